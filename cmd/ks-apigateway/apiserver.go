@@ -24,12 +24,18 @@ import (
 	// Install apis
 	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authenticate"
 	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/clientip"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/requestinfo"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/resourcesgrpc"
 	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/swagger"
 )
 
 func main() {
+	httpserver.RegisterDevDirective("clientip", "jwt")
 	httpserver.RegisterDevDirective("authenticate", "jwt")
+	httpserver.RegisterDevDirective("requestinfo", "jwt")
 	httpserver.RegisterDevDirective("authentication", "jwt")
 	httpserver.RegisterDevDirective("swagger", "jwt")
+	httpserver.RegisterDevDirective("resourcesgrpc", "jwt")
 	caddymain.Run()
 }
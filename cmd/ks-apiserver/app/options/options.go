@@ -1,6 +1,8 @@
 package options
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 	genericoptions "kubesphere.io/kubesphere/pkg/options"
 )
@@ -10,6 +12,18 @@ type ServerRunOptions struct {
 
 	// istio pilot discovery service url
 	IstioPilotServiceURL string
+
+	// max concurrent searches of a multi kind search, 0 means GOMAXPROCS
+	SearchConcurrency int
+
+	// timeout of each search of a multi kind search
+	SearchBranchTimeout time.Duration
+
+	// estimated size in bytes above which a searched object is large, 0 means 1MiB
+	SearchLargeObjectThreshold int
+
+	// label selector scoping the workload, pod and service caches, every object is cached if empty
+	InformerLabelSelector string
 }
 
 func NewServerRunOptions() *ServerRunOptions {
@@ -17,6 +31,7 @@ func NewServerRunOptions() *ServerRunOptions {
 	s := ServerRunOptions{
 		GenericServerRunOptions: genericoptions.NewServerRunOptions(),
 		IstioPilotServiceURL:    "http://istio-pilot.istio-system.svc:8080/version",
+		SearchBranchTimeout:     10 * time.Second,
 	}
 
 	return &s
@@ -27,4 +42,8 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	s.GenericServerRunOptions.AddFlags(fs)
 
 	fs.StringVar(&s.IstioPilotServiceURL, "istio-pilot-service-url", "http://istio-pilot.istio-system.svc:8080/version", "istio pilot discovery service url")
+	fs.IntVar(&s.SearchConcurrency, "search-concurrency", 0, "max concurrent searches of a multi kind search, 0 means GOMAXPROCS")
+	fs.DurationVar(&s.SearchBranchTimeout, "search-branch-timeout", 10*time.Second, "timeout of each search of a multi kind search, results of searches timed out are reported as warnings")
+	fs.IntVar(&s.SearchLargeObjectThreshold, "search-large-object-threshold", 0, "estimated size in bytes above which keyword searches don't scan the annotation values of an object and results report it, 0 means 1MiB")
+	fs.StringVar(&s.InformerLabelSelector, "informer-label-selector", "", "label selector of the workloads, pods and services cached, e.g. kubesphere.io/workspace=ws1 for a deployment serving a workspace, searches of these kinds return partial results by design")
 }
@@ -30,7 +30,9 @@ import (
 	"kubesphere.io/kubesphere/pkg/filter"
 	"kubesphere.io/kubesphere/pkg/informers"
 	logging "kubesphere.io/kubesphere/pkg/models/log"
+	"kubesphere.io/kubesphere/pkg/models/resources"
 	"kubesphere.io/kubesphere/pkg/signals"
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
 	"log"
 	"net/http"
 )
@@ -65,6 +67,10 @@ func Run(s *options.ServerRunOptions) error {
 
 	var err error
 
+	if err := informers.SetLabelSelector(s.InformerLabelSelector); err != nil {
+		return fmt.Errorf("invalid informer label selector: %v", err)
+	}
+
 	waitForResourceSync()
 
 	container := runtime.Container
@@ -81,6 +87,10 @@ func Run(s *options.ServerRunOptions) error {
 	initializeESClientConfig()
 	initializeKialiConfig(s)
 
+	resources.SetSearchConcurrency(s.SearchConcurrency)
+	resources.SetSearchBranchTimeout(s.SearchBranchTimeout)
+	resources.SetLargeObjectThreshold(s.SearchLargeObjectThreshold)
+
 	if s.GenericServerRunOptions.InsecurePort != 0 {
 		err = http.ListenAndServe(fmt.Sprintf("%s:%d", s.GenericServerRunOptions.BindAddress, s.GenericServerRunOptions.InsecurePort), container)
 	}
@@ -157,6 +167,8 @@ func waitForResourceSync() {
 	informerFactory.Batch().V1().Jobs().Lister()
 	informerFactory.Batch().V1beta1().CronJobs().Lister()
 
+	informerFactory.Extensions().V1beta1().Ingresses().Lister()
+
 	informerFactory.Start(stopChan)
 	informerFactory.WaitForCacheSync(stopChan)
 
@@ -168,4 +180,6 @@ func waitForResourceSync() {
 	s2iInformerFactory.Start(stopChan)
 	s2iInformerFactory.WaitForCacheSync(stopChan)
 	log.Println("resources sync success")
+
+	go resources.SyncKindAliases(k8s.Client().Discovery(), stopChan)
 }
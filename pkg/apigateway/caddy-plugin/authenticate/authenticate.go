@@ -26,6 +26,10 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/recovery"
 )
 
 type Auth struct {
@@ -46,7 +50,9 @@ type User struct {
 	Extra    *map[string]interface{} `json:"extra,omitempty"`
 }
 
-func (h Auth) ServeHTTP(resp http.ResponseWriter, req *http.Request) (int, error) {
+func (h Auth) ServeHTTP(resp http.ResponseWriter, req *http.Request) (status int, err error) {
+	defer recovery.Recover("authenticate", resp, req, &status, &err)
+
 	for _, path := range h.Rule.ExceptedPath {
 		if httpserver.Path(req.URL.Path).Matches(path) {
 			return h.Next.ServeHTTP(resp, req)
@@ -79,10 +85,10 @@ func (h Auth) ServeHTTP(resp http.ResponseWriter, req *http.Request) (int, error
 
 func (h Auth) InjectContext(req *http.Request, token *jwt.Token) (*http.Request, error) {
 
-	payLoad, ok := token.Claims.(jwt.MapClaims)
+	u, err := TokenUser(token)
 
-	if !ok {
-		return nil, errors.New("invalid payload")
+	if err != nil {
+		return nil, err
 	}
 
 	for header := range req.Header {
@@ -91,10 +97,43 @@ func (h Auth) InjectContext(req *http.Request, token *jwt.Token) (*http.Request,
 		}
 	}
 
+	if u.Name != "" {
+		req.Header.Set("X-Token-Username", u.Name)
+	}
+
+	if u.UID != "" {
+		req.Header.Set("X-Token-UID", u.UID)
+	}
+
+	if len(u.Groups) > 0 {
+		req.Header.Set("X-Token-Groups", strings.Join(u.Groups, ","))
+	}
+
+	// the headers are the backends', the plugins behind take the user of the context, which the
+	// clients can't set
+	if u.Name != "" {
+		req = req.WithContext(request.WithUser(req.Context(), u))
+	}
+
+	return req, nil
+}
+
+// TokenUser returns the user of the claims of a validated token, its name is empty if the claims
+// name no user
+func TokenUser(token *jwt.Token) (*user.DefaultInfo, error) {
+
+	payLoad, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return nil, errors.New("invalid payload")
+	}
+
+	u := &user.DefaultInfo{}
+
 	username, ok := payLoad["username"].(string)
 
 	if ok && username != "" {
-		req.Header.Set("X-Token-Username", username)
+		u.Name = username
 	}
 
 	uid := payLoad["uid"]
@@ -102,10 +141,10 @@ func (h Auth) InjectContext(req *http.Request, token *jwt.Token) (*http.Request,
 	if uid != nil {
 		switch uid.(type) {
 		case int:
-			req.Header.Set("X-Token-UID", strconv.Itoa(uid.(int)))
+			u.UID = strconv.Itoa(uid.(int))
 			break
 		case string:
-			req.Header.Set("X-Token-UID", uid.(string))
+			u.UID = uid.(string)
 			break
 		}
 	}
@@ -113,10 +152,10 @@ func (h Auth) InjectContext(req *http.Request, token *jwt.Token) (*http.Request,
 	groups, ok := payLoad["groups"].([]string)
 
 	if ok && len(groups) > 0 {
-		req.Header.Set("X-Token-Groups", strings.Join(groups, ","))
+		u.Groups = groups
 	}
 
-	return req, nil
+	return u, nil
 }
 
 func (h Auth) Validate(uToken string) (*jwt.Token, error) {
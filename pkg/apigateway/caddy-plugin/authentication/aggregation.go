@@ -0,0 +1,123 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// clusterRoleSelector lists the cluster roles matching a label selector
+type clusterRoleSelector func(selector labels.Selector) ([]*v1.ClusterRole, error)
+
+// clusterRoleRules returns the rules of clusterRole, united with the rules of the cluster roles its
+// aggregation rule selects
+func clusterRoleRules(clusterRole *v1.ClusterRole, selectRoles clusterRoleSelector, version *rbacVersion) ([]v1.PolicyRule, error) {
+	roles, err := expandClusterRole(clusterRole, selectRoles, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]v1.PolicyRule, 0, len(clusterRole.Rules))
+	for _, role := range roles {
+		rules = append(rules, role.Rules...)
+	}
+
+	return rules, nil
+}
+
+// compiledClusterRoleRules returns the compiled rules of clusterRole and of the cluster roles its
+// aggregation rule selects
+func compiledClusterRoleRules(clusterRole *v1.ClusterRole, selectRoles clusterRoleSelector, version *rbacVersion) ([]compiledRule, error) {
+	roles, err := expandClusterRole(clusterRole, selectRoles, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the rules of roles aggregating nothing are the compiled ones of the store, never appended to
+	if len(roles) == 1 {
+		return compiledRoles.clusterRoleRules(clusterRole), nil
+	}
+
+	rules := make([]compiledRule, 0, len(clusterRole.Rules))
+	for _, role := range roles {
+		rules = append(rules, compiledRoles.clusterRoleRules(role)...)
+	}
+
+	return rules, nil
+}
+
+// expandClusterRole returns clusterRole and the cluster roles its aggregation rule selects, aggregated
+// roles selecting further roles are expanded in turn. Every role is expanded once, so roles selecting
+// each other don't loop.
+func expandClusterRole(clusterRole *v1.ClusterRole, selectRoles clusterRoleSelector, version *rbacVersion) ([]*v1.ClusterRole, error) {
+	roles := make([]*v1.ClusterRole, 0, 1)
+	expanded := map[string]bool{clusterRole.Name: true}
+	pending := []*v1.ClusterRole{clusterRole}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		version.observe(current)
+		roles = append(roles, current)
+
+		if current.AggregationRule == nil {
+			continue
+		}
+
+		for i := range current.AggregationRule.ClusterRoleSelectors {
+			selector, err := metav1.LabelSelectorAsSelector(&current.AggregationRule.ClusterRoleSelectors[i])
+
+			if err != nil {
+				return nil, evaluationFailed(err)
+			}
+
+			selected, err := selectRoles(selector)
+
+			if err != nil {
+				return nil, evaluationFailed(err)
+			}
+
+			for _, role := range selected {
+				if !expanded[role.Name] {
+					expanded[role.Name] = true
+					pending = append(pending, role)
+				}
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+// selectFrom selects cluster roles among clusterRoles
+func selectFrom(clusterRoles []v1.ClusterRole) clusterRoleSelector {
+	return func(selector labels.Selector) ([]*v1.ClusterRole, error) {
+		selected := make([]*v1.ClusterRole, 0)
+		for i := range clusterRoles {
+			if selector.Matches(labels.Set(clusterRoles[i].Labels)) {
+				selected = append(selected, &clusterRoles[i])
+			}
+		}
+		return selected, nil
+	}
+}
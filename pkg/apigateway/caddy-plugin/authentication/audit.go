@@ -0,0 +1,223 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/clientip"
+)
+
+const (
+	// the audit log written to the standard error rather than a file
+	auditStderr         = "stderr"
+	defaultAuditMaxSize = 100 << 20
+	// rotated files kept besides the current one, the oldest is removed
+	auditBackups   = 5
+	auditQueueSize = 1000
+)
+
+var auditDropped = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "authentication_audit_events_dropped_total",
+	Help: "Number of decisions left out of the audit log because its buffer was full.",
+})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(auditDropped); err != nil {
+		log.Printf("[ERROR] authentication: register audit metrics: %v", err)
+	}
+}
+
+// auditEvent is a line of the audit log
+type auditEvent struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Groups      []string  `json:"groups,omitempty"`
+	Verb        string    `json:"verb"`
+	APIGroup    string    `json:"apiGroup,omitempty"`
+	APIVersion  string    `json:"apiVersion,omitempty"`
+	Resource    string    `json:"resource,omitempty"`
+	Subresource string    `json:"subresource,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	// the URL path of the non-resource requests
+	Path      string `json:"path,omitempty"`
+	SourceIP  string `json:"sourceIP"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Allowed   bool   `json:"allowed"`
+	// reason of a denial, see the Reason constants
+	Reason         string  `json:"reason,omitempty"`
+	LatencySeconds float64 `json:"latencySeconds"`
+}
+
+// auditSink is where the lines of the audit log are written
+type auditSink interface {
+	write(line []byte) error
+	close() error
+}
+
+// writerSink writes the audit log to a stream it doesn't own, like the standard error
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) write(line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+func (s writerSink) close() error {
+	return nil
+}
+
+// auditLogger writes the denials of the gateway, and the permissions if allowed, to a sink as JSON
+// lines. The lines are written by a goroutine from a bounded queue, decisions are dropped if the
+// queue is full, so the request never waits for the sink.
+type auditLogger struct {
+	sink    auditSink
+	allowed bool
+	now     func() time.Time
+
+	queue chan auditEvent
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// newAuditLogger returns a logger writing to sink until it is closed
+func newAuditLogger(sink auditSink, allowed bool, queueSize int) *auditLogger {
+	l := &auditLogger{
+		sink:    sink,
+		allowed: allowed,
+		now:     time.Now,
+		queue:   make(chan auditEvent, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// record queues the decision of r, it never blocks. A nil logger records nothing.
+func (l *auditLogger) record(r *http.Request, attrs authorizer.Attributes, allowed bool, reason string, latency time.Duration) {
+	if l == nil || (allowed && !l.allowed) {
+		return
+	}
+
+	event := auditEvent{
+		Time:           l.now(),
+		User:           attrs.GetUser().GetName(),
+		Groups:         attrs.GetUser().GetGroups(),
+		Verb:           attrs.GetVerb(),
+		SourceIP:       clientip.FromRequest(r).String(),
+		UserAgent:      r.UserAgent(),
+		Allowed:        allowed,
+		Reason:         reason,
+		LatencySeconds: latency.Seconds(),
+	}
+
+	if attrs.IsResourceRequest() {
+		event.APIGroup = attrs.GetAPIGroup()
+		event.APIVersion = attrs.GetAPIVersion()
+		event.Resource = attrs.GetResource()
+		event.Subresource = attrs.GetSubresource()
+		event.Name = attrs.GetName()
+		event.Namespace = attrs.GetNamespace()
+	} else {
+		event.Path = attrs.GetPath()
+	}
+
+	select {
+	case l.queue <- event:
+	default:
+		auditDropped.Inc()
+	}
+}
+
+// recordRequest records the denial of r decided before its attributes were, e.g. of the
+// impersonation, with the attributes of the request of its user
+func (l *auditLogger) recordRequest(r *http.Request, reason string) {
+	if l == nil {
+		return
+	}
+
+	attrs, err := getAuthorizerAttributes(r.Context())
+
+	if err != nil {
+		u, _ := request.UserFrom(r.Context())
+		if u == nil {
+			u = &user.DefaultInfo{}
+		}
+		attrs = &authorizer.AttributesRecord{User: u, Verb: strings.ToLower(r.Method), Path: r.URL.Path}
+	}
+
+	l.record(r, attrs, false, reason, 0)
+}
+
+// run writes the queued decisions until the logger is closed, the decisions queued by then included
+func (l *auditLogger) run() {
+	defer close(l.done)
+
+	for {
+		select {
+		case event := <-l.queue:
+			l.write(event)
+		case <-l.stop:
+			for {
+				select {
+				case event := <-l.queue:
+					l.write(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes a line, failures are logged, they never fail the request
+func (l *auditLogger) write(event auditEvent) {
+	line, err := json.Marshal(event)
+
+	if err != nil {
+		log.Printf("[ERROR] authentication: encode audit event: %v", err)
+		return
+	}
+
+	if err := l.sink.write(append(line, '\n')); err != nil {
+		log.Printf("[ERROR] authentication: write audit log: %v", err)
+	}
+}
+
+// close writes the queued decisions and closes the sink, the decisions recorded later are dropped
+func (l *auditLogger) close() error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+	return l.sink.close()
+}
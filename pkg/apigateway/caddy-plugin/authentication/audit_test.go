@@ -0,0 +1,327 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// auditEvents decodes the lines of an audit log
+func auditEvents(t *testing.T, log []byte) []auditEvent {
+	var events []auditEvent
+
+	scanner := bufio.NewScanner(bytes.NewReader(log))
+	for scanner.Scan() {
+		var event auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("decode audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func TestAuditLog(t *testing.T) {
+	// alice reads only
+	readOnly := authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		return attrs.GetVerb() == "get", "", nil
+	})
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"developers"}}
+
+	for _, allowed := range []bool{false, true} {
+		var buffer bytes.Buffer
+
+		audit := newAuditLogger(writerSink{&buffer}, allowed, 10)
+		auth := Authentication{Rule: Rule{Path: "/"}, Next: next, Authorizer: readOnly, audit: audit}
+
+		for _, method := range []string{http.MethodGet, http.MethodDelete} {
+			r := newAuthorizedRequest(t, method, "/api/v1/namespaces/demo/pods/web", alice)
+			r.Header.Set("User-Agent", "kubectl/v1.15.0")
+			r.RemoteAddr = "10.0.0.1:1234"
+
+			if _, err := auth.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodPost, "/healthz", alice)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the queued decisions are written on close
+		if err := audit.close(); err != nil {
+			t.Fatal(err)
+		}
+
+		events := auditEvents(t, buffer.Bytes())
+
+		denials := events
+		if allowed {
+			if len(events) != 3 || !events[0].Allowed || events[0].Verb != "get" || events[0].Reason != "" {
+				t.Fatalf("expected the permission and the denials logged, got %+v", events)
+			}
+			denials = events[1:]
+		}
+
+		if len(denials) != 2 {
+			t.Fatalf("expected the denials logged, got %+v", events)
+		}
+
+		denial := denials[0]
+		if denial.Allowed || denial.Reason != ReasonRBACDeny || denial.User != "alice" || len(denial.Groups) == 0 || denial.Groups[0] != "developers" || denial.Verb != "delete" ||
+			denial.Resource != "pods" || denial.Namespace != "demo" || denial.Name != "web" || denial.Path != "" ||
+			denial.SourceIP != "10.0.0.1" || denial.UserAgent != "kubectl/v1.15.0" || denial.Time.IsZero() || denial.LatencySeconds < 0 {
+			t.Errorf("expected the denied delete of the pod logged, got %+v", denial)
+		}
+
+		// the non-resource requests are logged by path
+		if denial := denials[1]; denial.Path != "/healthz" || denial.Resource != "" || denial.Verb != "post" {
+			t.Errorf("expected the denied post of /healthz logged, got %+v", denial)
+		}
+	}
+}
+
+func TestAuditLogDenials(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "editor"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "create"}, APIGroups: []string{""}, Resources: []string{"pods", "configmaps"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "editor"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "editor"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	// a recent write makes denials in demo go through the recheck
+	writes := newRecentWrites(time.Minute)
+	writes.reader = &fakeRBACReader{}
+	writes.record("demo", "1")
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	tests := []struct {
+		name     string
+		auth     Authentication
+		request  func() *http.Request
+		status   int
+		reason   string
+		verb     string
+		resource string
+		path     string
+	}{
+		{
+			name: "impersonation",
+			auth: Authentication{Rule: Rule{Path: "/"}, Next: next},
+			request: func() *http.Request {
+				r := newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice)
+				r.Header.Set("Impersonate-User", "admin")
+				return r
+			},
+			status: http.StatusForbidden, reason: ReasonImpersonationDeny, verb: "get", resource: "pods",
+		},
+		{
+			name: "strict metadata",
+			auth: Authentication{Rule: Rule{Path: "/", StrictMetadataMaxBody: 256}, Next: next},
+			request: func() *http.Request {
+				body := `{"metadata":{"namespace":"other","name":"config"}}`
+				r := newAuthorizedRequest(t, http.MethodPost, "/api/v1/namespaces/demo/configmaps", alice)
+				r.Body = ioutil.NopCloser(strings.NewReader(body))
+				r.ContentLength = int64(len(body))
+				r.Header.Set("Content-Type", "application/json")
+				return r
+			},
+			status: http.StatusBadRequest, reason: ReasonMetadataMismatch, verb: "create", resource: "configmaps",
+		},
+		{
+			name: "recheck after a write",
+			auth: Authentication{Rule: Rule{Path: "/"}, Next: next, writes: writes},
+			request: func() *http.Request {
+				return newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/secrets/web", alice)
+			},
+			status: http.StatusForbidden, reason: ReasonRecheckDeny, verb: "get", resource: "secrets",
+		},
+		{
+			name: "bypass log",
+			auth: Authentication{Rule: Rule{Path: "/", DebugPath: "/debug/bypassed"}, Next: next, bypassed: newBypassLog(10)},
+			request: func() *http.Request {
+				return newAuthorizedRequest(t, http.MethodGet, "/debug/bypassed", alice)
+			},
+			status: http.StatusForbidden, reason: ReasonRBACDeny, verb: "get", path: "/debug/bypassed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+
+			test.auth.audit = newAuditLogger(writerSink{&buffer}, false, 10)
+
+			recorder := httptest.NewRecorder()
+			if _, err := test.auth.ServeHTTP(recorder, test.request()); err != nil {
+				t.Fatal(err)
+			}
+
+			if recorder.Code != test.status {
+				t.Fatalf("expected %d, got %d", test.status, recorder.Code)
+			}
+
+			if err := test.auth.audit.close(); err != nil {
+				t.Fatal(err)
+			}
+
+			events := auditEvents(t, buffer.Bytes())
+
+			if len(events) != 1 {
+				t.Fatalf("expected the denial logged once, got %+v", events)
+			}
+
+			if event := events[0]; event.Allowed || event.Reason != test.reason || event.User != "alice" || event.Verb != test.verb || event.Resource != test.resource || event.Path != test.path {
+				t.Errorf("expected the %s denial of %s %s%s logged, got %+v", test.reason, test.verb, test.resource, test.path, event)
+			}
+		})
+	}
+}
+
+// blockingSink holds the writes until release is closed
+type blockingSink struct {
+	release chan struct{}
+	lines   int
+}
+
+func (s *blockingSink) write(line []byte) error {
+	<-s.release
+	s.lines++
+	return nil
+}
+
+func (s *blockingSink) close() error {
+	return nil
+}
+
+func auditDroppedCount(t *testing.T) float64 {
+	var metric dto.Metric
+	if err := auditDropped.Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestAuditLogNeverBlocks(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	audit := newAuditLogger(sink, false, 2)
+
+	dropped := auditDroppedCount(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "list", Resource: "pods"}
+
+	// one in the sink, two queued, the others dropped
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			audit.record(r, attrs, false, ReasonRBACDeny, time.Millisecond)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("expected the decisions recorded without waiting for the sink")
+	}
+
+	close(sink.release)
+
+	if err := audit.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if written, lost := sink.lines, auditDroppedCount(t)-dropped; written+int(lost) != 10 || written > 3 || written < 2 {
+		t.Errorf("expected at most 3 decisions written and the others dropped, got %d written, %v dropped", written, lost)
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "audit.json")
+	audit := newAuditLogger(newRotatingFile(file, 300, auditBackups), false, 100)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "list", Resource: "pods"}
+
+	for i := 0; i < 20; i++ {
+		audit.record(r, attrs, false, ReasonRBACDeny, time.Millisecond)
+	}
+
+	if err := audit.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := filepath.Glob(file + "*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != auditBackups+1 {
+		t.Errorf("expected the log rotated into %d backups, got %v", auditBackups, matches)
+	}
+
+	for _, match := range matches {
+		content, err := ioutil.ReadFile(match)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(content) > 300 || !strings.HasSuffix(string(content), "\n") {
+			t.Errorf("expected %s holding whole lines up to 300 bytes, got %d bytes", match, len(content))
+		}
+	}
+}
@@ -21,17 +21,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/endpoints/request"
+	"log"
 	"net/http"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
 	"k8s.io/api/rbac/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/kubernetes/pkg/util/slice"
+	k8sinformers "k8s.io/client-go/informers"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/flowcontrol"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/recovery"
+	"kubesphere.io/kubesphere/pkg/constants"
 	"kubesphere.io/kubesphere/pkg/informers"
 	sliceutils "kubesphere.io/kubesphere/pkg/utils"
 )
@@ -39,38 +48,359 @@ import (
 type Authentication struct {
 	Rule Rule
 	Next httpserver.Handler
+
+	// recent requests bypassed authorization by excepted paths
+	bypassed *bypassLog
+	// workspace memberships added to the user before authorization
+	memberships *membershipCache
+	// reviews a sample of the decisions with the API server, disabled if nil
+	shadow *shadowEvaluator
+	// rechecks denials after RBAC writes through the gateway, disabled if nil
+	writes *recentWrites
+	// counts the decisions by resource and verb, disabled if nil
+	usage *usageCollector
+	// observes the latency of the decisions, disabled if nil
+	latency *latencyRecorder
+	// resolve the user in order, the user of the context if empty
+	identities []identitySource
+	// records a sample of the decisions for offline analysis, disabled if nil
+	samples *sampleRecorder
+	// the RBAC informer caches the decisions wait for, not waited for if nil
+	caches *cacheSync
+	// keeps the recent decisions, disabled if nil
+	decisions *decisionCache
+	// limits the requests of each user, disabled if nil
+	limiter *rateLimiter
+	// writes the decisions to the audit log, disabled if nil
+	audit *auditLogger
+	// Authorizer decides the requests, the roles bound in the shared informers decide them if nil
+	Authorizer Authorizer
+	// the roles and bindings the written roles and bindings are verified against, the shared
+	// informers' if unset
+	listers Listers
+}
+
+// NewAuthentication returns the middleware enforcing rule in front of next, the requests are decided
+// by the authorizers of rule on the RBAC informers of factory. The indexes must be registered on
+// factory before.
+func NewAuthentication(rule Rule, next httpserver.Handler, factory k8sinformers.SharedInformerFactory) *Authentication {
+	return newAuthentication(rule, next, factory, nil)
+}
+
+// newAuthentication is NewAuthentication, the RBAC authorizer decides on resolver once it synced if
+// it isn't nil
+func newAuthentication(rule Rule, next httpserver.Handler, factory k8sinformers.SharedInformerFactory, resolver *subjectResolver) *Authentication {
+	listers := NewEvaluator(factory).Listers()
+	return &Authentication{Rule: rule, Next: next, Authorizer: newAuthorizer(rule, listers, resolver), listers: listers}
 }
 
 type Rule struct {
 	Path         string
 	ExceptedPath []string
+	// refuse to start if an excepted path shadows the protected path
+	StrictExceptions bool
+	// authorize the CORS preflight requests like the others, they are sent without credentials and
+	// pass unauthorized otherwise
+	StrictPreflight bool
+	// excepted paths matching more than this fraction of known routes are reported
+	ShadowThreshold float64
+	// path of the debug endpoint listing recent bypassed requests, disabled if empty. It's under the
+	// protected path, the users get it if they may get it as a non-resource URL.
+	DebugPath string
+	// the responses to the decisions carry the RBAC version they were made on in a header
+	RBACVersionHeader bool
+	// refuse to start if the service account misses critical permissions
+	RequirePermissions bool
+	// fraction of decisions compared with SubjectAccessReview, disabled if 0
+	ShadowSample float64
+	// denials within this window after a RBAC write are rechecked with the API server, disabled if 0
+	ReadYourWritesWindow time.Duration
+	// path of the endpoint exporting the counts of decisions by resource and verb, disabled if empty.
+	// It's under the protected path, so it's authorized as a non-resource URL.
+	UsagePath string
+	// decisions slower than this carry the trace ID of the request as exemplar, disabled if 0
+	ExemplarThreshold time.Duration
+	// sources of the user in order of priority, the user of the context if empty
+	IdentitySources []string
+	// PEM bundle of the CAs verifying the client certificates of the clientCert source
+	ClientCA string
+	// file of JSON lines the sampled decisions are recorded to, disabled if empty
+	SampleFile string
+	// fraction of the decisions recorded
+	SampleFraction float64
+	// the sample file is rotated beyond this size in bytes
+	SampleMaxSize int64
+	// file of the HMAC key pseudonymizing the user names of the samples, names are kept if empty
+	SampleKeyFile string
+	// leave the name of the user out of the message and the header of the denials
+	HideDeniedUser bool
+	// JSON bodies of creates and updates up to this size in bytes are rejected if the namespace or
+	// name of the object isn't the one of the path, disabled if 0
+	StrictMetadataMaxBody int64
+	// permissions are kept this long, a revoked role permits the requests decided before it until
+	// then, 5s by default, disabled if 0
+	DecisionCacheTTL time.Duration
+	// the least recently used permissions are evicted beyond this count
+	DecisionCacheSize int
+	// denials are kept this long, a granted role is denied the requests decided before it until
+	// then, 2s by default, disabled if 0
+	DenialCacheTTL time.Duration
+	// the least recently used denials are evicted beyond this count
+	DenialCacheSize int
+	// requests per second of each user, of each client address for the anonymous ones, disabled if 0
+	RateLimitQPS float64
+	// requests a user may send at once after a pause
+	RateLimitBurst int
+	// the users of these groups aren't limited
+	RateLimitExemptGroups []string
+	// the limits of the least recently seen users are dropped beyond this count
+	RateLimitUsers int
+	// decide the requests on the rules of the subjects resolved on the RBAC events, rather than on the
+	// bindings looked up on each request
+	SubjectResolver bool
+	// the evaluation of the roles of a request is given up after this long, answered 503, unlimited
+	// if 0
+	AuthorizationTimeout time.Duration
+	// registered authorizers consulted in order, the first permitting a request permits it, RBAC
+	// alone if empty
+	Authorizers []string
+	// policy endpoint of the external authorizer
+	ExternalAuthorizerURL string
+	// the calls to the policy endpoint are given up after this long
+	ExternalAuthorizerTimeout time.Duration
+	// the other authorizers decide the requests the policy endpoint doesn't decide, their
+	// authorization fails otherwise
+	ExternalAuthorizerFailOpen bool
+	// log the decision and latency of each authorizer of the chain, with the user unless
+	// HideDeniedUser
+	DebugAuthorizers bool
+	// the responses to the decisions of the roles name the binding and rule permitting the request,
+	// or count the bindings evaluated for a denial. They expose the RBAC topology to the users.
+	DebugMatches bool
+	// file of JSON lines the denials are written to, the standard error if "stderr", disabled if
+	// empty
+	AuditLog string
+	// the audit log file is rotated beyond this size in bytes
+	AuditMaxSize int64
+	// write the permitted requests to the audit log too
+	AuditAllowed bool
+	// address of the listener serving the metrics of the default registry on /metrics, disabled if
+	// empty. It's listened on from the first start to the final shutdown, reloads don't change it.
+	MetricsAddress string
 }
 
-func (c Authentication) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+func (c Authentication) ServeHTTP(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	defer recovery.Recover("authentication", w, r, &status, &err)
 
-	if httpserver.Path(r.URL.Path).Matches(c.Rule.Path) {
+	// the paths are matched cleaned, "/kapis/public/../secret" is "/kapis/secret" for the backend too
+	requestPath := cleanPath(r.URL.Path)
+
+	// the backends are given the path that was matched, they'd resolve the raw one their own way
+	if forwarded := forwardedPath(r.URL.Path); forwarded != r.URL.Path {
+		r.URL.Path = forwarded
+		r.URL.RawPath = ""
+	}
+
+	if httpserver.Path(requestPath).Matches(c.Rule.Path) {
 
 		for _, path := range c.Rule.ExceptedPath {
-			if httpserver.Path(r.URL.Path).Matches(path) {
+			if exceptionMatches(requestPath, path) {
+				bypassedRequests.WithLabelValues(path).Inc()
+				if c.bypassed != nil {
+					c.bypassed.record(r, path)
+				}
 				return c.Next.ServeHTTP(w, r)
 			}
 		}
 
+		if !c.Rule.StrictPreflight && isPreflight(r) {
+			return c.Next.ServeHTTP(w, r)
+		}
+
+		identified, err := c.identify(r)
+
+		if errors.Is(err, ErrUnauthenticated) {
+			return unauthenticated(w, r, err.Error()), nil
+		}
+
+		if err != nil {
+			return httpStatus(err), err
+		}
+
+		// the requests are limited by sender, whoever they impersonate
+		if c.limiter != nil {
+			if ok, retryAfter := c.limiter.allow(identified); !ok {
+				return rateLimited(w, r, retryAfter), nil
+			}
+		}
+
+		// the empty caches would deny everything and resolve no workspace right after the start
+		if c.caches != nil && !c.caches.ready() {
+			return syncing(w, r), nil
+		}
+
+		ctx, cancel := c.authorizationContext(identified.Context())
+		impersonated, refused, err := impersonate(ctx, c.authorizer(), identified)
+		cancel()
+
+		if errors.Is(err, ErrUnauthenticated) {
+			return unauthenticated(w, r, err.Error()), nil
+		}
+
+		if errors.Is(err, ErrAuthorizationTimeout) {
+			return deny(w, r, ReasonAuthorizationTimeout, k8serr.NewServiceUnavailable(err.Error())), nil
+		}
+
+		if err != nil {
+			return httpStatus(err), err
+		}
+
+		if refused != nil {
+			c.audit.recordRequest(identified, ReasonImpersonationDeny)
+			return deny(w, r, ReasonImpersonationDeny, refused), nil
+		}
+
+		r = c.enrichRequest(impersonated)
+
 		attrs, err := getAuthorizerAttributes(r.Context())
 
+		if errors.Is(err, ErrUnauthenticated) {
+			return unauthenticated(w, r, err.Error()), nil
+		}
+
+		// a misordered plugin chain, not a failure of the gateway
+		if errors.Is(err, ErrNoRequestInfo) {
+			return deny(w, r, ReasonNoRequestInfo, k8serr.NewBadRequest(err.Error())), nil
+		}
+
+		if err != nil {
+			return httpStatus(err), err
+		}
+
+		// the request info is the one of the forwarded path, a plugin between requestinfo and this one
+		// rewrote the path otherwise
+		if info, _ := request.RequestInfoFrom(r.Context()); info.Path != r.URL.Path {
+			return deny(w, r, ReasonNoRequestInfo, k8serr.NewBadRequest(fmt.Sprintf("the request info of path %q was resolved on path %q", r.URL.Path, info.Path))), nil
+		}
+
+		if c.bypassed != nil && c.Rule.DebugPath != "" && requestPath == c.Rule.DebugPath {
+			return c.serveBypassLog(w, r, attrs.GetUser())
+		}
+
+		start := time.Now()
+
+		ctx, cancel = c.authorizationContext(r.Context())
+		defer cancel()
+
+		decisionCtx := ctx
+		var trace *decisionTrace
+		if c.Rule.DebugMatches {
+			trace = &decisionTrace{}
+			decisionCtx = withDecisionTrace(ctx, trace)
+		}
+
+		permitted, version, err := c.decisions.authorize(decisionCtx, c.authorizer(), attrs)
+
 		if err != nil {
-			return http.StatusInternalServerError, err
+			countDecision(attrs.GetAPIGroup(), false, err)
 		}
 
-		permitted, err := permissionValidate(attrs)
+		// not a denial, the roles of the user may permit the request
+		if errors.Is(err, ErrAuthorizationTimeout) {
+			return deny(w, r, ReasonAuthorizationTimeout, k8serr.NewServiceUnavailable(err.Error())), nil
+		}
 
 		if err != nil {
-			return http.StatusInternalServerError, err
+			return httpStatus(err), err
+		}
+
+		reason := ReasonRBACDeny
+
+		// the informer caches may not have the RBAC writes of the gateway yet
+		if !permitted && c.writes != nil {
+			var rechecked bool
+			if permitted, rechecked = c.writes.recheck(attrs); rechecked {
+				reason = ReasonRecheckDeny
+			}
+		}
+
+		countDecision(attrs.GetAPIGroup(), permitted, nil)
+
+		latency := time.Since(start)
+
+		if c.latency != nil {
+			c.latency.observe(r, latency)
+		}
+
+		if c.shadow != nil {
+			c.shadow.submit(attrs, permitted)
+		}
+
+		if c.usage != nil {
+			c.usage.observe(attrs, permitted)
+		}
+
+		if c.samples != nil {
+			c.samples.record(attrs, permitted, version)
+		}
+
+		if c.Rule.RBACVersionHeader {
+			w.Header().Set(rbacVersionHeader, version)
+		}
+
+		trace.setHeaders(w.Header(), permitted)
+
+		// the roles may permit anonymous requests, the others should authenticate
+		if !permitted && isAnonymous(attrs.GetUser()) {
+			c.audit.record(r, attrs, false, ReasonUnauthenticated, latency)
+			return unauthenticated(w, r, "authentication required"), nil
 		}
 
 		if !permitted {
-			err = k8serr.NewForbidden(schema.GroupResource{Group: attrs.GetAPIGroup(), Resource: attrs.GetResource()}, attrs.GetName(), fmt.Errorf("permission undefined"))
-			return handleForbidden(w, err), nil
+			c.audit.record(r, attrs, false, reason, latency)
+			withUser := !c.Rule.HideDeniedUser
+			w.Header().Set(deniedPermissionHeader, deniedPermissionFields(attrs, withUser))
+			forbidden := k8serr.NewForbidden(schema.GroupResource{Group: attrs.GetAPIGroup(), Resource: attrs.GetResource()}, attrs.GetName(), deniedPermission(attrs, withUser))
+			forbidden.ErrStatus.ResourceVersion = version
+			return deny(w, r, reason, forbidden), nil
+		}
+
+		if c.Rule.StrictMetadataMaxBody > 0 {
+			if mismatch := checkBodyMetadata(r, attrs, c.Rule.StrictMetadataMaxBody); mismatch != nil {
+				c.audit.record(r, attrs, false, ReasonMetadataMismatch, latency)
+				return deny(w, r, ReasonMetadataMismatch, mismatch), nil
+			}
+		}
+
+		escalation, err := c.checkEscalation(ctx, r, attrs)
+
+		if errors.Is(err, ErrAuthorizationTimeout) {
+			return deny(w, r, ReasonAuthorizationTimeout, k8serr.NewServiceUnavailable(err.Error())), nil
+		}
+
+		if err != nil {
+			return httpStatus(err), err
+		}
+
+		if escalation != nil {
+			c.audit.record(r, attrs, false, ReasonEscalationDeny, latency)
+			return deny(w, r, ReasonEscalationDeny, escalation), nil
+		}
+
+		c.audit.record(r, attrs, true, "", latency)
+
+		if attrs.IsResourceRequest() && attrs.GetVerb() == "watch" {
+			return c.serveWatch(w, r, attrs)
+		}
+
+		if c.usage != nil && requestPath == c.Rule.UsagePath {
+			return c.usage.ServeHTTP(w, r)
+		}
+
+		if c.writes != nil {
+			if scope, ok := writeScope(attrs); ok {
+				return c.writes.serve(c.Next, w, r, scope)
+			}
 		}
 	}
 
@@ -78,32 +408,216 @@ func (c Authentication) ServeHTTP(w http.ResponseWriter, r *http.Request) (int,
 
 }
 
-func handleForbidden(w http.ResponseWriter, err error) int {
-	message := fmt.Sprintf("Forbidden,%s", err.Error())
-	w.Header().Add("WWW-Authenticate", message)
-	return http.StatusForbidden
+// authorizationContext returns ctx given up after the authorization timeout of the rule, if any
+func (c *Authentication) authorizationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Rule.AuthorizationTimeout > 0 {
+		return context.WithTimeout(ctx, c.Rule.AuthorizationTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// deniedPermissionHeader carries the permission missing to a denied request, as key="value" pairs
+const deniedPermissionHeader = "X-Denied-Permission"
+
+// deniedPermission is the reason of a denial, it tells the permission the user misses like upstream,
+// with the version of resource requests. The name of the user is left out unless withUser.
+func deniedPermission(attrs authorizer.Attributes, withUser bool) error {
+	subject := "the user"
+	if withUser {
+		subject = fmt.Sprintf("user %q", attrs.GetUser().GetName())
+	}
+
+	if !attrs.IsResourceRequest() {
+		return fmt.Errorf("%s cannot %s path %q", subject, attrs.GetVerb(), attrs.GetPath())
+	}
+
+	resource := attrs.GetResource()
+	if attrs.GetSubresource() != "" {
+		resource += "/" + attrs.GetSubresource()
+	}
+
+	group := fmt.Sprintf("API group %q", attrs.GetAPIGroup())
+	if attrs.GetAPIVersion() != "" {
+		group = fmt.Sprintf("API group version %q", schema.GroupVersion{Group: attrs.GetAPIGroup(), Version: attrs.GetAPIVersion()})
+	}
+
+	scope := "at the cluster scope"
+	if attrs.GetNamespace() != "" {
+		scope = fmt.Sprintf("in the namespace %q", attrs.GetNamespace())
+	}
+
+	return fmt.Errorf("%s cannot %s resource %q in %s %s", subject, attrs.GetVerb(), resource, group, scope)
 }
 
-func permissionValidate(attrs authorizer.Attributes) (bool, error) {
+// deniedPermissionFields returns the value of the deniedPermissionHeader of a denial, like
+// verb="get", group="apps", resource="deployments", subresource="", namespace="demo", user="alice"
+func deniedPermissionFields(attrs authorizer.Attributes, withUser bool) string {
+	fields := make([]string, 0, 7)
+	field := func(key, value string) {
+		fields = append(fields, fmt.Sprintf("%s=%q", key, value))
+	}
+
+	field("verb", attrs.GetVerb())
 
-	permitted, err := clusterRoleValidate(attrs)
+	if attrs.IsResourceRequest() {
+		field("group", attrs.GetAPIGroup())
+		field("version", attrs.GetAPIVersion())
+		field("resource", attrs.GetResource())
+		field("subresource", attrs.GetSubresource())
+		field("namespace", attrs.GetNamespace())
+	} else {
+		field("path", attrs.GetPath())
+	}
+
+	if withUser {
+		field("user", attrs.GetUser().GetName())
+	}
+
+	return strings.Join(fields, ", ")
+}
+
+// Listers are the roles and bindings requests are evaluated against
+type Listers struct {
+	Roles               rbaclisters.RoleLister
+	RoleBindings        rbaclisters.RoleBindingLister
+	ClusterRoles        rbaclisters.ClusterRoleLister
+	ClusterRoleBindings rbaclisters.ClusterRoleBindingLister
+	// the role bindings indexed by subject, the role bindings of the namespace are listed if nil
+	RoleBindingSubjects cache.Indexer
+	// the cluster role bindings indexed by subject and by role, the cluster role bindings are listed
+	// if nil
+	ClusterRoleBindingSubjects cache.Indexer
+	// the cluster roles indexed by the wildcards they grant, the bindings of such roles aren't looked
+	// for first if nil
+	ClusterRoleWildcards cache.Indexer
+}
+
+func sharedListers() Listers {
+	return NewEvaluator(informers.SharedInformerFactory()).Listers()
+}
+
+// authorizer returns the authorizer of the middleware, the default one if unset
+func (c *Authentication) authorizer() Authorizer {
+	if c.Authorizer == nil {
+		return defaultAuthorizer
+	}
+	return c.Authorizer
+}
+
+// rbacListers returns the listers of the middleware, the shared ones if unset
+func (c *Authentication) rbacListers() Listers {
+	if c.listers.Roles == nil {
+		return sharedListers()
+	}
+	return c.listers
+}
+
+// permissionValidate decides on listers, on the shared ones if unset
+func permissionValidate(ctx context.Context, listers Listers, attrs authorizer.Attributes) (bool, string, error) {
+	if listers.Roles == nil {
+		listers = sharedListers()
+	}
+	return AuthorizeContext(ctx, listers, attrs)
+}
+
+// Authorize reports whether the roles of listers bound to the user permit the request, it's the
+// decision of the gateway.
+func Authorize(listers Listers, attrs authorizer.Attributes) (bool, error) {
+	permitted, _, err := AuthorizeVersion(listers, attrs)
+	return permitted, err
+}
+
+// AuthorizeVersion is Authorize, it also returns the highest resource version of the roles and
+// bindings consulted by the decision, empty if none has one.
+func AuthorizeVersion(listers Listers, attrs authorizer.Attributes) (bool, string, error) {
+	return AuthorizeContext(context.Background(), listers, attrs)
+}
+
+// AuthorizeContext is AuthorizeVersion giving up with ErrAuthorizationTimeout once ctx is done, the
+// context is checked between the bindings.
+func AuthorizeContext(ctx context.Context, listers Listers, attrs authorizer.Attributes) (bool, string, error) {
+	var version rbacVersion
+
+	decisionTraceFrom(ctx).record()
+
+	permitted, err := clusterRoleValidate(ctx, listers, attrs, "", &version)
 
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 
 	if permitted {
-		return true, nil
+		return true, version.String(), nil
 	}
 
-	if attrs.GetNamespace() != "" {
-		permitted, err = roleValidate(attrs)
+	// workspace roles grant the workspace resources of their workspace only
+	if workspace := requestWorkspace(attrs); workspace != "" {
+		permitted, err = clusterRoleValidate(ctx, listers, attrs, workspace, &version)
 
 		if err != nil {
-			return false, err
+			return false, "", err
 		}
 
 		if permitted {
+			return true, version.String(), nil
+		}
+	}
+
+	// roles grant resources of their namespace only, non resource requests are up to cluster roles
+	// like upstream, whatever namespace they carry
+	if attrs.IsResourceRequest() && attrs.GetNamespace() != "" {
+		permitted, err = roleValidate(ctx, listers, attrs, &version)
+
+		if err != nil {
+			return false, "", err
+		}
+
+		if permitted {
+			return true, version.String(), nil
+		}
+	}
+
+	return false, version.String(), nil
+}
+
+func roleValidate(ctx context.Context, listers Listers, attrs authorizer.Attributes, version *rbacVersion) (bool, error) {
+	trace := decisionTraceFrom(ctx)
+
+	roleBindings, err := userRoleBindings(listers, attrs.GetNamespace(), attrs.GetUser())
+
+	if err != nil {
+		return false, evaluationFailed(err)
+	}
+
+	// roles already checked against the request, further bindings of them can't permit it
+	checked := make(map[string]bool)
+
+	for _, roleBinding := range roleBindings {
+		if ctx.Err() != nil {
+			return false, evaluationAborted(ctx)
+		}
+
+		version.observe(roleBinding)
+
+		if checked[roleRefKey(roleBinding.RoleRef)] || !appliesTo(roleBinding.Subjects, attrs.GetUser(), roleBinding.Namespace) {
+			continue
+		}
+
+		checked[roleRefKey(roleBinding.RoleRef)] = true
+		trace.evaluate()
+
+		rules, err := boundCompiledRules(listers, attrs.GetNamespace(), roleBinding.RoleRef, version)
+
+		if grantsNothing(err) {
+			continue
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if rule := compiledRulesMatch(rules, attrs); rule >= 0 {
+			trace.match(roleBinding.Namespace, roleBinding.Name, roleBinding.RoleRef, rule)
 			return true, nil
 		}
 	}
@@ -111,119 +625,333 @@ func permissionValidate(attrs authorizer.Attributes) (bool, error) {
 	return false, nil
 }
 
-func roleValidate(attrs authorizer.Attributes) (bool, error) {
-	roleBindingLister := informers.SharedInformerFactory().Rbac().V1().RoleBindings().Lister()
-	roleLister := informers.SharedInformerFactory().Rbac().V1().Roles().Lister()
-	roleBindings, err := roleBindingLister.RoleBindings(attrs.GetNamespace()).List(labels.Everything())
+// boundRules returns the role a role binding of namespace refers to and its rules, role bindings
+// refer to a role of their namespace or to a cluster role granted in their namespace only.
+func boundRules(listers Listers, namespace string, roleRef v1.RoleRef, version *rbacVersion) ([]v1.PolicyRule, error) {
+	if err := checkRoleRef(roleRef, "Role", "ClusterRole"); err != nil {
+		return nil, err
+	}
+
+	if roleRef.Kind == "ClusterRole" {
+		clusterRole, err := getClusterRole(listers.ClusterRoles, roleRef)
+		if err != nil {
+			return nil, err
+		}
+		return clusterRoleRules(clusterRole, listers.ClusterRoles.List, version)
+	}
+
+	role, err := getRole(listers.Roles, namespace, roleRef)
+	if err != nil {
+		return nil, err
+	}
+	version.observe(role)
+	return role.Rules, nil
+}
+
+// boundCompiledRules is boundRules returning the compiled rules
+func boundCompiledRules(listers Listers, namespace string, roleRef v1.RoleRef, version *rbacVersion) ([]compiledRule, error) {
+	if err := checkRoleRef(roleRef, "Role", "ClusterRole"); err != nil {
+		return nil, err
+	}
+
+	if roleRef.Kind == "ClusterRole" {
+		clusterRole, err := getClusterRole(listers.ClusterRoles, roleRef)
+		if err != nil {
+			return nil, err
+		}
+		return compiledClusterRoleRules(clusterRole, listers.ClusterRoles.List, version)
+	}
 
+	role, err := getRole(listers.Roles, namespace, roleRef)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	version.observe(role)
+	return compiledRoles.roleRules(role), nil
+}
 
-	fullSource := attrs.GetResource()
+// getRole returns the role of namespace roleRef refers to, ErrRoleNotFound if it's missing
+func getRole(lister rbaclisters.RoleLister, namespace string, roleRef v1.RoleRef) (*v1.Role, error) {
+	role, err := lister.Roles(namespace).Get(roleRef.Name)
+	if k8serr.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: role %s/%s", ErrRoleNotFound, namespace, roleRef.Name)
+	}
+	if err != nil {
+		return nil, evaluationFailed(err)
+	}
+	return role, nil
+}
 
-	if attrs.GetSubresource() != "" {
-		fullSource = fullSource + "/" + attrs.GetSubresource()
+// checkRoleRef returns ErrInvalidRoleRef unless roleRef refers to a role of the RBAC API of one of
+// kinds. The API group is empty in the objects built without the defaults of the API server.
+func checkRoleRef(roleRef v1.RoleRef, kinds ...string) error {
+	if roleRef.APIGroup != "" && roleRef.APIGroup != v1.GroupName {
+		return fmt.Errorf("%w: %s %s of API group %s", ErrInvalidRoleRef, roleRef.Kind, roleRef.Name, roleRef.APIGroup)
 	}
 
-	for _, roleBinding := range roleBindings {
+	if !sliceutils.HasString(kinds, roleRef.Kind) {
+		return fmt.Errorf("%w: %s %s isn't a %s", ErrInvalidRoleRef, roleRef.Kind, roleRef.Name, strings.Join(kinds, " or "))
+	}
 
-		for _, subj := range roleBinding.Subjects {
+	return nil
+}
 
-			if (subj.Kind == v1.UserKind && subj.Name == attrs.GetUser().GetName()) ||
-				(subj.Kind == v1.GroupKind && slice.ContainsString(attrs.GetUser().GetGroups(), subj.Name, nil)) {
-				role, err := roleLister.Roles(attrs.GetNamespace()).Get(roleBinding.RoleRef.Name)
+// getClusterRole returns the cluster role roleRef refers to, ErrRoleNotFound if it's missing
+func getClusterRole(lister rbaclisters.ClusterRoleLister, roleRef v1.RoleRef) (*v1.ClusterRole, error) {
+	if err := checkRoleRef(roleRef, "ClusterRole"); err != nil {
+		return nil, err
+	}
+	clusterRole, err := lister.Get(roleRef.Name)
+	if k8serr.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: cluster role %s", ErrRoleNotFound, roleRef.Name)
+	}
+	if err != nil {
+		return nil, evaluationFailed(err)
+	}
+	return clusterRole, nil
+}
 
-				if err != nil {
-					return false, err
-				}
+// skippedBindingLogs limits the warnings about the bindings granting nothing, they are evaluated on
+// every request of their subjects
+var skippedBindingLogs = flowcontrol.NewTokenBucketRateLimiter(skippedBindingLogQPS, 1)
 
-				for _, rule := range role.Rules {
-					if ruleMatchesRequest(rule, attrs.GetAPIGroup(), "", attrs.GetResource(), attrs.GetSubresource(), attrs.GetName(), attrs.GetVerb()) {
-						return true, nil
-					}
-				}
-			}
+const skippedBindingLogQPS = 0.1
+
+// grantsNothing reports whether err is the one of a binding referring to a missing role, or to
+// something else than a role, which is skipped. The binding is logged, at most every 10s.
+func grantsNothing(err error) bool {
+	if !errors.Is(err, ErrRoleNotFound) && !errors.Is(err, ErrInvalidRoleRef) {
+		return false
+	}
+
+	if skippedBindingLogs.TryAccept() {
+		log.Printf("[WARNING] authentication: skip binding: %v", err)
+	}
+
+	return true
+}
+
+// clusterRoleValidate evaluates the cluster role bindings of workspace, the ones granting their role
+// cluster wide if it's empty
+func clusterRoleValidate(ctx context.Context, listers Listers, attrs authorizer.Attributes, workspace string, version *rbacVersion) (bool, error) {
+	trace := decisionTraceFrom(ctx)
+
+	// a binding of a role granting everything, like cluster-admin, permits the request whatever the
+	// other bindings
+	binding, role, err := wildcardBinding(listers, attrs, workspace)
+	if err != nil {
+		return false, evaluationFailed(err)
+	}
+
+	if binding != nil {
+		version.observe(binding)
+		version.observe(role)
+		trace.evaluate()
+		trace.match("", binding.Name, binding.RoleRef, compiledRulesMatch(compiledRoles.clusterRoleRules(role), attrs))
+		return true, nil
+	}
+
+	clusterRoleBindings, err := userClusterRoleBindings(listers, attrs.GetUser())
+	if err != nil {
+		return false, evaluationFailed(err)
+	}
+
+	if len(clusterRoleBindings) >= concurrentBindings {
+		return evaluateConcurrently(ctx, listers, attrs, workspace, clusterRoleBindings, version, trace)
+	}
+
+	// cluster roles already checked against the request, further bindings of them can't permit it
+	checked := make(map[string]bool)
+
+	for _, clusterRoleBinding := range clusterRoleBindings {
+		if ctx.Err() != nil {
+			return false, evaluationAborted(ctx)
+		}
+		if permitted, err := clusterRoleBindingPermits(listers, attrs, workspace, clusterRoleBinding, checked, version, trace); err != nil || permitted {
+			return permitted, err
 		}
 	}
 
 	return false, nil
 }
 
-func clusterRoleValidate(attrs authorizer.Attributes) (bool, error) {
-	clusterRoleBindingLister := informers.SharedInformerFactory().Rbac().V1().ClusterRoleBindings().Lister()
-	clusterRoleBindings, err := clusterRoleBindingLister.List(labels.Everything())
-	clusterRoleLister := informers.SharedInformerFactory().Rbac().V1().ClusterRoles().Lister()
+// clusterRoleBindingPermits reports whether the cluster role binding permits the request, the
+// bindings of the cluster roles of checked are skipped and the one of the binding is added. The
+// evaluation and the match are recorded in trace.
+func clusterRoleBindingPermits(listers Listers, attrs authorizer.Attributes, workspace string, clusterRoleBinding *v1.ClusterRoleBinding, checked map[string]bool, version *rbacVersion, trace *decisionTrace) (bool, error) {
+	version.observe(clusterRoleBinding)
+
+	if workspaceOf(clusterRoleBinding) != workspace || checked[roleRefKey(clusterRoleBinding.RoleRef)] || !appliesTo(clusterRoleBinding.Subjects, attrs.GetUser(), "") {
+		return false, nil
+	}
+
+	checked[roleRefKey(clusterRoleBinding.RoleRef)] = true
+	trace.evaluate()
+
+	clusterRole, err := getClusterRole(listers.ClusterRoles, clusterRoleBinding.RoleRef)
+
+	if grantsNothing(err) {
+		return false, nil
+	}
+
 	if err != nil {
 		return false, err
 	}
 
-	for _, clusterRoleBinding := range clusterRoleBindings {
+	rules, err := compiledClusterRoleRules(clusterRole, listers.ClusterRoles.List, version)
 
-		for _, subject := range clusterRoleBinding.Subjects {
+	if err != nil {
+		return false, err
+	}
 
-			if (subject.Kind == v1.UserKind && subject.Name == attrs.GetUser().GetName()) ||
-				(subject.Kind == v1.GroupKind && sliceutils.HasString(attrs.GetUser().GetGroups(), subject.Name)) {
+	rule := compiledRulesMatch(rules, attrs)
 
-				clusterRole, err := clusterRoleLister.Get(clusterRoleBinding.RoleRef.Name)
+	if rule < 0 {
+		return false, nil
+	}
 
-				if err != nil {
-					return false, err
-				}
+	trace.match("", clusterRoleBinding.Name, clusterRoleBinding.RoleRef, rule)
 
-				for _, rule := range clusterRole.Rules {
-					if attrs.IsResourceRequest() {
-						if ruleMatchesRequest(rule, attrs.GetAPIGroup(), "", attrs.GetResource(), attrs.GetSubresource(), attrs.GetName(), attrs.GetVerb()) {
-							return true, nil
-						}
-					} else {
-						if ruleMatchesRequest(rule, "", attrs.GetPath(), "", "", "", attrs.GetVerb()) {
-							return true, nil
-						}
-					}
+	return true, nil
+}
 
-				}
+// compiledRulesPermit reports whether one of rules permits the resource or non resource request
+func compiledRulesPermit(rules []compiledRule, attrs authorizer.Attributes) bool {
+	return compiledRulesMatch(rules, attrs) >= 0
+}
 
+// compiledRulesMatch returns the index of the first of rules permitting the resource or non resource
+// request, -1 if none does
+func compiledRulesMatch(rules []compiledRule, attrs authorizer.Attributes) int {
+	for i := range rules {
+		if attrs.IsResourceRequest() {
+			if rules[i].matches(attrs.GetAPIGroup(), attrs.GetAPIVersion(), "", attrs.GetResource(), attrs.GetSubresource(), attrs.GetName(), attrs.GetVerb()) {
+				return i
+			}
+		} else {
+			if rules[i].matches("", "", attrs.GetPath(), "", "", "", attrs.GetVerb()) {
+				return i
 			}
 		}
 	}
 
-	return false, nil
+	return -1
 }
 
-func ruleMatchesResources(rule v1.PolicyRule, apiGroup string, resource string, subresource string, resourceName string) bool {
+// workspaceOf returns the workspace a workspace role binding grants its role in, it's empty for the
+// cluster role bindings granting their role cluster wide
+func workspaceOf(binding *v1.ClusterRoleBinding) string {
+	return binding.Labels[constants.WorkspaceLabelKey]
+}
 
-	if resource == "" {
-		return false
+// requestWorkspace returns the workspace of the requests to the workspace resources of the kapis, like
+// /kapis/tenant.kubesphere.io/v1alpha2/workspaces/{workspace}/namespaces, empty for the others
+func requestWorkspace(attrs authorizer.Attributes) string {
+	if !attrs.IsResourceRequest() || attrs.GetResource() != "workspaces" || !strings.HasPrefix(attrs.GetPath(), "/kapis/") {
+		return ""
 	}
+	return attrs.GetName()
+}
 
-	if !sliceutils.HasString(rule.APIGroups, apiGroup) && !sliceutils.HasString(rule.APIGroups, v1.ResourceAll) {
+// appliesTo reports whether one of subjects is the user, one of its groups or its service account.
+// Service accounts of bindings in namespace default to namespace, it's empty for cluster bindings.
+func appliesTo(subjects []v1.Subject, u user.Info, namespace string) bool {
+	_, ok := matchingSubject(subjects, u, namespace)
+	return ok
+}
+
+// matchingSubject returns the first of subjects which is the user, one of its groups or its service
+// account, ok is false if none is.
+func matchingSubject(subjects []v1.Subject, u user.Info, namespace string) (subject v1.Subject, ok bool) {
+	for _, subject := range subjects {
+		if subjectMatches(subject, u, namespace) {
+			return subject, true
+		}
+	}
+	return v1.Subject{}, false
+}
+
+// subjectMatches reports whether subject is the user, one of its groups or its service account. The
+// kind of the subject alone tells which one it is, a group named like the user is never the user.
+// Users and groups are of the RBAC API group and service accounts of the core group, an empty group
+// is accepted for the users and groups of objects built without the defaults of the API server.
+func subjectMatches(subject v1.Subject, u user.Info, namespace string) bool {
+	switch subject.Kind {
+	case v1.UserKind:
+		return (subject.APIGroup == "" || subject.APIGroup == v1.GroupName) && subject.Name == u.GetName()
+	case v1.GroupKind:
+		return (subject.APIGroup == "" || subject.APIGroup == v1.GroupName) && sliceutils.HasString(u.GetGroups(), subject.Name)
+	case v1.ServiceAccountKind:
+		saNamespace := subject.Namespace
+		if saNamespace == "" {
+			saNamespace = namespace
+		}
+		return subject.APIGroup == "" && saNamespace != "" && serviceaccount.MakeUsername(saNamespace, subject.Name) == u.GetName()
+	default:
 		return false
 	}
+}
 
-	if len(rule.ResourceNames) > 0 && !sliceutils.HasString(rule.ResourceNames, resourceName) {
+// WithImplicitGroups adds the groups kube-apiserver puts every user in, the identities resolved
+// from tokens may lack them, the callers of the Evaluator add them to the users they authorize. Named users are in system:authenticated and the others, anonymous
+// included, in system:unauthenticated, users named like service accounts are in their groups.
+func WithImplicitGroups(u user.Info) user.Info {
+	implicit := []string{user.AllAuthenticated}
+
+	if u.GetName() == "" || u.GetName() == user.Anonymous {
+		implicit = []string{user.AllUnauthenticated}
+	}
+
+	if namespace, _, err := serviceaccount.SplitUsername(u.GetName()); err == nil {
+		implicit = append(implicit, serviceaccount.MakeGroupNames(namespace)...)
+	}
+
+	groups := append([]string{}, u.GetGroups()...)
+
+	for _, group := range implicit {
+		if !sliceutils.HasString(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+
+	if len(groups) == len(u.GetGroups()) {
+		return u
+	}
+
+	return &user.DefaultInfo{Name: u.GetName(), UID: u.GetUID(), Groups: groups, Extra: u.GetExtra()}
+}
+
+func roleRefKey(roleRef v1.RoleRef) string {
+	return roleRef.Kind + "/" + roleRef.Name
+}
+
+func ruleMatchesResources(rule v1.PolicyRule, apiGroup string, apiVersion string, resource string, subresource string, resourceName string) bool {
+
+	if resource == "" {
 		return false
 	}
 
-	combinedResource := resource
+	if !apiGroupMatches(rule.APIGroups, apiGroup, apiVersion) {
+		return false
+	}
 
-	if subresource != "" {
-		combinedResource = combinedResource + "/" + subresource
+	if len(rule.ResourceNames) > 0 && !resourceNameMatches(rule.ResourceNames, resourceName) {
+		return false
 	}
 
 	for _, res := range rule.Resources {
 
 		// match "*"
-		if res == v1.ResourceAll || res == combinedResource {
+		if res == v1.ResourceAll || isCombinedResource(res, resource, subresource) {
 			return true
 		}
 
 		// match "*/subresource"
-		if len(subresource) > 0 && strings.HasPrefix(res, "*/") && subresource == strings.TrimLeft(res, "*/") {
+		if len(subresource) > 0 && strings.HasPrefix(res, "*/") && subresource == strings.TrimPrefix(res, "*/") {
 			return true
 		}
-		// match "resource/*"
-		if strings.HasSuffix(res, "/*") && resource == strings.TrimRight(res, "/*") {
+		// match "resource/*", the resource itself isn't matched like upstream
+		if prefix, ok := wildcardPrefix(res, "/*"); ok && len(subresource) > 0 && resource == prefix {
 			return true
 		}
 	}
@@ -231,19 +959,93 @@ func ruleMatchesResources(rule v1.PolicyRule, apiGroup string, resource string,
 	return false
 }
 
-func ruleMatchesRequest(rule v1.PolicyRule, apiGroup string, nonResourceURL string, resource string, subresource string, resourceName string, verb string) bool {
+// isCombinedResource reports whether res is "resource/subresource", or resource without subresource.
+// The combined resource isn't built, it would be allocated for every rule of long resource names.
+func isCombinedResource(res, resource, subresource string) bool {
+	if subresource == "" {
+		return res == resource
+	}
+	return len(res) == len(resource)+1+len(subresource) && res[len(resource)] == '/' &&
+		strings.HasPrefix(res, resource) && strings.HasSuffix(res, subresource)
+}
+
+// apiGroupMatches reports whether one of groups matches the group of the request. Our roles may
+// restrict a group to a version with a "group/version" entry, "apps/v1" or "/v1" for the core group,
+// "*/v1" matches v1 of every group. Such entries never match requests without version. The core group
+// is written "" or "core", the surrounding spaces of the entries are ignored.
+func apiGroupMatches(groups []string, apiGroup, apiVersion string) bool {
+	apiGroup = canonicalGroup(apiGroup)
+
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
 
-	if !sliceutils.HasString(rule.Verbs, verb) && !sliceutils.HasString(rule.Verbs, v1.VerbAll) {
+		if group == v1.ResourceAll || canonicalGroup(group) == apiGroup {
+			return true
+		}
+
+		i := strings.LastIndex(group, "/")
+		if apiVersion == "" || i < 0 || strings.TrimSpace(group[i+1:]) != apiVersion {
+			continue
+		}
+		if prefix := strings.TrimSpace(group[:i]); prefix == v1.ResourceAll || canonicalGroup(prefix) == apiGroup {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalGroup returns the empty name of the core group for "core", the other groups are unchanged
+func canonicalGroup(group string) string {
+	if group == "core" {
+		return ""
+	}
+	return group
+}
+
+// resourceNameMatches reports whether one of names matches the name of the request, "*" matches
+// every name like an empty list, requests without name included, and "prefix*" the names starting
+// with prefix.
+func resourceNameMatches(names []string, resourceName string) bool {
+	if sliceutils.HasString(names, resourceName) {
+		return true
+	}
+
+	for _, name := range names {
+		if name == v1.ResourceAll {
+			return true
+		}
+		if prefix, ok := wildcardPrefix(name, "*"); ok && resourceName != "" && strings.HasPrefix(resourceName, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ruleMatchesRequest(rule v1.PolicyRule, apiGroup string, apiVersion string, nonResourceURL string, resource string, subresource string, resourceName string, verb string) bool {
+
+	if !verbMatches(rule.Verbs, verb) {
 		return false
 	}
 
 	if nonResourceURL == "" {
-		return ruleMatchesResources(rule, apiGroup, resource, subresource, resourceName)
+		return ruleMatchesResources(rule, apiGroup, apiVersion, resource, subresource, resourceName)
 	} else {
 		return ruleMatchesNonResource(rule, nonResourceURL)
 	}
 }
 
+// verbMatches reports whether one of verbs is verb or "*", the verbs are walked once
+func verbMatches(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb || v == v1.VerbAll {
+			return true
+		}
+	}
+	return false
+}
+
 func ruleMatchesNonResource(rule v1.PolicyRule, nonResourceURL string) bool {
 
 	if nonResourceURL == "" {
@@ -259,6 +1061,10 @@ func ruleMatchesNonResource(rule v1.PolicyRule, nonResourceURL string) bool {
 	return false
 }
 
+// pathMatches matches path against the spec of a non resource rule segment by segment. A "*" segment
+// matches one segment of path, a trailing "*" the rest of path like upstream, "/apis/*" matches
+// "/apis/apps/v1" and "/healthz*" matches "/healthz/ping". The other segments, a trailing slash
+// included, must be equal.
 func pathMatches(path, spec string) bool {
 	if spec == "*" {
 		return true
@@ -266,30 +1072,66 @@ func pathMatches(path, spec string) bool {
 	if spec == path {
 		return true
 	}
-	if strings.HasSuffix(spec, "*") && strings.HasPrefix(path, strings.TrimRight(spec, "*")) {
-		return true
+	if !strings.Contains(spec, "*") {
+		return false
 	}
-	return false
+
+	specSegments := strings.Split(spec, "/")
+	pathSegments := strings.Split(path, "/")
+
+	for i, segment := range specSegments {
+		if i == len(specSegments)-1 {
+			if prefix, ok := wildcardPrefix(segment, "*"); ok {
+				return i < len(pathSegments) && strings.HasPrefix(strings.Join(pathSegments[i:], "/"), prefix)
+			}
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if segment == "*" && pathSegments[i] != "" {
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+
+	return len(specSegments) == len(pathSegments)
+}
+
+// wildcardPrefix returns pattern without its trailing wildcard, ok is false if pattern doesn't end
+// with wildcard. The wildcard is removed once, the characters before it are literal.
+func wildcardPrefix(pattern, wildcard string) (prefix string, ok bool) {
+	if !strings.HasSuffix(pattern, wildcard) {
+		return "", false
+	}
+	return strings.TrimSuffix(pattern, wildcard), true
 }
 
 func getAuthorizerAttributes(ctx context.Context) (authorizer.Attributes, error) {
 	attribs := authorizer.AttributesRecord{}
 
-	user, ok := request.UserFrom(ctx)
-	if ok {
-		attribs.User = user
+	u, ok := request.UserFrom(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
 	}
+	attribs.User = WithImplicitGroups(u)
 
 	requestInfo, found := request.RequestInfoFrom(ctx)
 	if !found {
-		return nil, errors.New("no RequestInfo found in the context")
+		return nil, ErrNoRequestInfo
 	}
 
 	// Start with common attributes that apply to resource and non-resource requests
 	attribs.ResourceRequest = requestInfo.IsResourceRequest
-	attribs.Path = requestInfo.Path
+	attribs.Path = cleanPath(requestInfo.Path)
 	attribs.Verb = requestInfo.Verb
 
+	// HEAD of non-resource paths is resolved to the head verb, probes are authorized like GET
+	if attribs.Verb == "head" {
+		attribs.Verb = "get"
+	}
+
 	attribs.APIGroup = requestInfo.APIGroup
 	attribs.APIVersion = requestInfo.APIVersion
 	attribs.Resource = requestInfo.Resource
@@ -297,5 +1139,46 @@ func getAuthorizerAttributes(ctx context.Context) (authorizer.Attributes, error)
 	attribs.Namespace = requestInfo.Namespace
 	attribs.Name = requestInfo.Name
 
+	if attribs.ResourceRequest {
+		attribs.Verb = streamingVerb(attribs.APIGroup, attribs.Resource, attribs.Subresource, attribs.Verb)
+	}
+
 	return &attribs, nil
 }
+
+// streamingVerb returns the verb kube-apiserver authorizes the streaming subresources of pods with.
+// exec, attach and portforward are created whether the stream is upgraded from a POST (SPDY) or a GET
+// (websocket), logs are only read. The proxy subresources keep the verb of the method, like the other
+// requests.
+func streamingVerb(apiGroup, resource, subresource, verb string) string {
+	if apiGroup != "" || resource != "pods" {
+		return verb
+	}
+
+	switch subresource {
+	case "exec", "attach", "portforward":
+		return "create"
+	case "log":
+		return "get"
+	default:
+		return verb
+	}
+}
+
+// cleanPath returns the path of a request with duplicate slashes collapsed, dot segments resolved
+// and without trailing slash, the way the paths of the rules are written.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+// forwardedPath returns the cleaned path forwarded to the backends, the trailing slash is kept
+func forwardedPath(p string) string {
+	cleaned := cleanPath(p)
+	if cleaned != "/" && strings.HasSuffix(p, "/") {
+		return cleaned + "/"
+	}
+	return cleaned
+}
@@ -0,0 +1,166 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication/authorizationtest"
+)
+
+func TestHeadRequests(t *testing.T) {
+	authorizationtest.Install(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "prober"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+			{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "prober"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "prober"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "prober"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := authentication.Authentication{Rule: authentication.Rule{Path: "/"}, Next: next}
+
+	prober := &user.DefaultInfo{Name: "prober"}
+	stranger := &user.DefaultInfo{Name: "stranger"}
+
+	tests := []struct {
+		method string
+		path   string
+		user   user.Info
+		status int
+	}{
+		{method: http.MethodHead, path: "/api/v1/namespaces/demo/pods/web", user: prober, status: http.StatusOK},
+		{method: http.MethodHead, path: "/healthz", user: prober, status: http.StatusOK},
+		{method: http.MethodHead, path: "/api/v1/namespaces/demo/services/web", user: prober, status: http.StatusForbidden},
+		{method: http.MethodHead, path: "/api/v1/namespaces/demo/pods/web", user: stranger, status: http.StatusForbidden},
+		{method: http.MethodHead, path: "/healthz", user: stranger, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		code, err := auth.ServeHTTP(recorder, authorizationtest.Request(t, test.method, test.path, test.user))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.status == http.StatusOK {
+			if code != http.StatusOK {
+				t.Errorf("%s %s of %s: expected permitted, got %d", test.method, test.path, test.user.GetName(), code)
+			}
+			continue
+		}
+
+		// the denial is written without body, caddy must not write an error page
+		if code != 0 || recorder.Code != http.StatusForbidden || recorder.Body.Len() != 0 || recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s of %s: expected written denial without body, got %d %d %q", test.method, test.path, test.user.GetName(), code, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	// denials of other methods carry the Status
+	recorder := httptest.NewRecorder()
+	code, err := auth.ServeHTTP(recorder, authorizationtest.Request(t, http.MethodGet, "/healthz", stranger))
+
+	if err != nil || code != 0 || recorder.Code != http.StatusForbidden || recorder.Body.Len() == 0 {
+		t.Errorf("expected written forbidden, got %d %d %v", code, recorder.Code, err)
+	}
+}
+
+func TestAuthorizerDecidesLikeTheGateway(t *testing.T) {
+	objects := append(authorizationtest.Admin("admin"), authorizationtest.Viewer("alice", "demo")...)
+
+	fake, err := authorizationtest.NewAuthorizer(objects...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizationtest.Install(t, objects...)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := authentication.Authentication{Rule: authentication.Rule{Path: "/"}, Next: next}
+
+	tests := []struct {
+		method string
+		path   string
+		user   string
+	}{
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "admin"},
+		{method: http.MethodGet, path: "/healthz", user: "admin"},
+		{method: http.MethodGet, path: "/apis/apps/v1/namespaces/demo/deployments", user: "alice"},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "alice"},
+		{method: http.MethodGet, path: "/api/v1/namespaces/other/pods", user: "alice"},
+		{method: http.MethodGet, path: "/healthz", user: "alice"},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", user: "bob"},
+	}
+
+	for _, test := range tests {
+		r := authorizationtest.Request(t, test.method, test.path, &user.DefaultInfo{Name: test.user})
+
+		status, err := auth.ServeHTTP(httptest.NewRecorder(), r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision, _, err := fake.Authorize(attributes(r))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if (status == http.StatusOK) != (decision == authorizer.DecisionAllow) {
+			t.Errorf("%s %s of %s: gateway returned %d, fake decided %v", test.method, test.path, test.user, status, decision)
+		}
+	}
+}
+
+// attributes are the attributes of a request the gateway authorizes
+func attributes(r *http.Request) authorizer.Attributes {
+	u, _ := request.UserFrom(r.Context())
+	info, _ := request.RequestInfoFrom(r.Context())
+
+	return &authorizer.AttributesRecord{
+		User:            u,
+		ResourceRequest: info.IsResourceRequest,
+		Path:            info.Path,
+		Verb:            info.Verb,
+		APIGroup:        info.APIGroup,
+		APIVersion:      info.APIVersion,
+		Resource:        info.Resource,
+		Subresource:     info.Subresource,
+		Namespace:       info.Namespace,
+		Name:            info.Name,
+	}
+}
@@ -0,0 +1,188 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+
+// Package authorizationtest provides an in-memory authorizer deciding like the gateway, and
+// fixtures of common users, for the tests of components built on the authorization.
+package authorizationtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	k8sinformers "k8s.io/client-go/informers"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/requestinfo"
+	"kubesphere.io/kubesphere/pkg/informers"
+)
+
+// requestInfoFactory resolves the request info like the gateway does
+var requestInfoFactory = requestinfo.NewResolver()
+
+// Authorizer decides on the roles and bindings it holds with the evaluation of the gateway, it
+// implements the authorizer of the API server.
+type Authorizer struct {
+	roles               cache.Indexer
+	roleBindings        cache.Indexer
+	clusterRoles        cache.Indexer
+	clusterRoleBindings cache.Indexer
+}
+
+var _ authorizer.Authorizer = &Authorizer{}
+
+// NewAuthorizer returns an authorizer holding objects, roles and bindings of the rbac/v1 API.
+func NewAuthorizer(objects ...runtime.Object) (*Authorizer, error) {
+	a := &Authorizer{
+		roles:               newIndexer(),
+		roleBindings:        newIndexer(),
+		clusterRoles:        newIndexer(),
+		clusterRoleBindings: newIndexer(),
+	}
+
+	if err := a.Add(objects...); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func newIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// Add adds or replaces roles and bindings.
+func (a *Authorizer) Add(objects ...runtime.Object) error {
+	for _, object := range objects {
+		var err error
+		switch object.(type) {
+		case *v1.Role:
+			err = a.roles.Update(object)
+		case *v1.RoleBinding:
+			err = a.roleBindings.Update(object)
+		case *v1.ClusterRole:
+			err = a.clusterRoles.Update(object)
+		case *v1.ClusterRoleBinding:
+			err = a.clusterRoleBindings.Update(object)
+		default:
+			err = fmt.Errorf("unsupported object %T", object)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Listers returns the listers of the roles and bindings held.
+func (a *Authorizer) Listers() authentication.Listers {
+	return authentication.Listers{
+		Roles:               rbaclisters.NewRoleLister(a.roles),
+		RoleBindings:        rbaclisters.NewRoleBindingLister(a.roleBindings),
+		ClusterRoles:        rbaclisters.NewClusterRoleLister(a.clusterRoles),
+		ClusterRoleBindings: rbaclisters.NewClusterRoleBindingLister(a.clusterRoleBindings),
+	}
+}
+
+// Authorize allows the requests the gateway permits, it has no opinion on the others.
+func (a *Authorizer) Authorize(attrs authorizer.Attributes) (authorizer.Decision, string, error) {
+	permitted, err := authentication.Authorize(a.Listers(), attrs)
+
+	if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+
+	if permitted {
+		return authorizer.DecisionAllow, "", nil
+	}
+
+	return authorizer.DecisionNoOpinion, "permission undefined", nil
+}
+
+// Install replaces the shared informer factory with one caching exactly objects, so that the
+// gateway decides on them.
+func Install(t testing.TB, objects ...runtime.Object) {
+	factory := k8sinformers.NewSharedInformerFactory(nil, 0)
+	rbac := factory.Rbac().V1()
+
+	for _, object := range objects {
+		var err error
+		switch object.(type) {
+		case *v1.Role:
+			err = rbac.Roles().Informer().GetIndexer().Add(object)
+		case *v1.RoleBinding:
+			err = rbac.RoleBindings().Informer().GetIndexer().Add(object)
+		case *v1.ClusterRole:
+			err = rbac.ClusterRoles().Informer().GetIndexer().Add(object)
+		case *v1.ClusterRoleBinding:
+			err = rbac.ClusterRoleBindings().Informer().GetIndexer().Add(object)
+		default:
+			err = fmt.Errorf("unsupported object %T", object)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	informers.SetSharedInformerFactory(factory)
+}
+
+// Admin returns a cluster role granting everything and its binding to the user named name.
+func Admin(name string) []runtime.Object {
+	role := "test-admin-" + name
+	return []runtime.Object{
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: role}, Rules: []v1.PolicyRule{
+			{Verbs: []string{v1.VerbAll}, APIGroups: []string{v1.APIGroupAll}, Resources: []string{v1.ResourceAll}},
+			{Verbs: []string{v1.VerbAll}, NonResourceURLs: []string{v1.NonResourceAll}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: role}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: role}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: name}}},
+	}
+}
+
+// Viewer returns a role granting to read everything in namespace and its binding to the user named name.
+func Viewer(name, namespace string) []runtime.Object {
+	role := "test-viewer-" + name
+	return []runtime.Object{
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: role}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{v1.APIGroupAll}, Resources: []string{v1.ResourceAll}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: role}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: role}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: name}}},
+	}
+}
+
+// Request returns a request of u carrying the request info resolved like the gateway does.
+func Request(t testing.TB, method, path string, u user.Info) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+
+	info, err := requestInfoFactory.NewRequestInfo(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r.WithContext(request.WithRequestInfo(request.WithUser(r.Context(), u), info))
+}
@@ -0,0 +1,67 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// Authorizer decides the requests passing the gateway. The string returned is the version of the
+// policy the decision was made on, empty if it has none. The error wraps ErrAuthorizationTimeout if
+// ctx is done before the decision, the request is neither permitted nor denied on an error.
+type Authorizer interface {
+	Authorize(ctx context.Context, attrs authorizer.Attributes) (permitted bool, version string, err error)
+}
+
+// rbacAuthorizer decides on the roles bound to the user, the version is the highest resource version
+// of the roles and bindings consulted
+type rbacAuthorizer struct {
+	listers Listers
+	// decides the requests once synced, the bindings of listers are looked up otherwise
+	resolver *subjectResolver
+}
+
+// NewRBACAuthorizer returns the authorizer of the gateway deciding on the roles and bindings of
+// listers, the shared informers' if they are unset
+func NewRBACAuthorizer(listers Listers) Authorizer {
+	return &rbacAuthorizer{listers: listers}
+}
+
+func (a *rbacAuthorizer) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	start := time.Now()
+	permitted, version, err := a.evaluate(ctx, attrs)
+	rbacEvaluationLatency.Observe(time.Since(start).Seconds())
+	return permitted, version, err
+}
+
+// evaluate decides on the resolver once it synced, on the bindings of the listers until then. The
+// requests registered for a special verb are decided on it.
+func (a *rbacAuthorizer) evaluate(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	attrs = deriveSpecialVerb(attrs)
+
+	if a.resolver != nil && a.resolver.ready() {
+		return a.resolver.authorize(ctx, attrs)
+	}
+	return permissionValidate(ctx, a.listers, attrs)
+}
+
+// defaultAuthorizer decides the requests of a middleware without authorizer
+var defaultAuthorizer = NewRBACAuthorizer(Listers{})
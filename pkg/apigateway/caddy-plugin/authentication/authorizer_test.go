@@ -0,0 +1,127 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication/authorizationtest"
+)
+
+// failingClusterRoleBindings fails to list the cluster role bindings
+type failingClusterRoleBindings struct{}
+
+func (failingClusterRoleBindings) List(labels.Selector) ([]*v1.ClusterRoleBinding, error) {
+	return nil, errors.New("cache unavailable")
+}
+
+func (failingClusterRoleBindings) Get(name string) (*v1.ClusterRoleBinding, error) {
+	return nil, errors.New("cache unavailable")
+}
+
+// authorizerFunc decides with a function
+type authorizerFunc func(attrs authorizer.Attributes) bool
+
+func (f authorizerFunc) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	return f(attrs), "", nil
+}
+
+func TestRBACAuthorizer(t *testing.T) {
+	fake, err := authorizationtest.NewAuthorizer(append(authorizationtest.Admin("admin"), authorizationtest.Viewer("alice", "demo")...)...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := fake.Listers()
+	failing.ClusterRoleBindings = failingClusterRoleBindings{}
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	// decided on the fake listers alone, the shared informers are never started
+	auth := authentication.Authentication{Rule: authentication.Rule{Path: "/"}, Next: next, Authorizer: authentication.NewRBACAuthorizer(fake.Listers())}
+	broken := authentication.Authentication{Rule: authentication.Rule{Path: "/"}, Next: next, Authorizer: authentication.NewRBACAuthorizer(failing)}
+
+	tests := []struct {
+		name   string
+		auth   authentication.Authentication
+		method string
+		path   string
+		user   string
+		status int
+		err    error
+	}{
+		{name: "admin", auth: auth, method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "admin", status: http.StatusOK},
+		{name: "viewer", auth: auth, method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", user: "alice", status: http.StatusOK},
+		{name: "viewer writing", auth: auth, method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "alice", status: http.StatusForbidden},
+		{name: "viewer of another namespace", auth: auth, method: http.MethodGet, path: "/api/v1/namespaces/other/pods", user: "alice", status: http.StatusForbidden},
+		{name: "unbound", auth: auth, method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", user: "bob", status: http.StatusForbidden},
+		{name: "failing listers", auth: broken, method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", user: "alice", status: http.StatusInternalServerError, err: authentication.ErrEvaluationFailed},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		status, err := test.auth.ServeHTTP(recorder, authorizationtest.Request(t, test.method, test.path, &user.DefaultInfo{Name: test.user}))
+
+		// the denials are written
+		if status == 0 {
+			status = recorder.Code
+		}
+
+		if status != test.status || !errors.Is(err, test.err) {
+			t.Errorf("%s: expected %d %v, got %d %v", test.name, test.status, test.err, status, err)
+		}
+	}
+}
+
+func TestSwappedAuthorizer(t *testing.T) {
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	// reads only, whoever the user
+	readOnly := authorizerFunc(func(attrs authorizer.Attributes) bool {
+		return attrs.IsReadOnly()
+	})
+
+	auth := authentication.Authentication{Rule: authentication.Rule{Path: "/"}, Next: next, Authorizer: readOnly}
+	bob := &user.DefaultInfo{Name: "bob"}
+
+	if status, err := auth.ServeHTTP(httptest.NewRecorder(), authorizationtest.Request(t, http.MethodGet, "/api/v1/namespaces/demo/pods", bob)); status != http.StatusOK || err != nil {
+		t.Errorf("expected the read permitted, got %d %v", status, err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	if _, err := auth.ServeHTTP(recorder, authorizationtest.Request(t, http.MethodDelete, "/api/v1/namespaces/demo/pods/web", bob)); recorder.Code != http.StatusForbidden || err != nil {
+		t.Errorf("expected the write denied, got %d %v", recorder.Code, err)
+	}
+}
@@ -18,14 +18,29 @@
 package authentication
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mholt/caddy"
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/clock"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
 
 	"kubesphere.io/kubesphere/pkg/informers"
 	"kubesphere.io/kubesphere/pkg/signals"
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
 )
 
 func init() {
@@ -44,32 +59,331 @@ func Setup(c *caddy.Controller) error {
 		return err
 	}
 
-	if err != nil {
+	if err := checkExceptions(rule); err != nil {
 		return err
 	}
 
+	// served without authorization otherwise
+	if rule.UsagePath != "" && !httpserver.Path(rule.UsagePath).Matches(rule.Path) {
+		return fmt.Errorf("authentication: usage path %s isn't under the protected path %s", rule.UsagePath, rule.Path)
+	}
+
+	if rule.DebugPath != "" && !httpserver.Path(rule.DebugPath).Matches(rule.Path) {
+		return fmt.Errorf("authentication: debug path %s isn't under the protected path %s", rule.DebugPath, rule.Path)
+	}
+
+	var shadow *shadowEvaluator
+	if rule.ShadowSample > 0 {
+		shadow = newShadowEvaluator(func(review *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+			return k8s.Client().AuthorizationV1().SubjectAccessReviews().Create(review)
+		}, rule.ShadowSample, shadowQueueSize, mismatchLogSize)
+	}
+
+	var writes *recentWrites
+	if rule.ReadYourWritesWindow > 0 {
+		writes = newRecentWrites(rule.ReadYourWritesWindow)
+	}
+
+	identities, err := newIdentitySources(rule)
+
+	if err != nil {
+		return c.Errf("authentication: %v", err)
+	}
+
+	if err := checkExternalAuthorizer(rule); err != nil {
+		return c.Errf("authentication: %v", err)
+	}
+
+	var usage *usageCollector
+	if rule.UsagePath != "" {
+		usage = newUsageCollector(usageBuckets)
+	}
+
+	var samples *sampleRecorder
+	if rule.SampleFile != "" {
+		var key []byte
+		if rule.SampleKeyFile != "" {
+			if key, err = ioutil.ReadFile(rule.SampleKeyFile); err != nil {
+				return c.Errf("authentication: read sample key: %v", err)
+			}
+			key = bytes.TrimSpace(key)
+			if len(key) == 0 {
+				return c.Errf("authentication: sample key %s is empty", rule.SampleKeyFile)
+			}
+		}
+		samples = newSampleRecorder(rule.SampleFile, rule.SampleFraction, rule.SampleMaxSize, key)
+		c.OnShutdown(samples.close)
+	}
+
+	var audit *auditLogger
+	if rule.AuditLog == auditStderr {
+		audit = newAuditLogger(writerSink{os.Stderr}, rule.AuditAllowed, auditQueueSize)
+	} else if rule.AuditLog != "" {
+		audit = newAuditLogger(newRotatingFile(rule.AuditLog, rule.AuditMaxSize, auditBackups), rule.AuditAllowed, auditQueueSize)
+	}
+	if audit != nil {
+		c.OnShutdown(audit.close)
+	}
+
+	var decisions *decisionCache
+	if rule.DecisionCacheTTL > 0 || rule.DenialCacheTTL > 0 {
+		decisions = newDecisionCache(rule.DecisionCacheTTL, rule.DecisionCacheSize, rule.DenialCacheTTL, rule.DenialCacheSize)
+	}
+
+	var limiter *rateLimiter
+	if rule.RateLimitQPS > 0 {
+		limiter = newRateLimiter(rule.RateLimitQPS, rule.RateLimitBurst, rule.RateLimitExemptGroups, rule.RateLimitUsers, clock.RealClock{})
+	}
+
+	// the reloads start the new servers before they stop the old ones, the listener is kept
+	if rule.MetricsAddress != "" {
+		metrics := newMetricsServer(rule.MetricsAddress)
+		c.OnFirstStartup(func() error {
+			if err := metrics.start(); err != nil {
+				return fmt.Errorf("authentication: listen for metrics: %v", err)
+			}
+			return nil
+		})
+		c.OnFinalShutdown(metrics.stop)
+	}
+
+	// the state the instance feeds from the RBAC informers, the other blocks and the reloads wire
+	// their own
+	wiring := newRBACWiring(sharedRBAC)
+
 	c.OnStartup(func() error {
-		stopChan := signals.SetupSignalHandler()
-		informerFactory := informers.SharedInformerFactory()
-		informerFactory.Rbac().V1().Roles().Lister()
-		informerFactory.Rbac().V1().RoleBindings().Lister()
-		informerFactory.Rbac().V1().ClusterRoles().Lister()
-		informerFactory.Rbac().V1().ClusterRoleBindings().Lister()
-		informerFactory.Start(stopChan)
-		informerFactory.WaitForCacheSync(stopChan)
+		if err := checkPermissions(k8s.Client().AuthorizationV1().SelfSubjectAccessReviews().Create, requiredPermissions, rule.RequirePermissions); err != nil {
+			return err
+		}
+		if err := wiring.start(informers.SharedInformerFactory()); err != nil {
+			return err
+		}
+		c.OnShutdown(wiring.stop)
+		if shadow != nil {
+			// the workers of the instance stop with it, the reloads start their own
+			stopChan := make(chan struct{})
+			shadow.start(shadowWorkers, stopChan)
+			c.OnShutdown(func() error {
+				close(stopChan)
+				return nil
+			})
+		}
+		if writes != nil {
+			writes.reader = &clientsetRBACReader{client: k8s.Client()}
+		}
 		fmt.Println("Authentication middleware is initiated")
 		return nil
 	})
 
 	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
-		return &Authentication{Next: next, Rule: rule}
+		informerFactory := informers.SharedInformerFactory()
+		// the listers see the indexes registered when they are built, the requests list the
+		// bindings otherwise. The first build is before the startup starts the informers.
+		if err := wiring.wire(informerFactory, rule.SubjectResolver); err != nil {
+			log.Printf("[WARNING] authentication: wire the RBAC informers: %v", err)
+		}
+		a := newAuthentication(rule, next, informerFactory, wiring.resolver)
+		a.bypassed = newBypassLog(bypassLogSize)
+		a.memberships = wiring.memberships
+		a.shadow = shadow
+		a.writes = writes
+		a.usage = usage
+		a.latency = newLatencyRecorder(rule.ExemplarThreshold)
+		a.identities = identities
+		a.samples = samples
+		a.caches = wiring.caches
+		a.decisions = decisions
+		a.limiter = limiter
+		a.audit = audit
+		return a
+	})
+	return nil
+}
+
+// sharedRBAC registers the indexes of the shared RBAC informers before they start
+var sharedRBAC = &rbacInformers{}
+
+// rbacInformers registers the indexes of the RBAC informers once, before it starts them, the indexers
+// can't be added to started informers. They run until the process is signaled, the instances wire
+// what they feed from the events in rbacWiring.
+type rbacInformers struct {
+	mutex      sync.Mutex
+	registered bool
+	stopChan   <-chan struct{}
+}
+
+// register registers the indexes of the informers of informerFactory on the first call, before the
+// informers start
+func (s *rbacInformers) register(informerFactory k8sinformers.SharedInformerFactory) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.registerLocked(informerFactory)
+}
+
+// registerLocked is register with s.mutex held
+func (s *rbacInformers) registerLocked(informerFactory k8sinformers.SharedInformerFactory) error {
+	if s.registered {
+		return nil
+	}
+
+	rbac := informerFactory.Rbac().V1()
+	rbac.Roles().Lister()
+	rbac.RoleBindings().Lister()
+	rbac.ClusterRoles().Lister()
+	rbac.ClusterRoleBindings().Lister()
+	if err := registerIndexes(informerFactory); err != nil {
+		return err
+	}
+	compiledRoles.watch(rbac.Roles().Informer(), rbac.ClusterRoles().Informer())
+	s.registered = true
+	return nil
+}
+
+// start registers the indexes on the first call and starts the informers, the started informers
+// aren't started again
+func (s *rbacInformers) start(informerFactory k8sinformers.SharedInformerFactory) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.registerLocked(informerFactory); err != nil {
+		return err
+	}
+
+	if s.stopChan == nil {
+		s.stopChan = signals.SetupSignalHandler()
+	}
+
+	informerFactory.Start(s.stopChan)
+
+	return nil
+}
+
+// rbacWiring is the state an instance feeds from the events of the RBAC informers. The event
+// handlers can't be removed from the informers, the ones of the stopped instances ignore the events.
+type rbacWiring struct {
+	informers   *rbacInformers
+	memberships *membershipCache
+	caches      *cacheSync
+	// decides the requests once synced if enabled, nil otherwise
+	resolver *subjectResolver
+	stopChan chan struct{}
+}
+
+func newRBACWiring(informers *rbacInformers) *rbacWiring {
+	return &rbacWiring{informers: informers, memberships: newMembershipCache(), caches: &cacheSync{}, stopChan: make(chan struct{})}
+}
+
+// wire registers the indexes of the informers if needed, the listers see the indexes registered when
+// they are built. The subject resolver is built on them if enabled.
+func (w *rbacWiring) wire(informerFactory k8sinformers.SharedInformerFactory, subjectResolver bool) error {
+	if err := w.informers.register(informerFactory); err != nil {
+		return err
+	}
+
+	if subjectResolver && w.resolver == nil {
+		w.resolver = newSubjectResolver(NewEvaluator(informerFactory).Listers())
+	}
+
+	return nil
+}
+
+// start adds the event handlers of the instance to the informers and starts them, the subject
+// resolver resyncs once the caches synced, the bindings are looked up until then
+func (w *rbacWiring) start(informerFactory k8sinformers.SharedInformerFactory) error {
+	rbac := informerFactory.Rbac().V1()
+	roles := stoppableInformer{rbac.Roles().Informer(), w.stopChan}
+	roleBindings := stoppableInformer{rbac.RoleBindings().Informer(), w.stopChan}
+	clusterRoles := stoppableInformer{rbac.ClusterRoles().Informer(), w.stopChan}
+	clusterRoleBindings := stoppableInformer{rbac.ClusterRoleBindings().Informer(), w.stopChan}
+
+	hasSynced := []cache.InformerSynced{roles.HasSynced, roleBindings.HasSynced, clusterRoles.HasSynced, clusterRoleBindings.HasSynced}
+
+	w.memberships.watch(clusterRoleBindings)
+	w.caches.track(hasSynced...)
+	go w.caches.wait(w.stopChan)
+
+	if w.resolver != nil {
+		w.resolver.watch(roles, roleBindings, clusterRoles, clusterRoleBindings)
+		go w.resolver.run(subjectResolverResync, w.stopChan, hasSynced...)
+	}
+
+	// the caches sync in the background, the decisions answer 503 meanwhile
+	return w.informers.start(informerFactory)
+}
+
+// stop stops the resolver of the instance, its event handlers ignore the events from then on
+func (w *rbacWiring) stop() error {
+	close(w.stopChan)
+	return nil
+}
+
+// stoppableInformer is a shared informer whose added event handlers ignore the events once stopCh is
+// closed
+type stoppableInformer struct {
+	cache.SharedIndexInformer
+	stopCh <-chan struct{}
+}
+
+func (i stoppableInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	i.SharedIndexInformer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			select {
+			case <-i.stopCh:
+				return false
+			default:
+				return true
+			}
+		},
+		Handler: handler,
 	})
+}
+
+// parseSwitch parses the on or off argument of the option of c
+func parseSwitch(c *caddy.Controller) (bool, error) {
+	option := c.Val()
+
+	if !c.NextArg() {
+		return false, c.ArgErr()
+	}
+
+	var on bool
+
+	switch c.Val() {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return false, c.Errf("%s must be on or off, got %s", option, c.Val())
+	}
+
+	if c.NextArg() {
+		return false, c.ArgErr()
+	}
+
+	return on, nil
+}
+
+// checkExceptions warns about excepted paths shadowing the protected path, it fails in strict mode.
+func checkExceptions(rule Rule) error {
+	warnings := validateExceptions(rule, sampleRoutes, rule.ShadowThreshold)
+
+	for _, warning := range warnings {
+		log.Printf("[WARNING] authentication: %s", warning)
+	}
+
+	if rule.StrictExceptions && len(warnings) > 0 {
+		return fmt.Errorf("authentication: excepted paths shadow the protected path %s: %s", rule.Path, strings.Join(warnings, "; "))
+	}
+
 	return nil
 }
 
 func parse(c *caddy.Controller) (Rule, error) {
 
-	rule := Rule{ExceptedPath: make([]string, 0)}
+	rule := Rule{ExceptedPath: make([]string, 0), ShadowThreshold: defaultShadowThreshold, SampleMaxSize: defaultSampleMaxSize,
+		DecisionCacheTTL: defaultDecisionCacheTTL, DecisionCacheSize: defaultDecisionCacheSize,
+		DenialCacheTTL: defaultDenialCacheTTL, DenialCacheSize: defaultDenialCacheSize, RateLimitUsers: defaultRateLimitUsers,
+		ExternalAuthorizerTimeout: defaultExternalAuthorizerTimeout, AuditMaxSize: defaultAuditMaxSize}
 
 	if c.Next() {
 		args := c.RemainingArgs()
@@ -104,6 +418,469 @@ func parse(c *caddy.Controller) (Rule, error) {
 						return rule, c.ArgErr()
 					}
 					break
+				case "strictExceptions":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.StrictExceptions = on
+				case "shadowThreshold":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					threshold, err := strconv.ParseFloat(c.Val(), 64)
+
+					if err != nil || threshold < 0 || threshold > 1 {
+						return rule, c.Errf("shadowThreshold must be a fraction between 0 and 1, got %s", c.Val())
+					}
+
+					rule.ShadowThreshold = threshold
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "shadow":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					sample, err := strconv.ParseFloat(c.Val(), 64)
+
+					if err != nil || sample < 0 || sample > 1 {
+						return rule, c.Errf("shadow must be a fraction between 0 and 1, got %s", c.Val())
+					}
+
+					rule.ShadowSample = sample
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "hideDeniedUser":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.HideDeniedUser = on
+				case "strictPreflight":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.StrictPreflight = on
+				case "requirePermissions":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.RequirePermissions = on
+				case "readYourWrites":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					window, err := time.ParseDuration(c.Val())
+
+					if err != nil || window < 0 || window > maxReadYourWritesWindow {
+						return rule, c.Errf("readYourWrites must be a duration up to %s, got %s", maxReadYourWritesWindow, c.Val())
+					}
+
+					rule.ReadYourWritesWindow = window
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "exemplars":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					threshold, err := time.ParseDuration(c.Val())
+
+					if err != nil || threshold < 0 {
+						return rule, c.Errf("exemplars must be a positive duration, got %s", c.Val())
+					}
+
+					rule.ExemplarThreshold = threshold
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "usage":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.UsagePath = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "identitySource":
+					rule.IdentitySources = c.RemainingArgs()
+
+					if len(rule.IdentitySources) == 0 {
+						return rule, c.ArgErr()
+					}
+
+					for _, source := range rule.IdentitySources {
+						switch source {
+						case IdentityContext, IdentityClientCert:
+						default:
+							return rule, c.Errf("identitySource must be %s or %s, got %s", IdentityContext, IdentityClientCert, source)
+						}
+					}
+				case "authorizers":
+					rule.Authorizers = c.RemainingArgs()
+
+					if len(rule.Authorizers) == 0 {
+						return rule, c.ArgErr()
+					}
+
+					for _, name := range rule.Authorizers {
+						if !knownAuthorizer(name) {
+							return rule, c.Errf("authorizers must be among %s, got %s", strings.Join(registeredAuthorizers(), ", "), name)
+						}
+					}
+				case "externalAuthorizer":
+					args := c.RemainingArgs()
+
+					if len(args) != 1 && len(args) != 2 {
+						return rule, c.ArgErr()
+					}
+
+					endpoint, err := url.Parse(args[0])
+
+					if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+						return rule, c.Errf("externalAuthorizer must be an http or https URL, got %s", args[0])
+					}
+
+					rule.ExternalAuthorizerURL = args[0]
+
+					if len(args) == 2 {
+						timeout, err := time.ParseDuration(args[1])
+
+						if err != nil || timeout <= 0 {
+							return rule, c.Errf("externalAuthorizer timeout must be a positive duration, got %s", args[1])
+						}
+
+						rule.ExternalAuthorizerTimeout = timeout
+					}
+				case "externalAuthorizerFailure":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					switch c.Val() {
+					case "open":
+						rule.ExternalAuthorizerFailOpen = true
+					case "closed":
+						rule.ExternalAuthorizerFailOpen = false
+					default:
+						return rule, c.Errf("externalAuthorizerFailure must be open or closed, got %s", c.Val())
+					}
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "clientCA":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.ClientCA = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "samples":
+					args := c.RemainingArgs()
+
+					if len(args) != 2 {
+						return rule, c.ArgErr()
+					}
+
+					fraction, err := strconv.ParseFloat(args[1], 64)
+
+					if err != nil || fraction <= 0 || fraction > 1 {
+						return rule, c.Errf("samples fraction must be between 0 and 1, got %s", args[1])
+					}
+
+					rule.SampleFile = args[0]
+					rule.SampleFraction = fraction
+				case "sampleMaxSize":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					size, err := strconv.ParseInt(c.Val(), 10, 64)
+
+					if err != nil || size <= 0 {
+						return rule, c.Errf("sampleMaxSize must be a positive number of bytes, got %s", c.Val())
+					}
+
+					rule.SampleMaxSize = size
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "sampleKey":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.SampleKeyFile = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "strictMetadata":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					size, err := strconv.ParseInt(c.Val(), 10, 64)
+
+					if err != nil || size <= 0 {
+						return rule, c.Errf("strictMetadata must be a positive number of bytes, got %s", c.Val())
+					}
+
+					rule.StrictMetadataMaxBody = size
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "decisionCache":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					ttl, err := time.ParseDuration(c.Val())
+
+					if err != nil || ttl < 0 || ttl > maxDecisionCacheTTL {
+						return rule, c.Errf("decisionCache must be a duration up to %s, got %s", maxDecisionCacheTTL, c.Val())
+					}
+
+					rule.DecisionCacheTTL = ttl
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "denialCache":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					ttl, err := time.ParseDuration(c.Val())
+
+					if err != nil || ttl < 0 || ttl > maxDecisionCacheTTL {
+						return rule, c.Errf("denialCache must be a duration up to %s, got %s", maxDecisionCacheTTL, c.Val())
+					}
+
+					rule.DenialCacheTTL = ttl
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "denialCacheSize":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					size, err := strconv.Atoi(c.Val())
+
+					if err != nil || size <= 0 {
+						return rule, c.Errf("denialCacheSize must be a positive number of decisions, got %s", c.Val())
+					}
+
+					rule.DenialCacheSize = size
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "subjectResolver":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.SubjectResolver = on
+				case "rbacVersionHeader":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.RBACVersionHeader = on
+				case "debugMatches":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.DebugMatches = on
+				case "debugAuthorizers":
+					on, err := parseSwitch(c)
+
+					if err != nil {
+						return rule, err
+					}
+
+					rule.DebugAuthorizers = on
+				case "authorizationTimeout":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					timeout, err := time.ParseDuration(c.Val())
+
+					if err != nil || timeout < 0 {
+						return rule, c.Errf("authorizationTimeout must be a positive duration, got %s", c.Val())
+					}
+
+					rule.AuthorizationTimeout = timeout
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "rateLimit":
+					args := c.RemainingArgs()
+
+					if len(args) != 1 && len(args) != 2 {
+						return rule, c.ArgErr()
+					}
+
+					qps, err := strconv.ParseFloat(args[0], 64)
+
+					if err != nil || qps <= 0 || math.IsInf(qps, 0) {
+						return rule, c.Errf("rateLimit must be a positive number of requests per second, got %s", args[0])
+					}
+
+					rule.RateLimitQPS = qps
+					rule.RateLimitBurst = int(math.Ceil(qps))
+
+					if len(args) == 2 {
+						burst, err := strconv.Atoi(args[1])
+
+						if err != nil || burst <= 0 {
+							return rule, c.Errf("rateLimit burst must be a positive number of requests, got %s", args[1])
+						}
+
+						rule.RateLimitBurst = burst
+					}
+				case "rateLimitExempt":
+					rule.RateLimitExemptGroups = c.RemainingArgs()
+
+					if len(rule.RateLimitExemptGroups) == 0 {
+						return rule, c.ArgErr()
+					}
+				case "rateLimitUsers":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					users, err := strconv.Atoi(c.Val())
+
+					if err != nil || users <= 0 {
+						return rule, c.Errf("rateLimitUsers must be a positive number of users, got %s", c.Val())
+					}
+
+					rule.RateLimitUsers = users
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "decisionCacheSize":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					size, err := strconv.Atoi(c.Val())
+
+					if err != nil || size <= 0 {
+						return rule, c.Errf("decisionCacheSize must be a positive number of decisions, got %s", c.Val())
+					}
+
+					rule.DecisionCacheSize = size
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "auditLog":
+					args := c.RemainingArgs()
+
+					if len(args) != 1 && len(args) != 2 {
+						return rule, c.ArgErr()
+					}
+
+					rule.AuditLog = args[0]
+
+					if len(args) == 2 {
+						size, err := strconv.ParseInt(args[1], 10, 64)
+
+						if err != nil || size <= 0 {
+							return rule, c.Errf("auditLog max size must be a positive number of bytes, got %s", args[1])
+						}
+
+						// the standard error isn't rotated
+						if rule.AuditLog == auditStderr {
+							return rule, c.Errf("auditLog to %s has no max size", auditStderr)
+						}
+
+						rule.AuditMaxSize = size
+					}
+				case "auditDecisions":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					switch c.Val() {
+					case "denied":
+						rule.AuditAllowed = false
+					case "all":
+						rule.AuditAllowed = true
+					default:
+						return rule, c.Errf("auditDecisions must be denied or all, got %s", c.Val())
+					}
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "metrics":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					if _, _, err := net.SplitHostPort(c.Val()); err != nil {
+						return rule, c.Errf("metrics must be a listen address, got %s", c.Val())
+					}
+
+					rule.MetricsAddress = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "debug":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.DebugPath = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
 				}
 			}
 		case 1:
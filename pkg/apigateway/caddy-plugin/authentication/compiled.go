@@ -0,0 +1,304 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	sliceutils "kubesphere.io/kubesphere/pkg/utils"
+)
+
+// compiledRoles are the compiled rules of the roles and cluster roles of the informers
+var compiledRoles = newRuleStore()
+
+// compiledRule is a policy rule with its wildcards and group names resolved, it matches the requests
+// ruleMatchesRequest matches. The entries are kept in slices, the rules have a few of them and a scan
+// is faster than a map lookup then.
+type compiledRule struct {
+	allVerbs bool
+	verbs    []string
+
+	allGroups bool
+	// the groups of the entries, the core group is ""
+	groups []string
+	// the "group/version" entries, the group is "*" or canonical
+	versions []groupVersion
+
+	allResources bool
+	// the entries split at each of their slashes, so that the combined resource of a request isn't
+	// built, the entries themselves are kept without subresource
+	resources []resourceKey
+	// subresources of the "*/subresource" entries
+	anyResourceSubresources []string
+	// resources of the "resource/*" entries
+	allSubresources []string
+
+	// the names are restricted if any
+	restrictedNames bool
+	allNames        bool
+	names           []string
+	namePrefixes    []string
+
+	nonResourceURLs []string
+}
+
+type resourceKey struct {
+	resource    string
+	subresource string
+}
+
+type groupVersion struct {
+	group   string
+	version string
+}
+
+func compileRule(rule v1.PolicyRule) compiledRule {
+	compiled := compiledRule{
+		verbs:           rule.Verbs,
+		allVerbs:        sliceutils.HasString(rule.Verbs, v1.VerbAll),
+		restrictedNames: len(rule.ResourceNames) > 0,
+		names:           rule.ResourceNames,
+		nonResourceURLs: rule.NonResourceURLs,
+	}
+
+	for _, group := range rule.APIGroups {
+		group = strings.TrimSpace(group)
+		compiled.allGroups = compiled.allGroups || group == v1.APIGroupAll
+		compiled.groups = append(compiled.groups, canonicalGroup(group))
+
+		if i := strings.LastIndex(group, "/"); i >= 0 {
+			prefix := strings.TrimSpace(group[:i])
+			if prefix != v1.APIGroupAll {
+				prefix = canonicalGroup(prefix)
+			}
+			compiled.versions = append(compiled.versions, groupVersion{group: prefix, version: strings.TrimSpace(group[i+1:])})
+		}
+	}
+
+	for _, resource := range rule.Resources {
+		compiled.allResources = compiled.allResources || resource == v1.ResourceAll
+		compiled.resources = append(compiled.resources, resourceKey{resource: resource})
+		for i := strings.Index(resource, "/"); i >= 0 && i < len(resource)-1; i = nextSlash(resource, i) {
+			compiled.resources = append(compiled.resources, resourceKey{resource: resource[:i], subresource: resource[i+1:]})
+		}
+		if strings.HasPrefix(resource, "*/") {
+			compiled.anyResourceSubresources = append(compiled.anyResourceSubresources, strings.TrimPrefix(resource, "*/"))
+		}
+		if prefix, ok := wildcardPrefix(resource, "/*"); ok {
+			compiled.allSubresources = append(compiled.allSubresources, prefix)
+		}
+	}
+
+	for _, name := range rule.ResourceNames {
+		compiled.allNames = compiled.allNames || name == v1.ResourceAll
+		if prefix, ok := wildcardPrefix(name, "*"); ok {
+			compiled.namePrefixes = append(compiled.namePrefixes, prefix)
+		}
+	}
+
+	return compiled
+}
+
+// matches is ruleMatchesRequest on the compiled rule
+func (r *compiledRule) matches(apiGroup, apiVersion, nonResourceURL, resource, subresource, resourceName, verb string) bool {
+	if !r.allVerbs && !sliceutils.HasString(r.verbs, verb) {
+		return false
+	}
+
+	if nonResourceURL != "" {
+		for _, spec := range r.nonResourceURLs {
+			if pathMatches(nonResourceURL, spec) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return resource != "" && r.matchesGroup(apiGroup, apiVersion) && r.matchesName(resourceName) && r.matchesResource(resource, subresource)
+}
+
+func (r *compiledRule) matchesGroup(apiGroup, apiVersion string) bool {
+	apiGroup = canonicalGroup(apiGroup)
+
+	if r.allGroups || sliceutils.HasString(r.groups, apiGroup) {
+		return true
+	}
+
+	if apiVersion == "" {
+		return false
+	}
+
+	for _, version := range r.versions {
+		if version.version == apiVersion && (version.group == v1.APIGroupAll || version.group == apiGroup) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *compiledRule) matchesName(resourceName string) bool {
+	if !r.restrictedNames || r.allNames || sliceutils.HasString(r.names, resourceName) {
+		return true
+	}
+
+	if resourceName == "" {
+		return false
+	}
+
+	for _, prefix := range r.namePrefixes {
+		if strings.HasPrefix(resourceName, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *compiledRule) matchesResource(resource, subresource string) bool {
+	if r.allResources {
+		return true
+	}
+
+	for _, key := range r.resources {
+		if key.resource == resource && key.subresource == subresource {
+			return true
+		}
+	}
+
+	return subresource != "" && (sliceutils.HasString(r.anyResourceSubresources, subresource) || sliceutils.HasString(r.allSubresources, resource))
+}
+
+// nextSlash returns the index of the slash of s after the one at i, -1 if there is none
+func nextSlash(s string, i int) int {
+	if j := strings.Index(s[i+1:], "/"); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
+
+func compileRules(rules []v1.PolicyRule) []compiledRule {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled = append(compiled, compileRule(rule))
+	}
+	return compiled
+}
+
+// compiledEntry are the compiled rules of a role object
+type compiledEntry struct {
+	// the object compiled, the objects of the informer caches are replaced on updates, never changed
+	source interface{}
+	rules  []compiledRule
+}
+
+// ruleStore keeps the compiled rules of the roles and cluster roles by kind, namespace and name. The
+// entries are compiled on the events of the informers, and on the fly when the object of an entry
+// isn't the one looked up, e.g. before its event is handled.
+type ruleStore struct {
+	mutex   sync.RWMutex
+	entries map[storedRole]compiledEntry
+}
+
+func newRuleStore() *ruleStore {
+	return &ruleStore{entries: make(map[storedRole]compiledEntry)}
+}
+
+// watch compiles the rules of the roles and cluster roles of the informers on their changes
+func (s *ruleStore) watch(informers ...cache.SharedIndexInformer) {
+	for _, informer := range informers {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: s.compile,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				s.compile(newObj)
+			},
+			DeleteFunc: s.remove,
+		})
+	}
+}
+
+func (s *ruleStore) compile(obj interface{}) {
+	switch role := obj.(type) {
+	case *v1.Role:
+		s.roleRules(role)
+	case *v1.ClusterRole:
+		s.clusterRoleRules(role)
+	}
+}
+
+func (s *ruleStore) remove(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch role := obj.(type) {
+	case *v1.Role:
+		delete(s.entries, roleKey(role))
+	case *v1.ClusterRole:
+		delete(s.entries, clusterRoleKey(role))
+	}
+}
+
+// roleRules returns the compiled rules of role
+func (s *ruleStore) roleRules(role *v1.Role) []compiledRule {
+	return s.rules(roleKey(role), role, role.Rules)
+}
+
+// clusterRoleRules returns the compiled rules of clusterRole, without the rules it aggregates
+func (s *ruleStore) clusterRoleRules(clusterRole *v1.ClusterRole) []compiledRule {
+	return s.rules(clusterRoleKey(clusterRole), clusterRole, clusterRole.Rules)
+}
+
+func (s *ruleStore) rules(key storedRole, source interface{}, rules []v1.PolicyRule) []compiledRule {
+	s.mutex.RLock()
+	entry, ok := s.entries[key]
+	s.mutex.RUnlock()
+
+	if ok && entry.source == source {
+		return entry.rules
+	}
+
+	entry = compiledEntry{source: source, rules: compileRules(rules)}
+
+	s.mutex.Lock()
+	s.entries[key] = entry
+	s.mutex.Unlock()
+
+	return entry.rules
+}
+
+// storedRole is the key of the compiled rules of a role, a struct so that the lookups don't allocate
+type storedRole struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func roleKey(role *v1.Role) storedRole {
+	return storedRole{kind: "Role", namespace: role.Namespace, name: role.Name}
+}
+
+func clusterRoleKey(clusterRole *v1.ClusterRole) storedRole {
+	return storedRole{kind: "ClusterRole", name: clusterRole.Name}
+}
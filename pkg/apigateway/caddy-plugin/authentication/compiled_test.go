@@ -0,0 +1,156 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/gofuzz"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// groupFuzzValues are the API groups and versions of the versioned and core group entries
+var groupFuzzValues = []string{"core", " core ", "v1", "apps/v1", " apps / v1 ", "/v1", "*/v1", "core/v1", "apps/", "*/", "prefix*"}
+
+func TestCompiledRulesFuzz(t *testing.T) {
+	values := append(append([]string{}, fuzzValues...), groupFuzzValues...)
+	fuzzer := fuzz.NewWithSeed(1).NilChance(0.2).NumElements(0, 3).Funcs(
+		func(s *string, c fuzz.Continue) {
+			if c.Intn(8) > 0 {
+				*s = values[c.Intn(len(values))]
+			} else {
+				*s = c.RandString()
+			}
+		},
+	)
+
+	for i := 0; i < 50000; i++ {
+		var rule v1.PolicyRule
+		var r fuzzRequest
+		fuzzer.Fuzz(&rule)
+		fuzzer.Fuzz(&r)
+
+		compiled := compileRule(rule)
+
+		expected := ruleMatchesRequest(rule, r.APIGroup, r.APIVersion, r.Path, r.Resource, r.Subresource, r.Name, r.Verb)
+
+		if matched := compiled.matches(r.APIGroup, r.APIVersion, r.Path, r.Resource, r.Subresource, r.Name, r.Verb); matched != expected {
+			t.Errorf("rule %+v against request %+v: expected %v, the compiled rule %v", rule, r, expected, matched)
+		}
+	}
+}
+
+func TestCompiledRulesFollowUpdates(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader", ResourceVersion: "1"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "writer", ResourceVersion: "1"}, Rules: []v1.PolicyRule{{Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "reader"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "writer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "writer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	store := compiledRoles
+	compiledRoles = newRuleStore()
+	defer func() { compiledRoles = store }()
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	getSecrets := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "secrets"}
+	deleteSecrets := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "delete", Resource: "secrets", Namespace: "demo"}
+
+	for _, attrs := range []*authorizer.AttributesRecord{getSecrets, deleteSecrets} {
+		if permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs); permitted || err != nil {
+			t.Fatalf("%s %s: expected denied before the update, got %v %v", attrs.Verb, attrs.Resource, permitted, err)
+		}
+	}
+
+	clusterRoles := factory.Rbac().V1().ClusterRoles().Informer().GetIndexer()
+	roles := factory.Rbac().V1().Roles().Informer().GetIndexer()
+
+	oldClusterRole, _, _ := clusterRoles.GetByKey("reader")
+	oldRole, _, _ := roles.GetByKey("demo/writer")
+
+	clusterRole := oldClusterRole.(*v1.ClusterRole).DeepCopy()
+	clusterRole.ResourceVersion = "2"
+	clusterRole.Rules = append(clusterRole.Rules, v1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}})
+	role := oldRole.(*v1.Role).DeepCopy()
+	role.ResourceVersion = "2"
+	role.Rules = append(role.Rules, v1.PolicyRule{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"secrets"}})
+
+	if err := clusterRoles.Update(clusterRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := roles.Update(role); err != nil {
+		t.Fatal(err)
+	}
+	compiledRoles.compile(clusterRole)
+	compiledRoles.compile(role)
+
+	for _, attrs := range []*authorizer.AttributesRecord{getSecrets, deleteSecrets} {
+		if permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs); !permitted || err != nil {
+			t.Errorf("%s %s: expected permitted after the update, got %v %v", attrs.Verb, attrs.Resource, permitted, err)
+		}
+	}
+
+	if rules := compiledRoles.clusterRoleRules(clusterRole); len(rules) != 2 {
+		t.Errorf("expected the two compiled rules of the update, got %d", len(rules))
+	}
+
+	compiledRoles.remove(clusterRole)
+	compiledRoles.remove(cache.DeletedFinalStateUnknown{Key: "demo/writer", Obj: role})
+
+	if len(compiledRoles.entries) != 0 {
+		t.Errorf("expected the deleted roles dropped, got %d entries", len(compiledRoles.entries))
+	}
+}
+
+func BenchmarkCompiledRules(b *testing.B) {
+	rules := []v1.PolicyRule{
+		{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{"", "apps", "batch", "extensions"}, Resources: []string{"pods", "pods/log", "deployments", "replicasets", "jobs", "cronjobs", "services", "configmaps"}},
+		{Verbs: []string{"create", "update", "patch", "delete"}, APIGroups: []string{"apps/v1"}, Resources: []string{"deployments", "deployments/scale", "statefulsets", "daemonsets"}},
+		{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"registry-*", "default-token"}},
+		{Verbs: []string{"*"}, APIGroups: []string{"monitoring.kubesphere.io"}, Resources: []string{"*/status"}},
+	}
+	compiled := compileRules(rules)
+
+	// denied, so that every rule is matched, after the verbs and groups of most of them
+	request := fuzzRequest{Verb: "get", APIGroup: "batch", APIVersion: "v1", Resource: "cronjobs", Subresource: "status", Name: "backup"}
+
+	b.Run("uncompiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, rule := range rules {
+				if ruleMatchesRequest(rule, request.APIGroup, request.APIVersion, "", request.Resource, request.Subresource, request.Name, request.Verb) {
+					b.Fatal("expected denied")
+				}
+			}
+		}
+	})
+
+	b.Run("compiled", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := range compiled {
+				if compiled[j].matches(request.APIGroup, request.APIVersion, "", request.Resource, request.Subresource, request.Name, request.Verb) {
+					b.Fatal("expected denied")
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,142 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	// concurrentBindings is the number of cluster role bindings of a user from which they are evaluated
+	// concurrently, the goroutines cost more than they save below
+	concurrentBindings = 1024
+	// bindingChunk is the number of cluster role bindings a worker evaluates at once
+	bindingChunk = 256
+)
+
+// evaluateConcurrently evaluates the cluster role bindings in chunks by up to GOMAXPROCS workers, the
+// remaining chunks are dropped as soon as a binding permits the request. The request is permitted if
+// one of the bindings permits it, whatever the worker, otherwise the first error in the order of the
+// bindings is returned. Unlike the sequential evaluation the bindings after an error are evaluated,
+// so that an error never hides a binding permitting the request. The workers give up once parent is
+// done. The evaluations of every worker and the match of the one permitting the request are recorded
+// in trace.
+func evaluateConcurrently(parent context.Context, listers Listers, attrs authorizer.Attributes, workspace string, bindings []*v1.ClusterRoleBinding, version *rbacVersion, trace *decisionTrace) (bool, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	chunks := (len(bindings) + bindingChunk - 1) / bindingChunk
+	workers := runtime.GOMAXPROCS(0)
+	if workers > chunks {
+		workers = chunks
+	}
+
+	pending := make(chan int, chunks)
+	for chunk := 0; chunk < chunks; chunk++ {
+		pending <- chunk
+	}
+	close(pending)
+
+	var permitted int32
+	errs := make([]error, chunks)
+	// the versions observed and the bindings evaluated by each worker, merged once they are done
+	versions := make([]rbacVersion, workers)
+	var traces []decisionTrace
+	if trace != nil {
+		traces = make([]decisionTrace, workers)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for worker := 0; worker < workers; worker++ {
+		go func(worker int) {
+			defer wg.Done()
+
+			// the roles already checked by the worker
+			checked := make(map[string]bool)
+
+			var workerTrace *decisionTrace
+			if traces != nil {
+				workerTrace = &traces[worker]
+			}
+
+			for chunk := range pending {
+				end := (chunk + 1) * bindingChunk
+				if end > len(bindings) {
+					end = len(bindings)
+				}
+
+				for _, binding := range bindings[chunk*bindingChunk : end] {
+					select {
+					case <-ctx.Done():
+						return
+					default:
+					}
+
+					allowed, err := clusterRoleBindingPermits(listers, attrs, workspace, binding, checked, &versions[worker], workerTrace)
+
+					if err != nil && errs[chunk] == nil {
+						errs[chunk] = err
+					}
+
+					if allowed {
+						// the match of the first worker permitting the request is kept
+						if !atomic.CompareAndSwapInt32(&permitted, 0, 1) && workerTrace != nil {
+							workerTrace.binding = ""
+						}
+						cancel()
+						return
+					}
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+
+	for _, observed := range versions {
+		version.merge(observed)
+	}
+
+	for _, evaluated := range traces {
+		trace.merge(evaluated)
+	}
+
+	if atomic.LoadInt32(&permitted) == 1 {
+		return true, nil
+	}
+
+	if parent.Err() != nil {
+		return false, evaluationAborted(parent)
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,146 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// distinctBindings returns a cluster role per binding, each granting get on its own resource, bound
+// to alice
+func distinctBindings(count int) []runtime.Object {
+	objects := make([]runtime.Object, 0, 2*count)
+
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("role-%d", i)
+		objects = append(objects,
+			&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: fmt.Sprint(i + 1)}, Rules: []v1.PolicyRule{
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{fmt.Sprintf("resource-%d", i)}},
+			}},
+			&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: name}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		)
+	}
+
+	return objects
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+	count := 3 * concurrentBindings
+	setupRBAC(t, distinctBindings(count)...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	tests := []struct {
+		resource  string
+		permitted bool
+	}{
+		{resource: "resource-0", permitted: true},
+		{resource: fmt.Sprintf("resource-%d", count/2), permitted: true},
+		{resource: fmt.Sprintf("resource-%d", count-1), permitted: true},
+		{resource: fmt.Sprintf("resource-%d", count), permitted: false},
+	}
+
+	for _, test := range tests {
+		attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: test.resource}
+
+		// the same decision every time, whichever worker finds the binding
+		for i := 0; i < 10; i++ {
+			var version rbacVersion
+			permitted, err := clusterRoleValidate(context.Background(), sharedListers(), attrs, "", &version)
+
+			if permitted != test.permitted || err != nil {
+				t.Fatalf("get %s: expected %v, got %v %v", test.resource, test.permitted, permitted, err)
+			}
+
+			// every binding is evaluated for a denial, so the latest role is observed
+			if !test.permitted && version != rbacVersion(count) {
+				t.Errorf("get %s: expected the version %d observed, got %d", test.resource, count, version)
+			}
+		}
+	}
+}
+
+func TestConcurrentEvaluationErrors(t *testing.T) {
+	objects := distinctBindings(2 * concurrentBindings)
+
+	// the selector of the aggregation can't be parsed, the evaluation of the role fails
+	broken := &v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "broken"}, AggregationRule: &v1.AggregationRule{
+		ClusterRoleSelectors: []metav1.LabelSelector{{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "aggregate", Operator: "Unknown"}}}},
+	}}
+	objects = append(objects, broken,
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "broken"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "broken"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	setupRBAC(t, objects...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	// a binding permitting the request wins over the error of another one
+	for i := 0; i < 10; i++ {
+		attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: fmt.Sprintf("resource-%d", i*100)}
+
+		if permitted, err := clusterRoleValidate(context.Background(), sharedListers(), attrs, "", nil); !permitted || err != nil {
+			t.Errorf("get %s: expected permitted, got %v %v", attrs.Resource, permitted, err)
+		}
+	}
+
+	attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "delete", Resource: "resource-0"}
+
+	if permitted, err := clusterRoleValidate(context.Background(), sharedListers(), attrs, "", nil); permitted || !errors.Is(err, ErrEvaluationFailed) {
+		t.Errorf("expected the evaluation failed, got %v %v", permitted, err)
+	}
+}
+
+// BenchmarkClusterRoleBindings evaluates requests denied by every binding of the user, and permitted
+// by one of them
+func BenchmarkClusterRoleBindings(b *testing.B) {
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	for _, count := range []int{100, 10000, 50000} {
+		setupRBAC(b, distinctBindings(count)...)
+		listers := sharedListers()
+
+		for _, test := range []struct {
+			name      string
+			resource  string
+			permitted bool
+		}{
+			{name: "denied", resource: "secrets", permitted: false},
+			{name: "permitted", resource: fmt.Sprintf("resource-%d", count/2), permitted: true},
+		} {
+			attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: test.resource}
+
+			b.Run(fmt.Sprintf("bindings=%d/%s", count, test.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if permitted, err := clusterRoleValidate(context.Background(), listers, attrs, "", nil); permitted != test.permitted || err != nil {
+						b.Fatalf("expected %v, got %v %v", test.permitted, permitted, err)
+					}
+				}
+			})
+		}
+	}
+}
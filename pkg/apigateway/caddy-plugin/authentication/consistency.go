@@ -0,0 +1,442 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	// the window is short, a longer one turns every denial into API server reads
+	maxReadYourWritesWindow = time.Minute
+	maxRecentWrites         = 1000
+	// a recheck lists bindings and roles, at most 2 requests to the API server
+	recheckQPS        = 5
+	recheckBurst      = 10
+	maxRecordedBody   = 64 * 1024
+	recheckAllowed    = "allowed"
+	recheckDenied     = "denied"
+	recheckError      = "error"
+	recheckThrottled  = "throttled"
+	clusterWriteScope = ""
+)
+
+var rbacRechecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "authentication_read_your_writes_rechecks_total",
+	Help: "Number of denials rechecked with the API server after a recent RBAC write, by result.",
+}, []string{"result"})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(rbacRechecks); err != nil {
+		log.Printf("[ERROR] authentication: register read your writes metrics: %v", err)
+	}
+}
+
+// rbacReader lists roles and bindings from the API server, bypassing the informer caches. The
+// lists are at least as recent as resourceVersion, the most recent ones if it's empty.
+type rbacReader interface {
+	roleBindings(namespace, resourceVersion string) ([]v1.RoleBinding, error)
+	roles(namespace, resourceVersion string) ([]v1.Role, error)
+	clusterRoleBindings(resourceVersion string) ([]v1.ClusterRoleBinding, error)
+	clusterRoles(resourceVersion string) ([]v1.ClusterRole, error)
+}
+
+// rbacWrite is the last RBAC write through the gateway in a namespace
+type rbacWrite struct {
+	resourceVersion string
+	time            time.Time
+}
+
+// recentWrites records the RBAC writes passing through the gateway, so that a user granted by one
+// isn't denied while the informer caches lag behind. A denial in the scope of a write younger than
+// window is rechecked with the API server, rechecks are rate limited.
+type recentWrites struct {
+	window  time.Duration
+	reader  rbacReader
+	limiter flowcontrol.RateLimiter
+	now     func() time.Time
+
+	mutex sync.Mutex
+	// by namespace, cluster scoped kinds are recorded with an empty namespace
+	writes map[string]rbacWrite
+}
+
+// newRecentWrites returns the table of writes, its reader is set before the requests are served
+func newRecentWrites(window time.Duration) *recentWrites {
+	return &recentWrites{
+		window:  window,
+		limiter: flowcontrol.NewTokenBucketRateLimiter(recheckQPS, recheckBurst),
+		now:     time.Now,
+		writes:  make(map[string]rbacWrite),
+	}
+}
+
+// writeScope returns the namespace of the RBAC write requested, false if the request isn't one.
+// Deletions are ignored, they never grant anything.
+func writeScope(attrs authorizer.Attributes) (string, bool) {
+	if !attrs.IsResourceRequest() || attrs.GetAPIGroup() != v1.GroupName || attrs.GetSubresource() != "" {
+		return "", false
+	}
+
+	switch attrs.GetVerb() {
+	case "create", "update", "patch":
+	default:
+		return "", false
+	}
+
+	switch attrs.GetResource() {
+	case "roles", "rolebindings":
+		return attrs.GetNamespace(), attrs.GetNamespace() != ""
+	case "clusterroles", "clusterrolebindings":
+		return clusterWriteScope, true
+	}
+
+	return "", false
+}
+
+// serve passes a RBAC write to next and records it if it succeeds
+func (t *recentWrites) serve(next httpserver.Handler, w http.ResponseWriter, r *http.Request, scope string) (int, error) {
+	recorder := &writeRecorder{ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w}}
+
+	status, err := next.ServeHTTP(recorder, r)
+
+	written := recorder.status
+	if written == 0 {
+		written = status
+	}
+
+	if err == nil && written >= 200 && written < 300 {
+		t.record(scope, recorder.resourceVersion())
+	}
+
+	return status, err
+}
+
+func (t *recentWrites) record(scope, resourceVersion string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+
+	if _, ok := t.writes[scope]; !ok && len(t.writes) >= maxRecentWrites {
+		t.evict(now)
+	}
+
+	t.writes[scope] = rbacWrite{resourceVersion: resourceVersion, time: now}
+}
+
+// evict drops the expired writes, or the oldest one if none has expired
+func (t *recentWrites) evict(now time.Time) {
+	oldest, found := "", false
+	for scope, write := range t.writes {
+		if now.Sub(write.time) > t.window {
+			delete(t.writes, scope)
+			continue
+		}
+		if !found || write.time.Before(t.writes[oldest].time) {
+			oldest, found = scope, true
+		}
+	}
+
+	if len(t.writes) >= maxRecentWrites {
+		delete(t.writes, oldest)
+	}
+}
+
+func (t *recentWrites) lookup(scope string) (rbacWrite, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	write, ok := t.writes[scope]
+
+	if !ok || t.now().Sub(write.time) > t.window {
+		return rbacWrite{}, false
+	}
+
+	return write, true
+}
+
+// recheck evaluates a denied request with the roles and bindings of the API server if a recent write
+// may have granted it. It keeps the denial if there's no such write, the recheck is throttled or fails,
+// rechecked is false then.
+func (t *recentWrites) recheck(attrs authorizer.Attributes) (permitted bool, rechecked bool) {
+	cluster, clusterWritten := t.lookup(clusterWriteScope)
+
+	namespaced, namespaceWritten := rbacWrite{}, false
+	if attrs.IsResourceRequest() && attrs.GetNamespace() != "" {
+		namespaced, namespaceWritten = t.lookup(attrs.GetNamespace())
+	}
+
+	if !clusterWritten && !namespaceWritten {
+		return false, false
+	}
+
+	if !t.limiter.TryAccept() {
+		rbacRechecks.WithLabelValues(recheckThrottled).Inc()
+		return false, false
+	}
+
+	var err error
+
+	if clusterWritten {
+		permitted, err = t.clusterRoleRecheck(attrs, cluster.resourceVersion)
+	}
+
+	if err == nil && !permitted && namespaceWritten {
+		permitted, err = t.roleRecheck(attrs, namespaced.resourceVersion)
+	}
+
+	if err != nil {
+		rbacRechecks.WithLabelValues(recheckError).Inc()
+		log.Printf("[WARNING] authentication: recheck denial of user %s after a RBAC write: %v", attrs.GetUser().GetName(), err)
+		return false, false
+	}
+
+	if permitted {
+		rbacRechecks.WithLabelValues(recheckAllowed).Inc()
+	} else {
+		rbacRechecks.WithLabelValues(recheckDenied).Inc()
+	}
+
+	return permitted, true
+}
+
+func (t *recentWrites) clusterRoleRecheck(attrs authorizer.Attributes, resourceVersion string) (bool, error) {
+	bindings, err := t.reader.clusterRoleBindings(resourceVersion)
+
+	if err != nil {
+		return false, err
+	}
+
+	// the workspace role bindings grant their role in the workspace of the request only
+	workspace := requestWorkspace(attrs)
+
+	bound := make(map[string]bool)
+	for i := range bindings {
+		binding := &bindings[i]
+		if ws := workspaceOf(binding); ws != "" && ws != workspace {
+			continue
+		}
+		if checkRoleRef(binding.RoleRef, "ClusterRole") == nil && appliesTo(binding.Subjects, attrs.GetUser(), "") {
+			bound[binding.RoleRef.Name] = true
+		}
+	}
+
+	if len(bound) == 0 {
+		return false, nil
+	}
+
+	clusterRoles, err := t.reader.clusterRoles(resourceVersion)
+
+	if err != nil {
+		return false, err
+	}
+
+	for i := range clusterRoles {
+		if !bound[clusterRoles[i].Name] {
+			continue
+		}
+
+		rules, err := clusterRoleRules(&clusterRoles[i], selectFrom(clusterRoles), nil)
+
+		if err != nil {
+			return false, err
+		}
+
+		if rulesAllow(rules, attrs) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (t *recentWrites) roleRecheck(attrs authorizer.Attributes, resourceVersion string) (bool, error) {
+	bindings, err := t.reader.roleBindings(attrs.GetNamespace(), resourceVersion)
+
+	if err != nil {
+		return false, err
+	}
+
+	// role bindings refer to roles of their namespace or to cluster roles
+	bound := make(map[string]bool)
+	boundClusterRoles := make(map[string]bool)
+	for _, binding := range bindings {
+		if checkRoleRef(binding.RoleRef, "Role", "ClusterRole") != nil || !appliesTo(binding.Subjects, attrs.GetUser(), binding.Namespace) {
+			continue
+		}
+		switch binding.RoleRef.Kind {
+		case "Role":
+			bound[binding.RoleRef.Name] = true
+		case "ClusterRole":
+			boundClusterRoles[binding.RoleRef.Name] = true
+		}
+	}
+
+	if len(bound) > 0 {
+		roles, err := t.reader.roles(attrs.GetNamespace(), resourceVersion)
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, role := range roles {
+			if bound[role.Name] && rulesAllow(role.Rules, attrs) {
+				return true, nil
+			}
+		}
+	}
+
+	if len(boundClusterRoles) > 0 {
+		clusterRoles, err := t.reader.clusterRoles(resourceVersion)
+
+		if err != nil {
+			return false, err
+		}
+
+		for i := range clusterRoles {
+			if !boundClusterRoles[clusterRoles[i].Name] {
+				continue
+			}
+
+			rules, err := clusterRoleRules(&clusterRoles[i], selectFrom(clusterRoles), nil)
+
+			if err != nil {
+				return false, err
+			}
+
+			if rulesAllow(rules, attrs) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// rulesAllow reports whether one of rules matches the request
+func rulesAllow(rules []v1.PolicyRule, attrs authorizer.Attributes) bool {
+	for _, rule := range rules {
+		if attrs.IsResourceRequest() {
+			if ruleMatchesRequest(rule, attrs.GetAPIGroup(), attrs.GetAPIVersion(), "", attrs.GetResource(), attrs.GetSubresource(), attrs.GetName(), attrs.GetVerb()) {
+				return true
+			}
+		} else if ruleMatchesRequest(rule, "", "", attrs.GetPath(), "", "", "", attrs.GetVerb()) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRecorder keeps the status and the beginning of the body of the response to a RBAC write
+type writeRecorder struct {
+	*httpserver.ResponseWriterWrapper
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *writeRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (r *writeRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if !r.truncated {
+		if r.body.Len()+len(p) > maxRecordedBody {
+			r.truncated = true
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriterWrapper.Write(p)
+}
+
+// resourceVersion returns the resource version of the written object, empty if it's unknown
+func (r *writeRecorder) resourceVersion() string {
+	if r.truncated || r.Header().Get("Content-Encoding") != "" {
+		return ""
+	}
+
+	var object struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}
+
+	if err := json.Unmarshal(r.body.Bytes(), &object); err != nil {
+		return ""
+	}
+
+	return object.Metadata.ResourceVersion
+}
+
+// clientsetRBACReader reads roles and bindings with the typed client
+type clientsetRBACReader struct {
+	client kubernetes.Interface
+}
+
+func (c *clientsetRBACReader) roleBindings(namespace, resourceVersion string) ([]v1.RoleBinding, error) {
+	list, err := c.client.RbacV1().RoleBindings(namespace).List(metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clientsetRBACReader) roles(namespace, resourceVersion string) ([]v1.Role, error) {
+	list, err := c.client.RbacV1().Roles(namespace).List(metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clientsetRBACReader) clusterRoleBindings(resourceVersion string) ([]v1.ClusterRoleBinding, error) {
+	list, err := c.client.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c *clientsetRBACReader) clusterRoles(resourceVersion string) ([]v1.ClusterRole, error) {
+	list, err := c.client.RbacV1().ClusterRoles().List(metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,184 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// fakeRBACReader is the API server, ahead of the informer caches
+type fakeRBACReader struct {
+	roleBindingList        []v1.RoleBinding
+	roleList               []v1.Role
+	clusterRoleBindingList []v1.ClusterRoleBinding
+	clusterRoleList        []v1.ClusterRole
+	resourceVersions       []string
+}
+
+func (f *fakeRBACReader) roleBindings(namespace, resourceVersion string) ([]v1.RoleBinding, error) {
+	f.resourceVersions = append(f.resourceVersions, resourceVersion)
+	result := make([]v1.RoleBinding, 0)
+	for _, binding := range f.roleBindingList {
+		if binding.Namespace == namespace {
+			result = append(result, binding)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeRBACReader) roles(namespace, resourceVersion string) ([]v1.Role, error) {
+	f.resourceVersions = append(f.resourceVersions, resourceVersion)
+	result := make([]v1.Role, 0)
+	for _, role := range f.roleList {
+		if role.Namespace == namespace {
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeRBACReader) clusterRoleBindings(resourceVersion string) ([]v1.ClusterRoleBinding, error) {
+	f.resourceVersions = append(f.resourceVersions, resourceVersion)
+	return f.clusterRoleBindingList, nil
+}
+
+func (f *fakeRBACReader) clusterRoles(resourceVersion string) ([]v1.ClusterRole, error) {
+	f.resourceVersions = append(f.resourceVersions, resourceVersion)
+	return f.clusterRoleList, nil
+}
+
+func TestReadYourWrites(t *testing.T) {
+	// the cache only knows the admin, the binding of alice isn't there yet
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, Rules: []v1.PolicyRule{allResources}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+	)
+
+	reader := &fakeRBACReader{
+		roleBindingList: []v1.RoleBinding{{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "alice"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}}},
+		roleList:        []v1.Role{{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}}},
+	}
+
+	now := time.Now()
+	writes := newRecentWrites(5 * time.Second)
+	writes.reader = reader
+	writes.now = func() time.Time { return now }
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		if r.Method == http.MethodPost {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"kind":"RoleBinding","metadata":{"namespace":"demo","name":"alice","resourceVersion":"42"}}`)
+			return 0, nil
+		}
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: next, writes: writes}
+	admin := &user.DefaultInfo{Name: "admin"}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	serve := func(method, path string, u user.Info) int {
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, method, path, u))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == 0 {
+			return recorder.Code
+		}
+		return status
+	}
+
+	if status := serve(http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice); status != http.StatusForbidden {
+		t.Fatalf("expected alice denied before the write, got %d", status)
+	}
+
+	if len(reader.resourceVersions) != 0 {
+		t.Fatalf("expected no recheck without a write, got %v", reader.resourceVersions)
+	}
+
+	if status := serve(http.MethodPost, "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", admin); status != http.StatusCreated {
+		t.Fatalf("expected the binding created, got %d", status)
+	}
+
+	if status := serve(http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice); status != http.StatusOK {
+		t.Errorf("expected alice allowed right after the write, got %d", status)
+	}
+
+	if len(reader.resourceVersions) != 2 || reader.resourceVersions[0] != "42" {
+		t.Errorf("expected bindings and roles read at the written version, got %v", reader.resourceVersions)
+	}
+
+	reader.resourceVersions = nil
+
+	if status := serve(http.MethodGet, "/api/v1/namespaces/other/pods/web", alice); status != http.StatusForbidden {
+		t.Errorf("expected alice denied in other namespace, got %d", status)
+	}
+
+	now = now.Add(10 * time.Second)
+
+	if status := serve(http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice); status != http.StatusForbidden {
+		t.Errorf("expected alice denied by the cache after the window, got %d", status)
+	}
+
+	if len(reader.resourceVersions) != 0 {
+		t.Errorf("expected no recheck out of the scope or the window of the write, got %v", reader.resourceVersions)
+	}
+}
+
+func TestReadYourWritesBounded(t *testing.T) {
+	setupRBAC(t)
+
+	reader := &fakeRBACReader{}
+	writes := newRecentWrites(time.Minute)
+	writes.reader = reader
+	writes.limiter = flowcontrol.NewTokenBucketRateLimiter(0.001, 1)
+
+	writes.record("demo", "1")
+	attrs := (&fuzzRequest{ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo", User: "alice"}).attributes()
+
+	for i := 0; i < 10; i++ {
+		if permitted, _ := writes.recheck(attrs); permitted {
+			t.Fatal("expected alice denied")
+		}
+	}
+
+	// a recheck without bindings of the user stops after listing them
+	if len(reader.resourceVersions) != 1 {
+		t.Errorf("expected a single throttled recheck, got %d reads", len(reader.resourceVersions))
+	}
+
+	for i := 0; i < maxRecentWrites+10; i++ {
+		writes.record(fmt.Sprintf("namespace-%d", i), "1")
+	}
+
+	if len(writes.writes) != maxRecentWrites {
+		t.Errorf("expected at most %d recent writes, got %d", maxRecentWrites, len(writes.writes))
+	}
+}
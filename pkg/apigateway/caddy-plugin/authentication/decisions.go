@@ -0,0 +1,210 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	// a revoked role is effective within the TTL, the few seconds spare the evaluations of the
+	// bursts of requests a page of the console sends
+	defaultDecisionCacheTTL  = 5 * time.Second
+	maxDecisionCacheTTL      = time.Minute
+	defaultDecisionCacheSize = 10000
+	// the denials are kept shorter, a granted role is effective within 2s while the console
+	// polling what it's denied stays cheap
+	defaultDenialCacheTTL  = 2 * time.Second
+	defaultDenialCacheSize = 10000
+
+	decisionCacheAllowedHit = "allowed_hit"
+	decisionCacheDeniedHit  = "denied_hit"
+	decisionCacheMiss       = "miss"
+)
+
+var decisionCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "authentication_decision_cache_lookups_total",
+	Help: "Lookups of the kept decisions by result, a hit of the permissions, a hit of the denials or a miss.",
+}, []string{"result"})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(decisionCacheLookups); err != nil {
+		log.Printf("[ERROR] authentication: register decision cache metrics: %v", err)
+	}
+}
+
+// decisionKey is what a decision depends on, the groups and the keys of the extra are sorted
+type decisionKey struct {
+	user            string
+	uid             string
+	groups          string
+	extra           string
+	resourceRequest bool
+	verb            string
+	apiGroup        string
+	apiVersion      string
+	resource        string
+	subresource     string
+	namespace       string
+	name            string
+	path            string
+}
+
+// keptDecisions are decisions kept for ttl, the least recently used are evicted beyond the size of
+// entries. A nil entries keeps nothing.
+type keptDecisions struct {
+	ttl     time.Duration
+	entries *cache.LRUExpireCache
+}
+
+func newKeptDecisions(ttl time.Duration, size int) keptDecisions {
+	if ttl <= 0 {
+		return keptDecisions{}
+	}
+	return keptDecisions{ttl: ttl, entries: cache.NewLRUExpireCache(size)}
+}
+
+// get returns the RBAC version of the kept decision on key
+func (k keptDecisions) get(key decisionKey) (string, bool) {
+	if k.entries == nil {
+		return "", false
+	}
+	version, ok := k.entries.Get(key)
+	if !ok {
+		return "", false
+	}
+	return version.(string), true
+}
+
+func (k keptDecisions) add(key decisionKey, version string) {
+	if k.entries != nil {
+		k.entries.Add(key, version, k.ttl)
+	}
+}
+
+// decisionCache keeps the decisions of an authorizer, the permissions and the denials apart: a revoked
+// role keeps permitting the requests decided before for the TTL of the permissions at most, a granted
+// role is denied for the TTL of the denials at most, which is shorter. The failed evaluations and
+// the decisions an authorizer had no opinion on aren't kept.
+type decisionCache struct {
+	allowed keptDecisions
+	denied  keptDecisions
+}
+
+func newDecisionCache(allowedTTL time.Duration, allowedSize int, deniedTTL time.Duration, deniedSize int) *decisionCache {
+	return &decisionCache{allowed: newKeptDecisions(allowedTTL, allowedSize), denied: newKeptDecisions(deniedTTL, deniedSize)}
+}
+
+// authorize returns the kept decision on attrs, the decision of authz otherwise. Nothing is kept by
+// a nil cache.
+func (d *decisionCache) authorize(ctx context.Context, authz Authorizer, attrs authorizer.Attributes) (bool, string, error) {
+	if d == nil {
+		return authz.Authorize(ctx, attrs)
+	}
+
+	key := newDecisionKey(attrs)
+
+	if version, ok := d.allowed.get(key); ok {
+		decisionCacheLookups.WithLabelValues(decisionCacheAllowedHit).Inc()
+		return true, version, nil
+	}
+
+	if version, ok := d.denied.get(key); ok {
+		decisionCacheLookups.WithLabelValues(decisionCacheDeniedHit).Inc()
+		return false, version, nil
+	}
+
+	decisionCacheLookups.WithLabelValues(decisionCacheMiss).Inc()
+
+	var undecided int32
+	permitted, version, err := authz.Authorize(withUndecided(ctx, &undecided), attrs)
+
+	if err != nil {
+		return false, "", err
+	}
+
+	// the decision may differ once the authorizer without opinion is back
+	if atomic.LoadInt32(&undecided) != 0 {
+		return permitted, version, nil
+	}
+
+	if permitted {
+		d.allowed.add(key, version)
+	} else {
+		d.denied.add(key, version)
+	}
+
+	return permitted, version, nil
+}
+
+type undecidedKey struct{}
+
+// withUndecided returns ctx in which the authorizers without opinion on a request set undecided
+func withUndecided(ctx context.Context, undecided *int32) context.Context {
+	return context.WithValue(ctx, undecidedKey{}, undecided)
+}
+
+// markUndecided records in ctx that an authorizer had no opinion on the request, the decision
+// isn't kept
+func markUndecided(ctx context.Context) {
+	if undecided, ok := ctx.Value(undecidedKey{}).(*int32); ok {
+		atomic.StoreInt32(undecided, 1)
+	}
+}
+
+func newDecisionKey(attrs authorizer.Attributes) decisionKey {
+	groups := append([]string(nil), attrs.GetUser().GetGroups()...)
+	sort.Strings(groups)
+
+	// the users of the same name are told apart by the whole user, the values are kept in order
+	extra := attrs.GetUser().GetExtra()
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, fmt.Sprintf("%q=%q", key, extra[key]))
+	}
+
+	return decisionKey{
+		user:            attrs.GetUser().GetName(),
+		uid:             attrs.GetUser().GetUID(),
+		groups:          fmt.Sprintf("%q", groups),
+		extra:           fmt.Sprintf("%q", values),
+		resourceRequest: attrs.IsResourceRequest(),
+		verb:            attrs.GetVerb(),
+		apiGroup:        attrs.GetAPIGroup(),
+		apiVersion:      attrs.GetAPIVersion(),
+		resource:        attrs.GetResource(),
+		subresource:     attrs.GetSubresource(),
+		namespace:       attrs.GetNamespace(),
+		name:            attrs.GetName(),
+		path:            attrs.GetPath(),
+	}
+}
@@ -0,0 +1,294 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) step(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDecisionCache(t *testing.T) {
+	var mutex sync.Mutex
+	evaluations := 0
+	revoked := false
+	failing := false
+
+	authz := authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		evaluations++
+		if failing {
+			return false, "", evaluationFailed(errors.New("cache unavailable"))
+		}
+		return attrs.GetUser().GetName() == "alice" && !revoked, "42", nil
+	})
+
+	clock := &fakeClock{now: time.Now()}
+	cached := &decisionCache{
+		allowed: keptDecisions{ttl: 5 * time.Second, entries: cache.NewLRUExpireCacheWithClock(2, clock)},
+		denied:  keptDecisions{ttl: 5 * time.Second, entries: cache.NewLRUExpireCacheWithClock(2, clock)},
+	}
+
+	pods := func(name string, groups ...string) *authorizer.AttributesRecord {
+		return &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: name, Groups: groups}, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "demo"}
+	}
+
+	expect := func(name string, attrs authorizer.Attributes, permitted bool, count int) {
+		t.Helper()
+
+		got, version, err := cached.authorize(context.Background(), authz, attrs)
+
+		if err != nil || got != permitted || version != "42" || evaluations != count {
+			t.Errorf("%s: expected permitted %v after %d evaluations, got %v %q %v after %d", name, permitted, count, got, version, err, evaluations)
+		}
+	}
+
+	expect("first decision", pods("alice", "dev", "ops"), true, 1)
+	expect("kept decision", pods("alice", "dev", "ops"), true, 1)
+	expect("groups in another order", pods("alice", "ops", "dev"), true, 1)
+	expect("other groups", pods("alice", "dev"), true, 2)
+
+	// the decision is kept until it expires
+	revoked = true
+	clock.step(4 * time.Second)
+	expect("decision kept after the revocation", pods("alice", "dev", "ops"), true, 2)
+	clock.step(2 * time.Second)
+	expect("expired decision", pods("alice", "dev", "ops"), false, 3)
+
+	// the least recently used decision is evicted beyond the size
+	expect("denial", pods("bob"), false, 4)
+	expect("kept denial", pods("bob"), false, 4)
+	expect("evicting decision", pods("carol"), false, 5)
+	expect("evicted decision", pods("alice", "dev", "ops"), false, 6)
+
+	// the failures aren't kept
+	failing = true
+	if _, _, err := cached.authorize(context.Background(), authz, pods("dave")); !errors.Is(err, ErrEvaluationFailed) {
+		t.Errorf("expected the evaluation failed, got %v", err)
+	}
+	failing = false
+	expect("after a failure", pods("dave"), false, 8)
+
+	// the nil cache keeps nothing
+	var disabled *decisionCache
+	disabled.authorize(context.Background(), authz, pods("alice"))
+	disabled.authorize(context.Background(), authz, pods("alice"))
+	if evaluations != 10 {
+		t.Errorf("expected every decision evaluated without cache, got %d evaluations", evaluations)
+	}
+}
+
+func TestDecisionKey(t *testing.T) {
+	key := func(u *user.DefaultInfo) decisionKey {
+		return newDecisionKey(&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"})
+	}
+
+	alice := &user.DefaultInfo{Name: "alice", UID: "1", Extra: map[string][]string{"scopes": {"read", "write"}, "tenant": {"demo"}}}
+
+	tests := []struct {
+		name string
+		user *user.DefaultInfo
+		same bool
+	}{
+		{name: "same user", user: &user.DefaultInfo{Name: "alice", UID: "1", Extra: map[string][]string{"tenant": {"demo"}, "scopes": {"read", "write"}}}, same: true},
+		{name: "other uid", user: &user.DefaultInfo{Name: "alice", UID: "2", Extra: alice.Extra}},
+		{name: "other extra value", user: &user.DefaultInfo{Name: "alice", UID: "1", Extra: map[string][]string{"scopes": {"read"}, "tenant": {"demo"}}}},
+		{name: "other extra key", user: &user.DefaultInfo{Name: "alice", UID: "1", Extra: map[string][]string{"scopes": {"read", "write"}, "team": {"demo"}}}},
+		{name: "no extra", user: &user.DefaultInfo{Name: "alice", UID: "1"}},
+	}
+
+	for _, test := range tests {
+		if same := key(test.user) == key(alice); same != test.same {
+			t.Errorf("%s: expected the same key %v, got %v", test.name, test.same, same)
+		}
+	}
+}
+
+func TestDecisionCacheDefault(t *testing.T) {
+	tests := []struct {
+		input   string
+		allowed time.Duration
+		denied  time.Duration
+	}{
+		{input: "authentication {\n path /kapis\n}", allowed: defaultDecisionCacheTTL, denied: defaultDenialCacheTTL},
+		{input: "authentication {\n path /kapis\n decisionCache 2s\n}", allowed: 2 * time.Second, denied: defaultDenialCacheTTL},
+		{input: "authentication {\n path /kapis\n denialCache 500ms\n}", allowed: defaultDecisionCacheTTL, denied: 500 * time.Millisecond},
+		{input: "authentication {\n path /kapis\n decisionCache 0\n denialCache 0\n}"},
+	}
+
+	for _, test := range tests {
+		rule, err := parse(caddy.NewTestController("http", test.input))
+
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+
+		if rule.DecisionCacheTTL != test.allowed || rule.DenialCacheTTL != test.denied {
+			t.Errorf("%q: expected the decisions kept %s and the denials %s, got %s %s", test.input, test.allowed, test.denied, rule.DecisionCacheTTL, rule.DenialCacheTTL)
+		}
+	}
+}
+
+func decisionCacheLookupCount(t *testing.T, result string) float64 {
+	var metric dto.Metric
+	if err := decisionCacheLookups.WithLabelValues(result).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestDenialCache(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+	)
+
+	clock := &fakeClock{now: time.Now()}
+	cached := &decisionCache{
+		allowed: keptDecisions{ttl: time.Minute, entries: cache.NewLRUExpireCacheWithClock(10, clock)},
+		denied:  keptDecisions{ttl: time.Second, entries: cache.NewLRUExpireCacheWithClock(10, clock)},
+	}
+
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "demo"}
+
+	hits, misses := decisionCacheLookupCount(t, decisionCacheDeniedHit), decisionCacheLookupCount(t, decisionCacheMiss)
+
+	for i := 0; i < 3; i++ {
+		if permitted, _, err := cached.authorize(context.Background(), defaultAuthorizer, attrs); err != nil || permitted {
+			t.Fatalf("expected denied, got %v %v", permitted, err)
+		}
+	}
+
+	if hit, miss := decisionCacheLookupCount(t, decisionCacheDeniedHit)-hits, decisionCacheLookupCount(t, decisionCacheMiss)-misses; hit != 2 || miss != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %v %v", hit, miss)
+	}
+
+	binding := &v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}}
+	if err := factory.Rbac().V1().RoleBindings().Informer().GetIndexer().Add(binding); err != nil {
+		t.Fatal(err)
+	}
+
+	// the denial is kept until it expires
+	clock.step(500 * time.Millisecond)
+	if permitted, _, err := cached.authorize(context.Background(), defaultAuthorizer, attrs); err != nil || permitted {
+		t.Errorf("expected the kept denial, got %v %v", permitted, err)
+	}
+
+	clock.step(600 * time.Millisecond)
+	if permitted, _, err := cached.authorize(context.Background(), defaultAuthorizer, attrs); err != nil || !permitted {
+		t.Errorf("expected permitted after the denial expired, got %v %v", permitted, err)
+	}
+
+	// the permission is kept for its own TTL
+	hits = decisionCacheLookupCount(t, decisionCacheAllowedHit)
+	clock.step(30 * time.Second)
+	if permitted, _, err := cached.authorize(context.Background(), defaultAuthorizer, attrs); err != nil || !permitted || decisionCacheLookupCount(t, decisionCacheAllowedHit)-hits != 1 {
+		t.Errorf("expected the kept permission, got %v %v", permitted, err)
+	}
+
+	// the denials alone are kept
+	deniedOnly := newDecisionCache(0, defaultDecisionCacheSize, time.Minute, defaultDenialCacheSize)
+	hits = decisionCacheLookupCount(t, decisionCacheAllowedHit)
+	for i := 0; i < 2; i++ {
+		if permitted, _, err := deniedOnly.authorize(context.Background(), defaultAuthorizer, attrs); err != nil || !permitted {
+			t.Errorf("expected permitted, got %v %v", permitted, err)
+		}
+	}
+	if hit := decisionCacheLookupCount(t, decisionCacheAllowedHit) - hits; hit != 0 {
+		t.Errorf("expected no permission kept, got %v hits", hit)
+	}
+}
+
+func TestDecisionCacheConcurrency(t *testing.T) {
+	setupRBAC(t, duplicatedBindings(5)...)
+
+	cached := newDecisionCache(time.Minute, 4, time.Minute, 4)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, test := range decisions {
+					if permitted, _, err := cached.authorize(context.Background(), defaultAuthorizer, &test.attrs); err != nil || permitted != test.permitted {
+						t.Errorf("expected permitted %v, got %v %v", test.permitted, permitted, err)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func BenchmarkDecisionCache(b *testing.B) {
+	setupRBAC(b, duplicatedBindings(500)...)
+
+	benchmarks := []struct {
+		name   string
+		cached *decisionCache
+	}{
+		{name: "uncached"},
+		{name: "cached", cached: newDecisionCache(time.Minute, defaultDecisionCacheSize, time.Minute, defaultDenialCacheSize)},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					for _, test := range decisions {
+						if permitted, _, _ := benchmark.cached.authorize(context.Background(), defaultAuthorizer, &test.attrs); permitted != test.permitted {
+							b.Errorf("expected permitted %v, got %v", test.permitted, permitted)
+							return
+						}
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,221 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+const (
+	// ExtraWorkspaces lists the workspaces the user is a member of
+	ExtraWorkspaces = "workspaces"
+	// ExtraWorkspaceRoles lists the roles of the user in workspaces, formatted as <workspace>:<role>
+	ExtraWorkspaceRoles = "workspace-roles"
+)
+
+// the memberships of this many users are cached, arbitrary entries are dropped beyond
+const membershipCacheSize = 10000
+
+// workspace roles are bound by cluster role bindings named system:<workspace>:<role>
+var workspaceRoleBindingName = regexp.MustCompile(fmt.Sprintf(`^system:(\S+):(%s)$`, strings.Join(constants.WorkSpaceRoles, "|")))
+
+type workspaceRole struct {
+	workspace string
+	role      string
+}
+
+// membershipCache caches the workspace memberships of users, the entries of the subjects of a
+// changed workspace role binding are dropped.
+type membershipCache struct {
+	mutex       sync.RWMutex
+	memberships map[string][]workspaceRole
+	size        int
+	// counts the invalidations, the memberships listed before one aren't cached
+	generation uint64
+}
+
+func newMembershipCache() *membershipCache {
+	return &membershipCache{memberships: make(map[string][]workspaceRole), size: membershipCacheSize}
+}
+
+// watch drops cached memberships on changes of workspace role bindings
+func (c *membershipCache) watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.invalidate,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.invalidate(oldObj)
+			c.invalidate(newObj)
+		},
+		DeleteFunc: c.invalidate,
+	})
+}
+
+func (c *membershipCache) invalidate(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the bindings listed by the fills in flight may miss the change
+	c.generation++
+
+	binding, ok := obj.(*v1.ClusterRoleBinding)
+
+	// unknown object, drop everything to stay correct
+	if !ok {
+		c.memberships = make(map[string][]workspaceRole)
+		return
+	}
+
+	if !workspaceRoleBindingName.MatchString(binding.Name) {
+		return
+	}
+
+	for _, subject := range binding.Subjects {
+		if subject.Kind == v1.UserKind {
+			delete(c.memberships, subject.Name)
+		}
+	}
+}
+
+// get returns the memberships of the user, listed from the cluster role bindings of lister on a miss
+func (c *membershipCache) get(lister rbaclisters.ClusterRoleBindingLister, username string) ([]workspaceRole, error) {
+	c.mutex.RLock()
+	roles, ok := c.memberships[username]
+	generation := c.generation
+	c.mutex.RUnlock()
+
+	if ok {
+		return roles, nil
+	}
+
+	clusterRoleBindings, err := lister.List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles = make([]workspaceRole, 0)
+
+	for _, binding := range clusterRoleBindings {
+		groups := workspaceRoleBindingName.FindStringSubmatch(binding.Name)
+		if len(groups) != 3 {
+			continue
+		}
+		for _, subject := range binding.Subjects {
+			if subject.Kind == v1.UserKind && subject.Name == username {
+				roles = append(roles, workspaceRole{workspace: groups[1], role: groups[2]})
+				break
+			}
+		}
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].workspace == roles[j].workspace {
+			return roles[i].role < roles[j].role
+		}
+		return roles[i].workspace < roles[j].workspace
+	})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// a binding changed since the list, the next request lists again
+	if c.generation != generation {
+		return roles, nil
+	}
+
+	for key := range c.memberships {
+		if len(c.memberships) < c.size {
+			break
+		}
+		delete(c.memberships, key)
+	}
+
+	c.memberships[username] = roles
+
+	return roles, nil
+}
+
+// enrich returns a copy of u with the workspace memberships in extra
+func (c *membershipCache) enrich(lister rbaclisters.ClusterRoleBindingLister, u user.Info) (user.Info, error) {
+	roles, err := c.get(lister, u.GetName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	extra := make(map[string][]string, len(u.GetExtra())+2)
+	for k, v := range u.GetExtra() {
+		extra[k] = v
+	}
+
+	workspaces := make([]string, 0)
+	workspaceRoles := make([]string, 0)
+	for _, role := range roles {
+		if len(workspaces) == 0 || workspaces[len(workspaces)-1] != role.workspace {
+			workspaces = append(workspaces, role.workspace)
+		}
+		workspaceRoles = append(workspaceRoles, role.workspace+":"+role.role)
+	}
+
+	extra[ExtraWorkspaces] = workspaces
+	extra[ExtraWorkspaceRoles] = workspaceRoles
+
+	return &user.DefaultInfo{Name: u.GetName(), UID: u.GetUID(), Groups: u.GetGroups(), Extra: extra}, nil
+}
+
+// enrichRequest adds the workspace memberships to the user of the request, the request goes on
+// unchanged if they can't be resolved.
+func (c Authentication) enrichRequest(r *http.Request) *http.Request {
+	if c.memberships == nil {
+		return r
+	}
+
+	u, ok := request.UserFrom(r.Context())
+
+	if !ok {
+		return r
+	}
+
+	enriched, err := c.memberships.enrich(c.rbacListers().ClusterRoleBindings, u)
+
+	if err != nil {
+		log.Printf("[WARNING] authentication: resolve workspaces of user %s: %v", u.GetName(), err)
+		return r
+	}
+
+	return r.WithContext(request.WithUser(r.Context(), enriched))
+}
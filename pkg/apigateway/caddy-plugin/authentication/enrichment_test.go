@@ -0,0 +1,277 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func workspaceRoleBinding(name string, users ...string) *v1.ClusterRoleBinding {
+	binding := &v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: name}}
+	for _, u := range users {
+		binding.Subjects = append(binding.Subjects, v1.Subject{Kind: v1.UserKind, Name: u})
+	}
+	return binding
+}
+
+// setupBindings replaces the shared informer factory with one caching bindings
+func setupBindings(t *testing.T, bindings ...*v1.ClusterRoleBinding) cache.Indexer {
+	objects := make([]runtime.Object, 0, len(bindings))
+	for _, binding := range bindings {
+		objects = append(objects, binding)
+	}
+
+	return setupRBAC(t, objects...).Rbac().V1().ClusterRoleBindings().Informer().GetIndexer()
+}
+
+func enrichedUser(t *testing.T, auth Authentication, u user.Info) user.Info {
+	r := httptest.NewRequest(http.MethodGet, "/kapis/tenant.kubesphere.io/v1alpha2/workspaces", nil)
+	r = r.WithContext(request.WithUser(r.Context(), u))
+
+	enriched, ok := request.UserFrom(auth.enrichRequest(r).Context())
+
+	if !ok {
+		t.Fatal("expected user in the request context")
+	}
+
+	return enriched
+}
+
+func TestWorkspaceEnrichment(t *testing.T) {
+	setupBindings(t,
+		workspaceRoleBinding("system:ws-a:workspace-admin", "alice"),
+		workspaceRoleBinding("system:ws-b:workspace-viewer", "alice", "bob"),
+		workspaceRoleBinding("system:ws-c:workspace-regular", "bob"),
+		// not a workspace role
+		workspaceRoleBinding("cluster-admin", "alice"),
+	)
+
+	auth := Authentication{memberships: newMembershipCache()}
+
+	alice := enrichedUser(t, auth, &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}, Extra: map[string][]string{"scopes": {"all"}}})
+
+	if !reflect.DeepEqual(alice.GetExtra()[ExtraWorkspaces], []string{"ws-a", "ws-b"}) {
+		t.Errorf("unexpected workspaces %v", alice.GetExtra()[ExtraWorkspaces])
+	}
+
+	if !reflect.DeepEqual(alice.GetExtra()[ExtraWorkspaceRoles], []string{"ws-a:workspace-admin", "ws-b:workspace-viewer"}) {
+		t.Errorf("unexpected workspace roles %v", alice.GetExtra()[ExtraWorkspaceRoles])
+	}
+
+	if alice.GetName() != "alice" || !reflect.DeepEqual(alice.GetGroups(), []string{"dev"}) || !reflect.DeepEqual(alice.GetExtra()["scopes"], []string{"all"}) {
+		t.Errorf("expected user kept, got %+v", alice)
+	}
+
+	carol := enrichedUser(t, auth, &user.DefaultInfo{Name: "carol"})
+
+	if workspaces, ok := carol.GetExtra()[ExtraWorkspaces]; !ok || len(workspaces) != 0 {
+		t.Errorf("expected no workspaces, got %v", carol.GetExtra())
+	}
+
+	// without the cache the request is unchanged
+	anonymous := &user.DefaultInfo{Name: "alice"}
+	if u := enrichedUser(t, Authentication{}, anonymous); u != anonymous {
+		t.Errorf("expected user unchanged, got %+v", u)
+	}
+}
+
+func TestWorkspaceEnrichmentInvalidation(t *testing.T) {
+	before := workspaceRoleBinding("system:ws-b:workspace-viewer", "alice", "bob")
+	indexer := setupBindings(t,
+		workspaceRoleBinding("system:ws-a:workspace-admin", "alice"),
+		before,
+		workspaceRoleBinding("system:ws-c:workspace-regular", "carol"),
+	)
+
+	memberships := newMembershipCache()
+	auth := Authentication{memberships: memberships}
+
+	for _, name := range []string{"alice", "carol"} {
+		enrichedUser(t, auth, &user.DefaultInfo{Name: name})
+	}
+
+	// alice is removed from ws-b
+	after := workspaceRoleBinding("system:ws-b:workspace-viewer", "bob")
+	if err := indexer.Update(after); err != nil {
+		t.Fatal(err)
+	}
+
+	// memberships are cached until the binding change is handled
+	alice := enrichedUser(t, auth, &user.DefaultInfo{Name: "alice"})
+	if !reflect.DeepEqual(alice.GetExtra()[ExtraWorkspaces], []string{"ws-a", "ws-b"}) {
+		t.Errorf("expected cached workspaces, got %v", alice.GetExtra()[ExtraWorkspaces])
+	}
+
+	memberships.invalidate(before)
+	memberships.invalidate(after)
+
+	alice = enrichedUser(t, auth, &user.DefaultInfo{Name: "alice"})
+	if !reflect.DeepEqual(alice.GetExtra()[ExtraWorkspaces], []string{"ws-a"}) {
+		t.Errorf("expected workspaces after removal, got %v", alice.GetExtra()[ExtraWorkspaces])
+	}
+
+	if _, cached := memberships.memberships["carol"]; !cached {
+		t.Error("expected memberships of carol kept")
+	}
+
+	// a binding deleted while the watch was down drops every entry
+	memberships.invalidate(cache.DeletedFinalStateUnknown{Key: "unknown", Obj: nil})
+
+	if len(memberships.memberships) != 0 {
+		t.Errorf("expected cache cleared, got %v", memberships.memberships)
+	}
+}
+
+// changingLister runs change after listing the bindings, like a binding changed while a fill lists
+type changingLister struct {
+	rbaclisters.ClusterRoleBindingLister
+	change func()
+}
+
+func (l *changingLister) List(selector labels.Selector) ([]*v1.ClusterRoleBinding, error) {
+	bindings, err := l.ClusterRoleBindingLister.List(selector)
+	if l.change != nil {
+		l.change()
+		l.change = nil
+	}
+	return bindings, err
+}
+
+func TestWorkspaceEnrichmentInvalidatedFill(t *testing.T) {
+	indexer := setupBindings(t, workspaceRoleBinding("system:ws-a:workspace-admin", "alice"))
+	memberships := newMembershipCache()
+
+	// alice joins ws-b after the fill listed the bindings, before it stores them
+	joined := workspaceRoleBinding("system:ws-b:workspace-viewer", "alice")
+	lister := &changingLister{ClusterRoleBindingLister: rbaclisters.NewClusterRoleBindingLister(indexer), change: func() {
+		if err := indexer.Add(joined); err != nil {
+			t.Fatal(err)
+		}
+		memberships.invalidate(joined)
+	}}
+
+	roles, err := memberships.get(lister, "alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(roles, []workspaceRole{{workspace: "ws-a", role: "workspace-admin"}}) {
+		t.Errorf("expected the listed memberships, got %v", roles)
+	}
+
+	if _, cached := memberships.memberships["alice"]; cached {
+		t.Fatal("expected the memberships listed before the change not cached")
+	}
+
+	roles, err = memberships.get(lister, "alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(roles, []workspaceRole{{workspace: "ws-a", role: "workspace-admin"}, {workspace: "ws-b", role: "workspace-viewer"}}) {
+		t.Errorf("expected the memberships after the change, got %v", roles)
+	}
+}
+
+func TestWorkspaceEnrichmentConcurrentInvalidation(t *testing.T) {
+	indexer := setupBindings(t)
+	lister := rbaclisters.NewClusterRoleBindingLister(indexer)
+	memberships := newMembershipCache()
+
+	const changes = 200
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// alice joins the workspaces one after the other, the handler runs after the cache is updated
+	go func() {
+		defer wg.Done()
+		for i := 0; i < changes; i++ {
+			binding := workspaceRoleBinding(fmt.Sprintf("system:ws-%03d:workspace-viewer", i), "alice")
+			if err := indexer.Add(binding); err != nil {
+				t.Error(err)
+				return
+			}
+			memberships.invalidate(binding)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for i := 0; i < changes; i++ {
+			if _, err := memberships.get(lister, "alice"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	roles, err := memberships.get(lister, "alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(roles) != changes {
+		t.Errorf("expected the %d workspaces, got %d", changes, len(roles))
+	}
+}
+
+func TestWorkspaceEnrichmentSize(t *testing.T) {
+	lister := rbaclisters.NewClusterRoleBindingLister(setupBindings(t, workspaceRoleBinding("system:ws-a:workspace-admin", "alice", "bob", "carol")))
+	memberships := newMembershipCache()
+	memberships.size = 2
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		roles, err := memberships.get(lister, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(roles) != 1 {
+			t.Errorf("expected the membership of %s, got %v", name, roles)
+		}
+	}
+
+	if len(memberships.memberships) != 2 {
+		t.Errorf("expected 2 cached memberships, got %v", memberships.memberships)
+	}
+
+	if _, cached := memberships.memberships["carol"]; !cached {
+		t.Error("expected the last memberships cached")
+	}
+}
@@ -0,0 +1,151 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// Reason codes of the denials, the Status of a denial carries exactly one of them as the type of its
+// single cause, so clients tell the denials apart. The codes are stable, they are never renamed or reused.
+const (
+	// ReasonRBACDeny is set when no role bound to the user permits the request
+	ReasonRBACDeny = "RBAC_DENY"
+	// ReasonScopeDeny is set when the scope of the token of the user forbids the request
+	ReasonScopeDeny = "SCOPE_DENY"
+	// ReasonReadOnlyMode is set when the request writes to a cluster served read-only
+	ReasonReadOnlyMode = "READONLY_MODE"
+	// ReasonRateLimited is set when the user sent too many requests
+	ReasonRateLimited = "RATE_LIMITED"
+	// ReasonEscalationDeny is set when the request grants permissions the user doesn't hold
+	ReasonEscalationDeny = "ESCALATION_DENY"
+	// ReasonIPRestricted is set when the request comes from an address the user isn't allowed from
+	ReasonIPRestricted = "IP_RESTRICTED"
+	// ReasonMetadataMismatch is set when the namespace or name of the object in the body isn't the
+	// one of the path
+	ReasonMetadataMismatch = "METADATA_MISMATCH"
+	// ReasonUnauthenticated is set when the request carries no user, or an anonymous one denied by
+	// the roles, the client should authenticate
+	ReasonUnauthenticated = "UNAUTHENTICATED"
+	// ReasonImpersonationDeny is set when the user may not impersonate the user, groups or extra of
+	// the impersonation headers
+	ReasonImpersonationDeny = "IMPERSONATION_DENY"
+	// ReasonCacheSyncing is set when the RBAC caches haven't synced yet after the start
+	ReasonCacheSyncing = "CACHE_SYNCING"
+	// ReasonNoRequestInfo is set when the request info wasn't resolved, the request didn't pass the
+	// requestinfo plugin before
+	ReasonNoRequestInfo = "NO_REQUEST_INFO"
+	// ReasonAuthorizationTimeout is set when the roles of the user weren't evaluated within the
+	// authorization timeout, the request was neither permitted nor denied
+	ReasonAuthorizationTimeout = "AUTHORIZATION_TIMEOUT"
+	// ReasonRecheckDeny is set when the roles of the API server, rechecked after a recent RBAC write
+	// through the gateway, deny the request too
+	ReasonRecheckDeny = "RECHECK_DENY"
+)
+
+// Errors returned by the authorization are wrapping one of these, callers tell them apart with errors.Is.
+var (
+	// ErrUnauthenticated is returned when the request carries no user
+	ErrUnauthenticated = errors.New("no user found in the context")
+	// ErrNoRequestInfo is returned when the request info wasn't resolved before the authorization
+	ErrNoRequestInfo = errors.New("no RequestInfo found in the context")
+	// ErrUnverifiedCertificate is returned when the client certificate isn't verified by the client CA
+	ErrUnverifiedCertificate = errors.New("client certificate not verified")
+	// ErrEvaluationFailed is returned when the roles of the user can't be evaluated, e.g. the cache
+	// can't be listed
+	ErrEvaluationFailed = errors.New("evaluate permissions failed")
+	// ErrRoleNotFound is returned when a binding refers to a missing role, the evaluation goes on
+	// without the binding, which grants nothing
+	ErrRoleNotFound = errors.New("bound role not found")
+	// ErrInvalidRoleRef is returned when a binding refers to something else than a role of the RBAC
+	// API of the kinds it may bind, the evaluation goes on without the binding
+	ErrInvalidRoleRef = errors.New("invalid role reference")
+	// ErrAuthorizationTimeout is returned when the evaluation is given up because the context of the
+	// request is done, its deadline passed or the client went away
+	ErrAuthorizationTimeout = errors.New("authorization timed out")
+)
+
+// httpStatus returns the status code of the response to a request whose authorization failed
+func httpStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, ErrUnverifiedCertificate):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// evaluationFailed wraps an error of the listers, its own kind (e.g. not found) isn't exposed
+// because it isn't the status of the request.
+func evaluationFailed(err error) error {
+	return fmt.Errorf("%w: %v", ErrEvaluationFailed, err)
+}
+
+// evaluationAborted wraps the error of the done context of an evaluation
+func evaluationAborted(ctx context.Context) error {
+	return fmt.Errorf("%w: %v", ErrAuthorizationTimeout, ctx.Err())
+}
+
+// deny writes the Status of a denial with its reason code, caddy must not write an error page in
+// place of it, so the returned status is always 0. The response to HEAD has no body.
+func deny(w http.ResponseWriter, r *http.Request, reason string, err k8serr.APIStatus) int {
+	status := err.Status()
+	status.Kind, status.APIVersion = "Status", "v1"
+
+	if status.Details == nil {
+		status.Details = &metav1.StatusDetails{}
+	}
+	status.Details.Causes = []metav1.StatusCause{{Type: metav1.CauseType(reason), Message: status.Message}}
+
+	w.Header().Add("WWW-Authenticate", fmt.Sprintf("%s,%s", status.Reason, status.Message))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(int(status.Code))
+		return 0
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(status.Code))
+
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("[WARNING] authentication: write denial of %s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	return 0
+}
+
+// unauthenticated writes the Status of a request to authenticate with a bearer token challenge,
+// clients tell it from a denial of an authenticated user by the 401 status.
+func unauthenticated(w http.ResponseWriter, r *http.Request, message string) int {
+	w.Header().Add("WWW-Authenticate", "Bearer")
+	return deny(w, r, ReasonUnauthenticated, k8serr.NewUnauthorized(message))
+}
+
+// isAnonymous reports whether u has no name or is the anonymous user
+func isAnonymous(u user.Info) bool {
+	return u.GetName() == "" || u.GetName() == user.Anonymous
+}
@@ -0,0 +1,381 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/requestinfo"
+)
+
+// requestInfoFactory resolves the request info like the gateway does
+var requestInfoFactory = requestinfo.NewResolver()
+
+// newAuthorizedRequest returns a request of u carrying the request info resolved like the gateway does
+func newAuthorizedRequest(t *testing.T, method, path string, u user.Info) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+
+	info, err := requestInfoFactory.NewRequestInfo(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r.WithContext(request.WithRequestInfo(request.WithUser(r.Context(), u), info))
+}
+
+func TestAuthorizationErrors(t *testing.T) {
+	// the cache can't be read
+	auth := Authentication{Rule: Rule{Path: "/"}, Authorizer: authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		return false, "", evaluationFailed(errors.New("cache unavailable"))
+	})}
+
+	tests := []struct {
+		request *http.Request
+		err     error
+		status  int
+	}{
+		// the failure of the evaluation isn't the status of the request
+		{request: newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods", &user.DefaultInfo{Name: "alice"}), err: ErrEvaluationFailed, status: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		status, err := auth.ServeHTTP(httptest.NewRecorder(), test.request)
+
+		if !errors.Is(err, test.err) || status != test.status {
+			t.Errorf("%s: expected %d %v, got %d %v", test.request.URL.Path, test.status, test.err, status, err)
+		}
+	}
+}
+
+func TestMissingRequestInfo(t *testing.T) {
+	auth := Authentication{Rule: Rule{Path: "/"}}
+
+	withoutInfo := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	withoutInfo = withoutInfo.WithContext(request.WithUser(withoutInfo.Context(), &user.DefaultInfo{Name: "alice"}))
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		code    int
+		reason  string
+	}{
+		{name: "without request info", request: withoutInfo, code: http.StatusBadRequest, reason: ReasonNoRequestInfo},
+		{name: "without user", request: httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil), code: http.StatusUnauthorized, reason: ReasonUnauthenticated},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		_, err := auth.ServeHTTP(recorder, test.request)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.name, recorder.Body.String(), err)
+		}
+
+		if recorder.Code != test.code || status.Code != int32(test.code) || status.Details == nil ||
+			len(status.Details.Causes) != 1 || string(status.Details.Causes[0].Type) != test.reason {
+			t.Errorf("%s: expected %d %s, got %d %+v", test.name, test.code, test.reason, recorder.Code, status)
+		}
+	}
+}
+
+func TestDenialReasons(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	// a recent write makes denials in demo go through the recheck
+	writes := newRecentWrites(time.Minute)
+	writes.reader = &fakeRBACReader{}
+	writes.record("demo", "1")
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	tests := []struct {
+		stage  string
+		auth   Authentication
+		method string
+		path   string
+		reason string
+		status int
+	}{
+		{stage: "cluster roles", auth: Authentication{Rule: Rule{Path: "/"}, Next: next}, method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", reason: ReasonRBACDeny, status: http.StatusForbidden},
+		{stage: "roles", auth: Authentication{Rule: Rule{Path: "/"}, Next: next}, method: http.MethodGet, path: "/api/v1/namespaces/demo/secrets/web", reason: ReasonRBACDeny, status: http.StatusForbidden},
+		{stage: "non resource", auth: Authentication{Rule: Rule{Path: "/"}, Next: next}, method: http.MethodGet, path: "/healthz", reason: ReasonRBACDeny, status: http.StatusForbidden},
+		{stage: "recheck after a write", auth: Authentication{Rule: Rule{Path: "/"}, Next: next, writes: writes}, method: http.MethodGet, path: "/api/v1/namespaces/demo/secrets/web", reason: ReasonRecheckDeny, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		code, err := test.auth.ServeHTTP(recorder, newAuthorizedRequest(t, test.method, test.path, alice))
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.stage, err)
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.stage, recorder.Body.String(), err)
+		}
+
+		if code != 0 || recorder.Code != test.status || int(status.Code) != test.status {
+			t.Errorf("%s: expected written %d, got %d %d %d", test.stage, test.status, code, recorder.Code, status.Code)
+		}
+
+		if status.Details == nil || len(status.Details.Causes) != 1 || string(status.Details.Causes[0].Type) != test.reason {
+			t.Errorf("%s: expected the single reason %s, got %+v", test.stage, test.reason, status.Details)
+		}
+	}
+}
+
+func TestForbiddenStatus(t *testing.T) {
+	setupRBAC(t)
+
+	recorder := httptest.NewRecorder()
+	auth := Authentication{Rule: Rule{Path: "/"}}
+
+	if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/apis/apps/v1/namespaces/demo/deployments/web", &user.DefaultInfo{Name: "alice"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusForbidden || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON denial, got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	// the header is kept for the clients reading it
+	if recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Error("expected the WWW-Authenticate header")
+	}
+
+	var status metav1.Status
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status %q: %v", recorder.Body.String(), err)
+	}
+
+	details := metav1.StatusDetails{Group: "apps", Kind: "deployments", Name: "web"}
+
+	if status.Kind != "Status" || status.APIVersion != "v1" || status.Status != metav1.StatusFailure || status.Reason != metav1.StatusReasonForbidden || status.Code != http.StatusForbidden {
+		t.Errorf("expected a forbidden Status, got %+v", status)
+	}
+
+	if status.Details == nil || status.Details.Group != details.Group || status.Details.Kind != details.Kind || status.Details.Name != details.Name {
+		t.Errorf("expected details %+v, got %+v", details, status.Details)
+	}
+
+	if !strings.Contains(status.Message, `deployments.apps "web" is forbidden`) || !strings.Contains(status.Message, `user "alice" cannot get resource "deployments"`) {
+		t.Errorf("expected the denied resource and reason in the message, got %q", status.Message)
+	}
+}
+
+func TestDeniedPermission(t *testing.T) {
+	setupRBAC(t)
+
+	tests := []struct {
+		method   string
+		path     string
+		hideUser bool
+		message  string
+		header   string
+	}{
+		{
+			method:  http.MethodDelete,
+			path:    "/apis/apps/v1/namespaces/demo/deployments/web",
+			message: `deployments.apps "web" is forbidden: user "alice" cannot delete resource "deployments" in API group version "apps/v1" in the namespace "demo"`,
+			header:  `verb="delete", group="apps", version="v1", resource="deployments", subresource="", namespace="demo", user="alice"`,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/api/v1/namespaces/demo/pods/web/log",
+			message: `pods "web" is forbidden: user "alice" cannot get resource "pods/log" in API group version "v1" in the namespace "demo"`,
+			header:  `verb="get", group="", version="v1", resource="pods", subresource="log", namespace="demo", user="alice"`,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/api/v1/nodes",
+			message: `nodes is forbidden: user "alice" cannot list resource "nodes" in API group version "v1" at the cluster scope`,
+			header:  `verb="list", group="", version="v1", resource="nodes", subresource="", namespace="", user="alice"`,
+		},
+		{
+			method:  http.MethodGet,
+			path:    "/metrics",
+			message: `forbidden: user "alice" cannot get path "/metrics"`,
+			header:  `verb="get", path="/metrics", user="alice"`,
+		},
+		{
+			method:   http.MethodDelete,
+			path:     "/apis/apps/v1/namespaces/demo/deployments/web",
+			hideUser: true,
+			message:  `deployments.apps "web" is forbidden: the user cannot delete resource "deployments" in API group version "apps/v1" in the namespace "demo"`,
+			header:   `verb="delete", group="apps", version="v1", resource="deployments", subresource="", namespace="demo"`,
+		},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		auth := Authentication{Rule: Rule{Path: "/", HideDeniedUser: test.hideUser}}
+
+		if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: "alice"})); err != nil {
+			t.Fatal(err)
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.path, recorder.Body.String(), err)
+		}
+
+		if status.Message != test.message {
+			t.Errorf("%s: expected message %q, got %q", test.path, test.message, status.Message)
+		}
+		if header := recorder.Header().Get(deniedPermissionHeader); header != test.header {
+			t.Errorf("%s: expected header %q, got %q", test.path, test.header, header)
+		}
+		if test.hideUser && strings.Contains(recorder.Header().Get("WWW-Authenticate"), "alice") {
+			t.Errorf("%s: expected the user left out, got %q", test.path, recorder.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestUnauthenticated(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// probes are public
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "probes"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: user.AllUnauthenticated}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: next}
+
+	withoutUser := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/demo/pods/web", nil)
+	info, _ := requestInfoFactory.NewRequestInfo(withoutUser)
+	withoutUser = withoutUser.WithContext(request.WithRequestInfo(withoutUser.Context(), info))
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		status  int
+		reason  string
+	}{
+		{name: "without user", request: withoutUser, status: http.StatusUnauthorized, reason: ReasonUnauthenticated},
+		{name: "anonymous", request: newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: user.Anonymous}), status: http.StatusUnauthorized, reason: ReasonUnauthenticated},
+		{name: "empty user name", request: newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{}), status: http.StatusUnauthorized, reason: ReasonUnauthenticated},
+		{name: "anonymous permitted", request: newAuthorizedRequest(t, http.MethodGet, "/healthz", &user.DefaultInfo{Name: user.Anonymous}), status: http.StatusOK},
+		{name: "authenticated denied", request: newAuthorizedRequest(t, http.MethodDelete, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: "alice"}), status: http.StatusForbidden, reason: ReasonRBACDeny},
+		{name: "authenticated permitted", request: newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: "alice"}), status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		code, err := auth.ServeHTTP(recorder, test.request)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if test.status == http.StatusOK {
+			if code != http.StatusOK {
+				t.Errorf("%s: expected permitted, got %d", test.name, code)
+			}
+			continue
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.name, recorder.Body.String(), err)
+		}
+
+		if recorder.Code != test.status || status.Details == nil || len(status.Details.Causes) != 1 || string(status.Details.Causes[0].Type) != test.reason {
+			t.Errorf("%s: expected %d %s, got %d %+v", test.name, test.status, test.reason, recorder.Code, status.Details)
+		}
+
+		challenged := sets.NewString(recorder.Header()["Www-Authenticate"]...).Has("Bearer")
+
+		if challenged != (test.status == http.StatusUnauthorized) {
+			t.Errorf("%s: expected challenged %v, got %v", test.name, test.status == http.StatusUnauthorized, recorder.Header()["Www-Authenticate"])
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	panicking := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		panic("next handler broken")
+	})
+
+	tests := []struct {
+		name       string
+		next       httpserver.Handler
+		authorizer Authorizer
+	}{
+		{name: "next handler", next: panicking, authorizer: defaultAuthorizer},
+		{name: "evaluator", next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			return http.StatusOK, nil
+		}), authorizer: authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+			var rules []v1.PolicyRule
+			return rules[0].Verbs[0] == attrs.GetVerb(), "", nil
+		})},
+	}
+
+	for _, test := range tests {
+		auth := Authentication{Rule: Rule{Path: "/"}, Next: test.next, Authorizer: test.authorizer}
+		w := httptest.NewRecorder()
+
+		status, err := auth.ServeHTTP(w, newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: "alice"}))
+
+		if status != 0 || err != nil || w.Code != http.StatusInternalServerError || w.Header().Get("X-Request-Id") == "" {
+			t.Errorf("%s: expected 500 written, got %d %v %d", test.name, status, err, w.Code)
+		}
+
+		if strings.Contains(w.Body.String(), "broken") || strings.Contains(w.Body.String(), "index out of range") {
+			t.Errorf("%s: response leaks the panic %s", test.name, w.Body.String())
+		}
+	}
+}
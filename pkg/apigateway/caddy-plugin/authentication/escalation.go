@@ -0,0 +1,387 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/api/rbac/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	// RBAC objects are small, larger bodies aren't verified and are refused
+	escalationMaxBody = 1 << 20
+	// the group of the KubeSphere IAM API, its users and workspace members are bound to cluster roles
+	iamGroupName = "iam.kubesphere.io"
+)
+
+// checkEscalation refuses creates, updates and patches of roles and bindings granting permissions the
+// user doesn't hold, like the escalate and bind checks of kube-apiserver. A role is written if the
+// user holds every permission of its rules, or the escalate verb on it, a binding if the user holds
+// every permission of the bound role, or the bind verb on it. Patches are applied to the object of
+// the informer caches, the patched object is verified. The bodies which can't be verified, not JSON
+// or too large, are refused. The writes of the IAM API binding users to roles are verified like
+// bindings, see checkIAMEscalation.
+func (c *Authentication) checkEscalation(ctx context.Context, r *http.Request, attrs authorizer.Attributes) (*k8serr.StatusError, error) {
+	verb := attrs.GetVerb()
+
+	if !attrs.IsResourceRequest() {
+		return nil, nil
+	}
+
+	if attrs.GetAPIGroup() == iamGroupName {
+		return c.checkIAMEscalation(ctx, r, attrs)
+	}
+
+	if attrs.GetAPIGroup() != v1.GroupName || (verb != "create" && verb != "update" && verb != "patch") {
+		return nil, nil
+	}
+
+	switch attrs.GetResource() {
+	case "roles", "clusterroles", "rolebindings", "clusterrolebindings":
+	default:
+		return nil, nil
+	}
+
+	if attrs.GetSubresource() != "" {
+		return nil, nil
+	}
+
+	// the users who may escalate or bind any role grant whatever they like, their bodies aren't read
+	if unrestricted, err := c.holdsUnrestricted(ctx, attrs); err != nil || unrestricted {
+		return nil, err
+	}
+
+	if verb == "patch" {
+		patch, patchType, ok := peekBody(r, escalationMaxBody, string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType))
+
+		if !ok {
+			return escalationDenied(attrs, "the permissions granted by a patch which isn't a JSON, merge or strategic merge patch of up to 1MiB can't be verified"), nil
+		}
+
+		body, err := c.patchedObject(attrs, types.PatchType(patchType), patch)
+
+		if err != nil {
+			return escalationDenied(attrs, fmt.Sprintf("the permissions granted by the patch can't be verified: %v", err)), nil
+		}
+
+		return c.checkWrittenObject(ctx, attrs, body)
+	}
+
+	body, ok := peekJSONBody(r, escalationMaxBody)
+
+	if !ok {
+		return escalationDenied(attrs, "the permissions granted by a body which isn't JSON of up to 1MiB can't be verified"), nil
+	}
+
+	return c.checkWrittenObject(ctx, attrs, body)
+}
+
+// checkWrittenObject verifies the role or binding of body
+func (c *Authentication) checkWrittenObject(ctx context.Context, attrs authorizer.Attributes, body []byte) (*k8serr.StatusError, error) {
+	switch attrs.GetResource() {
+	case "roles", "clusterroles":
+		return c.checkRoleEscalation(ctx, attrs, body)
+	default:
+		return c.checkBindingEscalation(ctx, attrs, body)
+	}
+}
+
+func (c *Authentication) checkRoleEscalation(ctx context.Context, attrs authorizer.Attributes, body []byte) (*k8serr.StatusError, error) {
+	var role v1.ClusterRole
+
+	// roles and cluster roles share the rules, the aggregation rule is the cluster roles' own
+	if err := json.Unmarshal(body, &role); err != nil {
+		return escalationDenied(attrs, fmt.Sprintf("decode the role: %v", err)), nil
+	}
+
+	if permitted, err := c.holdsVerb(ctx, attrs, "escalate", attrs.GetResource(), role.Name); err != nil || permitted {
+		return nil, err
+	}
+
+	if role.AggregationRule != nil {
+		return escalationDenied(attrs, "aggregating cluster roles requires the escalate verb"), nil
+	}
+
+	return c.checkRulesHeld(attrs, role.Rules)
+}
+
+func (c *Authentication) checkBindingEscalation(ctx context.Context, attrs authorizer.Attributes, body []byte) (*k8serr.StatusError, error) {
+	var binding v1.RoleBinding
+
+	// role bindings and cluster role bindings share the role reference
+	if err := json.Unmarshal(body, &binding); err != nil {
+		return escalationDenied(attrs, fmt.Sprintf("decode the binding: %v", err)), nil
+	}
+
+	return c.checkRoleBound(ctx, attrs, binding.RoleRef)
+}
+
+// checkRoleBound refuses the binding of roleRef if the user holds neither the bind verb on it nor
+// every permission it grants
+func (c *Authentication) checkRoleBound(ctx context.Context, attrs authorizer.Attributes, roleRef v1.RoleRef) (*k8serr.StatusError, error) {
+	resource := "clusterroles"
+	if roleRef.Kind == "Role" {
+		resource = "roles"
+	}
+
+	if permitted, err := c.holdsVerb(ctx, attrs, "bind", resource, roleRef.Name); err != nil || permitted {
+		return nil, err
+	}
+
+	rules, err := boundRules(c.rbacListers(), attrs.GetNamespace(), roleRef, nil)
+
+	if err != nil {
+		return escalationDenied(attrs, fmt.Sprintf("the bound %s %s can't be read", roleRef.Kind, roleRef.Name)), nil
+	}
+
+	return c.checkRulesHeld(attrs, rules)
+}
+
+// patchedObject returns the JSON of the role or binding of the request patched with patch
+func (c *Authentication) patchedObject(attrs authorizer.Attributes, patchType types.PatchType, patch []byte) ([]byte, error) {
+	listers := c.rbacListers()
+
+	var live interface{}
+	var err error
+
+	switch attrs.GetResource() {
+	case "roles":
+		live, err = listers.Roles.Roles(attrs.GetNamespace()).Get(attrs.GetName())
+	case "clusterroles":
+		live, err = listers.ClusterRoles.Get(attrs.GetName())
+	case "rolebindings":
+		live, err = listers.RoleBindings.RoleBindings(attrs.GetNamespace()).Get(attrs.GetName())
+	default:
+		live, err = listers.ClusterRoleBindings.Get(attrs.GetName())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	original, err := json.Marshal(live)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch patchType {
+	case types.JSONPatchType:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return operations.Apply(original)
+	case types.MergePatchType:
+		return jsonpatch.MergePatch(original, patch)
+	default:
+		// the patch strategies are the ones of the type of the live object
+		return strategicpatch.StrategicMergePatch(original, patch, live)
+	}
+}
+
+// checkIAMEscalation refuses the writes of the IAM API binding users to roles the user may not bind:
+// the users created or updated with a cluster role, and the members invited to a workspace with a
+// role of the workspace. The bodies which can't be verified are refused.
+func (c *Authentication) checkIAMEscalation(ctx context.Context, r *http.Request, attrs authorizer.Attributes) (*k8serr.StatusError, error) {
+	verb := attrs.GetVerb()
+
+	var bound func(body []byte) ([]string, error)
+
+	switch {
+	case attrs.GetResource() == "users" && attrs.GetSubresource() == "" && (verb == "create" || verb == "update"):
+		bound = func(body []byte) ([]string, error) {
+			var user struct {
+				ClusterRole string `json:"cluster_role"`
+			}
+			if err := json.Unmarshal(body, &user); err != nil || user.ClusterRole == "" {
+				return nil, err
+			}
+			return []string{user.ClusterRole}, nil
+		}
+	case attrs.GetResource() == "workspaces" && attrs.GetSubresource() == "members" && verb == "create":
+		bound = func(body []byte) ([]string, error) {
+			var members []struct {
+				Role string `json:"role"`
+			}
+			if err := json.Unmarshal(body, &members); err != nil {
+				return nil, err
+			}
+			roles := make([]string, 0, len(members))
+			for _, member := range members {
+				// the roles of a workspace are the cluster roles system:<workspace>:<role>
+				roles = append(roles, fmt.Sprintf("system:%s:%s", attrs.GetName(), member.Role))
+			}
+			return roles, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	body, ok := peekJSONBody(r, escalationMaxBody)
+
+	if !ok {
+		return escalationDenied(attrs, "the roles bound by a body which isn't JSON of up to 1MiB can't be verified"), nil
+	}
+
+	roles, err := bound(body)
+
+	if err != nil {
+		return escalationDenied(attrs, fmt.Sprintf("decode the bound roles: %v", err)), nil
+	}
+
+	for _, role := range roles {
+		if denied, err := c.checkRoleBound(ctx, attrs, v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: role}); err != nil || denied != nil {
+			return denied, err
+		}
+	}
+
+	return nil, nil
+}
+
+// holdsVerb reports whether the authorizer permits the user verb on the role of resource named name
+// in the namespace of the request
+func (c *Authentication) holdsVerb(ctx context.Context, attrs authorizer.Attributes, verb, resource, name string) (bool, error) {
+	return holdsSpecialVerb(ctx, c.authorizer(), verb, authorizer.AttributesRecord{
+		User:      attrs.GetUser(),
+		Namespace: attrs.GetNamespace(),
+		APIGroup:  v1.GroupName,
+		Resource:  resource,
+		Name:      name,
+	})
+}
+
+// holdsUnrestricted reports whether the user may escalate or bind every role the request may grant
+func (c *Authentication) holdsUnrestricted(ctx context.Context, attrs authorizer.Attributes) (bool, error) {
+	switch attrs.GetResource() {
+	case "roles", "clusterroles":
+		return c.holdsVerb(ctx, attrs, "escalate", attrs.GetResource(), "")
+	default:
+		for _, resource := range []string{"roles", "clusterroles"} {
+			if permitted, err := c.holdsVerb(ctx, attrs, "bind", resource, ""); err != nil || !permitted {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// checkRulesHeld refuses rules the user doesn't hold in the namespace of the request, or cluster
+// wide for cluster scoped requests
+func (c *Authentication) checkRulesHeld(attrs authorizer.Attributes, rules []v1.PolicyRule) (*k8serr.StatusError, error) {
+	held, err := rulesFor(c.rbacListers(), attrs.GetUser(), attrs.GetNamespace())
+
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make([]string, 0)
+
+	for _, rule := range rules {
+		for _, g := range atomicPermissions(rule) {
+			if !g.heldBy(held) {
+				missing = append(missing, g.String())
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	return escalationDenied(attrs, fmt.Sprintf("user %q is attempting to grant RBAC permissions not currently held: %s", attrs.GetUser().GetName(), strings.Join(missing, ", "))), nil
+}
+
+// grant is a single verb on a single resource, name or non resource URL granted by a rule
+type grant struct {
+	verb, apiGroup, resource, subresource, name, url string
+}
+
+// atomicPermissions breaks rule down into its permissions
+func atomicPermissions(rule v1.PolicyRule) []grant {
+	permissions := make([]grant, 0)
+
+	for _, verb := range rule.Verbs {
+		for _, url := range rule.NonResourceURLs {
+			permissions = append(permissions, grant{verb: verb, url: url})
+		}
+
+		names := rule.ResourceNames
+		if len(names) == 0 {
+			names = []string{""}
+		}
+
+		for _, apiGroup := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				resource, subresource := resource, ""
+				if i := strings.Index(resource, "/"); i >= 0 {
+					resource, subresource = resource[:i], resource[i+1:]
+				}
+				for _, name := range names {
+					permissions = append(permissions, grant{verb: verb, apiGroup: apiGroup, resource: resource, subresource: subresource, name: name})
+				}
+			}
+		}
+	}
+
+	return permissions
+}
+
+// heldBy reports whether one of rules grants the permission, wildcards are only granted by wildcards
+func (p grant) heldBy(rules []v1.PolicyRule) bool {
+	for _, rule := range rules {
+		if ruleMatchesRequest(rule, p.apiGroup, "", p.url, p.resource, p.subresource, p.name, p.verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p grant) String() string {
+	if p.url != "" {
+		return fmt.Sprintf("%s %s", p.verb, p.url)
+	}
+
+	resource := p.resource
+	if p.subresource != "" {
+		resource += "/" + p.subresource
+	}
+	if p.apiGroup != "" {
+		resource += "." + p.apiGroup
+	}
+	if p.name != "" {
+		resource += "/" + p.name
+	}
+
+	return fmt.Sprintf("%s %s", p.verb, resource)
+}
+
+func escalationDenied(attrs authorizer.Attributes, reason string) *k8serr.StatusError {
+	return k8serr.NewForbidden(schema.GroupResource{Group: attrs.GetAPIGroup(), Resource: attrs.GetResource()}, attrs.GetName(), fmt.Errorf("%s", reason))
+}
@@ -0,0 +1,192 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestEscalation(t *testing.T) {
+	setupRBAC(t,
+		// alice manages roles and bindings of demo and may read pods
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-manager"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"create", "update", "patch"}, APIGroups: []string{v1.GroupName}, Resources: []string{"roles", "rolebindings"}},
+			{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-manager"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "rbac-manager"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// bob may escalate and bind any role of demo
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-admin"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"create", "update", "patch", "escalate", "bind"}, APIGroups: []string{v1.GroupName}, Resources: []string{"roles", "rolebindings"}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-admin"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "rbac-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pod-reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "secret-reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}}},
+		// the role and binding alice patches
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "pod-reader"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "carol"}}},
+		// dave manages the users and the members of the workspaces and may read pods
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "users-manager"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"create", "update"}, APIGroups: []string{"iam.kubesphere.io"}, Resources: []string{"users", "workspaces/members"}},
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "users-manager"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "users-manager"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "dave"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "pod-viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "secret-viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "system:demo-ws:workspace-viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "system:demo-ws:workspace-admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+	)
+
+	var forwarded string
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		forwarded = string(body)
+		return http.StatusOK, err
+	})}
+
+	podReader := `{"kind":"Role","metadata":{"name":"viewer"},"rules":[{"verbs":["get","list"],"apiGroups":[""],"resources":["pods/log"]}]}`
+	secretReader := `{"kind":"Role","metadata":{"name":"viewer"},"rules":[{"verbs":["get"],"apiGroups":[""],"resources":["pods","secrets"]}]}`
+	wildcard := `{"kind":"Role","metadata":{"name":"viewer"},"rules":[{"verbs":["get"],"apiGroups":[""],"resources":["*"]}]}`
+	podReaderBinding := `{"kind":"RoleBinding","metadata":{"name":"viewer"},"roleRef":{"kind":"Role","name":"pod-reader"},"subjects":[{"kind":"User","name":"carol"}]}`
+	secretReaderBinding := `{"kind":"RoleBinding","metadata":{"name":"viewer"},"roleRef":{"kind":"Role","name":"secret-reader"},"subjects":[{"kind":"User","name":"carol"}]}`
+
+	tests := []struct {
+		name        string
+		user        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		// the permission named in the rejection
+		rejected string
+	}{
+		{name: "role of held permissions", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles", body: podReader},
+		{name: "update of held permissions", user: "alice", method: http.MethodPut, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", body: podReader},
+		{name: "role escalation", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles", body: secretReader, rejected: "get secrets"},
+		{name: "wildcard escalation", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles", body: wildcard, rejected: "get *"},
+		{name: "escalate verb", user: "bob", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles", body: secretReader},
+		{name: "binding of held permissions", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", body: podReaderBinding},
+		{name: "binding escalation", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", body: secretReaderBinding, rejected: "get secrets"},
+		{name: "bind verb", user: "bob", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", body: secretReaderBinding},
+		{name: "binding of a missing role", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", body: strings.Replace(podReaderBinding, "pod-reader", "deleted", 1), rejected: "deleted"},
+		{name: "unverifiable body", user: "alice", method: http.MethodPost, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles", contentType: "application/yaml", body: "kind: Role\n", rejected: "can't be verified"},
+		{name: "merge patch of held permissions", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", contentType: "application/merge-patch+json", body: `{"rules":[{"verbs":["list"],"apiGroups":[""],"resources":["pods"]}]}`},
+		{name: "merge patch escalation", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", contentType: "application/merge-patch+json", body: `{"rules":[{"verbs":["get"],"apiGroups":[""],"resources":["secrets"]}]}`, rejected: "get secrets"},
+		{name: "json patch escalation", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", contentType: "application/json-patch+json", body: `[{"op":"add","path":"/rules/-","value":{"verbs":["get"],"apiGroups":[""],"resources":["secrets"]}}]`, rejected: "get secrets"},
+		{name: "strategic merge patch of a binding", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings/viewer", contentType: "application/strategic-merge-patch+json", body: `{"subjects":[{"kind":"User","name":"erin"}]}`},
+		{name: "strategic merge patch escalation", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings/viewer", contentType: "application/strategic-merge-patch+json", body: `{"roleRef":{"kind":"Role","name":"secret-reader"}}`, rejected: "get secrets"},
+		{name: "patch of a missing role", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/deleted", contentType: "application/merge-patch+json", body: `{"rules":[]}`, rejected: "can't be verified"},
+		{name: "unverifiable patch", user: "alice", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", contentType: "application/apply-patch+yaml", body: "rules: []\n", rejected: "can't be verified"},
+		{name: "escalate verb patch", user: "bob", method: http.MethodPatch, path: "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/roles/viewer", contentType: "application/apply-patch+yaml", body: "rules: []\n"},
+		{name: "user of a held cluster role", user: "dave", method: http.MethodPost, path: "/kapis/iam.kubesphere.io/v1alpha2/users", body: `{"username":"erin","cluster_role":"pod-viewer"}`},
+		{name: "user without cluster role", user: "dave", method: http.MethodPut, path: "/kapis/iam.kubesphere.io/v1alpha2/users/erin", body: `{"username":"erin","email":"erin@kubesphere.io"}`},
+		{name: "user escalation", user: "dave", method: http.MethodPut, path: "/kapis/iam.kubesphere.io/v1alpha2/users/erin", body: `{"username":"erin","cluster_role":"secret-viewer"}`, rejected: "get secrets"},
+		{name: "member of a held workspace role", user: "dave", method: http.MethodPost, path: "/kapis/iam.kubesphere.io/v1alpha2/workspaces/demo-ws/members", body: `[{"username":"erin","role":"workspace-viewer"}]`},
+		{name: "member escalation", user: "dave", method: http.MethodPost, path: "/kapis/iam.kubesphere.io/v1alpha2/workspaces/demo-ws/members", body: `[{"username":"erin","role":"workspace-viewer"},{"username":"frank","role":"workspace-admin"}]`, rejected: "* *.*"},
+		{name: "unverifiable members", user: "dave", method: http.MethodPost, path: "/kapis/iam.kubesphere.io/v1alpha2/workspaces/demo-ws/members", contentType: "text/plain", body: "erin", rejected: "can't be verified"},
+		{name: "other resources", user: "alice", method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", body: ""},
+	}
+
+	for _, test := range tests {
+		forwarded = ""
+
+		r := newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: test.user})
+		r.Body = ioutil.NopCloser(strings.NewReader(test.body))
+		r.ContentLength = int64(len(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, r)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if test.rejected == "" {
+			if status != http.StatusOK || forwarded != test.body {
+				t.Errorf("%s: expected the body forwarded whole, got %d %q", test.name, status, forwarded)
+			}
+			continue
+		}
+
+		if recorder.Code != http.StatusForbidden || forwarded != "" {
+			t.Errorf("%s: expected a rejection, got %d", test.name, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), ReasonEscalationDeny) || !strings.Contains(recorder.Body.String(), test.rejected) {
+			t.Errorf("%s: expected %s naming %q, got %s", test.name, ReasonEscalationDeny, test.rejected, recorder.Body.String())
+		}
+	}
+}
+
+func TestEscalationMiddlewareListers(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-manager"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"create"}, APIGroups: []string{v1.GroupName}, Resources: []string{"rolebindings"}},
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "rbac-manager"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "rbac-manager"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pod-reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "secret-reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}}},
+	)
+
+	auth := NewAuthentication(Rule{Path: "/"}, httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	}), factory)
+
+	// the shared informers hold nothing, the writes are verified on the listers of the middleware
+	setupRBAC(t)
+
+	tests := []struct {
+		role   string
+		status int
+	}{
+		{role: "pod-reader", status: http.StatusOK},
+		{role: "secret-reader", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		body := `{"kind":"RoleBinding","metadata":{"name":"viewer"},"roleRef":{"kind":"Role","name":"` + test.role + `"},"subjects":[{"kind":"User","name":"carol"}]}`
+		r := newAuthorizedRequest(t, http.MethodPost, "/apis/rbac.authorization.k8s.io/v1/namespaces/demo/rolebindings", &user.DefaultInfo{Name: "alice"})
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, r)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.role, err)
+		}
+
+		if status != test.status && recorder.Code != test.status {
+			t.Errorf("%s: expected %d, got %d %d", test.role, test.status, status, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"strconv"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// rbacVersionHeader carries the RBAC version of the decision when Rule.RBACVersionHeader is set
+const rbacVersionHeader = "X-Authorization-RBAC-Version"
+
+// Evaluator evaluates the requests against the RBAC informers of a factory
+type Evaluator struct {
+	factory k8sinformers.SharedInformerFactory
+
+	// the versions are tracked from the first SnapshotVersion
+	track    sync.Once
+	mutex    sync.Mutex
+	versions [rbacKinds]rbacVersion
+}
+
+// the RBAC kinds in the order of the versions of Evaluator
+const (
+	roleKind = iota
+	roleBindingKind
+	clusterRoleKind
+	clusterRoleBindingKind
+	rbacKinds
+)
+
+func NewEvaluator(factory k8sinformers.SharedInformerFactory) *Evaluator {
+	return &Evaluator{factory: factory}
+}
+
+// Listers returns the listers of the RBAC informers
+func (e *Evaluator) Listers() Listers {
+	rbac := e.factory.Rbac().V1()
+	return Listers{
+		Roles:                      rbac.Roles().Lister(),
+		RoleBindings:               rbac.RoleBindings().Lister(),
+		ClusterRoles:               rbac.ClusterRoles().Lister(),
+		ClusterRoleBindings:        rbac.ClusterRoleBindings().Lister(),
+		RoleBindingSubjects:        registeredIndexer(rbac.RoleBindings().Informer().GetIndexer(), subjectIndex),
+		ClusterRoleBindingSubjects: registeredIndexer(rbac.ClusterRoleBindings().Informer().GetIndexer(), subjectIndex),
+		ClusterRoleWildcards:       registeredIndexer(rbac.ClusterRoles().Informer().GetIndexer(), wildcardIndex),
+	}
+}
+
+// Authorize is Authorize on the listers of the evaluator, it also returns the RBAC version the
+// decision was made on, see AuthorizeVersion.
+func (e *Evaluator) Authorize(attrs authorizer.Attributes) (bool, string, error) {
+	return AuthorizeVersion(e.Listers(), attrs)
+}
+
+// SnapshotVersions are the highest resource versions of the objects the RBAC informers delivered
+type SnapshotVersions struct {
+	Roles               string `json:"roles"`
+	RoleBindings        string `json:"roleBindings"`
+	ClusterRoles        string `json:"clusterRoles"`
+	ClusterRoleBindings string `json:"clusterRoleBindings"`
+}
+
+// SnapshotVersion returns the highest resource versions of the roles and bindings the RBAC informers
+// delivered, they are empty until the caches have synced. The objects are delivered to the handlers
+// after the caches hold them, the versions may be behind the caches for a moment.
+func (e *Evaluator) SnapshotVersion() SnapshotVersions {
+	e.track.Do(e.trackVersions)
+
+	for _, informer := range e.informers() {
+		if !informer.HasSynced() {
+			return SnapshotVersions{}
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	return SnapshotVersions{
+		Roles:               e.versions[roleKind].String(),
+		RoleBindings:        e.versions[roleBindingKind].String(),
+		ClusterRoles:        e.versions[clusterRoleKind].String(),
+		ClusterRoleBindings: e.versions[clusterRoleBindingKind].String(),
+	}
+}
+
+// informers returns the RBAC informers in the order of the kinds
+func (e *Evaluator) informers() [rbacKinds]cache.SharedIndexInformer {
+	rbac := e.factory.Rbac().V1()
+	return [rbacKinds]cache.SharedIndexInformer{
+		roleKind:               rbac.Roles().Informer(),
+		roleBindingKind:        rbac.RoleBindings().Informer(),
+		clusterRoleKind:        rbac.ClusterRoles().Informer(),
+		clusterRoleBindingKind: rbac.ClusterRoleBindings().Informer(),
+	}
+}
+
+// trackVersions observes the versions of the objects delivered by the informers, the objects
+// already cached are delivered to the handlers added to started informers
+func (e *Evaluator) trackVersions() {
+	for kind, informer := range e.informers() {
+		observe := e.observer(kind)
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    observe,
+			UpdateFunc: func(_, obj interface{}) { observe(obj) },
+			DeleteFunc: observe,
+		})
+	}
+}
+
+func (e *Evaluator) observer(kind int) func(obj interface{}) {
+	return func(obj interface{}) {
+		// the tombstones of the deletions missed carry the last object known
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if object, ok := obj.(metav1.Object); ok {
+			e.mutex.Lock()
+			e.versions[kind].observe(object)
+			e.mutex.Unlock()
+		}
+	}
+}
+
+// rbacVersion is the highest resource version of the roles and bindings consulted by a decision.
+// Resource versions are opaque in general, etcd ones are integers and compared as such, the
+// others are ignored. A nil version observes nothing.
+type rbacVersion uint64
+
+func (v *rbacVersion) observe(object metav1.Object) {
+	if v == nil {
+		return
+	}
+	version, err := strconv.ParseUint(object.GetResourceVersion(), 10, 64)
+	if err == nil && rbacVersion(version) > *v {
+		*v = rbacVersion(version)
+	}
+}
+
+// merge keeps the later of the versions
+func (v *rbacVersion) merge(other rbacVersion) {
+	if v != nil && other > *v {
+		*v = other
+	}
+}
+
+func (v rbacVersion) String() string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
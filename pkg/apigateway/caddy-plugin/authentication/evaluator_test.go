@@ -0,0 +1,236 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestDecisionRBACVersion(t *testing.T) {
+	binding := &v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer", ResourceVersion: "12"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}}
+
+	factory := setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer", ResourceVersion: "10"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		binding,
+	)
+
+	dir, err := ioutil.TempDir("", "samples")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "samples.json")
+
+	auth := Authentication{Rule: Rule{Path: "/", RBACVersionHeader: true}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	}), samples: newSampleRecorder(file, 1, defaultSampleMaxSize, nil)}
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, method, "/api/v1/namespaces/demo/pods/web", alice)); err != nil {
+			t.Fatal(err)
+		}
+		return recorder
+	}
+
+	if recorder := serve(http.MethodGet); recorder.Header().Get(rbacVersionHeader) != "12" {
+		t.Errorf("expected the version of the binding, got %q", recorder.Header().Get(rbacVersionHeader))
+	}
+
+	// bob joins the binding
+	updated := binding.DeepCopy()
+	updated.ResourceVersion = "15"
+	updated.Subjects = append(updated.Subjects, v1.Subject{Kind: v1.UserKind, Name: "bob"})
+
+	if err := factory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer().Update(updated); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder := serve(http.MethodGet); recorder.Header().Get(rbacVersionHeader) != "15" {
+		t.Errorf("expected the version of the updated binding, got %q", recorder.Header().Get(rbacVersionHeader))
+	}
+
+	denied := serve(http.MethodDelete)
+
+	var status metav1.Status
+	if err := json.Unmarshal(denied.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status %q: %v", denied.Body.String(), err)
+	}
+
+	if denied.Code != http.StatusForbidden || status.ResourceVersion != "15" {
+		t.Errorf("expected the denial made on version 15, got %d %+v", denied.Code, status)
+	}
+
+	if err := auth.samples.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	var versions []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sample DecisionSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, sample.RBACVersion)
+	}
+
+	if fmt.Sprint(versions) != "[12 15 15]" {
+		t.Errorf("expected the samples recorded with the versions of their decisions, got %v", versions)
+	}
+}
+
+// fakeRBACServer serves lists of an object of each RBAC kind at resourceVersion, watches have no
+// events until done is closed
+func fakeRBACServer(resourceVersion string, done <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		kinds := map[string]string{"roles": "RoleList", "rolebindings": "RoleBindingList", "clusterroles": "ClusterRoleList", "clusterrolebindings": "ClusterRoleBindingList"}
+		object := fmt.Sprintf(`{"metadata":{"name":"viewer","namespace":"demo","resourceVersion":%q}}`, resourceVersion)
+		list := metav1.List{
+			TypeMeta: metav1.TypeMeta{Kind: kinds[path.Base(r.URL.Path)], APIVersion: v1.SchemeGroupVersion.String()},
+			ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion},
+			Items:    []runtime.RawExtension{{Raw: []byte(object)}},
+		}
+		json.NewEncoder(w).Encode(list)
+	}))
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	stopCh := make(chan struct{})
+
+	server := fakeRBACServer("42", stopCh)
+	defer server.Close()
+	defer close(stopCh)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := k8sinformers.NewSharedInformerFactory(client, 0)
+	evaluator := NewEvaluator(factory)
+
+	if snapshot := evaluator.SnapshotVersion(); snapshot != (SnapshotVersions{}) {
+		t.Errorf("expected no versions before the informers sync, got %+v", snapshot)
+	}
+
+	factory.Start(stopCh)
+
+	rbac := factory.Rbac().V1()
+	if !cache.WaitForCacheSync(stopCh, rbac.Roles().Informer().HasSynced, rbac.RoleBindings().Informer().HasSynced,
+		rbac.ClusterRoles().Informer().HasSynced, rbac.ClusterRoleBindings().Informer().HasSynced) {
+		t.Fatal("expected the caches synced")
+	}
+
+	expected := SnapshotVersions{Roles: "42", RoleBindings: "42", ClusterRoles: "42", ClusterRoleBindings: "42"}
+
+	// the handlers receive the objects after the caches hold them
+	err = wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return evaluator.SnapshotVersion() == expected, nil
+	})
+
+	if err != nil {
+		t.Errorf("expected %+v, got %+v", expected, evaluator.SnapshotVersion())
+	}
+}
+
+func TestMiddlewareListers(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	// registered again by the middleware of every site
+	if err := registerIndexes(factory); err != nil {
+		t.Fatalf("expected the registered indexes skipped, got %v", err)
+	}
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := NewAuthentication(Rule{Path: "/"}, next, factory)
+
+	if rbac, ok := auth.Authorizer.(*rbacAuthorizer); !ok || rbac.listers.ClusterRoleBindingSubjects == nil {
+		t.Fatal("expected the listers built with the indexes")
+	}
+
+	// the middleware keeps deciding on the listers it was built with
+	setupRBAC(t)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	if status, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice)); status != http.StatusOK || err != nil {
+		t.Errorf("expected permitted on the listers of the middleware, got %d %v", status, err)
+	}
+
+	// a middleware without authorizer decides on the shared ones
+	shared := Authentication{Rule: Rule{Path: "/"}, Next: next}
+	recorder := httptest.NewRecorder()
+
+	if _, err := shared.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice)); recorder.Code != http.StatusForbidden || err != nil {
+		t.Errorf("expected forbidden on the shared listers, got %d %v", recorder.Code, err)
+	}
+}
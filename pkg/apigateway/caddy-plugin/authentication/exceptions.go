@@ -0,0 +1,196 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/clientip"
+)
+
+const (
+	// an exception matching more than this fraction of the sample routes is reported
+	defaultShadowThreshold = 0.5
+	bypassLogSize          = 100
+)
+
+// sampleRoutes are known API routes, they are used to detect exceptions which bypass
+// most of the protected API.
+var sampleRoutes = []string{
+	"/api/v1/namespaces/default/pods",
+	"/api/v1/namespaces/default/services",
+	"/api/v1/nodes",
+	"/apis/apps/v1/namespaces/default/deployments",
+	"/apis/rbac.authorization.k8s.io/v1/clusterroles",
+	"/kapis/iam.kubesphere.io/v1alpha2/users",
+	"/kapis/iam.kubesphere.io/v1alpha2/workspaces/system-workspace/roles",
+	"/kapis/logging.kubesphere.io/v1alpha2/cluster",
+	"/kapis/metrics.kubesphere.io/v1alpha2/nodes",
+	"/kapis/monitoring.kubesphere.io/v1alpha2/cluster",
+	"/kapis/operations.kubesphere.io/v1alpha2/namespaces/default/jobs/demo",
+	"/kapis/resources.kubesphere.io/v1alpha2/namespaces/default/deployments",
+	"/kapis/resources.kubesphere.io/v1alpha2/namespaces",
+	"/kapis/servicemesh.kubesphere.io/v1alpha2/namespaces/default/services/demo/metrics",
+	"/kapis/tenant.kubesphere.io/v1alpha2/workspaces",
+}
+
+// validateExceptions returns warnings of excepted paths which unintentionally shadow the
+// protected path: exceptions matching the whole protected path, or matching more than
+// threshold of the protected routes.
+func validateExceptions(rule Rule, routes []string, threshold float64) []string {
+	warnings := make([]string, 0)
+
+	protected := make([]string, 0)
+	for _, route := range routes {
+		if httpserver.Path(route).Matches(rule.Path) {
+			protected = append(protected, route)
+		}
+	}
+
+	for _, exception := range rule.ExceptedPath {
+		// "/", "/*" and "" match every path
+		if exceptionMatches(cleanPath(rule.Path), exception) {
+			warnings = append(warnings, fmt.Sprintf("excepted path %q shadows the protected path %q, every request bypasses authorization", exception, rule.Path))
+			continue
+		}
+
+		if len(protected) == 0 {
+			continue
+		}
+
+		shadowed := 0
+		for _, route := range protected {
+			if exceptionMatches(route, exception) {
+				shadowed++
+			}
+		}
+
+		if fraction := float64(shadowed) / float64(len(protected)); fraction > threshold {
+			warnings = append(warnings, fmt.Sprintf("excepted path %q bypasses authorization of %d of %d known routes under %q", exception, shadowed, len(protected), rule.Path))
+		}
+	}
+
+	return warnings
+}
+
+// exceptionMatches reports whether the cleaned requestPath is excepted by exception. An exception
+// matches its path and every path below it, "/prefix/*" is written for "/prefix" too. Trailing
+// slashes don't matter and a part of a segment is never matched: "/kapis/version" doesn't match
+// "/kapis/version2", the wildcard of "/kapis/ver*" is literal.
+func exceptionMatches(requestPath, exception string) bool {
+	if prefix, ok := wildcardPrefix(exception, "/*"); ok {
+		exception = prefix
+	}
+
+	exception = cleanPath(exception)
+
+	return exception == "/" || requestPath == exception || strings.HasPrefix(requestPath, exception+"/")
+}
+
+// bypassRecord is a request which bypassed authorization by an excepted path
+type bypassRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	ClientIP  string    `json:"clientIP"`
+	Exception string    `json:"exception"`
+}
+
+// bypassLog keeps the recent bypassed requests in a ring buffer
+type bypassLog struct {
+	mutex   sync.Mutex
+	records []bypassRecord
+	next    int
+	full    bool
+}
+
+func newBypassLog(size int) *bypassLog {
+	return &bypassLog{records: make([]bypassRecord, size)}
+}
+
+func (l *bypassLog) record(r *http.Request, exception string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.records[l.next] = bypassRecord{Time: time.Now(), Method: r.Method, Path: r.URL.Path, ClientIP: clientip.FromRequest(r).String(), Exception: exception}
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// list returns the recent bypassed requests, the oldest first
+func (l *bypassLog) list() []bypassRecord {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.full {
+		return append([]bypassRecord{}, l.records[:l.next]...)
+	}
+
+	return append(append([]bypassRecord{}, l.records[l.next:]...), l.records[:l.next]...)
+}
+
+func (l *bypassLog) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.list()); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// serveBypassLog serves the bypass log to u if u may get the debug path as a non-resource URL, the
+// log holds the addresses and paths of the requests of the other users
+func (c Authentication) serveBypassLog(w http.ResponseWriter, r *http.Request, u user.Info) (int, error) {
+	check := &authorizer.AttributesRecord{User: u, Verb: "get", Path: c.Rule.DebugPath}
+
+	permitted, _, err := c.authorizer().Authorize(r.Context(), check)
+
+	if err != nil {
+		return httpStatus(err), err
+	}
+
+	if !permitted && isAnonymous(u) {
+		c.audit.record(r, check, false, ReasonUnauthenticated, 0)
+		return unauthenticated(w, r, "authentication required"), nil
+	}
+
+	if !permitted {
+		c.audit.record(r, check, false, ReasonRBACDeny, 0)
+		return deny(w, r, ReasonRBACDeny, k8serr.NewForbidden(schema.GroupResource{}, "", deniedPermission(check, !c.Rule.HideDeniedUser))), nil
+	}
+
+	return c.bypassed.ServeHTTP(w, r)
+}
+
+// isPreflight reports whether r is a CORS preflight request, which browsers send without credentials
+// before the requests of another origin. Plain OPTIONS requests aren't.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,428 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/requestinfo"
+)
+
+func TestValidateExceptions(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		warnings int
+	}{
+		{rule: Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/iam.kubesphere.io/v1alpha2/token"}}, warnings: 0},
+		// exception is a prefix of the protected path
+		{rule: Rule{Path: "/kapis", ExceptedPath: []string{"/kapis"}}, warnings: 1},
+		{rule: Rule{Path: "/kapis/resources.kubesphere.io", ExceptedPath: []string{"/kapis"}}, warnings: 1},
+		{rule: Rule{Path: "/", ExceptedPath: []string{"/"}}, warnings: 1},
+		// trailing comma in except directive
+		{rule: Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/iam.kubesphere.io/v1alpha2/token", ""}}, warnings: 1},
+		// each exception bypasses a few of the known routes
+		{rule: Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/resources.kubesphere.io", "/kapis/iam.kubesphere.io"}}, warnings: 0},
+		{rule: Rule{Path: "/kapis/iam.kubesphere.io", ExceptedPath: []string{"/kapis/iam.kubesphere.io/v1alpha2/"}}, warnings: 1},
+		// no known route is protected
+		{rule: Rule{Path: "/foo", ExceptedPath: []string{"/foo/bar"}}, warnings: 0},
+		{rule: Rule{Path: "/kapis", ExceptedPath: []string{"/*"}}, warnings: 1},
+		{rule: Rule{Path: "/kapis/iam.kubesphere.io", ExceptedPath: []string{"/kapis/*"}}, warnings: 1},
+	}
+
+	for _, test := range tests {
+		warnings := validateExceptions(test.rule, sampleRoutes, defaultShadowThreshold)
+		if len(warnings) != test.warnings {
+			t.Errorf("rule %+v: expected %d warnings, got %v", test.rule, test.warnings, warnings)
+		}
+	}
+}
+
+func TestValidateExceptionsThreshold(t *testing.T) {
+	routes := []string{"/kapis/a/1", "/kapis/a/2", "/kapis/b/1", "/kapis/c/1"}
+	rule := Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/a"}}
+
+	if warnings := validateExceptions(rule, routes, 0.5); len(warnings) != 0 {
+		t.Errorf("expected no warning at half of routes, got %v", warnings)
+	}
+
+	if warnings := validateExceptions(rule, routes, 0.25); len(warnings) != 1 {
+		t.Errorf("expected warning above threshold, got %v", warnings)
+	}
+}
+
+func TestSetupStrictExceptions(t *testing.T) {
+	tests := []struct {
+		input string
+		fail  bool
+	}{
+		{input: "authentication {\n path /kapis\n except /kapis\n}", fail: false},
+		{input: "authentication {\n path /kapis\n except /kapis\n strictExceptions on\n}", fail: true},
+		{input: "authentication {\n path /kapis\n except /kapis/iam.kubesphere.io/v1alpha2/token\n strictExceptions on\n}", fail: false},
+		{input: "authentication {\n path /kapis/iam.kubesphere.io\n except /kapis/iam.kubesphere.io/v1alpha2/\n strictExceptions on\n shadowThreshold 1\n}", fail: false},
+		{input: "authentication {\n path /kapis\n strictExceptions yes\n}", fail: true},
+		{input: "authentication {\n path /kapis\n strictPreflight on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n strictPreflight\n}", fail: true},
+		{input: "authentication {\n path /kapis\n hideDeniedUser on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n hideDeniedUser true\n}", fail: true},
+		{input: "authentication {\n path /kapis\n shadowThreshold 2\n}", fail: true},
+		{input: "authentication {\n path /kapis\n readYourWrites 5s\n}", fail: false},
+		{input: "authentication {\n path /kapis\n readYourWrites 1h\n}", fail: true},
+		{input: "authentication {\n path /kapis\n usage /kapis/usage\n}", fail: false},
+		{input: "authentication {\n path /kapis\n usage /usage\n}", fail: true},
+		{input: "authentication {\n path /kapis\n debug /kapis/debug/bypassed\n}", fail: false},
+		{input: "authentication {\n path /kapis\n debug /debug/bypassed\n}", fail: true},
+		{input: "authentication {\n path /kapis\n exemplars 250ms\n}", fail: false},
+		{input: "authentication {\n path /kapis\n exemplars slow\n}", fail: true},
+		{input: "authentication {\n path /kapis\n decisionCache 2s\n}", fail: false},
+		{input: "authentication {\n path /kapis\n decisionCache 0\n}", fail: false},
+		{input: "authentication {\n path /kapis\n decisionCache 1h\n}", fail: true},
+		{input: "authentication {\n path /kapis\n decisionCacheSize 1000\n}", fail: false},
+		{input: "authentication {\n path /kapis\n decisionCacheSize 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n denialCache 1500ms\n denialCacheSize 100\n}", fail: false},
+		{input: "authentication {\n path /kapis\n decisionCache 0\n denialCache 0\n}", fail: false},
+		{input: "authentication {\n path /kapis\n denialCache -1s\n}", fail: true},
+		{input: "authentication {\n path /kapis\n denialCacheSize many\n}", fail: true},
+		{input: "authentication {\n path /kapis\n subjectResolver on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n subjectResolver yes\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rbacVersionHeader on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n rbacVersionHeader yes\n}", fail: true},
+		{input: "authentication {\n path /kapis\n debugMatches on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n debugMatches verbose\n}", fail: true},
+		{input: "authentication {\n path /kapis\n debugAuthorizers on\n}", fail: false},
+		{input: "authentication {\n path /kapis\n debugAuthorizers verbose\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizationTimeout 500ms\n}", fail: false},
+		{input: "authentication {\n path /kapis\n authorizationTimeout -1s\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizationTimeout soon\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizers rbac\n}", fail: false},
+		{input: "authentication {\n path /kapis\n authorizers rbac owner\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizers\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizers rbac external\n externalAuthorizer http://opa:8181/v1/data/kubesphere/authz 200ms\n externalAuthorizerFailure open\n}", fail: false},
+		{input: "authentication {\n path /kapis\n authorizers rbac external\n}", fail: true},
+		{input: "authentication {\n path /kapis\n externalAuthorizer https://opa/v1/data/authz\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizers external\n externalAuthorizer opa:8181\n}", fail: true},
+		{input: "authentication {\n path /kapis\n authorizers external\n externalAuthorizer http://opa:8181 0s\n}", fail: true},
+		{input: "authentication {\n path /kapis\n externalAuthorizerFailure maybe\n}", fail: true},
+		{input: "authentication {\n path /kapis\n auditLog /var/log/ks-apigateway/audit.json 10485760\n auditDecisions all\n}", fail: false},
+		{input: "authentication {\n path /kapis\n auditLog stderr\n auditDecisions denied\n}", fail: false},
+		{input: "authentication {\n path /kapis\n auditLog stderr 10485760\n}", fail: true},
+		{input: "authentication {\n path /kapis\n auditLog /var/log/audit.json 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n auditLog\n}", fail: true},
+		{input: "authentication {\n path /kapis\n auditDecisions allowed\n}", fail: true},
+		{input: "authentication {\n path /kapis\n metrics :9090\n}", fail: false},
+		{input: "authentication {\n path /kapis\n metrics 127.0.0.1:9090\n}", fail: false},
+		{input: "authentication {\n path /kapis\n metrics 9090\n}", fail: true},
+		{input: "authentication {\n path /kapis\n metrics\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rateLimit 20\n}", fail: false},
+		{input: "authentication {\n path /kapis\n rateLimit 0.5 5\n rateLimitExempt system:masters system:serviceaccounts\n rateLimitUsers 100\n}", fail: false},
+		{input: "authentication {\n path /kapis\n rateLimit 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rateLimit 20 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rateLimit\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rateLimitExempt\n}", fail: true},
+		{input: "authentication {\n path /kapis\n rateLimitUsers 0\n}", fail: true},
+	}
+
+	for _, test := range tests {
+		err := Setup(caddy.NewTestController("http", test.input))
+		if test.fail && err == nil {
+			t.Errorf("%q: expected setup fails", test.input)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+		}
+	}
+}
+
+func TestParseSwitch(t *testing.T) {
+	switches := map[string]func(Rule) bool{
+		"strictExceptions":   func(r Rule) bool { return r.StrictExceptions },
+		"requirePermissions": func(r Rule) bool { return r.RequirePermissions },
+		"strictPreflight":    func(r Rule) bool { return r.StrictPreflight },
+		"hideDeniedUser":     func(r Rule) bool { return r.HideDeniedUser },
+		"subjectResolver":    func(r Rule) bool { return r.SubjectResolver },
+		"debugMatches":       func(r Rule) bool { return r.DebugMatches },
+		"debugAuthorizers":   func(r Rule) bool { return r.DebugAuthorizers },
+		"rbacVersionHeader":  func(r Rule) bool { return r.RBACVersionHeader },
+	}
+
+	for option, value := range switches {
+		for _, on := range []bool{true, false} {
+			arg := "off"
+			if on {
+				arg = "on"
+			}
+
+			rule, err := parse(caddy.NewTestController("http", "authentication {\n path /kapis\n "+option+" "+arg+"\n}"))
+
+			if err != nil || value(rule) != on {
+				t.Errorf("%s %s: expected %v, got %v %v", option, arg, on, value(rule), err)
+			}
+		}
+
+		for _, args := range []string{"", " yes", " on off"} {
+			if _, err := parse(caddy.NewTestController("http", "authentication {\n path /kapis\n "+option+args+"\n}")); err == nil {
+				t.Errorf("%s%s: expected an error", option, args)
+			}
+		}
+
+		if _, err := parse(caddy.NewTestController("http", "authentication {\n path /kapis\n "+option+" yes\n}")); err == nil || !strings.Contains(err.Error(), option+" must be on or off") {
+			t.Errorf("%s yes: expected the option named in the error, got %v", option, err)
+		}
+	}
+}
+
+func TestExceptionMatches(t *testing.T) {
+	tests := []struct {
+		exception string
+		path      string
+		matches   bool
+	}{
+		{exception: "/kapis/version", path: "/kapis/version", matches: true},
+		{exception: "/kapis/version", path: "/kapis/version/", matches: true},
+		{exception: "/kapis/version/", path: "/kapis/version", matches: true},
+		{exception: "/kapis/version", path: "/kapis/version/v1", matches: true},
+		{exception: "/kapis/version", path: "/kapis/version2", matches: false},
+		{exception: "/kapis/version", path: "/kapis", matches: false},
+		{exception: "/kapis//version", path: "/kapis/version", matches: true},
+		// the wildcard suffix matches the prefix itself and anything below it
+		{exception: "/apis/*", path: "/apis", matches: true},
+		{exception: "/apis/*", path: "/apis/", matches: true},
+		{exception: "/apis/*", path: "/apis/apps/v1/deployments", matches: true},
+		{exception: "/apis/*", path: "/apis2", matches: false},
+		{exception: "/apis/*", path: "/api/v1/pods", matches: false},
+		// a wildcard within a segment is literal
+		{exception: "/kapis/ver*", path: "/kapis/version2", matches: false},
+		{exception: "/kapis/ver*", path: "/kapis/ver", matches: false},
+		{exception: "/kapis/ver*", path: "/kapis/ver*", matches: true},
+		{exception: "/kapis/*/token", path: "/kapis/iam/token", matches: false},
+		{exception: "/", path: "/kapis/version", matches: true},
+		{exception: "/*", path: "/kapis/version", matches: true},
+		{exception: "", path: "/kapis/version", matches: true},
+	}
+
+	for _, test := range tests {
+		if matches := exceptionMatches(cleanPath(test.path), test.exception); matches != test.matches {
+			t.Errorf("%q of %q: expected matches %v, got %v", test.exception, test.path, test.matches, matches)
+		}
+	}
+}
+
+func TestCleanedPaths(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "probes"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	served, forwarded := false, ""
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		served = true
+		forwarded = r.URL.Path
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/public"}}, Next: next}
+
+	// the requests carry no user, only the excepted paths and the paths out of the protected one are served
+	tests := []struct {
+		path      string
+		served    bool
+		forwarded string
+	}{
+		{path: "/kapis/public/token", served: true, forwarded: "/kapis/public/token"},
+		{path: "/kapis/public/", served: true, forwarded: "/kapis/public/"},
+		{path: "/kapis/publicity", served: false},
+		{path: "/kapis//public/token", served: true, forwarded: "/kapis/public/token"},
+		{path: "/kapis/./public/token", served: true, forwarded: "/kapis/public/token"},
+		{path: "/kapis/../kapis/public/token", served: true, forwarded: "/kapis/public/token"},
+		{path: "/kapis/public/../secret-endpoint", served: false},
+		{path: "/kapis/public/../../kapis/secret-endpoint", served: false},
+		{path: "/kapis/../kapis/secret-endpoint", served: false},
+		{path: "//kapis/secret-endpoint", served: false},
+		{path: "/other/../kapis/secret-endpoint", served: false},
+		{path: "/other/../console", served: true, forwarded: "/console"},
+		{path: "/kapis/public/%2E%2E/secret-endpoint", served: false},
+	}
+
+	for _, test := range tests {
+		served, forwarded = false, ""
+		recorder := httptest.NewRecorder()
+
+		if _, err := auth.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil)); err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+
+		if served != test.served || (!served && recorder.Code != http.StatusUnauthorized) {
+			t.Errorf("%s: expected served %v, got %v %d", test.path, test.served, served, recorder.Code)
+		}
+
+		if forwarded != test.forwarded {
+			t.Errorf("%s: expected %q forwarded, got %q", test.path, test.forwarded, forwarded)
+		}
+	}
+
+	// non resource rules match the cleaned path
+	auth = Authentication{Rule: Rule{Path: "/"}, Next: next}
+
+	for _, path := range []string{"/healthz", "//healthz", "/healthz/", "/metrics/../healthz"} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		requestinfo.CleanPath(r)
+
+		info, err := requestInfoFactory.NewRequestInfo(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r = r.WithContext(request.WithRequestInfo(request.WithUser(r.Context(), &user.DefaultInfo{Name: "alice"}), info))
+
+		code, err := auth.ServeHTTP(httptest.NewRecorder(), r)
+
+		if err != nil || code != http.StatusOK {
+			t.Errorf("%s: expected permitted, got %d %v", path, code, err)
+		}
+	}
+
+	// the request info resolved on the raw path isn't the one of the forwarded path
+	for _, path := range []string{"//healthz", "/metrics/../healthz"} {
+		served = false
+		recorder := httptest.NewRecorder()
+
+		_, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, path, &user.DefaultInfo{Name: "alice"}))
+
+		var status metav1.Status
+		json.Unmarshal(recorder.Body.Bytes(), &status)
+
+		if err != nil || recorder.Code != http.StatusBadRequest || served || status.Details == nil || string(status.Details.Causes[0].Type) != ReasonNoRequestInfo {
+			t.Errorf("%s: expected a bad request, got %d %v %s", path, recorder.Code, err, recorder.Body)
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, Rules: []v1.PolicyRule{{Verbs: []string{"options"}, NonResourceURLs: []string{"/healthz"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "probes"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "probes"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	served := false
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		served = true
+		return http.StatusOK, nil
+	})
+
+	tests := []struct {
+		name   string
+		strict bool
+		path   string
+		// the method requested by the preflight, plain OPTIONS if empty
+		requestMethod string
+		user          string
+		served        bool
+		status        int
+	}{
+		{name: "preflight", path: "/api/v1/namespaces/demo/pods", requestMethod: http.MethodDelete, served: true},
+		{name: "strict preflight", strict: true, path: "/api/v1/namespaces/demo/pods", requestMethod: http.MethodDelete, status: http.StatusUnauthorized},
+		{name: "plain options", path: "/api/v1/namespaces/demo/pods", status: http.StatusUnauthorized},
+		{name: "permitted options", path: "/healthz", user: "alice", served: true},
+		{name: "denied options", path: "/metrics", user: "alice", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		served = false
+		auth := Authentication{Rule: Rule{Path: "/", StrictPreflight: test.strict}, Next: next}
+
+		r := httptest.NewRequest(http.MethodOptions, test.path, nil)
+		if test.user != "" {
+			r = newAuthorizedRequest(t, http.MethodOptions, test.path, &user.DefaultInfo{Name: test.user})
+		}
+		r.Header.Set("Origin", "https://console.example.com")
+		if test.requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", test.requestMethod)
+		}
+
+		recorder := httptest.NewRecorder()
+
+		if _, err := auth.ServeHTTP(recorder, r); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if served != test.served || (!served && recorder.Code != test.status) {
+			t.Errorf("%s: expected served %v, got %v %d", test.name, test.served, served, recorder.Code)
+		}
+	}
+}
+
+func TestBypassDebugEndpoint(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "debugger"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/kapis/debug/*"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "debugger"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "debugger"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{
+		Rule:     Rule{Path: "/kapis", ExceptedPath: []string{"/kapis/public"}, DebugPath: "/kapis/debug/bypassed"},
+		Next:     next,
+		bypassed: newBypassLog(2),
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := auth.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/kapis/public/%d", i), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the log holds the addresses of the requests of the other users
+	for _, u := range []*user.DefaultInfo{{Name: user.Anonymous}, {Name: "alice"}} {
+		recorder := httptest.NewRecorder()
+		if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/kapis/debug/bypassed", u)); err != nil {
+			t.Fatal(err)
+		}
+		if expected := map[string]int{user.Anonymous: http.StatusUnauthorized, "alice": http.StatusForbidden}[u.Name]; recorder.Code != expected {
+			t.Errorf("expected the log refused to %s with %d, got %d %s", u.Name, expected, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/kapis/debug/bypassed", &user.DefaultInfo{Name: "admin"})); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []bypassRecord
+	if err := json.Unmarshal(recorder.Body.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest request is dropped
+	if len(records) != 2 || records[0].Path != "/kapis/public/1" || records[1].Path != "/kapis/public/2" || records[1].Exception != "/kapis/public" || records[1].ClientIP != "192.0.2.1" {
+		t.Errorf("unexpected bypassed requests %+v", records)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// AuthorizerExternal is the name of the authorizer asking a policy endpoint, configured by the
+// externalAuthorizer option
+const AuthorizerExternal = "external"
+
+const (
+	defaultExternalAuthorizerTimeout = time.Second
+	// idle connections kept to the policy endpoint, every decision waits for one
+	externalAuthorizerIdleConns = 64
+	// the decision documents are small, larger responses are cut
+	maxExternalAuthorizerResponse = 1 << 20
+	externalAuthorizerLogQPS      = 0.1
+
+	externalFailureUnreachable = "unreachable"
+	externalFailureStatus      = "status"
+	externalFailureResponse    = "response"
+)
+
+var (
+	externalAuthorizerLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "authentication_external_authorizer_duration_seconds",
+		Help:    "Latency of the calls to the external policy endpoint, failed ones included.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	})
+	externalAuthorizerFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "authentication_external_authorizer_failures_total",
+		Help: "Calls to the external policy endpoint without decision by reason, the endpoint unreachable or timed out, an unexpected status or an undecodable response.",
+	}, []string{"reason"})
+)
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(externalAuthorizerLatency); err != nil {
+		log.Printf("[ERROR] authentication: register external authorizer metrics: %v", err)
+	}
+	if err := prometheus.DefaultRegisterer.Register(externalAuthorizerFailures); err != nil {
+		log.Printf("[ERROR] authentication: register external authorizer metrics: %v", err)
+	}
+}
+
+// externalAuthorizerLogs limits the warnings about the failed calls, they fail together
+var externalAuthorizerLogs = flowcontrol.NewTokenBucketRateLimiter(externalAuthorizerLogQPS, 1)
+
+// externalInput is the input document of OPA describing the request
+type externalInput struct {
+	User            string              `json:"user"`
+	Groups          []string            `json:"groups"`
+	Extra           map[string][]string `json:"extra,omitempty"`
+	ResourceRequest bool                `json:"resourceRequest"`
+	Verb            string              `json:"verb"`
+	APIGroup        string              `json:"apiGroup,omitempty"`
+	APIVersion      string              `json:"apiVersion,omitempty"`
+	Resource        string              `json:"resource,omitempty"`
+	Subresource     string              `json:"subresource,omitempty"`
+	Name            string              `json:"name,omitempty"`
+	Namespace       string              `json:"namespace,omitempty"`
+	Path            string              `json:"path"`
+}
+
+// externalDecision is the decision document of OPA, the result is missing if the policy doesn't
+// define it, which denies the request
+type externalDecision struct {
+	Result *struct {
+		Allow bool `json:"allow"`
+	} `json:"result"`
+}
+
+// externalAuthorizer permits the requests a policy endpoint allows, like the data API of OPA: the
+// attributes are posted as {"input": {...}} and {"result": {"allow": true}} permits the request. A
+// call without decision is no opinion if failOpen is set, the other authorizers of the chain decide
+// and the decision isn't kept. It fails the authorization otherwise.
+type externalAuthorizer struct {
+	url      string
+	client   *http.Client
+	timeout  time.Duration
+	failOpen bool
+}
+
+func newExternalAuthorizer(url string, timeout time.Duration, failOpen bool) *externalAuthorizer {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:        externalAuthorizerIdleConns,
+		MaxIdleConnsPerHost: externalAuthorizerIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &externalAuthorizer{url: url, client: &http.Client{Transport: transport}, timeout: timeout, failOpen: failOpen}
+}
+
+func (a *externalAuthorizer) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	body, err := json.Marshal(map[string]externalInput{"input": newExternalInput(attrs)})
+
+	if err != nil {
+		return false, "", err
+	}
+
+	call, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+
+	if err != nil {
+		return false, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := a.client.Do(req.WithContext(call))
+
+	if err != nil {
+		externalAuthorizerLatency.Observe(time.Since(start).Seconds())
+		// the whole authorization is given up, not only the call
+		if ctx.Err() != nil {
+			return false, "", evaluationAborted(ctx)
+		}
+		return a.undecided(ctx, externalFailureUnreachable, err)
+	}
+
+	defer func() {
+		// drained for the connection to be reused
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxExternalAuthorizerResponse))
+		resp.Body.Close()
+	}()
+
+	var decision externalDecision
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxExternalAuthorizerResponse)).Decode(&decision)
+
+	externalAuthorizerLatency.Observe(time.Since(start).Seconds())
+
+	if resp.StatusCode != http.StatusOK {
+		return a.undecided(ctx, externalFailureStatus, fmt.Errorf("status %d", resp.StatusCode))
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, "", evaluationAborted(ctx)
+		}
+		return a.undecided(ctx, externalFailureResponse, err)
+	}
+
+	return decision.Result != nil && decision.Result.Allow, "", nil
+}
+
+// undecided counts a call without decision, it's no opinion when failing open and an error otherwise
+func (a *externalAuthorizer) undecided(ctx context.Context, reason string, err error) (bool, string, error) {
+	externalAuthorizerFailures.WithLabelValues(reason).Inc()
+
+	if externalAuthorizerLogs.TryAccept() {
+		log.Printf("[WARNING] authentication: external authorizer %s: %v, fail open: %v", a.url, err, a.failOpen)
+	}
+
+	if !a.failOpen {
+		return false, "", evaluationFailed(fmt.Errorf("external authorizer: %v", err))
+	}
+
+	markUndecided(ctx)
+	return false, "", nil
+}
+
+// checkExternalAuthorizer returns an error unless the external authorizer is both configured and
+// in the chain, or neither
+func checkExternalAuthorizer(rule Rule) error {
+	chained := false
+	for _, name := range rule.Authorizers {
+		chained = chained || name == AuthorizerExternal
+	}
+
+	if chained && rule.ExternalAuthorizerURL == "" {
+		return fmt.Errorf("authorizer %s requires externalAuthorizer", AuthorizerExternal)
+	}
+
+	if !chained && rule.ExternalAuthorizerURL != "" {
+		return fmt.Errorf("externalAuthorizer is set but %s isn't in the authorizers", AuthorizerExternal)
+	}
+
+	return nil
+}
+
+func newExternalInput(attrs authorizer.Attributes) externalInput {
+	u := attrs.GetUser()
+	return externalInput{
+		User:            u.GetName(),
+		Groups:          u.GetGroups(),
+		Extra:           u.GetExtra(),
+		ResourceRequest: attrs.IsResourceRequest(),
+		Verb:            attrs.GetVerb(),
+		APIGroup:        attrs.GetAPIGroup(),
+		APIVersion:      attrs.GetAPIVersion(),
+		Resource:        attrs.GetResource(),
+		Subresource:     attrs.GetSubresource(),
+		Name:            attrs.GetName(),
+		Namespace:       attrs.GetNamespace(),
+		Path:            attrs.GetPath(),
+	}
+}
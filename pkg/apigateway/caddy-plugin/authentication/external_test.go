@@ -0,0 +1,300 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// policyServer decides like OPA on the user of the input, it records the inputs and counts the
+// connections
+type policyServer struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	inputs      []externalInput
+	connections int32
+}
+
+func newPolicyServer() *policyServer {
+	s := &policyServer{}
+
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var document struct {
+			Input externalInput `json:"input"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&document) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.mutex.Lock()
+		s.inputs = append(s.inputs, document.Input)
+		s.mutex.Unlock()
+
+		switch document.Input.User {
+		case "alice":
+			w.Write([]byte(`{"result": {"allow": true}}`))
+		case "bob":
+			w.Write([]byte(`{"result": {"allow": false}}`))
+		case "carol":
+			// undefined by the policy
+			w.Write([]byte(`{}`))
+		case "dave":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "erin":
+			w.Write([]byte(`allow`))
+		case "frank":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{"result": {"allow": true}}`))
+		}
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&s.connections, 1)
+		}
+	}
+	s.Start()
+
+	return s
+}
+
+func externalFailureCount(t *testing.T, reason string) float64 {
+	var metric dto.Metric
+	if err := externalAuthorizerFailures.WithLabelValues(reason).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestExternalAuthorizer(t *testing.T) {
+	server := newPolicyServer()
+	defer server.Close()
+
+	// the calls without decision fail the authorization when failing closed, they are no opinion
+	// when failing open
+	tests := []struct {
+		user      string
+		permitted bool
+		failure   string
+	}{
+		{user: "alice", permitted: true},
+		{user: "bob", permitted: false},
+		{user: "carol", permitted: false},
+		{user: "dave", failure: externalFailureStatus},
+		{user: "erin", failure: externalFailureResponse},
+		{user: "frank", failure: externalFailureUnreachable},
+	}
+
+	for _, failOpen := range []bool{false, true} {
+		external := newExternalAuthorizer(server.URL, 50*time.Millisecond, failOpen)
+
+		for _, test := range tests {
+			attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: test.user}, ResourceRequest: true, Verb: "get", Namespace: "demo", Resource: "pods"}
+
+			failures := 0.0
+			if test.failure != "" {
+				failures = externalFailureCount(t, test.failure)
+			}
+
+			var undecided int32
+			permitted, _, err := external.Authorize(withUndecided(context.Background(), &undecided), attrs)
+
+			failed := test.failure != "" && !failOpen
+
+			if permitted != test.permitted || errors.Is(err, ErrEvaluationFailed) != failed || (err != nil && !failed) {
+				t.Errorf("%s, fail open %v: expected %v failed %v, got %v %v", test.user, failOpen, test.permitted, failed, permitted, err)
+			}
+
+			if marked := undecided != 0; marked != (test.failure != "" && failOpen) {
+				t.Errorf("%s, fail open %v: unexpected undecided %v", test.user, failOpen, marked)
+			}
+
+			if test.failure != "" && externalFailureCount(t, test.failure)-failures != 1 {
+				t.Errorf("%s: expected a %s failure counted", test.user, test.failure)
+			}
+		}
+	}
+}
+
+func TestExternalAuthorizerInput(t *testing.T) {
+	server := newPolicyServer()
+	defer server.Close()
+
+	external := newExternalAuthorizer(server.URL, time.Second, false)
+
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"dev", "system:authenticated"}, Extra: map[string][]string{"scopes": {"read"}}}
+	requests := []authorizer.AttributesRecord{
+		{User: alice, ResourceRequest: true, Verb: "update", APIGroup: "apps", APIVersion: "v1", Resource: "deployments", Subresource: "scale", Name: "web", Namespace: "demo", Path: "/apis/apps/v1/namespaces/demo/deployments/web/scale"},
+		{User: alice, Verb: "get", Path: "/healthz"},
+	}
+
+	// the pooled connection serves every call
+	for i := 0; i < 10; i++ {
+		for _, attrs := range requests {
+			if permitted, _, err := external.Authorize(context.Background(), &attrs); !permitted || err != nil {
+				t.Fatalf("expected permitted, got %v %v", permitted, err)
+			}
+		}
+	}
+
+	expected := []externalInput{
+		{User: "alice", Groups: alice.Groups, Extra: alice.Extra, ResourceRequest: true, Verb: "update", APIGroup: "apps", APIVersion: "v1", Resource: "deployments", Subresource: "scale", Name: "web", Namespace: "demo", Path: "/apis/apps/v1/namespaces/demo/deployments/web/scale"},
+		{User: "alice", Groups: alice.Groups, Extra: alice.Extra, Verb: "get", Path: "/healthz"},
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if !reflect.DeepEqual(server.inputs[:2], expected) {
+		t.Errorf("expected the inputs %+v, got %+v", expected, server.inputs[:2])
+	}
+
+	if connections := atomic.LoadInt32(&server.connections); connections != 1 {
+		t.Errorf("expected the connection reused, got %d connections", connections)
+	}
+}
+
+func TestExternalAuthorizerCanceled(t *testing.T) {
+	server := newPolicyServer()
+	defer server.Close()
+
+	// failing open doesn't apply to a request given up
+	external := newExternalAuthorizer(server.URL, time.Second, true)
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "frank"}, ResourceRequest: true, Verb: "get", Resource: "pods"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if permitted, _, err := external.Authorize(ctx, attrs); permitted || !errors.Is(err, ErrAuthorizationTimeout) {
+		t.Errorf("expected the authorization given up, got %v %v", permitted, err)
+	}
+}
+
+func TestExternalAuthorizerChain(t *testing.T) {
+	server := newPolicyServer()
+	defer server.Close()
+
+	setupRBAC(t)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	rule := Rule{Path: "/", Authorizers: []string{AuthorizerRBAC, AuthorizerExternal}, ExternalAuthorizerURL: server.URL, ExternalAuthorizerTimeout: time.Second}
+	auth := Authentication{Rule: rule, Next: next, Authorizer: newAuthorizer(rule, sharedListers(), nil)}
+
+	// bound to no role, allowed by the policy
+	if status, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods", &user.DefaultInfo{Name: "alice"})); status != http.StatusOK || err != nil {
+		t.Errorf("expected alice permitted by the policy, got %d %v", status, err)
+	}
+
+	recorder := httptest.NewRecorder()
+
+	if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods", &user.DefaultInfo{Name: "bob"})); recorder.Code != http.StatusForbidden || err != nil {
+		t.Errorf("expected bob denied, got %d %v", recorder.Code, err)
+	}
+}
+
+func TestExternalAuthorizerOutage(t *testing.T) {
+	server := newPolicyServer()
+	server.Close()
+
+	setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Name: "viewer", Namespace: "demo"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer", Namespace: "demo"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+	)
+
+	var served *http.Request
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		served = r
+		return http.StatusOK, nil
+	})
+
+	// the policy endpoint is down, failing open leaves the decisions to RBAC
+	rule := Rule{Path: "/", Authorizers: []string{AuthorizerRBAC, AuthorizerExternal}, ExternalAuthorizerURL: server.URL, ExternalAuthorizerTimeout: 50 * time.Millisecond, ExternalAuthorizerFailOpen: true, DenialCacheTTL: time.Minute, DenialCacheSize: 10}
+	auth := Authentication{Rule: rule, Next: next, Authorizer: newAuthorizer(rule, sharedListers(), nil), decisions: newDecisionCache(0, 0, rule.DenialCacheTTL, rule.DenialCacheSize)}
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		status int
+		user   string
+	}{
+		{name: "permitted by RBAC", path: "/api/v1/namespaces/demo/pods", status: http.StatusOK, user: "bob"},
+		{name: "denied by RBAC", path: "/api/v1/namespaces/demo/secrets", status: http.StatusForbidden},
+		{name: "other namespace", path: "/api/v1/namespaces/other/pods", status: http.StatusForbidden},
+		{name: "impersonated user", path: "/api/v1/namespaces/demo/pods", header: map[string]string{"Impersonate-User": "admin"}, status: http.StatusForbidden},
+		{name: "impersonated group", path: "/api/v1/namespaces/demo/pods", header: map[string]string{"Impersonate-User": "bob", "Impersonate-Group": "system:masters"}, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		served = nil
+		recorder := httptest.NewRecorder()
+
+		r := newAuthorizedRequest(t, http.MethodGet, test.path, &user.DefaultInfo{Name: "bob"})
+		for key, value := range test.header {
+			r.Header.Set(key, value)
+		}
+
+		if _, err := auth.ServeHTTP(recorder, r); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.status, recorder.Code, recorder.Body)
+		}
+
+		if test.status == http.StatusOK {
+			if u, _ := request.UserFrom(served.Context()); u == nil || u.GetName() != test.user {
+				t.Errorf("%s: expected served as %s, got %v", test.name, test.user, u)
+			}
+		}
+	}
+
+	// the denials without the opinion of the policy endpoint aren't kept
+	if len(auth.decisions.denied.entries.Keys()) != 0 {
+		t.Errorf("expected no denial kept, got %d", len(auth.decisions.denied.entries.Keys()))
+	}
+
+	// failing closed, the authorization fails
+	rule.ExternalAuthorizerFailOpen = false
+	auth = Authentication{Rule: rule, Next: next, Authorizer: newAuthorizer(rule, sharedListers(), nil)}
+
+	if status, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/secrets", &user.DefaultInfo{Name: "bob"})); status != http.StatusInternalServerError || !errors.Is(err, ErrEvaluationFailed) {
+		t.Errorf("expected the authorization failed, got %d %v", status, err)
+	}
+}
@@ -0,0 +1,288 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/gofuzz"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// fuzzValues are picked for most generated strings, so that rules, bindings and requests overlap:
+// wildcards, subresources, deep and odd paths, subject kinds and a few names.
+var fuzzValues = []string{
+	"", "*", "*/*", "/", "//", " ", "\x00", "é",
+	"get", "list", "create", "delete",
+	"apps", "pods", "pods/log", "pods/*", "*/log", "*/scale", "deployments/scale/status", "log", "scale",
+	"/healthz", "/healthz/*", "/healthz*", "/api/*", "*/", "/api/v1/../..", "/api//v1",
+	v1.UserKind, v1.GroupKind, "alice", "dev", "demo", "viewer",
+}
+
+type fuzzRequest struct {
+	ResourceRequest bool
+	Verb            string
+	APIGroup        string
+	APIVersion      string
+	Resource        string
+	Subresource     string
+	Name            string
+	Namespace       string
+	Path            string
+	User            string
+	Groups          []string
+}
+
+func (r *fuzzRequest) attributes() *authorizer.AttributesRecord {
+	return &authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: r.User, Groups: r.Groups},
+		ResourceRequest: r.ResourceRequest,
+		Verb:            r.Verb,
+		APIGroup:        r.APIGroup,
+		APIVersion:      r.APIVersion,
+		Resource:        r.Resource,
+		Subresource:     r.Subresource,
+		Name:            r.Name,
+		Namespace:       r.Namespace,
+		Path:            r.Path,
+	}
+}
+
+// fuzzRBAC is a small set of roles and bindings, a binding is a ClusterRoleBinding if its namespace is empty
+type fuzzRBAC struct {
+	Roles []struct {
+		Namespace string
+		Name      string
+		Rules     []v1.PolicyRule
+	}
+	Bindings []struct {
+		Namespace string
+		Role      string
+		Subjects  []v1.Subject
+	}
+}
+
+// objects returns the roles and bindings, bound roles missing from the set are added without rules
+func (f *fuzzRBAC) objects() []runtime.Object {
+	objects := make([]runtime.Object, 0)
+	roles := make(map[string]bool)
+
+	for _, role := range f.Roles {
+		meta := metav1.ObjectMeta{Namespace: role.Namespace, Name: role.Name}
+		if role.Namespace == "" {
+			objects = append(objects, &v1.ClusterRole{ObjectMeta: meta, Rules: role.Rules})
+		} else {
+			objects = append(objects, &v1.Role{ObjectMeta: meta, Rules: role.Rules})
+		}
+		roles[role.Namespace+"/"+role.Name] = true
+	}
+
+	for i, binding := range f.Bindings {
+		meta := metav1.ObjectMeta{Namespace: binding.Namespace, Name: fmt.Sprintf("binding-%d", i)}
+		if binding.Namespace == "" {
+			objects = append(objects, &v1.ClusterRoleBinding{ObjectMeta: meta, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: binding.Role}, Subjects: binding.Subjects})
+		} else {
+			objects = append(objects, &v1.RoleBinding{ObjectMeta: meta, RoleRef: v1.RoleRef{Kind: "Role", Name: binding.Role}, Subjects: binding.Subjects})
+		}
+
+		if key := binding.Namespace + "/" + binding.Role; !roles[key] {
+			roles[key] = true
+			meta := metav1.ObjectMeta{Namespace: binding.Namespace, Name: binding.Role}
+			if binding.Namespace == "" {
+				objects = append(objects, &v1.ClusterRole{ObjectMeta: meta})
+			} else {
+				objects = append(objects, &v1.Role{ObjectMeta: meta})
+			}
+		}
+	}
+
+	return objects
+}
+
+func newAuthorizationFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.NewWithSeed(seed).NilChance(0.2).NumElements(0, 3).Funcs(
+		func(s *string, c fuzz.Continue) {
+			if c.Intn(4) > 0 {
+				*s = fuzzValues[c.Intn(len(fuzzValues))]
+			} else {
+				*s = c.RandString()
+			}
+		},
+	)
+}
+
+var (
+	allResources    = v1.PolicyRule{Verbs: []string{v1.VerbAll}, APIGroups: []string{v1.APIGroupAll}, Resources: []string{v1.ResourceAll}}
+	allNonResources = v1.PolicyRule{Verbs: []string{v1.VerbAll}, NonResourceURLs: []string{v1.NonResourceAll}}
+)
+
+// checkRuleMatching verifies the properties of the match of rule and r: it's deterministic, a rule
+// needs verbs and the wildcard rules match every request in their scope
+func checkRuleMatching(t *testing.T, rule v1.PolicyRule, r fuzzRequest) {
+	t.Helper()
+
+	matched := ruleMatchesRequest(rule, r.APIGroup, r.APIVersion, r.Path, r.Resource, r.Subresource, r.Name, r.Verb)
+
+	if matched != ruleMatchesRequest(rule, r.APIGroup, r.APIVersion, r.Path, r.Resource, r.Subresource, r.Name, r.Verb) {
+		t.Errorf("nondeterministic match of rule %+v and request %+v", rule, r)
+	}
+
+	if matched && len(rule.Verbs) == 0 {
+		t.Errorf("rule without verbs %+v matches request %+v", rule, r)
+	}
+
+	if r.Resource != "" && !ruleMatchesRequest(allResources, r.APIGroup, r.APIVersion, "", r.Resource, r.Subresource, r.Name, r.Verb) {
+		t.Errorf("rule of all resources doesn't match request %+v", r)
+	}
+
+	if r.Path != "" && !ruleMatchesRequest(allNonResources, "", "", r.Path, "", "", "", r.Verb) {
+		t.Errorf("rule of all non resource URLs doesn't match request %+v", r)
+	}
+
+	for _, spec := range rule.NonResourceURLs {
+		checkPathMatching(t, r.Path, spec, r.Name)
+	}
+}
+
+// checkPathMatching verifies that path matches itself and the wildcards, and that its match of spec
+// is deterministic
+func checkPathMatching(t *testing.T, path, spec, suffix string) {
+	t.Helper()
+
+	if !pathMatches(path, v1.NonResourceAll) || !pathMatches(path, path) || !pathMatches(path+suffix, path+"*") {
+		t.Errorf("path %q doesn't match itself or a wildcard", path)
+	}
+
+	if pathMatches(path, spec) != pathMatches(path, spec) {
+		t.Errorf("nondeterministic match of path %q and %q", path, spec)
+	}
+}
+
+// TestRuleMatchingFuzz checks the generated rules and requests
+func TestRuleMatchingFuzz(t *testing.T) {
+	fuzzer := newAuthorizationFuzzer(1)
+
+	for i := 0; i < 20000; i++ {
+		var rule v1.PolicyRule
+		var r fuzzRequest
+		fuzzer.Fuzz(&rule)
+		fuzzer.Fuzz(&r)
+
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					t.Fatalf("panic on rule %+v and request %+v: %v", rule, r, p)
+				}
+			}()
+
+			checkRuleMatching(t, rule, r)
+			checkPathMatching(t, r.Path, r.Path, r.Name)
+		}()
+	}
+}
+
+func TestRuleMatchingCases(t *testing.T) {
+	tests := []struct {
+		rule    v1.PolicyRule
+		request fuzzRequest
+	}{
+		// no verbs
+		{rule: v1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}}, request: fuzzRequest{Verb: "get", Resource: "pods"}},
+		// subresource wildcard
+		{rule: v1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods/*"}}, request: fuzzRequest{Verb: "get", Resource: "pods", Subresource: "log"}},
+		// resource wildcard
+		{rule: v1.PolicyRule{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"*/scale"}}, request: fuzzRequest{Verb: "update", APIGroup: "apps", Resource: "deployments", Subresource: "scale"}},
+		// deep subresource
+		{rule: v1.PolicyRule{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"deployments/scale/status"}}, request: fuzzRequest{Verb: "get", APIGroup: "apps", Resource: "deployments", Subresource: "scale/status"}},
+		// resource names
+		{rule: v1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{"\x00", "é"}}, request: fuzzRequest{Verb: "get", Resource: "pods", Name: "é"}},
+		// path prefix
+		{rule: v1.PolicyRule{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz*"}}, request: fuzzRequest{Verb: "get", Path: "/healthz/ready", Name: "viewer"}},
+		// odd paths
+		{rule: v1.PolicyRule{Verbs: []string{"get"}, NonResourceURLs: []string{"*/", "/api//v1"}}, request: fuzzRequest{Verb: "get", Path: "/api/v1/../..", Name: "/"}},
+		// empty request
+		{rule: allResources},
+	}
+
+	for _, test := range tests {
+		checkRuleMatching(t, test.rule, test.request)
+	}
+}
+
+func TestPathMatchingValues(t *testing.T) {
+	for _, path := range fuzzValues {
+		for _, spec := range fuzzValues {
+			checkPathMatching(t, path, spec, "viewer")
+		}
+	}
+}
+
+func TestPermissionValidateFuzz(t *testing.T) {
+	fuzzer := newAuthorizationFuzzer(1)
+
+	for i := 0; i < 1000; i++ {
+		var rbac fuzzRBAC
+		var r fuzzRequest
+		fuzzer.Fuzz(&rbac)
+		fuzzer.Fuzz(&r)
+
+		objects := rbac.objects()
+
+		// half of the users are granted everything
+		admin := i%2 == 0
+		if admin {
+			objects = append(objects,
+				&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "fuzz-admin"}, Rules: []v1.PolicyRule{allResources, allNonResources}},
+				&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "fuzz-admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "fuzz-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: r.User}}},
+			)
+		}
+
+		setupRBAC(t, objects...)
+		attrs := r.attributes()
+
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					t.Fatalf("panic on request %+v with %+v: %v", r, rbac, p)
+				}
+			}()
+
+			permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs)
+
+			if err != nil {
+				t.Fatalf("request %+v with %+v: %v", r, rbac, err)
+			}
+
+			if again, _, _ := permissionValidate(context.Background(), sharedListers(), attrs); again != permitted {
+				t.Errorf("nondeterministic decision of request %+v with %+v", r, rbac)
+			}
+
+			inScope := (r.ResourceRequest && r.Resource != "") || (!r.ResourceRequest && r.Path != "")
+
+			if admin && inScope && !permitted {
+				t.Errorf("request %+v of admin isn't permitted", r)
+			}
+		}()
+	}
+}
@@ -0,0 +1,153 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// Identity sources, the user of a request is resolved by the first configured source having one
+const (
+	// IdentityContext is the user set in the context by a previous plugin, like authenticate, the
+	// default source. The token headers are never read, the clients may send them.
+	IdentityContext = "context"
+	// IdentityClientCert is the user of the client certificate of the TLS connection, its common
+	// name is the user and its organizations are the groups. Certificates not verified by the
+	// client CA are denied.
+	IdentityClientCert = "clientCert"
+)
+
+// identitySource resolves the user of a request, ok is false if it has none for the request
+type identitySource interface {
+	user(r *http.Request) (u user.Info, ok bool, err error)
+}
+
+type contextSource struct{}
+
+func (contextSource) user(r *http.Request) (user.Info, bool, error) {
+	u, ok := request.UserFrom(r.Context())
+	return u, ok, nil
+}
+
+// certificateSource verifies the client certificates against roots
+type certificateSource struct {
+	roots *x509.CertPool
+	now   func() time.Time
+}
+
+func (s certificateSource) user(r *http.Request) (user.Info, bool, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, false, nil
+	}
+
+	certificate := r.TLS.PeerCertificates[0]
+
+	options := x509.VerifyOptions{
+		Roots:         s.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   s.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, intermediate := range r.TLS.PeerCertificates[1:] {
+		options.Intermediates.AddCert(intermediate)
+	}
+
+	if _, err := certificate.Verify(options); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrUnverifiedCertificate, err)
+	}
+
+	if certificate.Subject.CommonName == "" {
+		return nil, false, fmt.Errorf("%w: no common name", ErrUnverifiedCertificate)
+	}
+
+	return &user.DefaultInfo{Name: certificate.Subject.CommonName, Groups: certificate.Subject.Organization}, true, nil
+}
+
+// LoadClientCA reads the PEM bundle of the CAs of the client certificates, for the listeners
+// verifying them like the gateway
+func LoadClientCA(file string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+
+	return roots, nil
+}
+
+// newIdentitySources returns the sources named in rule, in order
+func newIdentitySources(rule Rule) ([]identitySource, error) {
+	sources := make([]identitySource, 0, len(rule.IdentitySources))
+
+	for _, name := range rule.IdentitySources {
+		switch name {
+		case IdentityContext:
+			sources = append(sources, contextSource{})
+		case IdentityClientCert:
+			if rule.ClientCA == "" {
+				return nil, fmt.Errorf("identity source %s requires clientCA", name)
+			}
+			roots, err := LoadClientCA(rule.ClientCA)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, certificateSource{roots: roots, now: time.Now})
+		default:
+			return nil, fmt.Errorf("unknown identity source %s", name)
+		}
+	}
+
+	return sources, nil
+}
+
+// identify sets the user of the first source having one in the context of the request, the
+// request is unauthenticated if none has. A source failing to resolve the user denies the request.
+// The request is unchanged if no source is configured, the user is the one of the context.
+func (c Authentication) identify(r *http.Request) (*http.Request, error) {
+	if len(c.identities) == 0 {
+		return r, nil
+	}
+
+	for _, source := range c.identities {
+		u, ok, err := source.user(r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return r.WithContext(request.WithUser(r.Context(), u)), nil
+		}
+	}
+
+	return nil, ErrUnauthenticated
+}
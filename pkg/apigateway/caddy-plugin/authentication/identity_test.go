@@ -0,0 +1,290 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{certificate: certificate, key: key}
+}
+
+// issue returns a client certificate of subject valid until notAfter
+func (ca *testCA) issue(t *testing.T, subject pkix.Name, notAfter time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      subject,
+		NotBefore:    notAfter.Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
+
+// writeBundle writes the PEM bundle of the certificates of cas to a temporary file
+func writeBundle(t *testing.T, dir string, cas ...*testCA) string {
+	var bundle []byte
+
+	for _, ca := range cas {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.certificate.Raw})...)
+	}
+
+	file := filepath.Join(dir, "ca.pem")
+
+	if err := ioutil.WriteFile(file, bundle, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// newAnonymousRequest returns a request carrying the request info only
+func newAnonymousRequest(t *testing.T, certificates ...*x509.Certificate) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/demo/pods", nil)
+
+	info, err := requestInfoFactory.NewRequestInfo(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = r.WithContext(request.WithRequestInfo(r.Context(), info))
+
+	if len(certificates) > 0 {
+		r.TLS = &tls.ConnectionState{PeerCertificates: certificates}
+	}
+
+	return r
+}
+
+func TestIdentitySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	trusted := newTestCA(t, "trusted")
+	other := newTestCA(t, "other")
+
+	verified := trusted.issue(t, pkix.Name{CommonName: "alice", Organization: []string{"developers", "auditors"}}, time.Now().Add(time.Hour))
+	expired := trusted.issue(t, pkix.Name{CommonName: "alice"}, time.Now().Add(-time.Minute))
+	wrongCA := other.issue(t, pkix.Name{CommonName: "admin", Organization: []string{"system:masters"}}, time.Now().Add(time.Hour))
+
+	permitting := authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		return true, "", nil
+	})
+
+	var identified user.Info
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		identified, _ = request.UserFrom(r.Context())
+		return http.StatusOK, nil
+	})
+
+	withHeader := func(r *http.Request) *http.Request {
+		r.Header.Set(constants.UserNameHeader, "bob")
+		r.Header.Set("X-Token-Groups", "testers")
+		return r
+	}
+
+	withContextUser := func(r *http.Request) *http.Request {
+		return r.WithContext(request.WithUser(r.Context(), &user.DefaultInfo{Name: "carol"}))
+	}
+
+	tests := []struct {
+		name    string
+		sources []string
+		request *http.Request
+		user    string
+		groups  string
+		err     error
+	}{
+		// the organizations are a set, sorted by the encoding
+		{name: "verified", sources: []string{IdentityClientCert}, request: newAnonymousRequest(t, verified), user: "alice", groups: "auditors,developers"},
+		{name: "expired", sources: []string{IdentityClientCert, IdentityContext}, request: withContextUser(newAnonymousRequest(t, expired)), err: ErrUnverifiedCertificate},
+		{name: "wrong CA", sources: []string{IdentityClientCert, IdentityContext}, request: withContextUser(newAnonymousRequest(t, wrongCA)), err: ErrUnverifiedCertificate},
+		{name: "no certificate", sources: []string{IdentityClientCert}, request: newAnonymousRequest(t), err: ErrUnauthenticated},
+		// the first source having a user wins
+		{name: "certificate before context", sources: []string{IdentityClientCert, IdentityContext}, request: withContextUser(newAnonymousRequest(t, verified)), user: "alice", groups: "auditors,developers"},
+		{name: "context without certificate", sources: []string{IdentityClientCert, IdentityContext}, request: withContextUser(newAnonymousRequest(t)), user: "carol"},
+		// the token headers sent by the clients are never a user
+		{name: "token headers", sources: []string{IdentityClientCert, IdentityContext}, request: withHeader(newAnonymousRequest(t)), err: ErrUnauthenticated},
+		// the user of the context is ignored if it isn't a source
+		{name: "context not a source", sources: []string{IdentityClientCert}, request: withContextUser(newAnonymousRequest(t)), err: ErrUnauthenticated},
+		{name: "default context", request: withContextUser(newAnonymousRequest(t, wrongCA)), user: "carol"},
+	}
+
+	for _, test := range tests {
+		rule := Rule{Path: "/", IdentitySources: test.sources, ClientCA: writeBundle(t, dir, trusted)}
+
+		identities, err := newIdentitySources(rule)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		identified = nil
+		auth := Authentication{Rule: rule, Next: next, Authorizer: permitting, identities: identities}
+
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, test.request)
+
+		// requests without user are answered with a challenge
+		if test.err == ErrUnauthenticated {
+			if err != nil || status != 0 || recorder.Code != http.StatusUnauthorized || identified != nil {
+				t.Errorf("%s: expected unauthorized, got %d %d %v", test.name, status, recorder.Code, err)
+			}
+			continue
+		}
+
+		if test.err != nil {
+			if !errors.Is(err, test.err) || status != http.StatusUnauthorized || identified != nil {
+				t.Errorf("%s: expected unauthorized by %v, got %d %v", test.name, test.err, status, err)
+			}
+			continue
+		}
+
+		if err != nil || status != http.StatusOK || identified == nil || identified.GetName() != test.user || strings.Join(identified.GetGroups(), ",") != test.groups {
+			t.Errorf("%s: expected %s in %s, got %d %v %v", test.name, test.user, test.groups, status, err, identified)
+		}
+	}
+}
+
+func TestSetupIdentitySources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "identity")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	bundle := writeBundle(t, dir, newTestCA(t, "trusted"))
+
+	empty := filepath.Join(dir, "empty.pem")
+
+	if err := ioutil.WriteFile(empty, []byte("no certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input string
+		fail  bool
+	}{
+		{input: "authentication {\n path /kapis\n identitySource context\n}", fail: false},
+		{input: "authentication {\n path /kapis\n identitySource header context\n}", fail: true},
+		{input: "authentication {\n path /kapis\n identitySource clientCert context\n clientCA " + bundle + "\n}", fail: false},
+		{input: "authentication {\n path /kapis\n identitySource\n}", fail: true},
+		{input: "authentication {\n path /kapis\n identitySource token\n}", fail: true},
+		{input: "authentication {\n path /kapis\n identitySource clientCert\n}", fail: true},
+		{input: "authentication {\n path /kapis\n identitySource clientCert\n clientCA " + filepath.Join(dir, "missing.pem") + "\n}", fail: true},
+		{input: "authentication {\n path /kapis\n identitySource clientCert\n clientCA " + empty + "\n}", fail: true},
+	}
+
+	for _, test := range tests {
+		err := Setup(caddy.NewTestController("http", test.input))
+		if test.fail && err == nil {
+			t.Errorf("%q: expected setup fails", test.input)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// impersonate replaces the user of the request with the one of the impersonation headers, like
+// kube-apiserver does. The user must be permitted the impersonate verb on the impersonated user (or
+// service account), on each group and on each extra value, the first one missing is refused. The
+// request is unchanged without impersonation headers. The verified headers are forwarded. The error
+// wraps ErrAuthorizationTimeout if ctx is done before the checks.
+func impersonate(ctx context.Context, authz Authorizer, r *http.Request) (*http.Request, *k8serr.StatusError, error) {
+	target := r.Header.Get(authenticationv1.ImpersonateUserHeader)
+	groups := r.Header[authenticationv1.ImpersonateGroupHeader]
+
+	extra := make(map[string][]string)
+	for header, values := range r.Header {
+		if strings.HasPrefix(header, authenticationv1.ImpersonateUserExtraHeaderPrefix) {
+			key := unescapeExtraKey(strings.ToLower(strings.TrimPrefix(header, authenticationv1.ImpersonateUserExtraHeaderPrefix)))
+			extra[key] = values
+		}
+	}
+
+	if target == "" {
+		if len(groups) > 0 || len(extra) > 0 {
+			return nil, k8serr.NewBadRequest("impersonating groups or extra requires impersonating a user"), nil
+		}
+		return r, nil, nil
+	}
+
+	u, ok := request.UserFrom(r.Context())
+
+	if !ok {
+		return nil, nil, ErrUnauthenticated
+	}
+
+	impersonator := WithImplicitGroups(u)
+
+	checks := make([]authorizer.AttributesRecord, 0, 1+len(groups)+len(extra))
+
+	if namespace, name, err := serviceaccount.SplitUsername(target); err == nil {
+		checks = append(checks, authorizer.AttributesRecord{Namespace: namespace, Resource: "serviceaccounts", Name: name})
+	} else {
+		checks = append(checks, authorizer.AttributesRecord{Resource: "users", Name: target})
+	}
+
+	for _, group := range groups {
+		checks = append(checks, authorizer.AttributesRecord{Resource: "groups", Name: group})
+	}
+
+	for key, values := range extra {
+		for _, value := range values {
+			checks = append(checks, authorizer.AttributesRecord{APIGroup: authenticationv1.GroupName, Resource: "userextras", Subresource: key, Name: value})
+		}
+	}
+
+	for _, check := range checks {
+		check.User = impersonator
+
+		permitted, err := holdsSpecialVerb(ctx, authz, "impersonate", check)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !permitted {
+			resource := schema.GroupResource{Group: check.APIGroup, Resource: check.Resource}
+			return nil, k8serr.NewForbidden(resource, check.Name, fmt.Errorf("user %q cannot impersonate %s %q", impersonator.GetName(), check.Resource, check.Name)), nil
+		}
+	}
+
+	impersonated := &user.DefaultInfo{Name: target, Groups: groups, Extra: extra}
+
+	return r.WithContext(request.WithUser(r.Context(), impersonated)), nil, nil
+}
+
+// unescapeExtraKey decodes the %-encoded bytes of the key of an extra header, the keys may hold
+// characters the header names can't like "/". Malformed keys are kept as they are, like kube-apiserver.
+func unescapeExtraKey(encoded string) string {
+	key, err := url.PathUnescape(encoded)
+
+	if err != nil {
+		return encoded
+	}
+
+	return key
+}
@@ -0,0 +1,172 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestImpersonation(t *testing.T) {
+	setupRBAC(t,
+		// admin may impersonate anyone, carol only users
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "impersonator"}, Rules: []v1.PolicyRule{{Verbs: []string{"impersonate"}, APIGroups: []string{""}, Resources: []string{"users", "groups", "serviceaccounts"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "impersonator"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "impersonator"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "user-impersonator"}, Rules: []v1.PolicyRule{{Verbs: []string{"impersonate"}, APIGroups: []string{""}, Resources: []string{"users"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "user-impersonator"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "user-impersonator"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "carol"}}},
+		// alice may read the pods of demo, the dev group may delete them
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor"}, Rules: []v1.PolicyRule{{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "editor"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}},
+	)
+
+	var decided user.Info
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		decided, _ = request.UserFrom(r.Context())
+		return http.StatusOK, nil
+	})}
+
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		target string
+		groups []string
+		status int
+		// the user the request is forwarded as, or the target named in the refusal
+		expected string
+	}{
+		{name: "user", user: "admin", method: http.MethodGet, target: "alice", status: http.StatusOK, expected: "alice"},
+		{name: "decided for the user", user: "admin", method: http.MethodDelete, target: "alice", status: http.StatusForbidden},
+		{name: "user and groups", user: "admin", method: http.MethodDelete, target: "bob", groups: []string{"dev", "qa"}, status: http.StatusOK, expected: "bob"},
+		{name: "service account", user: "admin", method: http.MethodGet, target: "system:serviceaccount:demo:builder", status: http.StatusForbidden},
+		{name: "unauthorized user", user: "alice", method: http.MethodGet, target: "admin", status: http.StatusForbidden, expected: `users "admin"`},
+		{name: "unauthorized group", user: "carol", method: http.MethodDelete, target: "bob", groups: []string{"dev"}, status: http.StatusForbidden, expected: `groups "dev"`},
+		{name: "groups without user", user: "admin", method: http.MethodGet, groups: []string{"dev"}, status: http.StatusBadRequest},
+		{name: "without impersonation", user: "alice", method: http.MethodGet, status: http.StatusOK, expected: "alice"},
+	}
+
+	for _, test := range tests {
+		decided = nil
+
+		r := newAuthorizedRequest(t, test.method, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: test.user})
+		if test.target != "" {
+			r.Header.Set("Impersonate-User", test.target)
+		}
+		for _, group := range test.groups {
+			r.Header.Add("Impersonate-Group", group)
+		}
+
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, r)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if status == 0 {
+			status = recorder.Code
+		}
+
+		if status != test.status {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.status, status, recorder.Body.String())
+			continue
+		}
+
+		if status == http.StatusOK {
+			if decided == nil || decided.GetName() != test.expected || strings.Join(decided.GetGroups(), ",") != strings.Join(test.groups, ",") {
+				t.Errorf("%s: expected the request forwarded as %s %v, got %v", test.name, test.expected, test.groups, decided)
+			}
+			continue
+		}
+
+		if test.expected != "" {
+			var status metav1.Status
+			if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Details.Causes[0].Type != ReasonImpersonationDeny || !strings.Contains(status.Message, test.expected) {
+				t.Errorf("%s: expected %s naming %s, got %+v", test.name, ReasonImpersonationDeny, test.expected, status)
+			}
+		}
+	}
+}
+
+func TestImpersonationExtra(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "impersonator"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"impersonate"}, APIGroups: []string{""}, Resources: []string{"users"}},
+			{Verbs: []string{"impersonate"}, APIGroups: []string{"authentication.k8s.io"}, Resources: []string{"userextras/example.com/scopes", "userextras/%zz"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "impersonator"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "impersonator"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	var decided user.Info
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		decided, _ = request.UserFrom(r.Context())
+		return http.StatusOK, nil
+	})}
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		// the key of the extra the request is forwarded with
+		key string
+	}{
+		{name: "escaped key", header: "Impersonate-Extra-Example.com%2fscopes", status: http.StatusOK, key: "example.com/scopes"},
+		{name: "malformed key kept", header: "Impersonate-Extra-%zz", status: http.StatusOK, key: "%zz"},
+		{name: "key not granted", header: "Impersonate-Extra-Example.com%2froles", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		decided = nil
+
+		r := newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", &user.DefaultInfo{Name: "admin"})
+		r.Header.Set("Impersonate-User", "alice")
+		r.Header.Set(test.header, "view")
+
+		recorder := httptest.NewRecorder()
+
+		if _, err := auth.ServeHTTP(recorder, r); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if recorder.Code != test.status {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.status, recorder.Code, recorder.Body.String())
+			continue
+		}
+
+		if test.status == http.StatusOK && (decided == nil || strings.Join(decided.GetExtra()[test.key], ",") != "view") {
+			t.Errorf("%s: expected the request forwarded with the extra %s, got %v", test.name, test.key, decided)
+		}
+	}
+}
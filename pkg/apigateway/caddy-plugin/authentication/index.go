@@ -0,0 +1,284 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	sliceutils "kubesphere.io/kubesphere/pkg/utils"
+)
+
+// subjectIndex indexes the role bindings by namespace and subject, and the cluster role bindings by
+// subject, see subjectKey
+const subjectIndex = "subject"
+
+// wildcardIndex indexes the cluster roles granting every verb on everything, the resources or the
+// non-resource URLs
+const (
+	wildcardIndex       = "wildcard"
+	wildcardResources   = "resources"
+	wildcardNonResource = "nonResourceURLs"
+)
+
+// roleIndex indexes the cluster role bindings by the name of their cluster role
+const roleIndex = "role"
+
+// registerIndexes registers the subject index of the role bindings and cluster role bindings, the role
+// index of the cluster role bindings and the wildcard index of the cluster roles of factory, they must
+// be registered before the informers start. The registered indexes are skipped.
+func registerIndexes(factory k8sinformers.SharedInformerFactory) error {
+	rbac := factory.Rbac().V1()
+	if err := addIndexers(rbac.RoleBindings().Informer(), cache.Indexers{subjectIndex: roleBindingSubjects}); err != nil {
+		return err
+	}
+	if err := addIndexers(rbac.ClusterRoleBindings().Informer(), cache.Indexers{subjectIndex: clusterRoleBindingSubjects, roleIndex: clusterRoleBindingRoles}); err != nil {
+		return err
+	}
+	return addIndexers(rbac.ClusterRoles().Informer(), cache.Indexers{wildcardIndex: clusterRoleWildcards})
+}
+
+// addIndexers adds the indexers not registered on informer yet
+func addIndexers(informer cache.SharedIndexInformer, indexers cache.Indexers) error {
+	registered := informer.GetIndexer().GetIndexers()
+	missing := cache.Indexers{}
+	for name, indexFunc := range indexers {
+		if _, ok := registered[name]; !ok {
+			missing[name] = indexFunc
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return informer.AddIndexers(missing)
+}
+
+// registeredIndexer returns indexer if the index name is registered, nil otherwise
+func registeredIndexer(indexer cache.Indexer, name string) cache.Indexer {
+	if _, ok := indexer.GetIndexers()[name]; !ok {
+		return nil
+	}
+	return indexer
+}
+
+// clusterRoleWildcards returns the index keys of a cluster role granting every verb on every
+// resource of every group, or on every non-resource URL, like cluster-admin. The aggregated rules
+// aren't indexed.
+func clusterRoleWildcards(obj interface{}) ([]string, error) {
+	role, ok := obj.(*v1.ClusterRole)
+	if !ok {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, 2)
+	resources, nonResource := false, false
+
+	for _, rule := range role.Rules {
+		if !sliceutils.HasString(rule.Verbs, v1.VerbAll) {
+			continue
+		}
+		if !resources && len(rule.ResourceNames) == 0 && sliceutils.HasString(rule.APIGroups, v1.APIGroupAll) && sliceutils.HasString(rule.Resources, v1.ResourceAll) {
+			resources = true
+			keys = append(keys, wildcardResources)
+		}
+		if !nonResource && sliceutils.HasString(rule.NonResourceURLs, v1.NonResourceAll) {
+			nonResource = true
+			keys = append(keys, wildcardNonResource)
+		}
+	}
+
+	return keys, nil
+}
+
+// clusterRoleBindingRoles returns the index key of the cluster role of a cluster role binding
+func clusterRoleBindingRoles(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*v1.ClusterRoleBinding)
+	if !ok || binding.RoleRef.Kind != "ClusterRole" {
+		return nil, nil
+	}
+	return []string{binding.RoleRef.Name}, nil
+}
+
+// wildcardBinding returns a cluster role binding of workspace of the user to a cluster role granting
+// everything of the kind of the request, like cluster-admin, and the role. The bindings of these roles
+// are few, they are looked up by role without fetching the other bindings of the user. It returns
+// nil if there is none, or if listers have no wildcard index.
+func wildcardBinding(listers Listers, attrs authorizer.Attributes, workspace string) (*v1.ClusterRoleBinding, *v1.ClusterRole, error) {
+	if listers.ClusterRoleWildcards == nil || listers.ClusterRoleBindingSubjects == nil {
+		return nil, nil, nil
+	}
+
+	key := wildcardNonResource
+	if attrs.IsResourceRequest() {
+		key = wildcardResources
+	}
+
+	roles, err := listers.ClusterRoleWildcards.ByIndex(wildcardIndex, key)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, object := range roles {
+		role := object.(*v1.ClusterRole)
+
+		bindings, err := listers.ClusterRoleBindingSubjects.ByIndex(roleIndex, role.Name)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, object := range bindings {
+			binding := object.(*v1.ClusterRoleBinding)
+			if workspaceOf(binding) == workspace && checkRoleRef(binding.RoleRef, "ClusterRole") == nil && appliesTo(binding.Subjects, attrs.GetUser(), "") {
+				return binding, role, nil
+			}
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// roleBindingSubjects returns the index keys of the subjects of a role binding
+func roleBindingSubjects(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*v1.RoleBinding)
+	if !ok {
+		return nil, nil
+	}
+	return subjectKeys(binding.Namespace, binding.Subjects), nil
+}
+
+// clusterRoleBindingSubjects returns the index keys of the subjects of a cluster role binding
+func clusterRoleBindingSubjects(obj interface{}) ([]string, error) {
+	binding, ok := obj.(*v1.ClusterRoleBinding)
+	if !ok {
+		return nil, nil
+	}
+	return subjectKeys("", binding.Subjects), nil
+}
+
+// subjectKeys returns the index keys of the subjects of a binding of namespace, empty for cluster
+// bindings. Service accounts are indexed by their user name, they default to namespace.
+func subjectKeys(namespace string, subjects []v1.Subject) []string {
+	keys := make([]string, 0, len(subjects))
+
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case v1.UserKind, v1.GroupKind:
+			keys = append(keys, subjectKey(namespace, subject.Kind, subject.Name))
+		case v1.ServiceAccountKind:
+			saNamespace := subject.Namespace
+			if saNamespace == "" {
+				saNamespace = namespace
+			}
+			if saNamespace != "" {
+				keys = append(keys, subjectKey(namespace, v1.UserKind, serviceaccount.MakeUsername(saNamespace, subject.Name)))
+			}
+		}
+	}
+
+	return keys
+}
+
+// subjectKey is the index key of a user or group of the bindings of namespace, empty for the cluster
+// role bindings. Namespaces and kinds have no slash, the key is unambiguous.
+func subjectKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// userKeys returns the index keys of the user and its groups in the bindings of namespace
+func userKeys(namespace string, u user.Info) []string {
+	keys := make([]string, 0, 1+len(u.GetGroups()))
+	keys = append(keys, subjectKey(namespace, v1.UserKind, u.GetName()))
+	for _, group := range u.GetGroups() {
+		keys = append(keys, subjectKey(namespace, v1.GroupKind, group))
+	}
+	return keys
+}
+
+// lookupSubjects returns the objects of indexer indexed by one of keys, once each
+func lookupSubjects(indexer cache.Indexer, keys []string) ([]interface{}, error) {
+	// a binding of several subjects of the user is found by each
+	seen := make(map[interface{}]bool)
+	found := make([]interface{}, 0)
+
+	for _, key := range keys {
+		objects, err := indexer.ByIndex(subjectIndex, key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range objects {
+			if !seen[object] {
+				seen[object] = true
+				found = append(found, object)
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// userRoleBindings returns the role bindings of namespace which may apply to the user, they are
+// looked up by the subject index if listers have it and listed otherwise. The subjects of the
+// bindings returned are still to be matched.
+func userRoleBindings(listers Listers, namespace string, u user.Info) ([]*v1.RoleBinding, error) {
+	if listers.RoleBindingSubjects == nil {
+		return listers.RoleBindings.RoleBindings(namespace).List(labels.Everything())
+	}
+
+	objects, err := lookupSubjects(listers.RoleBindingSubjects, userKeys(namespace, u))
+
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]*v1.RoleBinding, 0, len(objects))
+	for _, object := range objects {
+		bindings = append(bindings, object.(*v1.RoleBinding))
+	}
+
+	return bindings, nil
+}
+
+// userClusterRoleBindings returns the cluster role bindings which may apply to the user, like
+// userRoleBindings
+func userClusterRoleBindings(listers Listers, u user.Info) ([]*v1.ClusterRoleBinding, error) {
+	if listers.ClusterRoleBindingSubjects == nil {
+		return listers.ClusterRoleBindings.List(labels.Everything())
+	}
+
+	objects, err := lookupSubjects(listers.ClusterRoleBindingSubjects, userKeys("", u))
+
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := make([]*v1.ClusterRoleBinding, 0, len(objects))
+	for _, object := range objects {
+		bindings = append(bindings, object.(*v1.ClusterRoleBinding))
+	}
+
+	return bindings, nil
+}
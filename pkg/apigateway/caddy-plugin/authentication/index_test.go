@@ -0,0 +1,360 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+func TestSubjectIndex(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "user"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "group"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}},
+		// found by both subjects, returned once
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "both"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}, {Kind: v1.GroupKind, Name: "dev"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "other-user"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		// a group named like the user is indexed apart
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "group-alice"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "user"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// service accounts of the namespace of the binding by default
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "builder"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Name: "builder"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "deployer"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Namespace: "ci", Name: "deployer"}}},
+	)
+
+	indexed := NewEvaluator(factory).Listers()
+	listed := indexed
+	listed.RoleBindingSubjects = nil
+
+	if indexed.RoleBindingSubjects == nil {
+		t.Fatal("expected the subject index registered")
+	}
+
+	tests := []struct {
+		user      user.Info
+		namespace string
+		bindings  []string
+	}{
+		{user: &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}}, namespace: "demo", bindings: []string{"both", "group", "user"}},
+		{user: &user.DefaultInfo{Name: "alice"}, namespace: "demo", bindings: []string{"both", "user"}},
+		{user: &user.DefaultInfo{Name: "carol", Groups: []string{"alice"}}, namespace: "demo", bindings: []string{"group-alice"}},
+		{user: &user.DefaultInfo{Name: "alice"}, namespace: "other", bindings: []string{"user"}},
+		{user: &user.DefaultInfo{Name: "alice"}, namespace: "empty", bindings: []string{}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:demo:builder"}, namespace: "demo", bindings: []string{"builder"}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:ci:deployer"}, namespace: "demo", bindings: []string{"deployer"}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:demo:deployer"}, namespace: "demo", bindings: []string{}},
+	}
+
+	for _, test := range tests {
+		found, err := userRoleBindings(indexed, test.namespace, test.user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0, len(found))
+		for _, binding := range found {
+			names = append(names, binding.Name)
+		}
+		sort.Strings(names)
+
+		if fmt.Sprint(names) != fmt.Sprint(test.bindings) {
+			t.Errorf("%s in %s: expected %v, got %v", test.user.GetName(), test.namespace, test.bindings, names)
+		}
+
+		// the listed bindings applying to the user are the ones of the index
+		all, err := userRoleBindings(listed, test.namespace, test.user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applying := make([]string, 0)
+		for _, binding := range all {
+			if appliesTo(binding.Subjects, test.user, binding.Namespace) {
+				applying = append(applying, binding.Name)
+			}
+		}
+		sort.Strings(applying)
+
+		if fmt.Sprint(applying) != fmt.Sprint(test.bindings) {
+			t.Errorf("%s in %s: expected %v listed, got %v", test.user.GetName(), test.namespace, test.bindings, applying)
+		}
+	}
+}
+
+func TestClusterSubjectIndex(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "user"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "group"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "authenticated"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: user.AllAuthenticated}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "other-user"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "deployer"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Namespace: "ci", Name: "deployer"}}},
+		// service accounts of cluster role bindings have no default namespace
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "builder"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Name: "builder"}}},
+	)
+
+	indexed := NewEvaluator(factory).Listers()
+	listed := indexed
+	listed.ClusterRoleBindingSubjects = nil
+
+	if indexed.ClusterRoleBindingSubjects == nil {
+		t.Fatal("expected the subject index registered")
+	}
+
+	tests := []struct {
+		user     user.Info
+		bindings []string
+	}{
+		{user: WithImplicitGroups(&user.DefaultInfo{Name: "alice", Groups: []string{"dev"}}), bindings: []string{"authenticated", "group", "user"}},
+		{user: &user.DefaultInfo{Name: "alice"}, bindings: []string{"user"}},
+		{user: WithImplicitGroups(&user.DefaultInfo{Name: "carol"}), bindings: []string{"authenticated"}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:ci:deployer"}, bindings: []string{"deployer"}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:ci:builder"}, bindings: []string{}},
+	}
+
+	for _, test := range tests {
+		found, err := userClusterRoleBindings(indexed, test.user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0, len(found))
+		for _, binding := range found {
+			names = append(names, binding.Name)
+		}
+		sort.Strings(names)
+
+		if fmt.Sprint(names) != fmt.Sprint(test.bindings) {
+			t.Errorf("%s: expected %v, got %v", test.user.GetName(), test.bindings, names)
+		}
+
+		// the listed bindings applying to the user are the ones of the index
+		all, err := userClusterRoleBindings(listed, test.user)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applying := make([]string, 0)
+		for _, binding := range all {
+			if appliesTo(binding.Subjects, test.user, "") {
+				applying = append(applying, binding.Name)
+			}
+		}
+		sort.Strings(applying)
+
+		if fmt.Sprint(applying) != fmt.Sprint(test.bindings) {
+			t.Errorf("%s: expected %v listed, got %v", test.user.GetName(), test.bindings, applying)
+		}
+	}
+}
+
+// BenchmarkRoleBindingIndex evaluates a request in a namespace of 1000 role bindings of distinct users,
+// the bindings are listed or looked up by the subject index.
+func BenchmarkRoleBindingIndex(b *testing.B) {
+	objects := []runtime.Object{
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+	}
+	for i := 0; i < 1000; i++ {
+		objects = append(objects, &v1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("viewer-%d", i)},
+			RoleRef:    v1.RoleRef{Kind: "Role", Name: "viewer"},
+			Subjects:   []v1.Subject{{Kind: v1.UserKind, Name: fmt.Sprintf("user-%d", i)}, {Kind: v1.GroupKind, Name: fmt.Sprintf("team-%d", i)}},
+		})
+	}
+
+	indexed := NewEvaluator(setupRBAC(b, objects...)).Listers()
+	listed := indexed
+	listed.RoleBindingSubjects = nil
+
+	attrs := &authorizer.AttributesRecord{User: WithImplicitGroups(&user.DefaultInfo{Name: "user-999"}), ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo", Name: "web"}
+
+	for _, benchmark := range []struct {
+		name    string
+		listers Listers
+	}{{name: "listed", listers: listed}, {name: "indexed", listers: indexed}} {
+		b.Run(benchmark.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if permitted, err := roleValidate(context.Background(), benchmark.listers, attrs, nil); err != nil || !permitted {
+					b.Fatalf("expected permitted, got %v %v", permitted, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkClusterRoleBindingIndex evaluates a request against 5000 cluster role bindings of distinct
+// users, the bindings are listed or looked up by the subject index.
+func BenchmarkClusterRoleBindingIndex(b *testing.B) {
+	objects := []runtime.Object{
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+	}
+	for i := 0; i < 5000; i++ {
+		objects = append(objects, &v1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("viewer-%d", i)},
+			RoleRef:    v1.RoleRef{Kind: "ClusterRole", Name: "viewer"},
+			Subjects:   []v1.Subject{{Kind: v1.UserKind, Name: fmt.Sprintf("user-%d", i)}, {Kind: v1.GroupKind, Name: fmt.Sprintf("team-%d", i)}},
+		})
+	}
+
+	indexed := NewEvaluator(setupRBAC(b, objects...)).Listers()
+	listed := indexed
+	listed.ClusterRoleBindingSubjects = nil
+
+	attrs := &authorizer.AttributesRecord{User: WithImplicitGroups(&user.DefaultInfo{Name: "user-4999"}), ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo", Name: "web"}
+
+	for _, benchmark := range []struct {
+		name    string
+		listers Listers
+	}{{name: "listed", listers: listed}, {name: "indexed", listers: indexed}} {
+		b.Run(benchmark.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if permitted, err := clusterRoleValidate(context.Background(), benchmark.listers, attrs, "", nil); err != nil || !permitted {
+					b.Fatalf("expected permitted, got %v %v", permitted, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWildcardClusterRoles(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+			{Verbs: []string{"*"}, NonResourceURLs: []string{"*"}},
+		}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "resources-admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		// restricted to names, groups or verbs
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "named"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}, ResourceNames: []string{"web"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "apps-admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"*"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "resources-admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "resources-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "operator"}}},
+		// a workspace role binding of cluster-admin grants nothing cluster wide
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "workspace-admin", Labels: map[string]string{constants.WorkspaceLabelKey: "demo"}}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	listers := NewEvaluator(factory).Listers()
+
+	if listers.ClusterRoleWildcards == nil {
+		t.Fatal("expected the wildcard index registered")
+	}
+
+	for _, test := range []struct {
+		attrs   authorizer.AttributesRecord
+		user    string
+		binding string
+	}{
+		{attrs: authorizer.AttributesRecord{ResourceRequest: true}, user: "admin", binding: "admin"},
+		{attrs: authorizer.AttributesRecord{ResourceRequest: true}, user: "operator", binding: "resources-admin"},
+		{attrs: authorizer.AttributesRecord{}, user: "admin", binding: "admin"},
+		{attrs: authorizer.AttributesRecord{}, user: "operator"},
+		{attrs: authorizer.AttributesRecord{ResourceRequest: true}, user: "alice"},
+		{attrs: authorizer.AttributesRecord{ResourceRequest: true}, user: "bob"},
+	} {
+		test.attrs.User = &user.DefaultInfo{Name: test.user, Groups: []string{"dev"}}
+
+		binding, _, err := wildcardBinding(listers, &test.attrs, "")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := ""
+		if binding != nil {
+			name = binding.Name
+		}
+
+		if name != test.binding {
+			t.Errorf("%s, resource request %v: expected binding %q, got %q", test.user, test.attrs.ResourceRequest, test.binding, name)
+		}
+	}
+
+	tests := []struct {
+		user      string
+		groups    []string
+		attrs     authorizer.AttributesRecord
+		permitted bool
+	}{
+		{user: "admin", groups: []string{"dev"}, attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "demo", Name: "web"}, permitted: true},
+		{user: "admin", attrs: authorizer.AttributesRecord{Verb: "get", Path: "/metrics"}, permitted: true},
+		{user: "operator", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "delete", Resource: "nodes", Name: "node1"}, permitted: true},
+		{user: "operator", attrs: authorizer.AttributesRecord{Verb: "get", Path: "/metrics"}, permitted: false},
+		{user: "alice", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "delete", Resource: "nodes", Name: "node1"}, permitted: false},
+		{user: "bob", groups: []string{"dev"}, attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo", Name: "web"}, permitted: true},
+	}
+
+	for _, test := range tests {
+		test.attrs.User = &user.DefaultInfo{Name: test.user, Groups: test.groups}
+
+		var version rbacVersion
+		permitted, err := clusterRoleValidate(context.Background(), listers, &test.attrs, "", &version)
+
+		if err != nil || permitted != test.permitted {
+			t.Errorf("%s %s: expected permitted %v, got %v %v", test.user, test.attrs.Verb, test.permitted, permitted, err)
+		}
+	}
+}
+
+// BenchmarkClusterAdmin evaluates a request of a cluster admin which is also in a group bound to 5000
+// narrow cluster roles, the binding of cluster-admin is looked for first or found among the others.
+func BenchmarkClusterAdmin(b *testing.B) {
+	objects := []runtime.Object{
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+	}
+	for i := 0; i < 5000; i++ {
+		objects = append(objects,
+			&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("widget-reader-%d", i)}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"example.com"}, Resources: []string{fmt.Sprintf("widgets%d", i)}}}},
+			&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("widget-reader-%d", i)}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: fmt.Sprintf("widget-reader-%d", i)}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}},
+		)
+	}
+
+	wildcards := NewEvaluator(setupRBAC(b, objects...)).Listers()
+	scanned := wildcards
+	scanned.ClusterRoleWildcards = nil
+
+	attrs := &authorizer.AttributesRecord{User: WithImplicitGroups(&user.DefaultInfo{Name: "admin", Groups: []string{"dev"}}), ResourceRequest: true, Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "demo", Name: "web"}
+
+	for _, benchmark := range []struct {
+		name    string
+		listers Listers
+	}{{name: "scanned", listers: scanned}, {name: "wildcards first", listers: wildcards}} {
+		b.Run(benchmark.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if permitted, err := clusterRoleValidate(context.Background(), benchmark.listers, attrs, "", nil); err != nil || !permitted {
+					b.Fatalf("expected permitted, got %v %v", permitted, err)
+				}
+			}
+		})
+	}
+}
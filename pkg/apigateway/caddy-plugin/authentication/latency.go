@@ -0,0 +1,130 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	jaegerTraceHeader = "uber-trace-id"
+	// the exemplar label holding the trace ID
+	exemplarTraceID = "trace_id"
+)
+
+var authorizationLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "authentication_authorization_duration_seconds",
+	Help:    "Latency of the authorization of requests, rechecks with the API server included.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(authorizationLatency); err != nil {
+		log.Printf("[ERROR] authentication: register latency metrics: %v", err)
+	}
+}
+
+// exemplarObserver is implemented by the observers of Prometheus clients supporting exemplars
+type exemplarObserver interface {
+	ObserveWithExemplar(value float64, exemplar prometheus.Labels)
+}
+
+// tracer returns the ID of the sampled trace a request belongs to
+type tracer interface {
+	traceID(r *http.Request) (string, bool)
+}
+
+// latencyRecorder observes the latency of authorizations. The observations above threshold carry
+// the trace ID of the request as exemplar, so that slow requests can be looked up in the traces.
+// Exemplars are disabled if threshold is 0, and skipped if the request isn't traced or the
+// Prometheus client doesn't support them.
+type latencyRecorder struct {
+	observer  prometheus.Observer
+	threshold time.Duration
+	tracer    tracer
+}
+
+func newLatencyRecorder(threshold time.Duration) *latencyRecorder {
+	return &latencyRecorder{observer: authorizationLatency, threshold: threshold, tracer: headerTracer{}}
+}
+
+func (l *latencyRecorder) observe(r *http.Request, latency time.Duration) {
+	if l.threshold > 0 && latency > l.threshold && l.tracer != nil {
+		if observer, ok := l.observer.(exemplarObserver); ok {
+			if id, ok := l.tracer.traceID(r); ok {
+				observer.ObserveWithExemplar(latency.Seconds(), prometheus.Labels{exemplarTraceID: id})
+				return
+			}
+		}
+	}
+
+	l.observer.Observe(latency.Seconds())
+}
+
+// headerTracer reads the trace context propagated by the tracing proxies in front of the gateway,
+// W3C traceparent or Jaeger uber-trace-id. Unsampled traces aren't kept, they're ignored.
+type headerTracer struct{}
+
+func (headerTracer) traceID(r *http.Request) (string, bool) {
+	// version-traceid-parentid-flags
+	if parts := strings.Split(r.Header.Get(traceparentHeader), "-"); len(parts) == 4 {
+		if isTraceID(parts[1], 32) && isSampled(parts[3]) {
+			return parts[1], true
+		}
+	}
+
+	// traceid:spanid:parentid:flags
+	if parts := strings.Split(r.Header.Get(jaegerTraceHeader), ":"); len(parts) == 4 {
+		if isTraceID(parts[0], 0) && isSampled(parts[3]) {
+			return parts[0], true
+		}
+	}
+
+	return "", false
+}
+
+// isTraceID reports whether id is a non zero hex ID of length, or up to 32 digits if length is 0
+func isTraceID(id string, length int) bool {
+	if id == "" || len(id) > 32 || (length > 0 && len(id) != length) {
+		return false
+	}
+
+	zero := true
+	for _, c := range id {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+		if c != '0' {
+			zero = false
+		}
+	}
+
+	return !zero
+}
+
+func isSampled(flags string) bool {
+	value, err := strconv.ParseUint(flags, 16, 8)
+	return err == nil && value&1 == 1
+}
@@ -0,0 +1,125 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeTracer struct{ id string }
+
+func (t fakeTracer) traceID(r *http.Request) (string, bool) {
+	return t.id, t.id != ""
+}
+
+type observation struct {
+	value    float64
+	exemplar prometheus.Labels
+}
+
+type fakeObserver struct{ observations []observation }
+
+func (o *fakeObserver) Observe(value float64) {
+	o.observations = append(o.observations, observation{value: value})
+}
+
+func (o *fakeObserver) ObserveWithExemplar(value float64, exemplar prometheus.Labels) {
+	o.observations = append(o.observations, observation{value: value, exemplar: exemplar})
+}
+
+// plainObserver doesn't support exemplars, like the observers of older Prometheus clients
+type plainObserver struct{ values []float64 }
+
+func (o *plainObserver) Observe(value float64) { o.values = append(o.values, value) }
+
+func TestLatencyExemplars(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/kapis/foo", nil)
+
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		tracer    tracer
+		latency   time.Duration
+		exemplar  bool
+	}{
+		{name: "above threshold", threshold: 100 * time.Millisecond, tracer: fakeTracer{id: "4bf92f3577b34da6a3ce929d0e0e4736"}, latency: 200 * time.Millisecond, exemplar: true},
+		{name: "below threshold", threshold: 100 * time.Millisecond, tracer: fakeTracer{id: "4bf92f3577b34da6a3ce929d0e0e4736"}, latency: 50 * time.Millisecond},
+		{name: "at threshold", threshold: 100 * time.Millisecond, tracer: fakeTracer{id: "4bf92f3577b34da6a3ce929d0e0e4736"}, latency: 100 * time.Millisecond},
+		{name: "not traced", threshold: 100 * time.Millisecond, tracer: fakeTracer{}, latency: 200 * time.Millisecond},
+		{name: "disabled", tracer: fakeTracer{id: "4bf92f3577b34da6a3ce929d0e0e4736"}, latency: 200 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		observer := &fakeObserver{}
+		recorder := &latencyRecorder{observer: observer, threshold: test.threshold, tracer: test.tracer}
+
+		recorder.observe(r, test.latency)
+
+		if len(observer.observations) != 1 || observer.observations[0].value != test.latency.Seconds() {
+			t.Fatalf("%s: expected an observation of %v, got %+v", test.name, test.latency, observer.observations)
+		}
+
+		if exemplar := observer.observations[0].exemplar; (exemplar != nil) != test.exemplar ||
+			(test.exemplar && exemplar[exemplarTraceID] != "4bf92f3577b34da6a3ce929d0e0e4736") {
+			t.Errorf("%s: expected exemplar %v, got %v", test.name, test.exemplar, exemplar)
+		}
+	}
+
+	// observers without exemplars still observe
+	observer := &plainObserver{}
+	recorder := &latencyRecorder{observer: observer, threshold: time.Millisecond, tracer: fakeTracer{id: "4bf92f3577b34da6a3ce929d0e0e4736"}}
+	recorder.observe(r, time.Second)
+
+	if len(observer.values) != 1 {
+		t.Errorf("expected a plain observation, got %v", observer.values)
+	}
+
+	// the histogram of the vendored client
+	newLatencyRecorder(time.Millisecond).observe(r, time.Second)
+}
+
+func TestHeaderTracer(t *testing.T) {
+	tests := []struct {
+		header   string
+		value    string
+		expected string
+	}{
+		{header: traceparentHeader, value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", expected: "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{header: traceparentHeader, value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{header: traceparentHeader, value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{header: traceparentHeader, value: "00-4bf92f35-00f067aa0ba902b7-01"},
+		{header: jaegerTraceHeader, value: "a3ce929d0e0e4736:00f067aa0ba902b7:0:1", expected: "a3ce929d0e0e4736"},
+		{header: jaegerTraceHeader, value: "a3ce929d0e0e4736:00f067aa0ba902b7:0:0"},
+		{header: jaegerTraceHeader, value: "xyz:00f067aa0ba902b7:0:1"},
+		{header: "X-Foo", value: "bar"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/kapis/foo", nil)
+		r.Header.Set(test.header, test.value)
+
+		if id, ok := (headerTracer{}).traceID(r); id != test.expected || ok != (test.expected != "") {
+			t.Errorf("%s %s: expected %q, got %q %v", test.header, test.value, test.expected, id, ok)
+		}
+	}
+}
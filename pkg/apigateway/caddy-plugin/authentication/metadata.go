@@ -0,0 +1,163 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// objectMeta is the part of the metadata of an object compared with the path
+type objectMeta struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// checkBodyMetadata rejects creates and updates whose body names another namespace, or for updates
+// another name, than the path. Bodies which aren't JSON, larger than maxSize or malformed aren't
+// checked, the upstream validates them. The body read is put back in front of the rest of it.
+func checkBodyMetadata(r *http.Request, attrs authorizer.Attributes, maxSize int64) *k8serr.StatusError {
+	verb := attrs.GetVerb()
+
+	if !attrs.IsResourceRequest() || (verb != "create" && verb != "update") {
+		return nil
+	}
+
+	head, ok := peekJSONBody(r, maxSize)
+
+	if !ok {
+		return nil
+	}
+
+	meta, ok := decodeObjectMeta(head)
+
+	if !ok {
+		return nil
+	}
+
+	if meta.Namespace != "" && attrs.GetNamespace() != "" && meta.Namespace != attrs.GetNamespace() {
+		return k8serr.NewBadRequest(fmt.Sprintf("the namespace of the object (%s) does not match the namespace of the path (%s)", meta.Namespace, attrs.GetNamespace()))
+	}
+
+	if verb == "update" && meta.Name != "" && attrs.GetName() != "" && meta.Name != attrs.GetName() {
+		return k8serr.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name of the path (%s)", meta.Name, attrs.GetName()))
+	}
+
+	return nil
+}
+
+// peekJSONBody returns the JSON body of r if it's up to maxSize bytes, ok is false for other bodies.
+// The body read is put back in front of the rest of it, the upstream receives it whole.
+func peekJSONBody(r *http.Request, maxSize int64) (body []byte, ok bool) {
+	body, _, ok = peekBody(r, maxSize, "application/json")
+	return body, ok
+}
+
+// peekBody returns the body of r and its media type if it's one of mediaTypes and up to maxSize
+// bytes, like peekJSONBody
+func peekBody(r *http.Request, maxSize int64, mediaTypes ...string) (body []byte, mediaType string, ok bool) {
+	if r.Body == nil {
+		return nil, "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil || !sets.NewString(mediaTypes...).Has(mediaType) {
+		return nil, "", false
+	}
+
+	if r.ContentLength > maxSize {
+		return nil, "", false
+	}
+
+	// the length may be unknown, one byte more tells the body is too large
+	head, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSize+1))
+
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+
+	if err != nil || int64(len(head)) > maxSize {
+		return nil, "", false
+	}
+
+	return head, mediaType, true
+}
+
+// decodeObjectMeta decodes the metadata of the JSON object of data, the other fields are skipped
+// token by token without being decoded. ok is false if data isn't an object.
+func decodeObjectMeta(data []byte) (meta objectMeta, ok bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return meta, false
+	}
+
+	for decoder.More() {
+		key, err := decoder.Token()
+
+		if err != nil {
+			return meta, false
+		}
+
+		if key == "metadata" {
+			return meta, decoder.Decode(&meta) == nil
+		}
+
+		if err := skipValue(decoder); err != nil {
+			return meta, false
+		}
+	}
+
+	// no metadata
+	return meta, true
+}
+
+// skipValue reads the next value of decoder, objects and arrays included
+func skipValue(decoder *json.Decoder) error {
+	depth := 0
+
+	for {
+		token, err := decoder.Token()
+
+		if err != nil {
+			return err
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestStrictMetadata(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	var forwarded string
+
+	auth := Authentication{Rule: Rule{Path: "/", StrictMetadataMaxBody: 256}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		body, err := ioutil.ReadAll(r.Body)
+		forwarded = string(body)
+		return http.StatusOK, err
+	})}
+
+	// metadata follows a field skipped without being decoded
+	demo := `{"kind":"ConfigMap","data":{"nested":[{"a":1},[2,3]]},"metadata":{"namespace":"demo","name":"web"}}`
+	large := `{"data":{"payload":"` + strings.Repeat("x", 256) + `"},"metadata":{"namespace":"other","name":"web"}}`
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		// the length isn't sent
+		chunked bool
+		// the namespace or name named in the rejection
+		rejected string
+	}{
+		{name: "matching create", method: http.MethodPost, path: "/api/v1/namespaces/demo/configmaps", body: demo},
+		{name: "matching update", method: http.MethodPut, path: "/api/v1/namespaces/demo/configmaps/web", body: demo},
+		{name: "create of another namespace", method: http.MethodPost, path: "/api/v1/namespaces/prod/configmaps", body: demo, rejected: "(prod)"},
+		{name: "update of another name", method: http.MethodPut, path: "/api/v1/namespaces/demo/configmaps/db", body: demo, rejected: "(db)"},
+		{name: "without namespace", method: http.MethodPost, path: "/api/v1/namespaces/prod/configmaps", body: `{"metadata":{"name":"web"}}`},
+		{name: "charset", method: http.MethodPost, path: "/api/v1/namespaces/prod/configmaps", contentType: "application/json; charset=utf-8", body: demo, rejected: "(prod)"},
+		{name: "oversized", method: http.MethodPost, path: "/api/v1/namespaces/demo/configmaps", body: large},
+		{name: "oversized of unknown length", method: http.MethodPost, path: "/api/v1/namespaces/demo/configmaps", body: large, chunked: true},
+		{name: "yaml", method: http.MethodPost, path: "/api/v1/namespaces/prod/configmaps", contentType: "application/yaml", body: "metadata:\n  namespace: demo\n"},
+		{name: "malformed", method: http.MethodPost, path: "/api/v1/namespaces/prod/configmaps", body: `{"metadata":`},
+		{name: "patch", method: http.MethodPatch, path: "/api/v1/namespaces/prod/configmaps/web", contentType: "application/merge-patch+json", body: demo},
+	}
+
+	for _, test := range tests {
+		forwarded = ""
+
+		r := newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: "alice"})
+		r.Body = ioutil.NopCloser(strings.NewReader(test.body))
+		r.ContentLength = int64(len(test.body))
+		if test.chunked {
+			r.ContentLength = -1
+		}
+		r.Header.Set("Content-Type", "application/json")
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+
+		recorder := httptest.NewRecorder()
+		code, err := auth.ServeHTTP(recorder, r)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if test.rejected == "" {
+			if code != http.StatusOK || forwarded != test.body {
+				t.Errorf("%s: expected the body forwarded, got %d %q", test.name, code, forwarded)
+			}
+			continue
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.name, recorder.Body.String(), err)
+		}
+
+		if recorder.Code != http.StatusBadRequest || forwarded != "" || !strings.Contains(status.Message, test.rejected) ||
+			status.Details == nil || string(status.Details.Causes[0].Type) != ReasonMetadataMismatch {
+			t.Errorf("%s: expected rejected naming %s, got %d %+v", test.name, test.rejected, recorder.Code, status)
+		}
+	}
+}
+
+func TestSetupStrictMetadata(t *testing.T) {
+	tests := []struct {
+		input string
+		fail  bool
+	}{
+		{input: "authentication {\n path /kapis\n strictMetadata 1048576\n}", fail: false},
+		{input: "authentication {\n path /kapis\n strictMetadata\n}", fail: true},
+		{input: "authentication {\n path /kapis\n strictMetadata 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n strictMetadata 1MB\n}", fail: true},
+	}
+
+	for _, test := range tests {
+		err := Setup(caddy.NewTestController("http", test.input))
+		if test.fail && err == nil {
+			t.Errorf("%q: expected setup fails", test.input)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+		}
+	}
+}
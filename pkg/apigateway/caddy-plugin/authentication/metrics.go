@@ -0,0 +1,121 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	decisionAllowed = "allowed"
+	decisionDenied  = "denied"
+	decisionError   = "error"
+	// the metrics listener is given this long to finish the scrapes on shutdown
+	metricsShutdownTimeout = 5 * time.Second
+)
+
+var (
+	authorizationDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "authentication_decisions_total",
+		Help: "Number of authorization decisions of the gateway, by result and API group, empty for the core group and the non-resource URLs.",
+	}, []string{"result", "group"})
+
+	rbacEvaluationLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "authentication_rbac_evaluation_duration_seconds",
+		Help:    "Latency of the evaluation of the roles bound to the user, cached decisions excluded.",
+		Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	})
+
+	rbacCacheSynced = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "authentication_rbac_cache_synced",
+		Help: "Whether the RBAC informer caches have synced, 1 once they have, 0 before.",
+	})
+
+	bypassedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "authentication_bypassed_requests_total",
+		Help: "Number of requests passed without authorization, by the excepted path they matched.",
+	}, []string{"exception"})
+)
+
+func init() {
+	for _, collector := range []prometheus.Collector{authorizationDecisions, rbacEvaluationLatency, rbacCacheSynced, bypassedRequests} {
+		if err := prometheus.DefaultRegisterer.Register(collector); err != nil {
+			log.Printf("[ERROR] authentication: register decision metrics: %v", err)
+		}
+	}
+}
+
+// countDecision counts a decision of the gateway, err is the error of the authorizer
+func countDecision(group string, permitted bool, err error) {
+	result := decisionDenied
+	switch {
+	case err != nil:
+		result = decisionError
+	case permitted:
+		result = decisionAllowed
+	}
+
+	authorizationDecisions.WithLabelValues(result, group).Inc()
+}
+
+// metricsServer serves the metrics of the default registry on their own listener, for gateways
+// without a metrics plugin
+type metricsServer struct {
+	address  string
+	server   *http.Server
+	listener net.Listener
+}
+
+func newMetricsServer(address string) *metricsServer {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return &metricsServer{address: address, server: &http.Server{Handler: mux}}
+}
+
+// start listens on the address, the metrics are served in the background until stop
+func (s *metricsServer) start() error {
+	listener, err := net.Listen("tcp", s.address)
+
+	if err != nil {
+		return err
+	}
+
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("[ERROR] authentication: serve metrics on %s: %v", s.address, err)
+		}
+	}()
+
+	return nil
+}
+
+// stop closes the listener once the scrapes in flight are answered
+func (s *metricsServer) stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,190 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// scrape returns the value of the counter or gauge name with labels in the default registry, the
+// count of observations of a histogram, 0 if it has no sample yet
+func scrape(t *testing.T, name string, labels prometheus.Labels) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if !hasLabels(metric, labels) {
+				continue
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				return metric.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				return metric.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				return float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	return 0
+}
+
+func hasLabels(metric *dto.Metric, labels prometheus.Labels) bool {
+	matched := 0
+	for _, pair := range metric.GetLabel() {
+		if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+func TestDecisionMetrics(t *testing.T) {
+	// alice reads the deployments, the role of the vault namespace can't be resolved
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "reader"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "broken"}, AggregationRule: &v1.AggregationRule{
+			ClusterRoleSelectors: []metav1.LabelSelector{{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "aggregate", Operator: "Unknown"}}}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "vault", Name: "broken"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "broken"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/", ExceptedPath: []string{"/healthz"}}, Next: next}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	allowed := prometheus.Labels{"result": decisionAllowed, "group": "apps"}
+	denied := prometheus.Labels{"result": decisionDenied, "group": ""}
+	failed := prometheus.Labels{"result": decisionError, "group": ""}
+	bypassed := prometheus.Labels{"exception": "/healthz"}
+
+	before := map[string]float64{
+		"allowed":   scrape(t, "authentication_decisions_total", allowed),
+		"denied":    scrape(t, "authentication_decisions_total", denied),
+		"failed":    scrape(t, "authentication_decisions_total", failed),
+		"bypassed":  scrape(t, "authentication_bypassed_requests_total", bypassed),
+		"evaluated": scrape(t, "authentication_rbac_evaluation_duration_seconds", nil),
+	}
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{method: http.MethodGet, path: "/apis/apps/v1/namespaces/demo/deployments/web"},
+		{method: http.MethodGet, path: "/apis/apps/v1/namespaces/demo/deployments"},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web"},
+		{method: http.MethodGet, path: "/api/v1/namespaces/vault/secrets/token"},
+		{method: http.MethodGet, path: "/healthz"},
+	}
+
+	for _, request := range requests {
+		auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, request.method, request.path, alice))
+	}
+
+	after := map[string]float64{
+		"allowed":   scrape(t, "authentication_decisions_total", allowed),
+		"denied":    scrape(t, "authentication_decisions_total", denied),
+		"failed":    scrape(t, "authentication_decisions_total", failed),
+		"bypassed":  scrape(t, "authentication_bypassed_requests_total", bypassed),
+		"evaluated": scrape(t, "authentication_rbac_evaluation_duration_seconds", nil),
+	}
+
+	expected := map[string]float64{"allowed": 2, "denied": 1, "failed": 1, "bypassed": 1, "evaluated": 4}
+
+	for name, delta := range expected {
+		if after[name]-before[name] != delta {
+			t.Errorf("expected %s moved by %v, got %v", name, delta, after[name]-before[name])
+		}
+	}
+}
+
+func TestCacheSyncMetric(t *testing.T) {
+	synced := false
+
+	caches := &cacheSync{}
+	caches.track(func() bool { return synced })
+
+	if caches.ready() || scrape(t, "authentication_rbac_cache_synced", nil) != 0 {
+		t.Fatal("expected the caches reported syncing")
+	}
+
+	synced = true
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	// returns once the caches have synced
+	caches.wait(stopCh)
+
+	if scrape(t, "authentication_rbac_cache_synced", nil) != 1 {
+		t.Error("expected the caches reported synced")
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+	server := newMetricsServer("127.0.0.1:0")
+
+	if err := server.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.stop()
+
+	countDecision("apps", true, nil)
+
+	response, err := http.Get("http://" + server.listener.Addr().String() + "/metrics")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(body), `authentication_decisions_total{group="apps",result="allowed"}`) {
+		t.Errorf("expected the decision metrics served, got %d %s", response.StatusCode, body)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/clientip"
+	sliceutils "kubesphere.io/kubesphere/pkg/utils"
+)
+
+const defaultRateLimitUsers = 10000
+
+// rateLimiter limits the requests of each user to a token bucket, the anonymous requests are limited
+// by client address. The buckets of the users are kept in a LRU cache, a bucket unused for the time it
+// takes to refill is dropped, it's full again anyway.
+type rateLimiter struct {
+	qps    rate.Limit
+	burst  int
+	exempt []string
+	clock  cache.Clock
+
+	// the buckets are looked up and added at once, so that a user never gets two of them
+	mutex   sync.Mutex
+	buckets *cache.LRUExpireCache
+}
+
+func newRateLimiter(qps float64, burst int, exempt []string, users int, clock cache.Clock) *rateLimiter {
+	return &rateLimiter{
+		qps:     rate.Limit(qps),
+		burst:   burst,
+		exempt:  exempt,
+		clock:   clock,
+		buckets: cache.NewLRUExpireCacheWithClock(users, clock),
+	}
+}
+
+// allow takes a token of the bucket of the sender of r, retryAfter tells when to retry if none is left
+func (l *rateLimiter) allow(r *http.Request) (ok bool, retryAfter time.Duration) {
+	key, limited := l.key(r)
+
+	if !limited {
+		return true, 0
+	}
+
+	now := l.clock.Now()
+	// the time a bucket takes to refill
+	idle := time.Duration(float64(l.burst) / float64(l.qps) * float64(time.Second))
+
+	l.mutex.Lock()
+	bucket, ok := l.buckets.Get(key)
+	if !ok {
+		bucket = rate.NewLimiter(l.qps, l.burst)
+	}
+	l.buckets.Add(key, bucket, idle)
+	l.mutex.Unlock()
+
+	reservation := bucket.(*rate.Limiter).ReserveN(now, 1)
+
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// key returns the bucket of the sender of r, the name of the user, or its address if it's anonymous.
+// The users of an exempt group aren't limited.
+func (l *rateLimiter) key(r *http.Request) (key string, limited bool) {
+	u, ok := request.UserFrom(r.Context())
+
+	if !ok || isAnonymous(u) {
+		return "address:" + clientip.FromRequest(r).String(), true
+	}
+
+	for _, group := range WithImplicitGroups(u).GetGroups() {
+		if sliceutils.HasString(l.exempt, group) {
+			return "", false
+		}
+	}
+
+	return "user:" + u.GetName(), true
+}
+
+// rateLimited answers 429 with Retry-After in whole seconds, at least one
+func rateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) int {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	return deny(w, r, ReasonRateLimited, k8serr.NewTooManyRequests("too many requests, retry later", seconds))
+}
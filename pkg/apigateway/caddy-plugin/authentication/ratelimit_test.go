@@ -0,0 +1,175 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// requestOf returns a request of u from address, without user if u is nil
+func requestOf(u user.Info, address string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	r.RemoteAddr = address
+	if u != nil {
+		r = r.WithContext(request.WithUser(r.Context(), u))
+	}
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newRateLimiter(1, 3, []string{"system:masters", "system:serviceaccounts"}, 10, clock)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	bob := &user.DefaultInfo{Name: "bob"}
+
+	// the burst, then one request a second
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow(requestOf(alice, "10.0.0.1:1234")); !ok {
+			t.Fatalf("expected request %d of the burst allowed", i)
+		}
+	}
+
+	ok, retryAfter := limiter.allow(requestOf(alice, "10.0.0.2:1234"))
+
+	if ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("expected alice limited for up to a second beyond the burst, got %v %s", ok, retryAfter)
+	}
+
+	// the refused requests don't take a token
+	clock.step(time.Second)
+
+	if ok, _ := limiter.allow(requestOf(alice, "10.0.0.1:1234")); !ok {
+		t.Errorf("expected a request of alice allowed a second later")
+	}
+	if ok, _ := limiter.allow(requestOf(alice, "10.0.0.1:1234")); ok {
+		t.Errorf("expected alice limited again")
+	}
+
+	// the users have their own buckets, whatever their address
+	if ok, _ := limiter.allow(requestOf(bob, "10.0.0.1:1234")); !ok {
+		t.Errorf("expected bob allowed")
+	}
+
+	// the anonymous requests are limited by address
+	for i := 0; i < 3; i++ {
+		limiter.allow(requestOf(nil, "10.0.0.3:1234"))
+	}
+	if ok, _ := limiter.allow(requestOf(&user.DefaultInfo{Name: user.Anonymous}, "10.0.0.3:4321")); ok {
+		t.Errorf("expected the anonymous requests of 10.0.0.3 limited")
+	}
+	if ok, _ := limiter.allow(requestOf(nil, "10.0.0.4:1234")); !ok {
+		t.Errorf("expected the anonymous requests of 10.0.0.4 allowed")
+	}
+
+	// the exempt groups, the implicit ones included, are never limited
+	admin := &user.DefaultInfo{Name: "admin", Groups: []string{"system:masters"}}
+	controller := &user.DefaultInfo{Name: "system:serviceaccount:kubesphere-system:ks-controller-manager"}
+
+	for i := 0; i < 10; i++ {
+		for _, u := range []user.Info{admin, controller} {
+			if ok, _ := limiter.allow(requestOf(u, "10.0.0.1:1234")); !ok {
+				t.Fatalf("expected %s exempt", u.GetName())
+			}
+		}
+	}
+}
+
+func TestRateLimitUsers(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newRateLimiter(1, 1, nil, 2, clock)
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		limiter.allow(requestOf(&user.DefaultInfo{Name: name}, "10.0.0.1:1234"))
+	}
+
+	if keys := limiter.buckets.Keys(); len(keys) != 2 {
+		t.Errorf("expected the buckets of 2 users kept, got %v", keys)
+	}
+
+	// the bucket of alice was evicted, she starts over
+	if ok, _ := limiter.allow(requestOf(&user.DefaultInfo{Name: "alice"}, "10.0.0.1:1234")); !ok {
+		t.Errorf("expected alice allowed with a new bucket")
+	}
+
+	// the buckets unused for the time they take to refill are dropped
+	clock.step(2 * time.Second)
+
+	for _, key := range []string{"user:alice", "user:carol"} {
+		if _, ok := limiter.buckets.Get(key); ok {
+			t.Errorf("expected the idle bucket %s dropped", key)
+		}
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	permitting := authorizerFunc(func(_ context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		return true, "", nil
+	})
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	clock := &fakeClock{now: time.Now()}
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: next, Authorizer: permitting, limiter: newRateLimiter(0.2, 2, nil, 10, clock)}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	for i := 0; i < 2; i++ {
+		if status, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodGet, "/api/v1/pods", alice)); status != http.StatusOK || err != nil {
+			t.Fatalf("expected request %d of the burst served, got %d %v", i, status, err)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+
+	if status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/api/v1/pods", alice)); status != 0 || err != nil {
+		t.Fatalf("expected the denial written, got %d %v", status, err)
+	}
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", recorder.Code)
+	}
+
+	// a token every 5 seconds
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("expected Retry-After 5, got %q", retryAfter)
+	}
+
+	var status metav1.Status
+
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Reason != metav1.StatusReasonTooManyRequests || status.Details == nil || status.Details.RetryAfterSeconds != 5 ||
+		len(status.Details.Causes) != 1 || status.Details.Causes[0].Type != ReasonRateLimited {
+		t.Errorf("expected a rate limited Status retrying after 5s, got %+v", status)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ReplayDiff is a recorded decision the replayed roles decide otherwise
+type ReplayDiff struct {
+	Sample  DecisionSample `json:"sample"`
+	Allowed bool           `json:"allowed"`
+}
+
+// ReplayReport is the outcome of the replay of recorded decisions
+type ReplayReport struct {
+	Samples int `json:"samples"`
+	// denied decisions the replayed roles allow
+	Granted int `json:"granted"`
+	// allowed decisions the replayed roles deny
+	Revoked int          `json:"revoked"`
+	Diffs   []ReplayDiff `json:"diffs"`
+}
+
+// Replay evaluates the decisions recorded in samplesFile against the roles and bindings of the
+// YAML or JSON files of rbacFixtureDir, like the gateway would, and reports the decisions which
+// differ. The fixtures of pseudonymized samples bind the pseudonyms of the users.
+func Replay(samplesFile, rbacFixtureDir string) (*ReplayReport, error) {
+	listers, err := loadFixtureListers(rbacFixtureDir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(samplesFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	report := &ReplayReport{Diffs: make([]ReplayDiff, 0)}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var sample DecisionSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", samplesFile, line, err)
+		}
+
+		allowed, err := Authorize(listers, sample.attributes())
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", samplesFile, line, err)
+		}
+
+		report.Samples++
+
+		if allowed == sample.Allowed {
+			continue
+		}
+
+		if allowed {
+			report.Granted++
+		} else {
+			report.Revoked++
+		}
+
+		report.Diffs = append(report.Diffs, ReplayDiff{Sample: sample, Allowed: allowed})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// loadFixtureListers returns the listers of the roles and bindings of the .yaml, .yml and .json
+// files of dir, a file may hold several documents.
+func loadFixtureListers(dir string) (Listers, error) {
+	files, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return Listers{}, err
+	}
+
+	newIndexer := func() cache.Indexer {
+		return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	}
+
+	roles, roleBindings, clusterRoles, clusterRoleBindings := newIndexer(), newIndexer(), newIndexer(), newIndexer()
+
+	for _, info := range files {
+		switch filepath.Ext(info.Name()) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, info.Name())
+
+		objects, err := decodeFixture(path)
+
+		if err != nil {
+			return Listers{}, err
+		}
+
+		for _, object := range objects {
+			switch object.(type) {
+			case *v1.Role:
+				err = roles.Update(object)
+			case *v1.RoleBinding:
+				err = roleBindings.Update(object)
+			case *v1.ClusterRole:
+				err = clusterRoles.Update(object)
+			case *v1.ClusterRoleBinding:
+				err = clusterRoleBindings.Update(object)
+			default:
+				err = fmt.Errorf("unsupported object %T", object)
+			}
+			if err != nil {
+				return Listers{}, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+
+	return Listers{
+		Roles:               rbaclisters.NewRoleLister(roles),
+		RoleBindings:        rbaclisters.NewRoleBindingLister(roleBindings),
+		ClusterRoles:        rbaclisters.NewClusterRoleLister(clusterRoles),
+		ClusterRoleBindings: rbaclisters.NewClusterRoleBindingLister(clusterRoleBindings),
+	}, nil
+}
+
+func decodeFixture(path string) ([]runtime.Object, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(file, 4096)
+	objects := make([]runtime.Object, 0)
+
+	for {
+		var document runtime.RawExtension
+
+		if err := decoder.Decode(&document); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		// empty documents between separators
+		if len(document.Raw) == 0 || string(document.Raw) == "null" {
+			continue
+		}
+
+		object, _, err := scheme.Codecs.UniversalDeserializer().Decode(document.Raw, nil, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		objects = append(objects, object)
+	}
+}
@@ -0,0 +1,426 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// subjectResolverResync is the interval of the full resyncs of the resolver, they repair whatever the
+// events missed
+const subjectResolverResync = 10 * time.Minute
+
+// bindingID is the kind, namespace and name of a binding, the namespace of cluster role bindings is empty
+type bindingID struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// resolvedBinding is a binding with the compiled rules of its role
+type resolvedBinding struct {
+	// the namespace of role bindings, empty for cluster role bindings
+	namespace string
+	workspace string
+	subjects  []v1.Subject
+	roleRef   v1.RoleRef
+	role      storedRole
+	rules     []compiledRule
+	// the rules couldn't be resolved, the binding grants nothing and the decisions it would be
+	// consulted for fail unless another binding permits the request
+	err error
+	// the resource version of the binding, and the highest one of the binding and its roles
+	bindingVersion rbacVersion
+	version        rbacVersion
+	// the role aggregates others, every change of a cluster role may change its rules
+	aggregated bool
+}
+
+// resolvedState are the resolved bindings indexed by the subject keys of the subject index, so that
+// the ones of a namespace are apart, and by the role they depend on
+type resolvedState struct {
+	bindings   map[bindingID]*resolvedBinding
+	subjects   map[string]map[bindingID]bool
+	roles      map[storedRole]map[bindingID]bool
+	aggregated map[bindingID]bool
+}
+
+func newResolvedState() resolvedState {
+	return resolvedState{
+		bindings:   make(map[bindingID]*resolvedBinding),
+		subjects:   make(map[string]map[bindingID]bool),
+		roles:      make(map[storedRole]map[bindingID]bool),
+		aggregated: make(map[bindingID]bool),
+	}
+}
+
+func (s resolvedState) put(id bindingID, binding *resolvedBinding) {
+	s.remove(id)
+
+	s.bindings[id] = binding
+
+	for _, key := range subjectKeys(binding.namespace, binding.subjects) {
+		if s.subjects[key] == nil {
+			s.subjects[key] = make(map[bindingID]bool)
+		}
+		s.subjects[key][id] = true
+	}
+
+	if s.roles[binding.role] == nil {
+		s.roles[binding.role] = make(map[bindingID]bool)
+	}
+	s.roles[binding.role][id] = true
+
+	if binding.aggregated {
+		s.aggregated[id] = true
+	}
+}
+
+func (s resolvedState) remove(id bindingID) {
+	binding, ok := s.bindings[id]
+	if !ok {
+		return
+	}
+
+	delete(s.bindings, id)
+
+	for _, key := range subjectKeys(binding.namespace, binding.subjects) {
+		delete(s.subjects[key], id)
+		if len(s.subjects[key]) == 0 {
+			delete(s.subjects, key)
+		}
+	}
+
+	delete(s.roles[binding.role], id)
+	if len(s.roles[binding.role]) == 0 {
+		delete(s.roles, binding.role)
+	}
+
+	delete(s.aggregated, id)
+}
+
+// permits reports whether a binding of namespace, or a cluster role binding of workspace if namespace
+// is empty, permits the request. The error of a binding which couldn't be resolved is returned if no
+// binding permits the request.
+func (s resolvedState) permits(attrs authorizer.Attributes, namespace, workspace string, version *rbacVersion, trace *decisionTrace) (bool, error) {
+	var failed error
+	seen := make(map[bindingID]bool)
+
+	for _, key := range userKeys(namespace, attrs.GetUser()) {
+		for id := range s.subjects[key] {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			binding := s.bindings[id]
+
+			if binding.workspace != workspace || !appliesTo(binding.subjects, attrs.GetUser(), binding.namespace) {
+				continue
+			}
+
+			version.merge(binding.version)
+
+			if binding.err != nil {
+				if failed == nil {
+					failed = binding.err
+				}
+				continue
+			}
+
+			trace.evaluate()
+
+			if rule := compiledRulesMatch(binding.rules, attrs); rule >= 0 {
+				trace.match(binding.namespace, id.name, binding.roleRef, rule)
+				return true, nil
+			}
+		}
+	}
+
+	return false, failed
+}
+
+// subjectResolver keeps the compiled rules of every binding, indexed by subject, up to date with the
+// events of the RBAC informers, so that the requests are decided without looking up the bindings. A
+// binding is resolved again on its own events and on the ones of its role, the bindings of roles
+// aggregating others on the events of every cluster role. The state is rebuilt from the listers by
+// full resyncs, the decisions are up to the listers until the first one.
+type subjectResolver struct {
+	listers Listers
+
+	mutex  sync.RWMutex
+	state  resolvedState
+	synced bool
+}
+
+func newSubjectResolver(listers Listers) *subjectResolver {
+	return &subjectResolver{listers: listers, state: newResolvedState()}
+}
+
+// watch resolves the bindings again on the events of the informers of the roles and bindings
+func (r *subjectResolver) watch(roles, roleBindings, clusterRoles, clusterRoleBindings cache.SharedIndexInformer) {
+	for _, informer := range []cache.SharedIndexInformer{roles, roleBindings, clusterRoles, clusterRoleBindings} {
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: r.changed,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				r.changed(newObj)
+			},
+			DeleteFunc: r.deleted,
+		})
+	}
+}
+
+// run resyncs the resolver once the informers synced, then every interval until stopCh is closed. The
+// state is released then, the event handlers of the informers keep the resolver.
+func (r *subjectResolver) run(interval time.Duration, stopCh <-chan struct{}, hasSynced ...cache.InformerSynced) {
+	if !cache.WaitForCacheSync(stopCh, hasSynced...) {
+		return
+	}
+	wait.Until(r.resync, interval, stopCh)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.state, r.synced = newResolvedState(), false
+}
+
+// ready reports whether the resolver synced once
+func (r *subjectResolver) ready() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.synced
+}
+
+// resync rebuilds the state from the listers, the state is kept if they can't be listed. The
+// bindings are listed under the lock, the events of the bindings listed meanwhile would be applied
+// to the state replaced and lost otherwise.
+func (r *subjectResolver) resync() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	roleBindings, err := r.listers.RoleBindings.List(labels.Everything())
+	if err != nil {
+		log.Printf("[ERROR] authentication: resync the subject resolver: %v", err)
+		return
+	}
+
+	clusterRoleBindings, err := r.listers.ClusterRoleBindings.List(labels.Everything())
+	if err != nil {
+		log.Printf("[ERROR] authentication: resync the subject resolver: %v", err)
+		return
+	}
+
+	state := newResolvedState()
+
+	for _, binding := range roleBindings {
+		state.put(roleBindingID(binding), r.resolveRoleBinding(binding))
+	}
+	for _, binding := range clusterRoleBindings {
+		state.put(clusterRoleBindingID(binding), r.resolveClusterRoleBinding(binding))
+	}
+
+	r.state = state
+	r.synced = true
+}
+
+func (r *subjectResolver) changed(obj interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch object := obj.(type) {
+	case *v1.RoleBinding:
+		r.state.put(roleBindingID(object), r.resolveRoleBinding(object))
+	case *v1.ClusterRoleBinding:
+		r.state.put(clusterRoleBindingID(object), r.resolveClusterRoleBinding(object))
+	case *v1.Role:
+		r.resolveAgain(roleKey(object), false)
+	case *v1.ClusterRole:
+		r.resolveAgain(clusterRoleKey(object), true)
+	}
+}
+
+func (r *subjectResolver) deleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	switch object := obj.(type) {
+	case *v1.RoleBinding:
+		r.mutex.Lock()
+		r.state.remove(roleBindingID(object))
+		r.mutex.Unlock()
+	case *v1.ClusterRoleBinding:
+		r.mutex.Lock()
+		r.state.remove(clusterRoleBindingID(object))
+		r.mutex.Unlock()
+	case *v1.Role, *v1.ClusterRole:
+		r.changed(object)
+	default:
+		// the deleted object is unknown, whatever it was the state is rebuilt
+		log.Printf("[WARNING] authentication: unknown object %T deleted, resync the subject resolver", obj)
+		r.resync()
+	}
+}
+
+// resolveAgain resolves the bindings of role again, and the ones of aggregating roles if aggregating
+func (r *subjectResolver) resolveAgain(role storedRole, aggregating bool) {
+	ids := make([]bindingID, 0, len(r.state.roles[role]))
+	for id := range r.state.roles[role] {
+		ids = append(ids, id)
+	}
+	if aggregating {
+		for id := range r.state.aggregated {
+			ids = append(ids, id)
+		}
+	}
+
+	for _, id := range ids {
+		binding, ok := r.state.bindings[id]
+		if !ok {
+			continue
+		}
+
+		resolved := &resolvedBinding{namespace: binding.namespace, workspace: binding.workspace, subjects: binding.subjects, roleRef: binding.roleRef, bindingVersion: binding.bindingVersion}
+		if id.kind == "RoleBinding" {
+			r.resolveRoles(resolved)
+		} else {
+			r.resolveClusterRoles(resolved)
+		}
+		r.state.put(id, resolved)
+	}
+}
+
+func (r *subjectResolver) resolveRoleBinding(binding *v1.RoleBinding) *resolvedBinding {
+	resolved := &resolvedBinding{namespace: binding.Namespace, subjects: binding.Subjects, roleRef: binding.RoleRef}
+	resolved.bindingVersion.observe(binding)
+	r.resolveRoles(resolved)
+	return resolved
+}
+
+func (r *subjectResolver) resolveClusterRoleBinding(binding *v1.ClusterRoleBinding) *resolvedBinding {
+	resolved := &resolvedBinding{workspace: workspaceOf(binding), subjects: binding.Subjects, roleRef: binding.RoleRef}
+	resolved.bindingVersion.observe(binding)
+	r.resolveClusterRoles(resolved)
+	return resolved
+}
+
+// resolveRoles resolves the rules of a role binding, like roleValidate
+func (r *subjectResolver) resolveRoles(binding *resolvedBinding) {
+	binding.role = storedRole{kind: binding.roleRef.Kind, name: binding.roleRef.Name}
+	if binding.roleRef.Kind == "Role" {
+		binding.role.namespace = binding.namespace
+	}
+
+	if binding.roleRef.Kind == "ClusterRole" {
+		binding.aggregated = r.aggregates(binding.roleRef)
+	}
+
+	binding.version = binding.bindingVersion
+	rules, err := boundCompiledRules(r.listers, binding.namespace, binding.roleRef, &binding.version)
+	binding.rules, binding.err = rules, grantingNothing(err)
+}
+
+// resolveClusterRoles resolves the rules of a cluster role binding, like clusterRoleValidate
+func (r *subjectResolver) resolveClusterRoles(binding *resolvedBinding) {
+	binding.role = storedRole{kind: binding.roleRef.Kind, name: binding.roleRef.Name}
+	binding.aggregated = r.aggregates(binding.roleRef)
+	binding.version = binding.bindingVersion
+
+	clusterRole, err := getClusterRole(r.listers.ClusterRoles, binding.roleRef)
+
+	if err == nil {
+		binding.rules, err = compiledClusterRoleRules(clusterRole, r.listers.ClusterRoles.List, &binding.version)
+	}
+
+	binding.err = grantingNothing(err)
+}
+
+// aggregates reports whether the cluster role roleRef refers to aggregates others
+func (r *subjectResolver) aggregates(roleRef v1.RoleRef) bool {
+	clusterRole, err := r.listers.ClusterRoles.Get(roleRef.Name)
+	return err == nil && clusterRole.AggregationRule != nil
+}
+
+// grantingNothing returns nil for the errors of the bindings granting nothing, see grantsNothing, the
+// bindings are resolved on the events, not on the requests, they aren't logged
+func grantingNothing(err error) error {
+	if errors.Is(err, ErrRoleNotFound) || errors.Is(err, ErrInvalidRoleRef) {
+		return nil
+	}
+	return err
+}
+
+// authorize decides the request like AuthorizeContext, the trace of ctx records the decision. A
+// binding which couldn't be resolved doesn't keep the bindings of the other tiers from permitting the
+// request, its error is returned if none does.
+func (r *subjectResolver) authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var version rbacVersion
+
+	trace := decisionTraceFrom(ctx)
+	trace.record()
+
+	permitted, failed := r.state.permits(attrs, "", "", &version, trace)
+
+	if permitted {
+		return true, version.String(), nil
+	}
+
+	if workspace := requestWorkspace(attrs); workspace != "" {
+		permitted, err := r.state.permits(attrs, "", workspace, &version, trace)
+
+		if permitted {
+			return true, version.String(), nil
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+
+	if attrs.IsResourceRequest() && attrs.GetNamespace() != "" {
+		permitted, err := r.state.permits(attrs, attrs.GetNamespace(), "", &version, trace)
+
+		if permitted {
+			return true, version.String(), nil
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+
+	return false, version.String(), failed
+}
+
+func roleBindingID(binding *v1.RoleBinding) bindingID {
+	return bindingID{kind: "RoleBinding", namespace: binding.Namespace, name: binding.Name}
+}
+
+func clusterRoleBindingID(binding *v1.ClusterRoleBinding) bindingID {
+	return bindingID{kind: "ClusterRoleBinding", name: binding.Name}
+}
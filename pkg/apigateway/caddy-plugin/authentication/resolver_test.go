@@ -0,0 +1,290 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+// checkResolved fails unless the resolver decides the requests like the bindings looked up
+func checkResolved(t *testing.T, step string, resolver *subjectResolver, requests []*authorizer.AttributesRecord) {
+	t.Helper()
+
+	for _, attrs := range requests {
+		expected, _, expectedErr := AuthorizeVersion(sharedListers(), attrs)
+		permitted, _, err := resolver.authorize(context.Background(), attrs)
+
+		if permitted != expected || (err != nil) != (expectedErr != nil) {
+			t.Errorf("%s: %s %s %s/%s %s: expected %v %v, the resolver %v %v", step, attrs.User.GetName(), attrs.Verb, attrs.Namespace, attrs.Resource, attrs.Path, expected, expectedErr, permitted, err)
+		}
+	}
+}
+
+func TestSubjectResolverFuzz(t *testing.T) {
+	fuzzer := newAuthorizationFuzzer(2)
+
+	for i := 0; i < 500; i++ {
+		var rbac fuzzRBAC
+		fuzzer.Fuzz(&rbac)
+
+		setupRBAC(t, rbac.objects()...)
+
+		resolver := newSubjectResolver(sharedListers())
+		resolver.resync()
+
+		requests := make([]*authorizer.AttributesRecord, 0, 20)
+		for j := 0; j < 20; j++ {
+			var r fuzzRequest
+			fuzzer.Fuzz(&r)
+			// the subjects of the fixtures, so that some bindings apply
+			if j%2 == 0 {
+				for _, binding := range rbac.Bindings {
+					for _, subject := range binding.Subjects {
+						if subject.Kind == v1.UserKind {
+							r.User, r.Namespace = subject.Name, binding.Namespace
+						}
+					}
+				}
+			}
+			requests = append(requests, r.attributes())
+		}
+
+		checkResolved(t, "fuzz", resolver, requests)
+	}
+}
+
+func TestSubjectResolverEvents(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor", ResourceVersion: "1"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"update"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor", ResourceVersion: "2"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "editor"},
+			Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", ResourceVersion: "3"}, AggregationRule: &v1.AggregationRule{
+			ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"aggregate-to-monitoring": "true"}}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring", ResourceVersion: "4"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "monitoring"},
+			Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "sre"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "workspace-viewer", ResourceVersion: "5"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"get"}, APIGroups: []string{"*"}, Resources: []string{"workspaces"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "system:workspace:demo:viewer", ResourceVersion: "6", Labels: map[string]string{constants.WorkspaceLabelKey: "demo"}},
+			RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "workspace-viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	roles := factory.Rbac().V1().Roles().Informer().GetIndexer()
+	roleBindings := factory.Rbac().V1().RoleBindings().Informer().GetIndexer()
+	clusterRoles := factory.Rbac().V1().ClusterRoles().Informer().GetIndexer()
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	bob := &user.DefaultInfo{Name: "bob", Groups: []string{"sre"}}
+
+	var requests []*authorizer.AttributesRecord
+	for _, u := range []user.Info{alice, bob} {
+		requests = append(requests,
+			&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "update", APIGroup: "apps", Resource: "deployments", Namespace: "demo", Name: "web"},
+			&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "demo", Name: "web"},
+			&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "list", Resource: "pods"},
+			&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "get", APIGroup: "tenant.kubesphere.io", Resource: "workspaces", Name: "demo", Path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/demo"},
+			&authorizer.AttributesRecord{User: u, ResourceRequest: true, Verb: "get", APIGroup: "tenant.kubesphere.io", Resource: "workspaces", Name: "other", Path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/other"},
+		)
+	}
+
+	resolver := newSubjectResolver(sharedListers())
+
+	// the state is empty until the resync, the bindings are looked up meanwhile
+	if permitted, _, _ := resolver.authorize(context.Background(), requests[0]); permitted || !authorizeResolved(resolver, requests[0]) {
+		t.Fatal("expected the resolver unused before it synced")
+	}
+
+	resolver.resync()
+	checkResolved(t, "synced", resolver, requests)
+
+	if permitted, version, err := resolver.authorize(context.Background(), requests[0]); !permitted || version != "2" || err != nil {
+		t.Errorf("expected alice permitted on version 2, got %v %q %v", permitted, version, err)
+	}
+
+	steps := []struct {
+		name  string
+		apply func() interface{}
+	}{
+		{name: "binding subjects changed", apply: func() interface{} {
+			binding, _, _ := roleBindings.GetByKey("demo/editor")
+			updated := binding.(*v1.RoleBinding).DeepCopy()
+			updated.Subjects = []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}
+			roleBindings.Update(updated)
+			return updated
+		}},
+		{name: "role rules changed", apply: func() interface{} {
+			role, _, _ := roles.GetByKey("demo/editor")
+			updated := role.(*v1.Role).DeepCopy()
+			updated.Rules[0].Verbs = []string{"delete"}
+			roles.Update(updated)
+			return updated
+		}},
+		{name: "cluster role aggregated", apply: func() interface{} {
+			added := &v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader", Labels: map[string]string{"aggregate-to-monitoring": "true"}}, Rules: []v1.PolicyRule{
+				{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+			}}
+			clusterRoles.Add(added)
+			return added
+		}},
+		{name: "workspace role changed", apply: func() interface{} {
+			role, _, _ := clusterRoles.GetByKey("workspace-viewer")
+			updated := role.(*v1.ClusterRole).DeepCopy()
+			updated.Rules[0].ResourceNames = []string{"other"}
+			clusterRoles.Update(updated)
+			return updated
+		}},
+	}
+
+	for _, step := range steps {
+		resolver.changed(step.apply())
+		checkResolved(t, step.name, resolver, requests)
+	}
+
+	// bob lost the role, then the binding
+	role, _, _ := roles.GetByKey("demo/editor")
+	roles.Delete(role)
+	resolver.deleted(cache.DeletedFinalStateUnknown{Key: "demo/editor", Obj: role})
+	checkResolved(t, "role deleted", resolver, requests)
+
+	binding, _, _ := roleBindings.GetByKey("demo/editor")
+	roleBindings.Delete(binding)
+	resolver.deleted(binding)
+	checkResolved(t, "binding deleted", resolver, requests)
+
+	if len(resolver.state.roles[storedRole{kind: "Role", namespace: "demo", name: "editor"}]) != 0 || len(resolver.state.subjects[subjectKey("demo", v1.UserKind, "bob")]) != 0 {
+		t.Errorf("expected the deleted binding dropped from the indexes, got %+v", resolver.state)
+	}
+
+	// the incremental state is the one of a full resync
+	incremental := len(resolver.state.bindings)
+	resolver.resync()
+	if len(resolver.state.bindings) != incremental {
+		t.Errorf("expected %d bindings after the resync, got %d", incremental, len(resolver.state.bindings))
+	}
+	checkResolved(t, "resynced", resolver, requests)
+
+	// the binding is gone from the listers only, the synced resolver still permits the request
+	clusterRoleBindings := factory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer()
+	monitoring, _, _ := clusterRoleBindings.GetByKey("monitoring")
+	clusterRoleBindings.Delete(monitoring)
+
+	if !authorizeResolved(resolver, requests[7]) {
+		t.Errorf("expected the RBAC authorizer to decide on the synced resolver")
+	}
+}
+
+func TestSubjectResolverBrokenBinding(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "broken"}, AggregationRule: &v1.AggregationRule{
+			ClusterRoleSelectors: []metav1.LabelSelector{{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "aggregate", Operator: "Unknown"}}}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "broken"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "broken"},
+			Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"},
+			Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	resolver := newSubjectResolver(NewEvaluator(factory).Listers())
+	resolver.resync()
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	// the role binding permits the request whatever the broken cluster role binding
+	get := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo", Name: "web"}
+	if permitted, _, err := resolver.authorize(context.Background(), get); !permitted || err != nil {
+		t.Errorf("expected the get permitted by the role binding, got %v %v", permitted, err)
+	}
+
+	// nothing permits the request, the error of the broken binding is returned
+	del := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "delete", Resource: "pods", Namespace: "demo", Name: "web"}
+	if permitted, _, err := resolver.authorize(context.Background(), del); permitted || !errors.Is(err, ErrEvaluationFailed) {
+		t.Errorf("expected the delete failed on the broken binding, got %v %v", permitted, err)
+	}
+}
+
+// listingRoleBindings calls listed with the role bindings of every List
+type listingRoleBindings struct {
+	rbaclisters.RoleBindingLister
+	listed func([]*v1.RoleBinding)
+}
+
+func (l listingRoleBindings) List(selector labels.Selector) ([]*v1.RoleBinding, error) {
+	bindings, err := l.RoleBindingLister.List(selector)
+	l.listed(bindings)
+	return bindings, err
+}
+
+func TestSubjectResolverResyncEvents(t *testing.T) {
+	factory := setupRBAC(t,
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "view"},
+			Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	roleBindings := factory.Rbac().V1().RoleBindings().Informer().GetIndexer()
+
+	var resolver *subjectResolver
+	deleted := make(chan struct{})
+
+	// the binding is deleted once it's listed, its event is handled while the resync runs
+	listers := NewEvaluator(factory).Listers()
+	listers.RoleBindings = listingRoleBindings{RoleBindingLister: listers.RoleBindings, listed: func(bindings []*v1.RoleBinding) {
+		roleBindings.Delete(bindings[0])
+		go func() {
+			resolver.deleted(bindings[0])
+			close(deleted)
+		}()
+
+		select {
+		case <-deleted:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}}
+
+	resolver = newSubjectResolver(listers)
+	resolver.resync()
+	<-deleted
+
+	if len(resolver.state.bindings) != 0 {
+		t.Errorf("expected the binding deleted during the resync dropped, got %+v", resolver.state.bindings)
+	}
+}
+
+// authorizeResolved returns the decision of the RBAC authorizer deciding on the resolver
+func authorizeResolved(resolver *subjectResolver, attrs authorizer.Attributes) bool {
+	permitted, _, _ := newAuthorizer(Rule{}, sharedListers(), resolver).Authorize(context.Background(), attrs)
+	return permitted
+}
@@ -0,0 +1,99 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile appends lines to a file, renamed to path.1 when it exceeds maxSize, shifting the
+// previous ones up to path.<backups>. The file is opened on the first write.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func newRotatingFile(path string, maxSize int64, backups int) *rotatingFile {
+	return &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+}
+
+func (f *rotatingFile) write(line []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file != nil && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		f.file, f.size = file, info.Size()
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+
+	return err
+}
+
+// rotate renames the file to path.1, shifting the previous ones, the next write opens a new file
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	for i := f.backups - 1; i > 0; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(f.path, f.path+".1")
+}
+
+// close closes the current file
+func (f *rotatingFile) close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
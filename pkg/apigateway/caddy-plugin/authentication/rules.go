@@ -0,0 +1,139 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"sort"
+	"strings"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// rulesFor returns the rules of listers granted to the user cluster wide, and in namespace if it isn't empty.
+// The rules of workspace roles aren't granted cluster wide.
+// A role bound several times is read once, and identical rules of different roles are returned once.
+func rulesFor(listers Listers, u user.Info, namespace string) ([]v1.PolicyRule, error) {
+	rules := newRuleSet()
+
+	clusterRoleBindings, err := userClusterRoleBindings(listers, u)
+
+	if err != nil {
+		return nil, evaluationFailed(err)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, clusterRoleBinding := range clusterRoleBindings {
+		if workspaceOf(clusterRoleBinding) != "" || seen[roleRefKey(clusterRoleBinding.RoleRef)] || !appliesTo(clusterRoleBinding.Subjects, u, "") {
+			continue
+		}
+
+		seen[roleRefKey(clusterRoleBinding.RoleRef)] = true
+
+		clusterRole, err := getClusterRole(listers.ClusterRoles, clusterRoleBinding.RoleRef)
+
+		if grantsNothing(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		aggregated, err := clusterRoleRules(clusterRole, listers.ClusterRoles.List, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules.add(aggregated...)
+	}
+
+	if namespace == "" {
+		return rules.list(), nil
+	}
+
+	roleBindings, err := userRoleBindings(listers, namespace, u)
+
+	if err != nil {
+		return nil, evaluationFailed(err)
+	}
+
+	seen = make(map[string]bool)
+
+	for _, roleBinding := range roleBindings {
+		if seen[roleRefKey(roleBinding.RoleRef)] || !appliesTo(roleBinding.Subjects, u, namespace) {
+			continue
+		}
+
+		seen[roleRefKey(roleBinding.RoleRef)] = true
+
+		roleRules, err := boundRules(listers, namespace, roleBinding.RoleRef, nil)
+
+		if grantsNothing(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules.add(roleRules...)
+	}
+
+	return rules.list(), nil
+}
+
+// ruleSet keeps rules in order of addition, rules equal in canonical form are kept once
+type ruleSet struct {
+	keys  map[string]bool
+	rules []v1.PolicyRule
+}
+
+func newRuleSet() *ruleSet {
+	return &ruleSet{keys: make(map[string]bool), rules: make([]v1.PolicyRule, 0)}
+}
+
+func (s *ruleSet) add(rules ...v1.PolicyRule) {
+	for _, rule := range rules {
+		key := canonicalRule(rule)
+		if !s.keys[key] {
+			s.keys[key] = true
+			s.rules = append(s.rules, rule)
+		}
+	}
+}
+
+func (s *ruleSet) list() []v1.PolicyRule {
+	return s.rules
+}
+
+// canonicalRule returns a key of rule which doesn't depend on the order of its values
+func canonicalRule(rule v1.PolicyRule) string {
+	fields := [][]string{rule.Verbs, rule.APIGroups, rule.Resources, rule.ResourceNames, rule.NonResourceURLs}
+	parts := make([]string, len(fields))
+
+	for i, values := range fields {
+		sorted := append([]string{}, values...)
+		sort.Strings(sorted)
+		parts[i] = strings.Join(sorted, "\x00")
+	}
+
+	return strings.Join(parts, "\x01")
+}
@@ -0,0 +1,1057 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+)
+
+// setupRBAC replaces the shared informer factory with one caching exactly the given objects
+func setupRBAC(t testing.TB, objects ...runtime.Object) k8sinformers.SharedInformerFactory {
+	factory := k8sinformers.NewSharedInformerFactory(nil, 0)
+
+	if err := registerIndexes(factory); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range objects {
+		var err error
+		switch obj := object.(type) {
+		case *v1.Role:
+			err = factory.Rbac().V1().Roles().Informer().GetIndexer().Add(obj)
+		case *v1.RoleBinding:
+			err = factory.Rbac().V1().RoleBindings().Informer().GetIndexer().Add(obj)
+		case *v1.ClusterRole:
+			err = factory.Rbac().V1().ClusterRoles().Informer().GetIndexer().Add(obj)
+		case *v1.ClusterRoleBinding:
+			err = factory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer().Add(obj)
+		default:
+			err = fmt.Errorf("unsupported object %T", object)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	informers.SetSharedInformerFactory(factory)
+
+	return factory
+}
+
+// duplicatedBindings returns RBAC objects where the roles are bound to the dev group many times,
+// as it happens when each member of a team is granted the same roles.
+func duplicatedBindings(duplicates int) []runtime.Object {
+	objects := []runtime.Object{
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods", "services"}},
+		}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "auditor"}, Rules: []v1.PolicyRule{
+			// the rule of viewer in another order
+			{Verbs: []string{"list", "get"}, APIGroups: []string{""}, Resources: []string{"services", "pods"}},
+			{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}},
+		}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+		}},
+	}
+
+	for i := 0; i < duplicates; i++ {
+		group := []v1.Subject{{Kind: v1.GroupKind, Name: "dev"}}
+		objects = append(objects,
+			&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("viewer-%d", i)}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: group},
+			&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("auditor-%d", i)}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "auditor"}, Subjects: group},
+			&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("editor-%d", i)}, RoleRef: v1.RoleRef{Kind: "Role", Name: "editor"}, Subjects: group},
+		)
+	}
+
+	return objects
+}
+
+var (
+	developer = &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}}
+	stranger  = &user.DefaultInfo{Name: "mallory"}
+)
+
+var decisions = []struct {
+	attrs     authorizer.AttributesRecord
+	permitted bool
+}{
+	{attrs: authorizer.AttributesRecord{User: developer, ResourceRequest: true, Verb: "list", Resource: "pods"}, permitted: true},
+	{attrs: authorizer.AttributesRecord{User: developer, Path: "/healthz", Verb: "get"}, permitted: true},
+	{attrs: authorizer.AttributesRecord{User: developer, ResourceRequest: true, Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "demo"}, permitted: true},
+	// walks every binding of the user without a match
+	{attrs: authorizer.AttributesRecord{User: developer, ResourceRequest: true, Verb: "delete", Resource: "pods", Namespace: "demo"}, permitted: false},
+	{attrs: authorizer.AttributesRecord{User: developer, ResourceRequest: true, Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "other"}, permitted: false},
+	{attrs: authorizer.AttributesRecord{User: stranger, ResourceRequest: true, Verb: "list", Resource: "pods"}, permitted: false},
+}
+
+func TestRuleMatchesSubresources(t *testing.T) {
+	tests := []struct {
+		rule        string
+		resource    string
+		subresource string
+		matches     bool
+	}{
+		{rule: "*/status", resource: "pods", subresource: "status", matches: true},
+		{rule: "*/status", resource: "deployments", subresource: "status", matches: true},
+		{rule: "*/status", resource: "pods", subresource: "scale", matches: false},
+		{rule: "*/status", resource: "pods", matches: false},
+		{rule: "*/scale", resource: "deployments", subresource: "scale", matches: true},
+		{rule: "*/log", resource: "pods", subresource: "log", matches: true},
+		{rule: "*/log", resource: "pods", subresource: "logs", matches: false},
+		// the characters of the wildcard are part of the subresource
+		{rule: "*//log", resource: "pods", subresource: "log", matches: false},
+		{rule: "*/*scale", resource: "deployments", subresource: "scale", matches: false},
+		{rule: "*/*scale", resource: "deployments", subresource: "*scale", matches: true},
+		{rule: "pods/*", resource: "pods", subresource: "log", matches: true},
+		{rule: "pods/*", resource: "pod", subresource: "log", matches: false},
+		// the subresources of deployments, not the deployments themselves
+		{rule: "deployments/*", resource: "deployments", matches: false},
+		{rule: "deployments/*", resource: "deployments", subresource: "scale", matches: true},
+		{rule: "foo*/*", resource: "foo*", subresource: "status", matches: true},
+		{rule: "foo*/*", resource: "foo", subresource: "status", matches: false},
+		{rule: "pods//*", resource: "pods", subresource: "log", matches: false},
+		{rule: "pods*/*", resource: "pods", subresource: "log", matches: false},
+	}
+
+	for _, test := range tests {
+		rule := v1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{test.rule}}
+
+		if matches := ruleMatchesRequest(rule, "", "", "", test.resource, test.subresource, "", "get"); matches != test.matches {
+			t.Errorf("%s against %s/%s: expected %v, got %v", test.rule, test.resource, test.subresource, test.matches, matches)
+		}
+	}
+}
+
+func TestResourceNameWildcards(t *testing.T) {
+	tests := []struct {
+		names   []string
+		name    string
+		matches bool
+	}{
+		{names: nil, name: "web", matches: true},
+		{names: nil, name: "", matches: true},
+		{names: []string{"foo"}, name: "foo", matches: true},
+		{names: []string{"foo"}, name: "bar", matches: false},
+		{names: []string{"foo"}, name: "", matches: false},
+		{names: []string{"*", "foo"}, name: "bar", matches: true},
+		{names: []string{"foo", "*"}, name: "foo", matches: true},
+		// the wildcard grants lists like an empty list of names
+		{names: []string{"*", "foo"}, name: "", matches: true},
+		{names: []string{"prod-*"}, name: "prod-db", matches: true},
+		{names: []string{"prod-*"}, name: "prod-", matches: true},
+		{names: []string{"prod-*"}, name: "staging-db", matches: false},
+		{names: []string{"prod-*"}, name: "", matches: false},
+		{names: []string{"foo", "prod-*"}, name: "foo", matches: true},
+	}
+
+	for _, test := range tests {
+		rule := v1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: test.names}
+
+		verb := "get"
+		if test.name == "" {
+			verb = "list"
+		}
+
+		if matches := ruleMatchesRequest(rule, "", "", "", "secrets", "", test.name, verb); matches != test.matches {
+			t.Errorf("%v against %s %q: expected %v, got %v", test.names, verb, test.name, test.matches, matches)
+		}
+	}
+}
+
+func TestVersionedAPIGroups(t *testing.T) {
+	tests := []struct {
+		groups  []string
+		group   string
+		version string
+		matches bool
+	}{
+		// group only entries match every version
+		{groups: []string{"apps"}, group: "apps", version: "v1beta1", matches: true},
+		{groups: []string{"apps"}, group: "apps", version: "", matches: true},
+		{groups: []string{"apps/v1"}, group: "apps", version: "v1", matches: true},
+		{groups: []string{"apps/v1"}, group: "apps", version: "v1beta1", matches: false},
+		{groups: []string{"apps/v1"}, group: "apps", version: "", matches: false},
+		{groups: []string{"apps/v1"}, group: "extensions", version: "v1", matches: false},
+		{groups: []string{"apps/v1", "extensions"}, group: "extensions", version: "v1beta1", matches: true},
+		{groups: []string{"/v1"}, group: "", version: "v1", matches: true},
+		{groups: []string{"/v1"}, group: "apps", version: "v1", matches: false},
+		{groups: []string{"*/v1"}, group: "apps", version: "v1", matches: true},
+		{groups: []string{"*/v1"}, group: "apps", version: "v1beta1", matches: false},
+		{groups: []string{"devops.kubesphere.io/v1alpha1"}, group: "devops.kubesphere.io", version: "v1alpha1", matches: true},
+	}
+
+	for _, test := range tests {
+		rule := v1.PolicyRule{Verbs: []string{"get"}, APIGroups: test.groups, Resources: []string{"deployments"}}
+
+		if matches := ruleMatchesRequest(rule, test.group, test.version, "", "deployments", "", "", "get"); matches != test.matches {
+			t.Errorf("%v against %s/%s: expected %v, got %v", test.groups, test.group, test.version, test.matches, matches)
+		}
+	}
+
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "deployer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"apps/v1", "/v1"}, Resources: []string{"deployments", "pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "deployer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "deployer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: next}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	requests := []struct {
+		path    string
+		message string
+	}{
+		{path: "/apis/apps/v1/namespaces/demo/deployments/web"},
+		{path: "/api/v1/namespaces/demo/pods/web"},
+		{path: "/apis/apps/v1beta1/namespaces/demo/deployments/web", message: `user "alice" cannot get resource "deployments" in API group version "apps/v1beta1" in the namespace "demo"`},
+		{path: "/api/v1/namespaces/demo/services/web", message: `user "alice" cannot get resource "services" in API group version "v1" in the namespace "demo"`},
+		{path: "/healthz", message: `user "alice" cannot get path "/healthz"`},
+	}
+
+	for _, test := range requests {
+		recorder := httptest.NewRecorder()
+		code, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, test.path, alice))
+
+		if test.message == "" {
+			if code != http.StatusOK || err != nil {
+				t.Errorf("%s: expected permitted, got %d %v", test.path, code, err)
+			}
+			continue
+		}
+
+		var status metav1.Status
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: decode status %q: %v", test.path, recorder.Body.String(), err)
+		}
+
+		if recorder.Code != http.StatusForbidden || !strings.HasSuffix(status.Message, ": "+test.message) {
+			t.Errorf("%s: expected denied with %q, got %d %q", test.path, test.message, recorder.Code, status.Message)
+		}
+	}
+}
+
+func TestCoreGroupNames(t *testing.T) {
+	tests := []struct {
+		groups  []string
+		group   string
+		version string
+		matches bool
+	}{
+		{groups: []string{""}, group: "", version: "v1", matches: true},
+		{groups: []string{"core"}, group: "", version: "v1", matches: true},
+		{groups: []string{" core "}, group: "", version: "v1", matches: true},
+		{groups: []string{" "}, group: "", version: "v1", matches: true},
+		{groups: []string{"core/v1"}, group: "", version: "v1", matches: true},
+		{groups: []string{"core/v1"}, group: "", version: "v2", matches: false},
+		{groups: []string{"core"}, group: "apps", version: "v1", matches: false},
+		{groups: []string{"core"}, group: "core.kubesphere.io", version: "v1alpha1", matches: false},
+		// the other groups are unaffected, spaces aside
+		{groups: []string{" apps "}, group: "apps", version: "v1", matches: true},
+		{groups: []string{"apps"}, group: "", version: "v1", matches: false},
+		{groups: []string{"apps / v1"}, group: "apps", version: "v1", matches: true},
+	}
+
+	for _, test := range tests {
+		rule := v1.PolicyRule{Verbs: []string{"get"}, APIGroups: test.groups, Resources: []string{"pods"}}
+
+		if matches := ruleMatchesRequest(rule, test.group, test.version, "", "pods", "", "", "get"); matches != test.matches {
+			t.Errorf("%q against %s/%s: expected %v, got %v", test.groups, test.group, test.version, test.matches, matches)
+		}
+	}
+
+	setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "templated"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"core"}, Resources: []string{"pods", "services", "configmaps"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "templated"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "templated"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	for _, path := range []string{"/api/v1/namespaces/demo/pods/web", "/api/v1/namespaces/demo/services/web", "/api/v1/namespaces/demo/configmaps/web"} {
+		attrs, err := getAuthorizerAttributes(newAuthorizedRequest(t, http.MethodGet, path, &user.DefaultInfo{Name: "alice"}).Context())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs); err != nil || !permitted {
+			t.Errorf("%s: expected permitted, got %v %v", path, permitted, err)
+		}
+	}
+}
+
+// TestResourceNamesOfCollections compares the decisions on a role restricted to resource names with
+// kube-apiserver: lists and watches are granted for the names of their field selector only, creates
+// and collection deletes carry no name and aren't granted.
+func TestResourceNamesOfCollections(t *testing.T) {
+	setupRBAC(t,
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "my-config"}, Rules: []v1.PolicyRule{{
+			Verbs: []string{"get", "list", "watch", "create", "delete", "deletecollection"}, APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"my-config"},
+		}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "my-config"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "my-config"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	tests := []struct {
+		method    string
+		path      string
+		permitted bool
+	}{
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps/my-config", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps/other", permitted: false},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps", permitted: false},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps?fieldSelector=metadata.name%3Dmy-config", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps?fieldSelector=metadata.name%3Dother", permitted: false},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps?watch=true", permitted: false},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps?watch=true&fieldSelector=metadata.name%3Dmy-config", permitted: true},
+		{method: http.MethodPost, path: "/api/v1/namespaces/demo/configmaps", permitted: false},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/configmaps/my-config", permitted: true},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/configmaps", permitted: false},
+	}
+
+	for _, test := range tests {
+		r := newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: "alice"})
+
+		attrs, err := getAuthorizerAttributes(r.Context())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs)
+
+		if err != nil || permitted != test.permitted {
+			t.Errorf("%s %s (%s %q): expected permitted %v, got %v %v", test.method, test.path, attrs.GetVerb(), attrs.GetName(), test.permitted, permitted, err)
+		}
+	}
+}
+
+func TestPathMatches(t *testing.T) {
+	tests := []struct {
+		spec    string
+		path    string
+		matches bool
+	}{
+		{spec: "*", path: "/healthz", matches: true},
+		{spec: "/healthz", path: "/healthz", matches: true},
+		{spec: "/healthz", path: "/healthz/ping", matches: false},
+		{spec: "/healthz*", path: "/healthz/ping", matches: true},
+		{spec: "/apis/*", path: "/apis/apps", matches: true},
+		{spec: "/apis/*", path: "/apis", matches: false},
+		{spec: "/apis/*", path: "/api", matches: false},
+		{spec: "/apis/*", path: "/apis/apps/v1", matches: true},
+		{spec: "/kapis/*/v1alpha2/metrics", path: "/kapis/monitoring.kubesphere.io/v1alpha2/metrics", matches: true},
+		{spec: "/kapis/*/v1alpha2/metrics", path: "/kapis/monitoring.kubesphere.io/v1alpha3/metrics", matches: false},
+		{spec: "/kapis/*/v1alpha2/metrics", path: "/kapis/v1alpha2/metrics", matches: false},
+		{spec: "/kapis/*/v1alpha2/metrics", path: "/kapis//v1alpha2/metrics", matches: false},
+		{spec: "/kapis/*/v1alpha2/metrics", path: "/kapis/monitoring.kubesphere.io/v1alpha2/metrics/nodes", matches: false},
+		{spec: "/apis/*/*/namespaces", path: "/apis/apps/v1/namespaces", matches: true},
+		{spec: "/apis/*/*/namespaces", path: "/apis/apps/namespaces", matches: false},
+		{spec: "/apis/*/*/*", path: "/apis/apps/v1/deployments/web", matches: true},
+		{spec: "/apis/*/v1/*", path: "/apis/apps/v1", matches: false},
+		// a trailing slash is a segment of its own
+		{spec: "/apis/*/namespaces", path: "/apis/apps/namespaces/", matches: false},
+		{spec: "/apis/*/namespaces/", path: "/apis/apps/namespaces/", matches: true},
+		// specs longer than the path
+		{spec: "/apis/*/namespaces/demo", path: "/apis/apps/namespaces", matches: false},
+		{spec: "/apis/*/namespaces/*", path: "/apis/apps", matches: false},
+		// a wildcard within a segment other than the last one is literal
+		{spec: "/apis/app*/v1", path: "/apis/apps/v1", matches: false},
+	}
+
+	for _, test := range tests {
+		if matches := pathMatches(test.path, test.spec); matches != test.matches {
+			t.Errorf("%s against %s: expected %v, got %v", test.spec, test.path, test.matches, matches)
+		}
+	}
+}
+
+func TestPermissionValidateDuplicatedBindings(t *testing.T) {
+	setupRBAC(t, duplicatedBindings(10)...)
+
+	for _, test := range decisions {
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), &test.attrs)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if permitted != test.permitted {
+			t.Errorf("%s %s %s: expected permitted %v, got %v", test.attrs.User.GetName(), test.attrs.Verb, test.attrs.Resource+test.attrs.Path, test.permitted, permitted)
+		}
+	}
+}
+
+func TestNonResourceRequestsSkipRoles(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/metrics"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "prometheus"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "monitoring"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "prometheus"}}},
+		// grants every resource of demo
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "admin"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	tests := []struct {
+		attrs     authorizer.AttributesRecord
+		permitted bool
+		err       error
+	}{
+		// a namespace smuggled into a non resource request doesn't bring in the roles of the namespace
+		{attrs: authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, Verb: "get", Path: "/metrics", Namespace: "demo"}, permitted: false},
+		{attrs: authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "prometheus"}, Verb: "get", Path: "/metrics", Namespace: "demo"}, permitted: true},
+		{attrs: authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"}, permitted: true},
+	}
+
+	for _, test := range tests {
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), &test.attrs)
+
+		if permitted != test.permitted || !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("%s %s%s: expected %v %v, got %v %v", test.attrs.User.GetName(), test.attrs.Path, test.attrs.Resource, test.permitted, test.err, permitted, err)
+		}
+	}
+}
+
+func TestWorkspaceRoles(t *testing.T) {
+	workspaceViewer := &v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "workspace-viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{"tenant.kubesphere.io"}, Resources: []string{"workspaces", "workspaces/namespaces"}}}}
+	setupRBAC(t,
+		workspaceViewer,
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "system:ws-a:workspace-viewer", Labels: map[string]string{constants.WorkspaceLabelKey: "ws-a"}}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "workspace-viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "tenant-viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "workspace-viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+	)
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})}
+
+	tests := []struct {
+		user      string
+		path      string
+		permitted bool
+	}{
+		{user: "alice", path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/ws-a/namespaces", permitted: true},
+		{user: "alice", path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/ws-a", permitted: true},
+		// the workspace role isn't granted in the other workspaces nor cluster wide
+		{user: "alice", path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/ws-b/namespaces", permitted: false},
+		{user: "alice", path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces", permitted: false},
+		{user: "admin", path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/ws-b/namespaces", permitted: true},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, test.path, &user.DefaultInfo{Name: test.user}))
+
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.user, test.path, err)
+		}
+
+		if (status == http.StatusOK) != test.permitted {
+			t.Errorf("%s %s: expected permitted %v, got %d %d", test.user, test.path, test.permitted, status, recorder.Code)
+		}
+	}
+
+	// nor are its rules held cluster wide
+	rules, err := rulesFor(sharedListers(), &user.DefaultInfo{Name: "alice"}, "")
+
+	if err != nil || len(rules) != 0 {
+		t.Errorf("expected no rules of alice cluster wide, got %v %v", rules, err)
+	}
+}
+
+func TestDanglingBindings(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "node-viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"nodes"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "deleted"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "node-viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "node-viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "deleted"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "deleted"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})}
+
+	// the valid bindings decide, next to the bindings of deleted roles
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/api/v1/nodes", status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web", status: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: "alice"}))
+
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.method, test.path, err)
+		}
+		if status == 0 {
+			status = recorder.Code
+		}
+
+		if status != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, status)
+		}
+	}
+
+	rules, err := rulesFor(sharedListers(), &user.DefaultInfo{Name: "alice"}, "demo")
+
+	if err != nil || len(rules) != 2 {
+		t.Errorf("expected the rules of the valid bindings, got %v %v", rules, err)
+	}
+}
+
+func TestInvalidRoleRefs(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"nodes"}}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		// cluster role bindings can't refer to roles, it isn't the cluster role of the same name
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "role-kind"}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// objects of another API named like the roles
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "bogus-group"}, RoleRef: v1.RoleRef{APIGroup: "example.com", Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "bogus-group"}, RoleRef: v1.RoleRef{APIGroup: "example.com", Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "bogus-kind"}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Policy", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "Role", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "carol"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{APIGroup: v1.GroupName, Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "carol"}}},
+	)
+
+	tests := []struct {
+		user      string
+		attrs     authorizer.AttributesRecord
+		permitted bool
+	}{
+		{user: "alice", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "list", Resource: "nodes"}},
+		{user: "alice", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"}},
+		{user: "bob", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "list", Resource: "nodes"}},
+		{user: "bob", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"}},
+		{user: "carol", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "list", Resource: "nodes"}, permitted: true},
+		{user: "carol", attrs: authorizer.AttributesRecord{ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"}, permitted: true},
+	}
+
+	for _, test := range tests {
+		test.attrs.User = &user.DefaultInfo{Name: test.user}
+
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), &test.attrs)
+
+		if err != nil || permitted != test.permitted {
+			t.Errorf("%s %s %s: expected permitted %v, got %v %v", test.user, test.attrs.Verb, test.attrs.Resource, test.permitted, permitted, err)
+		}
+	}
+
+	for _, name := range []string{"alice", "bob"} {
+		if rules, err := rulesFor(sharedListers(), &user.DefaultInfo{Name: name}, "demo"); err != nil || len(rules) != 0 {
+			t.Errorf("expected no rules of %s, got %v %v", name, rules, err)
+		}
+	}
+}
+
+func TestRoleBindingKinds(t *testing.T) {
+	view := v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "view"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}}}
+	deployer := v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "deployer"}, Rules: []v1.PolicyRule{{Verbs: []string{"create"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}}}
+	bindings := []v1.RoleBinding{
+		// the built-in view cluster role granted in demo
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "view"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "view"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "deployer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "deployer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// refers to the missing role view of its namespace, not to the cluster role
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "view"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "view"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "broken", Name: "missing"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "missing"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	}
+
+	objects := []runtime.Object{&view, &deployer}
+	for i := range bindings {
+		objects = append(objects, &bindings[i])
+	}
+
+	setupRBAC(t, objects...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	tests := []struct {
+		attrs     authorizer.AttributesRecord
+		permitted bool
+		err       error
+	}{
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "demo"}, permitted: true},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "create", APIGroup: "apps", Resource: "deployments", Namespace: "demo"}, permitted: true},
+		// the cluster role is granted in the namespace of the binding only
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods"}, permitted: false},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "prod"}, permitted: false},
+		// the bindings of missing roles grant nothing
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "other"}, permitted: false},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "broken"}, permitted: false},
+	}
+
+	for _, test := range tests {
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), &test.attrs)
+
+		if permitted != test.permitted || !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("%s %s in %q: expected %v %v, got %v %v", test.attrs.Verb, test.attrs.Resource, test.attrs.Namespace, test.permitted, test.err, permitted, err)
+		}
+	}
+
+	rules, err := rulesFor(sharedListers(), alice, "demo")
+
+	if err != nil || len(rules) != 2 {
+		t.Errorf("expected the rules of the role and of the cluster role, got %+v %v", rules, err)
+	}
+
+	// the API server read after a write resolves the kinds the same way
+	writes := newRecentWrites(time.Minute)
+	writes.reader = &fakeRBACReader{roleBindingList: bindings, roleList: []v1.Role{deployer}, clusterRoleList: []v1.ClusterRole{view}}
+
+	for _, test := range tests[:2] {
+		if permitted, err := writes.roleRecheck(&test.attrs, "1"); !permitted || err != nil {
+			t.Errorf("%s %s: expected permitted by the recheck, got %v %v", test.attrs.Verb, test.attrs.Resource, permitted, err)
+		}
+	}
+}
+
+func TestAggregatedClusterRoles(t *testing.T) {
+	aggregate := func(label string) *v1.AggregationRule {
+		return &v1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{label: "true"}}}}
+	}
+
+	clusterRoles := []v1.ClusterRole{
+		{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, AggregationRule: aggregate("aggregate-to-admin"),
+			Rules: []v1.PolicyRule{{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"namespaces"}}}},
+		// aggregated into admin and aggregating view in turn
+		{ObjectMeta: metav1.ObjectMeta{Name: "edit", Labels: map[string]string{"aggregate-to-admin": "true"}}, AggregationRule: aggregate("aggregate-to-edit"),
+			Rules: []v1.PolicyRule{{Verbs: []string{"create"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}}},
+		// selects admin and edit back, they are expanded once
+		{ObjectMeta: metav1.ObjectMeta{Name: "view", Labels: map[string]string{"aggregate-to-edit": "true"}}, AggregationRule: aggregate("aggregate-to-admin"),
+			Rules: []v1.PolicyRule{{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unrelated"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+	}
+	binding := v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}}
+	roleBinding := v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "edit"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "edit"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}}
+
+	objects := []runtime.Object{&binding, &roleBinding}
+	for i := range clusterRoles {
+		objects = append(objects, &clusterRoles[i])
+	}
+
+	setupRBAC(t, objects...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	bob := &user.DefaultInfo{Name: "bob"}
+
+	tests := []struct {
+		attrs     authorizer.AttributesRecord
+		permitted bool
+	}{
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "delete", Resource: "namespaces"}, permitted: true},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "create", APIGroup: "apps", Resource: "deployments"}, permitted: true},
+		// two levels of aggregation
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "pods"}, permitted: true},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "secrets"}, permitted: false},
+		// the cycle back to admin grants its rules to the role binding of edit
+		{attrs: authorizer.AttributesRecord{User: bob, ResourceRequest: true, Verb: "list", Resource: "pods", Namespace: "demo"}, permitted: true},
+		{attrs: authorizer.AttributesRecord{User: bob, ResourceRequest: true, Verb: "get", Resource: "secrets", Namespace: "demo"}, permitted: false},
+	}
+
+	for _, test := range tests {
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), &test.attrs)
+
+		if permitted != test.permitted || err != nil {
+			t.Errorf("%s %s %s: expected %v, got %v %v", test.attrs.User.GetName(), test.attrs.Verb, test.attrs.Resource, test.permitted, permitted, err)
+		}
+	}
+
+	rules, err := rulesFor(sharedListers(), alice, "")
+
+	if err != nil || len(rules) != 3 {
+		t.Errorf("expected the rules of the three aggregated roles, got %+v %v", rules, err)
+	}
+
+	// the API server read after a write expands the aggregation the same way
+	writes := newRecentWrites(time.Minute)
+	writes.reader = &fakeRBACReader{clusterRoleBindingList: []v1.ClusterRoleBinding{binding}, roleBindingList: []v1.RoleBinding{roleBinding}, clusterRoleList: clusterRoles}
+
+	for _, test := range tests[:3] {
+		if permitted, err := writes.clusterRoleRecheck(&test.attrs, "1"); !permitted || err != nil {
+			t.Errorf("%s %s: expected permitted by the recheck, got %v %v", test.attrs.Verb, test.attrs.Resource, permitted, err)
+		}
+	}
+
+	if permitted, err := writes.roleRecheck(&tests[4].attrs, "1"); !permitted || err != nil {
+		t.Errorf("expected permitted by the recheck, got %v %v", permitted, err)
+	}
+}
+
+func TestServiceAccountSubjects(t *testing.T) {
+	podReader := v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "pod-reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}}}
+
+	setupRBAC(t,
+		&podReader,
+		// the service account of the subject defaults to the namespace of the binding
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "builder"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "pod-reader"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Name: "builder"}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "deployer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "pod-reader"}, Subjects: []v1.Subject{{Kind: v1.ServiceAccountKind, Namespace: "ci", Name: "deployer"}}},
+		// every service account of monitoring
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "pod-reader"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "system:serviceaccounts:monitoring"}}},
+	)
+
+	tests := []struct {
+		user      string
+		path      string
+		permitted bool
+	}{
+		{user: "system:serviceaccount:demo:builder", path: "/api/v1/namespaces/demo/pods", permitted: true},
+		{user: "system:serviceaccount:demo:builder", path: "/api/v1/namespaces/other/pods", permitted: false},
+		{user: "system:serviceaccount:other:builder", path: "/api/v1/namespaces/demo/pods", permitted: false},
+		{user: "system:serviceaccount:ci:deployer", path: "/api/v1/namespaces/demo/pods", permitted: true},
+		{user: "system:serviceaccount:demo:deployer", path: "/api/v1/namespaces/demo/pods", permitted: false},
+		// the token carries no group, the groups of the service account are added
+		{user: "system:serviceaccount:monitoring:prometheus", path: "/api/v1/pods", permitted: true},
+		// a user named like a service account of a binding isn't it
+		{user: "builder", path: "/api/v1/namespaces/demo/pods", permitted: false},
+	}
+
+	for _, test := range tests {
+		r := newAuthorizedRequest(t, http.MethodGet, test.path, &user.DefaultInfo{Name: test.user})
+
+		attrs, err := getAuthorizerAttributes(r.Context())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs)
+
+		if err != nil || permitted != test.permitted {
+			t.Errorf("%s %s: expected permitted %v, got %v %v", test.user, test.path, test.permitted, permitted, err)
+		}
+	}
+}
+
+func TestStreamingSubresources(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "debugger"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"pods/exec", "pods/attach", "pods/portforward"}},
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods/log", "pods/proxy"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "debugger"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "debugger"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "debugger"}}},
+	)
+
+	tests := []struct {
+		method string
+		path   string
+		// the verb evaluated
+		verb      string
+		permitted bool
+	}{
+		// kubectl upgrades a POST to SPDY, websocket clients a GET
+		{method: http.MethodPost, path: "/api/v1/namespaces/demo/pods/web/exec", verb: "create", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web/exec", verb: "create", permitted: true},
+		{method: http.MethodPost, path: "/api/v1/namespaces/demo/pods/web/attach", verb: "create", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web/attach", verb: "create", permitted: true},
+		{method: http.MethodPost, path: "/api/v1/namespaces/demo/pods/web/portforward", verb: "create", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web/portforward", verb: "create", permitted: true},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web/log", verb: "get", permitted: true},
+		// the proxy is authorized with the verb of the method
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web/proxy", verb: "get", permitted: true},
+		{method: http.MethodPost, path: "/api/v1/namespaces/demo/pods/web/proxy", verb: "create", permitted: false},
+		// the subresources of other resources are left alone
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/services/web/exec", verb: "get", permitted: false},
+	}
+
+	for _, test := range tests {
+		r := newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: "debugger"})
+
+		attrs, err := getAuthorizerAttributes(r.Context())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs)
+
+		if err != nil || attrs.GetVerb() != test.verb || permitted != test.permitted {
+			t.Errorf("%s %s: expected verb %s permitted %v, got %s %v %v", test.method, test.path, test.verb, test.permitted, attrs.GetVerb(), permitted, err)
+		}
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"developers"}}
+
+	tests := []struct {
+		name      string
+		subject   v1.Subject
+		user      user.Info
+		namespace string
+		matches   bool
+	}{
+		{name: "user", subject: v1.Subject{Kind: v1.UserKind, APIGroup: v1.GroupName, Name: "alice"}, user: alice, matches: true},
+		{name: "user without group", subject: v1.Subject{Kind: v1.UserKind, Name: "alice"}, user: alice, matches: true},
+		{name: "group", subject: v1.Subject{Kind: v1.GroupKind, APIGroup: v1.GroupName, Name: "developers"}, user: alice, matches: true},
+		// users and groups sharing names, e.g. synchronized from LDAP, are told apart by the kind
+		{name: "group named like the user", subject: v1.Subject{Kind: v1.GroupKind, APIGroup: v1.GroupName, Name: "alice"}, user: alice, matches: false},
+		{name: "user named like a group", subject: v1.Subject{Kind: v1.UserKind, APIGroup: v1.GroupName, Name: "developers"}, user: alice, matches: false},
+		{name: "group of a user without groups", subject: v1.Subject{Kind: v1.GroupKind, APIGroup: v1.GroupName, Name: "developers"}, user: &user.DefaultInfo{Name: "alice"}, matches: false},
+		{name: "empty group of a user without groups", subject: v1.Subject{Kind: v1.GroupKind, APIGroup: v1.GroupName}, user: &user.DefaultInfo{Name: "alice"}, matches: false},
+		{name: "user of another API group", subject: v1.Subject{Kind: v1.UserKind, APIGroup: "iam.kubesphere.io", Name: "alice"}, user: alice, matches: false},
+		{name: "group of another API group", subject: v1.Subject{Kind: v1.GroupKind, APIGroup: "iam.kubesphere.io", Name: "developers"}, user: alice, matches: false},
+		{name: "service account", subject: v1.Subject{Kind: v1.ServiceAccountKind, Name: "builder"}, user: &user.DefaultInfo{Name: "system:serviceaccount:demo:builder"}, namespace: "demo", matches: true},
+		{name: "service account of the RBAC API group", subject: v1.Subject{Kind: v1.ServiceAccountKind, APIGroup: v1.GroupName, Name: "builder"}, user: &user.DefaultInfo{Name: "system:serviceaccount:demo:builder"}, namespace: "demo", matches: false},
+		{name: "unknown kind", subject: v1.Subject{Kind: "Team", Name: "alice"}, user: alice, matches: false},
+	}
+
+	for _, test := range tests {
+		if matches := subjectMatches(test.subject, test.user, test.namespace); matches != test.matches {
+			t.Errorf("%s: expected matches %v, got %v", test.name, test.matches, matches)
+		}
+	}
+
+	// the first matching subject tells which one grants the binding
+	subjects := []v1.Subject{
+		{Kind: v1.GroupKind, APIGroup: v1.GroupName, Name: "alice"},
+		{Kind: v1.UserKind, APIGroup: "iam.kubesphere.io", Name: "alice"},
+		{Kind: v1.GroupKind, APIGroup: v1.GroupName, Name: "developers"},
+		{Kind: v1.UserKind, APIGroup: v1.GroupName, Name: "alice"},
+	}
+
+	if subject, ok := matchingSubject(subjects, alice, ""); !ok || subject != subjects[2] {
+		t.Errorf("expected %+v matching, got %+v %v", subjects[2], subject, ok)
+	}
+
+	if subject, ok := matchingSubject(subjects[:2], alice, ""); ok {
+		t.Errorf("expected no subject matching, got %+v", subject)
+	}
+}
+
+func TestImplicitGroups(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "discovery"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/apis", "/apis/*", "/version"}}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "public-info"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "discovery"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "discovery"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: user.AllAuthenticated}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "public-info"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "public-info"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: user.AllUnauthenticated}}},
+	)
+
+	tests := []struct {
+		user      user.Info
+		path      string
+		permitted bool
+		groups    []string
+	}{
+		// the token carries no group
+		{user: &user.DefaultInfo{Name: "alice"}, path: "/apis", permitted: true, groups: []string{user.AllAuthenticated}},
+		{user: &user.DefaultInfo{Name: "alice", Groups: []string{"developers"}}, path: "/apis/apps", permitted: true, groups: []string{"developers", user.AllAuthenticated}},
+		{user: &user.DefaultInfo{Name: "alice", Groups: []string{user.AllAuthenticated}}, path: "/version", permitted: true, groups: []string{user.AllAuthenticated}},
+		{user: &user.DefaultInfo{Name: "alice"}, path: "/healthz", permitted: false, groups: []string{user.AllAuthenticated}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:demo:builder"}, path: "/apis", permitted: true,
+			groups: []string{user.AllAuthenticated, "system:serviceaccounts", "system:serviceaccounts:demo"}},
+		{user: &user.DefaultInfo{Name: user.Anonymous}, path: "/apis", permitted: false, groups: []string{user.AllUnauthenticated}},
+		{user: &user.DefaultInfo{}, path: "/healthz", permitted: true, groups: []string{user.AllUnauthenticated}},
+	}
+
+	for _, test := range tests {
+		r := newAuthorizedRequest(t, http.MethodGet, test.path, test.user)
+
+		attrs, err := getAuthorizerAttributes(r.Context())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if groups := attrs.GetUser().GetGroups(); !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("%q: expected groups %v, got %v", test.user.GetName(), test.groups, groups)
+		}
+
+		permitted, _, err := permissionValidate(context.Background(), sharedListers(), attrs)
+
+		if err != nil || permitted != test.permitted {
+			t.Errorf("%q %s: expected permitted %v, got %v %v", test.user.GetName(), test.path, test.permitted, permitted, err)
+		}
+	}
+}
+
+func TestRulesFor(t *testing.T) {
+	setupRBAC(t, duplicatedBindings(10)...)
+
+	tests := []struct {
+		user      user.Info
+		namespace string
+		rules     int
+	}{
+		// the rule of viewer and its reordered copy of auditor are the same rule
+		{user: developer, rules: 2},
+		{user: developer, namespace: "demo", rules: 3},
+		{user: stranger, namespace: "demo", rules: 0},
+	}
+
+	for _, test := range tests {
+		rules, err := rulesFor(sharedListers(), test.user, test.namespace)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rules) != test.rules {
+			t.Errorf("%s in %q: expected %d rules, got %+v", test.user.GetName(), test.namespace, test.rules, rules)
+		}
+	}
+}
+
+func BenchmarkPermissionValidateDuplicatedBindings(b *testing.B) {
+	setupRBAC(b, duplicatedBindings(500)...)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, test := range decisions {
+			if permitted, _, _ := permissionValidate(context.Background(), sharedListers(), &test.attrs); permitted != test.permitted {
+				b.Fatalf("expected permitted %v, got %v", test.permitted, permitted)
+			}
+		}
+	}
+}
+
+// BenchmarkNonResourceRequests evaluates denied /metrics requests, with and without a namespace, the
+// role bindings of the namespace aren't listed in either case.
+func BenchmarkNonResourceRequests(b *testing.B) {
+	setupRBAC(b, duplicatedBindings(500)...)
+
+	for _, namespace := range []string{"", "demo"} {
+		attrs := &authorizer.AttributesRecord{User: developer, Verb: "get", Path: "/metrics", Namespace: namespace}
+
+		b.Run(fmt.Sprintf("namespace=%q", namespace), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if permitted, _, _ := permissionValidate(context.Background(), sharedListers(), attrs); permitted {
+					b.Fatal("expected denied")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRulesForDuplicatedBindings(b *testing.B) {
+	setupRBAC(b, duplicatedBindings(500)...)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := rulesFor(sharedListers(), developer, "demo"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// realisticRules are rules like the ones of the built-in roles of a namespace, a few verbs, groups and
+// resources each, subresources and names included
+var realisticRules = []v1.PolicyRule{
+	{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log", "services", "endpoints", "configmaps", "persistentvolumeclaims", "events"}},
+	{Verbs: []string{"get", "list", "watch"}, APIGroups: []string{"apps", "extensions"}, Resources: []string{"deployments", "deployments/scale", "statefulsets", "daemonsets", "replicasets"}},
+	{Verbs: []string{"create", "update", "patch", "delete"}, APIGroups: []string{"apps"}, Resources: []string{"deployments", "deployments/scale", "statefulsets", "statefulsets/scale"}},
+	{Verbs: []string{"get", "list"}, APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}},
+	{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"registry-secret", "default-token"}},
+	{Verbs: []string{"*"}, APIGroups: []string{"devops.kubesphere.io"}, Resources: []string{"*/status"}},
+	{Verbs: []string{"get", "update"}, APIGroups: []string{"types.kubefed.io"}, Resources: []string{"federatedpersistentvolumeclaims", "federatedpersistentvolumeclaims/status"}},
+}
+
+// realisticRequests are matched against realisticRules, the last ones match none of them
+var realisticRequests = []struct {
+	apiGroup, resource, subresource, name, verb string
+}{
+	{resource: "pods", verb: "list"},
+	{resource: "pods", subresource: "log", name: "web-0", verb: "get"},
+	{apiGroup: "apps", resource: "deployments", subresource: "scale", name: "web", verb: "update"},
+	{apiGroup: "batch", resource: "cronjobs", name: "backup", verb: "get"},
+	{resource: "secrets", name: "default-token", verb: "get"},
+	{resource: "secrets", name: "admin-token", verb: "get"},
+	{apiGroup: "apps", resource: "deployments", subresource: "status", name: "web", verb: "get"},
+	{apiGroup: "types.kubefed.io", resource: "federatedpersistentvolumeclaims", subresource: "status", name: "data", verb: "update"},
+	{resource: "namespaces", verb: "delete"},
+}
+
+// BenchmarkRuleMatchesResources matches every realistic request against every realistic rule. Building
+// the combined resource allocated for the names longer than 32 bytes: 1417 ns/op, 48 B/op, 1 allocs/op
+// before, 1389 ns/op, 0 B/op, 0 allocs/op after.
+func BenchmarkRuleMatchesResources(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, request := range realisticRequests {
+			for _, rule := range realisticRules {
+				ruleMatchesRequest(rule, request.apiGroup, "v1", "", request.resource, request.subresource, request.name, request.verb)
+			}
+		}
+	}
+}
+
+// BenchmarkPermissionValidate evaluates the realistic requests of a user bound to a namespace role and
+// a cluster role of the realistic rules, among the bindings of other users. The compiled rules are
+// looked up without building their key: 451 allocs/op before, 435 allocs/op after, the others are the
+// ones of the informers, listers and indexes.
+func BenchmarkPermissionValidate(b *testing.B) {
+	objects := []runtime.Object{
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "operator"}, Rules: realisticRules[:2]},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "maintainer"}, Rules: realisticRules[2:]},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "alice-operator"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "operator"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "alice-maintainer"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "maintainer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	}
+	for i := 0; i < 200; i++ {
+		subjects := []v1.Subject{{Kind: v1.UserKind, Name: fmt.Sprintf("user-%d", i)}}
+		objects = append(objects,
+			&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("operator-%d", i)}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "operator"}, Subjects: subjects},
+			&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("maintainer-%d", i)}, RoleRef: v1.RoleRef{Kind: "Role", Name: "maintainer"}, Subjects: subjects},
+		)
+	}
+	setupRBAC(b, objects...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	requests := make([]*authorizer.AttributesRecord, 0, len(realisticRequests))
+	for _, request := range realisticRequests {
+		requests = append(requests, &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Namespace: "demo",
+			APIGroup: request.apiGroup, APIVersion: "v1", Resource: request.resource, Subresource: request.subresource, Name: request.name, Verb: request.verb})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, attrs := range requests {
+			if _, _, err := permissionValidate(context.Background(), sharedListers(), attrs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
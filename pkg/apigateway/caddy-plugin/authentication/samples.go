@@ -0,0 +1,142 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	defaultSampleMaxSize = 100 << 20
+	// rotated files kept besides the current one, the oldest is removed
+	sampleBackups = 3
+)
+
+// DecisionSample is a decision of the gateway recorded for offline analysis, see Replay
+type DecisionSample struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	// the user is the pseudonym of its name, see Pseudonymize
+	Pseudonymized   bool     `json:"pseudonymized,omitempty"`
+	Groups          []string `json:"groups,omitempty"`
+	ResourceRequest bool     `json:"resourceRequest"`
+	Verb            string   `json:"verb"`
+	Namespace       string   `json:"namespace,omitempty"`
+	APIGroup        string   `json:"apiGroup,omitempty"`
+	APIVersion      string   `json:"apiVersion,omitempty"`
+	Resource        string   `json:"resource,omitempty"`
+	Subresource     string   `json:"subresource,omitempty"`
+	Name            string   `json:"name,omitempty"`
+	Path            string   `json:"path,omitempty"`
+	Allowed         bool     `json:"allowed"`
+	// highest resource version of the roles and bindings the decision was made on
+	RBACVersion string `json:"rbacVersion,omitempty"`
+}
+
+// attributes returns the attributes the decision was made on
+func (s *DecisionSample) attributes() authorizer.Attributes {
+	return &authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: s.User, Groups: s.Groups},
+		ResourceRequest: s.ResourceRequest,
+		Verb:            s.Verb,
+		Namespace:       s.Namespace,
+		APIGroup:        s.APIGroup,
+		APIVersion:      s.APIVersion,
+		Resource:        s.Resource,
+		Subresource:     s.Subresource,
+		Name:            s.Name,
+		Path:            s.Path,
+	}
+}
+
+// Pseudonymize returns the pseudonym of a user name recorded with key, the subjects of the RBAC
+// fixtures replayed against pseudonymized samples are pseudonymized the same way.
+func Pseudonymize(key []byte, name string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sampleRecorder writes a sample of the decisions of the gateway to a file of JSON lines, the
+// file is rotated when it exceeds maxSize. The file is opened on the first sample.
+type sampleRecorder struct {
+	file     *rotatingFile
+	fraction float64
+	// pseudonymizes the user names if not empty
+	key    []byte
+	random func() float64
+	now    func() time.Time
+}
+
+func newSampleRecorder(path string, fraction float64, maxSize int64, key []byte) *sampleRecorder {
+	return &sampleRecorder{file: newRotatingFile(path, maxSize, sampleBackups), fraction: fraction, key: key, random: rand.Float64, now: time.Now}
+}
+
+// record writes the decision if it's sampled, failures are logged, they never fail the request
+func (s *sampleRecorder) record(attrs authorizer.Attributes, allowed bool, version string) {
+	if s.random() >= s.fraction {
+		return
+	}
+
+	sample := DecisionSample{
+		Time:            s.now(),
+		User:            attrs.GetUser().GetName(),
+		Groups:          attrs.GetUser().GetGroups(),
+		ResourceRequest: attrs.IsResourceRequest(),
+		Verb:            attrs.GetVerb(),
+		Namespace:       attrs.GetNamespace(),
+		APIGroup:        attrs.GetAPIGroup(),
+		APIVersion:      attrs.GetAPIVersion(),
+		Resource:        attrs.GetResource(),
+		Subresource:     attrs.GetSubresource(),
+		Name:            attrs.GetName(),
+		Path:            attrs.GetPath(),
+		Allowed:         allowed,
+		RBACVersion:     version,
+	}
+
+	if len(s.key) > 0 {
+		sample.User = Pseudonymize(s.key, sample.User)
+		sample.Pseudonymized = true
+	}
+
+	line, err := json.Marshal(sample)
+
+	if err != nil {
+		log.Printf("[ERROR] authentication: encode decision sample: %v", err)
+		return
+	}
+
+	if err := s.file.write(append(line, '\n')); err != nil {
+		log.Printf("[ERROR] authentication: record decision sample: %v", err)
+	}
+}
+
+// close closes the current file
+func (s *sampleRecorder) close() error {
+	return s.file.close()
+}
@@ -0,0 +1,320 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const adminFixture = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: cluster-admin
+rules:
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: cluster-admin
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: User
+  name: admin
+`
+
+const healthzFixture = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: healthz
+rules:
+- nonResourceURLs: ["/healthz"]
+  verbs: ["get"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: healthz
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: healthz
+subjects:
+- kind: Group
+  name: system:authenticated
+`
+
+const viewerRoleFixture = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  namespace: demo
+  name: viewer
+rules:
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["get", "list", "watch"]
+`
+
+const viewerBindingFixture = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  namespace: demo
+  name: viewer
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: viewer
+subjects:
+- kind: User
+  name: alice
+`
+
+// the proposed change: the cluster admin binding is dropped, viewers may create deployments
+const proposedViewerFixture = `{
+  "apiVersion": "rbac.authorization.k8s.io/v1",
+  "kind": "Role",
+  "metadata": {"namespace": "demo", "name": "viewer"},
+  "rules": [
+    {"apiGroups": ["*"], "resources": ["*"], "verbs": ["get", "list", "watch"]},
+    {"apiGroups": ["apps"], "resources": ["deployments"], "verbs": ["create"]}
+  ]
+}`
+
+func writeFixtures(t *testing.T, dir string, files map[string]string) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	baseline, proposed := filepath.Join(dir, "baseline"), filepath.Join(dir, "proposed")
+
+	writeFixtures(t, baseline, map[string]string{"cluster.yaml": adminFixture + "---" + healthzFixture, "viewer.yml": viewerRoleFixture + "---" + viewerBindingFixture, "README.md": "not a fixture"})
+	writeFixtures(t, proposed, map[string]string{"healthz.yaml": healthzFixture, "viewer.yaml": viewerBindingFixture, "viewer.json": proposedViewerFixture})
+
+	listers, err := loadFixtureListers(baseline)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticated := []string{"system:authenticated"}
+
+	traffic := []*authorizer.AttributesRecord{
+		{User: &user.DefaultInfo{Name: "admin", Groups: authenticated}, ResourceRequest: true, Verb: "delete", Namespace: "demo", Resource: "pods", Name: "web"},
+		{User: &user.DefaultInfo{Name: "alice", Groups: authenticated}, ResourceRequest: true, Verb: "get", Namespace: "demo", Resource: "pods", Name: "web"},
+		{User: &user.DefaultInfo{Name: "alice", Groups: authenticated}, ResourceRequest: true, Verb: "create", Namespace: "demo", APIGroup: "apps", Resource: "deployments"},
+		{User: &user.DefaultInfo{Name: "alice", Groups: authenticated}, ResourceRequest: true, Verb: "delete", Namespace: "demo", Resource: "pods", Name: "web"},
+		{User: &user.DefaultInfo{Name: "bob", Groups: authenticated}, Verb: "get", Path: "/healthz"},
+	}
+
+	file := filepath.Join(dir, "samples.json")
+	recorder := newSampleRecorder(file, 1, defaultSampleMaxSize, nil)
+
+	for _, attrs := range traffic {
+		allowed, err := Authorize(listers, attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.record(attrs, allowed, "")
+	}
+
+	if err := recorder.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Replay(file, baseline)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Samples != len(traffic) || len(report.Diffs) != 0 {
+		t.Errorf("expected the decisions of %d samples unchanged, got %+v", len(traffic), report)
+	}
+
+	report, err = Replay(file, proposed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Samples != len(traffic) || report.Granted != 1 || report.Revoked != 1 || len(report.Diffs) != 2 {
+		t.Fatalf("expected a granted and a revoked decision of %d samples, got %+v", len(traffic), report)
+	}
+
+	if diff := report.Diffs[0]; diff.Sample.User != "admin" || diff.Sample.Verb != "delete" || diff.Allowed {
+		t.Errorf("expected the delete of admin revoked, got %+v", diff)
+	}
+
+	if diff := report.Diffs[1]; diff.Sample.User != "alice" || diff.Sample.Resource != "deployments" || !diff.Allowed {
+		t.Errorf("expected the deployment creation of alice granted, got %+v", diff)
+	}
+
+	if _, err := Replay(filepath.Join(dir, "missing.json"), proposed); err == nil {
+		t.Error("expected missing samples fail")
+	}
+
+	writeFixtures(t, filepath.Join(dir, "invalid"), map[string]string{"pod.yaml": "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\n"})
+
+	if _, err := Replay(file, filepath.Join(dir, "invalid")); err == nil {
+		t.Error("expected fixtures of other kinds fail")
+	}
+}
+
+func TestSampleRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "samples.json")
+	key := []byte("secret")
+
+	recorder := newSampleRecorder(file, 0.5, 300, key)
+	recorder.now = func() time.Time { return time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC) }
+
+	// every other decision is sampled
+	random := 0.0
+	recorder.random = func() float64 {
+		random = 0.75 - random
+		return random
+	}
+
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "list", Namespace: "demo", Resource: "pods"}
+
+	for i := 0; i < 40; i++ {
+		recorder.record(attrs, true, "")
+	}
+
+	if err := recorder.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+
+	for _, name := range []string{"samples.json", "samples.json.1", "samples.json.2", "samples.json.3"} {
+		f, err := os.Open(filepath.Join(dir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, _ := f.Stat()
+		if info.Size() > 300 {
+			t.Errorf("%s: expected rotated at 300 bytes, got %d", name, info.Size())
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var sample DecisionSample
+			if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+				t.Fatal(err)
+			}
+			if !sample.Pseudonymized || sample.User != Pseudonymize(key, "alice") || sample.Verb != "list" || !sample.Allowed {
+				t.Errorf("unexpected sample %+v", sample)
+			}
+			lines++
+		}
+
+		f.Close()
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "samples.json.4")); !os.IsNotExist(err) {
+		t.Errorf("expected %d backups at most, got %v", sampleBackups, err)
+	}
+
+	if lines == 0 || lines >= 20 {
+		t.Errorf("expected the oldest of 20 samples removed, got %d", lines)
+	}
+}
+
+func TestSetupSamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "key")
+
+	if err := ioutil.WriteFile(key, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := filepath.Join(dir, "samples.json")
+
+	tests := []struct {
+		input string
+		fail  bool
+	}{
+		{input: "authentication {\n path /kapis\n samples " + samples + " 0.1\n}", fail: false},
+		{input: "authentication {\n path /kapis\n samples " + samples + " 1\n sampleMaxSize 1048576\n sampleKey " + key + "\n}", fail: false},
+		{input: "authentication {\n path /kapis\n samples " + samples + "\n}", fail: true},
+		{input: "authentication {\n path /kapis\n samples " + samples + " 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n samples " + samples + " 0.1\n sampleMaxSize 0\n}", fail: true},
+		{input: "authentication {\n path /kapis\n samples " + samples + " 0.1\n sampleKey " + filepath.Join(dir, "missing") + "\n}", fail: true},
+	}
+
+	for _, test := range tests {
+		err := Setup(caddy.NewTestController("http", test.input))
+		if test.fail && err == nil {
+			t.Errorf("%q: expected setup fails", test.input)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%q: unexpected error %v", test.input, err)
+		}
+	}
+}
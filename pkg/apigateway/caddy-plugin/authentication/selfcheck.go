@@ -0,0 +1,117 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// permission is a permission the gateway's service account needs, the authorization doesn't work
+// without the critical ones.
+type permission struct {
+	group    string
+	resource string
+	verb     string
+	critical bool
+}
+
+func (p permission) String() string {
+	if p.group == "" {
+		return p.verb + " " + p.resource
+	}
+	return p.verb + " " + p.resource + "." + p.group
+}
+
+var requiredPermissions = func() []permission {
+	permissions := make([]permission, 0)
+
+	add := func(group string, critical bool, resources ...string) {
+		for _, resource := range resources {
+			for _, verb := range []string{"list", "watch"} {
+				permissions = append(permissions, permission{group: group, resource: resource, verb: verb, critical: critical})
+			}
+		}
+	}
+
+	// cached by the informers of the authorization
+	add("rbac.authorization.k8s.io", true, "roles", "rolebindings", "clusterroles", "clusterrolebindings")
+	add("", true, "namespaces")
+	// cached by the resource searchers
+	add("", false, "pods", "services", "configmaps", "secrets", "persistentvolumeclaims", "nodes")
+	add("apps", false, "deployments", "statefulsets", "daemonsets")
+	add("batch", false, "jobs", "cronjobs")
+	add("extensions", false, "ingresses")
+	add("storage.k8s.io", false, "storageclasses")
+
+	return permissions
+}()
+
+// accessReviewer creates a SelfSubjectAccessReview, it's the Create of the typed client
+type accessReviewer func(review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error)
+
+// checkPermissions reviews permissions with the credentials of the gateway and logs a report of the
+// missing ones. It fails if a critical permission is missing and required is true, a failed review
+// counts as missing.
+func checkPermissions(review accessReviewer, permissions []permission, required bool) error {
+	missing := make([]string, 0)
+	criticalMissing := make([]string, 0)
+
+	for _, p := range permissions {
+		result, err := review(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{Group: p.group, Resource: p.resource, Verb: p.verb},
+			},
+		})
+
+		var reason string
+		switch {
+		case err != nil:
+			reason = fmt.Sprintf("%s (review failed: %v)", p, err)
+		case !result.Status.Allowed:
+			reason = p.String()
+			if result.Status.Reason != "" {
+				reason = fmt.Sprintf("%s (%s)", p, result.Status.Reason)
+			}
+		default:
+			continue
+		}
+
+		missing = append(missing, reason)
+		if p.critical {
+			criticalMissing = append(criticalMissing, p.String())
+		}
+	}
+
+	if len(missing) == 0 {
+		log.Printf("[INFO] authentication: all %d permissions of the service account are granted", len(permissions))
+		return nil
+	}
+
+	log.Printf("[WARNING] authentication: %d of %d permissions of the service account are missing, %d critical:\n  %s",
+		len(missing), len(permissions), len(criticalMissing), strings.Join(missing, "\n  "))
+
+	if required && len(criticalMissing) > 0 {
+		return fmt.Errorf("authentication: critical permissions of the service account are missing: %s", strings.Join(criticalMissing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mholt/caddy"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// fakeReviewer denies the permissions in denied and fails the reviews in failed, it records the reviews
+type fakeReviewer struct {
+	denied  map[string]bool
+	failed  map[string]bool
+	reviews int
+}
+
+func (r *fakeReviewer) create(review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error) {
+	r.reviews++
+
+	attributes := review.Spec.ResourceAttributes
+	key := permission{group: attributes.Group, resource: attributes.Resource, verb: attributes.Verb}.String()
+
+	if r.failed[key] {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	result := review.DeepCopy()
+	result.Status.Allowed = !r.denied[key]
+	if !result.Status.Allowed {
+		result.Status.Reason = "no RBAC policy matched"
+	}
+
+	return result, nil
+}
+
+func TestCheckPermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		denied   []string
+		failed   []string
+		required bool
+		fail     bool
+	}{
+		{name: "all granted", required: true},
+		{name: "searcher kinds missing", denied: []string{"list pods", "watch deployments.apps"}, failed: []string{"list cronjobs.batch"}, required: true},
+		{name: "critical missing", denied: []string{"watch rolebindings.rbac.authorization.k8s.io", "list pods"}, required: true, fail: true},
+		{name: "critical review failed", failed: []string{"list namespaces"}, required: true, fail: true},
+		{name: "critical missing not required", denied: []string{"list clusterroles.rbac.authorization.k8s.io"}, failed: []string{"list namespaces"}},
+	}
+
+	for _, test := range tests {
+		reviewer := &fakeReviewer{denied: make(map[string]bool), failed: make(map[string]bool)}
+		for _, key := range test.denied {
+			reviewer.denied[key] = true
+		}
+		for _, key := range test.failed {
+			reviewer.failed[key] = true
+		}
+
+		err := checkPermissions(reviewer.create, requiredPermissions, test.required)
+
+		if test.fail != (err != nil) {
+			t.Errorf("%s: expected fail %v, got %v", test.name, test.fail, err)
+		}
+
+		// every permission is reviewed to report all missing ones at once
+		if reviewer.reviews != len(requiredPermissions) {
+			t.Errorf("%s: expected %d reviews, got %d", test.name, len(requiredPermissions), reviewer.reviews)
+		}
+	}
+}
+
+func TestParseRequirePermissions(t *testing.T) {
+	tests := []struct {
+		input    string
+		required bool
+		fail     bool
+	}{
+		{input: "authentication {\n path /kapis\n}", required: false},
+		{input: "authentication {\n path /kapis\n requirePermissions on\n}", required: true},
+		{input: "authentication {\n path /kapis\n requirePermissions off\n}", required: false},
+		{input: "authentication {\n path /kapis\n requirePermissions\n}", fail: true},
+		{input: "authentication {\n path /kapis\n requirePermissions yes\n}", fail: true},
+	}
+
+	for _, test := range tests {
+		rule, err := parse(caddy.NewTestController("http", test.input))
+
+		if test.fail != (err != nil) {
+			t.Errorf("%q: expected fail %v, got %v", test.input, test.fail, err)
+			continue
+		}
+
+		if !test.fail && rule.RequirePermissions != test.required {
+			t.Errorf("%q: expected requirePermissions %v, got %v", test.input, test.required, rule.RequirePermissions)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const (
+	shadowWorkers     = 4
+	shadowQueueSize   = 1000
+	mismatchLogSize   = 100
+	shadowMatch       = "match"
+	shadowMismatch    = "mismatch"
+	shadowReviewError = "error"
+	shadowDropped     = "dropped"
+)
+
+var shadowEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "authentication_shadow_evaluations_total",
+	Help: "Number of gateway decisions compared with SubjectAccessReview, by result and local decision.",
+}, []string{"result", "local"})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(shadowEvaluations); err != nil {
+		log.Printf("[ERROR] authentication: register shadow evaluation metrics: %v", err)
+	}
+}
+
+// subjectAccessReviewer creates a SubjectAccessReview, it's the Create of the typed client
+type subjectAccessReviewer func(review *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error)
+
+// mismatch is a decision of the gateway the API server disagrees with
+type mismatch struct {
+	Time   time.Time                               `json:"time"`
+	Local  bool                                    `json:"local"`
+	Remote bool                                    `json:"remote"`
+	Reason string                                  `json:"reason,omitempty"`
+	Spec   authorizationv1.SubjectAccessReviewSpec `json:"spec"`
+}
+
+type shadowTask struct {
+	attrs   authorizer.Attributes
+	allowed bool
+}
+
+// shadowEvaluator reviews a sample of the decisions of the gateway with the API server and records
+// the mismatches. Reviews run in a worker pool, decisions are dropped if the queue is full, so the
+// request never waits for them.
+type shadowEvaluator struct {
+	review subjectAccessReviewer
+	sample float64
+	random func() float64
+
+	queue   chan shadowTask
+	pending sync.WaitGroup
+
+	mutex      sync.Mutex
+	mismatches []mismatch
+	next       int
+	full       bool
+}
+
+func newShadowEvaluator(review subjectAccessReviewer, sample float64, queueSize, logSize int) *shadowEvaluator {
+	return &shadowEvaluator{
+		review:     review,
+		sample:     sample,
+		random:     rand.Float64,
+		queue:      make(chan shadowTask, queueSize),
+		mismatches: make([]mismatch, logSize),
+	}
+}
+
+// start runs the workers until stopCh is closed
+func (e *shadowEvaluator) start(workers int, stopCh <-chan struct{}) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case task := <-e.queue:
+					e.evaluate(task)
+					e.pending.Done()
+				case <-stopCh:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// submit queues the decision for review if it's sampled, it never blocks
+func (e *shadowEvaluator) submit(attrs authorizer.Attributes, allowed bool) {
+	if e.random() >= e.sample {
+		return
+	}
+
+	e.pending.Add(1)
+
+	select {
+	case e.queue <- shadowTask{attrs: attrs, allowed: allowed}:
+	default:
+		e.pending.Done()
+		shadowEvaluations.WithLabelValues(shadowDropped, decision(allowed)).Inc()
+	}
+}
+
+// flush waits for the queued decisions to be reviewed
+func (e *shadowEvaluator) flush() {
+	e.pending.Wait()
+}
+
+func (e *shadowEvaluator) evaluate(task shadowTask) {
+	spec := subjectAccessReviewSpec(task.attrs)
+
+	result, err := e.review(&authorizationv1.SubjectAccessReview{Spec: spec})
+
+	if err != nil {
+		shadowEvaluations.WithLabelValues(shadowReviewError, decision(task.allowed)).Inc()
+		return
+	}
+
+	if result.Status.Allowed == task.allowed {
+		shadowEvaluations.WithLabelValues(shadowMatch, decision(task.allowed)).Inc()
+		return
+	}
+
+	shadowEvaluations.WithLabelValues(shadowMismatch, decision(task.allowed)).Inc()
+	log.Printf("[WARNING] authentication: gateway decision %s differs from the API server for %s %s of user %s",
+		decision(task.allowed), task.attrs.GetVerb(), task.attrs.GetResource()+task.attrs.GetPath(), task.attrs.GetUser().GetName())
+
+	e.record(mismatch{Time: time.Now(), Local: task.allowed, Remote: result.Status.Allowed, Reason: result.Status.Reason, Spec: spec})
+}
+
+func (e *shadowEvaluator) record(m mismatch) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.mismatches[e.next] = m
+	e.next = (e.next + 1) % len(e.mismatches)
+	if e.next == 0 {
+		e.full = true
+	}
+}
+
+// list returns the recent mismatches, the oldest first
+func (e *shadowEvaluator) list() []mismatch {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if !e.full {
+		return append([]mismatch{}, e.mismatches[:e.next]...)
+	}
+
+	return append(append([]mismatch{}, e.mismatches[e.next:]...), e.mismatches[:e.next]...)
+}
+
+func decision(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
+
+func subjectAccessReviewSpec(attrs authorizer.Attributes) authorizationv1.SubjectAccessReviewSpec {
+	u := attrs.GetUser()
+
+	spec := authorizationv1.SubjectAccessReviewSpec{User: u.GetName(), UID: u.GetUID(), Groups: u.GetGroups()}
+
+	if extra := u.GetExtra(); len(extra) > 0 {
+		spec.Extra = make(map[string]authorizationv1.ExtraValue, len(extra))
+		for k, v := range extra {
+			spec.Extra[k] = v
+		}
+	}
+
+	if attrs.IsResourceRequest() {
+		spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace:   attrs.GetNamespace(),
+			Verb:        attrs.GetVerb(),
+			Group:       attrs.GetAPIGroup(),
+			Version:     attrs.GetAPIVersion(),
+			Resource:    attrs.GetResource(),
+			Subresource: attrs.GetSubresource(),
+			Name:        attrs.GetName(),
+		}
+	} else {
+		spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: attrs.GetPath(), Verb: attrs.GetVerb()}
+	}
+
+	return spec
+}
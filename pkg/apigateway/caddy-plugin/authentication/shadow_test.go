@@ -0,0 +1,193 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	dto "github.com/prometheus/client_model/go"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// fakeSubjectAccessReviewer allows everything but secrets, reviews of nodes fail
+type fakeSubjectAccessReviewer struct {
+	mutex   sync.Mutex
+	reviews []authorizationv1.SubjectAccessReviewSpec
+}
+
+func (r *fakeSubjectAccessReviewer) create(review *authorizationv1.SubjectAccessReview) (*authorizationv1.SubjectAccessReview, error) {
+	r.mutex.Lock()
+	r.reviews = append(r.reviews, review.Spec)
+	r.mutex.Unlock()
+
+	attributes := review.Spec.ResourceAttributes
+
+	if attributes != nil && attributes.Resource == "nodes" {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	result := review.DeepCopy()
+	result.Status.Allowed = attributes == nil || attributes.Resource != "secrets"
+	if !result.Status.Allowed {
+		result.Status.Reason = "secrets are confidential"
+	}
+
+	return result, nil
+}
+
+func shadowCount(t *testing.T, result, local string) float64 {
+	var metric dto.Metric
+	if err := shadowEvaluations.WithLabelValues(result, local).Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestShadowEvaluation(t *testing.T) {
+	reviewer := &fakeSubjectAccessReviewer{}
+	shadow := newShadowEvaluator(reviewer.create, 1, 10, 2)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	shadow.start(2, stopCh)
+
+	alice := &user.DefaultInfo{Name: "alice", Groups: []string{"dev"}, Extra: map[string][]string{ExtraWorkspaces: {"demo"}}}
+
+	mismatches := shadowCount(t, shadowMismatch, "allow") + shadowCount(t, shadowMismatch, "deny")
+	matches := shadowCount(t, shadowMatch, "allow") + shadowCount(t, shadowMatch, "deny")
+	failures := shadowCount(t, shadowReviewError, "allow")
+
+	decisions := []struct {
+		attrs   authorizer.AttributesRecord
+		allowed bool
+	}{
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "pods", Namespace: "demo"}, allowed: true},
+		// the gateway allows, the API server denies
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "secrets", Namespace: "demo", Name: "token"}, allowed: true},
+		// the gateway denies, the API server allows
+		{attrs: authorizer.AttributesRecord{User: alice, Verb: "get", Path: "/healthz"}, allowed: false},
+		{attrs: authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "list", Resource: "nodes"}, allowed: true},
+	}
+
+	for i := range decisions {
+		shadow.submit(&decisions[i].attrs, decisions[i].allowed)
+	}
+
+	shadow.flush()
+
+	if d := shadowCount(t, shadowMismatch, "allow") + shadowCount(t, shadowMismatch, "deny") - mismatches; d != 2 {
+		t.Errorf("expected 2 mismatches, got %v", d)
+	}
+
+	if d := shadowCount(t, shadowMatch, "allow") + shadowCount(t, shadowMatch, "deny") - matches; d != 1 {
+		t.Errorf("expected 1 match, got %v", d)
+	}
+
+	if d := shadowCount(t, shadowReviewError, "allow") - failures; d != 1 {
+		t.Errorf("expected 1 failed review, got %v", d)
+	}
+
+	list := shadow.list()
+
+	if len(list) != 2 {
+		t.Fatalf("expected 2 mismatches, got %+v", list)
+	}
+
+	for _, m := range list {
+		if m.Local == m.Remote || m.Spec.User != "alice" || len(m.Spec.Extra[ExtraWorkspaces]) != 1 {
+			t.Errorf("unexpected mismatch %+v", m)
+		}
+		if m.Spec.ResourceAttributes != nil && (m.Spec.ResourceAttributes.Name != "token" || m.Reason == "") {
+			t.Errorf("expected attributes of the secret, got %+v", m)
+		}
+		if m.Spec.ResourceAttributes == nil && m.Spec.NonResourceAttributes.Path != "/healthz" {
+			t.Errorf("expected attributes of the path, got %+v", m)
+		}
+	}
+}
+
+func TestShadowEvaluationSampling(t *testing.T) {
+	reviewer := &fakeSubjectAccessReviewer{}
+	// no workers, queued decisions stay queued
+	shadow := newShadowEvaluator(reviewer.create, 0.5, 1, 1)
+
+	values := []float64{0.1, 0.7, 0.2, 0.4}
+	shadow.random = func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}
+
+	dropped := shadowCount(t, shadowDropped, "allow")
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, Verb: "get", Path: "/healthz"}
+
+	// 0.7 isn't sampled, the first sampled decision fills the queue and the others are dropped
+	for i := 0; i < 4; i++ {
+		shadow.submit(attrs, true)
+	}
+
+	if d := shadowCount(t, shadowDropped, "allow") - dropped; d != 2 {
+		t.Errorf("expected 2 dropped decisions, got %v", d)
+	}
+
+	if len(shadow.queue) != 1 {
+		t.Errorf("expected 1 queued decision, got %d", len(shadow.queue))
+	}
+}
+
+func TestShadowEvaluationKeepsDecision(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "reader"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	reviewer := &fakeSubjectAccessReviewer{}
+	shadow := newShadowEvaluator(reviewer.create, 1, 10, 10)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	shadow.start(1, stopCh)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: next, shadow: shadow}
+
+	// the API server denies, the decision of the gateway stands
+	status, err := auth.ServeHTTP(httptest.NewRecorder(), newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/secrets/token", &user.DefaultInfo{Name: "alice"}))
+
+	if err != nil || status != http.StatusOK {
+		t.Errorf("expected permitted, got %d %v", status, err)
+	}
+
+	shadow.flush()
+
+	if list := shadow.list(); len(list) != 1 || !list[0].Local || list[0].Remote {
+		t.Errorf("expected mismatch recorded, got %+v", list)
+	}
+}
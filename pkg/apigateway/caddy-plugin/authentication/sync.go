@@ -0,0 +1,99 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// the clients retry after this many seconds while the caches sync
+	cacheSyncRetryAfter = 1
+	// the sync of the caches is checked this often until they have synced, for the metrics
+	cacheSyncPeriod = time.Second
+)
+
+// cacheSync tells whether the RBAC informer caches have synced. The caches are empty until then, every
+// decision would be a denial.
+type cacheSync struct {
+	mu sync.RWMutex
+	// the informers are created on startup, before the servers are started. The caches aren't waited
+	// for until then, like with the informers installed by the tests.
+	hasSynced []cache.InformerSynced
+	// once synced the caches stay synced, the informers aren't asked anymore
+	synced bool
+}
+
+// track sets the informers the decisions wait for
+func (s *cacheSync) track(hasSynced ...cache.InformerSynced) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hasSynced = hasSynced
+	rbacCacheSynced.Set(0)
+}
+
+// wait checks the sync of the caches until they have synced or stopCh is closed, the requests don't
+// tell the metrics otherwise
+func (s *cacheSync) wait(stopCh <-chan struct{}) {
+	wait.PollImmediateUntil(cacheSyncPeriod, func() (bool, error) {
+		return s.ready(), nil
+	}, stopCh)
+}
+
+// ready reports whether all the tracked informers have synced
+func (s *cacheSync) ready() bool {
+	s.mu.RLock()
+	synced, hasSynced := s.synced, s.hasSynced
+	s.mu.RUnlock()
+
+	if synced || len(hasSynced) == 0 {
+		return true
+	}
+
+	for _, f := range hasSynced {
+		if !f() {
+			return false
+		}
+	}
+
+	s.mu.Lock()
+	s.synced = true
+	s.mu.Unlock()
+
+	rbacCacheSynced.Set(1)
+
+	return true
+}
+
+// syncing answers 503 with Retry-After, the denials of empty caches aren't the decisions of the roles
+func syncing(w http.ResponseWriter, r *http.Request) int {
+	w.Header().Set("Retry-After", strconv.Itoa(cacheSyncRetryAfter))
+
+	unavailable := k8serr.NewServiceUnavailable("the RBAC caches are syncing, retry later")
+	unavailable.ErrStatus.Details = &metav1.StatusDetails{RetryAfterSeconds: cacheSyncRetryAfter}
+
+	return deny(w, r, ReasonCacheSyncing, unavailable)
+}
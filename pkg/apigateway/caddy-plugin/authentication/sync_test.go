@@ -0,0 +1,229 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCacheSync(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	// the role bindings sync last, the informers are asked until all of them have synced
+	var bindingsSynced, asked int32
+	synced := func() bool { return true }
+	bindings := func() bool {
+		atomic.AddInt32(&asked, 1)
+		return atomic.LoadInt32(&bindingsSynced) == 1
+	}
+
+	caches := &cacheSync{}
+	auth := Authentication{Rule: Rule{Path: "/"}, caches: caches, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})}
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, path, &user.DefaultInfo{Name: "alice"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != 0 {
+			recorder.Code = status
+		}
+		return recorder
+	}
+
+	// the caches aren't waited for until tracked, which doesn't make them synced
+	if recorder := serve("/api/v1/namespaces/demo/pods/web"); recorder.Code != http.StatusOK {
+		t.Fatalf("expected alice allowed before the caches are tracked, got %d", recorder.Code)
+	}
+
+	caches.track(synced, bindings, synced, synced)
+	memberships := newMembershipCache()
+	auth.memberships = memberships
+
+	recorder := serve("/api/v1/namespaces/demo/pods/web")
+
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 503 with Retry-After while the caches sync, got %d %q", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+
+	// the workspaces aren't resolved on the empty caches either
+	if _, cached := memberships.memberships["alice"]; cached {
+		t.Error("expected no memberships resolved while the caches sync")
+	}
+
+	var status metav1.Status
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Reason != metav1.StatusReasonServiceUnavailable || status.Details == nil || status.Details.RetryAfterSeconds != 1 || status.Details.Causes[0].Type != ReasonCacheSyncing {
+		t.Errorf("expected a %s Status, got %+v", ReasonCacheSyncing, status)
+	}
+
+	atomic.StoreInt32(&bindingsSynced, 1)
+
+	if recorder := serve("/api/v1/namespaces/demo/pods/web"); recorder.Code != http.StatusOK {
+		t.Errorf("expected alice allowed once the caches synced, got %d", recorder.Code)
+	}
+	if recorder := serve("/api/v1/namespaces/demo/secrets/web"); recorder.Code != http.StatusForbidden {
+		t.Errorf("expected the decisions of the roles once the caches synced, got %d", recorder.Code)
+	}
+
+	if asked := atomic.LoadInt32(&asked); asked != 2 {
+		t.Errorf("expected the informers not asked anymore once synced, asked %d times", asked)
+	}
+}
+
+func TestRBACWiringReload(t *testing.T) {
+	stopCh := make(chan struct{})
+
+	server := fakeRBACServer("1", stopCh)
+	defer server.Close()
+	defer close(stopCh)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := k8sinformers.NewSharedInformerFactory(client, 0)
+	// the informers run until the test ends, the signal handler can't be set up twice
+	informers := &rbacInformers{stopChan: stopCh}
+
+	// two blocks, the first one enables the subject resolver
+	first, second := newRBACWiring(informers), newRBACWiring(informers)
+
+	// the middlewares are built before the startup, their listers see the indexes
+	if err := first.wire(factory, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.wire(factory, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if listers := NewEvaluator(factory).Listers(); listers.RoleBindingSubjects == nil || listers.ClusterRoleBindingSubjects == nil || listers.ClusterRoleWildcards == nil {
+		t.Errorf("expected the indexes registered before the startup, got %+v", listers)
+	}
+
+	if first.resolver == nil || second.resolver != nil {
+		t.Fatalf("expected the subject resolver of the first block only, got %v %v", first.resolver, second.resolver)
+	}
+
+	for _, wiring := range []*rbacWiring{first, second} {
+		if err := wiring.start(factory); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) { return first.resolver.ready(), nil }); err != nil {
+		t.Fatal("expected the subject resolver synced")
+	}
+
+	// a reload wires its own subject resolver, the builds don't register the indexes on the started
+	// informers again
+	reloaded := newRBACWiring(informers)
+
+	if err := reloaded.wire(factory, true); err != nil {
+		t.Fatalf("unexpected error wiring the started informers %v", err)
+	}
+	if err := reloaded.start(factory); err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded.resolver == nil || reloaded.resolver == first.resolver {
+		t.Fatal("expected the reload to build its own subject resolver")
+	}
+
+	// the requests decide while the instance reloaded stops, it's checked by the race detector
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, Verb: "get", Namespace: "demo", Resource: "pods", ResourceRequest: true}
+	authz := newAuthorizer(Rule{}, NewEvaluator(factory).Listers(), first.resolver)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			authz.Authorize(context.Background(), attrs)
+		}
+	}()
+
+	first.stop()
+	<-done
+
+	// the stopped resolver releases its state, the one of the reload decides
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) { return !first.resolver.ready(), nil }); err != nil {
+		t.Fatal("expected the stopped subject resolver released")
+	}
+	if len(first.resolver.state.bindings) != 0 {
+		t.Errorf("expected the state of the stopped subject resolver released, got %+v", first.resolver.state.bindings)
+	}
+
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) { return reloaded.resolver.ready(), nil }); err != nil {
+		t.Fatal("expected the subject resolver of the reload synced")
+	}
+}
+
+// handlersInformer keeps the event handlers added to it
+type handlersInformer struct {
+	cache.SharedIndexInformer
+	handlers []cache.ResourceEventHandler
+}
+
+func (i *handlersInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	i.handlers = append(i.handlers, handler)
+}
+
+func TestStoppableInformer(t *testing.T) {
+	informer := &handlersInformer{}
+	stopCh := make(chan struct{})
+
+	var added int
+	stoppableInformer{informer, stopCh}.AddEventHandler(cache.ResourceEventHandlerFuncs{AddFunc: func(interface{}) { added++ }})
+
+	binding := &v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "viewer"}}
+
+	informer.handlers[0].OnAdd(binding)
+	close(stopCh)
+	informer.handlers[0].OnAdd(binding)
+
+	if added != 1 {
+		t.Errorf("expected the events ignored once stopped, handled %d", added)
+	}
+}
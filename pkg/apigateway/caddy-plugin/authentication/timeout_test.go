@@ -0,0 +1,199 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	rbaclisters "k8s.io/client-go/listers/rbac/v1"
+)
+
+// cancelingClusterRoles cancels the evaluation on the get of a cluster role after the given count
+type cancelingClusterRoles struct {
+	rbaclisters.ClusterRoleLister
+	cancel context.CancelFunc
+	after  int32
+	gets   int32
+}
+
+func (l *cancelingClusterRoles) Get(name string) (*v1.ClusterRole, error) {
+	if atomic.AddInt32(&l.gets, 1) == l.after {
+		l.cancel()
+	}
+	return l.ClusterRoleLister.Get(name)
+}
+
+// boundInNamespace is distinctBindings granting the cluster roles in the namespace demo only
+func boundInNamespace(count int) []k8sruntime.Object {
+	objects := make([]k8sruntime.Object, 0, 2*count)
+
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("role-%d", i)
+		objects = append(objects,
+			&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}, Rules: []v1.PolicyRule{
+				{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{fmt.Sprintf("resource-%d", i)}},
+			}},
+			&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: name}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		)
+	}
+
+	return objects
+}
+
+func TestAuthorizationCanceled(t *testing.T) {
+	const after = 10
+
+	tests := []struct {
+		name    string
+		objects []k8sruntime.Object
+		// the gets in flight in other workers when the evaluation is canceled
+		inFlight int32
+	}{
+		{name: "cluster role bindings", objects: distinctBindings(100)},
+		{name: "concurrent cluster role bindings", objects: distinctBindings(3 * concurrentBindings), inFlight: int32(runtime.GOMAXPROCS(0))},
+		{name: "role bindings", objects: boundInNamespace(100)},
+	}
+
+	// denied by every binding, all of them would be evaluated
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "get", Namespace: "demo", Resource: "secrets"}
+
+	for _, test := range tests {
+		setupRBAC(t, test.objects...)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		clusterRoles := &cancelingClusterRoles{ClusterRoleLister: sharedListers().ClusterRoles, cancel: cancel, after: after}
+		listers := sharedListers()
+		listers.ClusterRoles = clusterRoles
+
+		permitted, version, err := AuthorizeContext(ctx, listers, attrs)
+		cancel()
+
+		if permitted || version != "" || !errors.Is(err, ErrAuthorizationTimeout) {
+			t.Errorf("%s: expected the evaluation given up, got %v %q %v", test.name, permitted, version, err)
+		}
+
+		if gets := atomic.LoadInt32(&clusterRoles.gets); gets > after+test.inFlight {
+			t.Errorf("%s: expected the evaluation stopped after %d gets, got %d", test.name, after, gets)
+		}
+
+		// the same listers decide without the cancellation
+		ctx, cancel = context.WithCancel(context.Background())
+		clusterRoles.cancel, clusterRoles.gets = cancel, 0
+
+		if permitted, _, err := AuthorizeContext(context.Background(), listers, attrs); permitted || err != nil {
+			t.Errorf("%s: expected denied, got %v %v", test.name, permitted, err)
+		}
+		cancel()
+
+		if ctx.Err() == nil {
+			t.Fatalf("%s: expected the evaluation past %d gets", test.name, after)
+		}
+	}
+}
+
+func TestAuthorizationTimeout(t *testing.T) {
+	// an evaluation never done before its deadline
+	hanging := authorizerFunc(func(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		<-ctx.Done()
+		return false, "", evaluationAborted(ctx)
+	})
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/", AuthorizationTimeout: 10 * time.Millisecond}, Next: next, Authorizer: hanging, decisions: newDecisionCache(time.Minute, 10, time.Minute, 10)}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		start := time.Now()
+
+		if status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods", alice)); status != 0 || err != nil {
+			t.Fatalf("expected the response written, got %d %v", status, err)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the evaluation given up after 10ms, took %s", elapsed)
+		}
+
+		// neither permitted nor denied, and not kept by the decision cache
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: expected 503, got %d", i, recorder.Code)
+		}
+
+		var status metav1.Status
+
+		if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Reason != metav1.StatusReasonServiceUnavailable || status.Details == nil ||
+			len(status.Details.Causes) != 1 || status.Details.Causes[0].Type != ReasonAuthorizationTimeout {
+			t.Errorf("expected an authorization timeout Status, got %+v", status)
+		}
+	}
+}
+
+func TestImpersonationTimeout(t *testing.T) {
+	// the impersonation checks never done before their deadline
+	hanging := authorizerFunc(func(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+		<-ctx.Done()
+		return false, "", evaluationAborted(ctx)
+	})
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/", AuthorizationTimeout: 10 * time.Millisecond}, Next: next, Authorizer: hanging}
+
+	r := newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods", &user.DefaultInfo{Name: "admin"})
+	r.Header.Set("Impersonate-User", "alice")
+	recorder := httptest.NewRecorder()
+
+	if status, err := auth.ServeHTTP(recorder, r); status != 0 || err != nil {
+		t.Fatalf("expected the response written, got %d %v", status, err)
+	}
+
+	var status metav1.Status
+
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusServiceUnavailable || status.Details == nil ||
+		len(status.Details.Causes) != 1 || status.Details.Causes[0].Type != ReasonAuthorizationTimeout {
+		t.Errorf("expected an authorization timeout Status, got %d %+v", recorder.Code, status)
+	}
+}
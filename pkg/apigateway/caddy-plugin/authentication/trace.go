@@ -0,0 +1,124 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"k8s.io/api/rbac/v1"
+)
+
+const (
+	// matchedHeader names the binding, role and rule permitting a request when the matches are debugged
+	matchedHeader = "X-Authz-Matched"
+	// evaluatedBindingsHeader is the count of bindings evaluated for a denial when the matches are
+	// debugged
+	evaluatedBindingsHeader = "X-Authz-Evaluated-Bindings"
+)
+
+type decisionTraceKey struct{}
+
+// decisionTrace records how the roles decided a request. A nil trace records nothing. Nothing is
+// recorded for the decisions of the decision cache, or of other authorizers than RBAC.
+type decisionTrace struct {
+	// the roles were evaluated
+	recorded bool
+	// the bindings evaluated
+	evaluated int
+	// the binding permitting the request, its role and the index of the rule of the role, of the
+	// rules of the roles it aggregates in order for an aggregated cluster role
+	binding string
+	role    string
+	rule    int
+}
+
+func withDecisionTrace(ctx context.Context, trace *decisionTrace) context.Context {
+	return context.WithValue(ctx, decisionTraceKey{}, trace)
+}
+
+func decisionTraceFrom(ctx context.Context) *decisionTrace {
+	trace, _ := ctx.Value(decisionTraceKey{}).(*decisionTrace)
+	return trace
+}
+
+func (t *decisionTrace) record() {
+	if t != nil {
+		t.recorded = true
+	}
+}
+
+func (t *decisionTrace) evaluate() {
+	if t != nil {
+		t.evaluated++
+	}
+}
+
+// match records the binding of namespace, empty for a cluster role binding, whose rule of its role
+// permits the request
+func (t *decisionTrace) match(namespace, name string, roleRef v1.RoleRef, rule int) {
+	if t == nil {
+		return
+	}
+	if namespace == "" {
+		t.binding = path.Join("ClusterRoleBinding", name)
+	} else {
+		t.binding = path.Join("RoleBinding", namespace, name)
+	}
+	if roleRef.Kind == "Role" {
+		t.role = path.Join(roleRef.Kind, namespace, roleRef.Name)
+	} else {
+		t.role = path.Join(roleRef.Kind, roleRef.Name)
+	}
+	t.rule = rule
+}
+
+// merge adds the evaluations of other and keeps its match if it has one
+func (t *decisionTrace) merge(other decisionTrace) {
+	if t == nil {
+		return
+	}
+	t.evaluated += other.evaluated
+	if other.binding != "" {
+		t.binding, t.role, t.rule = other.binding, other.role, other.rule
+	}
+}
+
+// matched returns the value of the matchedHeader, like binding="ClusterRoleBinding/viewer",
+// role="ClusterRole/viewer", rule=0, empty if no binding was matched
+func (t *decisionTrace) matched() string {
+	if t.binding == "" {
+		return ""
+	}
+	return fmt.Sprintf("binding=%q, role=%q, rule=%d", t.binding, t.role, t.rule)
+}
+
+// setHeaders sets the headers of a recorded trace on the response to a decision
+func (t *decisionTrace) setHeaders(header http.Header, permitted bool) {
+	if t == nil || !t.recorded {
+		return
+	}
+	if !permitted {
+		header.Set(evaluatedBindingsHeader, strconv.Itoa(t.evaluated))
+	} else if matched := t.matched(); matched != "" {
+		header.Set(matchedHeader, matched)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestDebugMatches(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"list"}, APIGroups: []string{""}, Resources: []string{"secrets"}},
+			{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor"}, Rules: []v1.PolicyRule{{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "editor"}, RoleRef: v1.RoleRef{Kind: "Role", Name: "editor"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "secrets"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin"}, Rules: []v1.PolicyRule{
+			{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+		}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admins"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "admin"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	tests := []struct {
+		method    string
+		path      string
+		user      string
+		matched   string
+		evaluated string
+	}{
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/web", user: "alice", matched: `binding="ClusterRoleBinding/viewer", role="ClusterRole/viewer", rule=1`},
+		{method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "alice", matched: `binding="RoleBinding/demo/editor", role="Role/demo/editor", rule=0`},
+		{method: http.MethodGet, path: "/api/v1/namespaces/demo/secrets", user: "bob", matched: `binding="RoleBinding/demo/secrets", role="ClusterRole/viewer", rule=0`},
+		{method: http.MethodDelete, path: "/apis/apps/v1/namespaces/demo/deployments/web", user: "admin", matched: `binding="ClusterRoleBinding/admins", role="ClusterRole/cluster-admin", rule=0`},
+		{method: http.MethodPost, path: "/apis/apps/v1/namespaces/demo/deployments", user: "alice", evaluated: "2"},
+		{method: http.MethodGet, path: "/api/v1/namespaces/other/secrets", user: "bob", evaluated: "0"},
+	}
+
+	resolver := newSubjectResolver(sharedListers())
+	resolver.resync()
+
+	for _, resolved := range []bool{false, true} {
+		authz := defaultAuthorizer
+		if resolved {
+			authz = newAuthorizer(Rule{}, Listers{}, resolver)
+		}
+
+		for _, debug := range []bool{false, true} {
+			auth := Authentication{Rule: Rule{Path: "/", DebugMatches: debug}, Next: next, Authorizer: authz}
+
+			for _, test := range tests {
+				recorder := httptest.NewRecorder()
+
+				if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: test.user})); err != nil {
+					t.Fatal(err)
+				}
+
+				matched, evaluated := test.matched, test.evaluated
+				// the RBAC topology isn't exposed unless debugging
+				if !debug {
+					matched, evaluated = "", ""
+				}
+
+				if got := recorder.Header().Get(matchedHeader); got != matched {
+					t.Errorf("%s %s of %s, resolved %v, debug %v: expected matched %q, got %q", test.method, test.path, test.user, resolved, debug, matched, got)
+				}
+
+				if got := recorder.Header().Get(evaluatedBindingsHeader); got != evaluated {
+					t.Errorf("%s %s of %s, resolved %v, debug %v: expected %q bindings evaluated, got %q", test.method, test.path, test.user, resolved, debug, evaluated, got)
+				}
+			}
+		}
+	}
+}
+
+func TestDebugMatchesCached(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, Rules: []v1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "viewer"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})
+
+	auth := Authentication{Rule: Rule{Path: "/", DebugMatches: true}, Next: next, decisions: newDecisionCache(time.Minute, 10, time.Minute, 10)}
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	// the kept decisions weren't evaluated, nothing is claimed about them
+	for i, expected := range []string{`binding="ClusterRoleBinding/viewer", role="ClusterRole/viewer", rule=0`, ""} {
+		recorder := httptest.NewRecorder()
+
+		if status, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodGet, "/api/v1/namespaces/demo/pods/web", alice)); status != http.StatusOK || err != nil {
+			t.Fatalf("expected permitted, got %d %v", status, err)
+		}
+
+		if got := recorder.Header().Get(matchedHeader); got != expected {
+			t.Errorf("request %d: expected matched %q, got %q", i, expected, got)
+		}
+	}
+
+	for i, expected := range []string{"1", ""} {
+		recorder := httptest.NewRecorder()
+
+		if _, err := auth.ServeHTTP(recorder, newAuthorizedRequest(t, http.MethodDelete, "/api/v1/namespaces/demo/pods/web", alice)); err != nil || recorder.Code != http.StatusForbidden {
+			t.Fatalf("expected forbidden, got %d %v", recorder.Code, err)
+		}
+
+		if got := recorder.Header().Get(evaluatedBindingsHeader); got != expected {
+			t.Errorf("denial %d: expected %q bindings evaluated, got %q", i, expected, got)
+		}
+	}
+}
+
+func TestDebugMatchesConcurrent(t *testing.T) {
+	count := 3 * concurrentBindings
+	setupRBAC(t, distinctBindings(count)...)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	for _, i := range []int{0, count / 2, count - 1} {
+		trace := &decisionTrace{}
+		attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: fmt.Sprintf("resource-%d", i)}
+
+		if permitted, err := clusterRoleValidate(withDecisionTrace(context.Background(), trace), sharedListers(), attrs, "", nil); !permitted || err != nil {
+			t.Fatalf("expected permitted, got %v %v", permitted, err)
+		}
+
+		// the binding found, whichever worker found it
+		expected := fmt.Sprintf(`binding="ClusterRoleBinding/role-%d", role="ClusterRole/role-%d", rule=0`, i, i)
+
+		if trace.matched() != expected || trace.evaluated < 1 || trace.evaluated > count {
+			t.Errorf("get resource-%d: expected %s, got %s after %d bindings", i, expected, trace.matched(), trace.evaluated)
+		}
+	}
+
+	trace := &decisionTrace{}
+	attrs := &authorizer.AttributesRecord{User: alice, ResourceRequest: true, Verb: "get", Resource: "secrets"}
+
+	if permitted, err := clusterRoleValidate(withDecisionTrace(context.Background(), trace), sharedListers(), attrs, "", nil); permitted || err != nil {
+		t.Fatalf("expected denied, got %v %v", permitted, err)
+	}
+
+	if trace.matched() != "" || trace.evaluated != count {
+		t.Errorf("expected every binding evaluated for the denial, got %d %q", trace.evaluated, trace.matched())
+	}
+}
@@ -0,0 +1,148 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// AuthorizerRBAC is the name of the authorizer deciding on the roles bound to the user, the default
+// chain
+const AuthorizerRBAC = "rbac"
+
+// authorizerConstructors are the constructors of the authorizers named in the chains, they are given
+// the RBAC listers of the gateway
+var authorizerConstructors = map[string]func(listers Listers) Authorizer{
+	AuthorizerRBAC: NewRBACAuthorizer,
+}
+
+// RegisterAuthorizer registers the constructor of the authorizer the chains name name, it must be
+// called before the Caddyfile is parsed, from an init function. It panics if name is registered.
+func RegisterAuthorizer(name string, newAuthorizer func(listers Listers) Authorizer) {
+	if _, ok := authorizerConstructors[name]; ok {
+		panic(fmt.Sprintf("authorizer %s already registered", name))
+	}
+	authorizerConstructors[name] = newAuthorizer
+}
+
+// registeredAuthorizers returns the sorted names of the registered and configured authorizers
+func registeredAuthorizers() []string {
+	names := make([]string, 0, len(authorizerConstructors)+1)
+	for name := range authorizerConstructors {
+		names = append(names, name)
+	}
+	names = append(names, AuthorizerExternal)
+	sort.Strings(names)
+	return names
+}
+
+// knownAuthorizer reports whether a chain may name name
+func knownAuthorizer(name string) bool {
+	_, ok := authorizerConstructors[name]
+	return ok || name == AuthorizerExternal
+}
+
+// namedAuthorizer is a member of a chain
+type namedAuthorizer struct {
+	name string
+	Authorizer
+}
+
+// unionAuthorizer permits a request as soon as one of its authorizers permits it, in order. It denies
+// the request if all of them deny it, an empty union denies everything. The first error is returned,
+// the following authorizers aren't consulted. The version of a denial is the first non-empty one.
+type unionAuthorizer struct {
+	authorizers []namedAuthorizer
+	// log the decision and latency of each authorizer
+	debug bool
+	// the logs name the user
+	withUser bool
+}
+
+func (u *unionAuthorizer) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	denialVersion := ""
+
+	for _, a := range u.authorizers {
+		start := time.Now()
+		permitted, version, err := a.Authorize(ctx, attrs)
+
+		if u.debug {
+			log.Printf("[DEBUG] authentication: authorizer %s on %s: %s in %s", a.name, deniedPermissionFields(attrs, u.withUser), describeDecision(permitted, err), time.Since(start))
+		}
+
+		if err != nil {
+			return false, "", fmt.Errorf("authorizer %s: %w", a.name, err)
+		}
+
+		if permitted {
+			return true, version, nil
+		}
+
+		if denialVersion == "" {
+			denialVersion = version
+		}
+	}
+
+	return false, denialVersion, nil
+}
+
+// describeDecision returns the decision of an authorizer for the logs
+func describeDecision(permitted bool, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("failed: %v", err)
+	case permitted:
+		return "permitted"
+	default:
+		return "denied"
+	}
+}
+
+// newAuthorizer returns the authorizer of rule, the RBAC one on listers if rule names none. The names
+// are the known ones, they are checked when the Caddyfile is parsed. The RBAC authorizer decides on
+// resolver once it synced if it isn't nil.
+func newAuthorizer(rule Rule, listers Listers, resolver *subjectResolver) Authorizer {
+	rbac := &rbacAuthorizer{listers: listers, resolver: resolver}
+
+	if len(rule.Authorizers) == 0 {
+		return rbac
+	}
+
+	union := &unionAuthorizer{authorizers: make([]namedAuthorizer, 0, len(rule.Authorizers)), debug: rule.DebugAuthorizers, withUser: !rule.HideDeniedUser}
+
+	for _, name := range rule.Authorizers {
+		var a Authorizer
+		switch name {
+		case AuthorizerExternal:
+			a = newExternalAuthorizer(rule.ExternalAuthorizerURL, rule.ExternalAuthorizerTimeout, rule.ExternalAuthorizerFailOpen)
+		case AuthorizerRBAC:
+			a = rbac
+		default:
+			a = authorizerConstructors[name](listers)
+		}
+		union.authorizers = append(union.authorizers, namedAuthorizer{name: name, Authorizer: a})
+	}
+
+	return union
+}
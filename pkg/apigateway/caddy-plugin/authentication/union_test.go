@@ -0,0 +1,202 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// recordingAuthorizer returns its decision and records its name in calls
+type recordingAuthorizer struct {
+	name      string
+	permitted bool
+	version   string
+	err       error
+	calls     *[]string
+}
+
+func (a recordingAuthorizer) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	*a.calls = append(*a.calls, a.name)
+	return a.permitted, a.version, a.err
+}
+
+// authorizerFunc decides with a function
+type authorizerFunc func(ctx context.Context, attrs authorizer.Attributes) (bool, string, error)
+
+func (f authorizerFunc) Authorize(ctx context.Context, attrs authorizer.Attributes) (bool, string, error) {
+	return f(ctx, attrs)
+}
+
+func TestUnionAuthorizer(t *testing.T) {
+	failure := errors.New("webhook unreachable")
+
+	type member struct {
+		name      string
+		permitted bool
+		version   string
+		err       error
+	}
+
+	tests := []struct {
+		name      string
+		members   []member
+		permitted bool
+		version   string
+		err       error
+		calls     []string
+	}{
+		{
+			name:      "first permitting",
+			members:   []member{{name: "rbac", version: "7"}, {name: "owner", permitted: true, version: "owner-1"}, {name: "webhook", permitted: true}},
+			permitted: true,
+			version:   "owner-1",
+			calls:     []string{"rbac", "owner"},
+		},
+		{
+			name:      "first member permitting",
+			members:   []member{{name: "rbac", permitted: true, version: "7"}, {name: "owner", err: failure}},
+			permitted: true,
+			version:   "7",
+			calls:     []string{"rbac"},
+		},
+		{
+			name:    "all denying",
+			members: []member{{name: "rbac"}, {name: "owner", version: "owner-1"}, {name: "webhook", version: "webhook-1"}},
+			version: "owner-1",
+			calls:   []string{"rbac", "owner", "webhook"},
+		},
+		{
+			name:    "failing before a permission",
+			members: []member{{name: "rbac"}, {name: "webhook", err: failure}, {name: "owner", permitted: true}},
+			err:     failure,
+			calls:   []string{"rbac", "webhook"},
+		},
+		{
+			name:    "empty",
+			members: nil,
+			calls:   []string{},
+		},
+	}
+
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "get", Namespace: "demo", Resource: "pods"}
+
+	for _, test := range tests {
+		calls := []string{}
+		union := &unionAuthorizer{}
+		for _, m := range test.members {
+			union.authorizers = append(union.authorizers, namedAuthorizer{name: m.name, Authorizer: recordingAuthorizer{name: m.name, permitted: m.permitted, version: m.version, err: m.err, calls: &calls}})
+		}
+
+		permitted, version, err := union.Authorize(context.Background(), attrs)
+
+		if permitted != test.permitted || version != test.version || !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("%s: expected %v %q %v, got %v %q %v", test.name, test.permitted, test.version, test.err, permitted, version, err)
+		}
+
+		if fmt.Sprint(calls) != fmt.Sprint(test.calls) {
+			t.Errorf("%s: expected %v consulted, got %v", test.name, test.calls, calls)
+		}
+	}
+}
+
+func TestUnionAuthorizerDebugLogs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	calls := []string{}
+	union := &unionAuthorizer{debug: true, withUser: true, authorizers: []namedAuthorizer{
+		{name: "rbac", Authorizer: recordingAuthorizer{name: "rbac", calls: &calls}},
+		{name: "owner", Authorizer: recordingAuthorizer{name: "owner", permitted: true, calls: &calls}},
+	}}
+
+	attrs := &authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "alice"}, ResourceRequest: true, Verb: "get", Namespace: "demo", Resource: "pods"}
+
+	if permitted, _, err := union.Authorize(context.Background(), attrs); !permitted || err != nil {
+		t.Fatalf("expected permitted, got %v %v", permitted, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per authorizer consulted, got %q", logs.String())
+	}
+
+	for i, expected := range []string{"authorizer rbac on", "authorizer owner on"} {
+		decision := "denied in"
+		if i == 1 {
+			decision = "permitted in"
+		}
+		if !strings.Contains(lines[i], "[DEBUG]") || !strings.Contains(lines[i], expected) || !strings.Contains(lines[i], `user="alice"`) || !strings.Contains(lines[i], decision) {
+			t.Errorf("expected %q %s, got %q", expected, decision, lines[i])
+		}
+	}
+
+	// the user is left out if hidden
+	logs.Reset()
+	union.withUser = false
+
+	if _, _, err := union.Authorize(context.Background(), attrs); err != nil || logs.Len() == 0 || strings.Contains(logs.String(), "alice") {
+		t.Errorf("expected the logs without the user, got %q %v", logs.String(), err)
+	}
+
+	// silent unless debugging
+	logs.Reset()
+	union.debug = false
+
+	if _, _, err := union.Authorize(context.Background(), attrs); err != nil || logs.Len() != 0 {
+		t.Errorf("expected no log, got %q %v", logs.String(), err)
+	}
+}
+
+func TestNewAuthorizer(t *testing.T) {
+	if _, ok := newAuthorizer(Rule{}, Listers{}, nil).(*rbacAuthorizer); !ok {
+		t.Error("expected the RBAC authorizer alone by default")
+	}
+
+	union, ok := newAuthorizer(Rule{Authorizers: []string{AuthorizerRBAC, AuthorizerRBAC}, DebugAuthorizers: true}, Listers{}, nil).(*unionAuthorizer)
+
+	if !ok || len(union.authorizers) != 2 || union.authorizers[1].name != AuthorizerRBAC || !union.debug || !union.withUser {
+		t.Errorf("expected a debugged chain of the named authorizers, got %+v", union)
+	}
+
+	// the debug endpoint doesn't log the decisions, the hidden user isn't logged
+	union, ok = newAuthorizer(Rule{Authorizers: []string{AuthorizerRBAC}, DebugPath: "/debug", HideDeniedUser: true}, Listers{}, nil).(*unionAuthorizer)
+
+	if !ok || union.debug || union.withUser {
+		t.Errorf("expected a silent chain without the user, got %+v", union)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering rbac again panics")
+		}
+	}()
+
+	RegisterAuthorizer(AuthorizerRBAC, NewRBACAuthorizer)
+}
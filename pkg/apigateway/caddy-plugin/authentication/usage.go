@@ -0,0 +1,249 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"kubesphere.io/kubesphere/pkg/utils"
+)
+
+const (
+	// a week of hourly buckets
+	usageBuckets = 7 * 24
+	// keys of a bucket, requests of further keys are only counted as dropped
+	maxUsageKeys    = 10000
+	usageAllowed    = "allowed"
+	usageDenied     = "denied"
+	usageFormatJSON = "json"
+	usageFormatCSV  = "csv"
+)
+
+// usageKey is what is counted, resource is the path of non-resource requests
+type usageKey struct {
+	apiGroup string
+	resource string
+	verb     string
+	decision string
+}
+
+type usageBucket struct {
+	start   time.Time
+	counts  map[usageKey]int64
+	dropped int64
+}
+
+// UsageRecord is the count of requests of a verb on a resource in an hour
+type UsageRecord struct {
+	Hour     time.Time `json:"hour"`
+	APIGroup string    `json:"apiGroup"`
+	// with its subresource, or the path of a non-resource request
+	Resource string `json:"resource"`
+	Verb     string `json:"verb"`
+	Decision string `json:"decision"`
+	Count    int64  `json:"count"`
+}
+
+// usageCollector counts the decisions of the gateway by resource and verb in hourly buckets, the
+// oldest buckets are dropped. It tells the resources and verbs still in use before their deprecation.
+type usageCollector struct {
+	size int
+	now  func() time.Time
+
+	mutex sync.Mutex
+	// the oldest first
+	buckets []*usageBucket
+}
+
+func newUsageCollector(size int) *usageCollector {
+	return &usageCollector{size: size, now: time.Now, buckets: make([]*usageBucket, 0, size)}
+}
+
+// observe counts a decision
+func (c *usageCollector) observe(attrs authorizer.Attributes, allowed bool) {
+	key := usageKey{apiGroup: attrs.GetAPIGroup(), resource: attrs.GetResource(), verb: attrs.GetVerb(), decision: usageDenied}
+
+	if attrs.GetSubresource() != "" {
+		key.resource = key.resource + "/" + attrs.GetSubresource()
+	}
+
+	if !attrs.IsResourceRequest() {
+		key.resource = attrs.GetPath()
+	}
+
+	if allowed {
+		key.decision = usageAllowed
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	bucket := c.current()
+
+	if _, ok := bucket.counts[key]; !ok && len(bucket.counts) >= maxUsageKeys {
+		bucket.dropped++
+		return
+	}
+
+	bucket.counts[key]++
+}
+
+// current returns the bucket of this hour, it's added if missing
+func (c *usageCollector) current() *usageBucket {
+	start := c.now().UTC().Truncate(time.Hour)
+
+	if n := len(c.buckets); n > 0 && !c.buckets[n-1].start.Before(start) {
+		return c.buckets[n-1]
+	}
+
+	bucket := &usageBucket{start: start, counts: make(map[usageKey]int64)}
+
+	if len(c.buckets) >= c.size {
+		c.buckets = append(c.buckets[:0], c.buckets[len(c.buckets)-c.size+1:]...)
+	}
+	c.buckets = append(c.buckets, bucket)
+
+	return bucket
+}
+
+// export returns the counts of the last hours, including the current one, ordered by hour and key.
+// Requests dropped because a bucket was full are reported as a record without group, resource and verb.
+func (c *usageCollector) export(hours int) []UsageRecord {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	since := c.now().UTC().Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+	records := make([]UsageRecord, 0)
+
+	for _, bucket := range c.buckets {
+		if bucket.start.Before(since) {
+			continue
+		}
+
+		start := len(records)
+
+		for key, count := range bucket.counts {
+			records = append(records, UsageRecord{Hour: bucket.start, APIGroup: key.apiGroup, Resource: key.resource, Verb: key.verb, Decision: key.decision, Count: count})
+		}
+
+		hour := records[start:]
+		sort.Slice(hour, func(i, j int) bool {
+			a, b := hour[i], hour[j]
+			if a.APIGroup != b.APIGroup {
+				return a.APIGroup < b.APIGroup
+			}
+			if a.Resource != b.Resource {
+				return a.Resource < b.Resource
+			}
+			if a.Verb != b.Verb {
+				return a.Verb < b.Verb
+			}
+			return a.Decision < b.Decision
+		})
+
+		if bucket.dropped > 0 {
+			records = append(records, UsageRecord{Hour: bucket.start, Count: bucket.dropped})
+		}
+	}
+
+	return records
+}
+
+// reset drops every bucket
+func (c *usageCollector) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.buckets = make([]*usageBucket, 0, c.size)
+}
+
+// writeUsage writes records in format, json or csv, the hours of csv are rendered in timeFormat
+func writeUsage(w io.Writer, records []UsageRecord, format, timeFormat string, now time.Time) error {
+	switch format {
+	case usageFormatJSON:
+		return json.NewEncoder(w).Encode(records)
+	case usageFormatCSV:
+		out := csv.NewWriter(w)
+		if err := out.Write([]string{"hour", "apiGroup", "resource", "verb", "decision", "count"}); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := out.Write([]string{utils.FormatTime(record.Hour, timeFormat, now), record.APIGroup, record.Resource, record.Verb, record.Decision, strconv.FormatInt(record.Count, 10)}); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return out.Error()
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// ServeHTTP exports the counts of the last hours (24 by default) as json or csv, DELETE resets them.
+// The timeFormat parameter selects how csv renders the hours.
+func (c *usageCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method == http.MethodDelete {
+		c.reset()
+		w.WriteHeader(http.StatusNoContent)
+		return 0, nil
+	}
+
+	hours := 24
+	if value := r.URL.Query().Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > c.size {
+			return http.StatusBadRequest, fmt.Errorf("hours must be between 1 and %d, got %s", c.size, value)
+		}
+		hours = parsed
+	}
+
+	format := usageFormatJSON
+	if value := r.URL.Query().Get("format"); value != "" {
+		format = value
+	}
+
+	switch format {
+	case usageFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+	case usageFormatCSV:
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		return http.StatusBadRequest, fmt.Errorf("format must be %s or %s, got %s", usageFormatJSON, usageFormatCSV, format)
+	}
+
+	timeFormat, err := utils.ParseTimeFormat(r.URL.Query().Get(utils.TimeFormatParameter))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err := writeUsage(w, c.export(hours), format, timeFormat, c.now()); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,150 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageRollover(t *testing.T) {
+	collector := newUsageCollector(24)
+
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	collector.now = func() time.Time { return now }
+
+	list := (&fuzzRequest{ResourceRequest: true, Verb: "list", APIGroup: "apps", Resource: "deployments", Namespace: "demo"}).attributes()
+	logs := (&fuzzRequest{ResourceRequest: true, Verb: "get", Resource: "pods", Subresource: "log", Namespace: "demo"}).attributes()
+	healthz := (&fuzzRequest{Verb: "get", Path: "/healthz"}).attributes()
+
+	// a day and 6 hours of traffic, a request of each kind every 15 minutes
+	for ; now.Before(start.Add(30 * time.Hour)); now = now.Add(15 * time.Minute) {
+		collector.observe(list, true)
+		collector.observe(logs, false)
+		collector.observe(healthz, true)
+	}
+	now = now.Add(-15 * time.Minute)
+
+	if len(collector.buckets) != 24 {
+		t.Fatalf("expected the oldest buckets dropped, got %d", len(collector.buckets))
+	}
+
+	records := collector.export(24)
+
+	if len(records) != 24*3 {
+		t.Fatalf("expected 3 records an hour, got %d", len(records))
+	}
+
+	if first := records[0].Hour; !first.Equal(start.Add(6 * time.Hour)) {
+		t.Errorf("expected the first hour %s, got %s", start.Add(6*time.Hour), first)
+	}
+
+	expected := []UsageRecord{
+		{APIGroup: "", Resource: "/healthz", Verb: "get", Decision: usageAllowed, Count: 4},
+		{APIGroup: "", Resource: "pods/log", Verb: "get", Decision: usageDenied, Count: 4},
+		{APIGroup: "apps", Resource: "deployments", Verb: "list", Decision: usageAllowed, Count: 4},
+	}
+
+	for i, record := range records[len(records)-3:] {
+		record.Hour = time.Time{}
+		if record != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], record)
+		}
+	}
+
+	if records := collector.export(2); len(records) != 6 {
+		t.Errorf("expected the records of 2 hours, got %d", len(records))
+	}
+
+	collector.reset()
+
+	if records := collector.export(24); len(records) != 0 {
+		t.Errorf("expected no record after reset, got %d", len(records))
+	}
+}
+
+func TestUsageExport(t *testing.T) {
+	collector := newUsageCollector(usageBuckets)
+	now := time.Date(2019, 6, 1, 10, 30, 0, 0, time.UTC)
+	collector.now = func() time.Time { return now }
+
+	collector.observe((&fuzzRequest{ResourceRequest: true, Verb: "delete", APIGroup: "extensions", Resource: "ingresses"}).attributes(), true)
+
+	recorder := httptest.NewRecorder()
+	if _, err := collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/usage?format=csv&hours=1", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"hour", "apiGroup", "resource", "verb", "decision", "count"},
+		{"2019-06-01T10:00:00Z", "extensions", "ingresses", "delete", "allowed", "1"},
+	}
+
+	if len(rows) != len(expected) || strings.Join(rows[0], ",") != strings.Join(expected[0], ",") || strings.Join(rows[1], ",") != strings.Join(expected[1], ",") {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+
+	recorder = httptest.NewRecorder()
+	if _, err := collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/usage?format=csv&hours=1&timeFormat=humanAge", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if rows, err := csv.NewReader(recorder.Body).ReadAll(); err != nil || len(rows) != 2 || rows[1][0] != "30m" {
+		t.Errorf("expected the age of the hour 30m, got %v %v", rows, err)
+	}
+
+	recorder = httptest.NewRecorder()
+	if _, err := collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/usage", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []UsageRecord
+	if err := json.Unmarshal(recorder.Body.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 || records[0].Resource != "ingresses" || records[0].Count != 1 {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	for _, query := range []string{"/usage?format=xml", "/usage?timeFormat=age", "/usage?hours=0", "/usage?hours=1000"} {
+		if status, err := collector.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, query, nil)); status != http.StatusBadRequest || err == nil {
+			t.Errorf("%s: expected bad request, got %d %v", query, status, err)
+		}
+	}
+
+	if _, err := collector.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/usage", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := collector.export(1); len(records) != 0 {
+		t.Errorf("expected counts reset, got %+v", records)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// specialVerbs are the verbs checked besides the verb of a request on the resources they're
+// registered for, like kube-apiserver does: impersonate for the impersonation headers, bind and
+// escalate for the writes of RBAC objects, use for the pod security policies of the pods admitted.
+// The rules grant them like the other verbs, by name or by "*".
+var specialVerbs = map[string]map[schema.GroupResource]bool{}
+
+// specialVerbRequest is the group, resource, subresource and verb of the requests deciding on a
+// special verb rather than on their own verb
+type specialVerbRequest struct {
+	resource    schema.GroupResource
+	subresource string
+	verb        string
+}
+
+// specialVerbRequests maps the requests to the special verb they're decided on, see deriveSpecialVerb
+var specialVerbRequests = map[specialVerbRequest]string{}
+
+func init() {
+	registerSpecialVerb("impersonate", "", "users", "groups", "serviceaccounts")
+	registerSpecialVerb("impersonate", authenticationv1.GroupName, "userextras", "uids")
+	registerSpecialVerb("bind", v1.GroupName, "roles", "clusterroles")
+	registerSpecialVerb("escalate", v1.GroupName, "roles", "clusterroles")
+	registerSpecialVerb("use", "policy", "podsecuritypolicies")
+	registerSpecialVerb("use", "extensions", "podsecuritypolicies")
+	// the admission of a pod asks whether its user may use a policy, like the policy admission of
+	// kube-apiserver, by a create of the use subresource of the policy
+	registerSpecialVerbRequest("use", "policy", "podsecuritypolicies", "use", "create")
+	registerSpecialVerbRequest("use", "extensions", "podsecuritypolicies", "use", "create")
+}
+
+// registerSpecialVerb registers verb for resources of apiGroup
+func registerSpecialVerb(verb, apiGroup string, resources ...string) {
+	if specialVerbs[verb] == nil {
+		specialVerbs[verb] = make(map[schema.GroupResource]bool)
+	}
+	for _, resource := range resources {
+		specialVerbs[verb][schema.GroupResource{Group: apiGroup, Resource: resource}] = true
+	}
+}
+
+// registerSpecialVerbRequest decides the requests of verb on the subresource of resource of apiGroup
+// on specialVerb, which must be registered for the resource
+func registerSpecialVerbRequest(specialVerb, apiGroup, resource, subresource, verb string) {
+	groupResource := schema.GroupResource{Group: apiGroup, Resource: resource}
+
+	if !specialVerbs[specialVerb][groupResource] {
+		panic(fmt.Sprintf("special verb %s isn't registered for %s", specialVerb, groupResource))
+	}
+
+	specialVerbRequests[specialVerbRequest{resource: groupResource, subresource: subresource, verb: verb}] = specialVerb
+}
+
+// deriveSpecialVerb returns the attributes attrs are decided on, the special verb on the resource of
+// attrs if one is registered for the request, attrs otherwise. The subresource is dropped, the rules
+// grant the special verbs on the resources.
+func deriveSpecialVerb(attrs authorizer.Attributes) authorizer.Attributes {
+	if !attrs.IsResourceRequest() {
+		return attrs
+	}
+
+	request := specialVerbRequest{
+		resource:    schema.GroupResource{Group: attrs.GetAPIGroup(), Resource: attrs.GetResource()},
+		subresource: attrs.GetSubresource(),
+		verb:        attrs.GetVerb(),
+	}
+
+	verb, ok := specialVerbRequests[request]
+
+	if !ok {
+		return attrs
+	}
+
+	return &authorizer.AttributesRecord{
+		User:            attrs.GetUser(),
+		Verb:            verb,
+		Namespace:       attrs.GetNamespace(),
+		APIGroup:        attrs.GetAPIGroup(),
+		APIVersion:      attrs.GetAPIVersion(),
+		Resource:        attrs.GetResource(),
+		Name:            attrs.GetName(),
+		ResourceRequest: true,
+		Path:            attrs.GetPath(),
+	}
+}
+
+// specialVerbCheck returns the attributes of the check of verb on the resource of target, the
+// subresource, namespace and name of target are kept. It fails if verb isn't registered for the
+// resource, a check of a verb on a resource it doesn't apply to would be a bug of the caller.
+func specialVerbCheck(verb string, target authorizer.AttributesRecord) (authorizer.AttributesRecord, error) {
+	resource := schema.GroupResource{Group: target.APIGroup, Resource: target.Resource}
+
+	if !specialVerbs[verb][resource] {
+		return target, fmt.Errorf("special verb %s isn't registered for %s", verb, resource)
+	}
+
+	target.Verb = verb
+	target.ResourceRequest = true
+
+	return target, nil
+}
+
+// holdsSpecialVerb reports whether authz permits the user of target verb on the resource of target,
+// the error wraps ErrAuthorizationTimeout if ctx is done before the decision
+func holdsSpecialVerb(ctx context.Context, authz Authorizer, verb string, target authorizer.AttributesRecord) (bool, error) {
+	check, err := specialVerbCheck(verb, target)
+
+	if err != nil {
+		return false, err
+	}
+
+	permitted, _, err := authz.Authorize(ctx, &check)
+
+	return permitted, err
+}
@@ -0,0 +1,123 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestSpecialVerbs(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "restricted-psp"}, Rules: []v1.PolicyRule{{Verbs: []string{"use"}, APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, ResourceNames: []string{"restricted"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "restricted-psp"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "restricted-psp"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, Rules: []v1.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "admin"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "admin"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "root"}}},
+	)
+
+	alice := &user.DefaultInfo{Name: "alice"}
+
+	tests := []struct {
+		name  string
+		verb  string
+		attrs authorizer.AttributesRecord
+		// the special verb isn't registered for the resource
+		invalid   bool
+		permitted bool
+	}{
+		// the pod security policy admission of a pod of demo created by alice
+		{name: "use of the policy", verb: "use", attrs: authorizer.AttributesRecord{User: alice, Namespace: "demo", APIGroup: "policy", Resource: "podsecuritypolicies", Name: "restricted"}, permitted: true},
+		{name: "use of another policy", verb: "use", attrs: authorizer.AttributesRecord{User: alice, Namespace: "demo", APIGroup: "policy", Resource: "podsecuritypolicies", Name: "privileged"}},
+		{name: "use in another namespace", verb: "use", attrs: authorizer.AttributesRecord{User: alice, Namespace: "other", APIGroup: "policy", Resource: "podsecuritypolicies", Name: "restricted"}},
+		{name: "use of the extensions group", verb: "use", attrs: authorizer.AttributesRecord{User: alice, Namespace: "demo", APIGroup: "extensions", Resource: "podsecuritypolicies", Name: "restricted"}},
+		{name: "wildcard verbs", verb: "use", attrs: authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "root"}, APIGroup: "policy", Resource: "podsecuritypolicies", Name: "privileged"}, permitted: true},
+		{name: "escalate", verb: "escalate", attrs: authorizer.AttributesRecord{User: alice, Namespace: "demo", APIGroup: v1.GroupName, Resource: "roles"}},
+		{name: "use of pods", verb: "use", attrs: authorizer.AttributesRecord{User: alice, Namespace: "demo", Resource: "pods"}, invalid: true},
+		{name: "unknown verb", verb: "approve", attrs: authorizer.AttributesRecord{User: alice, APIGroup: "certificates.k8s.io", Resource: "signers"}, invalid: true},
+	}
+
+	for _, test := range tests {
+		permitted, err := holdsSpecialVerb(context.Background(), defaultAuthorizer, test.verb, test.attrs)
+
+		if (err != nil) != test.invalid || permitted != test.permitted {
+			t.Errorf("%s: expected permitted %v invalid %v, got %v %v", test.name, test.permitted, test.invalid, permitted, err)
+		}
+	}
+
+	// use grants nothing else on the policies
+	for _, verb := range []string{"get", "list", "update", "delete"} {
+		attrs := authorizer.AttributesRecord{User: alice, Verb: verb, Namespace: "demo", APIGroup: "policy", APIVersion: "v1beta1", Resource: "podsecuritypolicies", Name: "restricted", ResourceRequest: true}
+
+		if permitted, _, err := permissionValidate(context.Background(), sharedListers(), &attrs); err != nil || permitted {
+			t.Errorf("%s of the policy: expected denied, got %v %v", verb, permitted, err)
+		}
+	}
+}
+
+func TestSpecialVerbRequests(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "restricted-psp"}, Rules: []v1.PolicyRule{{Verbs: []string{"use"}, APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies"}, ResourceNames: []string{"restricted"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "restricted-psp"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "restricted-psp"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+		// the verb of the request isn't the one the request is decided on
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "psp-use-creator"}, Rules: []v1.PolicyRule{{Verbs: []string{"create"}, APIGroups: []string{"policy"}, Resources: []string{"podsecuritypolicies/use"}}}},
+		&v1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "psp-use-creator"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "psp-use-creator"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "bob"}}},
+	)
+
+	auth := Authentication{Rule: Rule{Path: "/"}, Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusOK, nil
+	})}
+
+	tests := []struct {
+		name      string
+		user      string
+		method    string
+		path      string
+		permitted bool
+	}{
+		{name: "admission of the policy", user: "alice", method: http.MethodPost, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/restricted/use", permitted: true},
+		{name: "admission of another policy", user: "alice", method: http.MethodPost, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/privileged/use"},
+		{name: "admission in another namespace", user: "alice", method: http.MethodPost, path: "/apis/policy/v1beta1/namespaces/other/podsecuritypolicies/restricted/use"},
+		{name: "admission of the extensions group", user: "alice", method: http.MethodPost, path: "/apis/extensions/v1beta1/namespaces/demo/podsecuritypolicies/restricted/use"},
+		{name: "read of the use subresource", user: "alice", method: http.MethodGet, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/restricted/use"},
+		{name: "read of the policy", user: "alice", method: http.MethodGet, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/restricted"},
+		{name: "update of the policy", user: "alice", method: http.MethodPut, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/restricted"},
+		{name: "create of the use subresource", user: "bob", method: http.MethodPost, path: "/apis/policy/v1beta1/namespaces/demo/podsecuritypolicies/restricted/use"},
+	}
+
+	for _, test := range tests {
+		r := newAuthorizedRequest(t, test.method, test.path, &user.DefaultInfo{Name: test.user})
+		recorder := httptest.NewRecorder()
+
+		if _, err := auth.ServeHTTP(recorder, r); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if permitted := recorder.Code == http.StatusOK; permitted != test.permitted {
+			t.Errorf("%s: expected permitted %v, got %d %s", test.name, test.permitted, recorder.Code, recorder.Body)
+		}
+	}
+}
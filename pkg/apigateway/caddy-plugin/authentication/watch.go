@@ -0,0 +1,81 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// streamWriter passes the events of a watch through as they're written, it flushes every write so
+// that no event waits in a buffer, and tells whether the stream has started.
+type streamWriter struct {
+	*httpserver.ResponseWriterWrapper
+	started bool
+}
+
+func (s *streamWriter) WriteHeader(status int) {
+	s.started = true
+	s.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.started = true
+	n, err := s.ResponseWriterWrapper.Write(p)
+	if err == nil {
+		s.Flush()
+	}
+	return n, err
+}
+
+// Flush flushes the underlying writer if it can, a watch mustn't fail because a writer in between can't.
+func (s *streamWriter) Flush() {
+	if flusher, ok := s.ResponseWriterWrapper.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// serveWatch serves an authorized watch, it's authorized once before the stream starts. Once the
+// stream started, nothing is written on top of it: the errors of next are logged instead of written
+// by caddy, and a panic of next aborts the connection, the client sees the end of the watch and
+// watches again.
+func (c Authentication) serveWatch(w http.ResponseWriter, r *http.Request, attrs authorizer.Attributes) (status int, err error) {
+	stream := &streamWriter{ResponseWriterWrapper: &httpserver.ResponseWriterWrapper{ResponseWriter: w}}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if !stream.started {
+				panic(p)
+			}
+			log.Printf("[ERROR] authentication: panic serving the watch %s of user %s: %v", r.URL.Path, attrs.GetUser().GetName(), p)
+			panic(http.ErrAbortHandler)
+		}
+	}()
+
+	status, err = c.Next.ServeHTTP(stream, r)
+
+	if stream.started && (err != nil || status >= http.StatusBadRequest) {
+		log.Printf("[WARNING] authentication: watch %s of user %s ended with %d: %v", r.URL.Path, attrs.GetUser().GetName(), status, err)
+		return 0, nil
+	}
+
+	return status, err
+}
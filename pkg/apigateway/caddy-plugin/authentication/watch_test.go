@@ -0,0 +1,141 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package authentication
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// watchStream streams two events, the second once the client read the first, then ends as told by end
+type watchStream struct {
+	read chan struct{}
+	end  string
+}
+
+func (s *watchStream) ServeHTTP(w http.ResponseWriter, r *http.Request) (int, error) {
+	if s.end == "fail early" {
+		return http.StatusBadGateway, errors.New("upstream unavailable")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, `{"type":"ADDED"}`)
+
+	// blocks unless the event has been flushed to the client
+	<-s.read
+
+	fmt.Fprintln(w, `{"type":"MODIFIED"}`)
+
+	switch s.end {
+	case "fail":
+		return http.StatusInternalServerError, errors.New("informer resync failed")
+	case "panic":
+		panic("informer gone")
+	default:
+		return http.StatusOK, nil
+	}
+}
+
+func TestWatchStreams(t *testing.T) {
+	setupRBAC(t,
+		&v1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "watcher"}, Rules: []v1.PolicyRule{{Verbs: []string{"watch"}, APIGroups: []string{""}, Resources: []string{"pods"}}}},
+		&v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "watcher"}, RoleRef: v1.RoleRef{Kind: "ClusterRole", Name: "watcher"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "alice"}}},
+	)
+
+	tests := []struct {
+		end    string
+		user   string
+		status int
+		events int
+		broken bool
+	}{
+		{end: "ok", user: "alice", status: http.StatusOK, events: 2},
+		// nothing is written on top of the stream
+		{end: "fail", user: "alice", status: http.StatusOK, events: 2},
+		{end: "panic", user: "alice", status: http.StatusOK, events: 2, broken: true},
+		// errors before the stream are written as usual
+		{end: "fail early", user: "alice", status: http.StatusBadGateway},
+		{end: "ok", user: "mallory", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		stream := &watchStream{read: make(chan struct{}), end: test.end}
+		auth := Authentication{Rule: Rule{Path: "/"}, Next: stream}
+
+		// the user and the request info are resolved by the plugins before, the errors written by caddy
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, err := requestInfoFactory.NewRequestInfo(r)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			r = r.WithContext(request.WithRequestInfo(request.WithUser(r.Context(), &user.DefaultInfo{Name: test.user}), info))
+			if status, _ := auth.ServeHTTP(w, r); status >= http.StatusBadRequest {
+				http.Error(w, http.StatusText(status), status)
+			}
+		}))
+
+		response, err := http.Get(server.URL + "/api/v1/pods?watch=true")
+
+		if err != nil {
+			t.Fatalf("%s of %s: %v", test.end, test.user, err)
+		}
+
+		if response.StatusCode != test.status {
+			t.Errorf("%s of %s: expected %d, got %d", test.end, test.user, test.status, response.StatusCode)
+		}
+
+		if test.events > 0 {
+			reader := bufio.NewReader(response.Body)
+
+			if line, err := reader.ReadString('\n'); err != nil || line != "{\"type\":\"ADDED\"}\n" {
+				t.Errorf("%s: expected the first event before the second is written, got %q %v", test.end, line, err)
+			}
+
+			close(stream.read)
+
+			if line, err := reader.ReadString('\n'); err != nil || line != "{\"type\":\"MODIFIED\"}\n" {
+				t.Errorf("%s: expected the second event, got %q %v", test.end, line, err)
+			}
+
+			rest, err := ioutil.ReadAll(reader)
+
+			if len(rest) != 0 || (err != nil) != test.broken || (test.broken && err != io.ErrUnexpectedEOF) {
+				t.Errorf("%s: expected the stream to end broken %v, got %q %v", test.end, test.broken, rest, err)
+			}
+		} else if body, _ := ioutil.ReadAll(response.Body); strings.Contains(string(body), "ADDED") {
+			t.Errorf("%s of %s: expected no event, got %q", test.end, test.user, body)
+		}
+
+		response.Body.Close()
+		server.Close()
+	}
+}
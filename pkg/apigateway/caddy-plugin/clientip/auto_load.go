@@ -0,0 +1,203 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package clientip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+// the trusted proxies file is checked for changes every reloadInterval
+const reloadInterval = 10 * time.Second
+
+func init() {
+	caddy.RegisterPlugin("clientip", caddy.Plugin{
+		ServerType: "http",
+		Action:     Setup,
+	})
+}
+
+// Rule configures the clientip plugin
+type Rule struct {
+	Config
+	// file listing more trusted proxies, one address or CIDR a line, reloaded on change
+	TrustedFile string
+}
+
+func Setup(c *caddy.Controller) error {
+
+	rule, err := parse(c)
+
+	if err != nil {
+		return err
+	}
+
+	resolver := &Resolver{}
+	reloader := &reloader{rule: rule, resolver: resolver, stop: make(chan struct{})}
+
+	if err := reloader.reload(); err != nil {
+		return c.Err(err.Error())
+	}
+
+	c.OnStartup(func() error {
+		if rule.TrustedFile != "" {
+			go reloader.run(reloadInterval)
+		}
+		fmt.Println("ClientIP middleware is initiated")
+		return nil
+	})
+
+	c.OnShutdown(func() error {
+		close(reloader.stop)
+		return nil
+	})
+
+	httpserver.GetConfig(c).AddMiddleware(func(next httpserver.Handler) httpserver.Handler {
+		return &ClientIP{Next: next, resolver: resolver}
+	})
+
+	return nil
+}
+
+// reloader updates the resolver when the trusted proxies file changes, the requests are served
+// with the previous config meanwhile, and on with it if the file is invalid.
+type reloader struct {
+	rule     Rule
+	resolver *Resolver
+	stop     chan struct{}
+	content  []byte
+}
+
+func (l *reloader) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.reload(); err != nil {
+				log.Printf("[WARNING] clientip: reload %s: %v", l.rule.TrustedFile, err)
+			}
+		}
+	}
+}
+
+// reload updates the resolver with the content of the trusted proxies file if it changed
+func (l *reloader) reload() error {
+	config := l.rule.Config
+
+	if l.rule.TrustedFile == "" {
+		return l.resolver.Update(config)
+	}
+
+	content, err := ioutil.ReadFile(l.rule.TrustedFile)
+
+	if err != nil {
+		return err
+	}
+
+	if l.content != nil && bytes.Equal(content, l.content) {
+		return nil
+	}
+
+	config.TrustedProxies = append(append([]string{}, config.TrustedProxies...), parseTrustedFile(content)...)
+
+	if err := l.resolver.Update(config); err != nil {
+		return err
+	}
+
+	l.content = content
+
+	return nil
+}
+
+// parseTrustedFile returns the lines of content, blank lines and comments starting with # are skipped
+func parseTrustedFile(content []byte) []string {
+	proxies := make([]string, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+
+	return proxies
+}
+
+func parse(c *caddy.Controller) (Rule, error) {
+
+	rule := Rule{}
+
+	if c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+			for c.NextBlock() {
+				switch c.Val() {
+				case "trusted":
+					args := c.RemainingArgs()
+
+					if len(args) == 0 {
+						return rule, c.ArgErr()
+					}
+
+					rule.TrustedProxies = append(rule.TrustedProxies, args...)
+				case "headers":
+					args := c.RemainingArgs()
+
+					if len(args) == 0 {
+						return rule, c.ArgErr()
+					}
+
+					rule.Headers = args
+				case "trustedFile":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.TrustedFile = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				}
+			}
+		default:
+			return rule, c.ArgErr()
+		}
+	}
+
+	if c.Next() {
+		return rule, c.ArgErr()
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,234 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/recovery"
+)
+
+const (
+	HeaderForwardedFor = "X-Forwarded-For"
+	HeaderRealIP       = "X-Real-IP"
+)
+
+// DefaultHeaders are the headers carrying the client address, in order of preference
+var DefaultHeaders = []string{HeaderForwardedFor, HeaderRealIP}
+
+type contextKey struct{}
+
+// Config tells the proxies in front of the gateway
+type Config struct {
+	// addresses or CIDRs of the proxies whose headers are trusted
+	TrustedProxies []string
+	// headers carrying the client address, in order of preference, DefaultHeaders if empty
+	Headers []string
+}
+
+type config struct {
+	trusted []*net.IPNet
+	headers []string
+}
+
+// Resolver resolves the address of the client behind the trusted proxies. Headers of requests
+// from other peers are ignored, they may be spoofed. The config can be updated while serving.
+type Resolver struct {
+	config atomic.Value
+}
+
+// NewResolver returns a resolver trusting the proxies of c.
+func NewResolver(c Config) (*Resolver, error) {
+	r := &Resolver{}
+
+	if err := r.Update(c); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Update replaces the config, the requests being resolved keep the previous one.
+func (r *Resolver) Update(c Config) error {
+	parsed := &config{headers: c.Headers}
+
+	if len(parsed.headers) == 0 {
+		parsed.headers = DefaultHeaders
+	}
+
+	for _, header := range parsed.headers {
+		if header != HeaderForwardedFor && header != HeaderRealIP {
+			return fmt.Errorf("unsupported header %s", header)
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		network, err := parseNetwork(proxy)
+
+		if err != nil {
+			return err
+		}
+
+		parsed.trusted = append(parsed.trusted, network)
+	}
+
+	r.config.Store(parsed)
+
+	return nil
+}
+
+// parseNetwork parses a CIDR, or an address as the network of this single address
+func parseNetwork(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", value, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(value)
+
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q", value)
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func (c *config) isTrusted(ip net.IP) bool {
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the address of the client of req, the peer address if no trusted proxy forwarded
+// it. It's nil if the peer address can't be parsed.
+func (r *Resolver) Resolve(req *http.Request) net.IP {
+	c := r.config.Load().(*config)
+
+	peer := parseAddress(req.RemoteAddr)
+
+	if peer == nil || !c.isTrusted(peer) {
+		return peer
+	}
+
+	for _, header := range c.headers {
+		var ip net.IP
+
+		switch header {
+		case HeaderForwardedFor:
+			ip = c.forwardedFor(req.Header[http.CanonicalHeaderKey(HeaderForwardedFor)])
+		case HeaderRealIP:
+			ip = parseAddress(req.Header.Get(HeaderRealIP))
+		}
+
+		if ip != nil {
+			return ip
+		}
+	}
+
+	return peer
+}
+
+// forwardedFor returns the rightmost address which isn't a trusted proxy, the proxies append the
+// address of their peer, so only the addresses after the last untrusted one can't be spoofed. It's
+// the leftmost address if every address is trusted, nil if an address can't be parsed before.
+func (c *config) forwardedFor(values []string) net.IP {
+	addresses := make([]string, 0)
+	for _, value := range values {
+		addresses = append(addresses, strings.Split(value, ",")...)
+	}
+
+	var leftmost net.IP
+
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip := parseAddress(addresses[i])
+
+		if ip == nil {
+			return nil
+		}
+
+		if !c.isTrusted(ip) {
+			return ip
+		}
+
+		leftmost = ip
+	}
+
+	return leftmost
+}
+
+// parseAddress parses an address with or without port, IPv6 addresses with port are bracketed
+func parseAddress(value string) net.IP {
+	value = strings.TrimSpace(value)
+
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(value)
+
+	if err != nil {
+		return net.ParseIP(strings.Trim(value, "[]"))
+	}
+
+	return net.ParseIP(host)
+}
+
+// WithClientIP returns a copy of r carrying the client address ip
+func WithClientIP(r *http.Request, ip net.IP) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, ip))
+}
+
+// FromRequest returns the client address resolved by the clientip plugin, the peer address if the
+// plugin isn't configured. Plugins use it instead of RemoteAddr.
+func FromRequest(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(contextKey{}).(net.IP); ok && ip != nil {
+		return ip
+	}
+	return parseAddress(r.RemoteAddr)
+}
+
+// ClientIP resolves the client address of the requests for the next plugins
+type ClientIP struct {
+	Next     httpserver.Handler
+	resolver *Resolver
+}
+
+func (h ClientIP) ServeHTTP(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	defer recovery.Recover("clientip", w, r, &status, &err)
+
+	return h.Next.ServeHTTP(w, WithClientIP(r, h.resolver.Resolve(r)))
+}
@@ -0,0 +1,210 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package clientip
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+)
+
+func request(remoteAddr string, headers map[string][]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/kapis/foo", nil)
+	r.RemoteAddr = remoteAddr
+	for name, values := range headers {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	resolver, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		expected   string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", expected: "203.0.113.7"},
+		{name: "spoofed by untrusted peer", remoteAddr: "203.0.113.7:5000", headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Real-IP": {"2.2.2.2"}}, expected: "203.0.113.7"},
+		{name: "forwarded", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, expected: "198.51.100.1"},
+		{name: "chained", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 192.168.1.1, 10.0.0.3"}}, expected: "198.51.100.1"},
+		{name: "chained headers", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1", "10.0.0.3"}}, expected: "198.51.100.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}}, expected: "10.0.0.4"},
+		{name: "garbage", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"foo, 10.0.0.3"}, "X-Real-IP": {"198.51.100.2"}}, expected: "198.51.100.2"},
+		{name: "real ip", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Real-IP": {"198.51.100.2"}}, expected: "198.51.100.2"},
+		{name: "no header", remoteAddr: "10.0.0.2:5000", expected: "10.0.0.2"},
+		{name: "ipv6 peer", remoteAddr: "[2001:db8::1]:5000", headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1"}}, expected: "2001:db8::1"},
+		{name: "ipv6 proxy", remoteAddr: "[fd00::2]:5000", headers: map[string][]string{"X-Forwarded-For": {"2001:db8::5, fd00::3"}}, expected: "2001:db8::5"},
+		{name: "ipv6 with port", remoteAddr: "[fd00::2]:5000", headers: map[string][]string{"X-Forwarded-For": {"[2001:db8::5]:443"}}, expected: "2001:db8::5"},
+		{name: "ipv4 with port", remoteAddr: "10.0.0.2:5000", headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1:443"}}, expected: "198.51.100.1"},
+	}
+
+	for _, test := range tests {
+		if ip := resolver.Resolve(request(test.remoteAddr, test.headers)); ip.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, ip)
+		}
+	}
+}
+
+func TestResolveHeaderOrder(t *testing.T) {
+	resolver, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8"}, Headers: []string{HeaderRealIP, HeaderForwardedFor}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := request("10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-IP": {"198.51.100.2"}})
+
+	if ip := resolver.Resolve(r); ip.String() != "198.51.100.2" {
+		t.Errorf("expected X-Real-IP preferred, got %s", ip)
+	}
+
+	for _, config := range []Config{{TrustedProxies: []string{"10.0.0.0/33"}}, {TrustedProxies: []string{"foo"}}, {Headers: []string{"Forwarded"}}} {
+		if err := resolver.Update(config); err == nil {
+			t.Errorf("expected %+v invalid", config)
+		}
+	}
+
+	// the invalid configs are not applied
+	if ip := resolver.Resolve(r); ip.String() != "198.51.100.2" {
+		t.Errorf("expected the previous config kept, got %s", ip)
+	}
+}
+
+func TestReloadTrustedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clientip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "trusted")
+	write := func(content string) {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# the ingress\n10.0.0.0/8\n")
+
+	resolver := &Resolver{}
+	l := &reloader{rule: Rule{Config: Config{TrustedProxies: []string{"fd00::/8"}}, TrustedFile: file}, resolver: resolver}
+
+	if err := l.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := request("172.16.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1, 10.0.0.3"}})
+
+	if ip := resolver.Resolve(r); ip.String() != "172.16.0.2" {
+		t.Errorf("expected the untrusted peer, got %s", ip)
+	}
+
+	write("10.0.0.0/8\n172.16.0.0/12\n")
+
+	if err := l.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ip := resolver.Resolve(r); ip.String() != "198.51.100.1" {
+		t.Errorf("expected the client behind the added proxy, got %s", ip)
+	}
+
+	// the inline proxies are kept
+	if ip := resolver.Resolve(request("[fd00::1]:5000", map[string][]string{"X-Real-IP": {"198.51.100.2"}})); ip.String() != "198.51.100.2" {
+		t.Errorf("expected the inline proxies trusted, got %s", ip)
+	}
+
+	write("10.0.0.0/8\nfoo\n")
+
+	if err := l.reload(); err == nil {
+		t.Error("expected invalid file")
+	}
+
+	if ip := resolver.Resolve(r); ip.String() != "198.51.100.1" {
+		t.Errorf("expected the previous config kept, got %s", ip)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	resolver, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resolved net.IP
+	h := ClientIP{
+		Next: httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+			resolved = FromRequest(r)
+			return http.StatusOK, nil
+		}),
+		resolver: resolver,
+	}
+
+	if _, err := h.ServeHTTP(httptest.NewRecorder(), request("10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}})); err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.String() != "198.51.100.1" {
+		t.Errorf("expected the client address in the context, got %s", resolved)
+	}
+
+	// without the plugin, the peer address
+	if ip := FromRequest(request("10.0.0.2:5000", map[string][]string{"X-Forwarded-For": {"198.51.100.1"}})); ip.String() != "10.0.0.2" {
+		t.Errorf("expected the peer address, got %s", ip)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+	}{
+		{input: "clientip", valid: true},
+		{input: "clientip {\n trusted 10.0.0.0/8 fd00::/8\n trusted 192.168.1.1\n headers X-Real-IP X-Forwarded-For\n}", valid: true},
+		{input: "clientip {\n trusted\n}"},
+		{input: "clientip {\n trusted 10.0.0.0/33\n}"},
+		{input: "clientip {\n headers Forwarded\n}"},
+		{input: "clientip {\n trustedFile /nonexistent/trusted\n}"},
+		{input: "clientip foo"},
+	}
+
+	for _, test := range tests {
+		err := Setup(caddy.NewTestController("http", test.input))
+
+		if (err == nil) != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.input, test.valid, err)
+		}
+	}
+}
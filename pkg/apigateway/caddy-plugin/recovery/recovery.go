@@ -0,0 +1,95 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package recovery
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"kubesphere.io/kubesphere/pkg/errors"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+var panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_handler_panics_total",
+	Help: "Number of panics recovered while serving a request, by plugin.",
+}, []string{"plugin"})
+
+func init() {
+	if err := prometheus.DefaultRegisterer.Register(panics); err != nil {
+		log.Printf("[ERROR] recovery: register panic metrics: %v", err)
+	}
+}
+
+// response is the error envelope of the API, the correlation ID is logged with the stack
+type response struct {
+	errors.Error
+	CorrelationID string `json:"correlationId"`
+}
+
+// Recover recovers a panic of the ServeHTTP of plugin, it must be deferred with the named results
+// of ServeHTTP. The stack is logged, the client gets a 500 with a correlation ID to look it up.
+func Recover(plugin string, w http.ResponseWriter, r *http.Request, status *int, err *error) {
+	p := recover()
+
+	if p == nil {
+		return
+	}
+
+	// the reverse proxy aborts responses with it, it isn't a failure of the plugin
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+
+	panics.WithLabelValues(plugin).Inc()
+
+	id := requestID(r)
+
+	log.Printf("[ERROR] %s: panic serving %s %s, request %s: %v\n%s", plugin, r.Method, r.URL.Path, id, p, debug.Stack())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(requestIDHeader, id)
+	w.WriteHeader(http.StatusInternalServerError)
+
+	if encodeErr := json.NewEncoder(w).Encode(response{Error: errors.Error{Message: http.StatusText(http.StatusInternalServerError)}, CorrelationID: id}); encodeErr != nil {
+		log.Printf("[ERROR] %s: write response of request %s: %v", plugin, id, encodeErr)
+	}
+
+	// the response is written
+	*status, *err = 0, nil
+}
+
+// requestID returns the ID caddy assigned to the request, the one of the client, or a new one
+func requestID(r *http.Request) string {
+	if id, ok := r.Context().Value(httpserver.RequestIDCtxKey).(string); ok && id != "" {
+		return id
+	}
+	// it's logged, so it must not break the line
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 128 && !strings.ContainsAny(id, "\r\n") {
+		return id
+	}
+	return uuid.New().String()
+}
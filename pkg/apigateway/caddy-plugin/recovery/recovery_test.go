@@ -0,0 +1,119 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// serve runs handler like a plugin does
+func serve(w http.ResponseWriter, r *http.Request, handler func() (int, error)) (status int, err error) {
+	defer Recover("test", w, r, &status, &err)
+	return handler()
+}
+
+func panicCount(t *testing.T) float64 {
+	var metric dto.Metric
+	if err := panics.WithLabelValues("test").Write(&metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestRecover(t *testing.T) {
+	before := panicCount(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	r.Header.Set(requestIDHeader, "4f3c")
+	w := httptest.NewRecorder()
+
+	status, err := serve(w, r, func() (int, error) {
+		var roles map[string]string
+		roles["secret-token"] = "admin"
+		return http.StatusOK, nil
+	})
+
+	if status != 0 || err != nil {
+		t.Errorf("expected the response written, got %d %v", status, err)
+	}
+
+	var body map[string]string
+
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusInternalServerError || body["message"] != "Internal Server Error" || body["correlationId"] != "4f3c" || w.Header().Get(requestIDHeader) != "4f3c" {
+		t.Errorf("unexpected response %d %v", w.Code, body)
+	}
+
+	if strings.Contains(w.Body.String(), "secret-token") || strings.Contains(w.Body.String(), "goroutine") || strings.Contains(w.Body.String(), "nil map") {
+		t.Errorf("response leaks the panic %s", w.Body.String())
+	}
+
+	if d := panicCount(t) - before; d != 1 {
+		t.Errorf("expected 1 panic counted, got %v", d)
+	}
+}
+
+func TestRecoverRequestID(t *testing.T) {
+	for _, header := range []string{"", "forged\nline", strings.Repeat("a", 200)} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(requestIDHeader, header)
+		w := httptest.NewRecorder()
+
+		serve(w, r, func() (int, error) {
+			panic(fmt.Errorf("broken"))
+		})
+
+		if id := w.Header().Get(requestIDHeader); id == "" || id == header {
+			t.Errorf("expected a new correlation ID instead of %q, got %q", header, id)
+		}
+	}
+}
+
+func TestRecoverPassesAbort(t *testing.T) {
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("expected abort panic, got %v", p)
+		}
+	}()
+
+	serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), func() (int, error) {
+		panic(http.ErrAbortHandler)
+	})
+}
+
+func TestRecoverNoPanic(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	status, err := serve(w, httptest.NewRequest(http.MethodGet, "/", nil), func() (int, error) {
+		return http.StatusNotFound, nil
+	})
+
+	if status != http.StatusNotFound || err != nil || w.Body.Len() != 0 {
+		t.Errorf("expected the result of the handler, got %d %v %q", status, err, w.Body.String())
+	}
+}
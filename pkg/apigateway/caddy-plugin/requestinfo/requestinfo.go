@@ -0,0 +1,87 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package requestinfo
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/recovery"
+)
+
+// NewResolver returns the resolver of the request info of the gateway. The paths of the KubeSphere
+// APIs, /kapis/<group>/<version>/..., are resource requests like the ones of /apis, so that the
+// roles granting their resources apply:
+//
+//	/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments  list deployments in foo
+//	/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments/web/revisions  get deployments/revisions web in foo
+//	/kapis/tenant.kubesphere.io/v1alpha2/workspaces  list workspaces
+//
+// Paths without group and version, like /kapis/version, are non-resource requests.
+func NewResolver() request.RequestInfoResolver {
+	return &request.RequestInfoFactory{
+		APIPrefixes:          sets.NewString("api", "apis", "kapis"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	}
+}
+
+// RequestInfo sets the request info of the requests in their context, the plugins authorizing the
+// requests decide on it
+type RequestInfo struct {
+	Next     httpserver.Handler
+	resolver request.RequestInfoResolver
+}
+
+func (h RequestInfo) ServeHTTP(w http.ResponseWriter, r *http.Request) (status int, err error) {
+	defer recovery.Recover("requestinfo", w, r, &status, &err)
+
+	// the request info and the upstream have the same path, the raw one would be decided on the
+	// namespace before a ".." and forwarded to the namespace after it
+	CleanPath(r)
+
+	info, err := h.resolver.NewRequestInfo(r)
+
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return h.Next.ServeHTTP(w, r.WithContext(request.WithRequestInfo(r.Context(), info)))
+}
+
+// CleanPath sets the path of r to its path with duplicate slashes collapsed and dot segments
+// resolved, the trailing slash is kept. The escaped path is dropped, the upstream gets the path
+// escaped again, encoded slashes are slashes.
+func CleanPath(r *http.Request) {
+	cleaned := "/"
+	if r.URL.Path != "" {
+		cleaned = path.Clean("/" + r.URL.Path)
+	}
+	if cleaned != "/" && strings.HasSuffix(r.URL.Path, "/") {
+		cleaned += "/"
+	}
+
+	if cleaned != r.URL.Path || r.URL.RawPath != "" {
+		r.URL.Path = cleaned
+		r.URL.RawPath = ""
+	}
+}
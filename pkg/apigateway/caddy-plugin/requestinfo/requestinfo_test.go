@@ -0,0 +1,129 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package requestinfo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestResolver(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected request.RequestInfo
+	}{
+		{method: http.MethodGet, path: "/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments", expected: request.RequestInfo{IsResourceRequest: true, Verb: "list", APIPrefix: "kapis", APIGroup: "resources.kubesphere.io", APIVersion: "v1alpha2", Namespace: "foo", Resource: "deployments"}},
+		{method: http.MethodDelete, path: "/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments/web", expected: request.RequestInfo{IsResourceRequest: true, Verb: "delete", APIPrefix: "kapis", APIGroup: "resources.kubesphere.io", APIVersion: "v1alpha2", Namespace: "foo", Resource: "deployments", Name: "web"}},
+		{method: http.MethodGet, path: "/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments/web/revisions", expected: request.RequestInfo{IsResourceRequest: true, Verb: "get", APIPrefix: "kapis", APIGroup: "resources.kubesphere.io", APIVersion: "v1alpha2", Namespace: "foo", Resource: "deployments", Subresource: "revisions", Name: "web"}},
+		{method: http.MethodGet, path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces", expected: request.RequestInfo{IsResourceRequest: true, Verb: "list", APIPrefix: "kapis", APIGroup: "tenant.kubesphere.io", APIVersion: "v1alpha2", Resource: "workspaces"}},
+		{method: http.MethodGet, path: "/kapis/tenant.kubesphere.io/v1alpha2/workspaces/ws-a/namespaces", expected: request.RequestInfo{IsResourceRequest: true, Verb: "get", APIPrefix: "kapis", APIGroup: "tenant.kubesphere.io", APIVersion: "v1alpha2", Resource: "workspaces", Subresource: "namespaces", Name: "ws-a"}},
+		{method: http.MethodGet, path: "/kapis/version", expected: request.RequestInfo{Verb: "get"}},
+		{method: http.MethodGet, path: "/kapis", expected: request.RequestInfo{Verb: "get"}},
+		{method: http.MethodGet, path: "/healthz", expected: request.RequestInfo{Verb: "get"}},
+		{method: http.MethodGet, path: "/api/v1/namespaces/foo/pods", expected: request.RequestInfo{IsResourceRequest: true, Verb: "list", APIPrefix: "api", APIVersion: "v1", Namespace: "foo", Resource: "pods"}},
+	}
+
+	resolver := NewResolver()
+
+	for _, test := range tests {
+		info, err := resolver.NewRequestInfo(httptest.NewRequest(test.method, test.path, nil))
+
+		if err != nil {
+			t.Fatalf("%s %s: %v", test.method, test.path, err)
+		}
+
+		// the resolved path and parts are the ones of the request
+		test.expected.Path, test.expected.Parts = info.Path, info.Parts
+
+		if !reflect.DeepEqual(*info, test.expected) {
+			t.Errorf("%s %s: expected %+v, got %+v", test.method, test.path, test.expected, *info)
+		}
+	}
+}
+
+func TestRequestInfo(t *testing.T) {
+	var resolved *request.RequestInfo
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		resolved, _ = request.RequestInfoFrom(r.Context())
+		return http.StatusOK, nil
+	})
+
+	c := caddy.NewTestController("http", "requestinfo")
+
+	if err := Setup(c); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := httpserver.GetConfig(c).Middleware()[0](next)
+
+	if _, err := handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/kapis/resources.kubesphere.io/v1alpha2/namespaces/foo/deployments", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved == nil || resolved.Resource != "deployments" || resolved.Namespace != "foo" {
+		t.Errorf("expected the request info in the context, got %+v", resolved)
+	}
+
+	if err := Setup(caddy.NewTestController("http", "requestinfo on")); err == nil {
+		t.Error("expected setup fails with an argument")
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	var resolved *request.RequestInfo
+	var forwarded string
+
+	next := httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		resolved, _ = request.RequestInfoFrom(r.Context())
+		forwarded = r.URL.EscapedPath()
+		return http.StatusOK, nil
+	})
+
+	handler := RequestInfo{Next: next, resolver: NewResolver()}
+
+	tests := []struct {
+		path      string
+		forwarded string
+		namespace string
+	}{
+		{path: "/api/v1/namespaces/demo/pods/x/../../../other/secrets", forwarded: "/api/v1/namespaces/other/secrets", namespace: "other"},
+		{path: "/api/v1/namespaces/demo/./pods", forwarded: "/api/v1/namespaces/demo/pods", namespace: "demo"},
+		{path: "/api/v1//namespaces/demo/pods/", forwarded: "/api/v1/namespaces/demo/pods/", namespace: "demo"},
+		{path: "/api/v1/namespaces/demo%2F..%2Fother/secrets", forwarded: "/api/v1/namespaces/other/secrets", namespace: "other"},
+		{path: "/api/v1/namespaces/demo/pods", forwarded: "/api/v1/namespaces/demo/pods", namespace: "demo"},
+	}
+
+	for _, test := range tests {
+		if _, err := handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the request info is resolved on the path the next plugins forward
+		if forwarded != test.forwarded || resolved == nil || resolved.Path != test.forwarded || resolved.Namespace != test.namespace {
+			t.Errorf("%s: expected %s in %s, got %s %+v", test.path, test.forwarded, test.namespace, forwarded, resolved)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resourcesgrpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authenticate"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apis/resources/v1alpha2/rpc"
+	"kubesphere.io/kubesphere/pkg/models/resources"
+)
+
+// the calls are authorized like the requests of the resources API
+const (
+	apiGroup   = "resources.kubesphere.io"
+	apiVersion = "v1alpha2"
+)
+
+// Authorizer decides the calls, authentication.Evaluator implements it
+type Authorizer interface {
+	Authorize(attrs authorizer.Attributes) (permitted bool, version string, err error)
+}
+
+// guard authenticates the calls by the token of the gateway or the verified client certificate,
+// and authorizes them
+type guard struct {
+	// the tokens aren't accepted if empty
+	secret     []byte
+	authorizer Authorizer
+}
+
+func (g *guard) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	u, err := g.user(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.authorize(u, req, false); err != nil {
+		return nil, err
+	}
+
+	return handler(request.WithUser(ctx, u), req)
+}
+
+func (g *guard) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	u, err := g.user(ss.Context())
+
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &guardedStream{ServerStream: ss, guard: g, user: u})
+}
+
+// guardedStream authorizes the request of a server streaming call when the handler receives it
+type guardedStream struct {
+	grpc.ServerStream
+	guard *guard
+	user  user.Info
+}
+
+func (s *guardedStream) Context() context.Context {
+	return request.WithUser(s.ServerStream.Context(), s.user)
+}
+
+func (s *guardedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return s.guard.authorize(s.user, m, true)
+}
+
+// user returns the user of the bearer token of the authorization metadata, or of the verified
+// client certificate, its common name is the name and its organizations the groups
+func (g *guard) user(ctx context.Context) (user.Info, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get("authorization"); len(values) > 0 {
+		if len(g.secret) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "tokens aren't accepted")
+		}
+
+		fields := strings.Fields(values[0])
+
+		if len(fields) != 2 || fields[0] != "Bearer" {
+			return nil, status.Error(codes.Unauthenticated, "expect a bearer token")
+		}
+
+		auth := authenticate.Auth{Rule: authenticate.Rule{Secret: g.secret}}
+		token, err := auth.Validate(fields[1])
+
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+
+		u, err := authenticate.TokenUser(token)
+
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+
+		if u.Name == "" {
+			return nil, status.Error(codes.Unauthenticated, "the token names no user")
+		}
+
+		return u, nil
+	}
+
+	// the server verifies the certificates, they're only presented if a client CA is set
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			certificate := tlsInfo.State.VerifiedChains[0][0]
+
+			if certificate.Subject.CommonName == "" {
+				return nil, status.Error(codes.Unauthenticated, "the client certificate has no common name")
+			}
+
+			return &user.DefaultInfo{Name: certificate.Subject.CommonName, Groups: certificate.Subject.Organization}, nil
+		}
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "no token or client certificate")
+}
+
+// authorize decides the request of u with the attributes of the matching request of the resources
+// API, the lists of the streaming calls are watches
+func (g *guard) authorize(u user.Info, req interface{}, streaming bool) error {
+	var attrs authorizer.AttributesRecord
+
+	switch req := req.(type) {
+	case *rpc.ListRequest:
+		verb := "list"
+		if streaming {
+			verb = "watch"
+		}
+		attrs = attributes(u, verb, req.Kind, req.Namespace, "")
+	case *rpc.GetRequest:
+		attrs = attributes(u, "get", req.Kind, req.Namespace, req.Name)
+	default:
+		return status.Errorf(codes.Internal, "unexpected request %T", req)
+	}
+
+	kind, err := resources.ResolveKind(attrs.Resource)
+
+	if err != nil {
+		return statusOf(err)
+	}
+
+	attrs.Resource = kind
+	attrs.Path = resourcePath(attrs)
+
+	permitted, _, err := g.authorizer.Authorize(attrs)
+
+	if err != nil {
+		glog.Errorf("authorize %s %s of %s: %v", attrs.Verb, attrs.Path, u.GetName(), err)
+		return status.Error(codes.Internal, "authorization failed")
+	}
+
+	if !permitted {
+		return status.Errorf(codes.PermissionDenied, "%s can't %s %s", u.GetName(), attrs.Verb, attrs.Path)
+	}
+
+	return nil
+}
+
+// attributes returns the attributes of a resource request of u
+func attributes(u user.Info, verb, kind, namespace, name string) authorizer.AttributesRecord {
+	// the shared evaluator doesn't add the implicit groups of the users
+	return authorizer.AttributesRecord{
+		User:            authentication.WithImplicitGroups(u),
+		Verb:            verb,
+		Namespace:       namespace,
+		APIGroup:        apiGroup,
+		APIVersion:      apiVersion,
+		Resource:        kind,
+		Name:            name,
+		ResourceRequest: true,
+	}
+}
+
+// resourcePath returns the path of the request of the resources API matching attrs
+func resourcePath(attrs authorizer.AttributesRecord) string {
+	path := fmt.Sprintf("/kapis/%s/%s", attrs.APIGroup, attrs.APIVersion)
+
+	if attrs.Namespace != "" {
+		path += "/namespaces/" + attrs.Namespace
+	}
+
+	path += "/" + attrs.Resource
+
+	if attrs.Name != "" {
+		path += "/" + attrs.Name
+	}
+
+	return path
+}
@@ -0,0 +1,226 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resourcesgrpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/mholt/caddy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apis/resources/v1alpha2/rpc"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models/resources"
+)
+
+func init() {
+	caddy.RegisterPlugin("resourcesgrpc", caddy.Plugin{
+		ServerType: "http",
+		Action:     Setup,
+	})
+}
+
+// Rule configures the resourcesgrpc plugin
+type Rule struct {
+	Address string
+	// the HMAC secret of the tokens of the gateway, the tokens aren't accepted if empty
+	Secret []byte
+	// the serving certificate, the service is served in plaintext if empty
+	CertFile string
+	KeyFile  string
+	// the CAs of the client certificates, the certificates aren't accepted if empty
+	ClientCAFile string
+}
+
+// Setup is called by Caddy to parse the config block
+func Setup(c *caddy.Controller) error {
+
+	rule, err := parse(c)
+
+	if err != nil {
+		return err
+	}
+
+	options, err := serverOptions(rule)
+
+	if err != nil {
+		return c.Errf("resourcesgrpc: %v", err)
+	}
+
+	evaluator := authentication.NewEvaluator(informers.SharedInformerFactory())
+	g := &guard{secret: rule.Secret, authorizer: evaluator}
+	options = append(options, grpc.UnaryInterceptor(g.unary), grpc.StreamInterceptor(g.stream))
+
+	// the reloads start the new servers before they stop the old ones, the listener is kept
+	listener := &listener{address: rule.Address, options: options, evaluator: evaluator}
+	c.OnFirstStartup(listener.start)
+	c.OnFinalShutdown(listener.stop)
+
+	return nil
+}
+
+// serverOptions returns the credentials of rule
+func serverOptions(rule Rule) ([]grpc.ServerOption, error) {
+	if len(rule.Secret) == 0 && rule.ClientCAFile == "" {
+		return nil, fmt.Errorf("a token secret or a client CA is required")
+	}
+
+	if rule.ClientCAFile != "" && rule.CertFile == "" {
+		return nil, fmt.Errorf("the client certificates require a serving certificate")
+	}
+
+	options := []grpc.ServerOption{}
+
+	if rule.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(rule.CertFile, rule.KeyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
+
+		if rule.ClientCAFile != "" {
+			if config.ClientCAs, err = authentication.LoadClientCA(rule.ClientCAFile); err != nil {
+				return nil, err
+			}
+			// the tokens are accepted without certificate
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		options = append(options, grpc.Creds(credentials.NewTLS(config)))
+	}
+
+	return options, nil
+}
+
+// listener serves the service on the address until stop, the informers of the searched kinds are
+// started with it
+type listener struct {
+	address   string
+	options   []grpc.ServerOption
+	evaluator *authentication.Evaluator
+	server    *grpc.Server
+	stopChan  chan struct{}
+}
+
+func (l *listener) start() error {
+	lis, err := net.Listen("tcp", l.address)
+
+	if err != nil {
+		return fmt.Errorf("resourcesgrpc: listen: %v", err)
+	}
+
+	// the RBAC informers are started with the ones of the searched kinds, the calls are denied
+	// until they synced
+	l.evaluator.Listers()
+	l.stopChan = make(chan struct{})
+	resources.SharedClient().Start(l.stopChan)
+
+	l.server = grpc.NewServer(l.options...)
+	rpc.RegisterResourcesServer(l.server, NewServer(resources.SharedClient()))
+
+	go func() {
+		if err := l.server.Serve(lis); err != nil {
+			log.Printf("[ERROR] resourcesgrpc: serve on %s: %v", l.address, err)
+		}
+	}()
+
+	fmt.Println("Resources gRPC service is listening on", l.address)
+	return nil
+}
+
+// stop closes the listener once the unary calls in flight are answered, the watches are ended
+func (l *listener) stop() error {
+	close(l.stopChan)
+	l.server.Stop()
+	return nil
+}
+
+func parse(c *caddy.Controller) (Rule, error) {
+
+	rule := Rule{}
+
+	if c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+			for c.NextBlock() {
+				switch c.Val() {
+				case "listen":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.Address = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "secret":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.Secret = []byte(c.Val())
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				case "tls":
+					args := c.RemainingArgs()
+
+					if len(args) != 2 {
+						return rule, c.ArgErr()
+					}
+
+					rule.CertFile, rule.KeyFile = args[0], args[1]
+				case "clientCA":
+					if !c.NextArg() {
+						return rule, c.ArgErr()
+					}
+
+					rule.ClientCAFile = c.Val()
+
+					if c.NextArg() {
+						return rule, c.ArgErr()
+					}
+				default:
+					return rule, c.Errf("resourcesgrpc: unknown option %s", c.Val())
+				}
+			}
+		default:
+			return rule, c.ArgErr()
+		}
+	}
+
+	if c.Next() {
+		return rule, c.ArgErr()
+	}
+
+	if rule.Address == "" {
+		return rule, c.Err("resourcesgrpc: listen is required")
+	}
+
+	return rule, nil
+}
@@ -0,0 +1,186 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+
+// Package resourcesgrpc serves the resources search API over gRPC for the internal components, on
+// a listener of its own started with the gateway.
+package resourcesgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/apis/resources/v1alpha2/rpc"
+	"kubesphere.io/kubesphere/pkg/models/resources"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// Server implements the Resources service on a resources client, the calls are authorized by the
+// interceptors
+type Server struct {
+	client resources.Interface
+}
+
+var _ rpc.ResourcesServer = &Server{}
+
+func NewServer(client resources.Interface) *Server {
+	return &Server{client: client}
+}
+
+func (s *Server) List(ctx context.Context, req *rpc.ListRequest) (*rpc.Result, error) {
+	result, err := s.client.List(ctx, req.Kind, req.Namespace, newQuery(req.Query))
+
+	if err != nil {
+		return nil, statusOf(err)
+	}
+
+	return newResult(result, req.Projection)
+}
+
+func (s *Server) Get(ctx context.Context, req *rpc.GetRequest) (*rpc.Object, error) {
+	object, err := s.client.Get(ctx, req.Kind, req.Namespace, req.Name)
+
+	if err != nil {
+		return nil, statusOf(err)
+	}
+
+	return newObject(object, req.Projection)
+}
+
+func (s *Server) Watch(req *rpc.ListRequest, stream rpc.Resources_WatchServer) error {
+	results, err := s.client.Watch(stream.Context(), req.Kind, req.Namespace, newQuery(req.Query))
+
+	if err != nil {
+		return statusOf(err)
+	}
+
+	// the channel is closed when the stream is done
+	for result := range results {
+		page, err := newResult(result, req.Projection)
+
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(page); err != nil {
+			return err
+		}
+	}
+
+	return stream.Context().Err()
+}
+
+// newQuery returns the resources query of query, a limit of 0 returns every object
+func newQuery(query *rpc.Query) resources.Query {
+	if query == nil {
+		return resources.Query{Limit: -1}
+	}
+
+	q := resources.Query{
+		OrderBy: query.OrderBy,
+		Reverse: query.Reverse,
+		Limit:   int(query.Limit),
+		Offset:  int(query.Offset),
+		// the objects are encoded, never changed
+		UnsafeNoCopy: true,
+	}
+
+	if q.Limit == 0 {
+		q.Limit = -1
+	}
+
+	if query.Conditions != nil {
+		q.Conditions = &params.Conditions{Match: query.Conditions.Match, Fuzzy: query.Conditions.Fuzzy}
+	}
+
+	return q
+}
+
+func newResult(result *resources.Result, projection rpc.Projection) (*rpc.Result, error) {
+	page := &rpc.Result{Items: make([]*rpc.Object, 0, len(result.Items)), TotalCount: int32(result.TotalCount)}
+
+	for _, item := range result.Items {
+		object, err := newObject(item, projection)
+
+		if err != nil {
+			return nil, err
+		}
+
+		page.Items = append(page.Items, object)
+	}
+
+	return page, nil
+}
+
+func newObject(object runtime.Object, projection rpc.Projection) (*rpc.Object, error) {
+	accessor, err := meta.Accessor(object)
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "%T has no metadata: %v", object, err)
+	}
+
+	o := &rpc.Object{Metadata: &rpc.Metadata{
+		Name:              accessor.GetName(),
+		Namespace:         accessor.GetNamespace(),
+		Uid:               string(accessor.GetUID()),
+		ResourceVersion:   accessor.GetResourceVersion(),
+		Labels:            accessor.GetLabels(),
+		Annotations:       accessor.GetAnnotations(),
+		CreationTimestamp: accessor.GetCreationTimestamp().Unix(),
+	}}
+
+	if projection == rpc.Projection_FULL {
+		if o.Raw, err = json.Marshal(object); err != nil {
+			return nil, status.Errorf(codes.Internal, "encode %s: %v", accessor.GetName(), err)
+		}
+	}
+
+	return o, nil
+}
+
+// statusOf returns the status of the code matching the HTTP status of the resources API for err
+func statusOf(err error) error {
+	code := codes.Internal
+
+	switch resources.HTTPStatus(err) {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusConflict:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	case http.StatusGatewayTimeout:
+		code = codes.DeadlineExceeded
+	}
+
+	switch err {
+	case context.Canceled:
+		code = codes.Canceled
+	case context.DeadlineExceeded:
+		code = codes.DeadlineExceeded
+	}
+
+	return status.Error(code, err.Error())
+}
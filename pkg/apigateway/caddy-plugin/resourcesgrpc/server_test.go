@@ -0,0 +1,335 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resourcesgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication/authorizationtest"
+	"kubesphere.io/kubesphere/pkg/apis/resources/v1alpha2/rpc"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models/resources/resourcestest"
+)
+
+var testSecret = []byte("test-secret")
+
+func pod(namespace, name, app string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}}}
+}
+
+// newTestConn serves the objects to the connection, bob reads the namespace demo. stop closes the
+// connection and stops the server and the client.
+func newTestConn(t *testing.T) (rpc.ResourcesClient, *resourcestest.Client, func()) {
+	client, err := resourcestest.NewClient(pod("demo", "web-1", "web"), pod("demo", "db-1", "db"), pod("other", "web-1", "web"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizationtest.Install(t, authorizationtest.Viewer("bob", "demo")...)
+
+	g := &guard{secret: testSecret, authorizer: authentication.NewEvaluator(informers.SharedInformerFactory())}
+	server := grpc.NewServer(grpc.UnaryInterceptor(g.unary), grpc.StreamInterceptor(g.stream))
+	rpc.RegisterResourcesServer(server, NewServer(client))
+
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+
+	dialed, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return lis.Dial()
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rpc.NewResourcesClient(dialed), client, func() {
+		dialed.Close()
+		server.Stop()
+		client.Stop()
+	}
+}
+
+func withToken(t *testing.T, ctx context.Context, username string) context.Context {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": username}).SignedString(testSecret)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func objectNames(result *rpc.Result) []string {
+	names := make([]string, 0, len(result.Items))
+	for _, item := range result.Items {
+		names = append(names, item.Metadata.Namespace+"/"+item.Metadata.Name)
+	}
+	return names
+}
+
+func TestList(t *testing.T) {
+	client, _, stop := newTestConn(t)
+	defer stop()
+	ctx := withToken(t, context.Background(), "bob")
+
+	tests := []struct {
+		name     string
+		request  *rpc.ListRequest
+		expected []string
+		code     codes.Code
+	}{
+		{
+			name:     "every pod",
+			request:  &rpc.ListRequest{Kind: "pods", Namespace: "demo", Query: &rpc.Query{OrderBy: "name"}},
+			expected: []string{"demo/db-1", "demo/web-1"},
+		},
+		{
+			name: "matching pods",
+			request: &rpc.ListRequest{Kind: "pod", Namespace: "demo", Query: &rpc.Query{
+				Conditions: &rpc.Conditions{Fuzzy: map[string]string{"label": "web"}},
+			}},
+			expected: []string{"demo/web-1"},
+		},
+		{
+			name: "pods named",
+			request: &rpc.ListRequest{Kind: "pods", Namespace: "demo", Query: &rpc.Query{
+				Conditions: &rpc.Conditions{Match: map[string]string{"name": "db-1"}},
+			}},
+			expected: []string{"demo/db-1"},
+		},
+		{
+			name:     "paged",
+			request:  &rpc.ListRequest{Kind: "po", Namespace: "demo", Query: &rpc.Query{OrderBy: "name", Limit: 1, Offset: 1}},
+			expected: []string{"demo/web-1"},
+		},
+		{
+			name:    "namespace not granted",
+			request: &rpc.ListRequest{Kind: "pods", Namespace: "other"},
+			code:    codes.PermissionDenied,
+		},
+		{
+			name:    "across namespaces",
+			request: &rpc.ListRequest{Kind: "pods"},
+			code:    codes.PermissionDenied,
+		},
+		{
+			name:    "unknown kind",
+			request: &rpc.ListRequest{Kind: "widgets", Namespace: "demo"},
+			code:    codes.NotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := client.List(ctx, test.request)
+
+			if status.Code(err) != test.code {
+				t.Fatalf("expected code %v, got %v", test.code, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if names := objectNames(result); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestProjection(t *testing.T) {
+	client, _, stop := newTestConn(t)
+	defer stop()
+	ctx := withToken(t, context.Background(), "bob")
+
+	full, err := client.Get(ctx, &rpc.GetRequest{Kind: "pods", Namespace: "demo", Name: "web-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &corev1.Pod{}
+	if err := json.Unmarshal(full.Raw, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Name != "web-1" || full.Metadata.Labels["app"] != "web" {
+		t.Errorf("unexpected object %s, metadata %v", full.Raw, full.Metadata)
+	}
+
+	metadataOnly, err := client.Get(ctx, &rpc.GetRequest{Kind: "pods", Namespace: "demo", Name: "web-1", Projection: rpc.Projection_METADATA})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(metadataOnly.Raw) != 0 || metadataOnly.Metadata.Name != "web-1" {
+		t.Errorf("expected the metadata only, got %v", metadataOnly)
+	}
+
+	if _, err := client.Get(ctx, &rpc.GetRequest{Kind: "pods", Namespace: "demo", Name: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+
+	if _, err := client.Get(ctx, &rpc.GetRequest{Kind: "pods", Namespace: "other", Name: "web-1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client, objects, stop := newTestConn(t)
+	defer stop()
+	ctx, cancel := context.WithTimeout(withToken(t, context.Background(), "bob"), 10*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &rpc.ListRequest{Kind: "pods", Namespace: "demo", Query: &rpc.Query{
+		Conditions: &rpc.Conditions{Fuzzy: map[string]string{"label": "web"}},
+		OrderBy:    "name",
+	}, Projection: rpc.Projection_METADATA})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := stream.Recv()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := objectNames(result); !reflect.DeepEqual(names, []string{"demo/web-1"}) {
+		t.Fatalf("expected the web pods, got %v", names)
+	}
+
+	// the pod not matching is filtered out of the pages sent for the changes
+	if err := objects.Add(pod("demo", "db-2", "db"), pod("demo", "web-2", "web")); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		result, err := stream.Recv()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := objectNames(result)
+
+		if reflect.DeepEqual(names, []string{"demo/web-1", "demo/web-2"}) {
+			break
+		}
+
+		if !reflect.DeepEqual(names, []string{"demo/web-1"}) {
+			t.Fatalf("unexpected page %v", names)
+		}
+	}
+}
+
+func TestWatchDenied(t *testing.T) {
+	client, _, stop := newTestConn(t)
+	defer stop()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{name: "no token", ctx: context.Background(), code: codes.Unauthenticated},
+		{name: "invalid token", ctx: metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid"), code: codes.Unauthenticated},
+		{name: "namespace not granted", ctx: withToken(t, context.Background(), "alice"), code: codes.PermissionDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream, err := client.Watch(test.ctx, &rpc.ListRequest{Kind: "pods", Namespace: "demo"})
+
+			if err == nil {
+				_, err = stream.Recv()
+			}
+
+			if status.Code(err) != test.code {
+				t.Errorf("expected code %v, got %v", test.code, err)
+			}
+		})
+	}
+}
+
+func TestCertificateUser(t *testing.T) {
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "monitoring", Organization: []string{"system:monitoring"}}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{certificate}},
+	}}})
+
+	u, err := (&guard{}).user(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &user.DefaultInfo{Name: "monitoring", Groups: []string{"system:monitoring"}}
+	if !reflect.DeepEqual(u, user.Info(expected)) {
+		t.Errorf("expected %v, got %v", expected, u)
+	}
+
+	// the tokens are rejected without a secret
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer token"))
+	if _, err := (&guard{}).user(ctx); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+}
+
+func TestAttributesGroups(t *testing.T) {
+	tests := []struct {
+		user     user.Info
+		expected []string
+	}{
+		{user: &user.DefaultInfo{Name: "bob", Groups: []string{"dev"}}, expected: []string{"dev", user.AllAuthenticated}},
+		{user: &user.DefaultInfo{Name: "system:serviceaccount:demo:builder"}, expected: []string{user.AllAuthenticated, "system:serviceaccounts", "system:serviceaccounts:demo"}},
+	}
+
+	for _, test := range tests {
+		attrs := attributes(test.user, "list", "pods", "demo", "")
+
+		if groups := attrs.User.GetGroups(); !reflect.DeepEqual(groups, test.expected) {
+			t.Errorf("%s: expected groups %v, got %v", test.user.GetName(), test.expected, groups)
+		}
+	}
+}
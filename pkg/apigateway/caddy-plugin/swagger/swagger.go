@@ -21,6 +21,8 @@ import (
 	"net/http"
 
 	"github.com/mholt/caddy/caddyhttp/httpserver"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/recovery"
 )
 
 type Swagger struct {
@@ -34,7 +36,8 @@ type Handler struct {
 	Handler  http.Handler
 }
 
-func (h Swagger) ServeHTTP(resp http.ResponseWriter, req *http.Request) (int, error) {
+func (h Swagger) ServeHTTP(resp http.ResponseWriter, req *http.Request) (status int, err error) {
+	defer recovery.Recover("swagger", resp, req, &status, &err)
 
 	if httpserver.Path(req.URL.Path).Matches(h.Handler.URL) {
 		h.Handler.Handler.ServeHTTP(resp, req)
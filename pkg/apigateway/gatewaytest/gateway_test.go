@@ -0,0 +1,279 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package gatewaytest_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication/authorizationtest"
+	"kubesphere.io/kubesphere/pkg/apigateway/gatewaytest"
+	"kubesphere.io/kubesphere/pkg/constants"
+)
+
+const login = "/kapis/iam.kubesphere.io/v1alpha2/login"
+
+// chain is the plugin chain of the gateway, in the order of its directives
+var chain = []string{
+	"clientip {\n trusted 127.0.0.1\n}",
+	fmt.Sprintf("authenticate {\n path /\n secret %s\n except %s\n}", gatewaytest.Secret, login),
+	"requestinfo",
+	fmt.Sprintf("authentication {\n path /\n except %s\n debug /debug/bypassed\n usage /usage\n}", login),
+}
+
+// upstream answers the requests with their path, and echoes the lines of upgraded connections
+func upstream(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "websocket" {
+		io.WriteString(w, r.URL.Path)
+		return
+	}
+
+	conn, buffer, err := w.(http.Hijacker).Hijack()
+
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	buffer.Flush()
+
+	line, err := buffer.ReadString('\n')
+
+	if err != nil {
+		return
+	}
+
+	buffer.WriteString(line)
+	buffer.Flush()
+}
+
+func TestPluginChain(t *testing.T) {
+	authorizationtest.Install(t, append(authorizationtest.Admin("admin"), authorizationtest.Viewer("alice", "demo")...)...)
+
+	gateway := gatewaytest.New(t, http.HandlerFunc(upstream), chain...)
+	defer gateway.Close()
+
+	latency := gatewaytest.SampleCount(t, "authentication_authorization_duration_seconds")
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		user    string
+		header  map[string]string
+		status  int
+		forward bool
+		// the path the upstream gets, the one of the request if empty
+		forwarded string
+	}{
+		{name: "authorized resource request", method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", user: "alice", status: http.StatusOK, forward: true},
+		{name: "authorized non-resource request", method: http.MethodGet, path: "/healthz", user: "admin", status: http.StatusOK, forward: true},
+		{name: "excepted path", method: http.MethodPost, path: login, header: map[string]string{"X-Forwarded-For": "203.0.113.7"}, status: http.StatusOK, forward: true},
+		{name: "denied request", method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "alice", status: http.StatusForbidden},
+		{name: "denied namespace", method: http.MethodGet, path: "/api/v1/namespaces/other/pods", user: "alice", status: http.StatusForbidden},
+		// the request is decided on the path forwarded to the upstream, not on the raw one
+		{name: "dot segments into a denied namespace", method: http.MethodGet, path: "/api/v1/namespaces/demo/pods/x/../../../other/secrets", user: "alice", status: http.StatusForbidden},
+		{name: "dot segments into a permitted namespace", method: http.MethodGet, path: "/api/v1/namespaces/other/../demo/pods/", user: "alice", status: http.StatusOK, forward: true, forwarded: "/api/v1/namespaces/demo/pods/"},
+		{name: "missing token", method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", status: http.StatusUnauthorized},
+		{name: "spoofed token header", method: http.MethodGet, path: "/api/v1/namespaces/demo/pods", header: map[string]string{constants.UserNameHeader: "admin"}, status: http.StatusUnauthorized},
+		// authenticate skips the raw path under the excepted one, the token headers are still no user
+		{name: "spoofed token header past the excepted path", method: http.MethodGet, path: login + "/../../../../api/v1/namespaces/demo/pods", header: map[string]string{constants.UserNameHeader: "admin"}, status: http.StatusUnauthorized},
+		// alice may not impersonate, the impersonation headers grant nothing
+		{name: "impersonation", method: http.MethodDelete, path: "/api/v1/namespaces/demo/pods/web", user: "alice", header: map[string]string{"Impersonate-User": "admin", "Impersonate-Group": "system:masters"}, status: http.StatusForbidden},
+	}
+
+	decisions := 0
+
+	for _, test := range tests {
+		gateway.Reset()
+
+		r, err := http.NewRequest(test.method, gateway.Server.URL+test.path, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.user != "" {
+			r.Header.Set("Authorization", "Bearer "+gatewaytest.Token(t, test.user))
+			// the impersonations are refused before the decision on the request
+			if test.header["Impersonate-User"] == "" {
+				decisions++
+			}
+		}
+
+		for key, value := range test.header {
+			r.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(r)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d %s", test.name, test.status, resp.StatusCode, body)
+		}
+
+		forwarded := gateway.Forwarded()
+
+		if test.forward != (len(forwarded) == 1) {
+			t.Errorf("%s: expected forwarded %v, got %v", test.name, test.forward, forwarded)
+		}
+
+		if expected := test.forwarded; test.forward && len(forwarded) == 1 {
+			if expected == "" {
+				expected = test.path
+			}
+			if forwarded[0].Path != expected {
+				t.Errorf("%s: expected the upstream gets %s, got %s", test.name, expected, forwarded[0].Path)
+			}
+		}
+
+		if test.forward && len(forwarded) == 1 && test.user != "" && forwarded[0].Header.Get(constants.UserNameHeader) != test.user {
+			t.Errorf("%s: expected the upstream gets the user %s, got %v", test.name, test.user, forwarded[0].Header)
+		}
+
+		if test.status == http.StatusForbidden {
+			var status metav1.Status
+			if err := json.Unmarshal(body, &status); err != nil || status.Reason != metav1.StatusReasonForbidden || resp.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: expected a forbidden Status, got %s %v", test.name, body, err)
+			}
+		}
+	}
+
+	if observed := gatewaytest.SampleCount(t, "authentication_authorization_duration_seconds") - latency; observed != uint64(decisions) {
+		t.Errorf("expected %d observed decisions, got %d", decisions, observed)
+	}
+
+	// the audit of the bypassed requests has the address of the client behind the trusted proxy
+	r, _ := http.NewRequest(http.MethodGet, gateway.Server.URL+"/debug/bypassed", nil)
+	r.Header.Set("Authorization", "Bearer "+gatewaytest.Token(t, "admin"))
+
+	resp, err := http.DefaultClient.Do(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bypassed []struct {
+		Path     string `json:"path"`
+		ClientIP string `json:"clientIP"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&bypassed)
+	resp.Body.Close()
+
+	if err != nil || len(bypassed) != 1 || bypassed[0].Path != login || bypassed[0].ClientIP != "203.0.113.7" {
+		t.Errorf("unexpected bypassed requests %+v %v", bypassed, err)
+	}
+
+	// the usage counts the decisions of the authenticated requests
+	r, _ = http.NewRequest(http.MethodGet, gateway.Server.URL+"/usage", nil)
+	r.Header.Set("Authorization", "Bearer "+gatewaytest.Token(t, "admin"))
+
+	resp, err = http.DefaultClient.Do(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []struct {
+		Resource string `json:"resource"`
+		Verb     string `json:"verb"`
+		Decision string `json:"decision"`
+		Count    int64  `json:"count"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&records)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int64)
+	for _, record := range records {
+		counts[record.Resource+" "+record.Verb+" "+record.Decision] += record.Count
+	}
+
+	if counts["pods list allowed"] != 2 || counts["pods delete denied"] != 1 || counts["pods list denied"] != 1 || counts["secrets list denied"] != 1 {
+		t.Errorf("unexpected usage %v", counts)
+	}
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	authorizationtest.Install(t, authorizationtest.Viewer("alice", "demo")...)
+
+	gateway := gatewaytest.New(t, http.HandlerFunc(upstream), chain...)
+	defer gateway.Close()
+
+	tests := []struct {
+		user   string
+		status int
+	}{
+		{user: "alice", status: http.StatusSwitchingProtocols},
+		{user: "bob", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.Server.URL, "http://"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(conn, "GET /api/v1/namespaces/demo/pods?watch=true HTTP/1.1\r\nHost: gateway\r\nAuthorization: Bearer %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", gatewaytest.Token(t, test.user))
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+
+		if err != nil {
+			conn.Close()
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d", test.user, test.status, resp.StatusCode)
+		}
+
+		// the upgraded connection is relayed both ways
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			fmt.Fprint(conn, "ping\n")
+			if line, err := reader.ReadString('\n'); err != nil || line != "ping\n" {
+				t.Errorf("%s: expected the upstream echoes, got %q %v", test.user, line, err)
+			}
+		}
+
+		conn.Close()
+	}
+}
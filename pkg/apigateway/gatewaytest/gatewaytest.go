@@ -0,0 +1,184 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+// Package gatewaytest assembles the plugin chain of the gateway from Caddyfile blocks in front of a
+// fake upstream, for the integration tests of the plugins.
+package gatewaytest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mholt/caddy"
+	"github.com/mholt/caddy/caddyhttp/httpserver"
+	"github.com/prometheus/client_golang/prometheus"
+
+	// Install plugins
+	_ "github.com/mholt/caddy/caddyhttp/proxy"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authenticate"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/authentication"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/clientip"
+	_ "kubesphere.io/kubesphere/pkg/apigateway/caddy-plugin/requestinfo"
+)
+
+// Secret signs the tokens of Token, it's the secret of the authenticate blocks
+const Secret = "gatewaytest"
+
+// Forwarded is a request the gateway forwarded to the upstream
+type Forwarded struct {
+	Method string
+	Path   string
+	Header http.Header
+}
+
+// Gateway serves the plugin chain, the last plugin proxies to the upstream
+type Gateway struct {
+	// Server serves the chain like caddy
+	Server *httptest.Server
+	// Upstream is the fake API server
+	Upstream *httptest.Server
+
+	mutex     sync.Mutex
+	forwarded []Forwarded
+}
+
+// New builds the chain of the directives of blocks in order, like caddy builds a site, followed by
+// a transparent proxy to upstream supporting WebSocket. The startup hooks of the plugins aren't run,
+// the authorization decides on the informers installed by the test.
+func New(t testing.TB, upstream http.Handler, blocks ...string) *Gateway {
+	g := &Gateway{}
+
+	g.Upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mutex.Lock()
+		g.forwarded = append(g.forwarded, Forwarded{Method: r.Method, Path: r.URL.Path, Header: r.Header})
+		g.mutex.Unlock()
+
+		upstream.ServeHTTP(w, r)
+	}))
+
+	blocks = append(blocks, fmt.Sprintf("proxy / %s {\n transparent\n websocket\n}", g.Upstream.URL))
+
+	middleware := make([]httpserver.Middleware, 0)
+
+	for _, block := range blocks {
+		directive := strings.Fields(block)[0]
+
+		setup, err := caddy.DirectiveAction("http", directive)
+
+		if err != nil {
+			g.Upstream.Close()
+			t.Fatal(err)
+		}
+
+		c := caddy.NewTestController("http", block)
+
+		if err := setup(c); err != nil {
+			g.Upstream.Close()
+			t.Fatalf("%s: %v", directive, err)
+		}
+
+		middleware = append(middleware, httpserver.GetConfig(c).Middleware()...)
+	}
+
+	var chain httpserver.Handler = httpserver.HandlerFunc(func(w http.ResponseWriter, r *http.Request) (int, error) {
+		return http.StatusNotFound, nil
+	})
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		chain = middleware[i](chain)
+	}
+
+	g.Server = httptest.NewServer(serve(chain))
+
+	return g
+}
+
+// Close shuts the servers down
+func (g *Gateway) Close() {
+	g.Server.Close()
+	g.Upstream.Close()
+}
+
+// Forwarded returns the requests forwarded to the upstream, the oldest first
+func (g *Gateway) Forwarded() []Forwarded {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return append([]Forwarded(nil), g.forwarded...)
+}
+
+// Reset forgets the forwarded requests
+func (g *Gateway) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.forwarded = nil
+}
+
+// serve serves chain like the server of caddy, errors without response are written by default
+func serve(chain httpserver.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.OriginalURLCtxKey, *r.URL))
+		r = r.WithContext(context.WithValue(r.Context(), httpserver.ReplacerCtxKey, httpserver.NewReplacer(r, nil, "")))
+
+		status, _ := chain.ServeHTTP(w, r)
+
+		if status >= 400 {
+			httpserver.DefaultErrorFunc(w, r, status)
+		}
+	})
+}
+
+// Token returns a token of the user named username signed with Secret
+func Token(t testing.TB, username string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": username}).SignedString([]byte(Secret))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// SampleCount returns the number of observations of the histogram named name of the default
+// registry, 0 if it has none.
+func SampleCount(t testing.TB, name string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count uint64
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			count += metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return count
+}
@@ -56,7 +56,7 @@ func addWebService(c *restful.Container) error {
 		Metadata(restfulspec.KeyOpenAPITags, tags).
 		Doc("Namespace level resource query").
 		Param(webservice.PathParameter("namespace", "which namespace")).
-		Param(webservice.PathParameter("resources", "namespace level resource type")).
+		Param(webservice.PathParameter("resources", "namespace level resource type, e.g. deployments, deployment, Deployment or deploy")).
 		Param(webservice.QueryParameter(params.ConditionsParam, "query conditions").
 			Required(false).
 			DataFormat("key=%s,key~%s")).
@@ -66,6 +66,31 @@ func addWebService(c *restful.Container) error {
 			DefaultValue("limit=10,page=1")).
 		Writes(models.PageableResponse{}))
 
+	webservice.Route(webservice.GET("/namespaces/{namespace}/changes/{resources}").
+		To(resources.NamespaceChanges).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Doc("Namespace level resources changed since a resource version, every resource if the version is too old").
+		Param(webservice.PathParameter("namespace", "which namespace")).
+		Param(webservice.PathParameter("resources", "namespace level resource type")).
+		Param(webservice.QueryParameter("since", "resourceVersion of the previous response, empty for a full list").
+			Required(false)).
+		Param(webservice.QueryParameter(params.ConditionsParam, "query conditions").
+			Required(false).
+			DataFormat("key=%s,key~%s")))
+
+	webservice.Route(webservice.GET("/namespaces/{namespace}/timebuckets/{kind}").
+		To(resources.NamespaceTimeBuckets).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Doc("Count the warning events or container restarts of the namespace over time").
+		Param(webservice.PathParameter("namespace", "which namespace")).
+		Param(webservice.PathParameter("kind", "events or restarts")).
+		Param(webservice.QueryParameter("window", "counted duration until now").
+			Required(false).
+			DefaultValue("6h")).
+		Param(webservice.QueryParameter("bucket", "duration of a bucket").
+			Required(false).
+			DefaultValue("10m")))
+
 	tags = []string{"Cluster resources"}
 
 	webservice.Route(webservice.GET("/{resources}").
@@ -73,7 +98,7 @@ func addWebService(c *restful.Container) error {
 		Writes(models.PageableResponse{}).
 		Metadata(restfulspec.KeyOpenAPITags, tags).
 		Doc("Cluster level resource query").
-		Param(webservice.PathParameter("resources", "cluster level resource type"))).
+		Param(webservice.PathParameter("resources", "cluster level resource type, e.g. nodes, node, Node or no"))).
 		Param(webservice.QueryParameter(params.ConditionsParam, "query conditions").
 			Required(false).
 			DataFormat("key=value,key~value").
@@ -83,6 +108,17 @@ func addWebService(c *restful.Container) error {
 			DataFormat("limit=%d,page=%d").
 			DefaultValue("limit=10,page=1"))
 
+	webservice.Route(webservice.GET("/changes/{resources}").
+		To(resources.ClusterChanges).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Doc("Cluster level resources, or namespaced resources across namespaces, changed since a resource version").
+		Param(webservice.PathParameter("resources", "resource type")).
+		Param(webservice.QueryParameter("since", "resourceVersion of the previous response, empty for a full list").
+			Required(false)).
+		Param(webservice.QueryParameter(params.ConditionsParam, "query conditions").
+			Required(false).
+			DataFormat("key=value,key~value")))
+
 	webservice.Route(webservice.GET("/storageclasses/{storageclass}/persistentvolumeclaims").
 		To(resources.GetPvcListBySc).
 		Doc("get user's kubectl pod").
@@ -107,6 +143,34 @@ func addWebService(c *restful.Container) error {
 		Param(webservice.PathParameter("username", "username")).
 		Metadata(restfulspec.KeyOpenAPITags, tags))
 
+	webservice.Route(webservice.GET("/users/{username}/favorites").
+		To(resources.ListUserResources).
+		Doc("List the favorites and the recently viewed resources of the user, deleted resources are pruned").
+		Param(webservice.PathParameter("username", "username")).
+		Metadata(restfulspec.KeyOpenAPITags, tags))
+
+	webservice.Route(webservice.POST("/users/{username}/favorites").
+		To(resources.AddFavorite).
+		Doc("Pin a resource, the body is its kind, namespace and name").
+		Param(webservice.PathParameter("username", "username")).
+		Metadata(restfulspec.KeyOpenAPITags, tags))
+
+	webservice.Route(webservice.DELETE("/users/{username}/favorites/{kind}/{name}").
+		To(resources.RemoveFavorite).
+		Doc("Unpin a resource").
+		Param(webservice.PathParameter("username", "username")).
+		Param(webservice.PathParameter("kind", "resource type")).
+		Param(webservice.PathParameter("name", "resource name")).
+		Param(webservice.QueryParameter("namespace", "namespace of namespaced resources").
+			Required(false)).
+		Metadata(restfulspec.KeyOpenAPITags, tags))
+
+	webservice.Route(webservice.POST("/users/{username}/recent").
+		To(resources.RecordView).
+		Doc("Record a resource viewed by the user, the body is its kind, namespace and name").
+		Param(webservice.PathParameter("username", "username")).
+		Metadata(restfulspec.KeyOpenAPITags, tags))
+
 	tags = []string{"Components"}
 
 	webservice.Route(webservice.GET("/components").
@@ -22,6 +22,7 @@ import (
 	"github.com/emicklei/go-restful"
 	"net/http"
 
+	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
 	"kubesphere.io/kubesphere/pkg/errors"
 
 	"kubesphere.io/kubesphere/pkg/models/quotas"
@@ -29,23 +30,25 @@ import (
 
 func GetNamespaceQuotas(req *restful.Request, resp *restful.Response) {
 	namespace := req.PathParameter("namespace")
-	quota, err := quotas.GetNamespaceQuotas(namespace)
+	quota, err := quotas.GetNamespaceQuotas(req.Request.Context(), namespace)
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
 		return
 	}
 
+	runtime.WriteWarningsHeader(resp, quota.Warnings)
 	resp.WriteAsJson(quota)
 }
 
 func GetClusterQuotas(req *restful.Request, resp *restful.Response) {
-	quota, err := quotas.GetClusterQuotas()
+	quota, err := quotas.GetClusterQuotas(req.Request.Context())
 
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
 		return
 	}
 
+	runtime.WriteWarningsHeader(resp, quota.Warnings)
 	resp.WriteAsJson(quota)
 }
@@ -29,14 +29,41 @@ import (
 func ClusterResourceHandler(req *restful.Request, resp *restful.Response) {
 	resourceName := req.PathParameter("resources")
 	conditions, err := params.ParseConditions(req)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
 	orderBy := req.QueryParameter(params.OrderByParam)
 	limit, offset := params.ParsePaging(req)
 	reverse := params.ParseReverse(req)
 
-	result, err := resources.ListClusterResource(resourceName, conditions, orderBy, reverse, limit, offset)
+	query := resources.Query{Conditions: conditions, OrderBy: orderBy, Reverse: reverse, Limit: limit, Offset: offset}
+
+	result, err := resources.SharedClient().List(req.Request.Context(), resourceName, "", query)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+func ClusterChanges(req *restful.Request, resp *restful.Response) {
+	resourceName := req.PathParameter("resources")
+	conditions, err := params.ParseConditions(req)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	result, err := resources.Changes(req.Request.Context(), resourceName, "", req.QueryParameter("since"), conditions)
 
 	if err != nil {
-		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
 		return
 	}
 
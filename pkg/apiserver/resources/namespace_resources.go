@@ -20,6 +20,7 @@ package resources
 import (
 	"github.com/emicklei/go-restful"
 	"net/http"
+	"time"
 
 	"kubesphere.io/kubesphere/pkg/errors"
 	"kubesphere.io/kubesphere/pkg/models/resources"
@@ -30,16 +31,77 @@ func NamespaceResourceHandler(req *restful.Request, resp *restful.Response) {
 	namespace := req.PathParameter("namespace")
 	resourceName := req.PathParameter("resources")
 	conditions, err := params.ParseConditions(req)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
 	orderBy := req.QueryParameter(params.OrderByParam)
 	limit, offset := params.ParsePaging(req)
 	reverse := params.ParseReverse(req)
 
-	result, err := resources.ListNamespaceResource(namespace, resourceName, conditions, orderBy, reverse, limit, offset)
+	result, err := resources.ListNamespaceResource(req.Request.Context(), namespace, resourceName, conditions, orderBy, reverse, limit, offset)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+func NamespaceChanges(req *restful.Request, resp *restful.Response) {
+	namespace := req.PathParameter("namespace")
+	resourceName := req.PathParameter("resources")
+	conditions, err := params.ParseConditions(req)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	result, err := resources.Changes(req.Request.Context(), resourceName, namespace, req.QueryParameter("since"), conditions)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+func NamespaceTimeBuckets(req *restful.Request, resp *restful.Response) {
+	namespace := req.PathParameter("namespace")
+	kind := req.PathParameter("kind")
+
+	window, err := durationParameter(req, "window", 6*time.Hour)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	bucketSize, err := durationParameter(req, "bucket", 10*time.Minute)
 
 	if err != nil {
-		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	result, err := resources.TimeBuckets(namespace, kind, window, bucketSize)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
 		return
 	}
 
 	resp.WriteAsJson(result)
 }
+
+func durationParameter(req *restful.Request, name string, defaultValue time.Duration) (time.Duration, error) {
+	if value := req.QueryParameter(name); value != "" {
+		return time.ParseDuration(value)
+	}
+	return defaultValue, nil
+}
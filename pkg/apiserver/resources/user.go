@@ -18,12 +18,15 @@
 package resources
 
 import (
+	"fmt"
 	"github.com/emicklei/go-restful"
 	"net/http"
 
+	"kubesphere.io/kubesphere/pkg/constants"
 	"kubesphere.io/kubesphere/pkg/errors"
 	"kubesphere.io/kubesphere/pkg/models/kubeconfig"
 	"kubesphere.io/kubesphere/pkg/models/kubectl"
+	"kubesphere.io/kubesphere/pkg/models/resources"
 )
 
 func GetKubectl(req *restful.Request, resp *restful.Response) {
@@ -53,3 +56,100 @@ func GetKubeconfig(req *restful.Request, resp *restful.Response) {
 
 	resp.Write([]byte(kubectlConfig))
 }
+
+// pathUser returns the user of the path, the users may only access their own resources
+func pathUser(req *restful.Request, resp *restful.Response) (string, bool) {
+	user := req.PathParameter("username")
+
+	if user != req.HeaderParameter(constants.UserNameHeader) {
+		resp.WriteHeaderAndEntity(http.StatusForbidden, errors.Wrap(fmt.Errorf("the resources of %s are forbidden", user)))
+		return "", false
+	}
+
+	return user, true
+}
+
+func ListUserResources(req *restful.Request, resp *restful.Response) {
+
+	user, ok := pathUser(req, resp)
+
+	if !ok {
+		return
+	}
+
+	result, err := resources.ListUserResources(user)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+func AddFavorite(req *restful.Request, resp *restful.Response) {
+
+	user, ok := pathUser(req, resp)
+
+	if !ok {
+		return
+	}
+
+	var favorite resources.UserResource
+
+	if err := req.ReadEntity(&favorite); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	result, err := resources.AddFavorite(user, favorite.Kind, favorite.Namespace, favorite.Name)
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+func RemoveFavorite(req *restful.Request, resp *restful.Response) {
+
+	user, ok := pathUser(req, resp)
+
+	if !ok {
+		return
+	}
+
+	result, err := resources.RemoveFavorite(user, req.PathParameter("kind"), req.QueryParameter("namespace"), req.PathParameter("name"))
+
+	if err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteAsJson(result)
+}
+
+// RecordView records a resource viewed by the user, the console calls it from the pages of the resources
+func RecordView(req *restful.Request, resp *restful.Response) {
+
+	user, ok := pathUser(req, resp)
+
+	if !ok {
+		return
+	}
+
+	var viewed resources.UserResource
+
+	if err := req.ReadEntity(&viewed); err != nil {
+		resp.WriteHeaderAndEntity(http.StatusBadRequest, errors.Wrap(err))
+		return
+	}
+
+	if err := resources.RecordView(user, viewed.Kind, viewed.Namespace, viewed.Name); err != nil {
+		resp.WriteHeaderAndEntity(resources.HTTPStatus(err), errors.Wrap(err))
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
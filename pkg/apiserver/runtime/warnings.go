@@ -0,0 +1,41 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/emicklei/go-restful"
+
+	"kubesphere.io/kubesphere/pkg/models"
+)
+
+// WarningsHeader carries the warnings of an incomplete result, one value per warning
+const WarningsHeader = "X-Kubesphere-Warnings"
+
+// WriteWarningsHeader adds the warnings to the response header as "<code> <kind>[/<namespace>]: <message>",
+// it must be called before the body is written.
+func WriteWarningsHeader(resp *restful.Response, warnings []models.SearchWarning) {
+	for _, warning := range warnings {
+		scope := warning.Kind
+		if warning.Namespace != "" {
+			scope = scope + "/" + warning.Namespace
+		}
+		resp.AddHeader(WarningsHeader, fmt.Sprintf("%s %s: %s", warning.Code, scope, warning.Message))
+	}
+}
@@ -22,24 +22,27 @@ import (
 	"github.com/emicklei/go-restful"
 	"net/http"
 
+	"kubesphere.io/kubesphere/pkg/apiserver/runtime"
 	"kubesphere.io/kubesphere/pkg/errors"
 	"kubesphere.io/kubesphere/pkg/models/status"
 )
 
 func GetClusterResourceStatus(req *restful.Request, resp *restful.Response) {
-	res, err := status.GetClusterResourceStatus()
+	res, err := status.GetClusterResourceStatus(req.Request.Context())
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
 		return
 	}
+	runtime.WriteWarningsHeader(resp, res.Warnings)
 	resp.WriteAsJson(res)
 }
 
 func GetNamespacesResourceStatus(req *restful.Request, resp *restful.Response) {
-	res, err := status.GetNamespacesResourceStatus(req.PathParameter("namespace"))
+	res, err := status.GetNamespacesResourceStatus(req.Request.Context(), req.PathParameter("namespace"))
 	if err != nil {
 		resp.WriteHeaderAndEntity(http.StatusInternalServerError, errors.Wrap(err))
 		return
 	}
+	runtime.WriteWarningsHeader(resp, res.Warnings)
 	resp.WriteAsJson(res)
 }
@@ -45,6 +45,12 @@ const (
 	envOpenPitrixProxyToken = "OPENPITRIX_PROXY_TOKEN"
 
 	UserNameHeader = "X-Token-Username"
+
+	DisplayNameAnnotationKey = "kubesphere.io/alias-name"
+	DescriptionAnnotationKey = "kubesphere.io/description"
+	// the pod template annotation checksum.kubesphere.io/configmap.<name> or secret.<name> records
+	// the resource version of the referenced configmap or secret the pods are started with
+	ChecksumAnnotationPrefix = "checksum.kubesphere.io/"
 )
 
 var (
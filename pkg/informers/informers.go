@@ -23,7 +23,20 @@ import (
 
 	s2iInformers "github.com/kubesphere/s2ioperator/pkg/client/informers/externalversions"
 
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
+	appsinformers "k8s.io/client-go/informers/apps/v1"
+	batchinformers "k8s.io/client-go/informers/batch/v1"
+	batchv1beta1informers "k8s.io/client-go/informers/batch/v1beta1"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 
 	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
 )
@@ -35,16 +48,99 @@ var (
 	s2iOnce            sync.Once
 	informerFactory    informers.SharedInformerFactory
 	s2iInformerFactory s2iInformers.SharedInformerFactory
+	labelSelector      string
 )
 
+// scopedResources are the resources cached by the informers a label selector scopes. The informers
+// of RBAC, namespaces and the other resources cache every object, the authorization and the
+// tenancy of the objects depend on them.
+var scopedResources = sets.NewString("deployments", "statefulsets", "daemonsets", "replicasets", "jobs", "cronjobs", "pods", "services")
+
 func SharedInformerFactory() informers.SharedInformerFactory {
 	k8sOnce.Do(func() {
 		k8sClient := k8s.Client()
-		informerFactory = informers.NewSharedInformerFactory(k8sClient, defaultResync)
+		informerFactory = NewScopedInformerFactory(k8sClient, defaultResync, labelSelector)
 	})
 	return informerFactory
 }
 
+// SetLabelSelector scopes the workload, pod and service informers of the shared informer factory
+// to the objects matching selector, e.g. kubesphere.io/workspace=ws1, so that a deployment serving
+// a tenant doesn't cache the objects of the others. It must be called before the first call of
+// SharedInformerFactory.
+func SetLabelSelector(selector string) error {
+	if _, err := labels.Parse(selector); err != nil {
+		return err
+	}
+	labelSelector = selector
+	return nil
+}
+
+// LabelSelector returns the selector scoping the shared informer factory, empty if it isn't scoped
+func LabelSelector() string {
+	return labelSelector
+}
+
+// IsLabelScoped reports whether the cache of resource in the shared informer factory holds only the
+// objects matching the label selector, searches of resource return partial results by design.
+func IsLabelScoped(resource string) bool {
+	return labelSelector != "" && scopedResources.Has(resource)
+}
+
+// NewScopedInformerFactory returns a factory whose informers of the scoped resources list and watch
+// the objects matching selector only, the factory isn't scoped if selector is empty. The scoped
+// informers are started with the factory, whether they're used or not.
+func NewScopedInformerFactory(client kubernetes.Interface, resync time.Duration, selector string) informers.SharedInformerFactory {
+	factory := informers.NewSharedInformerFactory(client, resync)
+
+	if selector == "" {
+		return factory
+	}
+
+	tweak := func(options *metav1.ListOptions) {
+		options.LabelSelector = selector
+	}
+
+	indexers := func() cache.Indexers {
+		return cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	}
+
+	// the factory keeps the first informer of a type, the typed accessors return the scoped ones
+	factory.InformerFor(&appsv1.Deployment{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return appsinformers.NewFilteredDeploymentInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&appsv1.StatefulSet{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return appsinformers.NewFilteredStatefulSetInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&appsv1.DaemonSet{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return appsinformers.NewFilteredDaemonSetInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&appsv1.ReplicaSet{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return appsinformers.NewFilteredReplicaSetInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&batchv1.Job{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return batchinformers.NewFilteredJobInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&batchv1beta1.CronJob{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return batchv1beta1informers.NewFilteredCronJobInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&corev1.Pod{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPodInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+	factory.InformerFor(&corev1.Service{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredServiceInformer(client, metav1.NamespaceAll, resync, indexers(), tweak)
+	})
+
+	return factory
+}
+
+// SetSharedInformerFactory replaces the shared informer factory, it's used to
+// inject a factory built on a fake client in unit tests.
+func SetSharedInformerFactory(factory informers.SharedInformerFactory) {
+	k8sOnce.Do(func() {})
+	informerFactory = factory
+}
+
 func S2iSharedInformerFactory() s2iInformers.SharedInformerFactory {
 	s2iOnce.Do(func() {
 		k8sClient := k8s.S2iClient()
@@ -0,0 +1,192 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package informers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer serves the lists of pods and namespaces filtered by their label selector, and
+// watches without events. It records the label selectors of the requests by path.
+type fakeAPIServer struct {
+	pods       []corev1.Pod
+	namespaces []corev1.Namespace
+	done       chan struct{}
+
+	mutex     sync.Mutex
+	selectors map[string][]string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	selector := r.URL.Query().Get("labelSelector")
+
+	s.mutex.Lock()
+	s.selectors[r.URL.Path] = append(s.selectors[r.URL.Path], selector)
+	s.mutex.Unlock()
+
+	if r.URL.Query().Get("watch") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-s.done:
+		}
+		return
+	}
+
+	parsed, err := labels.Parse(selector)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var list interface{}
+
+	switch r.URL.Path {
+	case "/api/v1/pods":
+		pods := &corev1.PodList{TypeMeta: metav1.TypeMeta{Kind: "PodList", APIVersion: "v1"}}
+		for _, pod := range s.pods {
+			if parsed.Matches(labels.Set(pod.Labels)) {
+				pods.Items = append(pods.Items, pod)
+			}
+		}
+		list = pods
+	case "/api/v1/namespaces":
+		namespaces := &corev1.NamespaceList{TypeMeta: metav1.TypeMeta{Kind: "NamespaceList", APIVersion: "v1"}}
+		for _, namespace := range s.namespaces {
+			if parsed.Matches(labels.Set(namespace.Labels)) {
+				namespaces.Items = append(namespaces.Items, namespace)
+			}
+		}
+		list = namespaces
+	default:
+		// the other scoped informers are started with the factory
+		list = &metav1.List{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (s *fakeAPIServer) selectorsOf(path string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.selectors[path]...)
+}
+
+func TestScopedInformerFactory(t *testing.T) {
+	ws1 := map[string]string{"kubesphere.io/workspace": "ws1"}
+	ws2 := map[string]string{"kubesphere.io/workspace": "ws2"}
+
+	apiServer := &fakeAPIServer{
+		pods: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ws1-demo", Name: "web", Labels: ws1}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "ws2-demo", Name: "web", Labels: ws2}},
+		},
+		namespaces: []corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: "ws1-demo", Labels: ws1}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "ws2-demo", Labels: ws2}},
+		},
+		done:      make(chan struct{}),
+		selectors: make(map[string][]string),
+	}
+
+	server := httptest.NewServer(apiServer)
+	defer server.Close()
+	defer close(apiServer.done)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory := NewScopedInformerFactory(client, 0, "kubesphere.io/workspace=ws1")
+
+	pods := factory.Core().V1().Pods().Lister()
+	namespaces := factory.Core().V1().Namespaces().Lister()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	factory.Start(stopCh)
+
+	for informer, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			t.Fatalf("%v not synced", informer)
+		}
+	}
+
+	if len(apiServer.selectorsOf("/api/v1/pods")) == 0 || len(apiServer.selectorsOf("/api/v1/namespaces")) == 0 {
+		t.Fatal("expected pods and namespaces listed")
+	}
+
+	for _, selector := range apiServer.selectorsOf("/api/v1/pods") {
+		if selector != "kubesphere.io/workspace=ws1" {
+			t.Errorf("expected pods listed and watched with the selector, got %q", selector)
+		}
+	}
+
+	for _, selector := range apiServer.selectorsOf("/api/v1/namespaces") {
+		if selector != "" {
+			t.Errorf("expected namespaces listed and watched without selector, got %q", selector)
+		}
+	}
+
+	if cached, err := pods.List(labels.Everything()); err != nil || len(cached) != 1 || cached[0].Namespace != "ws1-demo" {
+		t.Errorf("expected the pod of ws1 cached only, got %v %v", cached, err)
+	}
+
+	if cached, err := namespaces.List(labels.Everything()); err != nil || len(cached) != 2 {
+		t.Errorf("expected every namespace cached, got %v %v", cached, err)
+	}
+}
+
+func TestSetLabelSelector(t *testing.T) {
+	defer SetLabelSelector("")
+
+	if err := SetLabelSelector("kubesphere.io/workspace in (ws1"); err == nil {
+		t.Error("expected invalid selector rejected")
+	}
+
+	if err := SetLabelSelector("kubesphere.io/workspace=ws1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsLabelScoped("deployments") || IsLabelScoped("namespaces") || IsLabelScoped("roles") {
+		t.Error("expected workloads scoped only")
+	}
+
+	SetLabelSelector("")
+
+	if IsLabelScoped("deployments") {
+		t.Error("expected nothing scoped without selector")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package iam
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// conditions and orders of the members
+const (
+	memberName      = "name"
+	memberWorkspace = "workspace"
+	memberRole      = "role"
+	memberSince     = "createTime"
+)
+
+// workspace role bindings are named system:<workspace>:<role>
+var workspaceRoleBindingName = regexp.MustCompile(fmt.Sprintf(`^system:(\S+):(%s)$`, strings.Join(constants.WorkSpaceRoles, "|")))
+
+// workspaceRolePrivilege orders the workspace roles, the most privileged first
+var workspaceRolePrivilege = map[string]int{
+	constants.WorkspaceAdmin:   0,
+	constants.WorkspaceRegular: 1,
+	constants.WorkspaceViewer:  2,
+}
+
+// WorkspaceMembers returns the users bound to roles of workspace, filtered by the name and role
+// conditions, ordered by name, role or createTime.
+func WorkspaceMembers(workspace string, conditions *params.Conditions, orderBy string, reverse bool) ([]models.WorkspaceMember, error) {
+	return listWorkspaceMembers(func(ws, username string) bool { return ws == workspace }, conditions, orderBy, reverse)
+}
+
+// WorkspacesOf returns the memberships of the user named username, filtered by the workspace and
+// role conditions, ordered by workspace, role or createTime.
+func WorkspacesOf(username string, conditions *params.Conditions, orderBy string, reverse bool) ([]models.WorkspaceMember, error) {
+	if orderBy == "" {
+		orderBy = memberWorkspace
+	}
+	return listWorkspaceMembers(func(ws, name string) bool { return name == username }, conditions, orderBy, reverse)
+}
+
+func listWorkspaceMembers(selected func(workspace, username string) bool, conditions *params.Conditions, orderBy string, reverse bool) ([]models.WorkspaceMember, error) {
+	clusterRoleBindings, err := informers.SharedInformerFactory().Rbac().V1().ClusterRoleBindings().Lister().List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]*models.WorkspaceMember, 0)
+
+	for _, binding := range clusterRoleBindings {
+		groups := workspaceRoleBindingName.FindStringSubmatch(binding.Name)
+
+		if len(groups) != 3 {
+			continue
+		}
+
+		workspace, role := groups[1], groups[2]
+
+		for _, subject := range binding.Subjects {
+			if subject.Kind != v1.UserKind || !selected(workspace, subject.Name) {
+				continue
+			}
+
+			key := workspace + "/" + subject.Name
+			member, ok := members[key]
+
+			if !ok {
+				member = &models.WorkspaceMember{Workspace: workspace, Username: subject.Name, Roles: make([]string, 0)}
+				members[key] = member
+			}
+
+			if hasString(member.Roles, role) {
+				continue
+			}
+
+			member.Roles = append(member.Roles, role)
+
+			if member.Role == "" || workspaceRolePrivilege[role] < workspaceRolePrivilege[member.Role] {
+				member.Role = role
+				member.Since = binding.CreationTimestamp.Time
+			}
+		}
+	}
+
+	result := make([]models.WorkspaceMember, 0)
+
+	for _, member := range members {
+		sort.Slice(member.Roles, func(i, j int) bool {
+			return workspaceRolePrivilege[member.Roles[i]] < workspaceRolePrivilege[member.Roles[j]]
+		})
+		if matchMember(conditions, member) {
+			result = append(result, *member)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if reverse {
+			i, j = j, i
+		}
+		return compareMembers(&result[i], &result[j], orderBy)
+	})
+
+	return result, nil
+}
+
+// matchMember matches the member with the conditions, a role condition matches any role of the member
+func matchMember(conditions *params.Conditions, member *models.WorkspaceMember) bool {
+	if conditions == nil {
+		return true
+	}
+
+	for k, v := range conditions.Match {
+		switch k {
+		case memberName:
+			if member.Username != v {
+				return false
+			}
+		case memberWorkspace:
+			if member.Workspace != v {
+				return false
+			}
+		case memberRole:
+			if !hasString(member.Roles, v) {
+				return false
+			}
+		}
+	}
+
+	for k, v := range conditions.Fuzzy {
+		switch k {
+		case memberName:
+			if !strings.Contains(member.Username, v) {
+				return false
+			}
+		case memberWorkspace:
+			if !strings.Contains(member.Workspace, v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func compareMembers(a, b *models.WorkspaceMember, orderBy string) bool {
+	switch orderBy {
+	case memberSince:
+		if !a.Since.Equal(b.Since) {
+			return a.Since.Before(b.Since)
+		}
+	case memberRole:
+		if a.Role != b.Role {
+			return workspaceRolePrivilege[a.Role] < workspaceRolePrivilege[b.Role]
+		}
+	case memberWorkspace:
+		if a.Workspace != b.Workspace {
+			return a.Workspace < b.Workspace
+		}
+	}
+
+	if a.Username != b.Username {
+		return a.Username < b.Username
+	}
+
+	return a.Workspace < b.Workspace
+}
@@ -0,0 +1,162 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package iam
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+var epoch = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func workspaceRoleBinding(workspace, role string, created int, users ...string) *v1.ClusterRoleBinding {
+	binding := &v1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{
+		Name:              "system:" + workspace + ":" + role,
+		CreationTimestamp: metav1.NewTime(epoch.Add(time.Duration(created) * time.Hour)),
+	}}
+	for _, user := range users {
+		binding.Subjects = append(binding.Subjects, v1.Subject{Kind: v1.UserKind, Name: user})
+	}
+	return binding
+}
+
+func setupMembers(t *testing.T) {
+	factory := k8sinformers.NewSharedInformerFactory(nil, 0)
+	indexer := factory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer()
+
+	bindings := []*v1.ClusterRoleBinding{
+		workspaceRoleBinding("demo", "workspace-admin", 1, "alice"),
+		workspaceRoleBinding("demo", "workspace-regular", 2, "bob", "alice"),
+		workspaceRoleBinding("demo", "workspace-viewer", 3, "carol", "bob", "alice"),
+		workspaceRoleBinding("prod", "workspace-viewer", 4, "alice"),
+		workspaceRoleBinding("prod", "workspace-admin", 5, "bob"),
+		// not a workspace role binding
+		{ObjectMeta: metav1.ObjectMeta{Name: "system:demo:owner"}, Subjects: []v1.Subject{{Kind: v1.UserKind, Name: "dave"}}},
+		// groups aren't members
+		{ObjectMeta: metav1.ObjectMeta{Name: "system:staging:workspace-viewer"}, Subjects: []v1.Subject{{Kind: v1.GroupKind, Name: "alice"}}},
+	}
+
+	for _, binding := range bindings {
+		if err := indexer.Add(binding); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	informers.SetSharedInformerFactory(factory)
+}
+
+func usernames(members []models.WorkspaceMember) []string {
+	names := make([]string, 0)
+	for _, member := range members {
+		names = append(names, member.Username)
+	}
+	return names
+}
+
+func TestWorkspaceMembers(t *testing.T) {
+	setupMembers(t)
+
+	members, err := WorkspaceMembers("demo", nil, "", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []models.WorkspaceMember{
+		{Workspace: "demo", Username: "alice", Role: "workspace-admin", Roles: []string{"workspace-admin", "workspace-regular", "workspace-viewer"}, Since: epoch.Add(time.Hour)},
+		{Workspace: "demo", Username: "bob", Role: "workspace-regular", Roles: []string{"workspace-regular", "workspace-viewer"}, Since: epoch.Add(2 * time.Hour)},
+		{Workspace: "demo", Username: "carol", Role: "workspace-viewer", Roles: []string{"workspace-viewer"}, Since: epoch.Add(3 * time.Hour)},
+	}
+
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("expected %+v, got %+v", expected, members)
+	}
+
+	tests := []struct {
+		conditions *params.Conditions
+		orderBy    string
+		reverse    bool
+		expected   []string
+	}{
+		{orderBy: memberSince, reverse: true, expected: []string{"carol", "bob", "alice"}},
+		{orderBy: memberRole, reverse: true, expected: []string{"carol", "bob", "alice"}},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{memberName: "o"}}, expected: []string{"bob", "carol"}},
+		{conditions: &params.Conditions{Match: map[string]string{memberRole: "workspace-regular"}}, expected: []string{"alice", "bob"}},
+		{conditions: &params.Conditions{Match: map[string]string{memberName: "dave"}}, expected: []string{}},
+	}
+
+	for _, test := range tests {
+		members, err := WorkspaceMembers("demo", test.conditions, test.orderBy, test.reverse)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if names := usernames(members); !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%+v by %s: expected %v, got %v", test.conditions, test.orderBy, test.expected, names)
+		}
+	}
+}
+
+func TestWorkspacesOf(t *testing.T) {
+	setupMembers(t)
+
+	memberships, err := WorkspacesOf("alice", nil, "", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(memberships) != 2 || memberships[0].Workspace != "demo" || memberships[0].Role != "workspace-admin" || len(memberships[0].Roles) != 3 ||
+		memberships[1].Workspace != "prod" || memberships[1].Role != "workspace-viewer" || !memberships[1].Since.Equal(epoch.Add(4*time.Hour)) {
+		t.Errorf("unexpected memberships %+v", memberships)
+	}
+
+	memberships, err = WorkspacesOf("bob", nil, memberRole, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(memberships) != 2 || memberships[0].Workspace != "prod" || memberships[0].Role != "workspace-admin" || memberships[1].Role != "workspace-regular" {
+		t.Errorf("unexpected memberships by role %+v", memberships)
+	}
+
+	memberships, err = WorkspacesOf("bob", &params.Conditions{Fuzzy: map[string]string{memberWorkspace: "pro"}}, "", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(memberships) != 1 || memberships[0].Workspace != "prod" {
+		t.Errorf("unexpected filtered memberships %+v", memberships)
+	}
+
+	if memberships, err := WorkspacesOf("dave", nil, "", false); err != nil || len(memberships) != 0 {
+		t.Errorf("expected no membership, got %+v %v", memberships, err)
+	}
+}
@@ -19,6 +19,8 @@
 package quotas
 
 import (
+	"context"
+
 	"github.com/golang/glog"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -53,33 +55,59 @@ var (
 		jobsKey: resources.Jobs, cronJobsKey: resources.CronJobs}
 )
 
-func getUsage(namespace, resource string) (int, error) {
-	list, err := resources.ListNamespaceResource(namespace, resource, &params.Conditions{}, "", false, -1, 0)
+// getUsages counts resources of keys of resourceMap concurrently, usages of kinds timed out are missing
+func getUsages(ctx context.Context, namespace string, keys []string) (map[string]int, []models.SearchWarning, error) {
+	requests := make([]resources.SearchRequest, 0, len(keys))
+	for _, key := range keys {
+		requests = append(requests, resources.SearchRequest{Kind: resourceMap[key], Namespace: namespace, Conditions: &params.Conditions{}})
+	}
+
+	lists, warnings, err := resources.SearchAll(ctx, requests)
+
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	return list.TotalCount, nil
+
+	usages := make(map[string]int)
+	for i, list := range lists {
+		if list != nil {
+			usages[keys[i]] = list.TotalCount
+		}
+	}
+
+	return usages, warnings, nil
 }
 
-func GetClusterQuotas() (*models.ResourceQuota, error) {
+func GetClusterQuotas(ctx context.Context) (*models.ResourceQuota, error) {
 
 	quota := v1.ResourceQuotaStatus{Hard: make(v1.ResourceList), Used: make(v1.ResourceList)}
 
-	for k, v := range resourceMap {
-		used, err := getUsage("", v)
-		if err != nil {
-			return nil, err
-		}
+	keys := make([]string, 0, len(resourceMap))
+	for k := range resourceMap {
+		keys = append(keys, k)
+	}
+
+	usages, warnings, err := getUsages(ctx, "", keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, used := range usages {
 		var quantity resource.Quantity
 		quantity.Set(int64(used))
 		quota.Used[v1.ResourceName(k)] = quantity
 	}
 
-	return &models.ResourceQuota{Namespace: "\"\"", Data: quota}, nil
+	result := &models.ResourceQuota{Namespace: "\"\"", Data: quota}
+	if len(warnings) > 0 {
+		result.Warnings = warnings
+	}
+
+	return result, nil
 
 }
 
-func GetNamespaceQuotas(namespace string) (*models.ResourceQuota, error) {
+func GetNamespaceQuotas(ctx context.Context, namespace string) (*models.ResourceQuota, error) {
 	quota, err := getNamespaceResourceQuota(namespace)
 	if err != nil {
 		glog.Error(err)
@@ -89,23 +117,33 @@ func GetNamespaceQuotas(namespace string) (*models.ResourceQuota, error) {
 		quota = &v1.ResourceQuotaStatus{Hard: make(v1.ResourceList), Used: make(v1.ResourceList)}
 	}
 
-	for k, v := range resourceMap {
+	var keys []string
+	for k := range resourceMap {
 		if _, exist := quota.Used[v1.ResourceName(k)]; !exist {
 			if k == namespaceKey || k == storageClassesKey {
 				continue
 			}
-
-			used, err := getUsage(namespace, v)
-			if err != nil {
-				return nil, err
-			}
-			var quantity resource.Quantity
-			quantity.Set(int64(used))
-			quota.Used[v1.ResourceName(k)] = quantity
+			keys = append(keys, k)
 		}
 	}
 
-	return &models.ResourceQuota{Namespace: namespace, Data: *quota}, nil
+	usages, warnings, err := getUsages(ctx, namespace, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, used := range usages {
+		var quantity resource.Quantity
+		quantity.Set(int64(used))
+		quota.Used[v1.ResourceName(k)] = quantity
+	}
+
+	result := &models.ResourceQuota{Namespace: namespace, Data: *quota}
+	if len(warnings) > 0 {
+		result.Warnings = warnings
+	}
+
+	return result, nil
 }
 
 func updateNamespaceQuota(tmpResourceList, resourceList v1.ResourceList) {
@@ -0,0 +1,346 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	alertTickInterval        = time.Second
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookAttempts   = 3
+	defaultWebhookRetryDelay = 2 * time.Second
+)
+
+// SearchAlert runs a saved search every interval and posts the items which started or stopped
+// matching to the webhook.
+type SearchAlert struct {
+	Name       string
+	Search     SearchRequest
+	Interval   time.Duration
+	WebhookURL string
+}
+
+// AlertStatus is the result of the last evaluation of an alert.
+type AlertStatus struct {
+	Name      string    `json:"name"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+	Matched   int       `json:"matched"`
+}
+
+// AlertNotification is posted to the webhook of an alert, items are namespace/name keys, or
+// names of cluster resources.
+type AlertNotification struct {
+	Alert     string    `json:"alert"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Time      time.Time `json:"time"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+}
+
+type alertState struct {
+	alert   SearchAlert
+	status  AlertStatus
+	matched map[string]bool
+	running bool
+}
+
+// AlertRunner evaluates the registered alerts on a ticker, at most concurrency alerts are
+// evaluated at a time. A failing search or webhook only affects its own alert.
+type AlertRunner struct {
+	mutex  sync.Mutex
+	alerts map[string]*alertState
+
+	client      *http.Client
+	concurrency int
+	attempts    int
+	retryDelay  time.Duration
+	now         func() time.Time
+}
+
+func NewAlertRunner(concurrency int) *AlertRunner {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &AlertRunner{
+		alerts:      make(map[string]*alertState),
+		client:      &http.Client{Timeout: defaultWebhookTimeout},
+		concurrency: concurrency,
+		attempts:    defaultWebhookAttempts,
+		retryDelay:  defaultWebhookRetryDelay,
+		now:         time.Now,
+	}
+}
+
+// Register adds the alert or replaces the alert with the same name, the first evaluation
+// reports every matching item as added.
+func (r *AlertRunner) Register(alert SearchAlert) error {
+	if alert.Name == "" {
+		return fmt.Errorf("alert name is empty")
+	}
+
+	if alert.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s of alert %s", alert.Interval, alert.Name)
+	}
+
+	namespaced, supported := IsNamespaced(alert.Search.Kind)
+
+	if !supported {
+		return kindUnavailable(alert.Search.Kind)
+	}
+
+	if !namespaced && alert.Search.Namespace != "" {
+		return &KindScopeError{Kind: alert.Search.Kind, Namespace: alert.Search.Namespace}
+	}
+
+	if u, err := url.Parse(alert.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid webhook url %q of alert %s", alert.WebhookURL, alert.Name)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.alerts[alert.Name] = &alertState{alert: alert, status: AlertStatus{Name: alert.Name}}
+
+	return nil
+}
+
+func (r *AlertRunner) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.alerts, name)
+}
+
+// Status returns the status of the alert, false if the alert isn't registered.
+func (r *AlertRunner) Status(name string) (AlertStatus, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state, ok := r.alerts[name]
+	if !ok {
+		return AlertStatus{}, false
+	}
+
+	return state.status, true
+}
+
+// ListStatus returns the status of all alerts ordered by name.
+func (r *AlertRunner) ListStatus() []AlertStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	list := make([]AlertStatus, 0, len(r.alerts))
+	for _, state := range r.alerts {
+		list = append(list, state.status)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	return list
+}
+
+// Run evaluates the alerts which are due until stopCh is closed.
+func (r *AlertRunner) Run(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	wait.Until(func() { r.runDue(ctx) }, alertTickInterval, stopCh)
+}
+
+// runDue evaluates the alerts whose interval elapsed since their last run and waits for them.
+func (r *AlertRunner) runDue(ctx context.Context) {
+	now := r.now()
+	due := make([]*alertState, 0)
+
+	r.mutex.Lock()
+	for _, state := range r.alerts {
+		if !state.running && !now.Before(state.status.LastRun.Add(state.alert.Interval)) {
+			state.running = true
+			due = append(due, state)
+		}
+	}
+	r.mutex.Unlock()
+
+	group, groupCtx := newLimitedGroup(ctx, r.concurrency)
+
+	for _, state := range due {
+		state := state
+		group.Go(func() error {
+			r.evaluate(groupCtx, state)
+			return nil
+		})
+	}
+
+	group.Wait()
+
+	// alerts skipped because of cancellation are due again on the next tick
+	r.mutex.Lock()
+	for _, state := range due {
+		state.running = false
+	}
+	r.mutex.Unlock()
+}
+
+func (r *AlertRunner) evaluate(ctx context.Context, state *alertState) {
+	alert := state.alert
+	matched, err := r.search(ctx, alert.Search)
+
+	var added, removed []string
+	if err == nil {
+		r.mutex.Lock()
+		added, removed = diffKeys(state.matched, matched)
+		r.mutex.Unlock()
+
+		if len(added) > 0 || len(removed) > 0 {
+			err = r.notify(ctx, alert, added, removed)
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state.status.LastRun = r.now()
+	if err != nil {
+		// keep the previous items, the changes are reported again on the next run
+		glog.Errorf("evaluate alert %s failed: %v", alert.Name, err)
+		state.status.LastError = err.Error()
+		return
+	}
+
+	state.status.LastError = ""
+	state.status.Matched = len(matched)
+	state.matched = matched
+}
+
+func (r *AlertRunner) search(ctx context.Context, request SearchRequest) (map[string]bool, error) {
+	result, err := searchBranch(ctx, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make(map[string]bool, len(result.Items))
+	for _, item := range result.Items {
+		object, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		key := object.GetName()
+		if object.GetNamespace() != "" {
+			key = object.GetNamespace() + "/" + key
+		}
+		matched[key] = true
+	}
+
+	return matched, nil
+}
+
+func diffKeys(previous, current map[string]bool) (added []string, removed []string) {
+	added, removed = make([]string, 0), make([]string, 0)
+
+	for key := range current {
+		if !previous[key] {
+			added = append(added, key)
+		}
+	}
+
+	for key := range previous {
+		if !current[key] {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+// notify posts the changes to the webhook, failed posts and responses other than 2xx are retried.
+func (r *AlertRunner) notify(ctx context.Context, alert SearchAlert, added, removed []string) error {
+	body, err := json.Marshal(AlertNotification{
+		Alert:     alert.Name,
+		Kind:      alert.Search.Kind,
+		Namespace: alert.Search.Namespace,
+		Time:      r.now(),
+		Added:     added,
+		Removed:   removed,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = r.post(ctx, alert.WebhookURL, body)
+
+		if err == nil || attempt >= r.attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retryDelay):
+		}
+	}
+}
+
+func (r *AlertRunner) post(ctx context.Context, webhook string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook %s responded %s", webhook, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// recordingWebhook records notifications, the first failures requests are answered with 500
+type recordingWebhook struct {
+	mutex         sync.Mutex
+	failures      int
+	requests      int
+	notifications []AlertNotification
+}
+
+func (h *recordingWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.requests++
+	if h.failures > 0 {
+		h.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var notification AlertNotification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	h.notifications = append(h.notifications, notification)
+}
+
+func (h *recordingWebhook) received() (int, []AlertNotification) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.requests, append([]AlertNotification{}, h.notifications...)
+}
+
+// newTestAlertRunner returns a runner driven by now, the returned function closes its connections
+// and awaits their goroutines.
+func newTestAlertRunner(t *testing.T, now *time.Time) (*AlertRunner, func()) {
+	before := runtime.NumGoroutine()
+	transport := &http.Transport{}
+
+	runner := NewAlertRunner(2)
+	runner.client = &http.Client{Transport: transport}
+	runner.retryDelay = 0
+	runner.now = func() time.Time { return *now }
+
+	return runner, func() {
+		transport.CloseIdleConnections()
+		expectNoLeak(t, before)
+	}
+}
+
+func TestAlertRunner(t *testing.T) {
+	factory := setupInformers(t,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web-1", Labels: map[string]string{"app": "web"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "db-1", Labels: map[string]string{"app": "db"}}},
+	)
+	indexer := factory.Core().V1().Pods().Informer().GetIndexer()
+
+	webhook := &recordingWebhook{}
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	runner, done := newTestAlertRunner(t, &now)
+	defer done()
+
+	alert := SearchAlert{
+		Name:       "web-pods",
+		Search:     SearchRequest{Kind: Pods, Namespace: "prod", Conditions: &params.Conditions{Fuzzy: map[string]string{"label": "web"}}},
+		Interval:   time.Minute,
+		WebhookURL: server.URL,
+	}
+
+	if err := runner.Register(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first evaluation reports the matching items as added
+	runner.runDue(context.Background())
+
+	// not due yet, a new pod isn't reported
+	addToIndexer(t, indexer, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web-2", Labels: map[string]string{"app": "web"}}})
+	now = now.Add(30 * time.Second)
+	runner.runDue(context.Background())
+
+	if err := indexer.Delete(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	runner.runDue(context.Background())
+
+	// nothing changed, nothing is posted
+	now = now.Add(time.Minute)
+	runner.runDue(context.Background())
+
+	_, notifications := webhook.received()
+
+	expected := [][2][]string{
+		{{"prod/web-1"}, {}},
+		{{"prod/web-2"}, {"prod/web-1"}},
+	}
+
+	if len(notifications) != len(expected) {
+		t.Fatalf("expected %d notifications, got %+v", len(expected), notifications)
+	}
+
+	for i, notification := range notifications {
+		if notification.Alert != "web-pods" || !reflect.DeepEqual(notification.Added, expected[i][0]) || !reflect.DeepEqual(notification.Removed, expected[i][1]) {
+			t.Errorf("unexpected notification %+v", notification)
+		}
+	}
+
+	status, ok := runner.Status("web-pods")
+
+	if !ok || !status.LastRun.Equal(now) || status.LastError != "" || status.Matched != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestAlertRunnerWebhookFailure(t *testing.T) {
+	setupInformers(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "web-1"}})
+
+	flaky := &recordingWebhook{failures: 2}
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+
+	broken := &recordingWebhook{failures: 100}
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	runner, done := newTestAlertRunner(t, &now)
+	defer done()
+
+	for _, alert := range []SearchAlert{
+		{Name: "flaky", Search: SearchRequest{Kind: Pods, Namespace: "prod", Conditions: &params.Conditions{}}, Interval: time.Minute, WebhookURL: flakyServer.URL},
+		{Name: "broken", Search: SearchRequest{Kind: Pods, Namespace: "prod", Conditions: &params.Conditions{}}, Interval: time.Minute, WebhookURL: brokenServer.URL},
+	} {
+		if err := runner.Register(alert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner.runDue(context.Background())
+
+	// the third attempt succeeds
+	if requests, notifications := flaky.received(); requests != 3 || len(notifications) != 1 {
+		t.Errorf("expected notification after 3 attempts, got %d requests %+v", requests, notifications)
+	}
+
+	if requests, _ := broken.received(); requests != 3 {
+		t.Errorf("expected 3 attempts, got %d", requests)
+	}
+
+	list := runner.ListStatus()
+
+	if len(list) != 2 || list[0].Name != "broken" || list[0].LastError == "" || list[1].Name != "flaky" || list[1].LastError != "" {
+		t.Errorf("unexpected status %+v", list)
+	}
+
+	// the changes are reported again once the webhook recovers
+	broken.mutex.Lock()
+	broken.failures = 0
+	broken.mutex.Unlock()
+
+	now = now.Add(time.Minute)
+	runner.runDue(context.Background())
+
+	if _, notifications := broken.received(); len(notifications) != 1 || !reflect.DeepEqual(notifications[0].Added, []string{"prod/web-1"}) {
+		t.Errorf("unexpected notifications %+v", notifications)
+	}
+
+	if status, _ := runner.Status("broken"); status.LastError != "" || status.Matched != 1 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestAlertRunnerRegister(t *testing.T) {
+	runner := NewAlertRunner(1)
+
+	tests := []struct {
+		alert SearchAlert
+		fail  bool
+	}{
+		{alert: SearchAlert{Name: "pods", Search: SearchRequest{Kind: Pods}, Interval: time.Minute, WebhookURL: "http://example.com/hook"}},
+		{alert: SearchAlert{Name: "", Search: SearchRequest{Kind: Pods}, Interval: time.Minute, WebhookURL: "http://example.com/hook"}, fail: true},
+		{alert: SearchAlert{Name: "foo", Search: SearchRequest{Kind: "foo"}, Interval: time.Minute, WebhookURL: "http://example.com/hook"}, fail: true},
+		{alert: SearchAlert{Name: "nodes", Search: SearchRequest{Kind: Nodes, Namespace: "demo"}, Interval: time.Minute, WebhookURL: "http://example.com/hook"}, fail: true},
+		{alert: SearchAlert{Name: "interval", Search: SearchRequest{Kind: Pods}, WebhookURL: "http://example.com/hook"}, fail: true},
+		{alert: SearchAlert{Name: "url", Search: SearchRequest{Kind: Pods}, Interval: time.Minute, WebhookURL: "example.com"}, fail: true},
+	}
+
+	for _, test := range tests {
+		err := runner.Register(test.alert)
+		if test.fail != (err != nil) {
+			t.Errorf("alert %+v: expected fail %v, got %v", test.alert, test.fail, err)
+		}
+	}
+
+	if _, ok := runner.Status("pods"); !ok {
+		t.Error("expected alert pods registered")
+	}
+
+	runner.Unregister("pods")
+
+	if _, ok := runner.Status("pods"); ok {
+		t.Error("expected alert pods unregistered")
+	}
+}
+
+func addToIndexer(t *testing.T, indexer cache.Indexer, object interface{}) {
+	if err := indexer.Add(object); err != nil {
+		t.Fatal(err)
+	}
+}
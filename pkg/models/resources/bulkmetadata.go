@@ -0,0 +1,249 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
+)
+
+const defaultBulkPatchConcurrency = 5
+
+// systemKeyDomains are the domains of label and annotation keys reserved to Kubernetes and KubeSphere
+var systemKeyDomains = []string{"kubernetes.io", "kubesphere.io"}
+
+// MetadataPatchResult is the outcome of a bulk metadata patch for an object
+type MetadataPatchResult struct {
+	Name string `json:"name"`
+	// JSON merge patch of the object
+	Patch string `json:"patch"`
+	// false in a dry run or if the patch failed
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkMetadataPatcher patches the labels and annotations of several objects of a kind
+type BulkMetadataPatcher struct {
+	patcher objectPatcher
+	// patches in flight at most
+	concurrency int
+	// keys of the Kubernetes and KubeSphere domains may be changed
+	allowSystemKeys bool
+}
+
+var (
+	bulkPatcherOnce    sync.Once
+	defaultBulkPatcher *BulkMetadataPatcher
+)
+
+// NewBulkMetadataPatcher returns a patcher sending at most concurrency patches at once, keys of the
+// kubernetes.io and kubesphere.io domains are refused unless allowSystemKeys.
+func NewBulkMetadataPatcher(client kubernetes.Interface, concurrency int, allowSystemKeys bool) *BulkMetadataPatcher {
+	return &BulkMetadataPatcher{patcher: &clientsetStore{client: client}, concurrency: concurrency, allowSystemKeys: allowSystemKeys}
+}
+
+func sharedBulkPatcher() *BulkMetadataPatcher {
+	bulkPatcherOnce.Do(func() {
+		defaultBulkPatcher = NewBulkMetadataPatcher(k8s.Client(), defaultBulkPatchConcurrency, false)
+	})
+	return defaultBulkPatcher
+}
+
+// BulkPatchMetadata adds labels and annotations to and removes labels from the named objects of a
+// kind in namespace, the values of removeLabels are ignored. Keys of system domains are refused.
+// A dry run returns the patches without applying them.
+func BulkPatchMetadata(kind, namespace string, names []string, addLabels, removeLabels, addAnnotations map[string]string, dryRun bool) ([]MetadataPatchResult, error) {
+	return sharedBulkPatcher().Patch(kind, namespace, names, addLabels, removeLabels, addAnnotations, dryRun)
+}
+
+// Patch validates the changes and patches the objects, the error is nil if the changes are valid,
+// failures of the objects are reported in their results in the order of names.
+func (p *BulkMetadataPatcher) Patch(kind, namespace string, names []string, addLabels, removeLabels, addAnnotations map[string]string, dryRun bool) ([]MetadataPatchResult, error) {
+	kind, err := ResolveKind(kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !patchable(kind) {
+		return nil, kindUnavailable(kind)
+	}
+
+	if namespace == "" {
+		return nil, &KindScopeError{Kind: kind, Namespaced: true}
+	}
+
+	if err := p.validate(addLabels, removeLabels, addAnnotations); err != nil {
+		return nil, err
+	}
+
+	data := metadataPatch(addLabels, removeLabels, addAnnotations)
+
+	results := make([]MetadataPatchResult, len(names))
+	semaphore := make(chan struct{}, p.concurrency)
+
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		results[i] = MetadataPatchResult{Name: name, Patch: string(data)}
+
+		if dryRun {
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(result *MetadataPatchResult) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			if err := p.patcher.patch(kind, namespace, result.Name, types.MergePatchType, data); err != nil {
+				result.Error = err.Error()
+				return
+			}
+
+			result.Applied = true
+		}(&results[i])
+	}
+
+	wg.Wait()
+
+	return results, nil
+}
+
+// validate checks the keys and values against the syntax of labels and annotations
+func (p *BulkMetadataPatcher) validate(addLabels, removeLabels, addAnnotations map[string]string) error {
+	metadata := field.NewPath("metadata")
+
+	errs := metav1validation.ValidateLabels(addLabels, metadata.Child("labels"))
+	errs = append(errs, apivalidation.ValidateAnnotations(addAnnotations, metadata.Child("annotations"))...)
+
+	for _, key := range sortedKeys(removeLabels) {
+		errs = append(errs, metav1validation.ValidateLabelName(key, metadata.Child("labels"))...)
+	}
+
+	for _, key := range sortedKeys(addLabels) {
+		if _, ok := removeLabels[key]; ok {
+			errs = append(errs, field.Invalid(metadata.Child("labels").Key(key), key, "label both added and removed"))
+		}
+	}
+
+	if !p.allowSystemKeys {
+		for path, keys := range map[*field.Path]map[string]string{
+			metadata.Child("labels"):      addLabels,
+			metadata.Child("annotations"): addAnnotations,
+		} {
+			for _, key := range sortedKeys(keys) {
+				if isSystemKey(key) {
+					errs = append(errs, field.Forbidden(path.Key(key), "key of a system domain"))
+				}
+			}
+		}
+
+		for _, key := range sortedKeys(removeLabels) {
+			if isSystemKey(key) {
+				errs = append(errs, field.Forbidden(metadata.Child("labels").Key(key), "key of a system domain"))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %v", ErrInvalidMetadata, errs.ToAggregate())
+	}
+
+	return nil
+}
+
+// isSystemKey reports whether the prefix of key is a system domain or one of its subdomains
+func isSystemKey(key string) bool {
+	i := strings.Index(key, "/")
+
+	if i < 0 {
+		return false
+	}
+
+	prefix := key[:i]
+
+	for _, domain := range systemKeyDomains {
+		if prefix == domain || strings.HasSuffix(prefix, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patchable reports whether objects of kind can be patched
+func patchable(kind string) bool {
+	for _, k := range migratedKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func metadataPatch(addLabels, removeLabels, addAnnotations map[string]string) []byte {
+	labels := make(map[string]interface{}, len(addLabels)+len(removeLabels))
+
+	for key := range removeLabels {
+		// null removes the key in a merge patch
+		labels[key] = nil
+	}
+
+	for key, value := range addLabels {
+		labels[key] = value
+	}
+
+	metadata := make(map[string]interface{})
+
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+
+	if len(addAnnotations) > 0 {
+		metadata["annotations"] = addAnnotations
+	}
+
+	// maps of strings always marshal, their keys are sorted
+	data, _ := json.Marshal(map[string]interface{}{"metadata": metadata})
+	return data
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
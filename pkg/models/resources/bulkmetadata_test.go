@@ -0,0 +1,130 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBulkPatchMetadataValidation(t *testing.T) {
+	patcher := &fakePatcher{}
+	bulk := &BulkMetadataPatcher{patcher: patcher, concurrency: 2}
+
+	tests := []struct {
+		name           string
+		addLabels      map[string]string
+		removeLabels   map[string]string
+		addAnnotations map[string]string
+		err            error
+	}{
+		{name: "invalid label key", addLabels: map[string]string{"team name": "web"}, err: ErrInvalidMetadata},
+		{name: "invalid label value", addLabels: map[string]string{"team": "-web"}, err: ErrInvalidMetadata},
+		{name: "too long label value", addLabels: map[string]string{"team": strings.Repeat("a", 64)}, err: ErrInvalidMetadata},
+		{name: "invalid removed key", removeLabels: map[string]string{"a/b/c": ""}, err: ErrInvalidMetadata},
+		{name: "invalid annotation key", addAnnotations: map[string]string{"owner!": "alice"}, err: ErrInvalidMetadata},
+		{name: "label added and removed", addLabels: map[string]string{"team": "web"}, removeLabels: map[string]string{"team": ""}, err: ErrInvalidMetadata},
+		{name: "system label", addLabels: map[string]string{"kubernetes.io/role": "web"}, err: ErrInvalidMetadata},
+		{name: "system subdomain", addLabels: map[string]string{"node-role.kubernetes.io/master": ""}, err: ErrInvalidMetadata},
+		{name: "system annotation", addAnnotations: map[string]string{"kubesphere.io/creator": "alice"}, err: ErrInvalidMetadata},
+		{name: "removed system label", removeLabels: map[string]string{"kubesphere.io/workspace": ""}, err: ErrInvalidMetadata},
+		{name: "lookalike domain", addLabels: map[string]string{"notkubernetes.io/team": "web"}},
+		{name: "valid", addLabels: map[string]string{"example.com/team": "web"}, removeLabels: map[string]string{"tier": ""}, addAnnotations: map[string]string{"owner": "alice"}},
+	}
+
+	for _, test := range tests {
+		_, err := bulk.Patch(Deployments, "demo", []string{"web"}, test.addLabels, test.removeLabels, test.addAnnotations, true)
+
+		if !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	if len(patcher.patches) != 0 {
+		t.Errorf("expected nothing patched, got %v", patcher.patches)
+	}
+
+	if _, err := bulk.Patch(Nodes, "", []string{"node1"}, map[string]string{"team": "web"}, nil, nil, true); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected nodes unavailable, got %v", err)
+	}
+
+	if _, err := bulk.Patch(Deployments, "", []string{"web"}, map[string]string{"team": "web"}, nil, nil, true); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected the namespace required, got %v", err)
+	}
+
+	bulk.allowSystemKeys = true
+
+	if _, err := bulk.Patch(Deployments, "demo", []string{"web"}, map[string]string{"kubesphere.io/workspace": "system"}, nil, nil, true); err != nil {
+		t.Errorf("expected system keys allowed, got %v", err)
+	}
+}
+
+func TestBulkPatchMetadata(t *testing.T) {
+	patcher := &fakePatcher{failOn: migrationKey(Deployments, "demo", "db")}
+	bulk := &BulkMetadataPatcher{patcher: patcher, concurrency: 2}
+
+	names := []string{"web", "db", "cache", "queue"}
+	addLabels := map[string]string{"team": "web"}
+	removeLabels := map[string]string{"tier": ""}
+	addAnnotations := map[string]string{"owner": "alice"}
+
+	patch := `{"metadata":{"annotations":{"owner":"alice"},"labels":{"team":"web","tier":null}}}`
+
+	results, err := bulk.Patch("deploy", "demo", names, addLabels, removeLabels, addAnnotations, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if result.Name != names[i] || result.Patch != patch || result.Applied || result.Error != "" {
+			t.Errorf("expected the patch of %s computed, got %+v", names[i], result)
+		}
+	}
+
+	if len(patcher.patches) != 0 {
+		t.Errorf("expected nothing patched in a dry run, got %v", patcher.patches)
+	}
+
+	results, err = bulk.Patch(Deployments, "demo", names, addLabels, removeLabels, addAnnotations, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		failed := names[i] == "db"
+		if result.Name != names[i] || result.Applied == failed || (result.Error != "") != failed {
+			t.Errorf("expected %s applied %v, got %+v", names[i], !failed, result)
+		}
+	}
+
+	var expected []string
+	for _, name := range []string{"cache", "queue", "web"} {
+		expected = append(expected, migrationKey(Deployments, "demo", name)+" "+patch)
+	}
+
+	sort.Strings(patcher.patches)
+
+	if !reflect.DeepEqual(patcher.patches, expected) {
+		t.Errorf("expected the other objects patched %v, got %v", expected, patcher.patches)
+	}
+}
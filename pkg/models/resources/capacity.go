@@ -0,0 +1,316 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+)
+
+const (
+	// namespaces of the capacity summary, by cpu requests
+	capacityTopNamespaces = 10
+	nodeRoleLabelPrefix   = "node-role.kubernetes.io/"
+	// role of the nodes without role label
+	defaultNodeRole = "worker"
+)
+
+// ResourceCapacity is the allocatable quantity of a resource and the part of it requested and
+// limited by pods, percentages are of the allocatable quantity, 0 if nothing is allocatable.
+type ResourceCapacity struct {
+	Allocatable     resource.Quantity `json:"allocatable"`
+	Requests        resource.Quantity `json:"requests"`
+	Limits          resource.Quantity `json:"limits"`
+	RequestsPercent float64           `json:"requestsPercent"`
+	LimitsPercent   float64           `json:"limitsPercent"`
+}
+
+// CapacitySummary is the capacity of cpu, memory and pods of a set of nodes. The requests of pods
+// are the number of pods, they have no limits.
+type CapacitySummary struct {
+	Nodes  int              `json:"nodes"`
+	CPU    ResourceCapacity `json:"cpu"`
+	Memory ResourceCapacity `json:"memory"`
+	Pods   ResourceCapacity `json:"pods"`
+}
+
+// NamespaceCapacity is the part of the cluster capacity requested by the pods of a namespace
+type NamespaceCapacity struct {
+	Namespace string          `json:"namespace"`
+	Capacity  CapacitySummary `json:"capacity"`
+}
+
+// ClusterCapacitySummary is the allocatable capacity of the nodes and the requests and limits of
+// the pods which aren't terminated.
+type ClusterCapacitySummary struct {
+	// nodes which are ready and schedulable
+	Cluster CapacitySummary `json:"cluster"`
+	// ready and schedulable nodes by the roles of their node-role.kubernetes.io labels, a node
+	// counts in each of its roles
+	Roles map[string]*CapacitySummary `json:"roles"`
+	// namespaces requesting the most cpu, percentages are of the cluster allocatable
+	Namespaces []NamespaceCapacity `json:"namespaces"`
+	// cordoned and not ready nodes and their pods, they aren't part of the cluster capacity
+	Unavailable CapacitySummary        `json:"unavailable"`
+	Cordoned    []string               `json:"cordoned"`
+	NotReady    []string               `json:"notReady"`
+	Warnings    []models.SearchWarning `json:"warnings,omitempty"`
+}
+
+// ClusterCapacity summarizes the capacity of the cluster from the node and pod caches
+func ClusterCapacity() (*ClusterCapacitySummary, error) {
+	return clusterCapacity(informers.SharedInformerFactory())
+}
+
+func clusterCapacity(factory k8sinformers.SharedInformerFactory) (*ClusterCapacitySummary, error) {
+	for _, kind := range []string{Nodes, Pods} {
+		if !cacheSynced(factory, kind) {
+			return nil, fmt.Errorf("%w: %s", ErrNotSynced, kind)
+		}
+	}
+
+	nodes, err := factory.Core().V1().Nodes().Lister().List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := factory.Core().V1().Pods().Lister().List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	byNode := make(map[string]*CapacitySummary, len(nodes))
+	byNamespace := make(map[string]*CapacitySummary)
+
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		totals := podTotals(pod)
+
+		namespace, ok := byNamespace[pod.Namespace]
+		if !ok {
+			namespace = &CapacitySummary{}
+			byNamespace[pod.Namespace] = namespace
+		}
+		namespace.addPod(totals)
+
+		// pending pods aren't on a node yet
+		if pod.Spec.NodeName != "" {
+			node, ok := byNode[pod.Spec.NodeName]
+			if !ok {
+				node = &CapacitySummary{}
+				byNode[pod.Spec.NodeName] = node
+			}
+			node.addPod(totals)
+		}
+	}
+
+	summary := &ClusterCapacitySummary{Roles: make(map[string]*CapacitySummary), Cordoned: make([]string, 0), NotReady: make([]string, 0)}
+
+	for _, node := range nodes {
+		capacity, ok := byNode[node.Name]
+		if !ok {
+			capacity = &CapacitySummary{}
+		}
+		capacity.addNode(node)
+
+		cordoned, ready := node.Spec.Unschedulable, nodeReady(node)
+
+		if cordoned {
+			summary.Cordoned = append(summary.Cordoned, node.Name)
+		}
+		if !ready {
+			summary.NotReady = append(summary.NotReady, node.Name)
+		}
+
+		if cordoned || !ready {
+			summary.Unavailable.add(capacity)
+			continue
+		}
+
+		summary.Cluster.add(capacity)
+
+		for _, role := range nodeRoles(node) {
+			if summary.Roles[role] == nil {
+				summary.Roles[role] = &CapacitySummary{}
+			}
+			summary.Roles[role].add(capacity)
+		}
+	}
+
+	summary.Cluster.computePercents()
+	summary.Unavailable.computePercents()
+
+	for _, role := range summary.Roles {
+		role.computePercents()
+	}
+
+	summary.Namespaces = topNamespaces(byNamespace, summary.Cluster, capacityTopNamespaces)
+
+	sort.Strings(summary.Cordoned)
+	sort.Strings(summary.NotReady)
+
+	if informers.IsLabelScoped(Pods) {
+		summary.Warnings = append(summary.Warnings, models.SearchWarning{
+			Code:    models.WarningPartialCache,
+			Kind:    Pods,
+			Message: fmt.Sprintf("only %s matching %s are cached, requests are partial", Pods, informers.LabelSelector()),
+		})
+	}
+
+	return summary, nil
+}
+
+// podTotals returns the requests and limits of a pod like the scheduler does, the greatest
+// of the sum of the containers and of each init container.
+func podTotals(pod *corev1.Pod) ResourceTotals {
+	totals := podSpecTotals(&pod.Spec, 1)
+
+	for _, container := range pod.Spec.InitContainers {
+		init := podSpecTotals(&corev1.PodSpec{Containers: []corev1.Container{container}}, 1)
+		maxQuantity(&totals.CPURequests, init.CPURequests)
+		maxQuantity(&totals.CPULimits, init.CPULimits)
+		maxQuantity(&totals.MemoryRequests, init.MemoryRequests)
+		maxQuantity(&totals.MemoryLimits, init.MemoryLimits)
+	}
+
+	return totals
+}
+
+func maxQuantity(total *resource.Quantity, quantity resource.Quantity) {
+	if quantity.Cmp(*total) > 0 {
+		*total = quantity
+	}
+}
+
+func (c *CapacitySummary) addPod(totals ResourceTotals) {
+	c.CPU.Requests.Add(totals.CPURequests)
+	c.CPU.Limits.Add(totals.CPULimits)
+	c.Memory.Requests.Add(totals.MemoryRequests)
+	c.Memory.Limits.Add(totals.MemoryLimits)
+	c.Pods.Requests.Add(*resource.NewQuantity(1, resource.DecimalSI))
+}
+
+func (c *CapacitySummary) addNode(node *corev1.Node) {
+	c.Nodes++
+	addQuantity(&c.CPU.Allocatable, node.Status.Allocatable, corev1.ResourceCPU)
+	addQuantity(&c.Memory.Allocatable, node.Status.Allocatable, corev1.ResourceMemory)
+	addQuantity(&c.Pods.Allocatable, node.Status.Allocatable, corev1.ResourcePods)
+}
+
+func (c *CapacitySummary) add(other *CapacitySummary) {
+	c.Nodes += other.Nodes
+	for _, pair := range [][2]*ResourceCapacity{{&c.CPU, &other.CPU}, {&c.Memory, &other.Memory}, {&c.Pods, &other.Pods}} {
+		pair[0].Allocatable.Add(pair[1].Allocatable)
+		pair[0].Requests.Add(pair[1].Requests)
+		pair[0].Limits.Add(pair[1].Limits)
+	}
+}
+
+// computePercents computes the percentages of the allocatable quantities of c
+func (c *CapacitySummary) computePercents() {
+	c.percentsOf(c)
+}
+
+// percentsOf computes the percentages of c relative to the allocatable quantities of total
+func (c *CapacitySummary) percentsOf(total *CapacitySummary) {
+	c.CPU.RequestsPercent = percent(c.CPU.Requests.MilliValue(), total.CPU.Allocatable.MilliValue())
+	c.CPU.LimitsPercent = percent(c.CPU.Limits.MilliValue(), total.CPU.Allocatable.MilliValue())
+	c.Memory.RequestsPercent = percent(c.Memory.Requests.Value(), total.Memory.Allocatable.Value())
+	c.Memory.LimitsPercent = percent(c.Memory.Limits.Value(), total.Memory.Allocatable.Value())
+	c.Pods.RequestsPercent = percent(c.Pods.Requests.Value(), total.Pods.Allocatable.Value())
+}
+
+// percent returns part of total in percent rounded to 2 decimals
+func percent(part, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 100
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// nodeRoles returns the roles of the node-role.kubernetes.io labels of node, sorted
+func nodeRoles(node *corev1.Node) []string {
+	var roles []string
+
+	for key := range node.Labels {
+		if role := strings.TrimPrefix(key, nodeRoleLabelPrefix); role != key && role != "" {
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == 0 {
+		return []string{defaultNodeRole}
+	}
+
+	sort.Strings(roles)
+	return roles
+}
+
+// topNamespaces returns the n namespaces requesting the most cpu, then memory, by name if equal
+func topNamespaces(byNamespace map[string]*CapacitySummary, cluster CapacitySummary, n int) []NamespaceCapacity {
+	namespaces := make([]NamespaceCapacity, 0, len(byNamespace))
+
+	for name, capacity := range byNamespace {
+		capacity.CPU.Allocatable = cluster.CPU.Allocatable
+		capacity.Memory.Allocatable = cluster.Memory.Allocatable
+		capacity.Pods.Allocatable = cluster.Pods.Allocatable
+		capacity.percentsOf(&cluster)
+		namespaces = append(namespaces, NamespaceCapacity{Namespace: name, Capacity: *capacity})
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		a, b := namespaces[i].Capacity, namespaces[j].Capacity
+		if c := a.CPU.Requests.Cmp(b.CPU.Requests); c != 0 {
+			return c > 0
+		}
+		if c := a.Memory.Requests.Cmp(b.Memory.Requests); c != 0 {
+			return c > 0
+		}
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	if len(namespaces) > n {
+		namespaces = namespaces[:n]
+	}
+
+	return namespaces
+}
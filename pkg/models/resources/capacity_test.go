@@ -0,0 +1,152 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sinformers "k8s.io/client-go/informers"
+)
+
+func capacityNode(name string, labels map[string]string, cordoned, ready bool) *corev1.Node {
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{Unschedulable: cordoned},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("4"), corev1.ResourceMemory: resource.MustParse("8Gi"), corev1.ResourcePods: resource.MustParse("110")},
+			Conditions:  []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func capacityPod(namespace, name, node string, phase corev1.PodPhase, cpu, memory string) *corev1.Pod {
+	container := corev1.Container{Name: "main"}
+	if cpu != "" {
+		container.Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(memory)}
+		container.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(memory)}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.PodSpec{NodeName: node, Containers: []corev1.Container{container}},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestClusterCapacity(t *testing.T) {
+	migrate := capacityPod("demo", "migrate", "worker", corev1.PodRunning, "500m", "256Mi")
+	// the init container requests more cpu than the containers
+	migrate.Spec.InitContainers = []corev1.Container{{Name: "init", Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")}}}}
+
+	factory := setupInformers(t,
+		capacityNode("master", map[string]string{nodeRoleLabelPrefix + "master": ""}, false, true),
+		capacityNode("worker", nil, false, true),
+		capacityNode("cordoned", nil, true, true),
+		capacityPod("kube-system", "apiserver", "master", corev1.PodRunning, "1", "1Gi"),
+		capacityPod("demo", "web", "worker", corev1.PodRunning, "2", "2Gi"),
+		migrate,
+		// pods without requests count as pods only
+		capacityPod("demo", "sidecar", "worker", corev1.PodRunning, "", ""),
+		capacityPod("other", "batch", "cordoned", corev1.PodRunning, "1", "1Gi"),
+		capacityPod("demo", "pending", "", corev1.PodPending, "500m", "512Mi"),
+		// terminated pods don't hold resources
+		capacityPod("demo", "done", "worker", corev1.PodSucceeded, "4", "8Gi"),
+		capacityPod("demo", "crashed", "master", corev1.PodFailed, "4", "8Gi"),
+	)
+
+	summary, err := clusterCapacity(factory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cluster := summary.Cluster
+
+	if cluster.Nodes != 2 || cluster.CPU.Allocatable.String() != "8" || cluster.CPU.Requests.String() != "4" || cluster.CPU.RequestsPercent != 50 {
+		t.Errorf("expected 4 of 8 cpu requested on 2 nodes, got %+v", cluster)
+	}
+
+	if cluster.Memory.Requests.String() != "3328Mi" || cluster.Memory.RequestsPercent != 20.31 {
+		t.Errorf("expected 3328Mi of 16Gi memory requested, got %+v", cluster.Memory)
+	}
+
+	if cluster.Pods.Requests.Value() != 4 || cluster.Pods.RequestsPercent != 1.82 {
+		t.Errorf("expected 4 pods of 220, got %+v", cluster.Pods)
+	}
+
+	if master := summary.Roles["master"]; master == nil || master.Nodes != 1 || master.CPU.RequestsPercent != 25 {
+		t.Errorf("expected 1 of 4 cpu of the master requested, got %+v", master)
+	}
+
+	if worker := summary.Roles[defaultNodeRole]; worker == nil || worker.Nodes != 1 || worker.CPU.Requests.String() != "3" || worker.Pods.Requests.Value() != 3 {
+		t.Errorf("expected 3 cpu and 3 pods of the worker, got %+v", worker)
+	}
+
+	unavailable := summary.Unavailable
+
+	if unavailable.Nodes != 1 || unavailable.CPU.Requests.String() != "1" || !reflect.DeepEqual(summary.Cordoned, []string{"cordoned"}) || len(summary.NotReady) != 0 {
+		t.Errorf("expected the cordoned node flagged, got %+v %v %v", unavailable, summary.Cordoned, summary.NotReady)
+	}
+
+	var namespaces []string
+	for _, namespace := range summary.Namespaces {
+		namespaces = append(namespaces, namespace.Namespace)
+	}
+
+	// the pending pod counts in its namespace
+	if !reflect.DeepEqual(namespaces, []string{"demo", "kube-system", "other"}) || summary.Namespaces[0].Capacity.CPU.Requests.String() != "3500m" || summary.Namespaces[0].Capacity.CPU.RequestsPercent != 43.75 {
+		t.Errorf("expected demo requesting 3500m of 8 cpu first, got %+v", summary.Namespaces)
+	}
+}
+
+func TestClusterCapacityNotReady(t *testing.T) {
+	factory := setupInformers(t,
+		capacityNode("master", nil, false, false),
+		capacityNode("worker", nil, true, false),
+	)
+
+	summary, err := clusterCapacity(factory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summary.Cluster.Nodes != 0 || summary.Cluster.CPU.RequestsPercent != 0 || summary.Unavailable.Nodes != 2 {
+		t.Errorf("expected no available node, got %+v", summary)
+	}
+
+	if !reflect.DeepEqual(summary.NotReady, []string{"master", "worker"}) || !reflect.DeepEqual(summary.Cordoned, []string{"worker"}) {
+		t.Errorf("expected both nodes not ready and the worker cordoned, got %v %v", summary.NotReady, summary.Cordoned)
+	}
+
+	synced := cacheSynced
+	defer func() { cacheSynced = synced }()
+	cacheSynced = func(_ k8sinformers.SharedInformerFactory, kind string) bool { return kind != Pods }
+
+	if _, err := clusterCapacity(factory); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("expected pods not synced, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// changes of a kind kept by its journal, older versions get a full resync
+const changeJournalSize = 4096
+
+// ChangeSet is what changed in the objects of a kind since a resource version
+type ChangeSet struct {
+	// the version of the next request
+	ResourceVersion string `json:"resourceVersion"`
+	// the version was too old, Items are every object matching the conditions
+	FullResync bool          `json:"fullResync"`
+	Items      []interface{} `json:"items"`
+	// namespace/name of the objects deleted or no longer matching the conditions
+	Deleted []string `json:"deleted"`
+}
+
+type journalEntry struct {
+	key             string
+	resourceVersion uint64
+}
+
+// changeJournal is a bounded ring of the keys of the objects of a kind changed by informer events
+// with their resource version. It answers the changes since a version down to its floor, the
+// version of the last change it forgot.
+type changeJournal struct {
+	mutex   sync.Mutex
+	entries []journalEntry
+	next    int
+	full    bool
+	floor   uint64
+	latest  uint64
+}
+
+func newChangeJournal(size int, floor uint64) *changeJournal {
+	return &changeJournal{entries: make([]journalEntry, size), floor: floor, latest: floor}
+}
+
+// record journals a change, the events replayed to a new handler for the objects already cached
+// are older than the floor and are skipped.
+func (j *changeJournal) record(key string, resourceVersion uint64) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if resourceVersion <= j.floor {
+		return
+	}
+
+	if j.full {
+		j.floor = j.entries[j.next].resourceVersion
+	}
+
+	j.entries[j.next] = journalEntry{key: key, resourceVersion: resourceVersion}
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+
+	if resourceVersion > j.latest {
+		j.latest = resourceVersion
+	}
+}
+
+// reset forgets the changes up to resourceVersion, the deletions missed by a relist can't be journaled
+func (j *changeJournal) reset(resourceVersion uint64) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if resourceVersion < j.latest {
+		resourceVersion = j.latest
+	}
+
+	j.entries = make([]journalEntry, len(j.entries))
+	j.next, j.full = 0, false
+	j.floor, j.latest = resourceVersion, resourceVersion
+}
+
+// since returns the keys changed after resourceVersion and the latest version journaled, ok is false
+// if the journal forgot changes after resourceVersion.
+func (j *changeJournal) since(resourceVersion uint64) (keys []string, latest uint64, ok bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if resourceVersion < j.floor {
+		return nil, j.latest, false
+	}
+
+	changed := make(map[string]bool)
+	keys = make([]string, 0)
+
+	for _, entry := range j.entries {
+		if entry.key != "" && entry.resourceVersion > resourceVersion && !changed[entry.key] {
+			changed[entry.key] = true
+			keys = append(keys, entry.key)
+		}
+	}
+
+	return keys, j.latest, true
+}
+
+// journalRegistry keeps a journal per kind, the journal of a kind is created and fed by an
+// informer event handler on its first use.
+type journalRegistry struct {
+	mutex    sync.Mutex
+	journals map[string]*changeJournal
+}
+
+var journals = &journalRegistry{journals: make(map[string]*changeJournal)}
+
+func (r *journalRegistry) journal(informer cache.SharedIndexInformer, kind string) *changeJournal {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if journal, ok := r.journals[kind]; ok {
+		return journal
+	}
+
+	floor, _ := strconv.ParseUint(informer.LastSyncResourceVersion(), 10, 64)
+	journal := newChangeJournal(changeJournalSize, floor)
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			journalChange(journal, informer, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			journalChange(journal, informer, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			journalChange(journal, informer, obj)
+		},
+	})
+
+	r.journals[kind] = journal
+
+	return journal
+}
+
+// journalChange records the change of obj, the deletions found by a relist carry the last known
+// state of the object, not the version of the deletion, so the journal starts over.
+func journalChange(journal *changeJournal, informer cache.SharedIndexInformer, obj interface{}) {
+	object, ok := obj.(metav1.Object)
+
+	if !ok {
+		resourceVersion, _ := strconv.ParseUint(informer.LastSyncResourceVersion(), 10, 64)
+		journal.reset(resourceVersion)
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	resourceVersion, parseErr := strconv.ParseUint(object.GetResourceVersion(), 10, 64)
+
+	if err != nil || parseErr != nil {
+		journal.reset(0)
+		return
+	}
+
+	journal.record(key, resourceVersion)
+}
+
+// Changes returns the objects of kind in namespace matching conditions changed since the resource
+// version since, and the keys of the ones deleted or no longer matching. Namespaced kinds are
+// tracked across namespaces if namespace is empty. A full resync is returned for an empty since,
+// or a version older than the changes journaled, the journal of a kind starts on its first request.
+// The changed objects are matched by a search of the kind, the saving is in the size of the response.
+func Changes(ctx context.Context, kind, namespace, since string, conditions *params.Conditions) (*ChangeSet, error) {
+	kind, err := checkScope(kind, namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var version uint64
+	if since != "" {
+		if version, err = strconv.ParseUint(since, 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: resource version %s", ErrInvalidCondition, since)
+		}
+	}
+
+	informer, err := informerFor(kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if conditions == nil {
+		conditions = &params.Conditions{}
+	}
+
+	keys, latest, ok := journals.journal(informer, kind).since(version)
+
+	changes := &ChangeSet{ResourceVersion: strconv.FormatUint(latest, 10), FullResync: since == "" || !ok, Items: make([]interface{}, 0), Deleted: make([]string, 0)}
+
+	// nothing changed, the cache isn't scanned
+	if !changes.FullResync && len(keys) == 0 {
+		return changes, nil
+	}
+
+	found, err := searchResources(ctx, kind, namespace, conditions, "", false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if changes.FullResync {
+		for _, item := range found {
+			changes.Items = append(changes.Items, deepCopy(item))
+		}
+		return changes, nil
+	}
+
+	matched := make(map[string]interface{}, len(found))
+	for _, item := range found {
+		if key, err := cache.MetaNamespaceKeyFunc(item); err == nil {
+			matched[key] = item
+		}
+	}
+
+	for _, key := range keys {
+		if keyNamespace, _, _ := cache.SplitMetaNamespaceKey(key); namespace != "" && keyNamespace != namespace {
+			continue
+		}
+		if item, ok := matched[key]; ok {
+			changes.Items = append(changes.Items, deepCopy(item))
+		} else {
+			changes.Deleted = append(changes.Deleted, key)
+		}
+	}
+
+	return changes, nil
+}
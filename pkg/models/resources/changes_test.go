@@ -0,0 +1,190 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func TestChangeJournal(t *testing.T) {
+	journal := newChangeJournal(3, 10)
+
+	// replayed for the objects cached before the journal started
+	journal.record("demo/old", 9)
+
+	journal.record("demo/a", 11)
+	journal.record("demo/b", 12)
+	journal.record("demo/a", 13)
+
+	if keys, latest, ok := journal.since(10); !ok || latest != 13 || !reflect.DeepEqual(keys, []string{"demo/a", "demo/b"}) {
+		t.Errorf("expected a and b changed up to 13, got %v %d %v", keys, latest, ok)
+	}
+
+	if keys, _, ok := journal.since(12); !ok || !reflect.DeepEqual(keys, []string{"demo/a"}) {
+		t.Errorf("expected a changed after 12, got %v %v", keys, ok)
+	}
+
+	// the change of 11 is forgotten
+	journal.record("demo/c", 14)
+
+	if _, _, ok := journal.since(10); ok {
+		t.Error("expected the changes after 10 forgotten")
+	}
+
+	if keys, _, ok := journal.since(11); !ok || len(keys) != 3 {
+		t.Errorf("expected 3 changes after 11, got %v %v", keys, ok)
+	}
+
+	journal.reset(12)
+
+	if _, _, ok := journal.since(13); ok {
+		t.Error("expected the journal starting over at its latest version")
+	}
+
+	if keys, latest, ok := journal.since(14); !ok || latest != 14 || len(keys) != 0 {
+		t.Errorf("expected no change after 14, got %v %d %v", keys, latest, ok)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	defer func(registry *journalRegistry) { journals = registry }(journals)
+	journals = &journalRegistry{journals: make(map[string]*changeJournal)}
+
+	pod := func(namespace, name, resourceVersion string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, ResourceVersion: resourceVersion, Labels: labels}}
+	}
+
+	factory := setupInformers(t, pod("demo", "web", "10", nil), pod("demo", "db", "11", nil), pod("other", "web", "9", nil))
+	indexer := factory.Core().V1().Pods().Informer().GetIndexer()
+
+	journal := newChangeJournal(8, 11)
+	journals.journals[Pods] = journal
+
+	changes, err := Changes(context.Background(), "pods", "demo", "", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changes.FullResync || len(changes.Items) != 2 || changes.ResourceVersion != "11" {
+		t.Errorf("expected a full resync of 2 pods at 11, got %+v", changes)
+	}
+
+	// informer events
+	change := func(obj interface{}, deleted bool) {
+		if deleted {
+			indexer.Delete(obj)
+		} else {
+			indexer.Update(obj)
+		}
+		journalChange(journal, factory.Core().V1().Pods().Informer(), obj)
+	}
+
+	change(pod("demo", "web", "12", map[string]string{"app": "web"}), false)
+	change(pod("demo", "cache", "13", nil), false)
+	change(pod("demo", "db", "14", nil), true)
+	change(pod("other", "web", "15", nil), false)
+
+	changes, err = Changes(context.Background(), "Pod", "demo", "11", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes.FullResync || changes.ResourceVersion != "15" || !reflect.DeepEqual(podKeys(changes.Items), []string{"demo/cache", "demo/web"}) || !reflect.DeepEqual(changes.Deleted, []string{"demo/db"}) {
+		t.Errorf("expected cache and web changed and db deleted, got %+v", changes)
+	}
+
+	// the changed pods no longer matching are reported deleted
+	changes, err = Changes(context.Background(), "po", "demo", "11", &params.Conditions{Fuzzy: map[string]string{label: "web"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(changes.Deleted)
+
+	if !reflect.DeepEqual(podKeys(changes.Items), []string{"demo/web"}) || !reflect.DeepEqual(changes.Deleted, []string{"demo/cache", "demo/db"}) {
+		t.Errorf("expected web changed, cache and db gone, got %+v", changes)
+	}
+
+	changes, err = Changes(context.Background(), "pods", "", "14", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(podKeys(changes.Items), []string{"other/web"}) || len(changes.Deleted) != 0 {
+		t.Errorf("expected the change of other across namespaces, got %+v", changes)
+	}
+
+	if changes, err = Changes(context.Background(), "pods", "demo", "15", nil); err != nil || len(changes.Items) != 0 || len(changes.Deleted) != 0 || changes.FullResync {
+		t.Errorf("expected no change after 15, got %+v %v", changes, err)
+	}
+
+	// the journal overflows, the client lagging behind resyncs
+	for i := 16; i < 30; i++ {
+		change(pod("demo", "web", fmt.Sprint(i), nil), false)
+	}
+
+	changes, err = Changes(context.Background(), "pods", "demo", "15", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !changes.FullResync || changes.ResourceVersion != "29" || len(changes.Items) != 2 || len(changes.Deleted) != 0 {
+		t.Errorf("expected a full resync of 2 pods at 29, got %+v", changes)
+	}
+
+	// a deletion found by a relist has no version, the journal starts over
+	change(cache.DeletedFinalStateUnknown{Key: "demo/cache", Obj: pod("demo", "cache", "13", nil)}, true)
+
+	if changes, err = Changes(context.Background(), "pods", "demo", "28", nil); err != nil || !changes.FullResync {
+		t.Errorf("expected a full resync after a relist, got %+v %v", changes, err)
+	}
+
+	if _, err := Changes(context.Background(), "pods", "demo", "abc", nil); !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected invalid resource version, got %v", err)
+	}
+
+	if _, err := Changes(context.Background(), "nodes", "demo", "", nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected invalid scope, got %v", err)
+	}
+}
+
+func podKeys(items []interface{}) []string {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		key, _ := cache.MetaNamespaceKeyFunc(item)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,329 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// Query selects, orders and pages the objects of a List or a Watch
+type Query struct {
+	// Conditions nil matches every object
+	Conditions *params.Conditions
+	OrderBy    string
+	Reverse    bool
+	// Limit -1 returns every object from Offset
+	Limit  int
+	Offset int
+	// UnsafeNoCopy returns the objects of the informer caches instead of copies. It saves the copy
+	// of each item for hot paths which only read the items and drop them, like counting or
+	// encoding them. Modifying them corrupts the caches of every reader, authorization included.
+	UnsafeNoCopy bool
+}
+
+// Result is a page of the objects matching a query, TotalCount counts all of them
+type Result struct {
+	Items      []runtime.Object `json:"items"`
+	TotalCount int              `json:"total_count"`
+	// Warnings reports the large objects of Items
+	Warnings []models.SearchWarning `json:"warnings,omitempty"`
+}
+
+// Interface searches resources, Client implements it over informer caches
+type Interface interface {
+	List(ctx context.Context, kind, namespace string, query Query) (*Result, error)
+	Get(ctx context.Context, kind, namespace, name string) (runtime.Object, error)
+	Watch(ctx context.Context, kind, namespace string, query Query) (<-chan *Result, error)
+}
+
+var _ Interface = &Client{}
+
+// Client queries the informer caches of a factory the way the resources API does, it's the
+// entry point of other components searching resources. Namespaced kinds are listed across
+// namespaces if namespace is empty, cluster scoped kinds require an empty namespace. Kinds are
+// named by any of the names accepted by ResolveKind.
+type Client struct {
+	factory k8sinformers.SharedInformerFactory
+
+	mutex    sync.Mutex
+	watchers map[string][]*watcher
+}
+
+type watcher struct {
+	namespace string
+	changed   chan struct{}
+}
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *Client
+)
+
+// NewClient returns a client searching the caches of factory, objects of s2i kinds are
+// searched in the shared s2i informer factory.
+func NewClient(factory k8sinformers.SharedInformerFactory) *Client {
+	return &Client{factory: factory, watchers: make(map[string][]*watcher)}
+}
+
+// SharedClient returns the client of the shared informer factory.
+func SharedClient() *Client {
+	sharedClientOnce.Do(func() {
+		sharedClient = NewClient(informers.SharedInformerFactory())
+	})
+	return sharedClient
+}
+
+// Start starts the informers of the kinds searched by the client, the searches of a kind fail with
+// ErrNotSynced until its cache has synced. The started informers aren't started again.
+func (c *Client) Start(stopCh <-chan struct{}) {
+	for kind := range namespacedResources {
+		informerIn(c.factory, kind)
+	}
+	for kind := range clusterResources {
+		informerIn(c.factory, kind)
+	}
+
+	c.factory.Start(stopCh)
+	informers.S2iSharedInformerFactory().Start(stopCh)
+}
+
+// List returns the objects of kind in namespace matching query, copies unless query.UnsafeNoCopy.
+func (c *Client) List(ctx context.Context, kind, namespace string, query Query) (*Result, error) {
+	kind, err := checkScope(kind, namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := query.Conditions
+	if conditions == nil {
+		conditions = &params.Conditions{}
+	}
+
+	found, err := searchIn(ctx, c.factory, kind, namespace, conditions, query.OrderBy, query.Reverse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := pageResult(kind, found, query.Limit, query.Offset, query.UnsafeNoCopy)
+	result := &Result{Items: make([]runtime.Object, 0, len(page.Items)), TotalCount: page.TotalCount, Warnings: page.Warnings}
+
+	for _, item := range page.Items {
+		result.Items = append(result.Items, item.(runtime.Object))
+	}
+
+	return result, nil
+}
+
+// Get returns a copy of the object of kind named name in namespace.
+func (c *Client) Get(ctx context.Context, kind, namespace, name string) (runtime.Object, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	kind, err := ResolveKind(kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespaced, _ := IsNamespaced(kind)
+
+	if namespaced != (namespace != "") {
+		return nil, &KindScopeError{Kind: kind, Namespaced: namespaced, Namespace: namespace}
+	}
+
+	if !cacheSynced(c.factory, kind) {
+		return nil, fmt.Errorf("%w: %s", ErrNotSynced, kind)
+	}
+
+	informer, err := informerIn(c.factory, kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := name
+	if namespaced {
+		key = namespace + "/" + name
+	}
+
+	item, exists, err := informer.GetIndexer().GetByKey(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+
+	return item.(runtime.Object).DeepCopyObject(), nil
+}
+
+// Watch sends the result of List when the watch starts, and a fresh one each time objects of kind in
+// namespace change. Changes are coalesced, a receiver falling behind gets the latest result only.
+// The channel is closed when ctx is done.
+func (c *Client) Watch(ctx context.Context, kind, namespace string, query Query) (<-chan *Result, error) {
+	kind, err := checkScope(kind, namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &watcher{namespace: namespace, changed: make(chan struct{}, 1)}
+
+	// registered before the first List, so no change is missed in between
+	if err := c.register(kind, w); err != nil {
+		return nil, err
+	}
+
+	result, err := c.List(ctx, kind, namespace, query)
+
+	if err != nil {
+		c.unregister(kind, w)
+		return nil, err
+	}
+
+	results := make(chan *Result, 1)
+	results <- result
+
+	go func() {
+		defer close(results)
+		defer c.unregister(kind, w)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.changed:
+			}
+
+			result, err := c.List(ctx, kind, namespace, query)
+
+			if err != nil {
+				if ctx.Err() == nil {
+					glog.Warningf("watch %s in %q: %v", kind, namespace, err)
+				}
+				continue
+			}
+
+			// replace the result the receiver hasn't read yet, this is the only sender so the send never blocks
+			select {
+			case <-results:
+			default:
+			}
+			results <- result
+		}
+	}()
+
+	return results, nil
+}
+
+func (c *Client) register(kind string, w *watcher) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// informer handlers can't be removed, the handler of kind is added once and kept
+	if _, handled := c.watchers[kind]; !handled {
+		informer, err := informerIn(c.factory, kind)
+
+		if err != nil {
+			return err
+		}
+
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.changed(kind, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.changed(kind, newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				c.changed(kind, obj)
+			},
+		})
+	}
+
+	c.watchers[kind] = append(c.watchers[kind], w)
+
+	return nil
+}
+
+func (c *Client) unregister(kind string, w *watcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	watchers := c.watchers[kind]
+	for i := range watchers {
+		if watchers[i] == w {
+			c.watchers[kind] = append(watchers[:i:i], watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// changed notifies the watchers of the namespace of obj
+func (c *Client) changed(kind string, obj interface{}) {
+	namespace := ""
+	if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+		namespace, _, _ = cache.SplitMetaNamespaceKey(key)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, w := range c.watchers[kind] {
+		if w.namespace != "" && w.namespace != namespace {
+			continue
+		}
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// checkScope returns the searcher key of kind, rejecting a namespace for cluster scoped kinds
+func checkScope(kind, namespace string) (string, error) {
+	kind, err := ResolveKind(kind)
+
+	if err != nil {
+		return "", err
+	}
+
+	if namespaced, _ := IsNamespaced(kind); !namespaced && namespace != "" {
+		return "", &KindScopeError{Kind: kind, Namespace: namespace}
+	}
+
+	return kind, nil
+}
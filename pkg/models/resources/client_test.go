@@ -0,0 +1,203 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/models/resources"
+	"kubesphere.io/kubesphere/pkg/models/resources/resourcestest"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func clientFixtures() []runtime.Object {
+	return []runtime.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "db"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "web"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+	}
+}
+
+// newTestClient returns a client of objects, the test stops it
+func newTestClient(t *testing.T, objects ...runtime.Object) *resourcestest.Client {
+	client, err := resourcestest.NewClient(objects...)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func names(items []runtime.Object) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, item.(metav1.Object).GetNamespace()+"/"+item.(metav1.Object).GetName())
+	}
+	return result
+}
+
+func TestClientList(t *testing.T) {
+	client := newTestClient(t, clientFixtures()...)
+	defer client.Stop()
+
+	tests := []struct {
+		kind      string
+		namespace string
+		query     resources.Query
+		expected  []string
+		total     int
+	}{
+		{kind: resources.Services, namespace: "demo", query: resources.Query{OrderBy: "name", Limit: -1}, expected: []string{"demo/db", "demo/web"}, total: 2},
+		{kind: resources.Services, query: resources.Query{Conditions: &params.Conditions{Match: map[string]string{"name": "web"}}, Limit: -1}, total: 2},
+		{kind: resources.Services, namespace: "demo", query: resources.Query{OrderBy: "name", Limit: 1, Offset: 1}, expected: []string{"demo/web"}, total: 2},
+		{kind: resources.Namespaces, query: resources.Query{Limit: -1}, expected: []string{"/demo"}, total: 1},
+	}
+
+	for _, test := range tests {
+		result, err := client.List(context.Background(), test.kind, test.namespace, test.query)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.TotalCount != test.total || (test.expected != nil && !reflect.DeepEqual(names(result.Items), test.expected)) {
+			t.Errorf("%s in %q with %+v: expected %v of %d, got %v of %d", test.kind, test.namespace, test.query, test.expected, test.total, names(result.Items), result.TotalCount)
+		}
+	}
+
+	if _, err := client.List(context.Background(), resources.Namespaces, "demo", resources.Query{}); !errors.Is(err, resources.ErrInvalidScope) {
+		t.Errorf("expected invalid scope, got %v", err)
+	}
+
+	if _, err := client.List(context.Background(), "foo", "", resources.Query{}); !errors.Is(err, resources.ErrKindUnavailable) {
+		t.Errorf("expected kind unavailable, got %v", err)
+	}
+}
+
+func TestClientGet(t *testing.T) {
+	client := newTestClient(t, clientFixtures()...)
+	defer client.Stop()
+
+	object, err := client.Get(context.Background(), resources.Services, "other", "web")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if service := object.(*corev1.Service); service.Namespace != "other" || service.Name != "web" {
+		t.Errorf("unexpected service %s/%s", service.Namespace, service.Name)
+	}
+
+	if _, err := client.Get(context.Background(), resources.Namespaces, "", "demo"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := client.Get(context.Background(), resources.Services, "other", "db"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := client.Get(context.Background(), resources.Services, "", "web"); !errors.Is(err, resources.ErrInvalidScope) {
+		t.Errorf("expected invalid scope, got %v", err)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	client := newTestClient(t, clientFixtures()...)
+	defer client.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results, err := client.Watch(ctx, resources.Services, "demo", resources.Query{Limit: -1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func() *resources.Result {
+		select {
+		case result := <-results:
+			return result
+		case <-time.After(time.Second):
+			t.Fatal("expected a result")
+			return nil
+		}
+	}
+
+	if result := receive(); result.TotalCount != 2 {
+		t.Errorf("expected 2 services, got %d", result.TotalCount)
+	}
+
+	// the change of other namespace isn't sent
+	if err := client.Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "cache"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Add(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "cache"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := receive(); result.TotalCount != 3 {
+		t.Errorf("expected 3 services, got %d", result.TotalCount)
+	}
+
+	if err := client.Delete(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "db"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := receive(); result.TotalCount != 2 {
+		t.Errorf("expected 2 services after the deletion, got %d", result.TotalCount)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Error("expected no result after the watch is cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected results closed")
+	}
+}
+
+func TestNamespaceWithPods(t *testing.T) {
+	client := newTestClient(t, resourcestest.NamespaceWithPods("demo", 3)...)
+	defer client.Stop()
+
+	result, err := client.List(context.Background(), resources.Pods, "demo", resources.Query{Limit: -1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.TotalCount != 3 {
+		t.Errorf("expected 3 pods, got %d", result.TotalCount)
+	}
+}
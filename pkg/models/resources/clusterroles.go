@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -35,7 +35,7 @@ func (*clusterRoleSearcher) match(match map[string]string, item *rbac.ClusterRol
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		default:
@@ -50,7 +50,7 @@ func (*clusterRoleSearcher) fuzzy(fuzzy map[string]string, item *rbac.ClusterRol
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -63,7 +63,7 @@ func (*clusterRoleSearcher) fuzzy(fuzzy map[string]string, item *rbac.ClusterRol
 			}
 			return false
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -75,6 +75,10 @@ func (*clusterRoleSearcher) fuzzy(fuzzy map[string]string, item *rbac.ClusterRol
 	return true
 }
 
+func (*clusterRoleSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*clusterRoleSearcher) compare(a, b *rbac.ClusterRole, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -86,8 +90,8 @@ func (*clusterRoleSearcher) compare(a, b *rbac.ClusterRole, orderBy string) bool
 	}
 }
 
-func (s *clusterRoleSearcher) search(conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	clusterRoles, err := informers.SharedInformerFactory().Rbac().V1().ClusterRoles().Lister().List(labels.Everything())
+func (s *clusterRoleSearcher) search(factory informers.SharedInformerFactory, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	clusterRoles, err := factory.Rbac().V1().ClusterRoles().Lister().List(labels.Everything())
 
 	if err != nil {
 		return nil, err
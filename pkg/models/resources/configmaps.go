@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -35,7 +35,7 @@ func (*configMapSearcher) match(match map[string]string, item *v1.ConfigMap) boo
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		default:
@@ -50,7 +50,7 @@ func (*configMapSearcher) fuzzy(fuzzy map[string]string, item *v1.ConfigMap) boo
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -67,7 +67,7 @@ func (*configMapSearcher) fuzzy(fuzzy map[string]string, item *v1.ConfigMap) boo
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -79,6 +79,10 @@ func (*configMapSearcher) fuzzy(fuzzy map[string]string, item *v1.ConfigMap) boo
 	return true
 }
 
+func (*configMapSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*configMapSearcher) compare(a, b *v1.ConfigMap, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -90,8 +94,12 @@ func (*configMapSearcher) compare(a, b *v1.ConfigMap, orderBy string) bool {
 	}
 }
 
-func (s *configMapSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	configMaps, err := informers.SharedInformerFactory().Core().V1().ConfigMaps().Lister().ConfigMaps(namespace).List(labels.Everything())
+func (s *configMapSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1.ConfigMap), b.(*v1.ConfigMap), orderBy)
+}
+
+func (s *configMapSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	configMaps, err := factory.Core().V1().ConfigMaps().Lister().ConfigMaps(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
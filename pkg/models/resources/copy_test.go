@@ -0,0 +1,122 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func cachedPod(t *testing.T) *corev1.Pod {
+	item, _, err := informers.SharedInformerFactory().Core().V1().Pods().Informer().GetIndexer().GetByKey("demo/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item.(*corev1.Pod)
+}
+
+func TestReturnedObjectsAreCopies(t *testing.T) {
+	setupInformers(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web", Labels: map[string]string{"app": "web"}}})
+
+	client := NewClient(informers.SharedInformerFactory())
+
+	mutate := func(object interface{}) {
+		pod := object.(*corev1.Pod)
+		pod.Labels["app"] = "mutated"
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "injected"})
+	}
+
+	page, err := ListNamespaceResource(context.Background(), "demo", Pods, &params.Conditions{}, "", false, -1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate(page.Items[0])
+
+	result, err := client.List(context.Background(), Pods, "demo", Query{Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate(result.Items[0])
+
+	object, err := client.Get(context.Background(), Pods, "demo", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutate(object)
+
+	if pod := cachedPod(t); pod.Labels["app"] != "web" || len(pod.Spec.Containers) != 0 {
+		t.Errorf("the cached pod is modified: %+v", pod)
+	}
+
+	// the search sees the cache unchanged
+	page, err = ListNamespaceResource(context.Background(), "demo", Pods, &params.Conditions{Fuzzy: map[string]string{label: "mutated"}}, "", false, -1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalCount != 0 {
+		t.Errorf("expected no pod labeled mutated, got %d", page.TotalCount)
+	}
+
+	result, err = client.List(context.Background(), Pods, "demo", Query{Limit: -1, UnsafeNoCopy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Items[0] != runtime.Object(cachedPod(t)) {
+		t.Error("expected the cached pod with UnsafeNoCopy")
+	}
+}
+
+// BenchmarkPodSearch measures the copy of the returned pods against UnsafeNoCopy, with pods of a
+// few containers. Copies cost in proportion of the page, not of the cache.
+func BenchmarkPodSearch(b *testing.B) {
+	objects := make([]runtime.Object, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("pod-%d", i), Labels: map[string]string{"app": "web", "tier": "frontend"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "app", Image: "web:1.0", Env: []corev1.EnvVar{{Name: "A", Value: "a"}, {Name: "B", Value: "b"}}},
+				{Name: "sidecar", Image: "proxy:1.0"},
+			}},
+		})
+	}
+	setupInformers(b, objects...)
+
+	client := NewClient(informers.SharedInformerFactory())
+
+	for _, limit := range []int{10, -1} {
+		for _, unsafeNoCopy := range []bool{false, true} {
+			b.Run(fmt.Sprintf("limit=%d/unsafeNoCopy=%v", limit, unsafeNoCopy), func(b *testing.B) {
+				query := Query{Limit: limit, UnsafeNoCopy: unsafeNoCopy}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := client.List(context.Background(), Pods, "demo", query); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
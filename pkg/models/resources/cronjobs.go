@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -46,6 +46,10 @@ func (*cronJobSearcher) match(match map[string]string, item *v1beta1.CronJob) bo
 			if cronJobStatus(item) != v {
 				return false
 			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec.JobTemplate.Spec.Template.Spec, k, v) {
+				return false
+			}
 		default:
 			return false
 		}
@@ -58,7 +62,7 @@ func (*cronJobSearcher) fuzzy(fuzzy map[string]string, item *v1beta1.CronJob) bo
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -75,7 +79,7 @@ func (*cronJobSearcher) fuzzy(fuzzy map[string]string, item *v1beta1.CronJob) bo
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -88,9 +92,17 @@ func (*cronJobSearcher) fuzzy(fuzzy map[string]string, item *v1beta1.CronJob) bo
 	return true
 }
 
+func (*cronJobSearcher) sortKeys() []string {
+	return []string{name, createTime, lastScheduleTime}
+}
+
 func (*cronJobSearcher) compare(a, b *v1beta1.CronJob, orderBy string) bool {
 	switch orderBy {
 	case lastScheduleTime:
+		// never scheduled cron jobs are ordered by name
+		if a.Status.LastScheduleTime == nil && b.Status.LastScheduleTime == nil {
+			return strings.Compare(a.Name, b.Name) <= 0
+		}
 		if a.Status.LastScheduleTime == nil {
 			return true
 		}
@@ -107,8 +119,12 @@ func (*cronJobSearcher) compare(a, b *v1beta1.CronJob, orderBy string) bool {
 	}
 }
 
-func (s *cronJobSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	cronJobs, err := informers.SharedInformerFactory().Batch().V1beta1().CronJobs().Lister().CronJobs(namespace).List(labels.Everything())
+func (s *cronJobSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1beta1.CronJob), b.(*v1beta1.CronJob), orderBy)
+}
+
+func (s *cronJobSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	cronJobs, err := factory.Batch().V1beta1().CronJobs().Lister().CronJobs(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -31,7 +31,13 @@ type daemonSetSearcher struct {
 }
 
 func daemonSetStatus(item *v1.DaemonSet) string {
-	if item.Status.NumberAvailable == 0 {
+	// status hasn't been populated by the controller yet
+	if item.Status.ObservedGeneration == 0 {
+		return updating
+	}
+
+	// no node is selected
+	if item.Status.DesiredNumberScheduled == 0 {
 		return stopped
 	} else if item.Status.DesiredNumberScheduled == item.Status.NumberAvailable {
 		return running
@@ -48,8 +54,14 @@ func (*daemonSetSearcher) match(match map[string]string, item *v1.DaemonSet) boo
 			if daemonSetStatus(item) != v {
 				return false
 			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec.Template.Spec, k, v) {
+				return false
+			}
 		default:
-			return false
+			if matched, supported := matchResourceTotals(daemonSetTotals(item), k, v); !supported || !matched {
+				return false
+			}
 		}
 	}
 	return true
@@ -60,7 +72,7 @@ func (*daemonSetSearcher) fuzzy(fuzzy map[string]string, item *v1.DaemonSet) boo
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -77,7 +89,7 @@ func (*daemonSetSearcher) fuzzy(fuzzy map[string]string, item *v1.DaemonSet) boo
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -90,8 +102,14 @@ func (*daemonSetSearcher) fuzzy(fuzzy map[string]string, item *v1.DaemonSet) boo
 	return true
 }
 
+func (*daemonSetSearcher) sortKeys() []string {
+	return []string{name, createTime, cpuRequests, cpuLimits, memoryRequests, memoryLimits}
+}
+
 func (*daemonSetSearcher) compare(a, b *v1.DaemonSet, orderBy string) bool {
 	switch orderBy {
+	case cpuRequests, cpuLimits, memoryRequests, memoryLimits:
+		return lessResourceTotals(daemonSetTotals(a), daemonSetTotals(b), orderBy)
 	case createTime:
 		return a.CreationTimestamp.Time.Before(b.CreationTimestamp.Time)
 	case name:
@@ -101,8 +119,12 @@ func (*daemonSetSearcher) compare(a, b *v1.DaemonSet, orderBy string) bool {
 	}
 }
 
-func (s *daemonSetSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	daemonSets, err := informers.SharedInformerFactory().Apps().V1().DaemonSets().Lister().DaemonSets(namespace).List(labels.Everything())
+func (s *daemonSetSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1.DaemonSet), b.(*v1.DaemonSet), orderBy)
+}
+
+func (s *daemonSetSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	daemonSets, err := factory.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -32,16 +32,20 @@ type deploymentSearcher struct {
 }
 
 func deploymentStatus(item *v1.Deployment) string {
-	if item.Spec.Replicas != nil {
-		if item.Status.ReadyReplicas == 0 && *item.Spec.Replicas == 0 {
-			return stopped
-		} else if item.Status.ReadyReplicas == *item.Spec.Replicas {
-			return running
-		} else {
-			return updating
-		}
+	// status hasn't been populated by the controller yet
+	if item.Status.ObservedGeneration == 0 {
+		return updating
+	}
+
+	replicas := specReplicas(item.Spec.Replicas)
+
+	if item.Status.ReadyReplicas == 0 && replicas == 0 {
+		return stopped
+	} else if item.Status.ReadyReplicas == replicas {
+		return running
+	} else {
+		return updating
 	}
-	return stopped
 }
 
 // Exactly Match
@@ -52,8 +56,14 @@ func (*deploymentSearcher) match(match map[string]string, item *v1.Deployment) b
 			if deploymentStatus(item) != v {
 				return false
 			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec.Template.Spec, k, v) {
+				return false
+			}
 		default:
-			return false
+			if matched, supported := matchResourceTotals(deploymentTotals(item), k, v); !supported || !matched {
+				return false
+			}
 		}
 	}
 	return true
@@ -64,7 +74,7 @@ func (*deploymentSearcher) fuzzy(fuzzy map[string]string, item *v1.Deployment) b
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -81,7 +91,7 @@ func (*deploymentSearcher) fuzzy(fuzzy map[string]string, item *v1.Deployment) b
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -94,8 +104,14 @@ func (*deploymentSearcher) fuzzy(fuzzy map[string]string, item *v1.Deployment) b
 	return true
 }
 
+func (*deploymentSearcher) sortKeys() []string {
+	return []string{name, createTime, cpuRequests, cpuLimits, memoryRequests, memoryLimits}
+}
+
 func (*deploymentSearcher) compare(a, b *v1.Deployment, orderBy string) bool {
 	switch orderBy {
+	case cpuRequests, cpuLimits, memoryRequests, memoryLimits:
+		return lessResourceTotals(deploymentTotals(a), deploymentTotals(b), orderBy)
 	case createTime:
 		return a.CreationTimestamp.Time.Before(b.CreationTimestamp.Time)
 	case name:
@@ -105,8 +121,12 @@ func (*deploymentSearcher) compare(a, b *v1.Deployment, orderBy string) bool {
 	}
 }
 
-func (s *deploymentSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	deployments, err := informers.SharedInformerFactory().Apps().V1().Deployments().Lister().Deployments(namespace).List(labels.Everything())
+func (s *deploymentSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1.Deployment), b.(*v1.Deployment), orderBy)
+}
+
+func (s *deploymentSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	deployments, err := factory.Apps().V1().Deployments().Lister().Deployments(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
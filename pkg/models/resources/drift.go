@@ -0,0 +1,388 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+)
+
+// verdicts of DetectDrift
+const (
+	DriftNone    = "none"
+	DriftStale   = "stale"
+	DriftUnknown = "unknown"
+)
+
+// types of DriftReason
+const (
+	DriftTemplate  = "template"
+	DriftConfig    = "config"
+	DriftConfigMap = "configmap"
+	DriftSecret    = "secret"
+)
+
+const (
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	podTemplateHashLabel         = "pod-template-hash"
+	controllerRevisionHashLabel  = "controller-revision-hash"
+)
+
+type DriftReport struct {
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace"`
+	Name      string     `json:"name"`
+	Pods      []PodDrift `json:"pods"`
+}
+
+type PodDrift struct {
+	Name    string        `json:"name"`
+	Verdict string        `json:"verdict"`
+	Reasons []DriftReason `json:"reasons,omitempty"`
+}
+
+// DriftReason tells why a pod is stale or its verdict unknown. Recorded is the revision of the
+// template or the resource version of the config the pod runs with, Current the one it should.
+type DriftReason struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Verdict  string `json:"verdict"`
+	Recorded string `json:"recorded,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// driftWorkload is the revision the pods of a workload should run
+type driftWorkload struct {
+	selector labels.Selector
+	template *corev1.PodTemplateSpec
+	// the label of the pods holding their revision, and the current revision, empty if unknown
+	revisionLabel string
+	revision      string
+}
+
+// DetectDrift tells which pods of the deployment, statefulset or daemonset run a stale revision of
+// the pod template, or stale configmaps and secrets. Changes of configmaps and secrets don't roll
+// the pods, the resource versions they start with are recorded in the checksum annotations of the
+// template. The config verdict of a workload without checksum annotations is unknown.
+func DetectDrift(kind, namespace, name string) (*DriftReport, error) {
+	var workload *driftWorkload
+	var err error
+
+	switch kind {
+	case Deployments:
+		workload, err = deploymentDrift(namespace, name)
+	case StatefulSets:
+		workload, err = statefulSetDrift(namespace, name)
+	case DaemonSets:
+		workload, err = daemonSetDrift(namespace, name)
+	default:
+		return nil, kindUnavailable(kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := informers.SharedInformerFactory().Core().V1().Pods().Lister().Pods(namespace).List(workload.selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{Kind: kind, Namespace: namespace, Name: name, Pods: make([]PodDrift, 0)}
+
+	for _, pod := range pods {
+		reasons := workload.templateDrift(pod)
+
+		configReasons, err := workload.configDrift(pod)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reasons = append(reasons, configReasons...)
+
+		report.Pods = append(report.Pods, PodDrift{Name: pod.Name, Verdict: driftVerdict(reasons), Reasons: reasons})
+	}
+
+	sort.Slice(report.Pods, func(i, j int) bool {
+		return report.Pods[i].Name < report.Pods[j].Name
+	})
+
+	return report, nil
+}
+
+func deploymentDrift(namespace, name string) (*driftWorkload, error) {
+	deployment, err := informers.SharedInformerFactory().Apps().V1().Deployments().Lister().Deployments(namespace).Get(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	workload := &driftWorkload{selector: selector, template: &deployment.Spec.Template, revisionLabel: podTemplateHashLabel}
+
+	replicaSets, err := informers.SharedInformerFactory().Apps().V1().ReplicaSets().Lister().ReplicaSets(namespace).List(selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the replicaset of the current revision carries the hash of the template
+	revision := deployment.Annotations[deploymentRevisionAnnotation]
+	for _, replicaSet := range replicaSets {
+		if isControlledBy(replicaSet.OwnerReferences, deployment.UID) && revision != "" && replicaSet.Annotations[deploymentRevisionAnnotation] == revision {
+			workload.revision = replicaSet.Labels[podTemplateHashLabel]
+		}
+	}
+
+	return workload, nil
+}
+
+func statefulSetDrift(namespace, name string) (*driftWorkload, error) {
+	statefulSet, err := informers.SharedInformerFactory().Apps().V1().StatefulSets().Lister().StatefulSets(namespace).Get(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the pods are labeled with the name of their controller revision
+	return &driftWorkload{selector: selector, template: &statefulSet.Spec.Template, revisionLabel: controllerRevisionHashLabel, revision: statefulSet.Status.UpdateRevision}, nil
+}
+
+func daemonSetDrift(namespace, name string) (*driftWorkload, error) {
+	daemonSet, err := informers.SharedInformerFactory().Apps().V1().DaemonSets().Lister().DaemonSets(namespace).Get(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	workload := &driftWorkload{selector: selector, template: &daemonSet.Spec.Template, revisionLabel: controllerRevisionHashLabel}
+
+	revisions, err := informers.SharedInformerFactory().Apps().V1().ControllerRevisions().Lister().ControllerRevisions(namespace).List(selector)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var current *appsv1.ControllerRevision
+	for _, revision := range revisions {
+		if isControlledBy(revision.OwnerReferences, daemonSet.UID) && (current == nil || revision.Revision > current.Revision) {
+			current = revision
+		}
+	}
+
+	if current != nil {
+		workload.revision = current.Labels[controllerRevisionHashLabel]
+	}
+
+	return workload, nil
+}
+
+func isControlledBy(references []metav1.OwnerReference, uid types.UID) bool {
+	for _, reference := range references {
+		if reference.Controller != nil && *reference.Controller && reference.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *driftWorkload) templateDrift(pod *corev1.Pod) []DriftReason {
+	recorded := pod.Labels[w.revisionLabel]
+
+	switch {
+	case w.revision == "":
+		return []DriftReason{{Type: DriftTemplate, Verdict: DriftUnknown, Recorded: recorded, Message: "current revision of the template not found"}}
+	case recorded == "":
+		return []DriftReason{{Type: DriftTemplate, Verdict: DriftUnknown, Current: w.revision, Message: "revision of the pod not labeled"}}
+	case recorded != w.revision:
+		return []DriftReason{{Type: DriftTemplate, Verdict: DriftStale, Recorded: recorded, Current: w.revision}}
+	}
+
+	return nil
+}
+
+// configDrift compares the resource versions recorded in the annotations of the pod with the ones
+// of the configmaps and secrets its spec references
+func (w *driftWorkload) configDrift(pod *corev1.Pod) ([]DriftReason, error) {
+	configMaps, secrets := referencedConfigs(&pod.Spec)
+
+	if len(configMaps) == 0 && len(secrets) == 0 {
+		return nil, nil
+	}
+
+	if !hasChecksumAnnotations(w.template.Annotations) {
+		return []DriftReason{{Type: DriftConfig, Verdict: DriftUnknown, Message: "no checksum annotations"}}, nil
+	}
+
+	reasons := make([]DriftReason, 0)
+
+	for _, name := range configMaps {
+		configMap, err := informers.SharedInformerFactory().Core().V1().ConfigMaps().Lister().ConfigMaps(pod.Namespace).Get(name)
+
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		current := ""
+		if configMap != nil {
+			current = configMap.ResourceVersion
+		}
+
+		if reason := configReason(DriftConfigMap, name, pod.Annotations, current); reason != nil {
+			reasons = append(reasons, *reason)
+		}
+	}
+
+	for _, name := range secrets {
+		secret, err := informers.SharedInformerFactory().Core().V1().Secrets().Lister().Secrets(pod.Namespace).Get(name)
+
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		current := ""
+		if secret != nil {
+			current = secret.ResourceVersion
+		}
+
+		if reason := configReason(DriftSecret, name, pod.Annotations, current); reason != nil {
+			reasons = append(reasons, *reason)
+		}
+	}
+
+	return reasons, nil
+}
+
+func configReason(kind, name string, annotations map[string]string, current string) *DriftReason {
+	recorded, ok := annotations[checksumAnnotation(kind, name)]
+
+	switch {
+	case !ok:
+		return &DriftReason{Type: kind, Name: name, Verdict: DriftUnknown, Current: current, Message: "resource version not recorded"}
+	case current == "":
+		return &DriftReason{Type: kind, Name: name, Verdict: DriftStale, Recorded: recorded, Message: "not found"}
+	case recorded != current:
+		return &DriftReason{Type: kind, Name: name, Verdict: DriftStale, Recorded: recorded, Current: current}
+	}
+
+	return nil
+}
+
+func checksumAnnotation(kind, name string) string {
+	return constants.ChecksumAnnotationPrefix + kind + "." + name
+}
+
+func hasChecksumAnnotations(annotations map[string]string) bool {
+	for key := range annotations {
+		if strings.HasPrefix(key, constants.ChecksumAnnotationPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedConfigs returns the configmaps and secrets the containers consume, image pull secrets
+// aren't, they don't change the running pods
+func referencedConfigs(spec *corev1.PodSpec) (configMaps, secrets []string) {
+	for _, container := range podContainers(spec) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps = appendKey(configMaps, envFrom.ConfigMapRef.Name)
+			}
+			if envFrom.SecretRef != nil {
+				secrets = appendKey(secrets, envFrom.SecretRef.Name)
+			}
+		}
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil {
+				configMaps = appendKey(configMaps, env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				secrets = appendKey(secrets, env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps = appendKey(configMaps, volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			secrets = appendKey(secrets, volume.Secret.SecretName)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps = appendKey(configMaps, source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secrets = appendKey(secrets, source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	sort.Strings(configMaps)
+	sort.Strings(secrets)
+
+	return configMaps, secrets
+}
+
+// driftVerdict is stale if a reason is, unknown if a reason is
+func driftVerdict(reasons []DriftReason) string {
+	verdict := DriftNone
+	for _, reason := range reasons {
+		if reason.Verdict == DriftStale {
+			return DriftStale
+		}
+		if reason.Verdict == DriftUnknown {
+			verdict = DriftUnknown
+		}
+	}
+	return verdict
+}
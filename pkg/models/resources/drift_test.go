@@ -0,0 +1,181 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func controllerRef(uid types.UID) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{UID: uid, Controller: &controller}}
+}
+
+func driftPod(name string, labels, annotations map[string]string, spec corev1.PodSpec) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name, Labels: labels, Annotations: annotations}, Spec: spec}
+}
+
+func driftFixtures() []runtime.Object {
+	webSpec := corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}}}},
+		Volumes:    []corev1.Volume{{Name: "credentials", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "credentials"}}}},
+		// pulling doesn't change the running pods
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+	dbSpec := corev1.PodSpec{Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}}}}
+
+	recorded := map[string]string{"checksum.kubesphere.io/configmap.settings": "11", "checksum.kubesphere.io/secret.credentials": "5"}
+	staleConfig := map[string]string{"checksum.kubesphere.io/configmap.settings": "10", "checksum.kubesphere.io/secret.credentials": "5"}
+	untracked := map[string]string{"checksum.kubesphere.io/configmap.settings": "11"}
+
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web", UID: "web", Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"}},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: recorded}, Spec: webSpec},
+			},
+		},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web-old", OwnerReferences: controllerRef("web"),
+			Labels: map[string]string{"app": "web", "pod-template-hash": "old"}, Annotations: map[string]string{"deployment.kubernetes.io/revision": "1"}}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web-new", OwnerReferences: controllerRef("web"),
+			Labels: map[string]string{"app": "web", "pod-template-hash": "new"}, Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"}}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "settings", ResourceVersion: "11"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "credentials", ResourceVersion: "5"}},
+		driftPod("web-a", map[string]string{"app": "web", "pod-template-hash": "new"}, recorded, webSpec),
+		driftPod("web-b", map[string]string{"app": "web", "pod-template-hash": "old"}, recorded, webSpec),
+		driftPod("web-c", map[string]string{"app": "web", "pod-template-hash": "new"}, staleConfig, webSpec),
+		driftPod("web-d", map[string]string{"app": "web", "pod-template-hash": "new"}, untracked, webSpec),
+
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "db"},
+			Spec: appsv1.StatefulSetSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}},
+				Template: corev1.PodTemplateSpec{Spec: dbSpec},
+			},
+			Status: appsv1.StatefulSetStatus{UpdateRevision: "db-2"},
+		},
+		driftPod("db-0", map[string]string{"app": "db", "controller-revision-hash": "db-2"}, nil, dbSpec),
+		driftPod("db-1", map[string]string{"app": "db", "controller-revision-hash": "db-1"}, nil, dbSpec),
+
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "agent", UID: "agent"},
+			Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "agent"}}},
+		},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "agent-1", OwnerReferences: controllerRef("agent"),
+			Labels: map[string]string{"app": "agent", "controller-revision-hash": "one"}}, Revision: 1},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "agent-2", OwnerReferences: controllerRef("agent"),
+			Labels: map[string]string{"app": "agent", "controller-revision-hash": "two"}}, Revision: 2},
+		driftPod("agent-a", map[string]string{"app": "agent", "controller-revision-hash": "two"}, nil, corev1.PodSpec{}),
+		driftPod("agent-b", map[string]string{"app": "agent", "controller-revision-hash": "one"}, nil, corev1.PodSpec{}),
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	setupInformers(t, driftFixtures()...)
+
+	tests := []struct {
+		kind     string
+		name     string
+		expected []PodDrift
+	}{
+		{
+			kind: Deployments,
+			name: "web",
+			expected: []PodDrift{
+				{Name: "web-a", Verdict: DriftNone},
+				{Name: "web-b", Verdict: DriftStale, Reasons: []DriftReason{{Type: DriftTemplate, Verdict: DriftStale, Recorded: "old", Current: "new"}}},
+				{Name: "web-c", Verdict: DriftStale, Reasons: []DriftReason{{Type: DriftConfigMap, Name: "settings", Verdict: DriftStale, Recorded: "10", Current: "11"}}},
+				{Name: "web-d", Verdict: DriftUnknown, Reasons: []DriftReason{{Type: DriftSecret, Name: "credentials", Verdict: DriftUnknown, Current: "5", Message: "resource version not recorded"}}},
+			},
+		},
+		{
+			kind: StatefulSets,
+			name: "db",
+			expected: []PodDrift{
+				{Name: "db-0", Verdict: DriftUnknown, Reasons: []DriftReason{{Type: DriftConfig, Verdict: DriftUnknown, Message: "no checksum annotations"}}},
+				{Name: "db-1", Verdict: DriftStale, Reasons: []DriftReason{
+					{Type: DriftTemplate, Verdict: DriftStale, Recorded: "db-1", Current: "db-2"},
+					{Type: DriftConfig, Verdict: DriftUnknown, Message: "no checksum annotations"},
+				}},
+			},
+		},
+		{
+			kind: DaemonSets,
+			name: "agent",
+			expected: []PodDrift{
+				{Name: "agent-a", Verdict: DriftNone},
+				{Name: "agent-b", Verdict: DriftStale, Reasons: []DriftReason{{Type: DriftTemplate, Verdict: DriftStale, Recorded: "one", Current: "two"}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		report, err := DetectDrift(test.kind, "demo", test.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range report.Pods {
+			if len(report.Pods[i].Reasons) == 0 {
+				report.Pods[i].Reasons = nil
+			}
+		}
+
+		if !reflect.DeepEqual(report.Pods, test.expected) {
+			t.Errorf("%s %s:\n got %+v\nwant %+v", test.kind, test.name, report.Pods, test.expected)
+		}
+	}
+}
+
+func TestDetectDriftErrors(t *testing.T) {
+	setupInformers(t, driftFixtures()...)
+
+	if _, err := DetectDrift(Deployments, "demo", "foo"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	if _, err := DetectDrift(Jobs, "demo", "web"); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected kind unavailable, got %v", err)
+	}
+
+	// without the replicaset of the current revision, the template verdict is unknown
+	objects := driftFixtures()[:1]
+	objects = append(objects, driftPod("web-a", map[string]string{"app": "web", "pod-template-hash": "new"}, nil, corev1.PodSpec{}))
+	setupInformers(t, objects...)
+
+	report, err := DetectDrift(Deployments, "demo", "web")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Pods) != 1 || report.Pods[0].Verdict != DriftUnknown || report.Pods[0].Reasons[0].Type != DriftTemplate {
+		t.Errorf("unexpected report %+v", report.Pods)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// Errors returned by the package are wrapping one of these, callers tell them apart with errors.Is.
+var (
+	// ErrKindUnavailable is returned for kinds without a searcher or not supported by the operation
+	ErrKindUnavailable = errors.New("not support")
+	// ErrInvalidCondition is returned for conditions which can't be evaluated
+	ErrInvalidCondition = errors.New("invalid condition")
+	// ErrInvalidScope is returned when the namespace doesn't fit the scope of the kind, see KindScopeError
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrNotSynced is returned while the cache of the kind isn't synced
+	ErrNotSynced = errors.New("cache not synced")
+	// ErrEvaluationTimeout is returned when a search exceeds its deadline, it's the error of the
+	// context, so comparisons with context.DeadlineExceeded keep working.
+	ErrEvaluationTimeout = context.DeadlineExceeded
+	// ErrLimitExceeded is returned when an entry is added to a list which is full
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrInvalidOrder is returned for an orderBy key the kind can't be sorted by, see OrderByError
+	ErrInvalidOrder = errors.New("invalid order")
+	// ErrAmbiguousKind is returned for a kind name which is an alias of several kinds
+	ErrAmbiguousKind = errors.New("ambiguous kind")
+	// ErrInvalidMetadata is returned for labels or annotations which can't be set on objects
+	ErrInvalidMetadata = errors.New("invalid metadata")
+)
+
+// HTTPStatus returns the status code of the response to a failed request, errors of the API
+// server keep their own status code.
+func HTTPStatus(err error) int {
+	var status apierrors.APIStatus
+
+	switch {
+	case errors.Is(err, ErrInvalidCondition), errors.Is(err, ErrInvalidScope), errors.Is(err, ErrAmbiguousKind),
+		errors.Is(err, ErrInvalidOrder), errors.Is(err, ErrInvalidMetadata):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrKindUnavailable):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotSynced):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrEvaluationTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrLimitExceeded):
+		return http.StatusConflict
+	case errors.As(err, &status) && status.Status().Code != 0:
+		return int(status.Status().Code)
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func kindUnavailable(kind string) error {
+	return fmt.Errorf("%w: %s", ErrKindUnavailable, kind)
+}
+
+// validateConditions rejects resource totals conditions whose value isn't a quantity, they would
+// silently match nothing.
+func validateConditions(conditions *params.Conditions) error {
+	if conditions == nil {
+		return nil
+	}
+
+	for key, value := range conditions.Match {
+		if key == hasNodeSelector || key == hasAffinity {
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("%w: %s=%s is not a boolean", ErrInvalidCondition, key, value)
+			}
+			continue
+		}
+
+		var name string
+		if strings.HasSuffix(key, greaterThan) {
+			name = strings.TrimSuffix(key, greaterThan)
+		} else if strings.HasSuffix(key, lessThan) {
+			name = strings.TrimSuffix(key, lessThan)
+		} else {
+			continue
+		}
+
+		if _, ok := (&ResourceTotals{}).field(name); !ok {
+			continue
+		}
+
+		if _, err := resource.ParseQuantity(value); err != nil {
+			return fmt.Errorf("%w: %s=%s is not a quantity", ErrInvalidCondition, key, value)
+		}
+	}
+
+	return nil
+}
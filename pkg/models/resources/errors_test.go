@@ -0,0 +1,97 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{err: kindUnavailable("foo"), status: http.StatusNotFound},
+		{err: &KindScopeError{Kind: Pods, Namespaced: true}, status: http.StatusBadRequest},
+		{err: validateConditions(&params.Conditions{Match: map[string]string{"memoryLimitsLessThan": "1Gb"}}), status: http.StatusBadRequest},
+		{err: fmt.Errorf("%w: %s", ErrNotSynced, Pods), status: http.StatusServiceUnavailable},
+		{err: context.DeadlineExceeded, status: http.StatusGatewayTimeout},
+		{err: fmt.Errorf("search: %w", apierrors.NewNotFound(schema.GroupResource{Resource: ConfigMaps}, "snapshot")), status: http.StatusNotFound},
+		{err: apierrors.NewAlreadyExists(schema.GroupResource{Resource: Deployments}, "web"), status: http.StatusConflict},
+		{err: fmt.Errorf("%w: team name", ErrInvalidMetadata), status: http.StatusBadRequest},
+		{err: errors.New("boom"), status: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		if status := HTTPStatus(test.err); status != test.status {
+			t.Errorf("%v: expected status %d, got %d", test.err, test.status, status)
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	setupInformers(t)
+
+	search := func(namespace, kind string, conditions *params.Conditions) error {
+		_, err := ListNamespaceResource(context.Background(), namespace, kind, conditions, "", false, -1, 0)
+		return err
+	}
+
+	if err := search("demo", "foo", &params.Conditions{}); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected %v, got %v", ErrKindUnavailable, err)
+	}
+
+	var scopeError *KindScopeError
+	if err := search("", Pods, &params.Conditions{}); !errors.Is(err, ErrInvalidScope) || !errors.As(err, &scopeError) {
+		t.Errorf("expected %v, got %v", ErrInvalidScope, err)
+	}
+
+	if err := search("demo", Deployments, &params.Conditions{Match: map[string]string{"cpuLimitsGreaterThan": "two"}}); !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected %v, got %v", ErrInvalidCondition, err)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	if _, err := ListClusterResource(ctx, Pods, &params.Conditions{}, "", false, -1, 0); !errors.Is(err, ErrEvaluationTimeout) {
+		t.Errorf("expected %v, got %v", ErrEvaluationTimeout, err)
+	}
+
+	synced := cacheSynced
+	defer func() { cacheSynced = synced }()
+	cacheSynced = func(_ k8sinformers.SharedInformerFactory, kind string) bool { return kind != Pods }
+
+	if err := search("demo", Pods, &params.Conditions{}); !errors.Is(err, ErrNotSynced) {
+		t.Errorf("expected %v, got %v", ErrNotSynced, err)
+	}
+
+	if err := search("demo", Services, &params.Conditions{}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/golang/glog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
+)
+
+const (
+	defaultFallbackQPS   = 5
+	defaultFallbackBurst = 10
+)
+
+// Sources of a SourcedObject
+const (
+	SourceCache = "cache"
+	SourceLive  = "live"
+)
+
+// SourcedObject is an object and where it was read from, the informer cache or the API server
+type SourcedObject struct {
+	Object runtime.Object `json:"object"`
+	Source string         `json:"source"`
+}
+
+// GetOptions tunes GetWithFallback
+type GetOptions struct {
+	// CacheOnly never reads the API server, for callers which must not put load on it
+	CacheOnly bool
+}
+
+// objectGetter reads objects of a kind from the API server
+type objectGetter interface {
+	get(kind, namespace, name string) (runtime.Object, error)
+}
+
+// LiveFallback reads objects missing from the informer caches from the API server, e.g. right after
+// their creation. The reads of each kind are rate limited, misses beyond the limit are answered by
+// the cache.
+type LiveFallback struct {
+	cache *Client
+	live  objectGetter
+	qps   float32
+	burst int
+
+	mutex    sync.Mutex
+	limiters map[string]flowcontrol.RateLimiter
+}
+
+var (
+	fallbackOnce    sync.Once
+	defaultFallback *LiveFallback
+)
+
+// NewLiveFallback returns a fallback reading at most qps objects of each kind per second from client
+// when cache misses them. The kinds read from the API server are the ones of the recycle bin.
+func NewLiveFallback(cache *Client, client kubernetes.Interface, qps float32, burst int) *LiveFallback {
+	return &LiveFallback{cache: cache, live: &clientsetStore{client: client}, qps: qps, burst: burst, limiters: make(map[string]flowcontrol.RateLimiter)}
+}
+
+func sharedFallback() *LiveFallback {
+	fallbackOnce.Do(func() {
+		defaultFallback = NewLiveFallback(SharedClient(), k8s.Client(), defaultFallbackQPS, defaultFallbackBurst)
+	})
+	return defaultFallback
+}
+
+// GetWithFallback returns the object of kind named name in namespace from the shared informer
+// caches, or from the API server if the caches don't have it yet.
+func GetWithFallback(ctx context.Context, kind, namespace, name string, options GetOptions) (*SourcedObject, error) {
+	return sharedFallback().Get(ctx, kind, namespace, name, options)
+}
+
+func (f *LiveFallback) Get(ctx context.Context, kind, namespace, name string, options GetOptions) (*SourcedObject, error) {
+	object, err := f.cache.Get(ctx, kind, namespace, name)
+
+	if err == nil {
+		return &SourcedObject{Object: object, Source: SourceCache}, nil
+	}
+
+	if !apierrors.IsNotFound(err) || options.CacheOnly {
+		return nil, err
+	}
+
+	// the name was resolved by the cache
+	kind, _ = ResolveKind(kind)
+
+	if !f.limiter(kind).TryAccept() {
+		glog.V(4).Infof("live read of %s %s/%s rate limited", kind, namespace, name)
+		return nil, err
+	}
+
+	live, liveErr := f.live.get(kind, namespace, name)
+
+	if liveErr != nil {
+		// kinds not read from the API server keep the answer of the cache
+		if apierrors.IsNotFound(liveErr) || errors.Is(liveErr, ErrKindUnavailable) {
+			return nil, err
+		}
+		return nil, liveErr
+	}
+
+	return &SourcedObject{Object: live, Source: SourceLive}, nil
+}
+
+func (f *LiveFallback) limiter(kind string) flowcontrol.RateLimiter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	limiter, ok := f.limiters[kind]
+	if !ok {
+		limiter = flowcontrol.NewTokenBucketRateLimiter(f.qps, f.burst)
+		f.limiters[kind] = limiter
+	}
+	return limiter
+}
@@ -0,0 +1,99 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// fakeGetter is the API server, objects are keyed by migrationKey
+type fakeGetter struct {
+	objects map[string]runtime.Object
+	reads   int
+}
+
+func (g *fakeGetter) get(kind, namespace, name string) (runtime.Object, error) {
+	g.reads++
+	if object, ok := g.objects[migrationKey(kind, namespace, name)]; ok {
+		return object, nil
+	}
+	if kind != ConfigMaps && kind != Secrets {
+		return nil, kindUnavailable(kind)
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+}
+
+func TestGetWithFallback(t *testing.T) {
+	factory := setupInformers(t, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "cached"}})
+
+	live := &fakeGetter{objects: map[string]runtime.Object{
+		migrationKey(ConfigMaps, "demo", "created"): &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "created"}},
+	}}
+	fallback := &LiveFallback{cache: NewClient(factory), live: live, qps: 0.001, burst: 2, limiters: make(map[string]flowcontrol.RateLimiter)}
+
+	tests := []struct {
+		name      string
+		kind      string
+		object    string
+		options   GetOptions
+		source    string
+		notFound  bool
+		liveReads int
+	}{
+		{name: "cache hit", kind: ConfigMaps, object: "cached", source: SourceCache},
+		{name: "live hit", kind: "cm", object: "created", source: SourceLive, liveReads: 1},
+		{name: "cache only", kind: ConfigMaps, object: "created", options: GetOptions{CacheOnly: true}, notFound: true},
+		{name: "true not found", kind: ConfigMaps, object: "missing", notFound: true, liveReads: 1},
+		// the burst of config maps is spent, the cache answers
+		{name: "rate limited", kind: ConfigMaps, object: "created", notFound: true},
+		// each kind has its own limit
+		{name: "other kind", kind: Secrets, object: "missing", notFound: true, liveReads: 1},
+		{name: "kind not read live", kind: Pods, object: "missing", notFound: true, liveReads: 1},
+	}
+
+	for _, test := range tests {
+		live.reads = 0
+
+		result, err := fallback.Get(context.Background(), test.kind, "demo", test.object, test.options)
+
+		if test.notFound {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("%s: expected not found, got %+v %v", test.name, result, err)
+			}
+		} else if err != nil || result.Source != test.source || result.Object.(*corev1.ConfigMap).Name != test.object {
+			t.Errorf("%s: expected %s from %s, got %+v %v", test.name, test.object, test.source, result, err)
+		}
+
+		if live.reads != test.liveReads {
+			t.Errorf("%s: expected %d live reads, got %d", test.name, test.liveReads, live.reads)
+		}
+	}
+
+	if _, err := fallback.Get(context.Background(), Nodes, "demo", "node1", GetOptions{}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected the errors of the cache other than not found returned, got %v", err)
+	}
+}
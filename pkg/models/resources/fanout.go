@@ -0,0 +1,220 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+const defaultSearchBranchTimeout = 10 * time.Second
+
+var (
+	searchConcurrency   = runtime.GOMAXPROCS(0)
+	searchBranchTimeout = defaultSearchBranchTimeout
+)
+
+// SetSearchConcurrency limits the number of searches running concurrently for one multi kind
+// search, limit <= 0 resets it to GOMAXPROCS.
+func SetSearchConcurrency(limit int) {
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+	searchConcurrency = limit
+}
+
+// SetSearchBranchTimeout sets the timeout of each search of a multi kind search, timeout <= 0
+// resets it to the default.
+func SetSearchBranchTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultSearchBranchTimeout
+	}
+	searchBranchTimeout = timeout
+}
+
+// SearchRequest is a branch of a multi kind search, resources are listed across namespaces
+// if namespace is empty. The result is sorted by OrderBy if it isn't empty.
+type SearchRequest struct {
+	Kind       string
+	Namespace  string
+	Conditions *params.Conditions
+	OrderBy    string
+	Reverse    bool
+}
+
+// SearchAll runs requests concurrently and returns their results in order of requests. A branch
+// exceeding the branch timeout, of an unavailable kind, or whose cache isn't synced results in a
+// nil result and a warning instead of failing the whole search, any other error or the
+// cancellation of ctx fails the search. The items are the cached objects, they must not be modified,
+// the results are meant to be counted.
+func SearchAll(ctx context.Context, requests []SearchRequest) ([]*models.PageableResponse, []models.SearchWarning, error) {
+	results := make([]*models.PageableResponse, len(requests))
+	degraded := make([]*models.SearchWarning, len(requests))
+
+	group, groupCtx := newLimitedGroup(ctx, searchConcurrency)
+
+	for i := range requests {
+		i := i
+		group.Go(func() error {
+			result, err := searchBranch(groupCtx, requests[i])
+			// the branch failed while the search is still alive
+			if err != nil && groupCtx.Err() == nil {
+				if warning := branchWarning(requests[i], err); warning != nil {
+					degraded[i] = warning
+					return nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+			results[i] = result
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	warnings := make([]models.SearchWarning, 0)
+	for _, warning := range degraded {
+		if warning != nil {
+			warnings = append(warnings, *warning)
+		}
+	}
+
+	return results, warnings, nil
+}
+
+// branchWarning returns the warning of a branch failed by err, nil if err must fail the search
+func branchWarning(request SearchRequest, err error) *models.SearchWarning {
+	warning := &models.SearchWarning{Kind: request.Kind, Namespace: request.Namespace}
+
+	switch {
+	case err == context.DeadlineExceeded:
+		warning.Code = models.WarningTimeout
+		warning.Message = fmt.Sprintf("search timed out after %s", searchBranchTimeout)
+	case errors.Is(err, ErrKindUnavailable):
+		warning.Code = models.WarningKindUnavailable
+		warning.Message = err.Error()
+	case errors.Is(err, ErrNotSynced):
+		warning.Code = models.WarningStaleCache
+		warning.Message = err.Error()
+	default:
+		return nil
+	}
+
+	return warning
+}
+
+// searchBranch returns as soon as ctx is done or the branch times out, the cache scan in progress
+// is abandoned and its goroutine exits once the scan finishes.
+func searchBranch(ctx context.Context, request SearchRequest) (*models.PageableResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, searchBranchTimeout)
+	defer cancel()
+
+	type reply struct {
+		result *models.PageableResponse
+		err    error
+	}
+
+	replies := make(chan reply, 1)
+
+	go func() {
+		var r reply
+		if request.Namespace == "" {
+			r.result, r.err = listClusterResource(ctx, request.Kind, request.Conditions, request.OrderBy, request.Reverse, -1, 0, true)
+		} else {
+			r.result, r.err = listNamespaceResource(ctx, request.Namespace, request.Kind, request.Conditions, request.OrderBy, request.Reverse, -1, 0, true)
+		}
+		replies <- r
+	}()
+
+	select {
+	case r := <-replies:
+		return r.result, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedGroup runs at most limit functions concurrently, the first error cancels the
+// others, like errgroup with a limit.
+type limitedGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tokens chan struct{}
+	wg     sync.WaitGroup
+
+	once sync.Once
+	err  error
+}
+
+func newLimitedGroup(ctx context.Context, limit int) (*limitedGroup, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &limitedGroup{ctx: ctx, cancel: cancel, tokens: make(chan struct{}, limit)}, ctx
+}
+
+// Go blocks until a slot is free, f isn't run if the group is cancelled meanwhile.
+func (g *limitedGroup) Go(f func() error) {
+	select {
+	case g.tokens <- struct{}{}:
+	case <-g.ctx.Done():
+		g.fail(g.ctx.Err())
+		return
+	}
+
+	// both cases may be ready, the group may have been cancelled when the slot was freed
+	if err := g.ctx.Err(); err != nil {
+		<-g.tokens
+		g.fail(err)
+		return
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			<-g.tokens
+			g.wg.Done()
+		}()
+		if err := f(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+func (g *limitedGroup) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait waits for all functions and returns the first error.
+func (g *limitedGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
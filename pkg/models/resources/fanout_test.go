@@ -0,0 +1,228 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+const slowKind = "slow"
+
+// slowSearcher blocks until released, it simulates a scan of a huge cache
+type slowSearcher struct {
+	release chan struct{}
+
+	mutex   sync.Mutex
+	running int
+	started int
+}
+
+func (s *slowSearcher) search(_ k8sinformers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	s.mutex.Lock()
+	s.running++
+	s.started++
+	s.mutex.Unlock()
+
+	<-s.release
+
+	s.mutex.Lock()
+	s.running--
+	s.mutex.Unlock()
+
+	return []interface{}{}, nil
+}
+
+// searches returns the number of started and running searches
+func (s *slowSearcher) sortKeys() []string {
+	return []string{name}
+}
+
+func (s *slowSearcher) less(a, b interface{}, orderBy string) bool {
+	return false
+}
+
+func (s *slowSearcher) searches() (started, running int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.started, s.running
+}
+
+// setupSlowSearcher registers the slow searcher, the returned function unregisters it and restores
+// the search settings
+func setupSlowSearcher() (*slowSearcher, func()) {
+	searcher := &slowSearcher{release: make(chan struct{})}
+	namespacedResources[slowKind] = searcher
+	concurrency, timeout := searchConcurrency, searchBranchTimeout
+
+	return searcher, func() {
+		delete(namespacedResources, slowKind)
+		searchConcurrency, searchBranchTimeout = concurrency, timeout
+	}
+}
+
+// expectNoLeak waits for goroutines to exit, there must be no more goroutines than before
+func expectNoLeak(t *testing.T, before int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("leaked goroutines, %d before, %d after\n%s", before, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSearchAllCancel(t *testing.T) {
+	setupInformers(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pod"}})
+	searcher, restore := setupSlowSearcher()
+	defer restore()
+	SetSearchConcurrency(2)
+
+	before := runtime.NumGoroutine()
+
+	requests := []SearchRequest{
+		{Kind: slowKind, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Pods, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: slowKind, Namespace: "demo", Conditions: &params.Conditions{}},
+		// waits for a free slot when cancelled
+		{Kind: slowKind, Namespace: "demo", Conditions: &params.Conditions{}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, err := SearchAll(ctx, requests)
+
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled search returned after %v", elapsed)
+	}
+
+	// the search of pods took a slot, the last slow search never started
+	if started, _ := searcher.searches(); started > 2 {
+		t.Errorf("expected at most 2 slow searches started, got %d", started)
+	}
+
+	// abandoned scans exit once they finish
+	close(searcher.release)
+	expectNoLeak(t, before)
+
+	if _, running := searcher.searches(); running != 0 {
+		t.Errorf("expected no search running, got %d", running)
+	}
+}
+
+func TestSearchAllBranchTimeout(t *testing.T) {
+	setupInformers(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pod"}})
+	searcher, restore := setupSlowSearcher()
+	defer restore()
+	SetSearchBranchTimeout(50 * time.Millisecond)
+
+	before := runtime.NumGoroutine()
+
+	requests := []SearchRequest{
+		{Kind: slowKind, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Pods, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Pods, Conditions: &params.Conditions{}},
+	}
+
+	results, warnings, err := SearchAll(context.Background(), requests)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0] != nil || results[1].TotalCount != 1 || results[2].TotalCount != 1 {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	if len(warnings) != 1 || warnings[0].Code != models.WarningTimeout || warnings[0].Kind != slowKind || warnings[0].Namespace != "demo" {
+		t.Errorf("expected warning of slow kind, got %+v", warnings)
+	}
+
+	close(searcher.release)
+	expectNoLeak(t, before)
+
+	if _, running := searcher.searches(); running != 0 {
+		t.Errorf("expected no search running, got %d", running)
+	}
+}
+
+func TestSearchAllError(t *testing.T) {
+	setupInformers(t)
+
+	concurrency := searchConcurrency
+	defer func() {
+		searchConcurrency = concurrency
+	}()
+	// the search of pods isn't started once the search of nodes failed
+	SetSearchConcurrency(1)
+
+	requests := []SearchRequest{
+		{Kind: Nodes, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Pods, Namespace: "demo", Conditions: &params.Conditions{}},
+	}
+
+	if _, _, err := SearchAll(context.Background(), requests); err == nil {
+		t.Error("expected scope error of nodes")
+	}
+}
+
+func TestSearchAllDegradedBranches(t *testing.T) {
+	setupInformers(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pod"}})
+	// the cache of services is being relisted
+	synced := cacheSynced
+	defer func() { cacheSynced = synced }()
+	cacheSynced = func(_ k8sinformers.SharedInformerFactory, kind string) bool { return kind != Services }
+
+	requests := []SearchRequest{
+		{Kind: "foo", Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Pods, Namespace: "demo", Conditions: &params.Conditions{}},
+		{Kind: Services, Namespace: "demo", Conditions: &params.Conditions{}},
+	}
+
+	results, warnings, err := SearchAll(context.Background(), requests)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0] != nil || results[1].TotalCount != 1 || results[2] != nil {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	if len(warnings) != 2 || warnings[0].Code != models.WarningKindUnavailable || warnings[0].Kind != "foo" ||
+		warnings[1].Code != models.WarningStaleCache || warnings[1].Kind != Services {
+		t.Errorf("expected warnings of unavailable kind and stale cache, got %+v", warnings)
+	}
+}
@@ -0,0 +1,475 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models/iam"
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
+	sliceutil "kubesphere.io/kubesphere/pkg/utils"
+)
+
+const (
+	favoritesLabelKey           = "kubesphere.io/user-resources"
+	favoritesUsernameAnnotation = "kubesphere.io/username"
+	favoritesPrefix             = "user-resources-"
+	favoritesKey                = "favorites"
+	recentKey                   = "recent"
+	defaultMaxFavorites         = 100
+	defaultMaxRecent            = 20
+	// users are spread over the locks, the updates of a user are serialized
+	favoritesLocks = 64
+)
+
+// UserResource is a resource pinned or viewed by a user, Time is when it was pinned or last viewed
+type UserResource struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Time      time.Time `json:"time"`
+}
+
+func (r UserResource) is(kind, namespace, name string) bool {
+	return r.Kind == kind && r.Namespace == namespace && r.Name == name
+}
+
+// UserResources are the favorites and the recently viewed resources of a user, the latest first
+type UserResources struct {
+	Favorites []UserResource `json:"favorites"`
+	Recent    []UserResource `json:"recent"`
+}
+
+// configMapStore reads and writes ConfigMaps, updates of a stale resource version fail with a conflict
+type configMapStore interface {
+	getConfigMap(namespace, name string) (*corev1.ConfigMap, error)
+	createConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+	updateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error)
+}
+
+// Favorites keeps the favorites and the recently viewed resources of each user in a ConfigMap of a
+// system namespace, so that they follow the user across browsers. Entries whose resource is gone
+// from the informer caches are pruned when they're read. The existence of the resources is only
+// checked if the user may read them, it isn't disclosed to the others.
+type Favorites struct {
+	store        configMapStore
+	namespace    string
+	maxFavorites int
+	maxRecent    int
+	now          func() time.Time
+	// exists reports whether the resource is cached, unknown resources are reported existing
+	exists func(kind, namespace, name string) bool
+	// readable reports whether the user may get the objects of kind in namespace
+	readable func(username, kind, namespace string) bool
+
+	locks [favoritesLocks]sync.Mutex
+}
+
+var (
+	favoritesOnce    sync.Once
+	defaultFavorites *Favorites
+)
+
+// NewFavorites returns favorites kept in namespace, with at most maxFavorites favorites and
+// maxRecent recently viewed resources per user.
+func NewFavorites(client kubernetes.Interface, namespace string, maxFavorites, maxRecent int) *Favorites {
+	return &Favorites{store: &clientsetStore{client: client}, namespace: namespace, maxFavorites: maxFavorites, maxRecent: maxRecent, now: time.Now, exists: cachedResourceExists, readable: userMayRead}
+}
+
+func sharedFavorites() *Favorites {
+	favoritesOnce.Do(func() {
+		defaultFavorites = NewFavorites(k8s.Client(), constants.KubeSphereNamespace, defaultMaxFavorites, defaultMaxRecent)
+	})
+	return defaultFavorites
+}
+
+// ListUserResources returns the favorites and the recently viewed resources of username.
+func ListUserResources(username string) (*UserResources, error) {
+	return sharedFavorites().List(username)
+}
+
+// AddFavorite pins the resource for username.
+func AddFavorite(username, kind, namespace, name string) (*UserResources, error) {
+	return sharedFavorites().Add(username, kind, namespace, name)
+}
+
+// RemoveFavorite unpins the resource for username.
+func RemoveFavorite(username, kind, namespace, name string) (*UserResources, error) {
+	return sharedFavorites().Remove(username, kind, namespace, name)
+}
+
+// RecordView records that username viewed the resource.
+func RecordView(username, kind, namespace, name string) error {
+	return sharedFavorites().RecordView(username, kind, namespace, name)
+}
+
+// cachedResourceExists reports whether the resource is in the shared informer caches, resources
+// of kinds without synced cache are reported existing.
+func cachedResourceExists(kind, namespace, name string) bool {
+	factory := informers.SharedInformerFactory()
+
+	if !cacheSynced(factory, kind) {
+		return true
+	}
+
+	informer, err := informerIn(factory, kind)
+
+	if err != nil {
+		return true
+	}
+
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+
+	_, exists, err := informer.GetIndexer().GetByKey(key)
+
+	return err != nil || exists
+}
+
+// kindGroups are the API groups of the kinds
+var kindGroups = map[string]string{
+	ConfigMaps:             "",
+	CronJobs:               "batch",
+	DaemonSets:             "apps",
+	Deployments:            "apps",
+	Ingresses:              "extensions",
+	Jobs:                   "batch",
+	PersistentVolumeClaims: "",
+	Secrets:                "",
+	Services:               "",
+	StatefulSets:           "apps",
+	Pods:                   "",
+	Roles:                  rbacv1.GroupName,
+	Nodes:                  "",
+	Namespaces:             "",
+	ClusterRoles:           rbacv1.GroupName,
+	StorageClasses:         "storage.k8s.io",
+	S2iBuilders:            "devops.kubesphere.io",
+	S2iRuns:                "devops.kubesphere.io",
+	S2iBuilderTemplates:    "devops.kubesphere.io",
+}
+
+// userMayRead reports whether the roles of username permit to get the objects of kind in namespace,
+// cluster scoped kinds are read with the cluster roles only. Kinds of unknown group aren't readable.
+func userMayRead(username, kind, namespace string) bool {
+	group, ok := kindGroups[kind]
+
+	if !ok {
+		return false
+	}
+
+	all, namespaces, err := iam.GetUserNamespaces(username, rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{group}, Resources: []string{kind}})
+
+	if err != nil {
+		glog.Warningf("resolve the %s user %s may read: %v", kind, username, err)
+		return false
+	}
+
+	return all || (namespace != "" && sliceutil.HasString(namespaces, namespace))
+}
+
+// visible reports whether the resource may be looked up for username, the resources the user
+// can't read are never reported missing
+func (f *Favorites) visible(readable bool, kind, namespace, name string) bool {
+	return !readable || f.exists(kind, namespace, name)
+}
+
+// mayRead reports whether username may read the objects of kind in namespace, nil readable
+// permits nothing
+func (f *Favorites) mayRead(username, kind, namespace string) bool {
+	return f.readable != nil && f.readable(username, kind, namespace)
+}
+
+// List returns the resources of username, the entries of deleted resources are pruned.
+func (f *Favorites) List(username string) (*UserResources, error) {
+	configMap, err := f.store.getConfigMap(f.namespace, favoritesName(username))
+
+	if apierrors.IsNotFound(err) {
+		return &UserResources{Favorites: make([]UserResource, 0), Recent: make([]UserResource, 0)}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := decodeUserResources(configMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pruned := f.prune(username, resources); !pruned {
+		return resources, nil
+	}
+
+	// the pruned entries are dropped from the ConfigMap too, the pruned list is returned regardless
+	updated, err := f.update(username, func(resources *UserResources) error {
+		f.prune(username, resources)
+		return nil
+	})
+
+	if err != nil {
+		glog.Warningf("prune resources of user %s: %v", username, err)
+		return resources, nil
+	}
+
+	return updated, nil
+}
+
+// Add pins the resource for username, the resource must exist if username may read it. It fails
+// with ErrLimitExceeded if username has maxFavorites favorites already.
+func (f *Favorites) Add(username, kind, namespace, name string) (*UserResources, error) {
+	if err := checkObjectScope(kind, namespace); err != nil {
+		return nil, err
+	}
+
+	if !f.visible(f.mayRead(username, kind, namespace), kind, namespace, name) {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+
+	return f.update(username, func(resources *UserResources) error {
+		for _, favorite := range resources.Favorites {
+			if favorite.is(kind, namespace, name) {
+				return nil
+			}
+		}
+
+		if len(resources.Favorites) >= f.maxFavorites {
+			return fmt.Errorf("%w: %d favorites at most", ErrLimitExceeded, f.maxFavorites)
+		}
+
+		resources.Favorites = append([]UserResource{{Kind: kind, Namespace: namespace, Name: name, Time: f.now()}}, resources.Favorites...)
+
+		return nil
+	})
+}
+
+// Remove unpins the resource for username, resources not pinned are ignored.
+func (f *Favorites) Remove(username, kind, namespace, name string) (*UserResources, error) {
+	return f.update(username, func(resources *UserResources) error {
+		resources.Favorites = removeUserResource(resources.Favorites, kind, namespace, name)
+		return nil
+	})
+}
+
+// RecordView moves the resource to the top of the recently viewed resources of username, the
+// oldest are dropped beyond maxRecent.
+func (f *Favorites) RecordView(username, kind, namespace, name string) error {
+	if err := checkObjectScope(kind, namespace); err != nil {
+		return err
+	}
+
+	_, err := f.update(username, func(resources *UserResources) error {
+		recent := removeUserResource(resources.Recent, kind, namespace, name)
+		recent = append([]UserResource{{Kind: kind, Namespace: namespace, Name: name, Time: f.now()}}, recent...)
+
+		if len(recent) > f.maxRecent {
+			recent = recent[:f.maxRecent]
+		}
+
+		resources.Recent = recent
+
+		return nil
+	})
+
+	return err
+}
+
+// prune removes the entries of deleted resources username may read, it reports whether one is removed
+func (f *Favorites) prune(username string, resources *UserResources) bool {
+	pruned := false
+	readable := make(map[string]bool)
+
+	for _, list := range []*[]UserResource{&resources.Favorites, &resources.Recent} {
+		kept := make([]UserResource, 0, len(*list))
+		for _, entry := range *list {
+			// the permission is resolved once per kind and namespace
+			key := entry.Kind + "/" + entry.Namespace
+			permitted, ok := readable[key]
+			if !ok {
+				permitted = f.mayRead(username, entry.Kind, entry.Namespace)
+				readable[key] = permitted
+			}
+			if f.visible(permitted, entry.Kind, entry.Namespace, entry.Name) {
+				kept = append(kept, entry)
+			}
+		}
+		pruned = pruned || len(kept) != len(*list)
+		*list = kept
+	}
+
+	return pruned
+}
+
+// update applies mutate to the resources of username and saves them, it's retried on conflicts
+// with the updates of other replicas
+func (f *Favorites) update(username string, mutate func(resources *UserResources) error) (*UserResources, error) {
+	lock := &f.locks[favoritesLock(username)]
+	lock.Lock()
+	defer lock.Unlock()
+
+	var updated *UserResources
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		configMap, err := f.store.getConfigMap(f.namespace, favoritesName(username))
+
+		if apierrors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:        favoritesName(username),
+				Namespace:   f.namespace,
+				Labels:      map[string]string{favoritesLabelKey: "true"},
+				Annotations: map[string]string{favoritesUsernameAnnotation: username},
+			}}
+		} else if err != nil {
+			return err
+		}
+
+		resources, err := decodeUserResources(configMap)
+
+		if err != nil {
+			return err
+		}
+
+		if err := mutate(resources); err != nil {
+			return err
+		}
+
+		if err := encodeUserResources(configMap, resources); err != nil {
+			return err
+		}
+
+		if configMap.ResourceVersion == "" {
+			_, err = f.store.createConfigMap(configMap)
+			// created by another replica meanwhile, retried like a conflict
+			if apierrors.IsAlreadyExists(err) {
+				err = apierrors.NewConflict(schema.GroupResource{Resource: ConfigMaps}, configMap.Name, err)
+			}
+		} else {
+			_, err = f.store.updateConfigMap(configMap)
+		}
+
+		updated = resources
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// checkObjectScope rejects a reference to an object whose namespace doesn't fit the scope of kind
+func checkObjectScope(kind, namespace string) error {
+	namespaced, supported := IsNamespaced(kind)
+
+	if !supported {
+		return kindUnavailable(kind)
+	}
+
+	if namespaced != (namespace != "") {
+		return &KindScopeError{Kind: kind, Namespaced: namespaced, Namespace: namespace}
+	}
+
+	return nil
+}
+
+func removeUserResource(list []UserResource, kind, namespace, name string) []UserResource {
+	kept := make([]UserResource, 0, len(list))
+	for _, entry := range list {
+		if !entry.is(kind, namespace, name) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+// favoritesName is the name of the ConfigMap of username, usernames aren't valid names of objects
+func favoritesName(username string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(username))
+	return fmt.Sprintf("%s%x", favoritesPrefix, hash.Sum64())
+}
+
+func favoritesLock(username string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(username))
+	return hash.Sum32() % favoritesLocks
+}
+
+func decodeUserResources(configMap *corev1.ConfigMap) (*UserResources, error) {
+	resources := &UserResources{Favorites: make([]UserResource, 0), Recent: make([]UserResource, 0)}
+
+	for key, list := range map[string]*[]UserResource{favoritesKey: &resources.Favorites, recentKey: &resources.Recent} {
+		if data, ok := configMap.Data[key]; ok {
+			if err := json.Unmarshal([]byte(data), list); err != nil {
+				return nil, fmt.Errorf("decode %s of %s: %v", key, configMap.Name, err)
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+func encodeUserResources(configMap *corev1.ConfigMap, resources *UserResources) error {
+	favorites, err := json.Marshal(resources.Favorites)
+
+	if err != nil {
+		return err
+	}
+
+	recent, err := json.Marshal(resources.Recent)
+
+	if err != nil {
+		return err
+	}
+
+	configMap.Data = map[string]string{favoritesKey: string(favorites), recentKey: string(recent)}
+
+	return nil
+}
+
+func (s *clientsetStore) getConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	return s.client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (s *clientsetStore) createConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return s.client.CoreV1().ConfigMaps(configMap.Namespace).Create(configMap)
+}
+
+func (s *clientsetStore) updateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return s.client.CoreV1().ConfigMaps(configMap.Namespace).Update(configMap)
+}
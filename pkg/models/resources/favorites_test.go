@@ -0,0 +1,333 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeConfigMaps keeps ConfigMaps in memory, updates of a stale resource version conflict
+type fakeConfigMaps struct {
+	mutex      sync.Mutex
+	configMaps map[string]*corev1.ConfigMap
+	version    int
+	// conflicts fails the next updates with a conflict, like concurrent writes of other replicas
+	conflicts int
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{configMaps: make(map[string]*corev1.ConfigMap)}
+}
+
+func (s *fakeConfigMaps) getConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	configMap, ok := s.configMaps[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: ConfigMaps}, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (s *fakeConfigMaps) createConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := configMap.Namespace + "/" + configMap.Name
+	if _, ok := s.configMaps[key]; ok {
+		return nil, apierrors.NewAlreadyExists(schema.GroupResource{Resource: ConfigMaps}, configMap.Name)
+	}
+	return s.save(key, configMap), nil
+}
+
+func (s *fakeConfigMaps) updateConfigMap(configMap *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := configMap.Namespace + "/" + configMap.Name
+	current, ok := s.configMaps[key]
+	if !ok {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: ConfigMaps}, configMap.Name)
+	}
+	if s.conflicts > 0 || current.ResourceVersion != configMap.ResourceVersion {
+		if s.conflicts > 0 {
+			s.conflicts--
+		}
+		return nil, apierrors.NewConflict(schema.GroupResource{Resource: ConfigMaps}, configMap.Name, errors.New("stale resource version"))
+	}
+	return s.save(key, configMap), nil
+}
+
+func (s *fakeConfigMaps) save(key string, configMap *corev1.ConfigMap) *corev1.ConfigMap {
+	s.version++
+	saved := configMap.DeepCopy()
+	saved.ResourceVersion = strconv.Itoa(s.version)
+	s.configMaps[key] = saved
+	return saved.DeepCopy()
+}
+
+// fakeExistence reports the resources not deleted existing, and the namespaces not unreadable
+// readable
+type fakeExistence struct {
+	mutex      sync.Mutex
+	deleted    map[string]bool
+	unreadable map[string]bool
+}
+
+func (e *fakeExistence) exists(kind, namespace, name string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return !e.deleted[kind+"/"+namespace+"/"+name]
+}
+
+func (e *fakeExistence) readable(username, kind, namespace string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return !e.unreadable[username+"/"+namespace]
+}
+
+func (e *fakeExistence) delete(kind, namespace, name string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.deleted[kind+"/"+namespace+"/"+name] = true
+}
+
+func newTestFavorites(store configMapStore, existence *fakeExistence, now *time.Time) *Favorites {
+	return &Favorites{store: store, namespace: "kubesphere-system", maxFavorites: 3, maxRecent: 2, now: func() time.Time { return *now }, exists: existence.exists, readable: existence.readable}
+}
+
+func names(list []UserResource) []string {
+	names := make([]string, 0, len(list))
+	for _, entry := range list {
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+func TestFavoritesCaps(t *testing.T) {
+	now := time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+	favorites := newTestFavorites(newFakeConfigMaps(), &fakeExistence{deleted: make(map[string]bool)}, &now)
+
+	for i := 0; i < 3; i++ {
+		if _, err := favorites.Add("alice", Deployments, "demo", fmt.Sprintf("web-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pinning again is a no-op, pinning another one exceeds the cap
+	if _, err := favorites.Add("alice", Deployments, "demo", "web-0"); err != nil {
+		t.Errorf("expected pinning again succeeds, got %v", err)
+	}
+
+	if _, err := favorites.Add("alice", Deployments, "demo", "web-3"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected limit exceeded, got %v", err)
+	}
+
+	// the favorites of other users don't count
+	if _, err := favorites.Add("bob", Deployments, "demo", "web-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := favorites.Remove("alice", Deployments, "demo", "web-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := favorites.Add("alice", Deployments, "demo", "web-3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(names(resources.Favorites)) != "[web-3 web-2 web-0]" {
+		t.Errorf("unexpected favorites %v", names(resources.Favorites))
+	}
+
+	// the recent list keeps the latest views
+	for _, name := range []string{"web-0", "web-1", "web-2", "web-1"} {
+		now = now.Add(time.Minute)
+		if err := favorites.RecordView("alice", Deployments, "demo", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if resources, err = favorites.List("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(names(resources.Recent)) != "[web-1 web-2]" || !resources.Recent[0].Time.Equal(now) {
+		t.Errorf("unexpected recent resources %+v", resources.Recent)
+	}
+}
+
+func TestFavoritesValidation(t *testing.T) {
+	now := time.Now()
+	existence := &fakeExistence{deleted: map[string]bool{"deployments/demo/gone": true}}
+	favorites := newTestFavorites(newFakeConfigMaps(), existence, &now)
+
+	tests := []struct {
+		kind      string
+		namespace string
+		name      string
+		expected  func(error) bool
+	}{
+		{kind: "widgets", namespace: "demo", name: "web", expected: func(err error) bool { return errors.Is(err, ErrKindUnavailable) }},
+		{kind: Deployments, name: "web", expected: func(err error) bool { return errors.Is(err, ErrInvalidScope) }},
+		{kind: Nodes, namespace: "demo", name: "node-1", expected: func(err error) bool { return errors.Is(err, ErrInvalidScope) }},
+		{kind: Deployments, namespace: "demo", name: "gone", expected: apierrors.IsNotFound},
+	}
+
+	for _, test := range tests {
+		if _, err := favorites.Add("alice", test.kind, test.namespace, test.name); !test.expected(err) {
+			t.Errorf("%s %s/%s: unexpected error %v", test.kind, test.namespace, test.name, err)
+		}
+	}
+}
+
+func TestFavoritesPruneDeletedTargets(t *testing.T) {
+	now := time.Now()
+	store := newFakeConfigMaps()
+	existence := &fakeExistence{deleted: make(map[string]bool)}
+	favorites := newTestFavorites(store, existence, &now)
+
+	for _, name := range []string{"web", "db"} {
+		if _, err := favorites.Add("alice", Deployments, "demo", name); err != nil {
+			t.Fatal(err)
+		}
+		if err := favorites.RecordView("alice", Deployments, "demo", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	existence.delete(Deployments, "demo", "db")
+
+	resources, err := favorites.List("alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(names(resources.Favorites)) != "[web]" || fmt.Sprint(names(resources.Recent)) != "[web]" {
+		t.Errorf("expected the deleted deployment pruned, got %+v", resources)
+	}
+
+	// the pruned entries are dropped from the ConfigMap
+	configMap, err := store.getConfigMap("kubesphere-system", favoritesName("alice"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := decodeUserResources(configMap)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved.Favorites) != 1 || len(saved.Recent) != 1 {
+		t.Errorf("expected the pruned resources saved, got %+v", saved)
+	}
+
+	// users without ConfigMap have nothing
+	if resources, err := favorites.List("bob"); err != nil || len(resources.Favorites) != 0 || len(resources.Recent) != 0 {
+		t.Errorf("expected no resources, got %+v %v", resources, err)
+	}
+}
+
+func TestFavoritesUnreadableTargets(t *testing.T) {
+	now := time.Now()
+	existence := &fakeExistence{deleted: map[string]bool{"deployments/secret/gone": true}, unreadable: map[string]bool{"alice/secret": true}}
+	favorites := newTestFavorites(newFakeConfigMaps(), existence, &now)
+
+	// the resources alice can't read are pinned alike, whether they exist or not
+	for _, name := range []string{"web", "gone"} {
+		if _, err := favorites.Add("alice", Deployments, "secret", name); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	// and aren't pruned
+	resources, err := favorites.List("alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(names(resources.Favorites)) != "[gone web]" {
+		t.Errorf("expected the unreadable resources kept, got %+v", resources.Favorites)
+	}
+
+	// the missing resources are reported to the users who can read them
+	if _, err := favorites.Add("bob", Deployments, "secret", "gone"); !apierrors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestFavoritesConcurrentUpdates(t *testing.T) {
+	now := time.Now()
+	store := newFakeConfigMaps()
+	existence := &fakeExistence{deleted: make(map[string]bool)}
+	favorites := &Favorites{store: store, namespace: "kubesphere-system", maxFavorites: 100, maxRecent: 100, now: func() time.Time { return now }, exists: existence.exists, readable: existence.readable}
+
+	// another replica writes meanwhile
+	store.conflicts = 2
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			_, err := favorites.Add("alice", Deployments, "demo", fmt.Sprintf("web-%d", i))
+			errs <- err
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			errs <- favorites.RecordView("alice", Services, "demo", fmt.Sprintf("svc-%d", i))
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resources, err := favorites.List("alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resources.Favorites) != 20 || len(resources.Recent) != 20 {
+		t.Errorf("expected no update lost, got %d favorites and %d recent", len(resources.Favorites), len(resources.Recent))
+	}
+}
@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -36,7 +36,7 @@ func (*ingressSearcher) match(match map[string]string, item *extensions.Ingress)
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		default:
@@ -51,7 +51,7 @@ func (*ingressSearcher) fuzzy(fuzzy map[string]string, item *extensions.Ingress)
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -68,7 +68,7 @@ func (*ingressSearcher) fuzzy(fuzzy map[string]string, item *extensions.Ingress)
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -80,6 +80,10 @@ func (*ingressSearcher) fuzzy(fuzzy map[string]string, item *extensions.Ingress)
 	return true
 }
 
+func (*ingressSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*ingressSearcher) compare(a, b *extensions.Ingress, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -91,8 +95,12 @@ func (*ingressSearcher) compare(a, b *extensions.Ingress, orderBy string) bool {
 	}
 }
 
-func (s *ingressSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	ingresses, err := informers.SharedInformerFactory().Extensions().V1beta1().Ingresses().Lister().Ingresses(namespace).List(labels.Everything())
+func (s *ingressSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*extensions.Ingress), b.(*extensions.Ingress), orderBy)
+}
+
+func (s *ingressSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	ingresses, err := factory.Extensions().V1beta1().Ingresses().Lister().Ingresses(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
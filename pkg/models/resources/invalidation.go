@@ -0,0 +1,223 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+)
+
+const (
+	defaultInvalidationWindow   = 100 * time.Millisecond
+	defaultInvalidationMaxBatch = 1000
+)
+
+// InvalidationHandler drops cached entries derived from the objects of a kind, keys are
+// namespace/name of changed objects. When full is true keys is nil and every entry of
+// the kind must be dropped.
+type InvalidationHandler func(kind string, keys []string, full bool)
+
+var invalidations = newInvalidationCoalescer(defaultInvalidationWindow, defaultInvalidationMaxBatch)
+
+// RegisterInvalidationHandler registers handler to be notified of changes of kind. Informer events
+// are coalesced over a short window, so a burst of events (e.g. a namespace deletion) results in one
+// notification, no stale entry survives past the window.
+func RegisterInvalidationHandler(kind string, handler InvalidationHandler) error {
+	return invalidations.register(kind, handler)
+}
+
+type invalidationCoalescer struct {
+	window   time.Duration
+	maxBatch int
+
+	mutex    sync.Mutex
+	handlers map[string][]InvalidationHandler
+	pending  map[string]map[string]struct{}
+	// kinds need full flush since batch exceeded maxBatch
+	overflow map[string]bool
+	// kinds whose flush is scheduled
+	scheduled map[string]bool
+	// calls f after d, the tests flush on their own
+	afterFunc func(d time.Duration, f func())
+}
+
+func newInvalidationCoalescer(window time.Duration, maxBatch int) *invalidationCoalescer {
+	return &invalidationCoalescer{
+		window:    window,
+		maxBatch:  maxBatch,
+		handlers:  make(map[string][]InvalidationHandler),
+		pending:   make(map[string]map[string]struct{}),
+		overflow:  make(map[string]bool),
+		scheduled: make(map[string]bool),
+		afterFunc: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+}
+
+func (c *invalidationCoalescer) register(kind string, handler InvalidationHandler) error {
+	c.mutex.Lock()
+	first := len(c.handlers[kind]) == 0
+	c.handlers[kind] = append(c.handlers[kind], handler)
+	c.mutex.Unlock()
+
+	if !first {
+		return nil
+	}
+
+	informer, err := informerFor(kind)
+
+	if err != nil {
+		return err
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueue(kind, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.enqueue(kind, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.enqueue(kind, obj)
+		},
+	})
+
+	return nil
+}
+
+func (c *invalidationCoalescer) enqueue(kind string, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+
+	if err != nil {
+		glog.Warningf("invalidate %s: %v", kind, err)
+		// unknown object, drop everything to stay correct
+		c.invalidate(kind, "", true)
+		return
+	}
+
+	c.invalidate(kind, key, false)
+}
+
+func (c *invalidationCoalescer) invalidate(kind, key string, full bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if full {
+		c.overflow[kind] = true
+	} else if !c.overflow[kind] {
+		keys, ok := c.pending[kind]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.pending[kind] = keys
+		}
+		keys[key] = struct{}{}
+		// stop tracking keys of a huge batch, flush the whole kind instead
+		if len(keys) > c.maxBatch {
+			c.overflow[kind] = true
+			delete(c.pending, kind)
+		}
+	}
+
+	if !c.scheduled[kind] {
+		c.scheduled[kind] = true
+		c.afterFunc(c.window, func() {
+			c.flush(kind)
+		})
+	}
+}
+
+func (c *invalidationCoalescer) flush(kind string) {
+	c.mutex.Lock()
+	full := c.overflow[kind]
+	var keys []string
+	if !full {
+		keys = make([]string, 0, len(c.pending[kind]))
+		for key := range c.pending[kind] {
+			keys = append(keys, key)
+		}
+	}
+	delete(c.pending, kind)
+	delete(c.overflow, kind)
+	delete(c.scheduled, kind)
+	handlers := c.handlers[kind]
+	c.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(kind, keys, full)
+	}
+}
+
+// informerFor returns the shared informer which caches objects of kind
+func informerFor(kind string) (cache.SharedIndexInformer, error) {
+	return informerIn(informers.SharedInformerFactory(), kind)
+}
+
+// informerIn returns the informer of factory which caches objects of kind, objects of s2i kinds
+// are cached by the shared s2i informer factory.
+func informerIn(factory k8sinformers.SharedInformerFactory, kind string) (cache.SharedIndexInformer, error) {
+	switch kind {
+	case ConfigMaps:
+		return factory.Core().V1().ConfigMaps().Informer(), nil
+	case CronJobs:
+		return factory.Batch().V1beta1().CronJobs().Informer(), nil
+	case DaemonSets:
+		return factory.Apps().V1().DaemonSets().Informer(), nil
+	case Deployments:
+		return factory.Apps().V1().Deployments().Informer(), nil
+	case Ingresses:
+		return factory.Extensions().V1beta1().Ingresses().Informer(), nil
+	case Jobs:
+		return factory.Batch().V1().Jobs().Informer(), nil
+	case PersistentVolumeClaims:
+		return factory.Core().V1().PersistentVolumeClaims().Informer(), nil
+	case Secrets:
+		return factory.Core().V1().Secrets().Informer(), nil
+	case Services:
+		return factory.Core().V1().Services().Informer(), nil
+	case StatefulSets:
+		return factory.Apps().V1().StatefulSets().Informer(), nil
+	case Pods:
+		return factory.Core().V1().Pods().Informer(), nil
+	case Roles:
+		return factory.Rbac().V1().Roles().Informer(), nil
+	case Nodes:
+		return factory.Core().V1().Nodes().Informer(), nil
+	case Namespaces:
+		return factory.Core().V1().Namespaces().Informer(), nil
+	case ClusterRoles:
+		return factory.Rbac().V1().ClusterRoles().Informer(), nil
+	case StorageClasses:
+		return factory.Storage().V1().StorageClasses().Informer(), nil
+	case S2iBuilders:
+		return informers.S2iSharedInformerFactory().Devops().V1alpha1().S2iBuilders().Informer(), nil
+	case S2iRuns:
+		return informers.S2iSharedInformerFactory().Devops().V1alpha1().S2iRuns().Informer(), nil
+	case S2iBuilderTemplates:
+		return informers.S2iSharedInformerFactory().Devops().V1alpha1().S2iBuilderTemplates().Informer(), nil
+	default:
+		return nil, fmt.Errorf("%w: no informer of %s", ErrKindUnavailable, kind)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type recordedFlush struct {
+	keys []string
+	full bool
+}
+
+type flushRecorder struct {
+	mutex   sync.Mutex
+	flushes []recordedFlush
+}
+
+func (r *flushRecorder) handle(kind string, keys []string, full bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.flushes = append(r.flushes, recordedFlush{keys: keys, full: full})
+}
+
+func (r *flushRecorder) recorded() []recordedFlush {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]recordedFlush{}, r.flushes...)
+}
+
+func TestInvalidationStorm(t *testing.T) {
+	setupInformers(t)
+
+	window := 50 * time.Millisecond
+	coalescer := newInvalidationCoalescer(window, 100)
+	recorder := &flushRecorder{}
+
+	// the flushes are run by the test
+	var delays []time.Duration
+	var scheduled []func()
+	coalescer.afterFunc = func(d time.Duration, f func()) {
+		delays = append(delays, d)
+		scheduled = append(scheduled, f)
+	}
+
+	if err := coalescer.register(Pods, recorder.handle); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		coalescer.enqueue(Pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "deleted", Name: fmt.Sprintf("pod-%d", i)}})
+	}
+
+	// no stale entry survives past the window after the first event
+	if len(scheduled) != 1 || delays[0] != window {
+		t.Fatalf("expected one flush scheduled after %v, got %v", window, delays)
+	}
+
+	scheduled[0]()
+
+	flushes := recorder.recorded()
+
+	if len(flushes) != 1 {
+		t.Fatalf("expected exactly one flush, got %d", len(flushes))
+	}
+
+	if !flushes[0].full || flushes[0].keys != nil {
+		t.Errorf("expected full flush for oversized batch, got %d keys", len(flushes[0].keys))
+	}
+
+	// the events after the flush schedule the next one
+	coalescer.enqueue(Pods, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "deleted", Name: "pod-0"}})
+
+	if len(scheduled) != 2 {
+		t.Errorf("expected the next flush scheduled, got %d", len(scheduled))
+	}
+}
+
+func TestInvalidationBatch(t *testing.T) {
+	setupInformers(t)
+
+	window := 20 * time.Millisecond
+	coalescer := newInvalidationCoalescer(window, 100)
+	recorder := &flushRecorder{}
+
+	if err := coalescer.register(ConfigMaps, recorder.handle); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "a"} {
+		coalescer.enqueue(ConfigMaps, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name}})
+	}
+
+	time.Sleep(4 * window)
+
+	coalescer.enqueue(ConfigMaps, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "c"}})
+
+	time.Sleep(4 * window)
+
+	flushes := recorder.recorded()
+
+	if len(flushes) != 2 {
+		t.Fatalf("expected two flushes, got %d", len(flushes))
+	}
+
+	sort.Strings(flushes[0].keys)
+
+	if flushes[0].full || len(flushes[0].keys) != 2 || flushes[0].keys[0] != "demo/a" || flushes[0].keys[1] != "demo/b" {
+		t.Errorf("unexpected first flush %+v", flushes[0])
+	}
+
+	if flushes[1].full || len(flushes[1].keys) != 1 || flushes[1].keys[0] != "demo/c" {
+		t.Errorf("unexpected second flush %+v", flushes[1])
+	}
+}
+
+func TestInvalidationUnknownKind(t *testing.T) {
+	setupInformers(t)
+
+	coalescer := newInvalidationCoalescer(time.Millisecond, 1)
+
+	if err := coalescer.register("foo", func(string, []string, bool) {}); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -33,7 +33,12 @@ type jobSearcher struct {
 }
 
 func jobStatus(item *batchv1.Job) string {
-	status := ""
+	// status hasn't been populated by the controller yet
+	if item.Status.StartTime == nil && len(item.Status.Conditions) == 0 {
+		return updating
+	}
+
+	status := running
 
 	for _, condition := range item.Status.Conditions {
 		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
@@ -54,6 +59,10 @@ func (*jobSearcher) match(match map[string]string, item *batchv1.Job) bool {
 			if jobStatus(item) != v {
 				return false
 			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec.Template.Spec, k, v) {
+				return false
+			}
 		default:
 			return false
 		}
@@ -66,7 +75,7 @@ func (*jobSearcher) fuzzy(fuzzy map[string]string, item *batchv1.Job) bool {
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -83,7 +92,7 @@ func (*jobSearcher) fuzzy(fuzzy map[string]string, item *batchv1.Job) bool {
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -109,6 +118,10 @@ func jobUpdateTime(item *batchv1.Job) time.Time {
 	return updateTime
 }
 
+func (*jobSearcher) sortKeys() []string {
+	return []string{name, updateTime}
+}
+
 func (*jobSearcher) compare(a, b *batchv1.Job, orderBy string) bool {
 	switch orderBy {
 	case updateTime:
@@ -120,8 +133,12 @@ func (*jobSearcher) compare(a, b *batchv1.Job, orderBy string) bool {
 	}
 }
 
-func (s *jobSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	jobs, err := informers.SharedInformerFactory().Batch().V1().Jobs().Lister().Jobs(namespace).List(labels.Everything())
+func (s *jobSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*batchv1.Job), b.(*batchv1.Job), orderBy)
+}
+
+func (s *jobSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	jobs, err := factory.Batch().V1().Jobs().Lister().Jobs(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
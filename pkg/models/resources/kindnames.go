@@ -0,0 +1,193 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+
+	"kubesphere.io/kubesphere/pkg/utils"
+)
+
+// kindName is how a kind with a searcher is known to users besides its searcher key
+type kindName struct {
+	// groups are the API groups serving the kind, the short names of a resource with the
+	// same name served by another group aren't aliases of the kind
+	groups     []string
+	singular   string
+	kind       string
+	shortNames []string
+}
+
+var kindNames = map[string]kindName{
+	ConfigMaps:             {groups: []string{""}, singular: "configmap", kind: "ConfigMap", shortNames: []string{"cm"}},
+	CronJobs:               {groups: []string{"batch"}, singular: "cronjob", kind: "CronJob", shortNames: []string{"cj"}},
+	DaemonSets:             {groups: []string{"apps", "extensions"}, singular: "daemonset", kind: "DaemonSet", shortNames: []string{"ds"}},
+	Deployments:            {groups: []string{"apps", "extensions"}, singular: "deployment", kind: "Deployment", shortNames: []string{"deploy"}},
+	Ingresses:              {groups: []string{"extensions", "networking.k8s.io"}, singular: "ingress", kind: "Ingress", shortNames: []string{"ing"}},
+	Jobs:                   {groups: []string{"batch"}, singular: "job", kind: "Job"},
+	PersistentVolumeClaims: {groups: []string{""}, singular: "persistentvolumeclaim", kind: "PersistentVolumeClaim", shortNames: []string{"pvc"}},
+	Secrets:                {groups: []string{""}, singular: "secret", kind: "Secret"},
+	Services:               {groups: []string{""}, singular: "service", kind: "Service", shortNames: []string{"svc"}},
+	StatefulSets:           {groups: []string{"apps"}, singular: "statefulset", kind: "StatefulSet", shortNames: []string{"sts"}},
+	Pods:                   {groups: []string{""}, singular: "pod", kind: "Pod", shortNames: []string{"po"}},
+	Roles:                  {groups: []string{"rbac.authorization.k8s.io"}, singular: "role", kind: "Role"},
+	S2iBuilders:            {groups: []string{"devops.kubesphere.io"}, singular: "s2ibuilder", kind: "S2iBuilder"},
+	S2iRuns:                {groups: []string{"devops.kubesphere.io"}, singular: "s2irun", kind: "S2iRun"},
+	Nodes:                  {groups: []string{""}, singular: "node", kind: "Node", shortNames: []string{"no"}},
+	Namespaces:             {groups: []string{""}, singular: "namespace", kind: "Namespace", shortNames: []string{"ns"}},
+	ClusterRoles:           {groups: []string{"rbac.authorization.k8s.io"}, singular: "clusterrole", kind: "ClusterRole"},
+	StorageClasses:         {groups: []string{"storage.k8s.io"}, singular: "storageclass", kind: "StorageClass", shortNames: []string{"sc"}},
+	S2iBuilderTemplates:    {groups: []string{"devops.kubesphere.io"}, singular: "s2ibuildertemplate", kind: "S2iBuilderTemplate"},
+}
+
+// kindAliasesResync is the interval of the discovery of the short names of custom resources
+const kindAliasesResync = 10 * time.Minute
+
+var kindAliases = newKindResolver()
+
+// kindResolver maps the lowercased aliases of the kinds to their searcher keys. The static aliases
+// are built from kindNames, the discovered ones are the short names served by the API server,
+// replaced on each discovery as CRDs come and go.
+type kindResolver struct {
+	mutex      sync.RWMutex
+	static     map[string][]string
+	discovered map[string][]string
+}
+
+func newKindResolver() *kindResolver {
+	r := &kindResolver{static: make(map[string][]string), discovered: make(map[string][]string)}
+
+	for key, names := range kindNames {
+		addAlias(r.static, key, names.singular)
+		addAlias(r.static, key, names.kind)
+		for _, shortName := range names.shortNames {
+			addAlias(r.static, key, shortName)
+		}
+	}
+
+	return r
+}
+
+func addAlias(aliases map[string][]string, key, alias string) {
+	alias = strings.ToLower(alias)
+	for _, candidate := range aliases[alias] {
+		if candidate == key {
+			return
+		}
+	}
+	aliases[alias] = append(aliases[alias], key)
+}
+
+// resolve returns the searcher key of name. The searcher keys resolve to themselves, an alias of
+// several kinds is rejected with the candidates.
+func (r *kindResolver) resolve(name string) (string, error) {
+	alias := strings.ToLower(name)
+
+	if _, supported := IsNamespaced(alias); supported {
+		return alias, nil
+	}
+
+	r.mutex.RLock()
+	candidates := make([]string, 0, 1)
+	candidates = append(candidates, r.static[alias]...)
+	for _, key := range r.discovered[alias] {
+		if !utils.HasString(candidates, key) {
+			candidates = append(candidates, key)
+		}
+	}
+	r.mutex.RUnlock()
+
+	switch len(candidates) {
+	case 0:
+		return "", kindUnavailable(name)
+	case 1:
+		return candidates[0], nil
+	default:
+		sort.Strings(candidates)
+		return "", fmt.Errorf("%w: %s is one of %s", ErrAmbiguousKind, name, strings.Join(candidates, ", "))
+	}
+}
+
+// discover replaces the discovered aliases with the short names of the resources served by client
+// which have a searcher. When some groups fail discovery, the previous short names which weren't
+// discovered again are kept until a complete discovery.
+func (r *kindResolver) discover(client discovery.ServerResourcesInterface) error {
+	lists, err := client.ServerResources()
+
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return err
+	}
+
+	discovered := make(map[string][]string)
+
+	for _, list := range lists {
+		gv, parseErr := schema.ParseGroupVersion(list.GroupVersion)
+		if parseErr != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			names, ok := kindNames[resource.Name]
+			if !ok || !utils.HasString(names.groups, gv.Group) {
+				continue
+			}
+			for _, shortName := range resource.ShortNames {
+				addAlias(discovered, resource.Name, shortName)
+			}
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err != nil {
+		for alias, keys := range r.discovered {
+			if _, ok := discovered[alias]; !ok {
+				discovered[alias] = keys
+			}
+		}
+	}
+	r.discovered = discovered
+
+	return err
+}
+
+// ResolveKind returns the searcher key of a kind named by its plural, singular, CamelCase kind or
+// short name, case insensitively, e.g. DaemonSet, daemonset and ds are daemonsets. A short name
+// of several kinds is rejected with ErrAmbiguousKind, an unknown name with ErrKindUnavailable.
+func ResolveKind(name string) (string, error) {
+	return kindAliases.resolve(name)
+}
+
+// SyncKindAliases discovers the short names of the kinds served by client, CRDs included, until
+// stopCh is closed.
+func SyncKindAliases(client discovery.ServerResourcesInterface, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		if err := kindAliases.discover(client); err != nil {
+			glog.Warningf("discover kind aliases: %v", err)
+		}
+	}, kindAliasesResync, stopCh)
+}
@@ -0,0 +1,145 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func TestResolveKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "daemonsets", expected: DaemonSets},
+		{name: "daemonset", expected: DaemonSets},
+		{name: "DaemonSet", expected: DaemonSets},
+		{name: "DaemonSets", expected: DaemonSets},
+		{name: "ds", expected: DaemonSets},
+		{name: "DS", expected: DaemonSets},
+		{name: "deploy", expected: Deployments},
+		{name: "Ingress", expected: Ingresses},
+		{name: "pvc", expected: PersistentVolumeClaims},
+		{name: "no", expected: Nodes},
+		{name: "StorageClass", expected: StorageClasses},
+		{name: "s2ibuildertemplate", expected: S2iBuilderTemplates},
+	}
+
+	for _, test := range tests {
+		if kind, err := ResolveKind(test.name); err != nil || kind != test.expected {
+			t.Errorf("%s: expected %s, got %s %v", test.name, test.expected, kind, err)
+		}
+	}
+
+	for _, name := range []string{"", "foo", "replicasets", "d"} {
+		if _, err := ResolveKind(name); !errors.Is(err, ErrKindUnavailable) {
+			t.Errorf("%q: expected kind unavailable, got %v", name, err)
+		}
+	}
+}
+
+func TestDiscoveredKindAliases(t *testing.T) {
+	defer func(resolver *kindResolver) { kindAliases = resolver }(kindAliases)
+	kindAliases = newKindResolver()
+
+	client := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "devops.kubesphere.io/v1alpha1", APIResources: []metav1.APIResource{
+			{Name: "s2ibuilders", ShortNames: []string{"s2ib", "s2i"}},
+			{Name: "s2iruns", ShortNames: []string{"s2ir", "s2i", "cm"}},
+		}},
+		// a resource of the same name served by another group isn't an alias of the kind
+		{GroupVersion: "batch.volcano.sh/v1alpha1", APIResources: []metav1.APIResource{
+			{Name: "jobs", ShortNames: []string{"vcjob"}},
+		}},
+	}}}
+
+	if err := kindAliases.discover(client); err != nil {
+		t.Fatal(err)
+	}
+
+	if kind, err := ResolveKind("S2IB"); err != nil || kind != S2iBuilders {
+		t.Errorf("expected %s, got %s %v", S2iBuilders, kind, err)
+	}
+
+	if _, err := ResolveKind("vcjob"); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected kind unavailable, got %v", err)
+	}
+
+	for name, candidates := range map[string]string{"s2i": "s2ibuilders, s2iruns", "cm": "configmaps, s2iruns"} {
+		_, err := ResolveKind(name)
+		if !errors.Is(err, ErrAmbiguousKind) || !strings.Contains(err.Error(), candidates) {
+			t.Errorf("%s: expected ambiguous between %s, got %v", name, candidates, err)
+		}
+		if status := HTTPStatus(err); status != 400 {
+			t.Errorf("%s: expected bad request, got %d", name, status)
+		}
+	}
+
+	// the short names of a deleted CRD are dropped by the next discovery
+	client.Resources = client.Resources[1:]
+
+	if err := kindAliases.discover(client); err != nil {
+		t.Fatal(err)
+	}
+
+	if kind, err := ResolveKind("cm"); err != nil || kind != ConfigMaps {
+		t.Errorf("expected %s, got %s %v", ConfigMaps, kind, err)
+	}
+
+	if _, err := ResolveKind("s2ib"); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected kind unavailable, got %v", err)
+	}
+}
+
+func TestListByKindAlias(t *testing.T) {
+	setupInformers(t,
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "agent"}},
+	)
+
+	for _, kind := range []string{"daemonsets", "DaemonSet", "ds"} {
+		result, err := ListNamespaceResource(context.Background(), "demo", kind, &params.Conditions{}, "", false, -1, 0)
+		if err != nil || result.TotalCount != 1 {
+			t.Errorf("%s: expected 1 daemonset, got %v %v", kind, result, err)
+		}
+	}
+
+	results, _, err := SearchAll(context.Background(), []SearchRequest{
+		{Kind: "DaemonSet", Conditions: &params.Conditions{}},
+		{Kind: "ds", Namespace: "demo", Conditions: &params.Conditions{}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range results {
+		if result == nil || result.TotalCount != 1 {
+			t.Errorf("request %d: expected 1 daemonset, got %v", i, result)
+		}
+	}
+}
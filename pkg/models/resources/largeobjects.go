@@ -0,0 +1,135 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"kubesphere.io/kubesphere/pkg/models"
+)
+
+const (
+	defaultLargeObjectThreshold = 1 << 20
+	// objects whose size is remembered, a resource version changes the size
+	sizeHintsSize = 10000
+	sizeHintsTTL  = time.Hour
+)
+
+var (
+	largeObjectThreshold = defaultLargeObjectThreshold
+	sizeHints            = cache.NewLRUExpireCache(sizeHintsSize)
+)
+
+// SetLargeObjectThreshold sets the estimated size in bytes above which an object is large,
+// threshold <= 0 resets it to the default. The values of the annotations of large objects aren't
+// scanned by keyword searches, and large objects of a result are reported with a warning.
+func SetLargeObjectThreshold(threshold int) {
+	if threshold <= 0 {
+		threshold = defaultLargeObjectThreshold
+	}
+	largeObjectThreshold = threshold
+}
+
+type sizeHint struct {
+	resourceVersion string
+	size            int
+}
+
+// isLargeObject reports whether the estimated size of item exceeds the threshold
+func isLargeObject(item metav1.Object) bool {
+	return objectSize(item) > largeObjectThreshold
+}
+
+// objectSize estimates the serialized size of item from its biggest fields without serializing it,
+// the estimate of a resource version is remembered.
+func objectSize(item metav1.Object) int {
+	key := item.GetUID()
+
+	if key != "" {
+		if hint, ok := sizeHints.Get(key); ok && hint.(sizeHint).resourceVersion == item.GetResourceVersion() {
+			return hint.(sizeHint).size
+		}
+	}
+
+	size := len(item.GetName()) + len(item.GetNamespace()) + mapSize(item.GetLabels()) + mapSize(item.GetAnnotations())
+
+	switch object := item.(type) {
+	case *v1.ConfigMap:
+		size += mapSize(object.Data)
+		for k, v := range object.BinaryData {
+			size += len(k) + len(v)
+		}
+	case *v1.Secret:
+		size += mapSize(object.StringData)
+		for k, v := range object.Data {
+			size += len(k) + len(v)
+		}
+	}
+
+	if key != "" {
+		sizeHints.Add(key, sizeHint{resourceVersion: item.GetResourceVersion(), size: size}, sizeHintsTTL)
+	}
+
+	return size
+}
+
+func mapSize(m map[string]string) int {
+	size := 0
+	for k, v := range m {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// searchFuzzyKeys is searchFuzzy matching the keys only
+func searchFuzzyKeys(m map[string]string, value string) bool {
+	for k := range m {
+		if strings.Contains(k, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// largeObjectWarnings returns a warning for each large object of items
+func largeObjectWarnings(kind string, items []interface{}) []models.SearchWarning {
+	warnings := make([]models.SearchWarning, 0)
+
+	for _, item := range items {
+		object, ok := item.(metav1.Object)
+
+		if !ok || !isLargeObject(object) {
+			continue
+		}
+
+		warnings = append(warnings, models.SearchWarning{
+			Code:      models.WarningLargeObject,
+			Kind:      kind,
+			Namespace: object.GetNamespace(),
+			Message:   fmt.Sprintf("%s is about %d bytes, keyword searches match its annotation keys but not their values", object.GetName(), objectSize(object)),
+		})
+	}
+
+	return warnings
+}
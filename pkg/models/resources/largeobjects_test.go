@@ -0,0 +1,123 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+// appliedConfigMap returns a configmap applied by kubectl with size bytes of data
+func appliedConfigMap(name string, size int) *corev1.ConfigMap {
+	data := strings.Repeat("x", size) + "needle"
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name, UID: types.UID(name), ResourceVersion: "1", Annotations: map[string]string{lastApplied: data}},
+		Data:       map[string]string{"data": data},
+	}
+}
+
+func TestLargeObjectKeywordSearch(t *testing.T) {
+	setupInformers(t, appliedConfigMap("large-settings", 5<<20), appliedConfigMap("small-settings", 1<<10))
+
+	tests := []struct {
+		keyword  string
+		expected []string
+	}{
+		// the annotation values of the large configmap aren't scanned
+		{keyword: "needle", expected: []string{"small-settings"}},
+		// its metadata still matches
+		{keyword: "large", expected: []string{"large-settings"}},
+		{keyword: "last-applied", expected: []string{"large-settings", "small-settings"}},
+	}
+
+	for _, test := range tests {
+		page, err := ListNamespaceResource(context.Background(), "demo", ConfigMaps, &params.Conditions{Fuzzy: map[string]string{keyword: test.keyword}}, name, false, -1, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0)
+		for _, item := range page.Items {
+			names = append(names, item.(*corev1.ConfigMap).Name)
+		}
+
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("keyword %s: expected %v, got %v", test.keyword, test.expected, names)
+		}
+	}
+}
+
+func TestLargeObjectWarnings(t *testing.T) {
+	setupInformers(t, appliedConfigMap("large-settings", 5<<20), appliedConfigMap("small-settings", 1<<10))
+
+	page, err := ListNamespaceResource(context.Background(), "demo", ConfigMaps, &params.Conditions{}, name, false, -1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Warnings) != 1 || page.Warnings[0].Code != models.WarningLargeObject || page.Warnings[0].Kind != ConfigMaps || !strings.HasPrefix(page.Warnings[0].Message, "large-settings ") {
+		t.Errorf("expected a warning of the large configmap, got %+v", page.Warnings)
+	}
+
+	// the warnings are of the page only
+	page, err = ListNamespaceResource(context.Background(), "demo", ConfigMaps, &params.Conditions{}, name, false, 1, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page.Warnings) != 0 {
+		t.Errorf("expected no warning of the page of the small configmap, got %+v", page.Warnings)
+	}
+}
+
+func TestObjectSizeHints(t *testing.T) {
+	defer SetLargeObjectThreshold(0)
+	SetLargeObjectThreshold(1 << 10)
+
+	configMap := appliedConfigMap("hinted-settings", 100)
+
+	if isLargeObject(configMap) {
+		t.Fatalf("expected small, got %d bytes", objectSize(configMap))
+	}
+
+	// the hint of the resource version is used, a new resource version is estimated again
+	configMap.Data["more"] = strings.Repeat("x", 2<<10)
+
+	if isLargeObject(configMap) {
+		t.Errorf("expected the size hint of the resource version")
+	}
+
+	configMap.ResourceVersion = "2"
+
+	if !isLargeObject(configMap) {
+		t.Errorf("expected large after update, got %d bytes", objectSize(configMap))
+	}
+}
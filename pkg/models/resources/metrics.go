@@ -0,0 +1,101 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/cache"
+)
+
+// metrics are labeled by kind only, namespace would make the cardinality unbounded
+var (
+	searchTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "resources_search_total",
+		Help: "Number of resources searches.",
+	}, []string{"kind"})
+
+	searchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "resources_search_duration_seconds",
+		Help:    "Duration of resources searches in seconds.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"kind"})
+
+	searchItemsScanned = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "resources_search_items_scanned",
+		Help:    "Number of cached objects scanned by a resources search.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"kind"})
+
+	searchItemsReturned = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "resources_search_items_returned",
+		Help:    "Number of objects matched by a resources search.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"kind"})
+)
+
+func init() {
+	if err := RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+		glog.Errorf("register resources metrics: %v", err)
+	}
+}
+
+// RegisterMetrics registers the search metrics to registerer, they are registered to the default registry on init.
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{searchTotal, searchDuration, searchItemsScanned, searchItemsReturned} {
+		if err := registerer.Register(collector); err != nil {
+			if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func observeSearch(kind, namespace string, returned int, duration time.Duration) {
+	searchTotal.WithLabelValues(kind).Inc()
+	searchDuration.WithLabelValues(kind).Observe(duration.Seconds())
+	searchItemsReturned.WithLabelValues(kind).Observe(float64(returned))
+
+	if scanned, ok := countCached(kind, namespace); ok {
+		searchItemsScanned.WithLabelValues(kind).Observe(float64(scanned))
+	}
+}
+
+// countCached returns the number of cached objects of kind in namespace, which is what a search scans
+func countCached(kind, namespace string) (int, bool) {
+	informer, err := informerFor(kind)
+
+	if err != nil {
+		return 0, false
+	}
+
+	if namespace == "" {
+		return len(informer.GetIndexer().ListKeys()), true
+	}
+
+	keys, err := informer.GetIndexer().IndexKeys(cache.NamespaceIndex, namespace)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return len(keys), true
+}
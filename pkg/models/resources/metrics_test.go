@@ -0,0 +1,105 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// gatherKind returns the metrics of the families labeled with kind
+func gatherKind(t *testing.T, registry *prometheus.Registry, kind string) map[string]*dto.Metric {
+	families, err := registry.Gather()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make(map[string]*dto.Metric)
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "kind" && label.GetValue() == kind {
+					metrics[family.GetName()] = metric
+				}
+			}
+		}
+	}
+
+	return metrics
+}
+
+func TestSearchMetrics(t *testing.T) {
+	setupInformers(t,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod3"}},
+	)
+
+	registry := prometheus.NewRegistry()
+
+	if err := RegisterMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	// collectors are shared with the default registry, compare with the values before searches
+	before := gatherKind(t, registry, Pods)
+
+	if _, err := ListNamespaceResource(context.Background(), "ns1", Pods, &params.Conditions{Match: map[string]string{name: "pod1"}}, "", false, -1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ListClusterResource(context.Background(), Pods, &params.Conditions{}, "", false, -1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// unsupported kinds aren't recorded
+	ListClusterResource(context.Background(), "foo", &params.Conditions{}, "", false, -1, 0)
+
+	after := gatherKind(t, registry, Pods)
+
+	if count := after["resources_search_total"].GetCounter().GetValue() - before["resources_search_total"].GetCounter().GetValue(); count != 2 {
+		t.Errorf("expected 2 searches, got %v", count)
+	}
+
+	if count := after["resources_search_duration_seconds"].GetHistogram().GetSampleCount() - before["resources_search_duration_seconds"].GetHistogram().GetSampleCount(); count != 2 {
+		t.Errorf("expected 2 duration samples, got %v", count)
+	}
+
+	// 2 pods in ns1 and 3 pods across namespaces
+	if scanned := after["resources_search_items_scanned"].GetHistogram().GetSampleSum() - before["resources_search_items_scanned"].GetHistogram().GetSampleSum(); scanned != 5 {
+		t.Errorf("expected 5 items scanned, got %v", scanned)
+	}
+
+	// 1 matched pod in ns1 and 3 pods across namespaces
+	if returned := after["resources_search_items_returned"].GetHistogram().GetSampleSum() - before["resources_search_items_returned"].GetHistogram().GetSampleSum(); returned != 4 {
+		t.Errorf("expected 4 items returned, got %v", returned)
+	}
+
+	if len(gatherKind(t, registry, "foo")) != 0 {
+		t.Error("expected no metrics of unsupported kind")
+	}
+}
@@ -0,0 +1,242 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
+)
+
+const (
+	defaultMigrationQPS   = 5
+	defaultMigrationBurst = 10
+)
+
+// migratedKinds are the kinds whose legacy displayName label is migrated
+var migratedKinds = []string{ConfigMaps, CronJobs, DaemonSets, Deployments, Ingresses, Jobs, PersistentVolumeClaims, Secrets, Services, StatefulSets}
+
+// DisplayNameChange is an object whose legacy displayName label is copied to the alias-name annotation
+type DisplayNameChange struct {
+	Kind        string `json:"kind"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// DisplayNameMigrationReport counts the objects visited by a migration
+type DisplayNameMigrationReport struct {
+	DryRun bool `json:"dryRun"`
+	// objects carrying the legacy label
+	Scanned int `json:"scanned"`
+	// objects patched in this run, or to be patched in a dry run
+	Migrated int `json:"migrated"`
+	// objects whose alias-name annotation is already set, it takes precedence over the label
+	Skipped int                 `json:"skipped"`
+	Changes []DisplayNameChange `json:"changes"`
+	// key of the last patched object if the migration was interrupted, empty once it completes
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// objectPatcher patches objects of a kind in the API server
+type objectPatcher interface {
+	patch(kind, namespace, name string, patchType types.PatchType, data []byte) error
+}
+
+// DisplayNameMigration copies the legacy displayName label of objects to the alias-name annotation.
+// Objects are visited in order of their keys, the key of the last patched object is kept as cursor,
+// so a migration interrupted by a failed patch resumes after it.
+type DisplayNameMigration struct {
+	patcher objectPatcher
+	limiter flowcontrol.RateLimiter
+
+	mutex  sync.Mutex
+	cursor string
+}
+
+var (
+	migrationOnce    sync.Once
+	defaultMigration *DisplayNameMigration
+)
+
+// NewDisplayNameMigration returns a migration patching at most qps objects per second.
+func NewDisplayNameMigration(client kubernetes.Interface, qps float32, burst int) *DisplayNameMigration {
+	return &DisplayNameMigration{patcher: &clientsetStore{client: client}, limiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst)}
+}
+
+func sharedMigration() *DisplayNameMigration {
+	migrationOnce.Do(func() {
+		defaultMigration = NewDisplayNameMigration(k8s.Client(), defaultMigrationQPS, defaultMigrationBurst)
+	})
+	return defaultMigration
+}
+
+// MigrateDisplayNames copies the legacy displayName label to the alias-name annotation of objects in
+// namespaces, all namespaces if it's empty. A dry run reports the changes without patching.
+func MigrateDisplayNames(namespaces []string, dryRun bool) (*DisplayNameMigrationReport, error) {
+	return sharedMigration().Run(namespaces, dryRun)
+}
+
+func (m *DisplayNameMigration) Run(namespaces []string, dryRun bool) (*DisplayNameMigrationReport, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	changes, report, err := displayNameChanges(namespaces)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report.DryRun = dryRun
+
+	for _, change := range changes {
+		key := migrationKey(change.Kind, change.Namespace, change.Name)
+
+		// patched before the interruption
+		if !dryRun && m.cursor != "" && key <= m.cursor {
+			continue
+		}
+
+		if !dryRun {
+			m.limiter.Accept()
+			if err := m.patcher.patch(change.Kind, change.Namespace, change.Name, types.MergePatchType, displayNamePatch(change.DisplayName)); err != nil {
+				report.Cursor = m.cursor
+				return report, fmt.Errorf("migrate display name of %s: %v", key, err)
+			}
+			m.cursor = key
+		}
+
+		report.Migrated++
+		report.Changes = append(report.Changes, change)
+	}
+
+	if !dryRun {
+		m.cursor = ""
+	}
+
+	return report, nil
+}
+
+// displayNameChanges lists the objects carrying the legacy label from the informer caches, ordered by key
+func displayNameChanges(namespaces []string) ([]DisplayNameChange, *DisplayNameMigrationReport, error) {
+	report := &DisplayNameMigrationReport{Changes: make([]DisplayNameChange, 0)}
+	changes := make([]DisplayNameChange, 0)
+
+	selected := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		selected[namespace] = true
+	}
+
+	for _, kind := range migratedKinds {
+		if !cacheSynced(informers.SharedInformerFactory(), kind) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotSynced, kind)
+		}
+
+		informer, err := informerFor(kind)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, object := range informer.GetIndexer().List() {
+			item, ok := object.(metav1.Object)
+
+			if !ok || (len(selected) > 0 && !selected[item.GetNamespace()]) {
+				continue
+			}
+
+			label := item.GetLabels()[displayName]
+
+			if label == "" {
+				continue
+			}
+
+			report.Scanned++
+
+			if item.GetAnnotations()[constants.DisplayNameAnnotationKey] != "" {
+				report.Skipped++
+				continue
+			}
+
+			changes = append(changes, DisplayNameChange{Kind: kind, Namespace: item.GetNamespace(), Name: item.GetName(), DisplayName: label})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return migrationKey(changes[i].Kind, changes[i].Namespace, changes[i].Name) < migrationKey(changes[j].Kind, changes[j].Namespace, changes[j].Name)
+	})
+
+	return changes, report, nil
+}
+
+func migrationKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func displayNamePatch(value string) []byte {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{constants.DisplayNameAnnotationKey: value},
+		},
+	}
+
+	// a map of strings always marshals
+	data, _ := json.Marshal(patch)
+	return data
+}
+
+func (s *clientsetStore) patch(kind, namespace, name string, patchType types.PatchType, data []byte) error {
+	var err error
+
+	switch kind {
+	case Deployments:
+		_, err = s.client.AppsV1().Deployments(namespace).Patch(name, patchType, data)
+	case StatefulSets:
+		_, err = s.client.AppsV1().StatefulSets(namespace).Patch(name, patchType, data)
+	case DaemonSets:
+		_, err = s.client.AppsV1().DaemonSets(namespace).Patch(name, patchType, data)
+	case Jobs:
+		_, err = s.client.BatchV1().Jobs(namespace).Patch(name, patchType, data)
+	case CronJobs:
+		_, err = s.client.BatchV1beta1().CronJobs(namespace).Patch(name, patchType, data)
+	case Services:
+		_, err = s.client.CoreV1().Services(namespace).Patch(name, patchType, data)
+	case ConfigMaps:
+		_, err = s.client.CoreV1().ConfigMaps(namespace).Patch(name, patchType, data)
+	case Secrets:
+		_, err = s.client.CoreV1().Secrets(namespace).Patch(name, patchType, data)
+	case PersistentVolumeClaims:
+		_, err = s.client.CoreV1().PersistentVolumeClaims(namespace).Patch(name, patchType, data)
+	case Ingresses:
+		_, err = s.client.ExtensionsV1beta1().Ingresses(namespace).Patch(name, patchType, data)
+	default:
+		err = kindUnavailable(kind)
+	}
+
+	return err
+}
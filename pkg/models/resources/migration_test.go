@@ -0,0 +1,131 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// fakePatcher records the patches, the patch of failOn fails
+type fakePatcher struct {
+	failOn  string
+	patches []string
+	mutex   sync.Mutex
+}
+
+func (p *fakePatcher) patch(kind, namespace, name string, patchType types.PatchType, data []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := migrationKey(kind, namespace, name)
+	if key == p.failOn {
+		return fmt.Errorf("connection refused")
+	}
+	if patchType != types.MergePatchType {
+		return fmt.Errorf("unexpected patch type %s", patchType)
+	}
+	p.patches = append(p.patches, key+" "+string(data))
+	return nil
+}
+
+func migrationFixtures() []runtime.Object {
+	objects := append(displayNameFixtures("demo"), displayNameFixtures("other")...)
+	return append(objects, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "settings", Labels: map[string]string{displayName: "settings"}}})
+}
+
+func TestMigrateDisplayNamesDryRun(t *testing.T) {
+	setupInformers(t, migrationFixtures()...)
+
+	patcher := &fakePatcher{}
+	migration := &DisplayNameMigration{patcher: patcher, limiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+
+	report, err := migration.Run([]string{"demo"}, true)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DisplayNameChange{
+		{Kind: ConfigMaps, Namespace: "demo", Name: "settings", DisplayName: "settings"},
+		{Kind: Deployments, Namespace: "demo", Name: "label-only", DisplayName: "backend"},
+		{Kind: Services, Namespace: "demo", Name: "label-only", DisplayName: "backend"},
+	}
+
+	if !reflect.DeepEqual(report.Changes, expected) {
+		t.Errorf("expected changes %v, got %v", expected, report.Changes)
+	}
+
+	// the objects carrying both are skipped, the annotation takes precedence
+	if !report.DryRun || report.Scanned != 5 || report.Migrated != 3 || report.Skipped != 2 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if len(patcher.patches) != 0 {
+		t.Errorf("expected no patch in dry run, got %v", patcher.patches)
+	}
+}
+
+func TestMigrateDisplayNamesResume(t *testing.T) {
+	setupInformers(t, migrationFixtures()...)
+
+	patcher := &fakePatcher{failOn: migrationKey(Services, "demo", "label-only")}
+	migration := &DisplayNameMigration{patcher: patcher, limiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+
+	report, err := migration.Run(nil, false)
+
+	if err == nil {
+		t.Fatal("expected interrupted migration")
+	}
+
+	if report.Migrated != 3 || report.Cursor != migrationKey(Deployments, "other", "label-only") {
+		t.Errorf("unexpected report of interrupted migration %+v", report)
+	}
+
+	patcher.failOn = ""
+
+	report, err = migration.Run(nil, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Migrated != 2 || report.Cursor != "" {
+		t.Errorf("unexpected report of resumed migration %+v", report)
+	}
+
+	expected := []string{
+		`configmaps/demo/settings {"metadata":{"annotations":{"kubesphere.io/alias-name":"settings"}}}`,
+		`deployments/demo/label-only {"metadata":{"annotations":{"kubesphere.io/alias-name":"backend"}}}`,
+		`deployments/other/label-only {"metadata":{"annotations":{"kubesphere.io/alias-name":"backend"}}}`,
+		`services/demo/label-only {"metadata":{"annotations":{"kubesphere.io/alias-name":"backend"}}}`,
+		`services/other/label-only {"metadata":{"annotations":{"kubesphere.io/alias-name":"backend"}}}`,
+	}
+
+	if !reflect.DeepEqual(patcher.patches, expected) {
+		t.Errorf("expected each object patched once %v, got %v", expected, patcher.patches)
+	}
+}
@@ -18,7 +18,8 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
+	"kubesphere.io/kubesphere/pkg/constants"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -35,7 +36,11 @@ func (*namespaceSearcher) match(match map[string]string, item *v1.Namespace) boo
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
+				return false
+			}
+		case workspace:
+			if item.Labels[constants.WorkspaceLabelKey] != v {
 				return false
 			}
 		default:
@@ -50,7 +55,7 @@ func (*namespaceSearcher) fuzzy(fuzzy map[string]string, item *v1.Namespace) boo
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -67,7 +72,7 @@ func (*namespaceSearcher) fuzzy(fuzzy map[string]string, item *v1.Namespace) boo
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -79,6 +84,10 @@ func (*namespaceSearcher) fuzzy(fuzzy map[string]string, item *v1.Namespace) boo
 	return true
 }
 
+func (*namespaceSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*namespaceSearcher) compare(a, b *v1.Namespace, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -90,8 +99,8 @@ func (*namespaceSearcher) compare(a, b *v1.Namespace, orderBy string) bool {
 	}
 }
 
-func (s *namespaceSearcher) search(conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	namespaces, err := informers.SharedInformerFactory().Core().V1().Namespaces().Lister().List(labels.Everything())
+func (s *namespaceSearcher) search(factory informers.SharedInformerFactory, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	namespaces, err := factory.Core().V1().Namespaces().Lister().List(labels.Everything())
 
 	if err != nil {
 		return nil, err
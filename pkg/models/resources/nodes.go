@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -35,7 +35,7 @@ func (*nodeSearcher) match(match map[string]string, item *v1.Node) bool {
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		default:
@@ -50,7 +50,7 @@ func (*nodeSearcher) fuzzy(fuzzy map[string]string, item *v1.Node) bool {
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -67,7 +67,7 @@ func (*nodeSearcher) fuzzy(fuzzy map[string]string, item *v1.Node) bool {
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -79,6 +79,10 @@ func (*nodeSearcher) fuzzy(fuzzy map[string]string, item *v1.Node) bool {
 	return true
 }
 
+func (*nodeSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*nodeSearcher) compare(a, b *v1.Node, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -90,8 +94,8 @@ func (*nodeSearcher) compare(a, b *v1.Node, orderBy string) bool {
 	}
 }
 
-func (s *nodeSearcher) search(conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	nodes, err := informers.SharedInformerFactory().Core().V1().Nodes().Lister().List(labels.Everything())
+func (s *nodeSearcher) search(factory informers.SharedInformerFactory, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	nodes, err := factory.Core().V1().Nodes().Lister().List(labels.Everything())
 
 	if err != nil {
 		return nil, err
@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -35,7 +35,27 @@ func (*podSearcher) match(match map[string]string, item *v1.Pod) bool {
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
+				return false
+			}
+		case containerName:
+			if !hasContainer(&item.Spec, v) {
+				return false
+			}
+		case envVar:
+			if !definesEnvVar(&item.Spec, v) {
+				return false
+			}
+		case mountsSecret:
+			if !mountsSecretNamed(&item.Spec, v) {
+				return false
+			}
+		case mountsConfigMap:
+			if !mountsConfigMapNamed(&item.Spec, v) {
+				return false
+			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec, k, v) {
 				return false
 			}
 		default:
@@ -45,12 +65,95 @@ func (*podSearcher) match(match map[string]string, item *v1.Pod) bool {
 	return true
 }
 
+// hasContainer reports whether a container or init container is named name
+func hasContainer(spec *v1.PodSpec, name string) bool {
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == name {
+			return true
+		}
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// definesEnvVar reports whether a container defines the variable, with a value or valueFrom
+func definesEnvVar(spec *v1.PodSpec, variable string) bool {
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for _, env := range containers[i].Env {
+				if env.Name == variable {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mountsSecretNamed reports whether a volume, projected volume or envFrom of a container
+// references the secret
+func mountsSecretNamed(spec *v1.PodSpec, secret string) bool {
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == secret {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secret {
+					return true
+				}
+			}
+		}
+	}
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for _, envFrom := range containers[i].EnvFrom {
+				if envFrom.SecretRef != nil && envFrom.SecretRef.Name == secret {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// mountsConfigMapNamed reports whether a volume, projected volume or envFrom of a container
+// references the configmap
+func mountsConfigMapNamed(spec *v1.PodSpec, configMap string) bool {
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil && volume.ConfigMap.Name == configMap {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil && source.ConfigMap.Name == configMap {
+					return true
+				}
+			}
+		}
+	}
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			for _, envFrom := range containers[i].EnvFrom {
+				if envFrom.ConfigMapRef != nil && envFrom.ConfigMapRef.Name == configMap {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // Fuzzy searchInNamespace
 func (*podSearcher) fuzzy(fuzzy map[string]string, item *v1.Pod) bool {
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -67,7 +170,7 @@ func (*podSearcher) fuzzy(fuzzy map[string]string, item *v1.Pod) bool {
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -79,6 +182,10 @@ func (*podSearcher) fuzzy(fuzzy map[string]string, item *v1.Pod) bool {
 	return true
 }
 
+func (*podSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*podSearcher) compare(a, b *v1.Pod, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -90,9 +197,13 @@ func (*podSearcher) compare(a, b *v1.Pod, orderBy string) bool {
 	}
 }
 
-func (s *podSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+func (s *podSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1.Pod), b.(*v1.Pod), orderBy)
+}
+
+func (s *podSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
 
-	pods, err := informers.SharedInformerFactory().Core().V1().Pods().Lister().Pods(namespace).List(labels.Everything())
+	pods, err := factory.Core().V1().Pods().Lister().Pods(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
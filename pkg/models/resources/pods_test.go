@@ -0,0 +1,109 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func containerFixtures() []runtime.Object {
+	return []runtime.Object{
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "meshed"},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "istio-init", Env: []corev1.EnvVar{{Name: "INBOUND_PORTS", Value: "*"}}}},
+				Containers: []corev1.Container{
+					{Name: "app", Env: []corev1.EnvVar{{Name: "DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"}}}}},
+					{Name: "istio-proxy", EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "istio-token"}}}}},
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "projected"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}}}},
+				Volumes: []corev1.Volume{{Name: "bundle", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "ca"}}},
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "tls"}}},
+				}}}}},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "volumes"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app"}},
+				Volumes: []corev1.Volume{
+					{Name: "tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "tls"}}},
+					{Name: "settings", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}},
+				},
+				// pulling isn't mounting
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			},
+		},
+	}
+}
+
+func TestPodContainerConditions(t *testing.T) {
+	setupInformers(t, containerFixtures()...)
+
+	tests := []struct {
+		match    map[string]string
+		expected []string
+	}{
+		{match: map[string]string{containerName: "istio-proxy"}, expected: []string{"meshed"}},
+		{match: map[string]string{containerName: "istio-init"}, expected: []string{"meshed"}},
+		{match: map[string]string{containerName: "app"}, expected: []string{"meshed", "projected", "volumes"}},
+		{match: map[string]string{containerName: "istio"}, expected: []string{}},
+		{match: map[string]string{envVar: "DB_PASSWORD"}, expected: []string{"meshed"}},
+		{match: map[string]string{envVar: "INBOUND_PORTS"}, expected: []string{"meshed"}},
+		{match: map[string]string{envVar: "db_password"}, expected: []string{}},
+		{match: map[string]string{mountsSecret: "istio-token"}, expected: []string{"meshed"}},
+		{match: map[string]string{mountsSecret: "tls"}, expected: []string{"projected", "volumes"}},
+		// a single key of a secret isn't the secret mounted
+		{match: map[string]string{mountsSecret: "db"}, expected: []string{}},
+		{match: map[string]string{mountsSecret: "registry"}, expected: []string{}},
+		{match: map[string]string{mountsConfigMap: "settings"}, expected: []string{"projected", "volumes"}},
+		{match: map[string]string{mountsConfigMap: "ca"}, expected: []string{"projected"}},
+		{match: map[string]string{containerName: "app", mountsSecret: "tls", mountsConfigMap: "settings"}, expected: []string{"projected", "volumes"}},
+	}
+
+	for _, test := range tests {
+		result, err := ListNamespaceResource(context.Background(), "demo", Pods, &params.Conditions{Match: test.match}, name, false, -1, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0)
+		for _, item := range result.Items {
+			names = append(names, item.(*corev1.Pod).Name)
+		}
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.match, test.expected, names)
+		}
+	}
+}
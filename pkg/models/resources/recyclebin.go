@@ -0,0 +1,461 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/simple/client/k8s"
+)
+
+const (
+	recycleBinLabelKey             = "kubesphere.io/recycle-bin"
+	recycleBinKindAnnotation       = "kubesphere.io/deleted-kind"
+	recycleBinNamespaceAnnotation  = "kubesphere.io/deleted-namespace"
+	recycleBinNameAnnotation       = "kubesphere.io/deleted-name"
+	recycleBinDeletedAtAnnotation  = "kubesphere.io/deleted-at"
+	recycleBinObjectKey            = "object"
+	recycleBinSnapshotPrefix       = "recycled-"
+	defaultRecycleBinMaxAge        = 7 * 24 * time.Hour
+	defaultRecycleBinMaxCount      = 500
+	defaultRecycleBinPruneInterval = 10 * time.Minute
+	// attempts to restore an object with a suffixed name if the name is taken
+	maxRestoreAttempts = 10
+)
+
+// DeletedResource is a snapshot of a resource deleted by DeleteWithSnapshot
+type DeletedResource struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// objectStore reads and writes objects of a kind in the API server
+type objectStore interface {
+	get(kind, namespace, name string) (runtime.Object, error)
+	create(kind string, object runtime.Object) (runtime.Object, error)
+	delete(kind, namespace, name string) error
+	listConfigMaps(namespace string, selector labels.Selector) ([]corev1.ConfigMap, error)
+}
+
+// RecycleBin keeps snapshots of deleted resources in ConfigMaps of a system namespace, snapshots
+// older than maxAge or exceeding maxCount are pruned.
+type RecycleBin struct {
+	store     objectStore
+	namespace string
+	maxAge    time.Duration
+	maxCount  int
+	now       func() time.Time
+}
+
+var (
+	recycleBinOnce    sync.Once
+	defaultRecycleBin *RecycleBin
+)
+
+// NewRecycleBin returns a recycle bin keeping snapshots in namespace.
+func NewRecycleBin(client kubernetes.Interface, namespace string, maxAge time.Duration, maxCount int) *RecycleBin {
+	return &RecycleBin{store: &clientsetStore{client: client}, namespace: namespace, maxAge: maxAge, maxCount: maxCount, now: time.Now}
+}
+
+func sharedRecycleBin() *RecycleBin {
+	recycleBinOnce.Do(func() {
+		defaultRecycleBin = NewRecycleBin(k8s.Client(), constants.KubeSphereNamespace, defaultRecycleBinMaxAge, defaultRecycleBinMaxCount)
+	})
+	return defaultRecycleBin
+}
+
+// DeleteWithSnapshot deletes the resource after saving a snapshot of it in the recycle bin.
+func DeleteWithSnapshot(kind, namespace, name string) (*DeletedResource, error) {
+	return sharedRecycleBin().DeleteWithSnapshot(kind, namespace, name)
+}
+
+// ListDeleted lists the snapshots of resources deleted from namespace, the latest first.
+func ListDeleted(namespace string) ([]DeletedResource, error) {
+	return sharedRecycleBin().ListDeleted(namespace)
+}
+
+// Restore re-creates the deleted resource of snapshot id.
+func Restore(id string) (runtime.Object, error) {
+	return sharedRecycleBin().Restore(id)
+}
+
+// StartRecycleBinPruner prunes the recycle bin periodically until stopCh is closed.
+func StartRecycleBinPruner(stopCh <-chan struct{}) {
+	sharedRecycleBin().Start(stopCh)
+}
+
+func (b *RecycleBin) DeleteWithSnapshot(kind, namespace, name string) (*DeletedResource, error) {
+	object, err := b.store.get(kind, namespace, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := snapshot(object)
+
+	if err != nil {
+		return nil, err
+	}
+
+	meta := object.(metav1.Object)
+	deletedAt := b.now()
+
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      recycleBinSnapshotPrefix + string(meta.GetUID()),
+			Namespace: b.namespace,
+			Labels:    map[string]string{recycleBinLabelKey: "true"},
+			Annotations: map[string]string{
+				recycleBinKindAnnotation:      kind,
+				recycleBinNamespaceAnnotation: namespace,
+				recycleBinNameAnnotation:      name,
+				recycleBinDeletedAtAnnotation: deletedAt.UTC().Format(time.RFC3339),
+			},
+		},
+		Data: map[string]string{recycleBinObjectKey: string(data)},
+	}
+
+	if _, err := b.store.create(ConfigMaps, configMap); err != nil {
+		return nil, err
+	}
+
+	if err := b.store.delete(kind, namespace, name); err != nil {
+		// keep the recycle bin consistent with what has been deleted
+		if deleteErr := b.store.delete(ConfigMaps, b.namespace, configMap.Name); deleteErr != nil {
+			glog.Errorf("remove snapshot %s: %v", configMap.Name, deleteErr)
+		}
+		return nil, err
+	}
+
+	return deletedResource(configMap), nil
+}
+
+func (b *RecycleBin) ListDeleted(namespace string) ([]DeletedResource, error) {
+	snapshots, err := b.listSnapshots()
+
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]DeletedResource, 0)
+	for i := range snapshots {
+		if item := deletedResource(&snapshots[i]); item.Namespace == namespace {
+			deleted = append(deleted, *item)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (b *RecycleBin) Restore(id string) (runtime.Object, error) {
+	object, err := b.store.get(ConfigMaps, b.namespace, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	configMap := object.(*corev1.ConfigMap)
+
+	if configMap.Labels[recycleBinLabelKey] != "true" {
+		return nil, fmt.Errorf("%s is not a snapshot of recycle bin", id)
+	}
+
+	kind := configMap.Annotations[recycleBinKindAnnotation]
+	restored, err := newRecyclableObject(kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(configMap.Data[recycleBinObjectKey]), restored); err != nil {
+		return nil, err
+	}
+
+	clearImmutableFields(restored)
+
+	meta := restored.(metav1.Object)
+	name := meta.GetName()
+
+	var created runtime.Object
+	for attempt := 0; attempt < maxRestoreAttempts; attempt++ {
+		if attempt > 0 {
+			meta.SetName(fmt.Sprintf("%s-restored-%d", name, attempt))
+		}
+		created, err = b.store.create(kind, restored)
+		if !errors.IsAlreadyExists(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.store.delete(ConfigMaps, b.namespace, id); err != nil && !errors.IsNotFound(err) {
+		glog.Errorf("remove restored snapshot %s: %v", id, err)
+	}
+
+	return created, nil
+}
+
+// Start prunes the recycle bin periodically until stopCh is closed.
+func (b *RecycleBin) Start(stopCh <-chan struct{}) {
+	go wait.Until(func() {
+		if err := b.prune(); err != nil {
+			glog.Errorf("prune recycle bin: %v", err)
+		}
+	}, defaultRecycleBinPruneInterval, stopCh)
+}
+
+// prune removes snapshots older than maxAge and the oldest snapshots exceeding maxCount
+func (b *RecycleBin) prune() error {
+	snapshots, err := b.listSnapshots()
+
+	if err != nil {
+		return err
+	}
+
+	now := b.now()
+
+	for i := range snapshots {
+		item := deletedResource(&snapshots[i])
+		if i >= b.maxCount || now.Sub(item.DeletedAt) > b.maxAge {
+			if err := b.store.delete(ConfigMaps, b.namespace, item.ID); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// listSnapshots returns snapshots, the latest deleted first
+func (b *RecycleBin) listSnapshots() ([]corev1.ConfigMap, error) {
+	snapshots, err := b.store.listConfigMaps(b.namespace, labels.SelectorFromSet(labels.Set{recycleBinLabelKey: "true"}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return deletedResource(&snapshots[i]).DeletedAt.After(deletedResource(&snapshots[j]).DeletedAt)
+	})
+
+	return snapshots, nil
+}
+
+func deletedResource(configMap *corev1.ConfigMap) *DeletedResource {
+	deletedAt, _ := time.Parse(time.RFC3339, configMap.Annotations[recycleBinDeletedAtAnnotation])
+	return &DeletedResource{
+		ID:        configMap.Name,
+		Kind:      configMap.Annotations[recycleBinKindAnnotation],
+		Namespace: configMap.Annotations[recycleBinNamespaceAnnotation],
+		Name:      configMap.Annotations[recycleBinNameAnnotation],
+		DeletedAt: deletedAt,
+	}
+}
+
+// snapshot serializes object without status and fields managed by the API server
+func snapshot(object runtime.Object) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delete(content, "status")
+
+	if meta, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"uid", "resourceVersion", "selfLink", "generation", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "managedFields"} {
+			delete(meta, field)
+		}
+	}
+
+	return json.Marshal(content)
+}
+
+// clearImmutableFields clears fields allocated by the API server or controllers which
+// can't be reused by the re-created object
+func clearImmutableFields(object runtime.Object) {
+	switch item := object.(type) {
+	case *corev1.Service:
+		if item.Spec.ClusterIP != corev1.ClusterIPNone {
+			item.Spec.ClusterIP = ""
+		}
+	case *corev1.PersistentVolumeClaim:
+		// the released volume can't be bound again
+		item.Spec.VolumeName = ""
+	case *batchv1.Job:
+		// selector is generated from the uid of the deleted job
+		if item.Spec.ManualSelector == nil || !*item.Spec.ManualSelector {
+			item.Spec.Selector = nil
+			delete(item.Spec.Template.Labels, "controller-uid")
+			delete(item.Spec.Template.Labels, "job-name")
+		}
+	}
+}
+
+func newRecyclableObject(kind string) (runtime.Object, error) {
+	switch kind {
+	case Deployments:
+		return &appsv1.Deployment{}, nil
+	case StatefulSets:
+		return &appsv1.StatefulSet{}, nil
+	case DaemonSets:
+		return &appsv1.DaemonSet{}, nil
+	case Jobs:
+		return &batchv1.Job{}, nil
+	case CronJobs:
+		return &batchv1beta1.CronJob{}, nil
+	case Services:
+		return &corev1.Service{}, nil
+	case ConfigMaps:
+		return &corev1.ConfigMap{}, nil
+	case Secrets:
+		return &corev1.Secret{}, nil
+	case PersistentVolumeClaims:
+		return &corev1.PersistentVolumeClaim{}, nil
+	case Ingresses:
+		return &v1beta1.Ingress{}, nil
+	default:
+		return nil, kindUnavailable(kind)
+	}
+}
+
+// clientsetStore is the objectStore of the API server
+type clientsetStore struct {
+	client kubernetes.Interface
+}
+
+func (s *clientsetStore) get(kind, namespace, name string) (runtime.Object, error) {
+	options := metav1.GetOptions{}
+
+	switch kind {
+	case Deployments:
+		return s.client.AppsV1().Deployments(namespace).Get(name, options)
+	case StatefulSets:
+		return s.client.AppsV1().StatefulSets(namespace).Get(name, options)
+	case DaemonSets:
+		return s.client.AppsV1().DaemonSets(namespace).Get(name, options)
+	case Jobs:
+		return s.client.BatchV1().Jobs(namespace).Get(name, options)
+	case CronJobs:
+		return s.client.BatchV1beta1().CronJobs(namespace).Get(name, options)
+	case Services:
+		return s.client.CoreV1().Services(namespace).Get(name, options)
+	case ConfigMaps:
+		return s.client.CoreV1().ConfigMaps(namespace).Get(name, options)
+	case Secrets:
+		return s.client.CoreV1().Secrets(namespace).Get(name, options)
+	case PersistentVolumeClaims:
+		return s.client.CoreV1().PersistentVolumeClaims(namespace).Get(name, options)
+	case Ingresses:
+		return s.client.ExtensionsV1beta1().Ingresses(namespace).Get(name, options)
+	default:
+		return nil, kindUnavailable(kind)
+	}
+}
+
+func (s *clientsetStore) create(kind string, object runtime.Object) (runtime.Object, error) {
+	switch item := object.(type) {
+	case *appsv1.Deployment:
+		return s.client.AppsV1().Deployments(item.Namespace).Create(item)
+	case *appsv1.StatefulSet:
+		return s.client.AppsV1().StatefulSets(item.Namespace).Create(item)
+	case *appsv1.DaemonSet:
+		return s.client.AppsV1().DaemonSets(item.Namespace).Create(item)
+	case *batchv1.Job:
+		return s.client.BatchV1().Jobs(item.Namespace).Create(item)
+	case *batchv1beta1.CronJob:
+		return s.client.BatchV1beta1().CronJobs(item.Namespace).Create(item)
+	case *corev1.Service:
+		return s.client.CoreV1().Services(item.Namespace).Create(item)
+	case *corev1.ConfigMap:
+		return s.client.CoreV1().ConfigMaps(item.Namespace).Create(item)
+	case *corev1.Secret:
+		return s.client.CoreV1().Secrets(item.Namespace).Create(item)
+	case *corev1.PersistentVolumeClaim:
+		return s.client.CoreV1().PersistentVolumeClaims(item.Namespace).Create(item)
+	case *v1beta1.Ingress:
+		return s.client.ExtensionsV1beta1().Ingresses(item.Namespace).Create(item)
+	default:
+		return nil, kindUnavailable(kind)
+	}
+}
+
+func (s *clientsetStore) delete(kind, namespace, name string) error {
+	// dependents are garbage collected in background
+	policy := metav1.DeletePropagationBackground
+	options := &metav1.DeleteOptions{PropagationPolicy: &policy}
+
+	switch kind {
+	case Deployments:
+		return s.client.AppsV1().Deployments(namespace).Delete(name, options)
+	case StatefulSets:
+		return s.client.AppsV1().StatefulSets(namespace).Delete(name, options)
+	case DaemonSets:
+		return s.client.AppsV1().DaemonSets(namespace).Delete(name, options)
+	case Jobs:
+		return s.client.BatchV1().Jobs(namespace).Delete(name, options)
+	case CronJobs:
+		return s.client.BatchV1beta1().CronJobs(namespace).Delete(name, options)
+	case Services:
+		return s.client.CoreV1().Services(namespace).Delete(name, options)
+	case ConfigMaps:
+		return s.client.CoreV1().ConfigMaps(namespace).Delete(name, options)
+	case Secrets:
+		return s.client.CoreV1().Secrets(namespace).Delete(name, options)
+	case PersistentVolumeClaims:
+		return s.client.CoreV1().PersistentVolumeClaims(namespace).Delete(name, options)
+	case Ingresses:
+		return s.client.ExtensionsV1beta1().Ingresses(namespace).Delete(name, options)
+	default:
+		return kindUnavailable(kind)
+	}
+}
+
+func (s *clientsetStore) listConfigMaps(namespace string, selector labels.Selector) ([]corev1.ConfigMap, error) {
+	list, err := s.client.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
@@ -0,0 +1,269 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeStore keeps objects in memory, keyed by kind/namespace/name
+type fakeStore struct {
+	objects map[string]runtime.Object
+}
+
+func newFakeStore(objects ...runtime.Object) *fakeStore {
+	store := &fakeStore{objects: make(map[string]runtime.Object)}
+	for _, object := range objects {
+		if _, err := store.create(fakeKind(object), object); err != nil {
+			panic(err)
+		}
+	}
+	return store
+}
+
+func fakeKind(object runtime.Object) string {
+	switch object.(type) {
+	case *appsv1.Deployment:
+		return Deployments
+	case *batchv1.Job:
+		return Jobs
+	case *corev1.Service:
+		return Services
+	case *corev1.ConfigMap:
+		return ConfigMaps
+	case *corev1.PersistentVolumeClaim:
+		return PersistentVolumeClaims
+	default:
+		panic(fmt.Sprintf("unsupported object %T", object))
+	}
+}
+
+func (s *fakeStore) get(kind, namespace, name string) (runtime.Object, error) {
+	object, ok := s.objects[kind+"/"+namespace+"/"+name]
+	if !ok {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	return object.DeepCopyObject(), nil
+}
+
+func (s *fakeStore) create(kind string, object runtime.Object) (runtime.Object, error) {
+	meta := object.(metav1.Object)
+	key := kind + "/" + meta.GetNamespace() + "/" + meta.GetName()
+	if _, ok := s.objects[key]; ok {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{Resource: kind}, meta.GetName())
+	}
+	created := object.DeepCopyObject()
+	created.(metav1.Object).SetUID(types.UID(fmt.Sprintf("uid-%s", meta.GetName())))
+	s.objects[key] = created
+	return created.DeepCopyObject(), nil
+}
+
+func (s *fakeStore) delete(kind, namespace, name string) error {
+	key := kind + "/" + namespace + "/" + name
+	if _, ok := s.objects[key]; !ok {
+		return errors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *fakeStore) listConfigMaps(namespace string, selector labels.Selector) ([]corev1.ConfigMap, error) {
+	configMaps := make([]corev1.ConfigMap, 0)
+	for _, object := range s.objects {
+		if configMap, ok := object.(*corev1.ConfigMap); ok && configMap.Namespace == namespace && selector.Matches(labels.Set(configMap.Labels)) {
+			configMaps = append(configMaps, *configMap.DeepCopy())
+		}
+	}
+	return configMaps, nil
+}
+
+func newTestRecycleBin(store objectStore, now *time.Time) *RecycleBin {
+	return &RecycleBin{store: store, namespace: "kubesphere-system", maxAge: time.Hour, maxCount: 2, now: func() time.Time { return *now }}
+}
+
+func TestRecycleBinRoundTrip(t *testing.T) {
+	replicas := int32(3)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web", Labels: map[string]string{"app": "web"}, ResourceVersion: "42"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 3},
+	}
+
+	store := newFakeStore(deployment)
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	bin := newTestRecycleBin(store, &now)
+
+	deleted, err := bin.DeleteWithSnapshot(Deployments, "demo", "web")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.get(Deployments, "demo", "web"); !errors.IsNotFound(err) {
+		t.Errorf("expected deployment deleted, got %v", err)
+	}
+
+	list, err := bin.ListDeleted("demo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0] != *deleted || list[0].Kind != Deployments || list[0].Name != "web" || !list[0].DeletedAt.Equal(now) {
+		t.Errorf("unexpected deleted resources %+v", list)
+	}
+
+	if other, _ := bin.ListDeleted("other"); len(other) != 0 {
+		t.Errorf("expected no deleted resources in other namespace, got %+v", other)
+	}
+
+	restored, err := bin.Restore(deleted.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := restored.(*appsv1.Deployment)
+
+	if item.Name != "web" || item.Labels["app"] != "web" || *item.Spec.Replicas != 3 {
+		t.Errorf("unexpected restored deployment %+v", item)
+	}
+
+	// status and fields managed by the API server aren't restored
+	if item.Status.ReadyReplicas != 0 || item.ResourceVersion != "" {
+		t.Errorf("expected status and resource version dropped, got %+v", item)
+	}
+
+	if list, _ := bin.ListDeleted("demo"); len(list) != 0 {
+		t.Errorf("expected snapshot removed after restore, got %+v", list)
+	}
+}
+
+func TestRecycleBinRestoreConflict(t *testing.T) {
+	manualSelector := false
+	objects := []runtime.Object{
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web"}, Spec: corev1.ServiceSpec{ClusterIP: "10.0.0.1"}},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "backup"},
+			Spec: batchv1.JobSpec{
+				ManualSelector: &manualSelector,
+				Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"controller-uid": "1"}},
+				Template:       corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"controller-uid": "1", "job-name": "backup", "app": "backup"}}},
+			},
+		},
+	}
+
+	store := newFakeStore(objects...)
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	bin := newTestRecycleBin(store, &now)
+
+	service, err := bin.DeleteWithSnapshot(Services, "demo", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := bin.DeleteWithSnapshot(Jobs, "demo", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the names are taken again meanwhile
+	addObjects(t, store,
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "web-restored-1"}},
+	)
+
+	restored, err := bin.Restore(service.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item := restored.(*corev1.Service); item.Name != "web-restored-2" || item.Spec.ClusterIP != "" {
+		t.Errorf("unexpected restored service %+v", item)
+	}
+
+	restored, err = bin.Restore(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item := restored.(*batchv1.Job); item.Name != "backup" || item.Spec.Selector != nil || len(item.Spec.Template.Labels) != 1 {
+		t.Errorf("unexpected restored job %+v", item)
+	}
+
+	if _, err := bin.Restore("foo"); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func addObjects(t *testing.T, store *fakeStore, objects ...runtime.Object) {
+	for _, object := range objects {
+		if _, err := store.create(fakeKind(object), object); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRecycleBinPrune(t *testing.T) {
+	store := newFakeStore()
+	now := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	bin := newTestRecycleBin(store, &now)
+
+	for i := 0; i < 4; i++ {
+		addObjects(t, store, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: fmt.Sprintf("config-%d", i)}})
+		if _, err := bin.DeleteWithSnapshot(ConfigMaps, "demo", fmt.Sprintf("config-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(20 * time.Minute)
+	}
+
+	// config-0 deleted 80 minutes ago is expired, config-1 exceeds the max count
+	if err := bin.prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := bin.ListDeleted("demo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].Name != "config-3" || list[1].Name != "config-2" {
+		t.Errorf("unexpected deleted resources after prune %+v", list)
+	}
+}
+
+func TestRecycleBinUnsupportedKind(t *testing.T) {
+	bin := NewRecycleBin(nil, "kubesphere-system", time.Hour, 1)
+
+	if _, err := bin.DeleteWithSnapshot(Pods, "demo", "foo"); err == nil {
+		t.Error("expected error for unsupported kind")
+	}
+}
@@ -0,0 +1,243 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	sliceutils "kubesphere.io/kubesphere/pkg/utils"
+)
+
+const (
+	ReferenceEnvFrom         = "envFrom"
+	ReferenceEnv             = "env"
+	ReferenceVolume          = "volume"
+	ReferenceImagePullSecret = "imagePullSecret"
+)
+
+type Referrer struct {
+	Kind       string      `json:"kind"`
+	Namespace  string      `json:"namespace"`
+	Name       string      `json:"name"`
+	References []Reference `json:"references"`
+}
+
+type Reference struct {
+	Type string `json:"type"`
+	// container or volume which holds the reference, empty for imagePullSecrets
+	Source string `json:"source,omitempty"`
+	// keys referenced individually, empty means the whole object is referenced
+	Keys []string `json:"keys,omitempty"`
+}
+
+type podTemplateOwner struct {
+	kind      string
+	namespace string
+	name      string
+	template  *corev1.PodTemplateSpec
+}
+
+// Referrers returns workloads whose pod template references the configmap or secret, live pods are not
+// inspected because changes of configmap or secret take effect on the next rollout of the workload.
+func Referrers(kind, namespace, name string) ([]Referrer, error) {
+	if kind != ConfigMaps && kind != Secrets {
+		return nil, kindUnavailable(kind)
+	}
+
+	owners, err := listPodTemplateOwners(namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := make([]Referrer, 0)
+
+	for _, owner := range owners {
+		var references []Reference
+		if kind == ConfigMaps {
+			references = configMapReferences(&owner.template.Spec, name)
+		} else {
+			references = secretReferences(&owner.template.Spec, name)
+		}
+		if len(references) > 0 {
+			referrers = append(referrers, Referrer{Kind: owner.kind, Namespace: owner.namespace, Name: owner.name, References: references})
+		}
+	}
+
+	sort.Slice(referrers, func(i, j int) bool {
+		if referrers[i].Kind != referrers[j].Kind {
+			return referrers[i].Kind < referrers[j].Kind
+		}
+		return referrers[i].Name < referrers[j].Name
+	})
+
+	return referrers, nil
+}
+
+func listPodTemplateOwners(namespace string) ([]podTemplateOwner, error) {
+	owners := make([]podTemplateOwner, 0)
+
+	deployments, err := informers.SharedInformerFactory().Apps().V1().Deployments().Lister().Deployments(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range deployments {
+		owners = append(owners, podTemplateOwner{kind: Deployments, namespace: item.Namespace, name: item.Name, template: &item.Spec.Template})
+	}
+
+	statefulSets, err := informers.SharedInformerFactory().Apps().V1().StatefulSets().Lister().StatefulSets(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range statefulSets {
+		owners = append(owners, podTemplateOwner{kind: StatefulSets, namespace: item.Namespace, name: item.Name, template: &item.Spec.Template})
+	}
+
+	daemonSets, err := informers.SharedInformerFactory().Apps().V1().DaemonSets().Lister().DaemonSets(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range daemonSets {
+		owners = append(owners, podTemplateOwner{kind: DaemonSets, namespace: item.Namespace, name: item.Name, template: &item.Spec.Template})
+	}
+
+	cronJobs, err := informers.SharedInformerFactory().Batch().V1beta1().CronJobs().Lister().CronJobs(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range cronJobs {
+		owners = append(owners, podTemplateOwner{kind: CronJobs, namespace: item.Namespace, name: item.Name, template: &item.Spec.JobTemplate.Spec.Template})
+	}
+
+	return owners, nil
+}
+
+func podContainers(spec *corev1.PodSpec) []corev1.Container {
+	containers := make([]corev1.Container, 0, len(spec.InitContainers)+len(spec.Containers))
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	return containers
+}
+
+func configMapReferences(spec *corev1.PodSpec, name string) []Reference {
+	references := make([]Reference, 0)
+
+	for _, container := range podContainers(spec) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil && envFrom.ConfigMapRef.Name == name {
+				references = append(references, Reference{Type: ReferenceEnvFrom, Source: container.Name})
+			}
+		}
+		keys := make([]string, 0)
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.ConfigMapKeyRef != nil && env.ValueFrom.ConfigMapKeyRef.Name == name {
+				keys = appendKey(keys, env.ValueFrom.ConfigMapKeyRef.Key)
+			}
+		}
+		if len(keys) > 0 {
+			references = append(references, Reference{Type: ReferenceEnv, Source: container.Name, Keys: keys})
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil && volume.ConfigMap.Name == name {
+			references = append(references, Reference{Type: ReferenceVolume, Source: volume.Name, Keys: keyToPathKeys(volume.ConfigMap.Items)})
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil && source.ConfigMap.Name == name {
+					references = append(references, Reference{Type: ReferenceVolume, Source: volume.Name, Keys: keyToPathKeys(source.ConfigMap.Items)})
+				}
+			}
+		}
+	}
+
+	return references
+}
+
+func secretReferences(spec *corev1.PodSpec, name string) []Reference {
+	references := make([]Reference, 0)
+
+	for _, container := range podContainers(spec) {
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil && envFrom.SecretRef.Name == name {
+				references = append(references, Reference{Type: ReferenceEnvFrom, Source: container.Name})
+			}
+		}
+		keys := make([]string, 0)
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil && env.ValueFrom.SecretKeyRef.Name == name {
+				keys = appendKey(keys, env.ValueFrom.SecretKeyRef.Key)
+			}
+		}
+		if len(keys) > 0 {
+			references = append(references, Reference{Type: ReferenceEnv, Source: container.Name, Keys: keys})
+		}
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil && volume.Secret.SecretName == name {
+			references = append(references, Reference{Type: ReferenceVolume, Source: volume.Name, Keys: keyToPathKeys(volume.Secret.Items)})
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == name {
+					references = append(references, Reference{Type: ReferenceVolume, Source: volume.Name, Keys: keyToPathKeys(source.Secret.Items)})
+				}
+			}
+		}
+	}
+
+	for _, imagePullSecret := range spec.ImagePullSecrets {
+		if imagePullSecret.Name == name {
+			references = append(references, Reference{Type: ReferenceImagePullSecret})
+		}
+	}
+
+	return references
+}
+
+func keyToPathKeys(items []corev1.KeyToPath) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = appendKey(keys, item.Key)
+	}
+	return keys
+}
+
+func appendKey(keys []string, key string) []string {
+	if sliceutils.HasString(keys, key) {
+		return keys
+	}
+	return append(keys, key)
+}
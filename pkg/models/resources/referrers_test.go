@@ -0,0 +1,140 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func referrerFixtures() []runtime.Object {
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "env-from"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", EnvFrom: []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}}}},
+			}}},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "env-keys"},
+			Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init", Env: []corev1.EnvVar{
+					{Name: "A", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "a"}}},
+					{Name: "B", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Key: "b"}}},
+					{Name: "C", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "other"}, Key: "c"}}},
+				}}},
+			}}},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "volumes"},
+			Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}}}},
+					{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+						{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "settings"}, Items: []corev1.KeyToPath{{Key: "a", Path: "a.conf"}}}},
+						{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "credentials"}}},
+					}}}},
+				},
+			}}},
+		},
+		&batchv1beta1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "pull-only"},
+			Spec: batchv1beta1.CronJobSpec{JobTemplate: batchv1beta1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+			}}}}},
+		},
+	}
+}
+
+func TestConfigMapReferrers(t *testing.T) {
+	setupInformers(t, referrerFixtures()...)
+
+	referrers, err := Referrers(ConfigMaps, "demo", "settings")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Referrer{
+		{Kind: DaemonSets, Namespace: "demo", Name: "volumes", References: []Reference{
+			{Type: ReferenceVolume, Source: "config"},
+			{Type: ReferenceVolume, Source: "projected", Keys: []string{"a"}},
+		}},
+		{Kind: Deployments, Namespace: "demo", Name: "env-from", References: []Reference{
+			{Type: ReferenceEnvFrom, Source: "app"},
+		}},
+		{Kind: StatefulSets, Namespace: "demo", Name: "env-keys", References: []Reference{
+			{Type: ReferenceEnv, Source: "init", Keys: []string{"a", "b"}},
+		}},
+	}
+
+	if !reflect.DeepEqual(referrers, expected) {
+		t.Errorf("unexpected referrers:\n got %+v\nwant %+v", referrers, expected)
+	}
+}
+
+func TestSecretReferrers(t *testing.T) {
+	setupInformers(t, referrerFixtures()...)
+
+	tests := []struct {
+		secret   string
+		expected []Referrer
+	}{
+		{
+			secret: "registry",
+			expected: []Referrer{{Kind: CronJobs, Namespace: "demo", Name: "pull-only", References: []Reference{
+				{Type: ReferenceImagePullSecret},
+			}}},
+		},
+		{
+			secret: "credentials",
+			expected: []Referrer{{Kind: DaemonSets, Namespace: "demo", Name: "volumes", References: []Reference{
+				{Type: ReferenceVolume, Source: "projected"},
+			}}},
+		},
+		{
+			secret:   "settings",
+			expected: []Referrer{},
+		},
+	}
+
+	for _, test := range tests {
+		referrers, err := Referrers(Secrets, "demo", test.secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(referrers, test.expected) {
+			t.Errorf("secret %s: unexpected referrers:\n got %+v\nwant %+v", test.secret, referrers, test.expected)
+		}
+	}
+}
+
+func TestReferrersUnsupportedKind(t *testing.T) {
+	setupInformers(t)
+
+	if _, err := Referrers(Pods, "demo", "foo"); err == nil {
+		t.Error("expected error for unsupported kind")
+	}
+}
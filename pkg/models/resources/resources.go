@@ -18,10 +18,19 @@
 package resources
 
 import (
+	"context"
 	"fmt"
+	"kubesphere.io/kubesphere/pkg/constants"
 	"kubesphere.io/kubesphere/pkg/models"
 	"kubesphere.io/kubesphere/pkg/params"
 	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/informers"
 )
 
 func init() {
@@ -69,6 +78,14 @@ const (
 	failed                 = "failed"
 	complete               = "complete"
 	app                    = "app"
+	containerName          = "containerName"
+	envVar                 = "envVar"
+	mountsSecret           = "mountsSecret"
+	mountsConfigMap        = "mountsConfigMap"
+	toleratesTaint         = "toleratesTaint"
+	hasNodeSelector        = "hasNodeSelector"
+	hasAffinity            = "hasAffinity"
+	workspace              = "workspace"
 	Deployments            = "deployments"
 	DaemonSets             = "daemonsets"
 	Roles                  = "roles"
@@ -90,70 +107,241 @@ const (
 	S2iRuns                = "s2iruns"
 )
 
+// The searchers declare the keys they sort by, other orderBy values are rejected, the empty
+// orderBy sorts by name. The namespaced searchers compare the items of their results with less,
+// the way search sorts them, to merge the results of several namespaces.
 type namespacedSearcherInterface interface {
-	search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error)
+	search(factory k8sinformers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error)
+	sortKeys() []string
+	less(a, b interface{}, orderBy string) bool
 }
 type clusterSearcherInterface interface {
-	search(conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error)
+	search(factory k8sinformers.SharedInformerFactory, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error)
+	sortKeys() []string
 }
 
-func ListNamespaceResource(namespace, resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int) (*models.PageableResponse, error) {
-	items := make([]interface{}, 0)
-	total := 0
-	var err error
-	var result []interface{}
+// KindScopeError is returned when the namespace argument doesn't fit the scope of the kind,
+// cluster scoped kinds reject a namespace and namespaced kinds require one.
+type KindScopeError struct {
+	Kind       string
+	Namespaced bool
+	Namespace  string
+}
 
-	if searcher, ok := namespacedResources[resource]; ok {
-		result, err = searcher.search(namespace, conditions, orderBy, reverse)
-	} else {
-		return nil, fmt.Errorf("not support")
+func (e *KindScopeError) Error() string {
+	if e.Namespaced {
+		return fmt.Sprintf("%s is namespaced, namespace is required", e.Kind)
+	}
+	return fmt.Sprintf("%s is cluster scoped, namespace %s is not allowed", e.Kind, e.Namespace)
+}
+
+func (e *KindScopeError) Unwrap() error {
+	return ErrInvalidScope
+}
+
+// OrderByError is returned when the searcher of the kind can't sort by the orderBy key
+type OrderByError struct {
+	Kind      string
+	OrderBy   string
+	Supported []string
+}
+
+func (e *OrderByError) Error() string {
+	return fmt.Sprintf("%s can't be ordered by %s, supported keys are %s", e.Kind, e.OrderBy, strings.Join(e.Supported, ", "))
+}
+
+func (e *OrderByError) Unwrap() error {
+	return ErrInvalidOrder
+}
+
+// validateOrderBy rejects the orderBy keys the searcher of kind doesn't sort by
+func validateOrderBy(kind, orderBy string) error {
+	if orderBy == "" {
+		return nil
+	}
+
+	var keys []string
+	if searcher, ok := clusterResources[kind]; ok {
+		keys = searcher.sortKeys()
+	} else if searcher, ok := namespacedResources[kind]; ok {
+		keys = searcher.sortKeys()
+	}
+
+	for _, key := range keys {
+		if key == orderBy {
+			return nil
+		}
+	}
+
+	return &OrderByError{Kind: kind, OrderBy: orderBy, Supported: keys}
+}
+
+// IsNamespaced reports whether the kind is namespace scoped, supported is false if no searcher
+// is registered for the kind.
+func IsNamespaced(kind string) (namespaced bool, supported bool) {
+	if _, ok := namespacedResources[kind]; ok {
+		return true, true
+	}
+	if _, ok := clusterResources[kind]; ok {
+		return false, true
 	}
+	return false, false
+}
+
+// ListNamespaceResource lists the resources of namespace, the items are copies of the cached objects.
+// The resource is any name of the kind accepted by ResolveKind.
+func ListNamespaceResource(ctx context.Context, namespace, resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int) (*models.PageableResponse, error) {
+	return listNamespaceResource(ctx, namespace, resource, conditions, orderBy, reverse, limit, offset, false)
+}
+
+// listNamespaceResource is ListNamespaceResource, the items are the cached objects if unsafeNoCopy
+func listNamespaceResource(ctx context.Context, namespace, resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int, unsafeNoCopy bool) (*models.PageableResponse, error) {
+	resource, err := ResolveKind(resource)
 
 	if err != nil {
 		return nil, err
 	}
 
-	total = len(result)
+	namespaced, _ := IsNamespaced(resource)
 
-	for i, d := range result {
-		if i >= offset && (limit == -1 || len(items) < limit) {
-			items = append(items, d)
-		}
+	if !namespaced {
+		return nil, &KindScopeError{Kind: resource, Namespace: namespace}
+	}
+
+	// list across namespaces must be requested explicitly by ListClusterResource
+	if namespace == "" {
+		return nil, &KindScopeError{Kind: resource, Namespaced: true}
+	}
+
+	result, err := searchResources(ctx, resource, namespace, conditions, orderBy, reverse)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return &models.PageableResponse{TotalCount: total, Items: items}, nil
+	return pageResult(resource, result, limit, offset, unsafeNoCopy), nil
 }
 
-func ListClusterResource(resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int) (*models.PageableResponse, error) {
-	items := make([]interface{}, 0)
-	total := 0
-	var err error
+// ListClusterResource lists cluster scoped resources, namespaced resources are listed across all namespaces.
+// The items are copies of the cached objects. The resource is any name of the kind accepted by ResolveKind.
+func ListClusterResource(ctx context.Context, resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int) (*models.PageableResponse, error) {
+	return listClusterResource(ctx, resource, conditions, orderBy, reverse, limit, offset, false)
+}
+
+// listClusterResource is ListClusterResource, the items are the cached objects if unsafeNoCopy
+func listClusterResource(ctx context.Context, resource string, conditions *params.Conditions, orderBy string, reverse bool, limit, offset int, unsafeNoCopy bool) (*models.PageableResponse, error) {
+	resource, err := ResolveKind(resource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := searchResources(ctx, resource, "", conditions, orderBy, reverse)
 
 	if err != nil {
 		return nil, err
 	}
 
+	return pageResult(resource, result, limit, offset, unsafeNoCopy), nil
+}
+
+// cacheSynced reports whether the informer cache of kind is synced, kinds without informer are
+// searched regardless.
+var cacheSynced = func(factory k8sinformers.SharedInformerFactory, kind string) bool {
+	informer, err := informerIn(factory, kind)
+	return err != nil || informer.HasSynced()
+}
+
+// searchResources dispatches the search to the searcher of kind, namespace must be empty for cluster scoped kinds.
+func searchResources(ctx context.Context, kind, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	return searchIn(ctx, informers.SharedInformerFactory(), kind, namespace, conditions, orderBy, reverse)
+}
+
+// searchIn is searchResources in the caches of factory
+func searchIn(ctx context.Context, factory k8sinformers.SharedInformerFactory, kind, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	// the client is gone, don't bother scanning the cache
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := validateConditions(conditions); err != nil {
+		return nil, err
+	}
+
+	if err := validateOrderBy(kind, orderBy); err != nil {
+		return nil, err
+	}
+
+	if !cacheSynced(factory, kind) {
+		return nil, fmt.Errorf("%w: %s", ErrNotSynced, kind)
+	}
+
+	start := time.Now()
+
 	var result []interface{}
+	var err error
 
-	if searcher, ok := clusterResources[resource]; ok {
-		result, err = searcher.search(conditions, orderBy, reverse)
+	if searcher, ok := clusterResources[kind]; ok {
+		result, err = searcher.search(factory, conditions, orderBy, reverse)
 	} else {
-		return nil, fmt.Errorf("not support")
+		result, err = namespacedResources[kind].search(factory, namespace, conditions, orderBy, reverse)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	total = len(result)
+	// the search has been abandoned, the result is dropped
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	observeSearch(kind, namespace, len(result), time.Since(start))
+
+	return result, nil
+}
+
+// pageResult returns the page of result of kind, the items are deep copies unless unsafeNoCopy. The
+// searchers return the objects of the informer caches, they're shared with every reader and must
+// not be modified, so only callers reading the items without keeping them pass unsafeNoCopy. The
+// large objects of the page and the label scope of the cache of kind are reported with warnings.
+func pageResult(kind string, result []interface{}, limit, offset int, unsafeNoCopy bool) *models.PageableResponse {
+	items := make([]interface{}, 0)
 
 	for i, d := range result {
-		if i >= offset && len(items) < limit {
+		if i >= offset && (limit == -1 || len(items) < limit) {
+			if !unsafeNoCopy {
+				d = deepCopy(d)
+			}
 			items = append(items, d)
 		}
 	}
 
-	return &models.PageableResponse{TotalCount: total, Items: items}, nil
+	page := &models.PageableResponse{TotalCount: len(result), Items: items}
+
+	warnings := largeObjectWarnings(kind, items)
+
+	// the cache is scoped by design, the result is partial but not stale
+	if informers.IsLabelScoped(kind) {
+		warnings = append(warnings, models.SearchWarning{
+			Code:    models.WarningPartialCache,
+			Kind:    kind,
+			Message: fmt.Sprintf("only %s matching %s are cached", kind, informers.LabelSelector()),
+		})
+	}
+
+	if len(warnings) > 0 {
+		page.Warnings = warnings
+	}
+
+	return page
+}
+
+func deepCopy(item interface{}) interface{} {
+	if object, ok := item.(runtime.Object); ok {
+		return object.DeepCopyObject()
+	}
+	return item
 }
 
 func searchFuzzy(m map[string]string, key, value string) bool {
@@ -168,3 +356,44 @@ func searchFuzzy(m map[string]string, key, value string) bool {
 	}
 	return false
 }
+
+// DisplayName returns the alias name of the object, the legacy displayName label
+// is used when the alias-name annotation is not set.
+func DisplayName(item metav1.Object) string {
+	if alias := item.GetAnnotations()[constants.DisplayNameAnnotationKey]; alias != "" {
+		return alias
+	}
+	return item.GetLabels()[displayName]
+}
+
+func Description(item metav1.Object) string {
+	return item.GetAnnotations()[constants.DescriptionAnnotationKey]
+}
+
+// Objects carry both alias-name annotation and legacy displayName label still match by the label,
+// so searches that relied on the label keep working while the annotation takes over.
+func matchName(item metav1.Object, value string) bool {
+	return item.GetName() == value ||
+		item.GetAnnotations()[constants.DisplayNameAnnotationKey] == value ||
+		item.GetLabels()[displayName] == value
+}
+
+func fuzzyMatchName(item metav1.Object, value string) bool {
+	return strings.Contains(item.GetName(), value) ||
+		strings.Contains(item.GetAnnotations()[constants.DisplayNameAnnotationKey], value) ||
+		strings.Contains(item.GetLabels()[displayName], value)
+}
+
+// fuzzyMatchKeyword matches the names, the description, the labels and the annotations of item. The
+// annotation values of large objects aren't scanned, they hold megabytes of last applied configuration.
+func fuzzyMatchKeyword(item metav1.Object, value string) bool {
+	if fuzzyMatchName(item, value) || strings.Contains(Description(item), value) || searchFuzzy(item.GetLabels(), "", value) {
+		return true
+	}
+
+	if isLargeObject(item) {
+		return searchFuzzyKeys(item.GetAnnotations(), value)
+	}
+
+	return searchFuzzy(item.GetAnnotations(), "", value)
+}
@@ -0,0 +1,338 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sinformers "k8s.io/client-go/informers"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// setupInformers replaces the shared informer factory with one whose caches
+// hold exactly the given objects.
+func setupInformers(t testing.TB, objects ...runtime.Object) k8sinformers.SharedInformerFactory {
+	factory := k8sinformers.NewSharedInformerFactory(nil, 0)
+
+	for _, object := range objects {
+		var err error
+		switch obj := object.(type) {
+		case *appsv1.Deployment:
+			err = factory.Apps().V1().Deployments().Informer().GetIndexer().Add(obj)
+		case *appsv1.StatefulSet:
+			err = factory.Apps().V1().StatefulSets().Informer().GetIndexer().Add(obj)
+		case *appsv1.DaemonSet:
+			err = factory.Apps().V1().DaemonSets().Informer().GetIndexer().Add(obj)
+		case *appsv1.ReplicaSet:
+			err = factory.Apps().V1().ReplicaSets().Informer().GetIndexer().Add(obj)
+		case *appsv1.ControllerRevision:
+			err = factory.Apps().V1().ControllerRevisions().Informer().GetIndexer().Add(obj)
+		case *batchv1.Job:
+			err = factory.Batch().V1().Jobs().Informer().GetIndexer().Add(obj)
+		case *batchv1beta1.CronJob:
+			err = factory.Batch().V1beta1().CronJobs().Informer().GetIndexer().Add(obj)
+		case *corev1.Pod:
+			err = factory.Core().V1().Pods().Informer().GetIndexer().Add(obj)
+		case *corev1.Service:
+			err = factory.Core().V1().Services().Informer().GetIndexer().Add(obj)
+		case *corev1.ConfigMap:
+			err = factory.Core().V1().ConfigMaps().Informer().GetIndexer().Add(obj)
+		case *corev1.Secret:
+			err = factory.Core().V1().Secrets().Informer().GetIndexer().Add(obj)
+		case *corev1.PersistentVolumeClaim:
+			err = factory.Core().V1().PersistentVolumeClaims().Informer().GetIndexer().Add(obj)
+		case *corev1.Namespace:
+			err = factory.Core().V1().Namespaces().Informer().GetIndexer().Add(obj)
+		case *corev1.Node:
+			err = factory.Core().V1().Nodes().Informer().GetIndexer().Add(obj)
+		case *corev1.Event:
+			err = factory.Core().V1().Events().Informer().GetIndexer().Add(obj)
+		case *v1beta1.Ingress:
+			err = factory.Extensions().V1beta1().Ingresses().Informer().GetIndexer().Add(obj)
+		case *rbacv1.Role:
+			err = factory.Rbac().V1().Roles().Informer().GetIndexer().Add(obj)
+		case *rbacv1.ClusterRole:
+			err = factory.Rbac().V1().ClusterRoles().Informer().GetIndexer().Add(obj)
+		case *rbacv1.ClusterRoleBinding:
+			err = factory.Rbac().V1().ClusterRoleBindings().Informer().GetIndexer().Add(obj)
+		case *storagev1.StorageClass:
+			err = factory.Storage().V1().StorageClasses().Informer().GetIndexer().Add(obj)
+		default:
+			err = fmt.Errorf("unsupported object %T", object)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	informers.SetSharedInformerFactory(factory)
+
+	// the informers aren't started, their caches are filled above. The tests setting up informers
+	// don't see what the ones before set.
+	cacheSynced = func(k8sinformers.SharedInformerFactory, string) bool { return true }
+
+	return factory
+}
+
+func displayNameFixtures(namespace string) []runtime.Object {
+	annotationOnly := metav1.ObjectMeta{Namespace: namespace, Name: "annotation-only", Annotations: map[string]string{constants.DisplayNameAnnotationKey: "frontend", constants.DescriptionAnnotationKey: "serves the shop"}}
+	labelOnly := metav1.ObjectMeta{Namespace: namespace, Name: "label-only", Labels: map[string]string{displayName: "backend"}}
+	both := metav1.ObjectMeta{Namespace: namespace, Name: "both", Annotations: map[string]string{constants.DisplayNameAnnotationKey: "database"}, Labels: map[string]string{displayName: "legacy-db"}}
+
+	if namespace == "" {
+		return []runtime.Object{&corev1.Namespace{ObjectMeta: annotationOnly}, &corev1.Namespace{ObjectMeta: labelOnly}, &corev1.Namespace{ObjectMeta: both}}
+	}
+
+	return []runtime.Object{
+		&appsv1.Deployment{ObjectMeta: annotationOnly}, &appsv1.Deployment{ObjectMeta: labelOnly}, &appsv1.Deployment{ObjectMeta: both},
+		&corev1.Service{ObjectMeta: annotationOnly}, &corev1.Service{ObjectMeta: labelOnly}, &corev1.Service{ObjectMeta: both},
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	objects := append(displayNameFixtures("demo"), displayNameFixtures("")...)
+	setupInformers(t, objects...)
+
+	tests := []struct {
+		conditions *params.Conditions
+		expected   string
+	}{
+		{conditions: &params.Conditions{Fuzzy: map[string]string{name: "front"}}, expected: "annotation-only"},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{name: "back"}}, expected: "label-only"},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{name: "datab"}}, expected: "both"},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{name: "legacy"}}, expected: "both"},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{keyword: "shop"}}, expected: "annotation-only"},
+		{conditions: &params.Conditions{Fuzzy: map[string]string{keyword: "backend"}}, expected: "label-only"},
+		{conditions: &params.Conditions{Match: map[string]string{name: "frontend"}}, expected: "annotation-only"},
+		{conditions: &params.Conditions{Match: map[string]string{name: "legacy-db"}}, expected: "both"},
+	}
+
+	for _, test := range tests {
+		for _, kind := range []string{Deployments, Services, Namespaces} {
+			// deployment searcher supports status only for exactly match
+			if kind == Deployments && len(test.conditions.Match) > 0 {
+				continue
+			}
+
+			var result *models.PageableResponse
+			var err error
+			if kind == Namespaces {
+				result, err = ListClusterResource(context.Background(), kind, test.conditions, "", false, 10, 0)
+			} else {
+				result, err = ListNamespaceResource(context.Background(), "demo", kind, test.conditions, "", false, -1, 0)
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result.TotalCount != 1 || result.Items[0].(metav1.Object).GetName() != test.expected {
+				t.Errorf("%s with conditions %v: expected %s, got %d items", kind, test.conditions, test.expected, result.TotalCount)
+			}
+		}
+	}
+}
+
+func TestDisplayNameAccessor(t *testing.T) {
+	for _, object := range displayNameFixtures("demo")[:3] {
+		item := object.(metav1.Object)
+		switch item.GetName() {
+		case "annotation-only":
+			if DisplayName(item) != "frontend" || Description(item) != "serves the shop" {
+				t.Errorf("unexpected display name %s and description %s", DisplayName(item), Description(item))
+			}
+		case "label-only":
+			if DisplayName(item) != "backend" {
+				t.Errorf("expected display name from legacy label, got %s", DisplayName(item))
+			}
+		case "both":
+			if DisplayName(item) != "database" {
+				t.Errorf("expected annotation takes precedence, got %s", DisplayName(item))
+			}
+		}
+	}
+}
+
+func TestKindScope(t *testing.T) {
+	setupInformers(t,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod2"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+	)
+
+	conditions := &params.Conditions{}
+
+	// cluster scoped kind with a namespace
+	_, err := ListNamespaceResource(context.Background(), "ns1", Nodes, conditions, "", false, -1, 0)
+	if scopeErr, ok := err.(*KindScopeError); !ok || scopeErr.Namespaced {
+		t.Errorf("expected cluster scoped error, got %v", err)
+	}
+
+	// namespaced kind without a namespace
+	_, err = ListNamespaceResource(context.Background(), "", Pods, conditions, "", false, -1, 0)
+	if scopeErr, ok := err.(*KindScopeError); !ok || !scopeErr.Namespaced {
+		t.Errorf("expected namespace required error, got %v", err)
+	}
+
+	result, err := ListNamespaceResource(context.Background(), "ns1", Pods, conditions, "", false, -1, 0)
+	if err != nil || result.TotalCount != 1 {
+		t.Errorf("expected 1 pod in ns1, got %v, %v", result, err)
+	}
+
+	// cross namespace listing of namespaced kind is explicitly requested via cluster entry
+	result, err = ListClusterResource(context.Background(), Pods, conditions, "", false, -1, 0)
+	if err != nil || result.TotalCount != 2 || len(result.Items) != 2 {
+		t.Errorf("expected 2 pods across namespaces, got %v, %v", result, err)
+	}
+
+	if _, err = ListClusterResource(context.Background(), "foo", conditions, "", false, -1, 0); err == nil {
+		t.Error("expected error for unsupported kind")
+	}
+}
+
+func TestClientWatchUnregisters(t *testing.T) {
+	client := NewClient(setupInformers(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	results, err := client.Watch(ctx, Services, "demo", Query{Limit: -1})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	for range results {
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if len(client.watchers[Services]) != 0 {
+		t.Errorf("expected watcher unregistered, got %d", len(client.watchers[Services]))
+	}
+}
+
+func TestLabelScopedSearch(t *testing.T) {
+	if err := informers.SetLabelSelector("kubesphere.io/workspace=ws1"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer informers.SetLabelSelector("")
+
+	ws1 := map[string]string{"kubesphere.io/workspace": "ws1"}
+
+	// a scoped cache holds the pods of ws1 only, and every namespace
+	setupInformers(t,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ws1-demo", Name: "web", Labels: ws1}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws1-demo", Labels: ws1}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ws2-demo"}},
+	)
+
+	pods, err := ListClusterResource(context.Background(), Pods, &params.Conditions{}, "", false, -1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pods.TotalCount != 1 || len(pods.Warnings) != 1 || pods.Warnings[0].Code != models.WarningPartialCache {
+		t.Errorf("expected the pod of ws1 with a partial cache warning, got %+v", pods)
+	}
+
+	namespaces, err := ListClusterResource(context.Background(), Namespaces, &params.Conditions{}, "", false, -1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespaces.TotalCount != 2 || len(namespaces.Warnings) != 0 {
+		t.Errorf("expected every namespace without warning, got %+v", namespaces)
+	}
+}
+
+func TestOrderByValidation(t *testing.T) {
+	older := metav1.NewTime(time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	newer := metav1.NewTime(older.Add(time.Hour))
+
+	setupInformers(t,
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "a", CreationTimestamp: newer}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "b", CreationTimestamp: older}},
+	)
+
+	names := func(result *models.PageableResponse) []string {
+		names := make([]string, 0)
+		for _, item := range result.Items {
+			names = append(names, item.(*appsv1.Deployment).Name)
+		}
+		return names
+	}
+
+	result, err := ListNamespaceResource(context.Background(), "demo", Deployments, &params.Conditions{}, createTime, false, -1, 0)
+
+	if err != nil || !reflect.DeepEqual(names(result), []string{"b", "a"}) {
+		t.Errorf("expected ordered by creation, got %v %v", result, err)
+	}
+
+	// the default is the name
+	result, err = ListNamespaceResource(context.Background(), "demo", Deployments, &params.Conditions{}, "", false, -1, 0)
+
+	if err != nil || !reflect.DeepEqual(names(result), []string{"a", "b"}) {
+		t.Errorf("expected ordered by name, got %v %v", result, err)
+	}
+
+	_, err = ListNamespaceResource(context.Background(), "demo", Deployments, &params.Conditions{}, updateTime, false, -1, 0)
+
+	var orderErr *OrderByError
+	if !errors.As(err, &orderErr) || orderErr.OrderBy != updateTime || !strings.Contains(err.Error(), "name, createTime, cpuRequests") {
+		t.Errorf("expected updateTime rejected with the supported keys, got %v", err)
+	}
+
+	if status := HTTPStatus(err); status != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %d", status)
+	}
+
+	// jobs are ordered by update time but not by creation time
+	if err := validateOrderBy(Jobs, updateTime); err != nil {
+		t.Error(err)
+	}
+
+	if err := validateOrderBy(Jobs, createTime); !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("expected createTime rejected for jobs, got %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+
+// Package resourcestest provides a resources client searching fixtures with the searchers of the
+// resources API, for the tests of components built on the search.
+package resourcestest
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	k8sinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"kubesphere.io/kubesphere/pkg/models/resources"
+)
+
+// an event not seen by the informer within it is reported as an error
+const eventTimeout = 5 * time.Second
+
+// fixtureTypes are the types cached for the searchers, s2i kinds aren't supported
+var fixtureTypes = []runtime.Object{
+	&appsv1.Deployment{}, &appsv1.StatefulSet{}, &appsv1.DaemonSet{},
+	&batchv1.Job{}, &batchv1beta1.CronJob{},
+	&corev1.Pod{}, &corev1.Service{}, &corev1.ConfigMap{}, &corev1.Secret{}, &corev1.PersistentVolumeClaim{},
+	&corev1.Namespace{}, &corev1.Node{}, &corev1.Event{},
+	&extensionsv1beta1.Ingress{},
+	&rbacv1.Role{}, &rbacv1.ClusterRole{}, &rbacv1.ClusterRoleBinding{},
+	&storagev1.StorageClass{},
+}
+
+// Client is a resources client of informers fed with fixtures instead of the API server. Objects
+// added, updated or deleted reach the informers as watch events, the results of List, Get and Watch
+// are the ones of the resources API.
+type Client struct {
+	*resources.Client
+
+	factory k8sinformers.SharedInformerFactory
+	stop    chan struct{}
+
+	mutex           sync.Mutex
+	sources         map[reflect.Type]*source
+	resourceVersion int
+}
+
+// source lists and watches the fixtures of a type
+type source struct {
+	objects map[string]runtime.Object
+	// created by the list, so that no change is missed before the watch
+	watcher *watch.RaceFreeFakeWatcher
+}
+
+var _ resources.Interface = &Client{}
+
+// NewClient returns a client searching objects, it must be stopped.
+func NewClient(objects ...runtime.Object) (*Client, error) {
+	c := &Client{
+		factory: k8sinformers.NewSharedInformerFactory(nil, 0),
+		stop:    make(chan struct{}),
+		sources: make(map[reflect.Type]*source),
+	}
+
+	for _, object := range fixtureTypes {
+		c.register(object)
+	}
+
+	for _, object := range objects {
+		if err := c.store(object, false); err != nil {
+			return nil, err
+		}
+	}
+
+	c.factory.Start(c.stop)
+
+	// the factory polls the informers one after the other, each poll waits
+	err := wait.PollImmediate(time.Millisecond, eventTimeout, func() (bool, error) {
+		for _, object := range fixtureTypes {
+			if !c.factory.InformerFor(object, nil).HasSynced() {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+
+	if err != nil {
+		c.Stop()
+		return nil, fmt.Errorf("wait for informers synced: %v", err)
+	}
+
+	c.Client = resources.NewClient(c.factory)
+
+	return c, nil
+}
+
+func (c *Client) register(object runtime.Object) {
+	objectType := reflect.TypeOf(object)
+	src := &source{objects: make(map[string]runtime.Object)}
+	c.sources[objectType] = src
+
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+
+			list := &metav1.List{ListMeta: metav1.ListMeta{ResourceVersion: strconv.Itoa(c.resourceVersion)}}
+			for _, item := range src.objects {
+				list.Items = append(list.Items, runtime.RawExtension{Object: item.DeepCopyObject()})
+			}
+
+			if src.watcher != nil {
+				src.watcher.Stop()
+			}
+			src.watcher = watch.NewRaceFreeFake()
+
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+
+			if src.watcher == nil {
+				return nil, fmt.Errorf("watch of %v before its list", objectType)
+			}
+
+			return src.watcher, nil
+		},
+	}
+
+	c.factory.InformerFor(object, func(kubernetes.Interface, time.Duration) cache.SharedIndexInformer {
+		return cache.NewSharedIndexInformer(lw, object, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	})
+}
+
+// store records object with a new resource version and sends the event to the watcher if send
+func (c *Client) store(object runtime.Object, send bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	src, ok := c.sources[reflect.TypeOf(object)]
+
+	if !ok {
+		return fmt.Errorf("unsupported object %T", object)
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(object)
+
+	if err != nil {
+		return err
+	}
+
+	object = object.DeepCopyObject()
+	accessor, err := meta.Accessor(object)
+
+	if err != nil {
+		return err
+	}
+
+	c.resourceVersion++
+	accessor.SetResourceVersion(strconv.Itoa(c.resourceVersion))
+
+	_, exists := src.objects[key]
+	src.objects[key] = object
+
+	if send && src.watcher != nil {
+		if exists {
+			src.watcher.Modify(object.DeepCopyObject())
+		} else {
+			src.watcher.Add(object.DeepCopyObject())
+		}
+	}
+
+	return nil
+}
+
+// Add adds or updates objects, it returns once the informers see them.
+func (c *Client) Add(objects ...runtime.Object) error {
+	for _, object := range objects {
+		if err := c.store(object, true); err != nil {
+			return err
+		}
+		if err := c.waitFor(object, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes objects, it returns once the informers see it.
+func (c *Client) Delete(objects ...runtime.Object) error {
+	for _, object := range objects {
+		key, err := cache.MetaNamespaceKeyFunc(object)
+
+		if err != nil {
+			return err
+		}
+
+		c.mutex.Lock()
+		src, ok := c.sources[reflect.TypeOf(object)]
+		if !ok {
+			c.mutex.Unlock()
+			return fmt.Errorf("unsupported object %T", object)
+		}
+		deleted, exists := src.objects[key]
+		delete(src.objects, key)
+		if exists && src.watcher != nil {
+			src.watcher.Delete(deleted.DeepCopyObject())
+		}
+		c.mutex.Unlock()
+
+		if err := c.waitFor(object, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitFor waits until the informer of object caches its last version, or doesn't cache it
+func (c *Client) waitFor(object runtime.Object, cached bool) error {
+	key, _ := cache.MetaNamespaceKeyFunc(object)
+	informer := c.factory.InformerFor(object, nil)
+
+	c.mutex.Lock()
+	expected := ""
+	if stored, ok := c.sources[reflect.TypeOf(object)].objects[key]; ok {
+		accessor, _ := meta.Accessor(stored)
+		expected = accessor.GetResourceVersion()
+	}
+	c.mutex.Unlock()
+
+	err := wait.PollImmediate(time.Millisecond, eventTimeout, func() (bool, error) {
+		item, exists, err := informer.GetIndexer().GetByKey(key)
+		if err != nil || exists != cached {
+			return false, err
+		}
+		if !cached {
+			return true, nil
+		}
+		accessor, err := meta.Accessor(item)
+		return err == nil && accessor.GetResourceVersion() == expected, err
+	})
+
+	if err != nil {
+		return fmt.Errorf("wait for %T %s: %v", object, key, err)
+	}
+
+	return nil
+}
+
+// Stop stops the informers.
+func (c *Client) Stop() {
+	close(c.stop)
+}
+
+// NamespaceWithPods returns a namespace and n running pods in it, named pod-0 to pod-<n-1>.
+func NamespaceWithPods(namespace string, n int) []runtime.Object {
+	objects := []runtime.Object{&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}}
+
+	for i := 0; i < n; i++ {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: fmt.Sprintf("pod-%d", i), Labels: map[string]string{"app": namespace}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		})
+	}
+
+	return objects
+}
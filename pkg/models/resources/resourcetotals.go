@@ -0,0 +1,166 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// computed fields of workloads, usable as orderBy and in match conditions with
+// the GreaterThan and LessThan suffixes, e.g. cpuRequestsGreaterThan=500m
+const (
+	cpuRequests    = "cpuRequests"
+	cpuLimits      = "cpuLimits"
+	memoryRequests = "memoryRequests"
+	memoryLimits   = "memoryLimits"
+	greaterThan    = "GreaterThan"
+	lessThan       = "LessThan"
+)
+
+// ResourceTotals are the requests and limits of all containers of a pod template times replicas,
+// containers without requests or limits count as zero.
+type ResourceTotals struct {
+	CPURequests    resource.Quantity `json:"cpuRequests"`
+	CPULimits      resource.Quantity `json:"cpuLimits"`
+	MemoryRequests resource.Quantity `json:"memoryRequests"`
+	MemoryLimits   resource.Quantity `json:"memoryLimits"`
+}
+
+// WorkloadResourceTotals returns the resource totals of deployments, statefulsets and daemonsets.
+func WorkloadResourceTotals(item interface{}) (*ResourceTotals, bool) {
+	switch workload := item.(type) {
+	case *appsv1.Deployment:
+		totals := deploymentTotals(workload)
+		return &totals, true
+	case *appsv1.StatefulSet:
+		totals := statefulSetTotals(workload)
+		return &totals, true
+	case *appsv1.DaemonSet:
+		totals := daemonSetTotals(workload)
+		return &totals, true
+	default:
+		return nil, false
+	}
+}
+
+func deploymentTotals(item *appsv1.Deployment) ResourceTotals {
+	return podSpecTotals(&item.Spec.Template.Spec, specReplicas(item.Spec.Replicas))
+}
+
+func statefulSetTotals(item *appsv1.StatefulSet) ResourceTotals {
+	return podSpecTotals(&item.Spec.Template.Spec, specReplicas(item.Spec.Replicas))
+}
+
+// pods of a daemonset run on every scheduled node
+func daemonSetTotals(item *appsv1.DaemonSet) ResourceTotals {
+	return podSpecTotals(&item.Spec.Template.Spec, item.Status.DesiredNumberScheduled)
+}
+
+// specReplicas returns replicas of spec, it defaults to 1 if not specified
+func specReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func podSpecTotals(spec *corev1.PodSpec, replicas int32) ResourceTotals {
+	var totals ResourceTotals
+
+	for _, container := range spec.Containers {
+		addQuantity(&totals.CPURequests, container.Resources.Requests, corev1.ResourceCPU)
+		addQuantity(&totals.CPULimits, container.Resources.Limits, corev1.ResourceCPU)
+		addQuantity(&totals.MemoryRequests, container.Resources.Requests, corev1.ResourceMemory)
+		addQuantity(&totals.MemoryLimits, container.Resources.Limits, corev1.ResourceMemory)
+	}
+
+	if replicas < 0 {
+		replicas = 0
+	}
+
+	// cpu is counted in milli cores, memory in bytes
+	for _, quantity := range []*resource.Quantity{&totals.CPURequests, &totals.CPULimits} {
+		*quantity = *resource.NewMilliQuantity(quantity.MilliValue()*int64(replicas), resource.DecimalSI)
+	}
+	for _, quantity := range []*resource.Quantity{&totals.MemoryRequests, &totals.MemoryLimits} {
+		*quantity = *resource.NewQuantity(quantity.Value()*int64(replicas), resource.BinarySI)
+	}
+
+	return totals
+}
+
+func addQuantity(total *resource.Quantity, list corev1.ResourceList, name corev1.ResourceName) {
+	if quantity, ok := list[name]; ok {
+		total.Add(quantity)
+	}
+}
+
+func (t *ResourceTotals) field(name string) (*resource.Quantity, bool) {
+	switch name {
+	case cpuRequests:
+		return &t.CPURequests, true
+	case cpuLimits:
+		return &t.CPULimits, true
+	case memoryRequests:
+		return &t.MemoryRequests, true
+	case memoryLimits:
+		return &t.MemoryLimits, true
+	default:
+		return nil, false
+	}
+}
+
+// lessResourceTotals compares the computed field orderBy of a and b
+func lessResourceTotals(a, b ResourceTotals, orderBy string) bool {
+	x, _ := a.field(orderBy)
+	y, _ := b.field(orderBy)
+	return x.Cmp(*y) < 0
+}
+
+// matchResourceTotals matches conditions like cpuRequestsGreaterThan=500m, supported is false if key
+// isn't a resource totals condition. Quantities can't be parsed match nothing.
+func matchResourceTotals(totals ResourceTotals, key, value string) (matched bool, supported bool) {
+	var name string
+	var sign int
+
+	if strings.HasSuffix(key, greaterThan) {
+		name, sign = strings.TrimSuffix(key, greaterThan), 1
+	} else if strings.HasSuffix(key, lessThan) {
+		name, sign = strings.TrimSuffix(key, lessThan), -1
+	} else {
+		return false, false
+	}
+
+	field, ok := totals.field(name)
+
+	if !ok {
+		return false, false
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+
+	if err != nil {
+		return false, true
+	}
+
+	return field.Cmp(quantity) == sign, true
+}
@@ -0,0 +1,158 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+func containerResources(requests, limits map[corev1.ResourceName]string) corev1.ResourceRequirements {
+	var r corev1.ResourceRequirements
+	if requests != nil {
+		r.Requests = make(corev1.ResourceList)
+		for k, v := range requests {
+			r.Requests[k] = resource.MustParse(v)
+		}
+	}
+	if limits != nil {
+		r.Limits = make(corev1.ResourceList)
+		for k, v := range limits {
+			r.Limits[k] = resource.MustParse(v)
+		}
+	}
+	return r
+}
+
+func resourceTotalsFixtures() []runtime.Object {
+	two, three := int32(2), int32(3)
+
+	return []runtime.Object{
+		// 2 * (250m + 1) cpu = 2500m, 2 * (512Mi + 1Gi) memory = 3Gi
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "multi-container"},
+			Spec: appsv1.DeploymentSpec{Replicas: &two, Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "app", Resources: containerResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "250m", corev1.ResourceMemory: "512Mi"}, map[corev1.ResourceName]string{corev1.ResourceCPU: "500m"})},
+				{Name: "sidecar", Resources: containerResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "1", corev1.ResourceMemory: "1Gi"}, nil)},
+			}}}},
+		},
+		// replicas defaults to 1, 1500m cpu, 100Mi memory
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "single"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "app", Resources: containerResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "1500m", corev1.ResourceMemory: "100Mi"}, nil)},
+			}}}},
+		},
+		// no requests
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "best-effort"},
+			Spec: appsv1.DeploymentSpec{Replicas: &three, Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "app"},
+			}}}},
+		},
+	}
+}
+
+func TestResourceTotals(t *testing.T) {
+	objects := resourceTotalsFixtures()
+
+	totals, ok := WorkloadResourceTotals(objects[0])
+
+	if !ok {
+		t.Fatal("expected totals of deployment")
+	}
+
+	expected := ResourceTotals{
+		CPURequests:    resource.MustParse("2500m"),
+		CPULimits:      resource.MustParse("1"),
+		MemoryRequests: resource.MustParse("3Gi"),
+	}
+
+	for _, name := range []string{cpuRequests, cpuLimits, memoryRequests, memoryLimits} {
+		got, _ := totals.field(name)
+		want, _ := expected.field(name)
+		if got.Cmp(*want) != 0 {
+			t.Errorf("%s: expected %s, got %s", name, want.String(), got.String())
+		}
+	}
+
+	if _, ok := WorkloadResourceTotals(&corev1.Pod{}); ok {
+		t.Error("expected no totals of pod")
+	}
+}
+
+func TestResourceTotalsSearch(t *testing.T) {
+	setupInformers(t, resourceTotalsFixtures()...)
+
+	tests := []struct {
+		conditions *params.Conditions
+		orderBy    string
+		reverse    bool
+		expected   []string
+	}{
+		{conditions: &params.Conditions{}, orderBy: cpuRequests, expected: []string{"best-effort", "single", "multi-container"}},
+		{conditions: &params.Conditions{}, orderBy: memoryRequests, reverse: true, expected: []string{"multi-container", "single", "best-effort"}},
+		{conditions: &params.Conditions{Match: map[string]string{"cpuRequestsGreaterThan": "1"}}, orderBy: cpuRequests, expected: []string{"single", "multi-container"}},
+		{conditions: &params.Conditions{Match: map[string]string{"memoryRequestsGreaterThan": "1Gi"}}, expected: []string{"multi-container"}},
+		// 0.5Gi is more than 100Mi
+		{conditions: &params.Conditions{Match: map[string]string{"memoryRequestsLessThan": "0.5Gi"}}, expected: []string{"best-effort", "single"}},
+		{conditions: &params.Conditions{Match: map[string]string{"cpuLimitsGreaterThan": "999m"}}, expected: []string{"multi-container"}},
+		{conditions: &params.Conditions{Match: map[string]string{"fooGreaterThan": "1"}}, expected: []string{}},
+	}
+
+	for _, test := range tests {
+		result, err := ListNamespaceResource(context.Background(), "demo", Deployments, test.conditions, test.orderBy, test.reverse, -1, 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := make([]string, 0)
+		for _, item := range result.Items {
+			names = append(names, item.(*appsv1.Deployment).Name)
+		}
+
+		if len(names) != len(test.expected) {
+			t.Errorf("conditions %v order by %s: expected %v, got %v", test.conditions.Match, test.orderBy, test.expected, names)
+			continue
+		}
+
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Errorf("conditions %v order by %s: expected %v, got %v", test.conditions.Match, test.orderBy, test.expected, names)
+				break
+			}
+		}
+	}
+
+	// a value which isn't a quantity can't match anything
+	_, err := ListNamespaceResource(context.Background(), "demo", Deployments, &params.Conditions{Match: map[string]string{"cpuRequestsGreaterThan": "invalid"}}, "", false, -1, 0)
+
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected %v, got %v", ErrInvalidCondition, err)
+	}
+}
@@ -19,6 +19,7 @@ package resources
 
 import (
 	"github.com/kubesphere/s2ioperator/pkg/apis/devops/v1alpha1"
+	k8sinformers "k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
@@ -35,7 +36,7 @@ func (*s2iBuilderTemplateSearcher) match(match map[string]string, item *v1alpha1
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		default:
@@ -50,7 +51,7 @@ func (*s2iBuilderTemplateSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -63,7 +64,7 @@ func (*s2iBuilderTemplateSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1
 			}
 			return false
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -75,6 +76,10 @@ func (*s2iBuilderTemplateSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1
 	return true
 }
 
+func (*s2iBuilderTemplateSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*s2iBuilderTemplateSearcher) compare(a, b *v1alpha1.S2iBuilderTemplate, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -86,7 +91,7 @@ func (*s2iBuilderTemplateSearcher) compare(a, b *v1alpha1.S2iBuilderTemplate, or
 	}
 }
 
-func (s *s2iBuilderTemplateSearcher) search(conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+func (s *s2iBuilderTemplateSearcher) search(_ k8sinformers.SharedInformerFactory, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
 	builderTemplates, err := informers.S2iSharedInformerFactory().Devops().V1alpha1().S2iBuilderTemplates().Lister().List(labels.Everything())
 
 	if err != nil {
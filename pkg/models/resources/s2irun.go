@@ -22,6 +22,7 @@ import (
 	"sort"
 	"strings"
 
+	k8sinformers "k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 
@@ -38,7 +39,7 @@ func (*s2iRunSearcher) match(match map[string]string, item *v1alpha1.S2iRun) boo
 	for k, v := range match {
 		switch k {
 		case name:
-			if item.Name != v && item.Labels[displayName] != v {
+			if !matchName(item, v) {
 				return false
 			}
 		case status:
@@ -57,7 +58,7 @@ func (*s2iRunSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1.S2iRun) boo
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -74,7 +75,7 @@ func (*s2iRunSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1.S2iRun) boo
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -86,6 +87,10 @@ func (*s2iRunSearcher) fuzzy(fuzzy map[string]string, item *v1alpha1.S2iRun) boo
 	return true
 }
 
+func (*s2iRunSearcher) sortKeys() []string {
+	return []string{name, createTime}
+}
+
 func (*s2iRunSearcher) compare(a, b *v1alpha1.S2iRun, orderBy string) bool {
 	switch orderBy {
 	case createTime:
@@ -97,7 +102,11 @@ func (*s2iRunSearcher) compare(a, b *v1alpha1.S2iRun, orderBy string) bool {
 	}
 }
 
-func (s *s2iRunSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+func (s *s2iRunSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1alpha1.S2iRun), b.(*v1alpha1.S2iRun), orderBy)
+}
+
+func (s *s2iRunSearcher) search(_ k8sinformers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
 	s2iRuns, err := informers.S2iSharedInformerFactory().Devops().V1alpha1().S2iRuns().Lister().S2iRuns(namespace).List(labels.Everything())
 
 	if err != nil {
@@ -0,0 +1,82 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"strconv"
+
+	"k8s.io/api/core/v1"
+)
+
+// matchScheduling matches the scheduling conditions toleratesTaint, hasNodeSelector and hasAffinity
+// against a pod spec, the one of the pod template of workloads. Values which aren't booleans match
+// nothing.
+func matchScheduling(spec *v1.PodSpec, key, value string) bool {
+	switch key {
+	case toleratesTaint:
+		return toleratesTaintKey(spec.Tolerations, value)
+	case hasNodeSelector:
+		expected, err := strconv.ParseBool(value)
+		return err == nil && (len(spec.NodeSelector) > 0) == expected
+	case hasAffinity:
+		expected, err := strconv.ParseBool(value)
+		return err == nil && definesAffinity(spec.Affinity) == expected
+	default:
+		return false
+	}
+}
+
+// toleratesTaintKey reports whether a toleration matches taints of key whatever their value and
+// effect, a toleration of operator Exists without key tolerates every taint.
+func toleratesTaintKey(tolerations []v1.Toleration, key string) bool {
+	for _, toleration := range tolerations {
+		if toleration.Key == key || (toleration.Key == "" && toleration.Operator == v1.TolerationOpExists) {
+			return true
+		}
+	}
+	return false
+}
+
+// definesAffinity reports whether affinity has a term of node affinity, pod affinity or pod
+// anti-affinity, an empty affinity constrains nothing.
+func definesAffinity(affinity *v1.Affinity) bool {
+	if affinity == nil {
+		return false
+	}
+
+	if node := affinity.NodeAffinity; node != nil {
+		if len(node.PreferredDuringSchedulingIgnoredDuringExecution) > 0 ||
+			(node.RequiredDuringSchedulingIgnoredDuringExecution != nil && len(node.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) > 0) {
+			return true
+		}
+	}
+
+	if pod := affinity.PodAffinity; pod != nil {
+		if len(pod.RequiredDuringSchedulingIgnoredDuringExecution) > 0 || len(pod.PreferredDuringSchedulingIgnoredDuringExecution) > 0 {
+			return true
+		}
+	}
+
+	if anti := affinity.PodAntiAffinity; anti != nil {
+		if len(anti.RequiredDuringSchedulingIgnoredDuringExecution) > 0 || len(anti.PreferredDuringSchedulingIgnoredDuringExecution) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// schedulingSpecs are pod specs by name, the pods, deployments and cronjobs of the fixtures have them
+func schedulingSpecs() map[string]corev1.PodSpec {
+	return map[string]corev1.PodSpec{
+		"master": {Tolerations: []corev1.Toleration{{Key: "node-role.kubernetes.io/master", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}},
+		// tolerates every taint
+		"everywhere": {Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}}},
+		"gpu": {
+			Tolerations:  []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpEqual, Value: "present"}},
+			NodeSelector: map[string]string{"accelerator": "gpu"},
+		},
+		// present but empty, they constrain nothing
+		"empty": {NodeSelector: map[string]string{}, Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}}},
+		"spread": {Affinity: &corev1.Affinity{PodAntiAffinity: &corev1.PodAntiAffinity{PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+			{Weight: 100, PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"}},
+		}}}},
+		"zoned": {Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+			{MatchExpressions: []corev1.NodeSelectorRequirement{{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}}},
+		}}}}},
+	}
+}
+
+func schedulingFixtures() []runtime.Object {
+	var objects []runtime.Object
+
+	for name, spec := range schedulingSpecs() {
+		meta := metav1.ObjectMeta{Namespace: "demo", Name: name}
+		template := corev1.PodTemplateSpec{Spec: spec}
+		objects = append(objects,
+			&corev1.Pod{ObjectMeta: meta, Spec: spec},
+			&appsv1.Deployment{ObjectMeta: meta, Spec: appsv1.DeploymentSpec{Template: template}},
+			&v1beta1.CronJob{ObjectMeta: meta, Spec: v1beta1.CronJobSpec{JobTemplate: v1beta1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}}}},
+		)
+	}
+
+	return objects
+}
+
+func TestSchedulingConditions(t *testing.T) {
+	setupInformers(t, schedulingFixtures()...)
+
+	tests := []struct {
+		match    map[string]string
+		expected []string
+	}{
+		{match: map[string]string{toleratesTaint: "node-role.kubernetes.io/master"}, expected: []string{"everywhere", "master"}},
+		{match: map[string]string{toleratesTaint: "nvidia.com/gpu"}, expected: []string{"everywhere", "gpu"}},
+		{match: map[string]string{toleratesTaint: "node.kubernetes.io/unreachable"}, expected: []string{"everywhere"}},
+		{match: map[string]string{hasNodeSelector: "true"}, expected: []string{"gpu"}},
+		{match: map[string]string{hasNodeSelector: "false"}, expected: []string{"empty", "everywhere", "master", "spread", "zoned"}},
+		{match: map[string]string{hasAffinity: "true"}, expected: []string{"spread", "zoned"}},
+		{match: map[string]string{hasNodeSelector: "false", hasAffinity: "false"}, expected: []string{"empty", "everywhere", "master"}},
+	}
+
+	for _, kind := range []string{Pods, Deployments, CronJobs} {
+		for _, test := range tests {
+			result, err := ListNamespaceResource(context.Background(), "demo", kind, &params.Conditions{Match: test.match}, name, false, -1, 0)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, 0)
+			for _, item := range result.Items {
+				names = append(names, item.(metav1.Object).GetName())
+			}
+			sort.Strings(names)
+
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("%s %v: expected %v, got %v", kind, test.match, test.expected, names)
+			}
+		}
+	}
+
+	_, err := ListNamespaceResource(context.Background(), "demo", Deployments, &params.Conditions{Match: map[string]string{hasAffinity: "yes"}}, name, false, -1, 0)
+
+	if !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("expected a value which isn't a boolean invalid, got %v", err)
+	}
+}
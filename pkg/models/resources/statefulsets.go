@@ -18,7 +18,7 @@
 package resources
 
 import (
-	"kubesphere.io/kubesphere/pkg/informers"
+	"k8s.io/client-go/informers"
 	"kubesphere.io/kubesphere/pkg/params"
 	"sort"
 	"strings"
@@ -31,16 +31,20 @@ type statefulSetSearcher struct {
 }
 
 func statefulSetStatus(item *v1.StatefulSet) string {
-	if item.Spec.Replicas != nil {
-		if item.Status.ReadyReplicas == 0 && *item.Spec.Replicas == 0 {
-			return stopped
-		} else if item.Status.ReadyReplicas == *item.Spec.Replicas {
-			return running
-		} else {
-			return updating
-		}
+	// status hasn't been populated by the controller yet
+	if item.Status.ObservedGeneration == 0 {
+		return updating
+	}
+
+	replicas := specReplicas(item.Spec.Replicas)
+
+	if item.Status.ReadyReplicas == 0 && replicas == 0 {
+		return stopped
+	} else if item.Status.ReadyReplicas == replicas {
+		return running
+	} else {
+		return updating
 	}
-	return stopped
 }
 
 // Exactly Match
@@ -51,8 +55,14 @@ func (*statefulSetSearcher) match(match map[string]string, item *v1.StatefulSet)
 			if statefulSetStatus(item) != v {
 				return false
 			}
+		case toleratesTaint, hasNodeSelector, hasAffinity:
+			if !matchScheduling(&item.Spec.Template.Spec, k, v) {
+				return false
+			}
 		default:
-			return false
+			if matched, supported := matchResourceTotals(statefulSetTotals(item), k, v); !supported || !matched {
+				return false
+			}
 		}
 	}
 	return true
@@ -63,7 +73,7 @@ func (*statefulSetSearcher) fuzzy(fuzzy map[string]string, item *v1.StatefulSet)
 	for k, v := range fuzzy {
 		switch k {
 		case name:
-			if !strings.Contains(item.Name, v) && !strings.Contains(item.Labels[displayName], v) {
+			if !fuzzyMatchName(item, v) {
 				return false
 			}
 		case label:
@@ -80,7 +90,7 @@ func (*statefulSetSearcher) fuzzy(fuzzy map[string]string, item *v1.StatefulSet)
 				return false
 			}
 		case keyword:
-			if !strings.Contains(item.Name, v) && !searchFuzzy(item.Labels, "", v) && !searchFuzzy(item.Annotations, "", v) {
+			if !fuzzyMatchKeyword(item, v) {
 				return false
 			}
 		default:
@@ -93,8 +103,14 @@ func (*statefulSetSearcher) fuzzy(fuzzy map[string]string, item *v1.StatefulSet)
 	return true
 }
 
+func (*statefulSetSearcher) sortKeys() []string {
+	return []string{name, createTime, cpuRequests, cpuLimits, memoryRequests, memoryLimits}
+}
+
 func (*statefulSetSearcher) compare(a, b *v1.StatefulSet, orderBy string) bool {
 	switch orderBy {
+	case cpuRequests, cpuLimits, memoryRequests, memoryLimits:
+		return lessResourceTotals(statefulSetTotals(a), statefulSetTotals(b), orderBy)
 	case createTime:
 		return a.CreationTimestamp.Time.Before(b.CreationTimestamp.Time)
 	case name:
@@ -104,8 +120,12 @@ func (*statefulSetSearcher) compare(a, b *v1.StatefulSet, orderBy string) bool {
 	}
 }
 
-func (s *statefulSetSearcher) search(namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
-	statefulSets, err := informers.SharedInformerFactory().Apps().V1().StatefulSets().Lister().StatefulSets(namespace).List(labels.Everything())
+func (s *statefulSetSearcher) less(a, b interface{}, orderBy string) bool {
+	return s.compare(a.(*v1.StatefulSet), b.(*v1.StatefulSet), orderBy)
+}
+
+func (s *statefulSetSearcher) search(factory informers.SharedInformerFactory, namespace string, conditions *params.Conditions, orderBy string, reverse bool) ([]interface{}, error) {
+	statefulSets, err := factory.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).List(labels.Everything())
 
 	if err != nil {
 		return nil, err
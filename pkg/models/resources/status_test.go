@@ -0,0 +1,362 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"testing"
+
+	"github.com/google/gofuzz"
+	"github.com/kubesphere/s2ioperator/pkg/apis/devops/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	fuzzConditionKeys = []string{name, label, annotation, keyword, status, app, chart, release, displayName, cpuRequests + greaterThan, memoryLimits + lessThan, containerName, envVar, mountsSecret, mountsConfigMap, toleratesTaint, hasNodeSelector, hasAffinity, "foo"}
+	fuzzOrderBy       = []string{name, createTime, updateTime, lastScheduleTime, cpuRequests, memoryLimits, "foo"}
+)
+
+// fuzzTarget exercises the match, fuzzy, compare and status functions of a searcher
+type fuzzTarget struct {
+	kind     string
+	object   func() interface{}
+	match    func(conditions map[string]string, item interface{})
+	fuzzy    func(conditions map[string]string, item interface{})
+	compare  func(a, b interface{}, orderBy string)
+	status   func(item interface{}) string
+	statuses []string
+}
+
+func fuzzTargets() []fuzzTarget {
+	return []fuzzTarget{
+		{
+			kind:   Deployments,
+			object: func() interface{} { return &appsv1.Deployment{} },
+			match:  func(c map[string]string, i interface{}) { (&deploymentSearcher{}).match(c, i.(*appsv1.Deployment)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&deploymentSearcher{}).fuzzy(c, i.(*appsv1.Deployment)) },
+			compare: func(a, b interface{}, o string) {
+				(&deploymentSearcher{}).compare(a.(*appsv1.Deployment), b.(*appsv1.Deployment), o)
+			},
+			status:   func(i interface{}) string { return deploymentStatus(i.(*appsv1.Deployment)) },
+			statuses: []string{running, updating, stopped},
+		},
+		{
+			kind:   StatefulSets,
+			object: func() interface{} { return &appsv1.StatefulSet{} },
+			match:  func(c map[string]string, i interface{}) { (&statefulSetSearcher{}).match(c, i.(*appsv1.StatefulSet)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&statefulSetSearcher{}).fuzzy(c, i.(*appsv1.StatefulSet)) },
+			compare: func(a, b interface{}, o string) {
+				(&statefulSetSearcher{}).compare(a.(*appsv1.StatefulSet), b.(*appsv1.StatefulSet), o)
+			},
+			status:   func(i interface{}) string { return statefulSetStatus(i.(*appsv1.StatefulSet)) },
+			statuses: []string{running, updating, stopped},
+		},
+		{
+			kind:   DaemonSets,
+			object: func() interface{} { return &appsv1.DaemonSet{} },
+			match:  func(c map[string]string, i interface{}) { (&daemonSetSearcher{}).match(c, i.(*appsv1.DaemonSet)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&daemonSetSearcher{}).fuzzy(c, i.(*appsv1.DaemonSet)) },
+			compare: func(a, b interface{}, o string) {
+				(&daemonSetSearcher{}).compare(a.(*appsv1.DaemonSet), b.(*appsv1.DaemonSet), o)
+			},
+			status:   func(i interface{}) string { return daemonSetStatus(i.(*appsv1.DaemonSet)) },
+			statuses: []string{running, updating, stopped},
+		},
+		{
+			kind:     Jobs,
+			object:   func() interface{} { return &batchv1.Job{} },
+			match:    func(c map[string]string, i interface{}) { (&jobSearcher{}).match(c, i.(*batchv1.Job)) },
+			fuzzy:    func(c map[string]string, i interface{}) { (&jobSearcher{}).fuzzy(c, i.(*batchv1.Job)) },
+			compare:  func(a, b interface{}, o string) { (&jobSearcher{}).compare(a.(*batchv1.Job), b.(*batchv1.Job), o) },
+			status:   func(i interface{}) string { return jobStatus(i.(*batchv1.Job)) },
+			statuses: []string{running, updating, failed, complete},
+		},
+		{
+			kind:   CronJobs,
+			object: func() interface{} { return &batchv1beta1.CronJob{} },
+			match:  func(c map[string]string, i interface{}) { (&cronJobSearcher{}).match(c, i.(*batchv1beta1.CronJob)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&cronJobSearcher{}).fuzzy(c, i.(*batchv1beta1.CronJob)) },
+			compare: func(a, b interface{}, o string) {
+				(&cronJobSearcher{}).compare(a.(*batchv1beta1.CronJob), b.(*batchv1beta1.CronJob), o)
+			},
+			status:   func(i interface{}) string { return cronJobStatus(i.(*batchv1beta1.CronJob)) },
+			statuses: []string{running, paused},
+		},
+		{
+			kind:    Pods,
+			object:  func() interface{} { return &corev1.Pod{} },
+			match:   func(c map[string]string, i interface{}) { (&podSearcher{}).match(c, i.(*corev1.Pod)) },
+			fuzzy:   func(c map[string]string, i interface{}) { (&podSearcher{}).fuzzy(c, i.(*corev1.Pod)) },
+			compare: func(a, b interface{}, o string) { (&podSearcher{}).compare(a.(*corev1.Pod), b.(*corev1.Pod), o) },
+		},
+		{
+			kind:   Services,
+			object: func() interface{} { return &corev1.Service{} },
+			match:  func(c map[string]string, i interface{}) { (&serviceSearcher{}).match(c, i.(*corev1.Service)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&serviceSearcher{}).fuzzy(c, i.(*corev1.Service)) },
+			compare: func(a, b interface{}, o string) {
+				(&serviceSearcher{}).compare(a.(*corev1.Service), b.(*corev1.Service), o)
+			},
+		},
+		{
+			kind:   ConfigMaps,
+			object: func() interface{} { return &corev1.ConfigMap{} },
+			match:  func(c map[string]string, i interface{}) { (&configMapSearcher{}).match(c, i.(*corev1.ConfigMap)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&configMapSearcher{}).fuzzy(c, i.(*corev1.ConfigMap)) },
+			compare: func(a, b interface{}, o string) {
+				(&configMapSearcher{}).compare(a.(*corev1.ConfigMap), b.(*corev1.ConfigMap), o)
+			},
+		},
+		{
+			kind:   Secrets,
+			object: func() interface{} { return &corev1.Secret{} },
+			match:  func(c map[string]string, i interface{}) { (&secretSearcher{}).match(c, i.(*corev1.Secret)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&secretSearcher{}).fuzzy(c, i.(*corev1.Secret)) },
+			compare: func(a, b interface{}, o string) {
+				(&secretSearcher{}).compare(a.(*corev1.Secret), b.(*corev1.Secret), o)
+			},
+		},
+		{
+			kind:   PersistentVolumeClaims,
+			object: func() interface{} { return &corev1.PersistentVolumeClaim{} },
+			match: func(c map[string]string, i interface{}) {
+				(&persistentVolumeClaimSearcher{}).match(c, i.(*corev1.PersistentVolumeClaim))
+			},
+			fuzzy: func(c map[string]string, i interface{}) {
+				(&persistentVolumeClaimSearcher{}).fuzzy(c, i.(*corev1.PersistentVolumeClaim))
+			},
+			compare: func(a, b interface{}, o string) {
+				(&persistentVolumeClaimSearcher{}).compare(a.(*corev1.PersistentVolumeClaim), b.(*corev1.PersistentVolumeClaim), o)
+			},
+		},
+		{
+			kind:   Ingresses,
+			object: func() interface{} { return &v1beta1.Ingress{} },
+			match:  func(c map[string]string, i interface{}) { (&ingressSearcher{}).match(c, i.(*v1beta1.Ingress)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&ingressSearcher{}).fuzzy(c, i.(*v1beta1.Ingress)) },
+			compare: func(a, b interface{}, o string) {
+				(&ingressSearcher{}).compare(a.(*v1beta1.Ingress), b.(*v1beta1.Ingress), o)
+			},
+		},
+		{
+			kind:    Roles,
+			object:  func() interface{} { return &rbacv1.Role{} },
+			match:   func(c map[string]string, i interface{}) { (&roleSearcher{}).match(c, i.(*rbacv1.Role)) },
+			fuzzy:   func(c map[string]string, i interface{}) { (&roleSearcher{}).fuzzy(c, i.(*rbacv1.Role)) },
+			compare: func(a, b interface{}, o string) { (&roleSearcher{}).compare(a.(*rbacv1.Role), b.(*rbacv1.Role), o) },
+		},
+		{
+			kind:   ClusterRoles,
+			object: func() interface{} { return &rbacv1.ClusterRole{} },
+			match:  func(c map[string]string, i interface{}) { (&clusterRoleSearcher{}).match(c, i.(*rbacv1.ClusterRole)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&clusterRoleSearcher{}).fuzzy(c, i.(*rbacv1.ClusterRole)) },
+			compare: func(a, b interface{}, o string) {
+				(&clusterRoleSearcher{}).compare(a.(*rbacv1.ClusterRole), b.(*rbacv1.ClusterRole), o)
+			},
+		},
+		{
+			kind:    Nodes,
+			object:  func() interface{} { return &corev1.Node{} },
+			match:   func(c map[string]string, i interface{}) { (&nodeSearcher{}).match(c, i.(*corev1.Node)) },
+			fuzzy:   func(c map[string]string, i interface{}) { (&nodeSearcher{}).fuzzy(c, i.(*corev1.Node)) },
+			compare: func(a, b interface{}, o string) { (&nodeSearcher{}).compare(a.(*corev1.Node), b.(*corev1.Node), o) },
+		},
+		{
+			kind:   Namespaces,
+			object: func() interface{} { return &corev1.Namespace{} },
+			match:  func(c map[string]string, i interface{}) { (&namespaceSearcher{}).match(c, i.(*corev1.Namespace)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&namespaceSearcher{}).fuzzy(c, i.(*corev1.Namespace)) },
+			compare: func(a, b interface{}, o string) {
+				(&namespaceSearcher{}).compare(a.(*corev1.Namespace), b.(*corev1.Namespace), o)
+			},
+		},
+		{
+			kind:   StorageClasses,
+			object: func() interface{} { return &storagev1.StorageClass{} },
+			match: func(c map[string]string, i interface{}) {
+				(&storageClassesSearcher{}).match(c, i.(*storagev1.StorageClass))
+			},
+			fuzzy: func(c map[string]string, i interface{}) {
+				(&storageClassesSearcher{}).fuzzy(c, i.(*storagev1.StorageClass))
+			},
+			compare: func(a, b interface{}, o string) {
+				(&storageClassesSearcher{}).compare(a.(*storagev1.StorageClass), b.(*storagev1.StorageClass), o)
+			},
+		},
+		{
+			kind:   S2iBuilders,
+			object: func() interface{} { return &v1alpha1.S2iBuilder{} },
+			match:  func(c map[string]string, i interface{}) { (&s2iBuilderSearcher{}).match(c, i.(*v1alpha1.S2iBuilder)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&s2iBuilderSearcher{}).fuzzy(c, i.(*v1alpha1.S2iBuilder)) },
+			compare: func(a, b interface{}, o string) {
+				(&s2iBuilderSearcher{}).compare(a.(*v1alpha1.S2iBuilder), b.(*v1alpha1.S2iBuilder), o)
+			},
+		},
+		{
+			kind:   S2iRuns,
+			object: func() interface{} { return &v1alpha1.S2iRun{} },
+			match:  func(c map[string]string, i interface{}) { (&s2iRunSearcher{}).match(c, i.(*v1alpha1.S2iRun)) },
+			fuzzy:  func(c map[string]string, i interface{}) { (&s2iRunSearcher{}).fuzzy(c, i.(*v1alpha1.S2iRun)) },
+			compare: func(a, b interface{}, o string) {
+				(&s2iRunSearcher{}).compare(a.(*v1alpha1.S2iRun), b.(*v1alpha1.S2iRun), o)
+			},
+		},
+		{
+			kind:   S2iBuilderTemplates,
+			object: func() interface{} { return &v1alpha1.S2iBuilderTemplate{} },
+			match: func(c map[string]string, i interface{}) {
+				(&s2iBuilderTemplateSearcher{}).match(c, i.(*v1alpha1.S2iBuilderTemplate))
+			},
+			fuzzy: func(c map[string]string, i interface{}) {
+				(&s2iBuilderTemplateSearcher{}).fuzzy(c, i.(*v1alpha1.S2iBuilderTemplate))
+			},
+			compare: func(a, b interface{}, o string) {
+				(&s2iBuilderTemplateSearcher{}).compare(a.(*v1alpha1.S2iBuilderTemplate), b.(*v1alpha1.S2iBuilderTemplate), o)
+			},
+		},
+	}
+}
+
+// newZeroingFuzzer generates objects whose fields are randomly left zero valued or nil,
+// small numbers make equal replica counts likely.
+func newZeroingFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.NewWithSeed(seed).NilChance(0.5).NumElements(0, 2).MaxDepth(8).Funcs(
+		func(i *int32, c fuzz.Continue) {
+			if c.RandBool() {
+				*i = c.Int31n(3)
+			}
+		},
+		func(i *int64, c fuzz.Continue) {
+			if c.RandBool() {
+				*i = c.Int63n(3)
+			}
+		},
+		func(s *string, c fuzz.Continue) {
+			if c.RandBool() {
+				*s = c.RandString()
+			}
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			if c.RandBool() {
+				c.FuzzNoCustom(t)
+			}
+		},
+	)
+}
+
+func TestSearcherFuzz(t *testing.T) {
+	fuzzer := newZeroingFuzzer(1)
+
+	for _, target := range fuzzTargets() {
+		for i := 0; i < 200; i++ {
+			a, b := target.object(), target.object()
+			fuzzer.Fuzz(a)
+			fuzzer.Fuzz(b)
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						t.Fatalf("%s: panic on %+v: %v", target.kind, a, r)
+					}
+				}()
+
+				for _, key := range fuzzConditionKeys {
+					for _, value := range []string{"", "a", "a=b", running, "1Gi"} {
+						target.match(map[string]string{key: value}, a)
+						target.fuzzy(map[string]string{key: value}, a)
+					}
+				}
+
+				for _, orderBy := range fuzzOrderBy {
+					target.compare(a, b, orderBy)
+				}
+
+				if target.status != nil {
+					s := target.status(a)
+					valid := false
+					for _, expected := range target.statuses {
+						valid = valid || s == expected
+					}
+					if !valid {
+						t.Errorf("%s: unexpected status %q", target.kind, s)
+					}
+				}
+			}()
+		}
+	}
+}
+
+func TestZeroValuedStatus(t *testing.T) {
+	for _, target := range fuzzTargets() {
+		if target.status == nil || target.kind == CronJobs {
+			continue
+		}
+		if s := target.status(target.object()); s != updating {
+			t.Errorf("%s: expected %s for zero valued status, got %s", target.kind, updating, s)
+		}
+	}
+}
+
+func TestWorkloadStatus(t *testing.T) {
+	zero, one := int32(0), int32(1)
+
+	tests := []struct {
+		item     interface{}
+		expected string
+	}{
+		// replicas defaults to 1
+		{item: &appsv1.Deployment{Status: appsv1.DeploymentStatus{ObservedGeneration: 1, ReadyReplicas: 1}}, expected: running},
+		{item: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &zero}, Status: appsv1.DeploymentStatus{ObservedGeneration: 1}}, expected: stopped},
+		{item: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &one}, Status: appsv1.DeploymentStatus{ObservedGeneration: 1}}, expected: updating},
+		{item: &appsv1.StatefulSet{Status: appsv1.StatefulSetStatus{ObservedGeneration: 1}}, expected: updating},
+		{item: &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{Replicas: &zero}, Status: appsv1.StatefulSetStatus{ObservedGeneration: 1}}, expected: stopped},
+		{item: &appsv1.DaemonSet{Status: appsv1.DaemonSetStatus{ObservedGeneration: 1}}, expected: stopped},
+		{item: &appsv1.DaemonSet{Status: appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 2}}, expected: updating},
+		{item: &appsv1.DaemonSet{Status: appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 2, NumberAvailable: 2}}, expected: running},
+		{item: &batchv1.Job{Status: batchv1.JobStatus{StartTime: &metav1.Time{}}}, expected: running},
+		{item: &batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}}}, expected: complete},
+	}
+
+	targets := make(map[string]fuzzTarget)
+	for _, target := range fuzzTargets() {
+		targets[target.kind] = target
+	}
+
+	for _, test := range tests {
+		var kind string
+		switch test.item.(type) {
+		case *appsv1.Deployment:
+			kind = Deployments
+		case *appsv1.StatefulSet:
+			kind = StatefulSets
+		case *appsv1.DaemonSet:
+			kind = DaemonSets
+		case *batchv1.Job:
+			kind = Jobs
+		}
+		if s := targets[kind].status(test.item); s != test.expected {
+			t.Errorf("%s %+v: expected %s, got %s", kind, test.item, test.expected, s)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+)
+
+// kinds of TimeBuckets
+const (
+	WarningEvents     = "events"
+	ContainerRestarts = "restarts"
+)
+
+const maxTimeBuckets = 1000
+
+// timeBucketsNow is the clock of TimeBuckets, tests replace it
+var timeBucketsNow = time.Now
+
+type TimeBucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// BucketedCounts are the counts of occurrences in consecutive buckets from Start to End. Start is
+// later than the start of the requested window if the caches don't retain occurrences so old.
+type BucketedCounts struct {
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	Buckets   []TimeBucket `json:"buckets"`
+	Total     int          `json:"total"`
+}
+
+// TimeBuckets counts the warning events or the container restarts of namespace within the window
+// ending now, in buckets of bucketSize.
+//
+// An event is counted once at its last occurrence. The API server drops events after their TTL, so
+// the counts start after the bucket of the oldest cached event. A pod only tells the last
+// termination of a container, so the counts start after the bucket of the last restart of the
+// containers which restarted several times.
+func TimeBuckets(namespace, kind string, window, bucketSize time.Duration) (*BucketedCounts, error) {
+	if window <= 0 || bucketSize <= 0 || window/bucketSize > maxTimeBuckets {
+		return nil, fmt.Errorf("%w: window %s in buckets of %s", ErrInvalidCondition, window, bucketSize)
+	}
+
+	var occurrences []time.Time
+	var retained time.Time
+	var err error
+
+	switch kind {
+	case WarningEvents:
+		occurrences, retained, err = warningEventTimes(namespace)
+	case ContainerRestarts:
+		occurrences, retained, err = restartTimes(namespace)
+	default:
+		return nil, kindUnavailable(kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	end := timeBucketsNow()
+	start := end.Add(-window)
+
+	// the buckets are aligned on the start of the window, occurrences may be missing in the bucket
+	// holding the retained time, the effective start is the next bucket
+	if retained.After(start) {
+		start = start.Add((retained.Sub(start) + bucketSize - 1) / bucketSize * bucketSize)
+	}
+
+	counts := &BucketedCounts{Kind: kind, Namespace: namespace, Start: start, End: end, Buckets: make([]TimeBucket, 0)}
+
+	for bucket := start; bucket.Before(end); bucket = bucket.Add(bucketSize) {
+		counts.Buckets = append(counts.Buckets, TimeBucket{Start: bucket})
+	}
+
+	for _, occurrence := range occurrences {
+		if occurrence.Before(start) || !occurrence.Before(end) {
+			continue
+		}
+		counts.Buckets[occurrence.Sub(start)/bucketSize].Count++
+		counts.Total++
+	}
+
+	return counts, nil
+}
+
+// warningEventTimes returns the last occurrences of the warning events, and the time of the
+// oldest cached event
+func warningEventTimes(namespace string) ([]time.Time, time.Time, error) {
+	events, err := informers.SharedInformerFactory().Core().V1().Events().Lister().Events(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	occurrences := make([]time.Time, 0)
+	var oldest time.Time
+
+	for _, event := range events {
+		occurrence := eventTime(event)
+
+		if oldest.IsZero() || occurrence.Before(oldest) {
+			oldest = occurrence
+		}
+
+		if event.Type == corev1.EventTypeWarning {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	return occurrences, oldest, nil
+}
+
+// eventTime returns the last occurrence of the event, events of the events.k8s.io API only have
+// an event time
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// restartTimes returns the last terminations of the restarted containers, and the time since which
+// no restart is missing
+func restartTimes(namespace string) ([]time.Time, time.Time, error) {
+	pods, err := informers.SharedInformerFactory().Core().V1().Pods().Lister().Pods(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	occurrences := make([]time.Time, 0)
+	var complete time.Time
+
+	for _, pod := range pods {
+		for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+			for _, status := range statuses {
+				terminated := status.LastTerminationState.Terminated
+
+				if status.RestartCount == 0 || terminated == nil {
+					continue
+				}
+
+				occurrences = append(occurrences, terminated.FinishedAt.Time)
+
+				// the previous restarts are before the last one
+				if status.RestartCount > 1 && terminated.FinishedAt.Time.After(complete) {
+					complete = terminated.FinishedAt.Time
+				}
+			}
+		}
+	}
+
+	return occurrences, complete, nil
+}
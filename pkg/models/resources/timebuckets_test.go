@@ -0,0 +1,166 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var bucketsNow = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// setupTimeBuckets sets up the informers of objects and the clock of the buckets, the returned
+// function restores the clock
+func setupTimeBuckets(t *testing.T, objects ...runtime.Object) func() {
+	setupInformers(t, objects...)
+
+	now := timeBucketsNow
+	timeBucketsNow = func() time.Time { return bucketsNow }
+
+	return func() { timeBucketsNow = now }
+}
+
+func event(name, eventType string, ago time.Duration) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Namespace: "demo", Name: name},
+		Type:          eventType,
+		LastTimestamp: metav1.NewTime(bucketsNow.Add(-ago)),
+	}
+}
+
+func restartedPod(name string, restarts int32, ago time.Duration) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: name},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:                 "app",
+			RestartCount:         restarts,
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{FinishedAt: metav1.NewTime(bucketsNow.Add(-ago))}},
+		}}},
+	}
+}
+
+func bucketCounts(counts *BucketedCounts) []int {
+	result := make([]int, 0, len(counts.Buckets))
+	for _, bucket := range counts.Buckets {
+		result = append(result, bucket.Count)
+	}
+	return result
+}
+
+func TestWarningEventBuckets(t *testing.T) {
+	restore := setupTimeBuckets(t,
+		// the oldest cached event is older than the window
+		event("old", corev1.EventTypeNormal, 7*time.Hour),
+		event("before-window", corev1.EventTypeWarning, 6*time.Hour+time.Second),
+		event("window-start", corev1.EventTypeWarning, 6*time.Hour),
+		event("boundary", corev1.EventTypeWarning, 5*time.Hour),
+		event("before-boundary", corev1.EventTypeWarning, 5*time.Hour+time.Second),
+		event("normal", corev1.EventTypeNormal, 3*time.Hour),
+		event("recent", corev1.EventTypeWarning, time.Second),
+		event("now", corev1.EventTypeWarning, 0),
+	)
+	defer restore()
+
+	counts, err := TimeBuckets("demo", WarningEvents, 6*time.Hour, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !counts.Start.Equal(bucketsNow.Add(-6*time.Hour)) || !counts.End.Equal(bucketsNow) {
+		t.Errorf("expected the whole window, got %s to %s", counts.Start, counts.End)
+	}
+
+	if expected := []int{2, 1, 0, 0, 0, 1}; fmt.Sprint(bucketCounts(counts)) != fmt.Sprint(expected) || counts.Total != 4 {
+		t.Errorf("expected %v of 4, got %v of %d", expected, bucketCounts(counts), counts.Total)
+	}
+
+	if !counts.Buckets[1].Start.Equal(bucketsNow.Add(-5 * time.Hour)) {
+		t.Errorf("unexpected start of bucket %s", counts.Buckets[1].Start)
+	}
+}
+
+func TestTimeBucketsRetention(t *testing.T) {
+	// the API server keeps events for 1 hour
+	restore := setupTimeBuckets(t,
+		event("oldest", corev1.EventTypeWarning, 50*time.Minute),
+		event("retained", corev1.EventTypeWarning, 25*time.Minute),
+	)
+	defer restore()
+
+	counts, err := TimeBuckets("demo", WarningEvents, 6*time.Hour, 20*time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the bucket of the oldest event may miss the dropped events
+	if !counts.Start.Equal(bucketsNow.Add(-40 * time.Minute)) {
+		t.Errorf("expected the effective start 40 minutes ago, got %s", bucketsNow.Sub(counts.Start))
+	}
+
+	if expected := []int{1, 0}; fmt.Sprint(bucketCounts(counts)) != fmt.Sprint(expected) || counts.Total != 1 {
+		t.Errorf("expected %v, got %v", expected, bucketCounts(counts))
+	}
+}
+
+func TestRestartBuckets(t *testing.T) {
+	restore := setupTimeBuckets(t,
+		restartedPod("once", 1, 5*time.Hour+30*time.Minute),
+		restartedPod("recently", 1, 10*time.Minute),
+		// the first restart of it isn't retained, it's before 4 hours ago
+		restartedPod("twice", 2, 4*time.Hour+30*time.Minute),
+		restartedPod("never", 0, time.Hour),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "running"}},
+	)
+	defer restore()
+
+	counts, err := TimeBuckets("demo", ContainerRestarts, 6*time.Hour, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !counts.Start.Equal(bucketsNow.Add(-4 * time.Hour)) {
+		t.Errorf("expected the effective start 4 hours ago, got %s", bucketsNow.Sub(counts.Start))
+	}
+
+	if expected := []int{0, 0, 0, 1}; fmt.Sprint(bucketCounts(counts)) != fmt.Sprint(expected) || counts.Total != 1 {
+		t.Errorf("expected %v, got %v", expected, bucketCounts(counts))
+	}
+}
+
+func TestTimeBucketsInvalid(t *testing.T) {
+	defer setupTimeBuckets(t)()
+
+	for _, test := range []struct{ window, bucket time.Duration }{{0, time.Minute}, {time.Hour, 0}, {24 * time.Hour, time.Second}} {
+		if _, err := TimeBuckets("demo", WarningEvents, test.window, test.bucket); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("%s in %s: expected invalid, got %v", test.window, test.bucket, err)
+		}
+	}
+
+	if _, err := TimeBuckets("demo", Pods, time.Hour, time.Minute); !errors.Is(err, ErrKindUnavailable) {
+		t.Errorf("expected kind unavailable, got %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kubesphere.io/kubesphere/pkg/informers"
+	"kubesphere.io/kubesphere/pkg/models"
+	sliceutils "kubesphere.io/kubesphere/pkg/utils"
+)
+
+const (
+	// max nodes of a topology graph, nodes beyond it will be dropped
+	topologyMaxNodes = 500
+
+	EdgeSelects = "selects"
+	EdgeRoutes  = "routes"
+	EdgeMounts  = "mounts"
+)
+
+type TopologyNode struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type TopologyEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+type TopologyGraph struct {
+	Namespace string         `json:"namespace"`
+	Nodes     []TopologyNode `json:"nodes"`
+	Edges     []TopologyEdge `json:"edges"`
+	// Truncated is set when the namespace has more nodes than the graph can hold,
+	// TotalNodes is the node count before truncation.
+	Truncated  bool `json:"truncated"`
+	TotalNodes int  `json:"total_nodes"`
+	// Warnings has a truncation warning if the graph is truncated
+	Warnings []models.SearchWarning `json:"warnings,omitempty"`
+}
+
+// workload in topology graph, with the pod template it manages
+type topologyWorkload struct {
+	node     TopologyNode
+	template *corev1.PodTemplateSpec
+	// volume claim templates of statefulset
+	claimTemplates []string
+}
+
+func topologyNodeID(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+func newTopologyNode(kind, namespace, name string, labels map[string]string) TopologyNode {
+	return TopologyNode{ID: topologyNodeID(kind, namespace, name), Kind: kind, Namespace: namespace, Name: name, Labels: labels}
+}
+
+// Topology builds the dependency graph of workloads, services, ingresses and persistent volume claims in the namespace.
+func Topology(namespace string) (*TopologyGraph, error) {
+	return buildTopology(namespace, topologyMaxNodes)
+}
+
+func buildTopology(namespace string, maxNodes int) (*TopologyGraph, error) {
+	workloads, err := listTopologyWorkloads(namespace)
+
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := informers.SharedInformerFactory().Core().V1().Services().Lister().Services(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	ingresses, err := informers.SharedInformerFactory().Extensions().V1beta1().Ingresses().Lister().Ingresses(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	persistentVolumeClaims, err := informers.SharedInformerFactory().Core().V1().PersistentVolumeClaims().Lister().PersistentVolumeClaims(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]TopologyNode, 0)
+	edges := make([]TopologyEdge, 0)
+
+	for _, workload := range workloads {
+		nodes = append(nodes, workload.node)
+	}
+
+	for _, service := range services {
+		serviceNode := newTopologyNode(Services, service.Namespace, service.Name, service.Labels)
+		nodes = append(nodes, serviceNode)
+
+		// service without selector is backed by manually managed endpoints
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+
+		selector := labels.SelectorFromSet(service.Spec.Selector)
+
+		for _, workload := range workloads {
+			if selector.Matches(labels.Set(workload.template.Labels)) {
+				edges = append(edges, TopologyEdge{Source: serviceNode.ID, Target: workload.node.ID, Type: EdgeSelects})
+			}
+		}
+	}
+
+	for _, ingress := range ingresses {
+		ingressNode := newTopologyNode(Ingresses, ingress.Namespace, ingress.Name, ingress.Labels)
+		nodes = append(nodes, ingressNode)
+
+		for _, serviceName := range ingressBackendServices(ingress) {
+			edges = append(edges, TopologyEdge{Source: ingressNode.ID, Target: topologyNodeID(Services, ingress.Namespace, serviceName), Type: EdgeRoutes})
+		}
+	}
+
+	for _, persistentVolumeClaim := range persistentVolumeClaims {
+		claimNode := newTopologyNode(PersistentVolumeClaims, persistentVolumeClaim.Namespace, persistentVolumeClaim.Name, persistentVolumeClaim.Labels)
+		nodes = append(nodes, claimNode)
+
+		for _, workload := range workloads {
+			if workloadMountsClaim(workload, persistentVolumeClaim.Name) {
+				edges = append(edges, TopologyEdge{Source: workload.node.ID, Target: claimNode.ID, Type: EdgeMounts})
+			}
+		}
+	}
+
+	graph := &TopologyGraph{Namespace: namespace, TotalNodes: len(nodes)}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	if maxNodes >= 0 && len(nodes) > maxNodes {
+		nodes = nodes[:maxNodes]
+		graph.Truncated = true
+		graph.Warnings = []models.SearchWarning{{Code: models.WarningTruncated, Namespace: namespace, Message: fmt.Sprintf("graph truncated to %d of %d nodes", maxNodes, graph.TotalNodes)}}
+	}
+
+	exists := make(map[string]bool, len(nodes))
+
+	for _, node := range nodes {
+		exists[node.ID] = true
+	}
+
+	graph.Nodes = nodes
+	graph.Edges = make([]TopologyEdge, 0)
+
+	for _, edge := range edges {
+		// edges to dropped or missing nodes (e.g. ingress backend not exist) are ignored
+		if exists[edge.Source] && exists[edge.Target] {
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Target < graph.Edges[j].Target
+	})
+
+	return graph, nil
+}
+
+func listTopologyWorkloads(namespace string) ([]topologyWorkload, error) {
+	workloads := make([]topologyWorkload, 0)
+
+	deployments, err := informers.SharedInformerFactory().Apps().V1().Deployments().Lister().Deployments(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range deployments {
+		workloads = append(workloads, topologyWorkload{node: newTopologyNode(Deployments, item.Namespace, item.Name, item.Labels), template: &item.Spec.Template})
+	}
+
+	statefulSets, err := informers.SharedInformerFactory().Apps().V1().StatefulSets().Lister().StatefulSets(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range statefulSets {
+		workload := topologyWorkload{node: newTopologyNode(StatefulSets, item.Namespace, item.Name, item.Labels), template: &item.Spec.Template}
+		for _, claimTemplate := range item.Spec.VolumeClaimTemplates {
+			// claims created by statefulset are named as <template>-<statefulset>-<ordinal>
+			workload.claimTemplates = append(workload.claimTemplates, fmt.Sprintf("%s-%s-", claimTemplate.Name, item.Name))
+		}
+		workloads = append(workloads, workload)
+	}
+
+	daemonSets, err := informers.SharedInformerFactory().Apps().V1().DaemonSets().Lister().DaemonSets(namespace).List(labels.Everything())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range daemonSets {
+		workloads = append(workloads, topologyWorkload{node: newTopologyNode(DaemonSets, item.Namespace, item.Name, item.Labels), template: &item.Spec.Template})
+	}
+
+	return workloads, nil
+}
+
+func workloadMountsClaim(workload topologyWorkload, claimName string) bool {
+	for _, volume := range workload.template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claimName {
+			return true
+		}
+	}
+	for _, prefix := range workload.claimTemplates {
+		if strings.HasPrefix(claimName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func ingressBackendServices(ingress *v1beta1.Ingress) []string {
+	services := make([]string, 0)
+
+	if ingress.Spec.Backend != nil && ingress.Spec.Backend.ServiceName != "" {
+		services = append(services, ingress.Spec.Backend.ServiceName)
+	}
+
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.ServiceName != "" && !sliceutils.HasString(services, path.Backend.ServiceName) {
+				services = append(services, path.Backend.ServiceName)
+			}
+		}
+	}
+
+	return services
+}
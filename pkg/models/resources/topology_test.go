@@ -0,0 +1,147 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/models"
+)
+
+func podTemplate(labels map[string]string, volumes ...corev1.Volume) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: labels},
+		Spec:       corev1.PodSpec{Volumes: volumes},
+	}
+}
+
+// two-tier app: frontend deployment exposed by an ingress, mysql statefulset with a volume claim template,
+// a worker matched by no service and a service shared by both tiers
+func twoTierApp() []runtime.Object {
+	return []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "frontend"},
+			Spec: appsv1.DeploymentSpec{Template: podTemplate(map[string]string{"app": "shop", "tier": "frontend"},
+				corev1.Volume{Name: "static", VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "static-files"}}})},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "worker"},
+			Spec:       appsv1.DeploymentSpec{Template: podTemplate(map[string]string{"app": "worker"})},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "mysql"},
+			Spec: appsv1.StatefulSetSpec{
+				Template:             podTemplate(map[string]string{"app": "shop", "tier": "db"}),
+				VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{ObjectMeta: metav1.ObjectMeta{Name: "data"}}},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "frontend"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"tier": "frontend"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "mysql"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"tier": "db"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "shop"},
+			Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "shop"}},
+		},
+		&v1beta1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "shop"},
+			Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{{
+				IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: []v1beta1.HTTPIngressPath{
+					{Path: "/", Backend: v1beta1.IngressBackend{ServiceName: "frontend"}},
+					{Path: "/missing", Backend: v1beta1.IngressBackend{ServiceName: "not-exist"}},
+				}}},
+			}}},
+		},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "static-files"}},
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Namespace: "demo", Name: "data-mysql-0"}},
+	}
+}
+
+func TestTopology(t *testing.T) {
+	setupInformers(t, twoTierApp()...)
+
+	graph, err := Topology("demo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if graph.Truncated || graph.TotalNodes != 9 || len(graph.Nodes) != 9 {
+		t.Fatalf("unexpected graph size: truncated %v, total %d, nodes %d", graph.Truncated, graph.TotalNodes, len(graph.Nodes))
+	}
+
+	expected := []TopologyEdge{
+		{Source: "deployments/demo/frontend", Target: "persistentvolumeclaims/demo/static-files", Type: EdgeMounts},
+		{Source: "ingresses/demo/shop", Target: "services/demo/frontend", Type: EdgeRoutes},
+		{Source: "services/demo/frontend", Target: "deployments/demo/frontend", Type: EdgeSelects},
+		{Source: "services/demo/mysql", Target: "statefulsets/demo/mysql", Type: EdgeSelects},
+		{Source: "services/demo/shop", Target: "deployments/demo/frontend", Type: EdgeSelects},
+		{Source: "services/demo/shop", Target: "statefulsets/demo/mysql", Type: EdgeSelects},
+		{Source: "statefulsets/demo/mysql", Target: "persistentvolumeclaims/demo/data-mysql-0", Type: EdgeMounts},
+	}
+
+	if !reflect.DeepEqual(graph.Edges, expected) {
+		t.Errorf("unexpected edges:\n got %v\nwant %v", graph.Edges, expected)
+	}
+
+	for _, edge := range graph.Edges {
+		if edge.Source == "deployments/demo/worker" || edge.Target == "deployments/demo/worker" {
+			t.Errorf("worker is not selected by any service but got edge %v", edge)
+		}
+	}
+}
+
+func TestTopologyTruncated(t *testing.T) {
+	setupInformers(t, twoTierApp()...)
+
+	graph, err := buildTopology("demo", 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !graph.Truncated || graph.TotalNodes != 9 || len(graph.Nodes) != 3 {
+		t.Fatalf("expected truncated graph, got truncated %v, total %d, nodes %d", graph.Truncated, graph.TotalNodes, len(graph.Nodes))
+	}
+
+	if len(graph.Warnings) != 1 || graph.Warnings[0].Code != models.WarningTruncated {
+		t.Errorf("expected truncation warning, got %+v", graph.Warnings)
+	}
+
+	ids := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		ids[node.ID] = true
+	}
+
+	for _, edge := range graph.Edges {
+		if !ids[edge.Source] || !ids[edge.Target] {
+			t.Errorf("edge %v refers to truncated node", edge)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// max items of a namespace in a workspace search, the items beyond it are dropped before the
+// limit of the search so that one huge namespace can't crowd out the others
+const workspaceSearchNamespaceMax = 100
+
+// NamespaceResultCount counts the items of a namespace in a workspace search. Total is the number of
+// matching items, Returned the number of them in the result after the namespace cap and the limit.
+type NamespaceResultCount struct {
+	Total    int  `json:"total"`
+	Returned int  `json:"returned"`
+	Capped   bool `json:"capped"`
+}
+
+// WorkspaceSearchResult is the merged result of a search in the namespaces of a workspace
+type WorkspaceSearchResult struct {
+	Workspace  string        `json:"workspace"`
+	Items      []interface{} `json:"items"`
+	TotalCount int           `json:"total_count"`
+	// Namespaces counts the items of every member namespace searched
+	Namespaces map[string]NamespaceResultCount `json:"namespaces"`
+	// Warnings has a truncation warning for every capped namespace, and the warnings of the
+	// namespaces which couldn't be searched
+	Warnings []models.SearchWarning `json:"warnings,omitempty"`
+}
+
+// SearchInWorkspace searches the resources of kind in the namespaces of workspace concurrently, and
+// merges the results sorted by orderBy across namespaces. At most workspaceSearchNamespaceMax items of
+// each namespace are kept, then limit items of the merged result are returned, limit -1 returns them
+// all. The items are copies of the cached objects. A namespace which can't be searched is reported
+// with a warning as in SearchAll.
+func SearchInWorkspace(ctx context.Context, workspace, kind string, conditions *params.Conditions, orderBy string, reverse bool, limit int) (*WorkspaceSearchResult, error) {
+	return searchInWorkspace(ctx, workspace, kind, conditions, orderBy, reverse, limit, workspaceSearchNamespaceMax)
+}
+
+func searchInWorkspace(ctx context.Context, workspaceName, kind string, conditions *params.Conditions, orderBy string, reverse bool, limit, namespaceMax int) (*WorkspaceSearchResult, error) {
+	kind, err := ResolveKind(kind)
+
+	if err != nil {
+		return nil, err
+	}
+
+	searcher, ok := namespacedResources[kind]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is cluster scoped, it doesn't belong to workspaces", ErrInvalidScope, kind)
+	}
+
+	if workspaceName == "" {
+		return nil, fmt.Errorf("%w: workspace is required", ErrInvalidCondition)
+	}
+
+	if err := validateConditions(conditions); err != nil {
+		return nil, err
+	}
+
+	if err := validateOrderBy(kind, orderBy); err != nil {
+		return nil, err
+	}
+
+	namespaces, err := searchResources(ctx, Namespaces, "", &params.Conditions{Match: map[string]string{workspace: workspaceName}}, name, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]SearchRequest, 0, len(namespaces))
+
+	for _, namespace := range namespaces {
+		object, err := meta.Accessor(namespace)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, SearchRequest{Kind: kind, Namespace: object.GetName(), Conditions: conditions, OrderBy: orderBy, Reverse: reverse})
+	}
+
+	results, warnings, err := SearchAll(ctx, requests)
+
+	if err != nil {
+		return nil, err
+	}
+
+	type namespacedItem struct {
+		namespace string
+		item      interface{}
+	}
+
+	counts := make(map[string]NamespaceResultCount, len(requests))
+	merged := make([]namespacedItem, 0)
+	total := 0
+
+	for i, result := range results {
+		// the namespace is reported by a warning
+		if result == nil {
+			continue
+		}
+
+		namespace := requests[i].Namespace
+		items := result.Items
+		count := NamespaceResultCount{Total: len(items)}
+
+		if len(items) > namespaceMax {
+			items = items[:namespaceMax]
+			count.Capped = true
+			warnings = append(warnings, models.SearchWarning{
+				Code:      models.WarningTruncated,
+				Kind:      kind,
+				Namespace: namespace,
+				Message:   fmt.Sprintf("%d of %d %s of the namespace searched", namespaceMax, len(result.Items), kind),
+			})
+		}
+
+		for _, item := range items {
+			merged = append(merged, namespacedItem{namespace: namespace, item: item})
+		}
+
+		counts[namespace] = count
+		total += count.Total
+	}
+
+	// the results of the namespaces are sorted already, items equal by orderBy stay in order of namespaces
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i].item, merged[j].item
+		if reverse {
+			a, b = b, a
+		}
+		return searcher.less(a, b, orderBy) && !searcher.less(b, a, orderBy)
+	})
+
+	if limit >= 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+
+	items := make([]interface{}, 0, len(merged))
+	for _, item := range merged {
+		items = append(items, item.item)
+		count := counts[item.namespace]
+		count.Returned++
+		counts[item.namespace] = count
+	}
+
+	page := pageResult(kind, items, -1, 0, false)
+
+	return &WorkspaceSearchResult{
+		Workspace:  workspaceName,
+		Items:      page.Items,
+		TotalCount: total,
+		Namespaces: counts,
+		Warnings:   append(warnings, page.Warnings...),
+	}, nil
+}
@@ -0,0 +1,156 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"kubesphere.io/kubesphere/pkg/constants"
+	"kubesphere.io/kubesphere/pkg/models"
+	"kubesphere.io/kubesphere/pkg/params"
+)
+
+// workspaceFixtures returns the namespaces big, medium and small of ws1 with 30, 5 and 1 deployments,
+// and the namespace other of ws2
+func workspaceFixtures() []runtime.Object {
+	objects := make([]runtime.Object, 0)
+	sizes := []struct {
+		namespace, workspace string
+		deployments          int
+	}{
+		{"big", "ws1", 30},
+		{"medium", "ws1", 5},
+		{"small", "ws1", 1},
+		{"other", "ws2", 3},
+	}
+
+	for _, size := range sizes {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: size.namespace, Labels: map[string]string{constants.WorkspaceLabelKey: size.workspace}}})
+		for i := 0; i < size.deployments; i++ {
+			objects = append(objects, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: size.namespace, Name: fmt.Sprintf("%s-%02d", size.namespace, i)}})
+		}
+	}
+
+	return objects
+}
+
+func itemNames(items []interface{}) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.(*appsv1.Deployment).Name)
+	}
+	return names
+}
+
+func TestSearchInWorkspace(t *testing.T) {
+	factory := setupInformers(t, workspaceFixtures()...)
+
+	result, err := searchInWorkspace(context.Background(), "ws1", "deploy", &params.Conditions{}, name, false, 12, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// big is capped to 10 items, so medium still makes it into the first 12
+	expected := []string{"big-00", "big-01", "big-02", "big-03", "big-04", "big-05", "big-06", "big-07", "big-08", "big-09", "medium-00", "medium-01"}
+
+	if names := itemNames(result.Items); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	if result.TotalCount != 36 {
+		t.Errorf("expected the matches of ws1 counted, got %d", result.TotalCount)
+	}
+
+	counts := map[string]NamespaceResultCount{
+		"big":    {Total: 30, Returned: 10, Capped: true},
+		"medium": {Total: 5, Returned: 2},
+		"small":  {Total: 1},
+	}
+
+	if !reflect.DeepEqual(result.Namespaces, counts) {
+		t.Errorf("expected %+v, got %+v", counts, result.Namespaces)
+	}
+
+	if len(result.Warnings) != 1 || result.Warnings[0].Code != models.WarningTruncated || result.Warnings[0].Namespace != "big" {
+		t.Errorf("expected the cap of big reported, got %+v", result.Warnings)
+	}
+
+	// the items are copies
+	if cached, err := factory.Apps().V1().Deployments().Lister().Deployments("big").Get("big-00"); err != nil || result.Items[0] == interface{}(cached) {
+		t.Errorf("expected a copy of the cached object, got %v", err)
+	}
+
+	// merged in reverse order across namespaces
+	result, err = searchInWorkspace(context.Background(), "ws1", Deployments, &params.Conditions{}, name, true, 3, 10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := itemNames(result.Items); !reflect.DeepEqual(names, []string{"small-00", "medium-04", "medium-03"}) {
+		t.Errorf("expected the last names first, got %v", names)
+	}
+
+	// without cap nor limit
+	result, err = SearchInWorkspace(context.Background(), "ws1", Deployments, &params.Conditions{Fuzzy: map[string]string{name: "-0"}}, "", false, -1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Items) != 16 || len(result.Warnings) != 0 || result.Namespaces["big"].Returned != 10 {
+		t.Errorf("expected every match of ws1, got %v %+v", itemNames(result.Items), result.Namespaces)
+	}
+}
+
+func TestSearchInWorkspaceErrors(t *testing.T) {
+	setupInformers(t, workspaceFixtures()...)
+
+	tests := []struct {
+		workspace, kind, orderBy string
+		err                      error
+	}{
+		{workspace: "ws1", kind: Nodes, err: ErrInvalidScope},
+		{workspace: "", kind: Deployments, err: ErrInvalidCondition},
+		{workspace: "ws1", kind: Deployments, orderBy: "lastScheduleTime", err: ErrInvalidOrder},
+		{workspace: "ws1", kind: "unknown", err: ErrKindUnavailable},
+	}
+
+	for _, test := range tests {
+		if _, err := SearchInWorkspace(context.Background(), test.workspace, test.kind, &params.Conditions{}, test.orderBy, false, 10); !errors.Is(err, test.err) {
+			t.Errorf("%s in %q: expected %v, got %v", test.kind, test.workspace, test.err, err)
+		}
+	}
+
+	// a workspace without namespace has an empty result
+	result, err := SearchInWorkspace(context.Background(), "ws3", Deployments, &params.Conditions{}, "", false, 10)
+
+	if err != nil || len(result.Items) != 0 || len(result.Namespaces) != 0 {
+		t.Errorf("expected an empty result, got %+v %v", result, err)
+	}
+}
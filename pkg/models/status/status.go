@@ -18,6 +18,8 @@
 package status
 
 import (
+	"context"
+
 	"kubesphere.io/kubesphere/pkg/models"
 	"kubesphere.io/kubesphere/pkg/params"
 
@@ -28,31 +30,46 @@ type workLoadStatus struct {
 	Namespace string                 `json:"namespace"`
 	Count     map[string]int         `json:"data"`
 	Items     map[string]interface{} `json:"items,omitempty"`
+	Warnings  []models.SearchWarning `json:"warnings,omitempty"`
 }
 
-func GetNamespacesResourceStatus(namespace string) (*workLoadStatus, error) {
+func GetNamespacesResourceStatus(ctx context.Context, namespace string) (*workLoadStatus, error) {
 	res := workLoadStatus{Count: make(map[string]int), Namespace: namespace, Items: make(map[string]interface{})}
-	var notReadyList *models.PageableResponse
-	var err error
+
+	var requests []resources.SearchRequest
 	for _, resource := range []string{resources.Deployments, resources.StatefulSets, resources.DaemonSets, resources.PersistentVolumeClaims} {
 		notReadyStatus := "updating"
 		if resource == resources.PersistentVolumeClaims {
 			notReadyStatus = "pending"
 		}
 
-		notReadyList, err = resources.ListNamespaceResource(namespace, resource, &params.Conditions{Match: map[string]string{"status": notReadyStatus}}, "", false, -1, 0)
+		conditions := &params.Conditions{Match: map[string]string{"status": notReadyStatus}}
+
+		requests = append(requests, resources.SearchRequest{Kind: resource, Namespace: namespace, Conditions: conditions})
+	}
+
+	notReadyLists, warnings, err := resources.SearchAll(ctx, requests)
+
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
+	for i, notReadyList := range notReadyLists {
+		// timed out, reported in warnings
+		if notReadyList == nil {
+			continue
 		}
+		res.Count[requests[i].Kind] = notReadyList.TotalCount
+	}
 
-		res.Count[resource] = notReadyList.TotalCount
+	if len(warnings) > 0 {
+		res.Warnings = warnings
 	}
 
 	return &res, nil
 }
 
-func GetClusterResourceStatus() (*workLoadStatus, error) {
+func GetClusterResourceStatus(ctx context.Context) (*workLoadStatus, error) {
 
-	return GetNamespacesResourceStatus("")
+	return GetNamespacesResourceStatus(ctx, "")
 }
@@ -25,8 +25,9 @@ import (
 )
 
 type PageableResponse struct {
-	Items      []interface{} `json:"items"`
-	TotalCount int           `json:"total_count"`
+	Items      []interface{}   `json:"items"`
+	TotalCount int             `json:"total_count"`
+	Warnings   []SearchWarning `json:"warnings,omitempty"`
 }
 
 type Workspace struct {
@@ -99,6 +100,16 @@ type User struct {
 	WorkspaceRules map[string][]SimpleRule `json:"workspace_rules,omitempty"`
 }
 
+// WorkspaceMember is a user bound to roles of a workspace, Role is the highest privileged of Roles
+// and Since the creation of its binding.
+type WorkspaceMember struct {
+	Workspace string    `json:"workspace"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Roles     []string  `json:"roles"`
+	Since     time.Time `json:"since"`
+}
+
 type Group struct {
 	Path        string   `json:"path"`
 	Name        string   `json:"name"`
@@ -134,4 +145,30 @@ type Token struct {
 type ResourceQuota struct {
 	Namespace string                  `json:"namespace"`
 	Data      v12.ResourceQuotaStatus `json:"data"`
+	Warnings  []SearchWarning         `json:"warnings,omitempty"`
+}
+
+// Codes of SearchWarning, clients may rely on them.
+const (
+	// WarningTimeout is the code of a search which didn't complete in time
+	WarningTimeout = "Timeout"
+	// WarningKindUnavailable is the code of a search of a kind without searcher
+	WarningKindUnavailable = "KindUnavailable"
+	// WarningStaleCache is the code of a search skipped because the cache of the kind isn't synced
+	WarningStaleCache = "StaleCache"
+	// WarningTruncated is the code of a result cut to its maximum size
+	WarningTruncated = "Truncated"
+	// WarningLargeObject is the code of an object of a result larger than the large object threshold
+	WarningLargeObject = "LargeObject"
+	// WarningPartialCache is the code of a result of a kind whose cache holds the objects matching a
+	// label selector only, the objects of other tenants aren't searched
+	WarningPartialCache = "PartialCache"
+)
+
+// SearchWarning reports a result which is incomplete, Code tells why.
+type SearchWarning struct {
+	Code      string `json:"code"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Message   string `json:"message"`
 }
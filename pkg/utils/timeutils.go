@@ -0,0 +1,111 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeFormatParameter is the query parameter selecting how the times of a response are rendered
+const TimeFormatParameter = "timeFormat"
+
+// time formats
+const (
+	// TimeRFC3339 renders a time as RFC 3339 in UTC, the default
+	TimeRFC3339 = "rfc3339"
+	// TimeUnix renders a time as seconds since the epoch
+	TimeUnix = "unix"
+	// TimeHumanAge renders the time elapsed since a time the way kubectl renders ages
+	TimeHumanAge = "humanAge"
+)
+
+// ParseTimeFormat validates a time format, the empty format is TimeRFC3339
+func ParseTimeFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return TimeRFC3339, nil
+	case TimeRFC3339, TimeUnix, TimeHumanAge:
+		return format, nil
+	default:
+		return "", fmt.Errorf("time format must be %s, %s or %s, got %s", TimeRFC3339, TimeUnix, TimeHumanAge, format)
+	}
+}
+
+// FormatTime renders t in format, ages are computed against now. The zero time renders empty.
+func FormatTime(t time.Time, format string, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	switch format {
+	case TimeUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimeHumanAge:
+		return HumanAge(now.Sub(t))
+	default:
+		return t.UTC().Format(time.RFC3339)
+	}
+}
+
+// HumanAge renders d with the abbreviations of kubectl, the precision decreases as d grows, e.g.
+// 90s, 5m30s, 2h15m, 3d4h, 2y30d. A slightly negative duration, from clock skew, is 0s.
+func HumanAge(d time.Duration) string {
+	if seconds := int(d.Seconds()); seconds < -1 {
+		return "<invalid>"
+	} else if seconds < 0 {
+		return "0s"
+	} else if seconds < 60*2 {
+		return fmt.Sprintf("%ds", seconds)
+	}
+
+	minutes := int(d / time.Minute)
+	if minutes < 10 {
+		if seconds := int(d/time.Second) % 60; seconds != 0 {
+			return fmt.Sprintf("%dm%ds", minutes, seconds)
+		}
+		return fmt.Sprintf("%dm", minutes)
+	} else if minutes < 60*3 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+
+	hours := int(d / time.Hour)
+	if hours < 8 {
+		if minutes := minutes % 60; minutes != 0 {
+			return fmt.Sprintf("%dh%dm", hours, minutes)
+		}
+		return fmt.Sprintf("%dh", hours)
+	} else if hours < 48 {
+		return fmt.Sprintf("%dh", hours)
+	} else if hours < 24*8 {
+		if remainder := hours % 24; remainder != 0 {
+			return fmt.Sprintf("%dd%dh", hours/24, remainder)
+		}
+		return fmt.Sprintf("%dd", hours/24)
+	} else if hours < 24*365*2 {
+		return fmt.Sprintf("%dd", hours/24)
+	} else if hours < 24*365*8 {
+		if days := hours / 24 % 365; days != 0 {
+			return fmt.Sprintf("%dy%dd", hours/24/365, days)
+		}
+		return fmt.Sprintf("%dy", hours/24/365)
+	}
+
+	return fmt.Sprintf("%dy", hours/24/365)
+}
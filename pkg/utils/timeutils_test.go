@@ -0,0 +1,90 @@
+/*
+
+ Copyright 2019 The KubeSphere Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+
+*/
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanAge(t *testing.T) {
+	tests := []struct {
+		age      time.Duration
+		expected string
+	}{
+		// just created, or created a bit later by a skewed clock
+		{age: 0, expected: "0s"},
+		{age: -time.Second / 2, expected: "0s"},
+		{age: -time.Minute, expected: "<invalid>"},
+		{age: 119 * time.Second, expected: "119s"},
+		{age: 2 * time.Minute, expected: "2m"},
+		{age: 5*time.Minute + 30*time.Second, expected: "5m30s"},
+		{age: 150 * time.Minute, expected: "150m"},
+		{age: 3 * time.Hour, expected: "3h"},
+		{age: 7*time.Hour + 59*time.Minute, expected: "7h59m"},
+		{age: 47 * time.Hour, expected: "47h"},
+		{age: 48 * time.Hour, expected: "2d"},
+		{age: 76 * time.Hour, expected: "3d4h"},
+		{age: 8 * 24 * time.Hour, expected: "8d"},
+		{age: 729 * 24 * time.Hour, expected: "729d"},
+		// multi-year
+		{age: 2 * 365 * 24 * time.Hour, expected: "2y"},
+		{age: (3*365 + 45) * 24 * time.Hour, expected: "3y45d"},
+		{age: 10 * 365 * 24 * time.Hour, expected: "10y"},
+	}
+
+	for _, test := range tests {
+		if age := HumanAge(test.age); age != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.age, test.expected, age)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	now := time.Date(2019, 6, 1, 10, 30, 0, 0, time.UTC)
+	created := time.Date(2019, 6, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{format: TimeRFC3339, expected: "2019-06-01T00:00:00Z"},
+		{format: TimeUnix, expected: "1559347200"},
+		{format: TimeHumanAge, expected: "10h"},
+	}
+
+	for _, test := range tests {
+		if formatted := FormatTime(created, test.format, now); formatted != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.format, test.expected, formatted)
+		}
+	}
+
+	if formatted := FormatTime(time.Time{}, TimeHumanAge, now); formatted != "" {
+		t.Errorf("expected the zero time renders empty, got %s", formatted)
+	}
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	if format, err := ParseTimeFormat(""); err != nil || format != TimeRFC3339 {
+		t.Errorf("expected the default format %s, got %s %v", TimeRFC3339, format, err)
+	}
+
+	if _, err := ParseTimeFormat("age"); err == nil {
+		t.Errorf("expected unknown format fails")
+	}
+}